@@ -1,12 +1,22 @@
-module sprout
-
-go 1.24.0
-
-require (
-	github.com/Data-Corruption/lmdb-go v1.2.1
-	github.com/Data-Corruption/stdx v0.4.3
-	github.com/go-chi/chi/v5 v5.2.3
-	github.com/urfave/cli/v3 v3.6.1
-	golang.org/x/mod v0.31.0
-	golang.org/x/sys v0.39.0
-)
+module sprout
+
+go 1.24.0
+
+require (
+	github.com/Data-Corruption/lmdb-go v1.2.1
+	github.com/Data-Corruption/stdx v0.4.3
+	github.com/go-chi/chi/v5 v5.2.3
+	github.com/quic-go/quic-go v0.59.1
+	github.com/urfave/cli/v3 v3.6.1
+	go.etcd.io/bbolt v1.4.3
+	golang.org/x/crypto v0.46.0
+	golang.org/x/mod v0.31.0
+	golang.org/x/sys v0.39.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/quic-go/qpack v0.6.0 // indirect
+	golang.org/x/net v0.47.0 // indirect
+	golang.org/x/text v0.32.0 // indirect
+)
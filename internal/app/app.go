@@ -5,21 +5,31 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io/fs"
+	"net/http"
 	"os"
 	"os/user"
 	"path/filepath"
+	"slices"
 	"sprout/internal/build"
 	"sprout/internal/platform/database"
 	"sprout/internal/platform/database/config"
+	"sprout/internal/platform/database/kv"
+	"sprout/internal/platform/httpclient"
+	"sprout/internal/platform/ids"
+	"sprout/internal/platform/lifecycle"
+	"sprout/internal/platform/notify"
 	"sprout/internal/platform/release"
+	"sprout/internal/platform/storage"
 	"sprout/internal/types"
 	"sprout/internal/ui"
+	"sprout/pkg/migrator"
+	"sprout/pkg/progress"
 	"sprout/pkg/x"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/Data-Corruption/lmdb-go/wrap"
 	"github.com/Data-Corruption/stdx/xhttp"
 	"github.com/Data-Corruption/stdx/xlog"
 	"github.com/urfave/cli/v3"
@@ -28,6 +38,10 @@ import (
 
 type CleanupFunc func() error
 
+// DevUIDir is where dev mode loads templates and assets from, relative to the
+// working directory (i.e. run from the repo root).
+const DevUIDir = "internal/ui"
+
 /*
 App represents the application, following the dependency injection pattern.
 
@@ -40,25 +54,48 @@ It provides:
 type App struct {
 	// injected services, etc.
 
-	DB            *wrap.DB
+	DB            kv.DB
 	Log           *xlog.Logger
 	Server        *xhttp.Server
 	UI            *ui.UI
+	Notify        *notify.Dispatcher
+	Storage       *storage.Monitor // disk usage, while `service run` serves
+	HTTP          *http.Client
 	BaseURL       string // e.g., "https://example.com"
 	UserAgent     string // e.g., "Mozilla/5.0 (compatible; <Name>/1.2.3; +<ContactURL>)"
 	StorageDir    string // (e.g., ~/.<Name>)
 	RuntimeDir    string // (e.g., XDG_RUNTIME_DIR/<Name>, fallback to /tmp/<Name>-USER)
 	TempDir       string // (e.g., StorageDir/tmp)
 	ReleaseSource release.ReleaseSource
+	IDs           ids.Generator   // unit name suffixes, tokens, etc. Replaced in tests for determinism
+	Dev           bool            // --dev, see Init for what it changes
+	SkipDB        bool            // Init stops before opening the database, for commands that repair it
+	StartedAt     time.Time       // process start, for uptime
 	buildInfo     build.BuildInfo // read-only
 
+	// skip release signature checks when updating (--insecure-skip-verify), checksums are still checked
+	InsecureSkipVerify bool
+	// native updates stop every instance, migrate once and start them again (update --all-instances)
+	AllInstances bool
+	// bearer token for private release hosts (config releaseToken, else RELEASE_TOKEN env), never logged
+	releaseToken string
+	// outbound client settings HTTP was built with, passed on to the install script
+	outbound httpclient.Options
+	// see AddUpdateHook
+	updateHooks []UpdateHook
+	// migration lock file, held shared by mguard. NativeUpdate takes it exclusively to migrate
+	guard *os.File
+	// see OnReload
+	reload reloader
+
 	// lifecycle management
 
 	cleanup       []CleanupFunc
 	cleanupOnce   sync.Once
 	postCleanup   CleanupFunc
 	postCleanupMu sync.Mutex
-	uOnce         sync.Once // prep update only once before exiting
+	uMu           sync.Mutex
+	uStarted      bool // an update was started, see updateOnce
 	// Inside commands, you can use <-a.Context.Done() to check for cancellation.
 	// You don't need to do this for the example service, the http server
 	// wrapper has its own signal listener.
@@ -67,6 +104,8 @@ type App struct {
 
 func New(buildInfo build.BuildInfo) *App {
 	return &App{
+		IDs:       ids.Random{},
+		StartedAt: time.Now(),
 		buildInfo: buildInfo,
 	}
 }
@@ -76,32 +115,52 @@ func (a *App) BuildInfo() build.BuildInfo {
 }
 
 func (a *App) Init(ctx context.Context, cmd *cli.Command) (context.Context, error) {
-	// paths
+	// paths, may be preset (e.g. by tests) to skip the home / runtime dir lookup
 	var err error
-	if a.StorageDir, err = getStoragePath(a.buildInfo.Name); err != nil {
-		return nil, err
+	if a.StorageDir == "" {
+		if a.StorageDir, err = getStoragePath(a.buildInfo.Name); err != nil {
+			return nil, err
+		}
 	}
-	if a.RuntimeDir, err = getRuntimePath(a.buildInfo.Name); err != nil {
-		return nil, err
+	if a.RuntimeDir == "" {
+		if a.RuntimeDir, err = getRuntimePath(a.buildInfo.Name); err != nil {
+			return nil, err
+		}
 	}
 	a.TempDir = filepath.Join(a.StorageDir, "tmp")
 	if err := os.MkdirAll(a.TempDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create temp dir: %w", err)
 	}
 
+	/* dev mode:
+	- templates / assets load from DevUIDir on every use
+	- debug logging unless --log is given
+	- works on a throwaway copy of the database
+	- no migration guard (nothing for the installer to wait on), no update checks or installs
+	- relaxed CSP, no https redirect (see router)
+	*/
+	a.Dev = cmd.Bool("dev")
+
 	// migration guard before touching anything
-	if !cmd.Bool("migrate") {
+	switch {
+	case cmd.Bool("migrate"):
+		// migrate flag set, we are the migrator instance, proceed without guard
+		fmt.Printf("%s version %s\n", a.buildInfo.Name, a.buildInfo.Version)
+	case a.Dev:
+		// skip, dev instances never touch the real database
+	default:
 		if err := a.mguard(); err != nil {
 			return ctx, fmt.Errorf("failed to setup migration guard: %w", err)
 		}
-	} else {
-		// migrate flag set, we are the migrator instance, proceed without guard
-		fmt.Printf("%s version %s\n", a.buildInfo.Name, a.buildInfo.Version)
 	}
 
 	// logger
-	logOverride := cmd.String("log") != ""
-	a.Log, err = xlog.New(filepath.Join(a.StorageDir, "logs"), x.Ternary(logOverride, cmd.String("log"), "none"))
+	logLevel := cmd.String("log")
+	if a.Dev && !cmd.IsSet("log") {
+		logLevel = "debug"
+	}
+	logOverride := logLevel != ""
+	a.Log, err = xlog.New(filepath.Join(a.StorageDir, "logs"), x.Ternary(logOverride, logLevel, "none"))
 	if err != nil {
 		return ctx, fmt.Errorf("failed to initialize logger: %w", err)
 	}
@@ -111,16 +170,35 @@ func (a *App) Init(ctx context.Context, cmd *cli.Command) (context.Context, erro
 		a.buildInfo.Name, a.buildInfo.Version, a.StorageDir, a.RuntimeDir)
 
 	// database
-	if a.DB, err = database.New(filepath.Join(a.StorageDir, "db"), a.Log); err != nil {
-		return ctx, fmt.Errorf("failed to initialize database: %w", err)
+	if a.SkipDB {
+		ctx = xlog.IntoContext(ctx, a.Log)
+		a.Context = ctx
+		return ctx, nil
+	}
+	dbDir := a.DBDir()
+	if a.Dev {
+		if dbDir, err = a.devDB(dbDir); err != nil {
+			return ctx, err
+		}
+	}
+	// the migrator instance's output ends up in the installer's, show it's not stuck
+	var onMigration func(database.MigrationEvent)
+	if cmd.Bool("migrate") {
+		onMigration = MigrationProgress(progress.New(os.Stdout))
+	}
+	seal, err := database.LoadSealing(a.StorageDir)
+	if err != nil {
+		return ctx, err
+	}
+	var migrated *database.MigrationResult
+	a.DB, migrated, err = database.OpenMigrating(dbDir, a.Log, seal, onMigration)
+	if err != nil {
+		return ctx, fmt.Errorf("failed to initialize database (if a crash left it locked, try '%s db repair'): %w", a.buildInfo.Name, err)
 	}
 	a.AddCleanup(func() error {
 		// store PreUpdateVersion on shutdown, unless we are the migrator instance
 		if !cmd.Bool("migrate") {
-			if err := config.Update(a.DB, func(cfg *types.Configuration) error {
-				cfg.PreUpdateVersion = a.buildInfo.Version
-				return nil
-			}); err != nil {
+			if err := lifecycle.RecordStop(a.DB, a.buildInfo.Version); err != nil {
 				a.Log.Errorf("failed to set PreUpdateVersion on shutdown: %v", err)
 			}
 		}
@@ -129,43 +207,147 @@ func (a *App) Init(ctx context.Context, cmd *cli.Command) (context.Context, erro
 	})
 	a.Log.Debug("Database initialized")
 
+	// settings from the config file win over the database's, the environment's
+	// over the file's and the flags' over both (see config.Layers)
+	if err := a.useConfigFile(); err != nil {
+		return ctx, err
+	}
+	if err := a.useFlags(cmd); err != nil {
+		return ctx, err
+	}
+
+	// --profile (or its env var) picks the settings profile for this process
+	if name := cmd.String("profile"); name != "" {
+		if err := config.UseProfile(a.DB, name); err != nil {
+			return ctx, err
+		}
+		a.AddCleanup(func() error { return config.UseProfile(a.DB, "") })
+	}
+	if name, err := config.ActiveProfile(a.DB); err != nil {
+		return ctx, err
+	} else if name != "" {
+		a.Log.Infof("Using config profile %s", name)
+	}
+
 	// get config
 	cfg, err := config.View(a.DB)
 	if err != nil {
 		return ctx, fmt.Errorf("failed to view config: %w", err)
 	}
 
-	// override port (useful for testing)
-	oPort := cmd.Int("port")
-	if oPort != 0 {
-		cfg.Port = oPort
+	// remember the version this one replaced, for rollback
+	if err := a.recordVersion(cfg); err != nil {
+		return ctx, fmt.Errorf("failed to record installed version: %w", err)
 	}
 
-	// calculate BaseURL
-	if a.BaseURL, err = getBaseURL(cfg); err != nil {
-		return ctx, fmt.Errorf("failed to get base URL: %w", err)
-	}
+	a.SetBaseURL(cfg)
 	a.Log.Debugf("Base URL: %s", a.BaseURL)
 
 	// set UserAgent
 	mmVer := strings.TrimPrefix(semver.MajorMinor(a.buildInfo.Version), "v")
 	a.UserAgent = fmt.Sprintf("Mozilla/5.0 (compatible; %s/%s; +%s)", a.buildInfo.Name, mmVer, a.buildInfo.ContactURL)
 
-	// set log level
+	// outbound http
+	a.outbound = httpclient.FromConfig(cfg, a.UserAgent)
+	if a.HTTP, err = httpclient.New(a.outbound); err != nil {
+		return ctx, fmt.Errorf("failed to create http client: %w", err)
+	}
+	a.releaseToken = cfg.ReleaseToken.Reveal()
+	if a.releaseToken == "" {
+		a.releaseToken = os.Getenv(release.TokenEnv)
+	}
+	if a.ReleaseSource == nil {
+		if a.Dev {
+			a.ReleaseSource = &release.StaticReleaseSource{Version: a.buildInfo.Version}
+		} else if a.buildInfo.ReleaseSource == release.SourceManifest {
+			a.ReleaseSource = &release.ManifestReleaseSource{Client: a.HTTP, Token: a.releaseToken, Cache: releaseCache{a}}
+		} else {
+			a.ReleaseSource = &release.GenericReleaseSource{Client: a.HTTP, Token: a.releaseToken, Cache: releaseCache{a}}
+		}
+	}
+
+	// set log level, following the settings page while running
 	if !logOverride {
 		if err := a.Log.SetLevel(cfg.LogLevel); err != nil {
 			return ctx, fmt.Errorf("failed to set log level: %w", err)
 		}
+		a.OnReload("log level", func(prev, next *types.Configuration) error {
+			if next.LogLevel == prev.LogLevel {
+				return nil
+			}
+			return a.Log.SetLevel(next.LogLevel)
+		})
 	}
+	// apply settings changes live where subsystems support it, see OnReload
+	watchCtx, stopWatch := context.WithCancel(ctx)
+	a.AddCleanup(func() error { stopWatch(); return nil })
+	a.watchReload(watchCtx, *cfg)
 	// put logger into context
 	ctx = xlog.IntoContext(ctx, a.Log)
 
 	// store context for use in update checking, etc.
 	a.Context = ctx
 
+	// notifications
+	a.Notify = notify.New(a.Log, func() []types.NotifyRoute {
+		cfg, err := config.View(a.DB)
+		if err != nil {
+			a.Log.Errorf("failed to view config for notify routes: %v", err)
+			return nil
+		}
+		return cfg.NotifyRoutes
+	})
+	a.Notify.Register(&notify.LogNotifier{Log: a.Log})
+	hostname, _ := os.Hostname()
+	for i, wh := range cfg.Webhooks {
+		id := x.Ternary(wh.Name != "", wh.Name, fmt.Sprintf("webhook-%d", i))
+		if !slices.Contains(notify.Formats, wh.Format) {
+			a.Log.Warnf("Webhook %s has unknown format %q, skipping it", id, wh.Format)
+			continue
+		}
+		a.Notify.Register(&notify.WebhookNotifier{
+			ID:     id,
+			URL:    wh.URL,
+			Secret: wh.Secret.Reveal(),
+			Format: wh.Format,
+			Instance: notify.Instance{
+				Name:     a.buildInfo.Name,
+				Version:  a.buildInfo.Version,
+				BaseURL:  a.BaseURL,
+				Hostname: hostname,
+			},
+			Client: a.HTTP,
+		})
+	}
+	a.AddCleanup(a.Notify.Close)
+
+	// migrator instance is only run by the installer, right after migrating
+	if cmd.Bool("migrate") {
+		schemaVer, err := database.SchemaVersion(a.DB)
+		if err != nil {
+			a.Log.Errorf("failed to get schema version: %v", err)
+		}
+		a.Notify.Dispatch(notify.Event{
+			Kind:  notify.EventMigrationApplied,
+			Title: "Migrations applied",
+			Fields: map[string]string{
+				"schemaVersion": schemaVer,
+				"appVersion":    a.buildInfo.Version,
+				"applied":       migrated.Summary(),
+			},
+		})
+	}
+
 	// load frontend
-	if a.UI, err = ui.New(); err != nil {
-		return ctx, fmt.Errorf("failed to load UI: %w", err)
+	if a.Dev {
+		if a.UI, err = ui.NewDev(DevUIDir); err != nil {
+			a.Log.Warnf("dev mode: falling back to embedded UI: %v", err)
+		}
+	}
+	if a.UI == nil {
+		if a.UI, err = ui.New(); err != nil {
+			return ctx, fmt.Errorf("failed to load UI: %w", err)
+		}
 	}
 
 	// update checking
@@ -173,9 +355,62 @@ func (a *App) Init(ctx context.Context, cmd *cli.Command) (context.Context, erro
 		return ctx, fmt.Errorf("failed to start auto checker: %w", err)
 	}
 
+	// without a service the first command after an update counts as booting it,
+	// services run them once listening (see server.New)
+	if !a.buildInfo.ServiceEnabled && !cmd.Bool("migrate") {
+		a.RunPendingUpdateHooks()
+	}
+
 	return ctx, nil
 }
 
+// MigrationProgress renders migration steps as they run (see
+// database.MigrateWith), one task per step.
+func MigrationProgress(p *progress.Printer) func(database.MigrationEvent) {
+	var task *progress.Task
+	return func(ev database.MigrationEvent) {
+		if task == nil {
+			// also when resuming a batched step, which doesn't start again
+			task = p.Step(fmt.Sprintf("Migrating %s: %s - %s", x.Ternary(ev.DBI == "", "schema", ev.DBI), ev.ID, ev.Desc))
+		}
+		switch ev.Kind {
+		case migrator.StepFinished, migrator.StepFailed:
+			task.End(ev.Err)
+			task = nil
+		}
+	}
+}
+
+// DBDir is where the real database lives (dev mode works on a copy).
+func (a *App) DBDir() string {
+	return filepath.Join(a.StorageDir, "db")
+}
+
+// UpdatesDisabled reports whether update checks and installs are off,
+// which is the case for dev builds (vX.X.X) and in dev mode.
+func (a *App) UpdatesDisabled() bool {
+	return a.buildInfo.Version == "vX.X.X" || a.Dev
+}
+
+// devDB copies the database in dbDir to a throwaway dir for dev mode and
+// returns its path. Starts empty if there's nothing to copy yet.
+func (a *App) devDB(dbDir string) (string, error) {
+	devDir := filepath.Join(a.TempDir, fmt.Sprintf("dev-db-%d", os.Getpid()))
+	if err := os.RemoveAll(devDir); err != nil {
+		return "", fmt.Errorf("failed to clear dev database dir: %w", err)
+	}
+	if err := database.Snapshot(dbDir, devDir); err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", fmt.Errorf("failed to copy database for dev mode: %w", err)
+		}
+		a.Log.Warn("dev mode: no database to copy, starting empty")
+	}
+	// added before the DB's cleanup, so it runs after the DB is closed
+	a.AddCleanup(func() error { return os.RemoveAll(devDir) })
+	a.Log.Infof("dev mode: using database copy at %s", devDir)
+	return devDir, nil
+}
+
 func (a *App) Close() {
 	a.cleanupOnce.Do(func() {
 		// call cleanup funcs in reverse order
@@ -247,7 +482,14 @@ func getRuntimePath(appName string) (string, error) {
 	return filepath.Join("/tmp", appName+"-"+username), nil
 }
 
-func getBaseURL(cfg *types.Configuration) (string, error) {
+// SetBaseURL sets BaseURL to the URL the app is reached at with cfg, the
+// proxy's port if it's behind one. The server calls it again when a reload
+// moves it to another port.
+func (a *App) SetBaseURL(cfg *types.Configuration) {
+	a.BaseURL = baseURL(cfg)
+}
+
+func baseURL(cfg *types.Configuration) string {
 	port := cfg.Port
 	host := cfg.Host
 	proxyPort := cfg.ProxyPort
@@ -255,8 +497,8 @@ func getBaseURL(cfg *types.Configuration) (string, error) {
 	// calculate that shit
 	host = x.Ternary(host != "", host, "localhost")
 	port = x.Ternary(proxyPort != 0, proxyPort, port)
-	hidePort := port == 80 || port == 443
-	scheme := x.Ternary(port == 443, "https", "http")
-	baseURL := fmt.Sprintf("%s://%s%s", scheme, host, x.Ternary(hidePort, "", fmt.Sprintf(":%d", port)))
-	return baseURL, nil
+	// without a proxy, the server serves HTTPS itself when TLS is set up
+	scheme := x.Ternary(port == 443 || (proxyPort == 0 && cfg.TLS.Enabled()), "https", "http")
+	hidePort := (scheme == "http" && port == 80) || (scheme == "https" && port == 443)
+	return fmt.Sprintf("%s://%s%s", scheme, host, x.Ternary(hidePort, "", fmt.Sprintf(":%d", port)))
 }
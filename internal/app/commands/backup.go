@@ -0,0 +1,167 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sprout/internal/app"
+	"sprout/internal/platform/backup"
+	"sprout/internal/platform/database/config"
+	"sprout/pkg/errs"
+	"sprout/pkg/humanize"
+	"sprout/pkg/progress"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+var Backup = register(func(a *app.App) *cli.Command {
+	return &cli.Command{
+		Name:        "backup",
+		Usage:       "back up the database now, or inspect backups",
+		Description: "Writes a compacted, consistent copy of the database to a timestamped archive in the backup dir while it's in use, verifies it, and applies the configured retention and encryption (see `service set --backup-*`).",
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			w := cmd.Root().Writer
+			if a.Dev {
+				return errs.New(errs.Invalid, "dev mode works on a copy of the database, back up without --dev")
+			}
+			cfg, err := config.View(a.DB)
+			if err != nil {
+				return fmt.Errorf("failed to get configuration from database: %w", err)
+			}
+			opts, err := a.BackupOptions(cfg.Backup, "cli")
+			if err != nil {
+				return err
+			}
+
+			step := progress.New(w).Step("Backing up to " + opts.Dir)
+			res := backup.Run(a.DB, opts)
+			if !res.OK() {
+				step.Fail(errors.New(res.Error))
+				return fmt.Errorf("backup failed: %s", res.Error)
+			}
+			step.Done()
+			fmt.Fprintf(w, "Archive: %s (%s)\n", res.Path, humanize.Bytes(res.Size))
+			for _, path := range res.Pruned {
+				fmt.Fprintf(w, "Pruned:  %s\n", filepath.Base(path))
+			}
+			if res.PruneError != "" {
+				fmt.Fprintf(w, "Warning: retention failed: %s\n", res.PruneError)
+			}
+			return nil
+		},
+		Commands: []*cli.Command{
+			{
+				Name:        "verify",
+				Usage:       "check an archive's checksums and test-open its database copy",
+				Description: "The archive can be a path or a file name in the backup dir. Encrypted archives are opened with " + backup.KeyFile + " from storage or " + backup.PassphraseEnv + ".",
+				ArgsUsage:   "<archive>",
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					w := cmd.Root().Writer
+					path, err := archivePath(a, cmd.Args().First())
+					if err != nil {
+						return err
+					}
+					keys, err := backup.Keys(a.StorageDir)
+					if err != nil {
+						return fmt.Errorf("failed to load backup key: %w", err)
+					}
+
+					step := progress.New(w).Step("Verifying " + filepath.Base(path))
+					v, err := backup.Verify(path, keys)
+					if step.End(err) != nil {
+						return errs.Wrap(errs.Invalid, err, fmt.Sprintf("%s is not a usable backup", filepath.Base(path)))
+					}
+					m := v.Manifest
+					fmt.Fprintln(w)
+					fmt.Fprintf(w, "Created:   %s (%s)\n", m.CreatedAt.Local().Format(time.DateTime), humanize.Ago(m.CreatedAt))
+					fmt.Fprintf(w, "Version:   %s %s, schema %s\n", m.App, m.Version, m.SchemaVersion)
+					if v.Encrypted {
+						fmt.Fprintln(w, "Encrypted: yes")
+					}
+					for _, f := range m.Files {
+						fmt.Fprintf(w, "File:      %s %s sha256:%s\n", f.Name, humanize.Bytes(f.Size), f.SHA256[:12])
+					}
+					for _, name := range slices.Sorted(maps.Keys(v.Entries)) {
+						fmt.Fprintf(w, "DBI:       %-10s %d entries\n", name, v.Entries[name])
+					}
+					return nil
+				},
+			},
+		},
+	}
+})
+
+var Restore = register(func(a *app.App) *cli.Command {
+	return &cli.Command{
+		Name:        "restore",
+		Usage:       "replace the database with a backup",
+		Description: "Verifies the archive (a path or a file name in the backup dir), then on exit stops the service and other instances, swaps the archive's database in and migrates it to this version's schema. The current database is kept next to it (db" + app.PreRestoreSuffix + "<time>) and put back if the migration fails.",
+		ArgsUsage:   "<archive>",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "yes",
+				Usage: "don't ask for confirmation",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			w := cmd.Root().Writer
+			path, err := archivePath(a, cmd.Args().First())
+			if err != nil {
+				return err
+			}
+
+			var cancelled bool
+			step := progress.New(w).Step("Verifying " + filepath.Base(path))
+			err = a.DeferRestore(path, func(v *backup.Verification) error {
+				step.Done()
+				m := v.Manifest
+				fmt.Fprintf(w, "Backup from %s %s (schema %s), created %s\n", m.App, m.Version, m.SchemaVersion, m.CreatedAt.Local().Format(time.DateTime))
+				if cmd.Bool("yes") {
+					return nil
+				}
+				yes, err := confirm(cmd, "Replace ALL current data with it?")
+				if err != nil {
+					return fmt.Errorf("prompt failed: %w", err)
+				}
+				if cancelled = !yes; cancelled {
+					return errs.New(errs.Conflict, "restore cancelled")
+				}
+				return nil
+			})
+			step.End(err) // no-op once done
+			if cancelled {
+				fmt.Fprintln(w, "Restore cancelled.")
+				return nil
+			} else if err != nil {
+				return err
+			}
+			fmt.Fprintln(w, "Restoring on exit...")
+			return nil
+		},
+	}
+})
+
+// archivePath resolves a path, or a bare file name in the configured backup dir.
+func archivePath(a *app.App, arg string) (string, error) {
+	if arg == "" {
+		return "", errs.New(errs.Invalid, "missing archive argument")
+	}
+	if _, err := os.Stat(arg); err == nil || strings.ContainsRune(arg, os.PathSeparator) {
+		return arg, nil
+	}
+	cfg, err := config.View(a.DB)
+	if err != nil {
+		return "", fmt.Errorf("failed to get configuration from database: %w", err)
+	}
+	path := filepath.Join(backup.Dir(a.StorageDir, cfg.Backup.Dir), arg)
+	if _, err := os.Stat(path); err != nil {
+		return "", errs.New(errs.NotFound, fmt.Sprintf("no archive %q here or in %s", arg, filepath.Dir(path)))
+	}
+	return path, nil
+}
@@ -6,7 +6,11 @@
 package commands
 
 import (
+	"bufio"
+	"fmt"
+	"io"
 	"sprout/internal/app"
+	"strings"
 
 	"github.com/urfave/cli/v3"
 )
@@ -21,3 +25,28 @@ func register(rf RegFunc) RegFunc {
 	}
 	return rf
 }
+
+// confirm asks a yes/no question on the root command's Reader / Writer (stdin /
+// stdout unless a test injected something else). EOF without an answer counts as no.
+func confirm(cmd *cli.Command, msg string) (bool, error) {
+	r := bufio.NewReader(cmd.Root().Reader)
+	w := cmd.Root().Writer
+	for {
+		fmt.Fprintf(w, "%s (y/n): ", msg)
+		line, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return false, fmt.Errorf("failed to read input: %w", err)
+		}
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+		if err == io.EOF {
+			fmt.Fprintln(w)
+			return false, nil
+		}
+		fmt.Fprintln(w, "Invalid input. Please enter one of: 'y', 'yes', 'n', or 'no'.")
+	}
+}
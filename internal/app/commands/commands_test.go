@@ -0,0 +1,715 @@
+package commands_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"sprout/internal/app/commands"
+	"sprout/internal/build"
+	"sprout/internal/platform/backup"
+	"sprout/internal/platform/database"
+	"sprout/internal/platform/database/config"
+	"sprout/internal/platform/release"
+	"sprout/internal/testsupport/apptest"
+	"sprout/internal/testsupport/releasetest"
+	"sprout/internal/types"
+	"sprout/pkg/errs"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func serviceBuild() build.BuildInfo {
+	bi := build.Info()
+	bi.Name = "sprout"
+	bi.Version = apptest.DefaultVersion
+	bi.ServiceEnabled = true
+	return bi
+}
+
+func TestUpdate(t *testing.T) {
+	h := apptest.New(t, apptest.WithRelease(&releasetest.MockReleaseSource{
+		LatestVersion: "v1.1.0",
+		Assets:        map[string][]byte{release.VersionsAsset: []byte("v1.0.0\nv1.1.0\n")},
+	}))
+
+	out, err := h.Exec("", "update", "--check")
+	if err != nil {
+		t.Fatalf("update --check: %v", err)
+	}
+	if !strings.Contains(out.Stdout, "Update available!") {
+		t.Errorf("update --check output = %q, want update available", out.Stdout)
+	}
+
+	out, err = h.Exec("", "update", "--check", "--json")
+	if errs.ExitCode(err) != commands.UpdateAvailableExit {
+		t.Errorf("update --check --json = %v, want exit code %d", err, commands.UpdateAvailableExit)
+	}
+	if want := `{"current":"` + apptest.DefaultVersion + `","latest":"v1.1.0","updateAvailable":true}`; strings.TrimSpace(out.Stdout) != want {
+		t.Errorf("update --check --json output = %q, want %q", out.Stdout, want)
+	}
+
+	if _, err := h.Exec("", "update", "--channel", "canary"); err == nil {
+		t.Error("update --channel accepted an unknown channel")
+	}
+	if _, err := h.Exec("", "update", "--channel", "beta"); err != nil {
+		t.Fatalf("update --channel: %v", err)
+	}
+	if got := h.Config().Channel; got != "beta" {
+		t.Errorf("Channel = %q, want beta", got)
+	}
+
+	for to, kind := range map[string]errs.Kind{"latest": errs.Invalid, "v0.9.0": errs.NotFound} {
+		if _, err := h.Exec("", "update", "--to", to); errs.KindOf(err) != kind {
+			t.Errorf("update --to %s = %v, want %v", to, err, kind)
+		}
+	}
+
+	out, err = h.Exec("", "update", "--dry-run", "--to", "v1.1.0")
+	if err != nil {
+		t.Fatalf("update --dry-run: %v", err)
+	}
+	for _, want := range []string{"Target:    v1.1.0", "/v1.1.0/linux-amd64.gz", "install.sh", "Dry run"} {
+		if !strings.Contains(out.Stdout, want) {
+			t.Errorf("update --dry-run output = %q, want %q", out.Stdout, want)
+		}
+	}
+	if h.Config().PendingUpdateHooks.From != "" {
+		t.Error("update --dry-run prepared an update")
+	}
+
+	before := h.Config().UpdateNotifications
+	out, err = h.Exec("", "update", "--notify")
+	if err != nil {
+		t.Fatalf("update --notify: %v", err)
+	}
+	if h.Config().UpdateNotifications == before {
+		t.Errorf("update --notify did not toggle UpdateNotifications")
+	}
+	if !strings.Contains(out.Stdout, "disabled") {
+		t.Errorf("update --notify output = %q, want disabled", out.Stdout)
+	}
+}
+
+func TestServiceSet(t *testing.T) {
+	h := apptest.New(t, apptest.WithBuildInfo(serviceBuild()))
+
+	out, err := h.Exec("", "service", "set", "--host", "0.0.0.0", "--proxy", "443")
+	if err != nil {
+		t.Fatalf("service set: %v", err)
+	}
+	if cfg := h.Config(); cfg.Host != "0.0.0.0" || cfg.ProxyPort != 443 {
+		t.Errorf("config = host %q proxy %d, want 0.0.0.0 443", cfg.Host, cfg.ProxyPort)
+	}
+	if !strings.Contains(out.Stdout, "updated successfully") {
+		t.Errorf("service set output = %q", out.Stdout)
+	}
+
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	taken := strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+	if _, err := h.Exec("", "service", "set", "--port", taken); !errs.Is(err, errs.Conflict) {
+		t.Errorf("service set --port %s (in use) = %v, want conflict", taken, err)
+	}
+	if cfg := h.Config(); strconv.Itoa(cfg.Port) == taken {
+		t.Errorf("service set saved port %s in use", taken)
+	}
+}
+
+func TestUninstall(t *testing.T) {
+	cases := []struct {
+		name  string
+		stdin string
+		args  []string
+		want  string
+	}{
+		{"dry run", "", []string{"uninstall", "--dry-run"}, "remove storage directory"},
+		{"declined", "n\n", []string{"uninstall"}, "Uninstall cancelled."},
+		{"invalid then declined", "maybe\nno\n", []string{"uninstall"}, "Invalid input"},
+		{"no input", "", []string{"uninstall"}, "Uninstall cancelled."},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := apptest.New(t)
+			out, err := h.Exec(tc.stdin, tc.args...)
+			if err != nil {
+				t.Fatalf("%v: %v", tc.args, err)
+			}
+			if !strings.Contains(out.Stdout, tc.want) {
+				t.Errorf("output = %q, want it to contain %q", out.Stdout, tc.want)
+			}
+			if strings.Contains(out.Stdout, "Uninstalling...") {
+				t.Errorf("uninstall went ahead: %q", out.Stdout)
+			}
+		})
+	}
+}
+
+func TestRollback(t *testing.T) {
+	if _, err := apptest.New(t).Exec("", "rollback"); errs.KindOf(err) != errs.NotFound {
+		t.Errorf("rollback without a previous version = %v, want NotFound", err)
+	}
+
+	h := apptest.New(t,
+		apptest.WithConfig(func(cfg *types.Configuration) error {
+			cfg.InstalledVersion = "v0.9.0"
+			return nil
+		}),
+		apptest.WithRelease(&releasetest.MockReleaseSource{
+			LatestVersion: apptest.DefaultVersion,
+			Assets:        map[string][]byte{release.VersionsAsset: []byte("v0.9.0\nv1.0.0\n")},
+		}),
+	)
+	if cfg := h.Config(); cfg.InstalledVersion != apptest.DefaultVersion || cfg.PreviousVersion != "v0.9.0" {
+		t.Fatalf("installed %q previous %q, want %s and v0.9.0", cfg.InstalledVersion, cfg.PreviousVersion, apptest.DefaultVersion)
+	}
+
+	out, err := h.Exec("n\n", "rollback")
+	if err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	for _, want := range []string{"to v0.9.0 (kept binary missing", "Rollback cancelled."} {
+		if !strings.Contains(out.Stdout, want) {
+			t.Errorf("rollback output = %q, want %q", out.Stdout, want)
+		}
+	}
+}
+
+func TestBackupVerify(t *testing.T) {
+	h := apptest.New(t)
+	path, err := backup.Create(h.App.DB, backup.Options{Dir: backup.Dir(h.App.StorageDir, ""), App: "sprout", Version: apptest.DefaultVersion}, time.Now())
+	if err != nil {
+		t.Fatalf("backup.Create: %v", err)
+	}
+
+	// by file name, resolved against the backup dir
+	out, err := h.Exec("", "backup", "verify", filepath.Base(path))
+	if err != nil {
+		t.Fatalf("backup verify: %v", err)
+	}
+	if !strings.Contains(out.Stdout, "✓ Verifying") || !strings.Contains(out.Stdout, "config") {
+		t.Errorf("backup verify output = %q", out.Stdout)
+	}
+
+	if _, err := h.Exec("", "backup", "verify", "missing.tar.gz"); err == nil {
+		t.Error("backup verify of a missing archive succeeded")
+	}
+}
+
+func TestBackupRestore(t *testing.T) {
+	h := apptest.New(t)
+	out, err := h.Exec("", "backup")
+	if err != nil {
+		t.Fatalf("backup: %v", err)
+	}
+	if !strings.Contains(out.Stdout, "Archive: "+backup.Dir(h.App.StorageDir, "")) {
+		t.Fatalf("backup output = %q", out.Stdout)
+	}
+	archives, err := backup.List(backup.Dir(h.App.StorageDir, ""), "sprout")
+	if err != nil || len(archives) != 1 {
+		t.Fatalf("backup.List() = %v, %v, want the new archive", archives, err)
+	}
+
+	// declining leaves nothing staged
+	out, err = h.Exec("n\n", "restore", filepath.Base(archives[0].Path))
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if !strings.Contains(out.Stdout, "Backup from sprout "+apptest.DefaultVersion) || !strings.Contains(out.Stdout, "Restore cancelled.") {
+		t.Errorf("restore output = %q", out.Stdout)
+	}
+	if staged, _ := filepath.Glob(filepath.Join(h.App.StorageDir, ".restore-*")); len(staged) != 0 {
+		t.Errorf("cancelled restore left %v", staged)
+	}
+}
+
+func TestDBCompact(t *testing.T) {
+	h := apptest.New(t)
+	out, err := h.Exec("", "db", "compact")
+	if err != nil {
+		t.Fatalf("db compact: %v", err)
+	}
+	if !strings.Contains(out.Stdout, "Compacting on exit...") {
+		t.Errorf("db compact output = %q", out.Stdout)
+	}
+
+	// the swap happens once the app has let go of the database
+	h.Close()
+	counts, err := database.Check(h.App.DBDir())
+	if err != nil {
+		t.Fatalf("database.Check after compact: %v", err)
+	}
+	if counts["config"] == 0 {
+		t.Errorf("compacted database counts = %v, want the config kept", counts)
+	}
+	if left, _ := filepath.Glob(filepath.Join(h.App.StorageDir, ".compact-*")); len(left) != 0 {
+		t.Errorf("compact left %v", left)
+	}
+}
+
+func TestDBRaw(t *testing.T) {
+	h := apptest.New(t)
+	defer h.Close()
+
+	if _, err := h.Exec("", "db", "put", "config", "debug", "hello"); err == nil {
+		t.Fatal("db put without --yes-i-know succeeded")
+	}
+	if _, err := h.Exec("", "db", "put", "--yes-i-know", "config", "0x00ff", "-"); err != nil {
+		t.Fatalf("db put: %v", err)
+	}
+	if _, err := h.Exec("", "db", "put", "--yes-i-know", "config", "seal", "x"); err == nil {
+		t.Error("db put overwrote the seal record")
+	}
+	if _, err := h.Exec("", "db", "get", "nope", "key"); err == nil {
+		t.Error("db get on an unknown DBI succeeded")
+	}
+
+	out, err := h.Exec("", "db", "list", "--keys", "config")
+	if err != nil {
+		t.Fatalf("db list: %v", err)
+	}
+	if !strings.Contains(out.Stdout, "0x00ff\n") || !strings.Contains(out.Stdout, database.ConfigDataKey+"\n") {
+		t.Errorf("db list output = %q", out.Stdout)
+	}
+	out, err = h.Exec("", "db", "get", "config", database.ConfigVersionKey)
+	if err != nil || !strings.HasPrefix(out.Stdout, `"v`) {
+		t.Errorf("db get version = %q, %v", out.Stdout, err)
+	}
+
+	if _, err := h.Exec("", "db", "del", "--yes-i-know", "config", "0x00ff"); err != nil {
+		t.Fatalf("db del: %v", err)
+	}
+	if _, err := h.Exec("", "db", "get", "config", "0x00ff"); !errs.Is(err, errs.NotFound) {
+		t.Errorf("db get after del = %v, want not found", err)
+	}
+}
+
+func TestMigrateNew(t *testing.T) {
+	h := apptest.New(t)
+	defer h.Close()
+
+	src, err := os.ReadFile("../../platform/database/migration.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(t.TempDir(), "migration.go")
+	if err := os.WriteFile(file, src, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, desc := range []string{"Add sessions DBI", "backfill sessions"} {
+		if _, err := h.Exec("", "migrate", "new", "--file", file, desc); err != nil {
+			t.Fatalf("migrate new %q: %v", desc, err)
+		}
+	}
+	out, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := string(out)
+	first, second := strings.Index(got, `_add_sessions_dbi", "Add sessions DBI"`), strings.Index(got, `_backfill_sessions", "backfill sessions"`)
+	if first < 0 || second < first || second > strings.Index(got, "adds steps above this line") {
+		t.Errorf("steps not added in order above the marker:\n%s", got)
+	}
+
+	if _, err := h.Exec("", "migrate", "new", "--file", filepath.Join(t.TempDir(), "nope.go"), "x"); !errs.Is(err, errs.NotFound) {
+		t.Errorf("migrate new on a missing file = %v, want not found", err)
+	}
+}
+
+func TestSeed(t *testing.T) {
+	h := apptest.New(t)
+	defer h.Close()
+
+	// a release build only takes fixtures marked for production
+	if _, err := h.Exec("", "seed", "--fixture", "demo"); !errs.Is(err, errs.Invalid) {
+		t.Fatalf("seed demo on a release build = %v, want invalid", err)
+	}
+	out, err := h.Exec("", "seed", "--force", "--fixture", "demo")
+	if err != nil || !strings.Contains(out.Stdout, "Applied fixtures: demo") {
+		t.Fatalf("seed --force = %q, %v", out.Stdout, err)
+	}
+	out, err = h.Exec("", "seed", "--force", "--fixture", "demo")
+	if err != nil || !strings.Contains(out.Stdout, "Already applied: demo") {
+		t.Errorf("second seed = %q, %v, want it skipped", out.Stdout, err)
+	}
+	out, err = h.Exec("", "seed", "--list")
+	if err != nil || !strings.Contains(out.Stdout, "applied ") {
+		t.Errorf("seed --list = %q, %v", out.Stdout, err)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	h := apptest.New(t)
+	defer h.Close()
+
+	if _, err := h.Exec("", "config", "set", "port", "8081"); err != nil {
+		t.Fatalf("config set port: %v", err)
+	}
+	if out, err := h.Exec("", "config", "get", "port"); err != nil || out.Stdout != "8081\n" {
+		t.Errorf("config get port = %q, %v", out.Stdout, err)
+	}
+	for _, args := range [][]string{
+		{"port", "0"},
+		{"port", "http"},
+		{"logLevel", "LOUD"},
+		{"backup.schedule", "every day"},
+		{"startCounter", "3"},
+	} {
+		if _, err := h.Exec("", append([]string{"config", "set"}, args...)...); !errs.Is(err, errs.Invalid) {
+			t.Errorf("config set %v = %v, want invalid", args, err)
+		}
+	}
+	if _, err := h.Exec("", "config", "get", "nope"); !errs.Is(err, errs.NotFound) {
+		t.Errorf("config get nope = %v, want not found", err)
+	}
+
+	// a port in use is refused before the next restart would fail on it
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	taken := strconv.Itoa(ln.Addr().(*net.TCPAddr).Port)
+	if _, err := h.Exec("", "config", "set", "port", taken); !errs.Is(err, errs.Conflict) || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("config set port %s (in use) = %v, want conflict", taken, err)
+	}
+	if out, err := h.Exec("", "config", "set", "--force", "port", taken); err != nil || !strings.Contains(out.Stdout, "warning: port "+taken+" is already in use") {
+		t.Errorf("config set --force port %s = %q, %v, want saved with a warning", taken, out.Stdout, err)
+	}
+
+	if _, err := h.Exec("", "config", "set", "releaseToken", "tok3n"); err != nil {
+		t.Fatalf("config set releaseToken: %v", err)
+	}
+	out, err := h.Exec("", "config", "list")
+	if err != nil || !strings.Contains(out.Stdout, "backup.schedule") || strings.Contains(out.Stdout, "startCounter") || strings.Contains(out.Stdout, "tok3n") {
+		t.Errorf("config list = %q, %v", out.Stdout, err)
+	}
+	if out, err := h.Exec("", "config", "get", "releaseToken"); err != nil || out.Stdout != "tok3n\n" {
+		t.Errorf("config get releaseToken = %q, %v", out.Stdout, err)
+	}
+}
+
+func TestConfigExportImport(t *testing.T) {
+	h := apptest.New(t)
+	defer h.Close()
+
+	for _, args := range [][]string{{"port", "8081"}, {"releaseToken", "tok3n"}, {"backup.keepLast", "5"}} {
+		if _, err := h.Exec("", append([]string{"config", "set"}, args...)...); err != nil {
+			t.Fatalf("config set %v: %v", args, err)
+		}
+	}
+	out, err := h.Exec("", "config", "export")
+	if err != nil || strings.Contains(out.Stdout, "tok3n") || strings.Contains(out.Stdout, "startCounter") || !strings.Contains(out.Stdout, `"port": 8081`) {
+		t.Fatalf("config export = %q, %v", out.Stdout, err)
+	}
+	exported := out.Stdout
+
+	// a merge only touches what the file has
+	if _, err := h.Exec(`{"port": 8082}`, "config", "import", "--merge", "-"); err != nil {
+		t.Fatalf("config import --merge: %v", err)
+	}
+	if cfg := h.Config(); cfg.Port != 8082 || cfg.Backup.KeepLast != 5 {
+		t.Errorf("after merge port %d, keepLast %d, want 8082, 5", cfg.Port, cfg.Backup.KeepLast)
+	}
+	// a full import resets the rest, redacted secrets are kept
+	if _, err := h.Exec("port: 8083\nreleaseToken: \""+types.Redacted+"\"\n", "config", "import", "-"); err != nil {
+		t.Fatalf("config import: %v", err)
+	}
+	if cfg := h.Config(); cfg.Port != 8083 || cfg.Backup.KeepLast != 0 || cfg.ReleaseToken.Reveal() != "tok3n" {
+		t.Errorf("after import port %d, keepLast %d, token %q", cfg.Port, cfg.Backup.KeepLast, cfg.ReleaseToken.Reveal())
+	}
+	// and the export round-trips
+	if _, err := h.Exec(exported, "config", "import", "-"); err != nil {
+		t.Fatalf("config import of export: %v", err)
+	}
+	if cfg := h.Config(); cfg.Port != 8081 || cfg.Backup.KeepLast != 5 || cfg.ReleaseToken.Reveal() != "tok3n" {
+		t.Errorf("after importing the export port %d, keepLast %d, token %q", cfg.Port, cfg.Backup.KeepLast, cfg.ReleaseToken.Reveal())
+	}
+
+	for _, in := range []string{`{"port": 0}`, `{"nope": 1}`, `{"startCounter": 3}`, `[1, 2]`} {
+		if _, err := h.Exec(in, "config", "import", "-"); !errs.Is(err, errs.Invalid) {
+			t.Errorf("config import of %s = %v, want invalid", in, err)
+		}
+	}
+	if cfg := h.Config(); cfg.Port != 8081 {
+		t.Errorf("port %d after failed imports, want 8081", cfg.Port)
+	}
+}
+
+func TestConfigReset(t *testing.T) {
+	h := apptest.New(t)
+	defer h.Close()
+
+	if _, err := h.Exec("", "config", "set", "port", "8081"); err != nil {
+		t.Fatalf("config set port: %v", err)
+	}
+	counter := h.Config().StartCounter
+	if out, err := h.Exec("n\n", "config", "reset"); err != nil || !strings.Contains(out.Stdout, "cancelled") || h.Config().Port != 8081 {
+		t.Errorf("config reset, declined = %q, %v, port %d", out.Stdout, err, h.Config().Port)
+	}
+	if _, err := h.Exec("y\n", "config", "reset"); err != nil {
+		t.Fatalf("config reset: %v", err)
+	}
+	cfg := h.Config()
+	if def := types.DefaultConfig(); cfg.Port != def.Port {
+		t.Errorf("port after reset = %d, want %d", cfg.Port, def.Port)
+	}
+	if cfg.StartCounter != counter {
+		t.Errorf("start counter after reset = %d, want it kept (%d)", cfg.StartCounter, counter)
+	}
+}
+
+func TestConfigDiff(t *testing.T) {
+	h := apptest.New(t)
+	defer h.Close()
+
+	if _, err := h.Exec("", "config", "reset", "--yes"); err != nil { // the harness picks a free port
+		t.Fatalf("config reset: %v", err)
+	}
+	if out, err := h.Exec("", "config", "diff"); err != nil || !strings.Contains(out.Stdout, "defaults") {
+		t.Errorf("config diff, nothing customized = %q, %v", out.Stdout, err)
+	}
+	for _, args := range [][]string{{"port", "8081"}, {"releaseToken", "hunter2"}} {
+		if _, err := h.Exec("", append([]string{"config", "set"}, args...)...); err != nil {
+			t.Fatalf("config set %v: %v", args, err)
+		}
+	}
+	out, err := h.Exec("", "config", "diff")
+	if err != nil {
+		t.Fatalf("config diff: %v", err)
+	}
+	def := types.DefaultConfig()
+	if !strings.Contains(out.Stdout, fmt.Sprintf("%d -> 8081", def.Port)) || !strings.Contains(out.Stdout, `"" -> `+types.Redacted) {
+		t.Errorf("config diff = %q, want port and the redacted token", out.Stdout)
+	}
+	if strings.Contains(out.Stdout, "hunter2") || strings.Contains(out.Stdout, "startCounter") || strings.Contains(out.Stdout, "logLevel") {
+		t.Errorf("config diff = %q, shows a secret, a recorded or an unchanged value", out.Stdout)
+	}
+
+	out, err = h.Exec("", "config", "diff", "--json")
+	if err != nil {
+		t.Fatalf("config diff --json: %v", err)
+	}
+	var changes []map[string]string
+	if err := json.Unmarshal([]byte(out.Stdout), &changes); err != nil || len(changes) != 2 || changes[0]["key"] != "port" || changes[0]["value"] != "8081" {
+		t.Errorf("config diff --json = %q, %v", out.Stdout, err)
+	}
+}
+
+func TestConfigSources(t *testing.T) {
+	h := apptest.New(t)
+	defer h.Close()
+
+	if _, err := h.Exec("", "config", "set", "host", "db.example.com"); err != nil {
+		t.Fatalf("config set: %v", err)
+	}
+	// what Init does for --port, the harness doesn't run it with flags
+	flags, err := config.LoadFlags(map[string]string{"port": "9300"})
+	if err != nil {
+		t.Fatalf("LoadFlags: %v", err)
+	}
+	config.UseFlags(h.App.DB, flags)
+	defer config.UseFlags(h.App.DB, nil)
+
+	out, err := h.Exec("", "config", "sources")
+	if err != nil {
+		t.Fatalf("config sources: %v", err)
+	}
+	for _, want := range []string{"port", "flags", "9300", "db.example.com", "database", "default"} {
+		if !strings.Contains(out.Stdout, want) {
+			t.Errorf("config sources = %q, want %q", out.Stdout, want)
+		}
+	}
+	if strings.Contains(out.Stdout, "startCounter") {
+		t.Errorf("config sources = %q, shows a recorded value", out.Stdout)
+	}
+
+	out, err = h.Exec("", "config", "sources", "--json")
+	if err != nil {
+		t.Fatalf("config sources --json: %v", err)
+	}
+	var sources []map[string]string
+	if err := json.Unmarshal([]byte(out.Stdout), &sources); err != nil {
+		t.Fatalf("config sources --json = %q, %v", out.Stdout, err)
+	}
+	for _, s := range sources {
+		if s["key"] == "port" && (s["value"] != "9300" || s["source"] != config.FlagsPath) {
+			t.Errorf("config sources --json port = %v, want 9300 from flags", s)
+		}
+	}
+}
+
+func TestConfigRemote(t *testing.T) {
+	h := apptest.New(t)
+	defer h.Close()
+
+	if out, err := h.Exec("", "config", "remote", "status"); err != nil || !strings.Contains(out.Stdout, "off") {
+		t.Errorf("config remote status, no url = %q, %v", out.Stdout, err)
+	}
+	if _, err := h.Exec("", "config", "remote", "pull"); !errs.Is(err, errs.Invalid) {
+		t.Errorf("config remote pull, no url = %v, want invalid", err)
+	}
+	if _, err := h.Exec("", "config", "set", "remoteConfig.url", "http://example.com/fleet.yaml"); !errs.Is(err, errs.Invalid) {
+		t.Errorf("config set remoteConfig.url http = %v, want invalid", err)
+	}
+	if _, err := h.Exec("", "config", "set", "remoteConfig.url", "https://example.com/fleet.yaml"); err != nil {
+		t.Fatalf("config set: %v", err)
+	}
+	out, err := h.Exec("", "config", "remote", "status")
+	if err != nil {
+		t.Fatalf("config remote status: %v", err)
+	}
+	for _, want := range []string{"https://example.com/fleet.yaml", "*/15 * * * *", "checked:    never"} {
+		if !strings.Contains(out.Stdout, want) {
+			t.Errorf("config remote status = %q, want %q", out.Stdout, want)
+		}
+	}
+}
+
+func TestConfigProfile(t *testing.T) {
+	h := apptest.New(t)
+	defer h.Close()
+
+	// the harness runs Init once, useProfile stands in for --profile
+	useProfile := func(name string) {
+		t.Helper()
+		if err := config.UseProfile(h.App.DB, name); err != nil {
+			t.Fatalf("UseProfile(%q): %v", name, err)
+		}
+	}
+	port := h.Config().Port
+	if _, err := h.Exec("", "config", "profile", "create", "dev"); err != nil {
+		t.Fatalf("config profile create: %v", err)
+	}
+	useProfile("dev")
+	if out, err := h.Exec("", "config", "set", "port", "8081"); err != nil || !strings.Contains(out.Stdout, "in profile dev") {
+		t.Fatalf("config set in a profile = %q, %v", out.Stdout, err)
+	}
+	useProfile("")
+	if h.Config().Port != port {
+		t.Errorf("port without the profile = %d, want %d", h.Config().Port, port)
+	}
+	if out, err := h.Exec("", "config", "profile", "show", "dev"); err != nil || !strings.Contains(out.Stdout, "8081") {
+		t.Errorf("config profile show = %q, %v", out.Stdout, err)
+	}
+
+	if _, err := h.Exec("", "config", "profile", "use", "dev"); err != nil {
+		t.Fatalf("config profile use: %v", err)
+	}
+	if out, err := h.Exec("", "config", "profile", "list"); err != nil || !strings.Contains(out.Stdout, "* dev") {
+		t.Errorf("config profile list = %q, %v", out.Stdout, err)
+	}
+	if out, err := h.Exec("", "config", "get", "port"); err != nil || strings.TrimSpace(out.Stdout) != "8081" {
+		t.Errorf("config get port with dev in use = %q, %v", out.Stdout, err)
+	}
+	useProfile(config.DefaultProfile)
+	if out, err := h.Exec("", "config", "get", "port"); err != nil || strings.TrimSpace(out.Stdout) != fmt.Sprint(port) {
+		t.Errorf("config get port with %s selected = %q, %v", config.DefaultProfile, out.Stdout, err)
+	}
+	useProfile("")
+	if _, err := h.Exec("", "config", "profile", "delete", "--yes", "dev"); err != nil {
+		t.Fatalf("config profile delete: %v", err)
+	}
+	if h.Config().Port != port {
+		t.Errorf("port after deleting the profile = %d, want %d", h.Config().Port, port)
+	}
+}
+
+func TestConfigHistory(t *testing.T) {
+	h := apptest.New(t)
+	defer h.Close()
+
+	if _, err := h.Exec("", "config", "set", "releaseToken", "hunter2"); err != nil {
+		t.Fatalf("config set: %v", err)
+	}
+	out, err := h.Exec("", "config", "history")
+	if err != nil {
+		t.Fatalf("config history: %v", err)
+	}
+	if !strings.Contains(out.Stdout, "cli") || !strings.Contains(out.Stdout, `"" -> `+types.Redacted) || strings.Contains(out.Stdout, "hunter2") {
+		t.Errorf("config history = %q, want the redacted token change from the cli", out.Stdout)
+	}
+
+	out, err = h.Exec("", "config", "history", "--json", "--limit", "1")
+	if err != nil {
+		t.Fatalf("config history --json: %v", err)
+	}
+	var history []config.Revision
+	if err := json.Unmarshal([]byte(out.Stdout), &history); err != nil || len(history) != 1 || history[0].Fields[0].Key != "releaseToken" {
+		t.Errorf("config history --json = %q, %v", out.Stdout, err)
+	}
+}
+
+func TestConfigRollback(t *testing.T) {
+	h := apptest.New(t)
+	defer h.Close()
+
+	for _, host := range []string{"one.example.com", "two.example.com"} {
+		if _, err := h.Exec("", "config", "set", "host", host); err != nil {
+			t.Fatalf("config set: %v", err)
+		}
+	}
+	out, err := h.Exec("", "config", "rollback", "--list")
+	if err != nil {
+		t.Fatalf("config rollback --list: %v", err)
+	}
+	if !strings.Contains(out.Stdout, "  1  before") || !strings.Contains(out.Stdout, "  2  before") || !strings.Contains(out.Stdout, "cli") {
+		t.Errorf("config rollback --list = %q, want the snapshots of both changes", out.Stdout)
+	}
+
+	if out, err := h.Exec("n\n", "config", "rollback"); err != nil || !strings.Contains(out.Stdout, "Rollback cancelled.") {
+		t.Fatalf("declined config rollback = %q, %v", out.Stdout, err)
+	}
+	out, err = h.Exec("", "config", "rollback", "--yes", "1")
+	if err != nil {
+		t.Fatalf("config rollback: %v", err)
+	}
+	if !strings.Contains(out.Stdout, "host") || !strings.Contains(out.Stdout, "two.example.com -> one.example.com") {
+		t.Errorf("config rollback = %q, want the host change", out.Stdout)
+	}
+	if out, err := h.Exec("", "config", "get", "host"); err != nil || strings.TrimSpace(out.Stdout) != "one.example.com" {
+		t.Errorf("host after rollback = %q, %v", out.Stdout, err)
+	}
+	if _, err := h.Exec("", "config", "rollback", "--yes", "x"); !errs.Is(err, errs.Invalid) {
+		t.Errorf("config rollback x = %v, want invalid", err)
+	}
+	if _, err := h.Exec("", "config", "rollback", "--yes", "999"); !errs.Is(err, errs.NotFound) {
+		t.Errorf("config rollback 999 = %v, want not found", err)
+	}
+}
+
+func TestConfigSchema(t *testing.T) {
+	h := apptest.New(t)
+	defer h.Close()
+
+	out, err := h.Exec("", "config", "schema")
+	if err != nil {
+		t.Fatalf("config schema: %v", err)
+	}
+	var schema config.JSONSchema
+	if err := json.Unmarshal([]byte(out.Stdout), &schema); err != nil {
+		t.Fatalf("config schema isn't JSON: %v\n%s", err, out.Stdout)
+	}
+	port := schema.Properties["port"]
+	if port == nil || port.Type != "integer" || port.Minimum == nil || *port.Minimum != 1 || port.Description == "" {
+		t.Errorf("port schema = %+v", port)
+	}
+	// enums registered by other packages
+	if enc := schema.Properties["backup"].Properties["encrypt"]; !slices.Contains(enc.Enum, "passphrase") {
+		t.Errorf("backup.encrypt enum = %v", enc.Enum)
+	}
+	if f := schema.Properties["webhooks"].Items.Properties["format"]; !slices.Contains(f.Enum, "slack") {
+		t.Errorf("webhooks format enum = %v", f.Enum)
+	}
+	if _, ok := schema.Properties["startCounter"]; ok {
+		t.Error("config schema includes recorded startCounter")
+	}
+}
@@ -0,0 +1,739 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sprout/internal/app"
+	"sprout/internal/platform/database/config"
+	"sprout/internal/platform/notify"
+	"sprout/internal/platform/remoteconfig"
+	"sprout/internal/types"
+	"sprout/pkg/errs"
+	"sprout/pkg/x"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+var Config = register(func(a *app.App) *cli.Command {
+	return &cli.Command{
+		Name:        "config",
+		Usage:       "read and change configuration values",
+		Description: "Keys are the JSON names of the config, nested ones joined by dots (e.g. backup.schedule), see `config list`. Values are parsed by the key's type: strings as is, numbers, true / false, times in RFC 3339, lists and nested settings as JSON. A running service picks changes up on restart. Values in `<storage>/" + config.FileName + "` (same keys, as YAML) override the database's.",
+		Commands: []*cli.Command{
+			{
+				Name:  "list",
+				Usage: "print all settings and their values",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "all",
+						Usage: "include values the app records for itself (read-only)",
+					},
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "print as a JSON object of key: value",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					w := cmd.Root().Writer
+					cfg, err := config.View(a.DB)
+					if err != nil {
+						return err
+					}
+					out := map[string]any{}
+					for _, f := range config.Fields(cfg) {
+						if config.Recorded(f.Key) && !cmd.Bool("all") {
+							continue
+						}
+						value := config.FormatRedacted(f.Value)
+						if by := setBy(a, f.Key); by != "" && !cmd.Bool("json") {
+							value += " (" + by + ")"
+						}
+						if cmd.Bool("json") {
+							out[f.Key] = value
+							continue
+						}
+						fmt.Fprintf(w, "%-28s %s\n", f.Key, value)
+					}
+					if cmd.Bool("json") {
+						b, err := json.MarshalIndent(out, "", "  ")
+						if err != nil {
+							return err
+						}
+						fmt.Fprintln(w, string(b))
+					}
+					return nil
+				},
+			},
+			{
+				Name:        "diff",
+				Usage:       "print the settings that differ from the defaults",
+				Description: "Shows what was customized on this install, as `key  default -> current`, secrets redacted. Values set by " + config.FileName + " are marked.",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "print as a JSON list of {key, default, value}",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					w := cmd.Root().Writer
+					cfg, err := config.View(a.DB)
+					if err != nil {
+						return err
+					}
+					def := types.DefaultConfig()
+					changes := config.Diff(&def, cfg)
+					if cmd.Bool("json") {
+						type change struct {
+							Key     string `json:"key"`
+							Default string `json:"default"`
+							Value   string `json:"value"`
+						}
+						out := []change{}
+						for _, c := range changes {
+							out = append(out, change{c.Key, config.FormatRedacted(c.From), config.FormatRedacted(c.To)})
+						}
+						b, err := json.MarshalIndent(out, "", "  ")
+						if err != nil {
+							return err
+						}
+						fmt.Fprintln(w, string(b))
+						return nil
+					}
+					if len(changes) == 0 {
+						fmt.Fprintln(w, "All settings are at their defaults.")
+						return nil
+					}
+					for _, c := range changes {
+						from, to := config.FormatRedacted(c.From), config.FormatRedacted(c.To)
+						line := fmt.Sprintf("%-28s %s -> %s", c.Key, x.Ternary(from == "", `""`, from), x.Ternary(to == "", `""`, to))
+						if by := setBy(a, c.Key); by != "" {
+							line += " (" + by + ")"
+						}
+						fmt.Fprintln(w, line)
+					}
+					return nil
+				},
+			},
+			{
+				Name:        "sources",
+				Usage:       "print where each setting's value comes from",
+				Description: "Settings are read from, highest precedence first: flags (--port), the environment (" + config.EnvPrefix(a.BuildInfo().Name) + "<NAME>, see `config schema`), " + config.FileName + ", the profile in use, the database, the defaults. Prints each setting with its effective value and the source it comes from, secrets redacted.",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "print as a JSON list of {key, value, source}",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					w := cmd.Root().Writer
+					sources, err := config.Sources(a.DB)
+					if err != nil {
+						return err
+					}
+					if cmd.Bool("json") {
+						type source struct {
+							Key    string `json:"key"`
+							Value  string `json:"value"`
+							Source string `json:"source"`
+						}
+						out := []source{}
+						for _, s := range sources {
+							out = append(out, source{s.Key, config.FormatRedacted(s.Value), s.From})
+						}
+						b, err := json.MarshalIndent(out, "", "  ")
+						if err != nil {
+							return err
+						}
+						fmt.Fprintln(w, string(b))
+						return nil
+					}
+					for _, s := range sources {
+						value := config.FormatRedacted(s.Value)
+						fmt.Fprintf(w, "%-28s %-14s %s\n", s.Key, s.From, x.Ternary(value == "", `""`, value))
+					}
+					return nil
+				},
+			},
+			{
+				Name:        "history",
+				Usage:       "print recent changes of the settings, newest first",
+				Description: fmt.Sprintf("Every change of a setting is recorded with when, where from (cli, web for the settings page, api for the settings endpoints without a browser, app for the app itself), the profile it changed and the old and new values, secrets redacted. The last %d are kept.", config.HistoryKeep),
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "limit",
+						Value: 20,
+						Usage: "number of changes to show (0 = all)",
+					},
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "print as JSON",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					w := cmd.Root().Writer
+					history, err := config.History(a.DB, int(cmd.Int("limit")))
+					if err != nil {
+						return err
+					}
+					if cmd.Bool("json") {
+						b, err := json.MarshalIndent(x.Ternary(history == nil, []config.Revision{}, history), "", "  ")
+						if err != nil {
+							return err
+						}
+						fmt.Fprintln(w, string(b))
+						return nil
+					}
+					if len(history) == 0 {
+						fmt.Fprintln(w, "No settings changed yet.")
+						return nil
+					}
+					for _, rev := range history {
+						source := rev.Source
+						if rev.Profile != "" {
+							source += " (" + rev.Profile + ")"
+						}
+						fmt.Fprintf(w, "%s  %s\n", rev.Time.Local().Format(time.DateTime), source)
+						for _, f := range rev.Fields {
+							fmt.Fprintf(w, "    %-28s %s -> %s\n", f.Key, x.Ternary(f.Old == "", `""`, f.Old), x.Ternary(f.New == "", `""`, f.New))
+						}
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "get",
+				Usage:     "print one value, secrets included",
+				ArgsUsage: "<key>",
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					if cmd.Args().Len() != 1 {
+						return errs.New(errs.Invalid, "expected exactly one key, see `config list`")
+					}
+					cfg, err := config.View(a.DB)
+					if err != nil {
+						return err
+					}
+					v, err := config.Lookup(cfg, cmd.Args().First())
+					if err != nil {
+						return err
+					}
+					fmt.Fprintln(cmd.Root().Writer, config.Format(v))
+					return nil
+				},
+			},
+			{
+				Name:        "set",
+				Usage:       "change one value",
+				ArgsUsage:   "<key> <value>",
+				Description: "Checks the value like the settings page and `service set` do (see types.Configuration.Validate), e.g. `config set port 8080`, `config set backup.schedule \"0 3 * * *\"`, `config set netWaitProbes '[\"dns:example.com\"]'`. A new port is checked to be free and bindable by this user, like the service's startup self-test does.",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "save a port the check finds in use",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					if cmd.Args().Len() != 2 {
+						return errs.New(errs.Invalid, "expected a key and a value, e.g. `config set port 8080`")
+					}
+					key, value := cmd.Args().Get(0), cmd.Args().Get(1)
+					if config.Recorded(key) {
+						return errs.New(errs.Invalid, fmt.Sprintf("%s is recorded by the app, not a setting", key))
+					}
+
+					var warning string
+					if err := config.UpdateFrom(a.DB, config.SourceCLI, func(cfg *types.Configuration) error {
+						port := cfg.Port
+						v, err := config.Lookup(cfg, key)
+						if err != nil {
+							return err
+						}
+						if err := config.Parse(v, value); err != nil {
+							return errs.Wrap(errs.Invalid, err, "invalid "+key)
+						}
+						if fe := cfg.Validate().For(key); fe != nil {
+							return errs.Wrap(errs.Invalid, fe, "invalid setting")
+						}
+						if cfg.Port != port {
+							warning, err = checkPort(cfg.Port, cmd.Bool("force"))
+							return err
+						}
+						return nil
+					}); err != nil {
+						if errs.Is(err, errs.Invalid) || errs.Is(err, errs.NotFound) || errs.Is(err, errs.Conflict) {
+							return err
+						}
+						return fmt.Errorf("failed to update config: %w", err)
+					}
+
+					a.Notify.Dispatch(notify.Event{
+						Kind:    notify.EventConfigChanged,
+						Title:   "Configuration changed",
+						Message: "changed via cli: " + key,
+						Fields:  map[string]string{"source": "cli", "fields": key},
+					})
+					w := cmd.Root().Writer
+					if profile, _ := config.ActiveProfile(a.DB); profile != "" {
+						fmt.Fprintf(w, "Set %s in profile %s. Restart the service for it to take effect.\n", key, profile)
+					} else {
+						fmt.Fprintf(w, "Set %s. Restart the service for it to take effect.\n", key)
+					}
+					for _, l := range config.Layers(a.DB) {
+						if l.Sets(key) {
+							fmt.Fprintf(w, "note: %s sets %s too, its value wins until it's removed there.\n", l.Path, key)
+						}
+					}
+					if warning != "" {
+						fmt.Fprintf(w, "warning: %s\n", warning)
+					}
+					return nil
+				},
+			},
+			{
+				Name:        "export",
+				Usage:       "print all settings as JSON, for another machine or version control",
+				Description: "Nested like " + config.FileName + ", values the app records for itself left out. Secrets print as " + types.Redacted + ", which `config import` reads as \"keep the current value\", unless --secrets.",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "secrets",
+						Usage: "include tokens and signing keys",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					cfg, err := config.View(a.DB)
+					if err != nil {
+						return err
+					}
+					b, err := config.Export(cfg, cmd.Bool("secrets"))
+					if err != nil {
+						return fmt.Errorf("failed to export config: %w", err)
+					}
+					fmt.Fprintln(cmd.Root().Writer, string(b))
+					return nil
+				},
+			},
+			{
+				Name:        "import",
+				Usage:       "replace the settings with a `config export`",
+				Description: "Reads JSON or YAML with the keys of `config export` / " + config.FileName + ". Settings the file leaves out are reset to their defaults, unless --merge. Values the app records for itself are kept. The result is validated like `config set`, nothing changes if it's invalid.",
+				ArgsUsage:   "<file|->",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "merge",
+						Usage: "only change the settings the file has",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					var raw []byte
+					var err error
+					switch path := cmd.Args().First(); path {
+					case "":
+						return errs.New(errs.Invalid, "missing file argument, - for stdin")
+					case "-":
+						raw, err = io.ReadAll(cmd.Root().Reader)
+					default:
+						if raw, err = os.ReadFile(path); errors.Is(err, os.ErrNotExist) {
+							return errs.Wrap(errs.NotFound, err, "failed to read "+path)
+						}
+					}
+					if err != nil {
+						return fmt.Errorf("failed to read settings: %w", err)
+					}
+					f, err := config.ParseFile(x.Ternary(cmd.Args().First() == "-", "stdin", cmd.Args().First()), raw)
+					if err != nil {
+						return err
+					}
+
+					if err := config.UpdateFrom(a.DB, config.SourceCLI, func(cfg *types.Configuration) error {
+						return config.Import(cfg, f, cmd.Bool("merge"))
+					}); err != nil {
+						if errs.Is(err, errs.Invalid) {
+							return err
+						}
+						return fmt.Errorf("failed to update config: %w", err)
+					}
+
+					a.Notify.Dispatch(notify.Event{
+						Kind:    notify.EventConfigChanged,
+						Title:   "Configuration changed",
+						Message: "imported via cli: " + strings.Join(f.Keys, ", "),
+						Fields:  map[string]string{"source": "cli", "fields": strings.Join(f.Keys, ",")},
+					})
+					w := cmd.Root().Writer
+					if cmd.Bool("merge") {
+						fmt.Fprintf(w, "Imported %d settings: %s.\n", len(f.Keys), strings.Join(f.Keys, ", "))
+					} else {
+						fmt.Fprintf(w, "Imported %d settings, the others are reset to their defaults.\n", len(f.Keys))
+					}
+					fmt.Fprintln(w, "Restart the service for them to take effect.")
+					return nil
+				},
+			},
+			{
+				Name:        "reset",
+				Usage:       "restore every setting to its default",
+				Description: "Tokens, webhooks and notification routes are settings too and are cleared. Values the app records for itself (update state, start counters) are kept. Values in " + config.FileName + " still override the defaults. See `config export` to keep a copy first.",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "yes",
+						Usage: "don't ask for confirmation",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					w := cmd.Root().Writer
+					if !cmd.Bool("yes") {
+						yes, err := confirm(cmd, "Reset all settings to their defaults?")
+						if err != nil {
+							return fmt.Errorf("prompt failed: %w", err)
+						}
+						if !yes {
+							fmt.Fprintln(w, "Reset cancelled.")
+							return nil
+						}
+					}
+					if err := config.UpdateFrom(a.DB, config.SourceCLI, func(cfg *types.Configuration) error {
+						config.Reset(cfg)
+						return nil
+					}); err != nil {
+						return fmt.Errorf("failed to update config: %w", err)
+					}
+					a.Notify.Dispatch(notify.Event{
+						Kind:    notify.EventConfigChanged,
+						Title:   "Configuration reset",
+						Message: "reset to defaults via cli",
+						Fields:  map[string]string{"source": "cli", "fields": "*"},
+					})
+					fmt.Fprintln(w, "Settings reset to their defaults. Restart the service for them to take effect.")
+					for _, l := range config.Layers(a.DB) {
+						fmt.Fprintf(w, "note: %s still sets %s.\n", l.Path, strings.Join(l.Keys, ", "))
+					}
+					return nil
+				},
+			},
+			{
+				Name:        "rollback",
+				Usage:       "restore the settings from before a change",
+				ArgsUsage:   "[n]",
+				Description: fmt.Sprintf("Restores the settings as they were before the n-th newest change (default 1, the last one), e.g. after a wrong proxyPort locked out the settings page. --list shows the %d snapshots kept. A rollback is a change too, rolling back again undoes it. Values the app records for itself are kept, settings go to the profile in use.", config.SnapshotKeep),
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "list",
+						Usage: "print the snapshots instead, newest first",
+					},
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "print the --list as JSON",
+					},
+					&cli.BoolFlag{
+						Name:  "yes",
+						Usage: "don't ask for confirmation",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					w := cmd.Root().Writer
+					snaps, err := config.Snapshots(a.DB)
+					if err != nil {
+						return err
+					}
+					if cmd.Bool("list") {
+						if cmd.Bool("json") {
+							b, err := json.MarshalIndent(x.Ternary(snaps == nil, []config.Snapshot{}, snaps), "", "  ")
+							if err != nil {
+								return err
+							}
+							fmt.Fprintln(w, string(b))
+							return nil
+						}
+						if len(snaps) == 0 {
+							fmt.Fprintln(w, "No snapshots yet, they're taken when settings change.")
+							return nil
+						}
+						for i, s := range snaps {
+							source := s.Source
+							if s.Profile != "" {
+								source += " (" + s.Profile + ")"
+							}
+							fmt.Fprintf(w, "%3d  before %s  %s\n", i+1, s.Time.Local().Format(time.DateTime), source)
+						}
+						return nil
+					}
+
+					n := 1
+					if cmd.Args().Len() > 1 {
+						return errs.New(errs.Invalid, "expected at most one snapshot number, see `config rollback --list`")
+					}
+					if arg := cmd.Args().First(); arg != "" {
+						if n, err = strconv.Atoi(arg); err != nil {
+							return errs.New(errs.Invalid, fmt.Sprintf("invalid snapshot number %q, see `config rollback --list`", arg))
+						}
+					}
+					if n < 1 || n > len(snaps) {
+						return errs.New(errs.NotFound, fmt.Sprintf("no snapshot %d, there are %d (see `config rollback --list`)", n, len(snaps)))
+					}
+					if !cmd.Bool("yes") {
+						yes, err := confirm(cmd, fmt.Sprintf("Restore the settings from before the change at %s?", snaps[n-1].Time.Local().Format(time.DateTime)))
+						if err != nil {
+							return fmt.Errorf("prompt failed: %w", err)
+						}
+						if !yes {
+							fmt.Fprintln(w, "Rollback cancelled.")
+							return nil
+						}
+					}
+					_, changed, err := config.Rollback(a.DB, config.SourceCLI, n)
+					if err != nil {
+						return err
+					}
+					if len(changed) == 0 {
+						fmt.Fprintln(w, "The settings already match the snapshot.")
+						return nil
+					}
+					keys := make([]string, len(changed))
+					for i, f := range changed {
+						keys[i] = f.Key
+						fmt.Fprintf(w, "%-28s %s -> %s\n", f.Key, x.Ternary(f.Old == "", `""`, f.Old), x.Ternary(f.New == "", `""`, f.New))
+					}
+					a.Notify.Dispatch(notify.Event{
+						Kind:    notify.EventConfigChanged,
+						Title:   "Configuration rolled back",
+						Message: "rolled back via cli: " + strings.Join(keys, ", "),
+						Fields:  map[string]string{"source": "cli", "fields": strings.Join(keys, ",")},
+					})
+					fmt.Fprintln(w, "Settings rolled back. Restart the service for them to take effect.")
+					for _, key := range keys {
+						if by := setBy(a, key); by != "" {
+							fmt.Fprintf(w, "note: %s sets %s, its value wins until it's removed there.\n", by, key)
+						}
+					}
+					return nil
+				},
+			},
+			{
+				Name:        "profile",
+				Usage:       "manage named sets of settings, e.g. dev / staging / prod",
+				Description: "A profile holds the settings that differ from the database's own, layered over them while it's in use. `config profile use` picks the one every command and the service use, --profile (or " + config.ProfileEnv + ") picks one for a single run, \"" + config.DefaultProfile + "\" none. Settings changed while a profile is in use (`--profile dev config set port 8080`, the settings page) are saved to it. A running service picks up `config profile use` on reload.",
+				Commands: []*cli.Command{
+					{
+						Name:  "list",
+						Usage: "print the profiles, * marks the one in use",
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							w := cmd.Root().Writer
+							profiles, err := config.Profiles(a.DB)
+							if err != nil {
+								return err
+							}
+							active, err := config.ActiveProfile(a.DB)
+							if err != nil {
+								return err
+							}
+							fmt.Fprintf(w, "%s %s (the database's settings)\n", x.Ternary(active == "", "*", " "), config.DefaultProfile)
+							for _, p := range profiles {
+								line := fmt.Sprintf("%s %s (%d settings)", x.Ternary(p.Name == active, "*", " "), p.Name, len(p.Values))
+								if p.Active {
+									line += ", picked by `config profile use`"
+								}
+								fmt.Fprintln(w, line)
+							}
+							return nil
+						},
+					},
+					{
+						Name:      "show",
+						Usage:     "print the settings a profile sets, secrets redacted",
+						ArgsUsage: "<name>",
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							if cmd.Args().Len() != 1 {
+								return errs.New(errs.Invalid, "expected a profile name, see `config profile list`")
+							}
+							profiles, err := config.Profiles(a.DB)
+							if err != nil {
+								return err
+							}
+							i := slices.IndexFunc(profiles, func(p config.Profile) bool { return p.Name == cmd.Args().First() })
+							if i < 0 {
+								return errs.New(errs.NotFound, fmt.Sprintf("unknown profile %q", cmd.Args().First()))
+							}
+							for _, f := range profiles[i].Fields() {
+								fmt.Fprintf(cmd.Root().Writer, "%-28s %s\n", f.Key, config.FormatRedacted(f.Value))
+							}
+							return nil
+						},
+					},
+					{
+						Name:        "create",
+						Usage:       "add a profile",
+						ArgsUsage:   "<name>",
+						Description: "It starts out setting nothing, i.e. like the database's settings, or as a copy of --from. Change its settings with `--profile <name> config set`.",
+						Flags: []cli.Flag{
+							&cli.StringFlag{
+								Name:  "from",
+								Usage: "copy the settings of this profile",
+							},
+						},
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							if cmd.Args().Len() != 1 {
+								return errs.New(errs.Invalid, "expected a profile name, e.g. `config profile create dev`")
+							}
+							name := cmd.Args().First()
+							if err := config.CreateProfile(a.DB, name, cmd.String("from")); err != nil {
+								return err
+							}
+							fmt.Fprintf(cmd.Root().Writer, "Created profile %s, change its settings with `--profile %s config set`.\n", name, name)
+							return nil
+						},
+					},
+					{
+						Name:      "use",
+						Usage:     "pick the profile every command and the service use",
+						ArgsUsage: "<name|" + config.DefaultProfile + ">",
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							if cmd.Args().Len() != 1 {
+								return errs.New(errs.Invalid, "expected a profile name, see `config profile list`")
+							}
+							name := cmd.Args().First()
+							if err := config.ActivateProfile(a.DB, name); err != nil {
+								return err
+							}
+							fmt.Fprintf(cmd.Root().Writer, "Using profile %s. Reload or restart the service for it to take effect.\n", name)
+							return nil
+						},
+					},
+					{
+						Name:      "delete",
+						Usage:     "remove a profile and its settings",
+						ArgsUsage: "<name>",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "yes",
+								Usage: "don't ask for confirmation",
+							},
+						},
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							w := cmd.Root().Writer
+							if cmd.Args().Len() != 1 {
+								return errs.New(errs.Invalid, "expected a profile name, see `config profile list`")
+							}
+							name := cmd.Args().First()
+							if !cmd.Bool("yes") {
+								yes, err := confirm(cmd, fmt.Sprintf("Delete profile %s and its settings?", name))
+								if err != nil {
+									return fmt.Errorf("prompt failed: %w", err)
+								}
+								if !yes {
+									fmt.Fprintln(w, "Delete cancelled.")
+									return nil
+								}
+							}
+							if err := config.DeleteProfile(a.DB, name); err != nil {
+								return err
+							}
+							fmt.Fprintf(w, "Deleted profile %s.\n", name)
+							return nil
+						},
+					},
+				},
+			},
+			{
+				Name:        "remote",
+				Usage:       "pull the config overlay at remoteConfig.url",
+				Description: "The service pulls the settings at remoteConfig.url (YAML or JSON with the keys of " + config.FileName + ") on remoteConfig.schedule, every 15 minutes by default, and applies them like `config import --merge` if <url>.minisig verifies with remoteConfig.publicKey or the build's release signing key. An unchanged overlay isn't applied again, settings changed locally stick until it changes. Flags, the environment and " + config.FileName + " still win, see `config sources`.",
+				Commands: []*cli.Command{
+					{
+						Name:  "pull",
+						Usage: "pull and apply the overlay now",
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							w := cmd.Root().Writer
+							res, err := remoteconfig.Pull(ctx, a.HTTP, a.DB, a.BuildInfo().SigningKey)
+							if err != nil {
+								return err
+							}
+							switch {
+							case res.NotModified:
+								fmt.Fprintf(w, "%s is unchanged since the last pull.\n", res.URL)
+							case len(res.Changed) == 0:
+								fmt.Fprintf(w, "%s changes no settings.\n", res.URL)
+							default:
+								a.Notify.Dispatch(notify.Event{
+									Kind:    notify.EventConfigChanged,
+									Title:   "Configuration changed",
+									Message: "changed via remote config: " + strings.Join(res.Changed, ", "),
+									Fields:  map[string]string{"source": config.SourceRemote, "fields": strings.Join(res.Changed, ",")},
+								})
+								fmt.Fprintf(w, "Applied %s: %s.\n", res.URL, strings.Join(res.Changed, ", "))
+								for _, key := range res.Changed {
+									if by := setBy(a, key); by != "" {
+										fmt.Fprintf(w, "note: %s sets %s too, its value wins until it's removed there.\n", by, key)
+									}
+								}
+							}
+							return nil
+						},
+					},
+					{
+						Name:  "status",
+						Usage: "print the remote config settings and the last pull",
+						Action: func(ctx context.Context, cmd *cli.Command) error {
+							w := cmd.Root().Writer
+							cfg, err := config.View(a.DB)
+							if err != nil {
+								return err
+							}
+							rc, state := cfg.RemoteConfig, cfg.RemoteConfigState
+							if rc.URL == "" {
+								fmt.Fprintln(w, "Remote config is off, set remoteConfig.url to turn it on.")
+								return nil
+							}
+							when := func(t time.Time) string {
+								return x.Ternary(t.IsZero(), "never", t.Local().Format(time.DateTime))
+							}
+							fmt.Fprintf(w, "url:        %s\n", rc.URL)
+							fmt.Fprintf(w, "schedule:   %s\n", remoteconfig.Schedule(rc))
+							fmt.Fprintf(w, "key:        %s\n", x.Ternary(rc.PublicKey != "", "remoteConfig.publicKey", x.Ternary(a.BuildInfo().SigningKey != "", "the build's signing key", "none, pulls fail")))
+							fmt.Fprintf(w, "checked:    %s\n", when(state.Checked))
+							fmt.Fprintf(w, "applied:    %s\n", when(state.Applied))
+							if state.URL == rc.URL && state.ETag != "" {
+								fmt.Fprintf(w, "etag:       %s\n", state.ETag)
+							}
+							if state.LastError != "" {
+								fmt.Fprintf(w, "last error: %s\n", state.LastError)
+							}
+							return nil
+						},
+					},
+				},
+			},
+			{
+				Name:        "schema",
+				Usage:       "print a JSON Schema of the settings",
+				Description: "Types, defaults, descriptions and valid values of every setting (the keys `config list` shows, nested as in " + config.FileName + "), for editors and tools that build forms or check values before `config set`. The service serves the same at /settings/schema.",
+				Metadata:    map[string]any{noDB: true},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					enc := json.NewEncoder(cmd.Root().Writer)
+					enc.SetEscapeHTML(false)
+					enc.SetIndent("", "  ")
+					return enc.Encode(config.Schema(a.BuildInfo().Name + " configuration"))
+				},
+			},
+		},
+	}
+})
+
+// setBy returns where the value of key in config.View comes from if not the
+// database: the config file's name or config.EnvPath, "" otherwise.
+func setBy(a *app.App, key string) string {
+	by := ""
+	for _, l := range config.Layers(a.DB) {
+		if l.Sets(key) {
+			by = filepath.Base(l.Path) // the last layer wins
+		}
+	}
+	return by
+}
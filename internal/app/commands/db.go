@@ -0,0 +1,533 @@
+package commands
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"sprout/internal/app"
+	"sprout/internal/platform/backup"
+	"sprout/internal/platform/database"
+	"sprout/internal/platform/database/config"
+	"sprout/internal/platform/database/kv"
+	"sprout/internal/platform/transfer"
+	"sprout/pkg/errs"
+	"sprout/pkg/humanize"
+	"sprout/pkg/progress"
+	"strings"
+	"text/tabwriter"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/urfave/cli/v3"
+)
+
+var DB = register(func(a *app.App) *cli.Command {
+	return &cli.Command{
+		Name:  "db",
+		Usage: "database maintenance",
+		Commands: []*cli.Command{
+			{
+				Name:        "export",
+				Usage:       "print every database bucket as one JSON document",
+				Description: "For inspecting data or editing it by hand, e.g. `db export > dump.json`, then `db import dump.json`. Printable keys and JSON values are written as is, others base64 encoded. The dump holds config secrets (tokens, webhook keys), keep it safe. Encrypted values (see `db encrypt`) stay encrypted in it. Use export-all for large databases.",
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					_, err := transfer.ExportJSON(a.DB, cmd.Root().Writer, transfer.Header{
+						App:        a.BuildInfo().Name,
+						Version:    a.BuildInfo().Version,
+						StorageDir: a.StorageDir,
+						CreatedAt:  time.Now(),
+					})
+					if err != nil {
+						return fmt.Errorf("failed to export: %w", err)
+					}
+					return nil
+				},
+			},
+			{
+				Name:        "import",
+				Usage:       "replace all data with a `db export` dump",
+				Description: "Replaces every database bucket with the dump's contents and migrates it to this version's schema, in one transaction. A backup is taken first. Stop the service before importing and start it afterwards.",
+				ArgsUsage:   "<dump.json>",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "yes",
+						Usage: "don't ask for confirmation",
+					},
+					&cli.BoolFlag{
+						Name:  "no-backup",
+						Usage: "skip the backup of the current data",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					w := cmd.Root().Writer
+					path := cmd.Args().First()
+					if path == "" {
+						return errs.New(errs.Invalid, "missing dump argument")
+					}
+					f, err := os.Open(path)
+					if err != nil {
+						return errs.Wrap(errs.NotFound, err, fmt.Sprintf("failed to open %s", path))
+					}
+					defer f.Close()
+					cfg, err := config.View(a.DB)
+					if err != nil {
+						return fmt.Errorf("failed to get configuration from database: %w", err)
+					}
+
+					p := progress.New(w)
+					var cancelled bool
+					var step *progress.Task
+					h, err := transfer.ImportJSON(a.DB, f, a.Log, func(h *transfer.Header) error {
+						if h.App != a.BuildInfo().Name {
+							return errs.New(errs.Invalid, fmt.Sprintf("dump is from %q, not %s", h.App, a.BuildInfo().Name))
+						}
+						fmt.Fprintf(w, "Dump from %s %s (schema %s), exported %s\n", h.App, h.Version, h.SchemaVersion, h.CreatedAt.Local().Format(time.DateTime))
+						if !cmd.Bool("yes") {
+							yes, err := confirm(cmd, "Replace ALL current data with it?")
+							if err != nil {
+								return fmt.Errorf("prompt failed: %w", err)
+							}
+							if cancelled = !yes; cancelled {
+								return errs.New(errs.Conflict, "import cancelled")
+							}
+						}
+						if !cmd.Bool("no-backup") {
+							s := p.Step("Backing up current data")
+							path, err := backup.Create(a.DB, backup.Options{Dir: backup.Dir(a.StorageDir, cfg.Backup.Dir), App: a.BuildInfo().Name, Version: a.BuildInfo().Version}, time.Now())
+							if s.End(err) != nil {
+								return fmt.Errorf("failed to back up current data (use --no-backup to skip): %w", err)
+							}
+							fmt.Fprintf(w, "Current data backed up to %s\n", path)
+						}
+						step = p.Step("Importing and migrating")
+						return nil
+					})
+					if step != nil {
+						step.End(err)
+					}
+					if cancelled {
+						fmt.Fprintln(w, "Import cancelled.")
+						return nil
+					} else if err != nil {
+						if errs.KindOf(err) != errs.Internal {
+							return err
+						}
+						return errs.Wrap(errs.Invalid, err, "failed to import")
+					}
+
+					if err := moveStoragePaths(a, h); err != nil {
+						return err
+					}
+					fmt.Fprintln(w, "Import complete. Restart the service if it's running.")
+					return nil
+				},
+			},
+			{
+				Name:        "export-dbi",
+				Usage:       "print one database bucket as JSON lines, for transforming it out of process",
+				Description: "The first line is a header with the migration version the entries are shaped for, then one entry per line, values decrypted. Transform them (e.g. on another machine) to a later version's shape, set the header's version to it and load the result with `db import-dbi`, which runs only the migrations after that version. Heavy rewrites then don't have to fit in one write transaction.",
+				ArgsUsage:   "<dbi>",
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					if cmd.Args().Len() != 1 {
+						return errs.New(errs.Invalid, "expected 1 argument: "+cmd.ArgsUsage)
+					}
+					_, err := transfer.ExportDBI(a.DB, cmd.Root().Writer, transfer.DBIHeader{
+						App:       a.BuildInfo().Name,
+						DBI:       cmd.Args().First(),
+						CreatedAt: time.Now(),
+					})
+					if err != nil {
+						return fmt.Errorf("failed to export: %w", err)
+					}
+					return nil
+				},
+			},
+			{
+				Name:        "import-dbi",
+				Usage:       "replace one database bucket with a `db export-dbi` stream",
+				Description: "Replaces the bucket named in the header, records it at the header's version and runs the migrations after it, in one transaction. Buckets without migrations of their own must be at this database's schema version. A backup is taken first.",
+				ArgsUsage:   "<file|->",
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "yes",
+						Usage: "don't ask for confirmation",
+					},
+					&cli.BoolFlag{
+						Name:  "no-backup",
+						Usage: "skip the backup of the current data",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					w := cmd.Root().Writer
+					var r io.Reader
+					switch path := cmd.Args().First(); path {
+					case "":
+						return errs.New(errs.Invalid, "missing file argument, - for stdin")
+					case "-":
+						if !cmd.Bool("yes") {
+							return errs.New(errs.Invalid, "reading from stdin needs --yes, the prompt can't share it")
+						}
+						r = cmd.Root().Reader
+					default:
+						f, err := os.Open(path)
+						if err != nil {
+							return errs.Wrap(errs.NotFound, err, fmt.Sprintf("failed to open %s", path))
+						}
+						defer f.Close()
+						r = f
+					}
+					cfg, err := config.View(a.DB)
+					if err != nil {
+						return fmt.Errorf("failed to get configuration from database: %w", err)
+					}
+
+					var cancelled bool
+					h, err := transfer.ImportDBI(a.DB, r, a.Log, func(h *transfer.DBIHeader) error {
+						if h.App != a.BuildInfo().Name {
+							return errs.New(errs.Invalid, fmt.Sprintf("export is from %q, not %s", h.App, a.BuildInfo().Name))
+						}
+						fmt.Fprintf(w, "%s at version %q, exported %s\n", h.DBI, h.Version, h.CreatedAt.Local().Format(time.DateTime))
+						if !cmd.Bool("yes") {
+							yes, err := confirm(cmd, "Replace all data in "+h.DBI+" with it?")
+							if err != nil {
+								return fmt.Errorf("prompt failed: %w", err)
+							}
+							if cancelled = !yes; cancelled {
+								return errs.New(errs.Conflict, "import cancelled")
+							}
+						}
+						if !cmd.Bool("no-backup") {
+							path, err := backup.Create(a.DB, backup.Options{Dir: backup.Dir(a.StorageDir, cfg.Backup.Dir), App: a.BuildInfo().Name, Version: a.BuildInfo().Version}, time.Now())
+							if err != nil {
+								return fmt.Errorf("failed to back up current data (use --no-backup to skip): %w", err)
+							}
+							fmt.Fprintf(w, "Current data backed up to %s\n", path)
+						}
+						return nil
+					})
+					if cancelled {
+						fmt.Fprintln(w, "Import cancelled.")
+						return nil
+					} else if err != nil {
+						if errs.KindOf(err) != errs.Internal {
+							return err
+						}
+						return errs.Wrap(errs.Invalid, err, "failed to import")
+					}
+					fmt.Fprintf(w, "Imported %d entries into %s. Restart the service if it's running.\n", h.Entries, h.DBI)
+					return nil
+				},
+			},
+			{
+				Name:        "repair",
+				Usage:       "clear stale reader slots and unusable lock files left by crashes",
+				Description: "Runs without opening the database normally, so it works when other commands fail with a locked or unopenable environment. Reader slots of exited processes are always safe to clear. " + database.LockFile + " is only deleted if the database won't open and no process has it open, after asking.",
+				Metadata:    map[string]any{noDB: true},
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "yes",
+						Usage: "delete an unusable " + database.LockFile + " without asking",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					w := cmd.Root().Writer
+					if a.Dev {
+						return errs.New(errs.Unavailable, "dev mode works on a throwaway copy, run without --dev to repair the real database")
+					}
+					if a.DB != nil {
+						return errs.New(errs.Conflict, "database is already open in this process")
+					}
+					dir := a.DBDir()
+
+					r, err := database.Repair(dir, false)
+					if err != nil && r != nil && r.OpenErr != nil && r.LockHolder == 0 {
+						fmt.Fprintf(w, "Database won't open: %v\n", r.OpenErr)
+						fmt.Fprintf(w, "No process has it open, so %s can be recreated safely (it holds no data).\n", database.LockFile)
+						yes := cmd.Bool("yes")
+						if !yes {
+							if yes, err = confirm(cmd, "Delete "+database.LockFile+"?"); err != nil {
+								return fmt.Errorf("prompt failed: %w", err)
+							}
+						}
+						if !yes {
+							fmt.Fprintln(w, "Repair cancelled.")
+							return nil
+						}
+						r, err = database.Repair(dir, true)
+					}
+					if err != nil {
+						if r != nil && r.LockHolder != 0 {
+							return errs.Wrap(errs.Conflict, err, fmt.Sprintf("database is in use by PID %d, stop it first", r.LockHolder))
+						}
+						return fmt.Errorf("failed to repair database: %w", err)
+					}
+
+					if r.LockRemoved {
+						fmt.Fprintf(w, "Removed unusable %s.\n", database.LockFile)
+					}
+					if r.LockHolder != 0 {
+						fmt.Fprintf(w, "In use by:     PID %d\n", r.LockHolder)
+					}
+					slices.Sort(r.Readers)
+					fmt.Fprintf(w, "Reader slots:  %d %v\n", len(r.Readers), slices.Compact(r.Readers))
+					fmt.Fprintf(w, "Stale cleared: %d\n", r.StaleReaders)
+					if r.StaleReaders == 0 && !r.LockRemoved {
+						fmt.Fprintln(w, "Nothing to repair.")
+					}
+					return nil
+				},
+			},
+			{
+				Name:        "compact",
+				Usage:       "rewrite the database without free pages and deleted data",
+				Description: "On exit stops the service and other instances, writes a compacted copy of the database next to it under the migration lock and swaps it in, then starts the service again. The data file shrinks by the free pages `db stats` reports. The current database is left as is if the copy fails.",
+				Metadata:    map[string]any{noDB: true},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					w := cmd.Root().Writer
+					err := a.DeferCompact(func(r app.CompactResult) {
+						fmt.Fprintf(w, "Database compacted, %s went from %s to %s\n", kv.DataFile, humanize.Bytes(r.Before), humanize.Bytes(r.After))
+					})
+					if err != nil {
+						return err
+					}
+					fmt.Fprintln(w, "Compacting on exit...")
+					return nil
+				},
+			},
+			{
+				Name:        "encrypt",
+				Usage:       "create a key that encrypts database values at rest",
+				Description: "Writes a random key to " + database.SealKeyFile + " in the storage dir. From the next start values are sealed with AES-256-GCM as they're written, the config right away. Alternatively set " + database.SealPassphraseEnv + " (e.g. in the service env file) to derive the key from a passphrase instead. Without the key the database can't be read, keep a copy of it off-box, backups don't include it.",
+				Metadata:    map[string]any{noDB: true},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					w := cmd.Root().Writer
+					if os.Getenv(database.SealPassphraseEnv) != "" {
+						return errs.New(errs.Conflict, database.SealPassphraseEnv+" is set, values are sealed with the passphrase instead")
+					}
+					path, err := database.CreateSealKey(a.StorageDir)
+					if err != nil {
+						return err
+					}
+					fmt.Fprintf(w, "Key written to %s, values are encrypted from the next start.\n", path)
+					fmt.Fprintln(w, "Keep a copy of it somewhere safe, the database is unreadable without it.")
+					return nil
+				},
+			},
+			{
+				Name:        "stats",
+				Usage:       "show space use per bucket, map size, free pages and reader slots",
+				Description: "Reads the database alongside the running service. Free pages are reused by writes before the data file grows, `db compact` drops them. Writes fail once used space reaches the map size.",
+				Metadata:    map[string]any{noDB: true},
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "print as JSON",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					w := cmd.Root().Writer
+					if a.DB != nil {
+						return errs.New(errs.Conflict, "database is already open in this process")
+					}
+					s, err := database.ReadStats(a.DBDir())
+					if err != nil {
+						return errs.Wrap(errs.Unavailable, err, "failed to read database stats")
+					}
+					if cmd.Bool("json") {
+						out, err := json.MarshalIndent(s, "", "  ")
+						if err != nil {
+							return err
+						}
+						fmt.Fprintln(w, string(out))
+						return nil
+					}
+
+					pct := func(n, of int64) float64 { return 100 * float64(n) / float64(max(of, 1)) }
+					if s.MapSize > 0 {
+						fmt.Fprintf(w, "Map:      %s of %s used (%.1f%%), %s is %s\n", humanize.Bytes(s.Used()), humanize.Bytes(s.MapSize), pct(s.Used(), s.MapSize), kv.DataFile, humanize.Bytes(s.FileSize))
+					} else {
+						fmt.Fprintf(w, "Used:     %s, %s is %s\n", humanize.Bytes(s.Used()), kv.DataFile, humanize.Bytes(s.FileSize))
+					}
+					fmt.Fprintf(w, "Free:     %s in %d pages (%.0f%% of used)\n", humanize.Bytes(s.Free()), s.FreePages, pct(s.FreePages, s.UsedPages))
+					if s.MaxReaders > 0 {
+						fmt.Fprintf(w, "Readers:  %d of %d slots\n", s.Readers, s.MaxReaders)
+					}
+					fmt.Fprintf(w, "Page:     %d bytes\n\n", s.PageSize)
+
+					tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+					fmt.Fprintln(tw, "BUCKET\tENTRIES\tPAGES\tOVERFLOW\tDEPTH\tSIZE")
+					for _, d := range s.DBIs {
+						fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%s\n", d.Name, d.Entries, d.Pages(), d.OverflowPages, d.Depth, humanize.Bytes(int64(d.Pages())*int64(s.PageSize)))
+					}
+					tw.Flush()
+
+					// thresholds worth acting on before they turn into failures
+					var hints []string
+					if s.MapSize > 0 && pct(s.Used(), s.MapSize) > 80 {
+						hints = append(hints, "The map is over 80% used, writes fail with MDB_MAP_FULL once it's full. Prune data or run `db compact`.")
+					}
+					if s.FreePages*2 > s.UsedPages && s.Free() > 16<<20 {
+						hints = append(hints, "Over half the used space is free pages. Run `db compact` to reclaim it.")
+					}
+					if s.MaxReaders > 0 && s.Readers*5 > int(s.MaxReaders)*4 {
+						hints = append(hints, "The reader table is over 80% full, new read transactions fail once it is. `db repair` clears slots of crashed processes.")
+					}
+					if len(hints) > 0 {
+						fmt.Fprintf(w, "\n%s\n", strings.Join(hints, "\n"))
+					}
+					return nil
+				},
+			},
+			{
+				Name:        "get",
+				Usage:       "print the value of a key in any DBI",
+				Description: "A low-level escape hatch for debugging, e.g. migrations. Keys are given as text, or as hex with a 0x prefix (binary keys like httplog's). The value is printed as stored, decrypted if values are sealed.",
+				ArgsUsage:   "<dbi> <key>",
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					name, key, err := rawArgs(cmd, 2, false)
+					if err != nil {
+						return err
+					}
+					v, err := database.RawGet(a.DB, name, key)
+					if err != nil {
+						return err
+					}
+					fmt.Fprintln(cmd.Root().Writer, rawString(v))
+					return nil
+				},
+			},
+			{
+				Name:        "put",
+				Usage:       "store a value under a key in any DBI, bypassing validation",
+				Description: "A low-level escape hatch for debugging, e.g. migrations. Keys and values are given as text, or as hex with a 0x prefix. A value of - is read from stdin. The value is stored as is, nothing checks that the app can still read it.",
+				ArgsUsage:   "<dbi> <key> <value>",
+				Flags:       []cli.Flag{rawWriteFlag},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					name, key, err := rawArgs(cmd, 3, true)
+					if err != nil {
+						return err
+					}
+					var value []byte
+					if arg := cmd.Args().Get(2); arg == "-" {
+						if value, err = io.ReadAll(cmd.Root().Reader); err != nil {
+							return fmt.Errorf("failed to read value: %w", err)
+						}
+					} else if value, err = parseRaw(arg); err != nil {
+						return err
+					}
+					if err := database.RawPut(a.DB, name, key, value); err != nil {
+						return err
+					}
+					fmt.Fprintf(cmd.Root().Writer, "Stored %d bytes under %s in %s\n", len(value), rawString(key), name)
+					return nil
+				},
+			},
+			{
+				Name:        "del",
+				Usage:       "delete a key from any DBI, bypassing validation",
+				Description: "A low-level escape hatch for debugging, e.g. migrations. Keys are given as text, or as hex with a 0x prefix.",
+				ArgsUsage:   "<dbi> <key>",
+				Flags:       []cli.Flag{rawWriteFlag},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					name, key, err := rawArgs(cmd, 2, true)
+					if err != nil {
+						return err
+					}
+					if err := database.RawDelete(a.DB, name, key); err != nil {
+						return err
+					}
+					fmt.Fprintf(cmd.Root().Writer, "Deleted %s from %s\n", rawString(key), name)
+					return nil
+				},
+			},
+			{
+				Name:        "list",
+				Usage:       "list the keys and values of any DBI",
+				Description: "Prints one key and value per line, tab separated, in key order. Non-printable keys and values are shown as hex with a 0x prefix, values are decrypted if sealed.",
+				ArgsUsage:   "<dbi>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "prefix",
+						Usage: "only keys starting with this, 0x for hex",
+					},
+					&cli.IntFlag{
+						Name:  "limit",
+						Usage: "at most this many entries, 0 for all",
+						Value: 100,
+					},
+					&cli.BoolFlag{
+						Name:  "keys",
+						Usage: "print only the keys",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					w := cmd.Root().Writer
+					name := cmd.Args().First()
+					if name == "" {
+						return errs.New(errs.Invalid, fmt.Sprintf("missing DBI argument, one of %v", database.DBINameList()))
+					}
+					prefix, err := parseRaw(cmd.String("prefix"))
+					if err != nil {
+						return err
+					}
+					return database.RawList(a.DB, name, prefix, int(cmd.Int("limit")), func(k, v []byte) error {
+						if cmd.Bool("keys") {
+							_, err := fmt.Fprintln(w, rawString(k))
+							return err
+						}
+						_, err := fmt.Fprintf(w, "%s\t%s\n", rawString(k), rawString(v))
+						return err
+					})
+				},
+			},
+		},
+	}
+})
+
+// rawWriteFlag guards the raw write commands, which can leave data the app
+// can't read.
+var rawWriteFlag = &cli.BoolFlag{
+	Name:  "yes-i-know",
+	Usage: "confirm writing around validation and migrations",
+}
+
+// rawArgs checks the argument count of a raw command and parses its DBI name
+// and key, refusing writes without --yes-i-know.
+func rawArgs(cmd *cli.Command, n int, write bool) (string, []byte, error) {
+	if cmd.Args().Len() != n {
+		return "", nil, errs.New(errs.Invalid, fmt.Sprintf("expected %d arguments: %s", n, cmd.ArgsUsage))
+	}
+	if write && !cmd.Bool(rawWriteFlag.Name) {
+		return "", nil, errs.New(errs.Invalid, "raw writes bypass validation and can leave data the app can't read, pass --yes-i-know")
+	}
+	key, err := parseRaw(cmd.Args().Get(1))
+	if err != nil {
+		return "", nil, err
+	}
+	return cmd.Args().First(), key, nil
+}
+
+// parseRaw reads a key or value argument, hex with a 0x prefix, text otherwise.
+func parseRaw(s string) ([]byte, error) {
+	if h, ok := strings.CutPrefix(s, "0x"); ok {
+		b, err := hex.DecodeString(h)
+		if err != nil {
+			return nil, errs.Wrap(errs.Invalid, err, fmt.Sprintf("invalid hex %q", s))
+		}
+		return b, nil
+	}
+	return []byte(s), nil
+}
+
+// rawString is the inverse of parseRaw for output, printable text as is.
+func rawString(b []byte) string {
+	if len(b) > 0 && utf8.Valid(b) && !strings.ContainsFunc(string(b), func(r rune) bool { return !unicode.IsPrint(r) }) {
+		return string(b)
+	}
+	return "0x" + hex.EncodeToString(b)
+}
@@ -0,0 +1,12 @@
+//go:build unix
+
+package commands
+
+import "golang.org/x/sys/unix"
+
+// inheritedFD reports whether fd is an open file, pipe or socket. An anonymous
+// inode (e.g. the runtime's epoll fd) has no file type.
+func inheritedFD(fd int) bool {
+	var st unix.Stat_t
+	return unix.Fstat(fd, &st) == nil && st.Mode&unix.S_IFMT != 0
+}
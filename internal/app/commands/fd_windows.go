@@ -0,0 +1,10 @@
+package commands
+
+import "golang.org/x/sys/windows"
+
+// inheritedFD reports whether fd is the value of an inherited file, pipe or
+// socket handle.
+func inheritedFD(fd int) bool {
+	t, err := windows.GetFileType(windows.Handle(fd))
+	return err == nil && t != windows.FILE_TYPE_UNKNOWN
+}
@@ -0,0 +1,201 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"sprout/internal/app"
+	"sprout/internal/platform/database/config"
+	"sprout/internal/platform/httprecord"
+	"sprout/internal/platform/notify"
+	"sprout/internal/types"
+	"sprout/pkg/errs"
+	"sprout/pkg/humanize"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+var HTTP = register(func(a *app.App) *cli.Command {
+	if !a.BuildInfo().ServiceEnabled {
+		return nil
+	}
+
+	return &cli.Command{
+		Name:  "http",
+		Usage: "inspect and replay recorded HTTP requests",
+		Commands: []*cli.Command{
+			{
+				Name:        "record",
+				Usage:       "turn request recording on or off",
+				Description: "Recording stores sanitized requests/responses (credentials and secret-looking JSON fields removed) in a ring buffer. Applies on service restart.",
+				ArgsUsage:   "on|off",
+				Flags: []cli.Flag{
+					&cli.IntFlag{
+						Name:  "keep",
+						Usage: fmt.Sprintf("number of recordings to keep (0 = %d)", httprecord.DefaultKeep),
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					w := cmd.Root().Writer
+					state := cmd.Args().First()
+					if state != "on" && state != "off" {
+						return fmt.Errorf("expected on or off, got %q", state)
+					}
+					if err := config.UpdateFrom(a.DB, config.SourceCLI, func(cfg *types.Configuration) error {
+						cfg.HTTPRecord = state == "on"
+						if cmd.IsSet("keep") {
+							cfg.HTTPRecordKeep = int(cmd.Int("keep"))
+						}
+						return nil
+					}); err != nil {
+						return fmt.Errorf("failed to update config: %w", err)
+					}
+					a.Notify.Dispatch(notify.Event{
+						Kind:    notify.EventConfigChanged,
+						Title:   "Configuration changed",
+						Message: "changed via cli: httpRecord",
+						Fields:  map[string]string{"source": "cli", "fields": "httpRecord"},
+					})
+					fmt.Fprintf(w, "Request recording %s, restart the service to apply.\n", state)
+					return nil
+				},
+			},
+			{
+				Name:  "list",
+				Usage: "list recorded requests",
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					w := cmd.Root().Writer
+					recs, err := httprecord.List(a.DB)
+					if err != nil {
+						return fmt.Errorf("failed to list recordings: %w", err)
+					}
+					if len(recs) == 0 {
+						fmt.Fprintln(w, "No recordings. Enable with 'http record on'.")
+						return nil
+					}
+					for _, rec := range recs {
+						fmt.Fprintf(w, "%6d  %s  %3d  %-6s %s (%s)\n", rec.ID, rec.Time.Format(time.DateTime), rec.Status, rec.Method, rec.URI, humanize.Duration(rec.Duration))
+					}
+					return nil
+				},
+			},
+			{
+				Name:      "show",
+				Usage:     "print a recorded request and response",
+				ArgsUsage: "<id>",
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					w := cmd.Root().Writer
+					rec, err := getRecording(a, cmd.Args().First())
+					if err != nil {
+						return err
+					}
+					fmt.Fprintf(w, "%s %s\n", rec.Method, rec.URI)
+					printHeader(w, rec.ReqHeader)
+					fmt.Fprintf(w, "\n%s\n\n--- %d (%s)\n", rec.ReqBody, rec.Status, humanize.Duration(rec.Duration))
+					printHeader(w, rec.RespHeader)
+					fmt.Fprintf(w, "\n%s\n", rec.RespBody)
+					if rec.Truncated {
+						fmt.Fprintln(w, "(body truncated)")
+					}
+					return nil
+				},
+			},
+			{
+				Name:        "replay",
+				Usage:       "re-issue a recorded request against the running server",
+				Description: "Redacted values are sent as " + httprecord.Redacted + " and bodies that aren't JSON as " + httprecord.UnparsedBody + ", edit and resend manually if the request depends on them.",
+				ArgsUsage:   "<id>",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "url",
+						Usage: "server to send to, default http://127.0.0.1:<port>",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					rec, err := getRecording(a, cmd.Args().First())
+					if err != nil {
+						return err
+					}
+					base := cmd.String("url")
+					if base == "" {
+						cfg, err := config.View(a.DB)
+						if err != nil {
+							return fmt.Errorf("failed to get configuration from database: %w", err)
+						}
+						base = fmt.Sprintf("http://127.0.0.1:%d", cfg.Port) // --port included, see config.Layers
+					}
+					return replay(ctx, cmd.Root().Writer, rec, strings.TrimSuffix(base, "/"))
+				},
+			},
+			{
+				Name:  "clear",
+				Usage: "delete all recordings",
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					w := cmd.Root().Writer
+					if err := httprecord.Clear(a.DB); err != nil {
+						return fmt.Errorf("failed to clear recordings: %w", err)
+					}
+					fmt.Fprintln(w, "Recordings cleared.")
+					return nil
+				},
+			},
+		},
+	}
+})
+
+func getRecording(a *app.App, arg string) (*httprecord.Recording, error) {
+	id, err := strconv.ParseUint(arg, 10, 64)
+	if err != nil {
+		return nil, errs.New(errs.Invalid, fmt.Sprintf("invalid recording id %q", arg))
+	}
+	rec, err := httprecord.Get(a.DB, id)
+	if err != nil {
+		if errs.Is(err, errs.NotFound) {
+			return nil, errs.Wrap(errs.NotFound, err, fmt.Sprintf("recording %d not found, it may have been rotated out", id))
+		}
+		return nil, fmt.Errorf("failed to get recording: %w", err)
+	}
+	return rec, nil
+}
+
+func printHeader(w io.Writer, h http.Header) {
+	for _, k := range slices.Sorted(maps.Keys(h)) {
+		fmt.Fprintf(w, "%s: %s\n", k, strings.Join(h[k], ", "))
+	}
+}
+
+func replay(ctx context.Context, w io.Writer, rec *httprecord.Recording, base string) error {
+	req, err := http.NewRequestWithContext(ctx, rec.Method, base+rec.URI, strings.NewReader(rec.ReqBody))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header = rec.ReqHeader.Clone()
+	for _, h := range []string{"Host", "Content-Length", "Accept-Encoding"} {
+		req.Header.Del(h)
+	}
+	if strings.Contains(rec.ReqBody, httprecord.Redacted) || rec.ReqBody == httprecord.UnparsedBody {
+		fmt.Fprintln(w, "warning: request body contains redacted values")
+	}
+	if strings.Contains(rec.URI, url.QueryEscape(httprecord.Redacted)) {
+		fmt.Fprintln(w, "warning: request query contains redacted values")
+	}
+
+	start := time.Now()
+	resp, err := (&http.Client{Timeout: 30 * time.Second}).Do(req)
+	if err != nil {
+		return fmt.Errorf("replay failed: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, httprecord.MaxBodyBytes))
+
+	fmt.Fprintf(w, "%s %s -> %d (%s), recorded %d\n", rec.Method, rec.URI, resp.StatusCode, time.Since(start).Round(time.Millisecond), rec.Status)
+	fmt.Fprintln(w, string(body))
+	return nil
+}
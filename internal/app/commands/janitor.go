@@ -0,0 +1,64 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sprout/internal/app"
+	"sprout/internal/platform/database/config"
+	"sprout/internal/platform/janitor"
+	"sprout/pkg/humanize"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+var Janitor = register(func(a *app.App) *cli.Command {
+	return &cli.Command{
+		Name:        "janitor",
+		Usage:       "remove old logs and stale runtime files now",
+		Description: "Runs the same cleanup the service does on its janitor schedule, with the configured limits (see service set).",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "only print what would be removed",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			w := cmd.Root().Writer
+			cfg, err := config.View(a.DB)
+			if err != nil {
+				return fmt.Errorf("failed to get configuration from database: %w", err)
+			}
+			_, limits := janitor.FromConfig(cfg.Janitor)
+			dryRun := cmd.Bool("dry-run")
+
+			r, err := janitor.Run(janitorPaths(a), limits, time.Now(), dryRun, a.Log)
+			verb := "Removed"
+			if dryRun {
+				verb = "Would remove"
+			}
+			for _, path := range r.RemovedLogs {
+				fmt.Fprintf(w, "%s log %s\n", verb, filepath.Base(path))
+			}
+			if r.UpdateLogTrimmed > 0 {
+				fmt.Fprintf(w, "%s %s from update.log\n", verb, humanize.Bytes(r.UpdateLogTrimmed))
+			}
+			for _, pid := range r.StalePIDs {
+				fmt.Fprintf(w, "%s PID file of exited process %d\n", verb, pid)
+			}
+			if r.Empty() {
+				fmt.Fprintln(w, "Nothing to clean up.")
+			}
+			return err
+		},
+	}
+})
+
+func janitorPaths(a *app.App) janitor.Paths {
+	return janitor.Paths{
+		LogDir:       filepath.Join(a.StorageDir, "logs"),
+		UpdateLog:    filepath.Join(a.StorageDir, "update.log"),
+		InstancesDir: filepath.Join(a.RuntimeDir, app.InstancesDir),
+	}
+}
@@ -0,0 +1,231 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/format"
+	"os"
+	"slices"
+	"sprout/internal/app"
+	"sprout/internal/platform/database"
+	"sprout/pkg/errs"
+	"sprout/pkg/progress"
+	"sprout/pkg/x"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+var Migrate = register(func(a *app.App) *cli.Command {
+	return &cli.Command{
+		Name:        "migrate",
+		Usage:       "apply pending database migrations, or show them with --plan",
+		Description: "Migrations are applied whenever the database is opened, this runs them without doing anything else. --plan only reads the database and lists the steps the next open would apply, in order.",
+		Metadata:    map[string]any{noDB: true},
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "plan",
+				Usage: "print pending migrations without applying them",
+			},
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "print the plan, or what was applied, as JSON",
+			},
+		},
+		Commands: []*cli.Command{
+			{
+				Name:        "new",
+				Usage:       "add a stub migration step to the source, for development",
+				ArgsUsage:   "<description>",
+				Description: "Inserts a step with a timestamped ID after the last one in " + migrationFile + ", so steps stay in order without picking IDs by hand. Run it from the repository root, fill in the step, then rebuild.",
+				Metadata:    map[string]any{noDB: true},
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "file",
+						Value: migrationFile,
+						Usage: "migration source to add the step to",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					w := cmd.Root().Writer
+					desc := strings.TrimSpace(strings.Join(cmd.Args().Slice(), " "))
+					if desc == "" {
+						return errs.New(errs.Invalid, "missing description, e.g. `migrate new \"add sessions dbi\"`")
+					}
+					id := migrationID(time.Now(), desc)
+					if err := addMigrationStub(cmd.String("file"), id, desc); err != nil {
+						return err
+					}
+					fmt.Fprintf(w, "Added migration %s to %s.\n", id, cmd.String("file"))
+					return nil
+				},
+			},
+			{
+				Name:        "status",
+				Usage:       "compare the database schema with this version's migrations",
+				Description: fmt.Sprintf("Prints the schema version of the database, the latest migration this version knows and whether the database is %s, %s, %s or %s. Exits with %d if migrations are pending (including a database that was never initialized) and with an error if the database is ahead, e.g. to gate a deploy.", database.SchemaUpToDate, database.SchemaBehind, database.SchemaNotInitialized, database.SchemaAhead, MigrationPendingExit),
+				Metadata:    map[string]any{noDB: true},
+				Flags: []cli.Flag{
+					&cli.BoolFlag{
+						Name:  "json",
+						Usage: "print as JSON",
+					},
+				},
+				Action: func(ctx context.Context, cmd *cli.Command) error {
+					w := cmd.Root().Writer
+					if a.DB != nil {
+						return errs.New(errs.Conflict, "database is already open in this process")
+					}
+					seal, err := database.LoadSealing(a.StorageDir)
+					if err != nil {
+						return err
+					}
+					st, err := database.ReadSchemaStatus(a.DBDir(), seal)
+					if err != nil {
+						return errs.Wrap(errs.Unavailable, err, "failed to read database")
+					}
+
+					if cmd.Bool("json") {
+						out, err := json.MarshalIndent(st, "", "  ")
+						if err != nil {
+							return err
+						}
+						fmt.Fprintln(w, string(out))
+					} else {
+						fmt.Fprintf(w, "Schema:  %s\n", x.Ternary(st.Version == "", "none", st.Version))
+						fmt.Fprintf(w, "Latest:  %s\n", st.Latest)
+						fmt.Fprintf(w, "State:   %s\n", st.State)
+						if len(st.Pending) > 0 {
+							fmt.Fprintf(w, "Pending: %d, see `migrate --plan`\n", len(st.Pending))
+						}
+					}
+
+					switch st.State {
+					case database.SchemaAhead:
+						return errs.New(errs.Conflict, "database was migrated by a newer version, update this one")
+					case database.SchemaBehind, database.SchemaNotInitialized:
+						return errs.Status(MigrationPendingExit)
+					}
+					return nil
+				},
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			w := cmd.Root().Writer
+			if a.DB != nil {
+				return errs.New(errs.Conflict, "database is already open in this process")
+			}
+			seal, err := database.LoadSealing(a.StorageDir)
+			if err != nil {
+				return err
+			}
+			ver, steps, err := database.Plan(a.DBDir(), seal)
+			if err != nil {
+				return errs.Wrap(errs.Unavailable, err, "failed to read database")
+			}
+
+			if cmd.Bool("plan") {
+				if cmd.Bool("json") {
+					out, err := json.MarshalIndent(steps, "", "  ")
+					if err != nil {
+						return err
+					}
+					fmt.Fprintln(w, string(out))
+					return nil
+				}
+				fmt.Fprintf(w, "Schema version: %s\n", x.Ternary(ver == "", "none", ver))
+				if len(steps) == 0 {
+					fmt.Fprintln(w, "Up to date, nothing to migrate.")
+					return nil
+				}
+				fmt.Fprintf(w, "%d pending:\n", len(steps))
+				for _, step := range steps {
+					fmt.Fprintf(w, "  %-12s %-8s %s\n", x.Ternary(step.DBI == "", "core", step.DBI), step.ID, step.Desc)
+				}
+				return nil
+			}
+
+			if a.Dev {
+				return errs.New(errs.Unavailable, "dev mode works on a throwaway copy, run without --dev to migrate the real database")
+			}
+			if len(steps) == 0 {
+				fmt.Fprintln(w, "Up to date, nothing to migrate.")
+				return nil
+			}
+			onMigration := app.MigrationProgress(progress.New(w))
+			if cmd.Bool("json") {
+				onMigration = nil
+			}
+			db, res, err := database.OpenMigrating(a.DBDir(), a.Log, seal, onMigration)
+			if err != nil {
+				return fmt.Errorf("failed to migrate database: %w", err)
+			}
+			defer db.Close()
+			if cmd.Bool("json") {
+				out, err := json.MarshalIndent(res, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(w, string(out))
+				return nil
+			}
+			fmt.Fprintf(w, "Applied %d migrations, schema version is now %s.\n", len(res.Applied), res.To)
+			return nil
+		},
+	}
+})
+
+// MigrationPendingExit is the exit code of `migrate status` when the database
+// has migrations pending, like UpdateAvailableExit.
+const MigrationPendingExit = 100
+
+// migrationFile is where `migrate new` adds steps, relative to the repository root.
+const migrationFile = "internal/platform/database/migration.go"
+
+// migrationStubMarker is the line in migrationFile new steps go above.
+const migrationStubMarker = "// `migrate new` adds steps above this line"
+
+// migrationID returns a step ID that sorts after every earlier one,
+// e.g. "20261015_143000_add_sessions_dbi".
+func migrationID(now time.Time, desc string) string {
+	slug := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		}
+		return '_'
+	}, desc)
+	slug = strings.Join(strings.FieldsFunc(slug, func(r rune) bool { return r == '_' }), "_")
+	return now.UTC().Format("20060102_150405") + x.Ternary(slug == "", "", "_"+slug)
+}
+
+// addMigrationStub inserts a step with id and desc above the marker in path.
+func addMigrationStub(path, id, desc string) error {
+	src, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return errs.New(errs.NotFound, fmt.Sprintf("%s not found, run from the repository root or pass --file", path))
+	} else if err != nil {
+		return err
+	}
+	i := bytes.Index(src, []byte(migrationStubMarker))
+	if i < 0 || bytes.Count(src, []byte(migrationStubMarker)) != 1 {
+		return errs.New(errs.Invalid, fmt.Sprintf("%s needs exactly one %q line", path, migrationStubMarker))
+	}
+	if bytes.Contains(src, []byte(strconv.Quote(id))) {
+		return errs.New(errs.Conflict, fmt.Sprintf("a migration %q already exists", id))
+	}
+	i = bytes.LastIndexByte(src[:i], '\n') + 1 // start of the marker line
+
+	stub := fmt.Sprintf("\tm.Add(%q, %q, func(txn kv.Txn) error {\n\t\t// TODO: migrate\n\t\treturn nil\n\t})\n\n", id, desc)
+	out, err := format.Source(slices.Concat(src[:i], []byte(stub), src[i:]))
+	if err != nil {
+		return fmt.Errorf("failed to format %s with the new step: %w", path, err)
+	}
+	return os.WriteFile(path, out, 0644)
+}
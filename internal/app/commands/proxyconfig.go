@@ -0,0 +1,118 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sprout/internal/app"
+	"sprout/internal/platform/database/config"
+	"sprout/pkg/x"
+	"text/template"
+
+	"github.com/urfave/cli/v3"
+)
+
+// proxyData is what the reverse proxy templates get rendered with.
+type proxyData struct {
+	Name       string
+	ServerName string // public hostname
+	ListenPort int    // port the proxy listens on
+	Upstream   string // host:port of the service
+	TLS        bool
+}
+
+var proxyTemplates = map[string]string{
+	"nginx": `# {{ .Name }} - nginx reverse proxy
+server {
+    listen {{ .ListenPort }}{{ if .TLS }} ssl{{ end }};
+    server_name {{ .ServerName }};
+{{ if .TLS }}
+    ssl_certificate     /etc/letsencrypt/live/{{ .ServerName }}/fullchain.pem;
+    ssl_certificate_key /etc/letsencrypt/live/{{ .ServerName }}/privkey.pem;
+{{ end }}
+    location / {
+        proxy_pass http://{{ .Upstream }};
+        proxy_http_version 1.1;
+        proxy_set_header Host $host;
+        proxy_set_header X-Real-IP $remote_addr;
+        proxy_set_header X-Forwarded-For $proxy_add_x_forwarded_for;
+        proxy_set_header X-Forwarded-Proto $scheme;
+        proxy_set_header Upgrade $http_upgrade;
+        proxy_set_header Connection "upgrade";
+    }
+}
+`,
+	"caddy": `# {{ .Name }} - Caddyfile
+{{ if .TLS }}{{ .ServerName }}{{ else }}http://{{ .ServerName }}:{{ .ListenPort }}{{ end }} {
+    # caddy sets X-Forwarded-For/Proto/Host itself
+    reverse_proxy {{ .Upstream }}
+}
+`,
+	"traefik": `# {{ .Name }} - traefik dynamic configuration (file provider)
+http:
+  routers:
+    {{ .Name }}:
+      rule: "Host(` + "`{{ .ServerName }}`" + `)"
+      entryPoints:
+        - {{ if .TLS }}websecure{{ else }}web{{ end }}
+      service: {{ .Name }}{{ if .TLS }}
+      tls:
+        certResolver: letsencrypt{{ end }}
+  services:
+    {{ .Name }}:
+      loadBalancer:
+        servers:
+          - url: "http://{{ .Upstream }}"
+# entry point "{{ if .TLS }}websecure{{ else }}web{{ end }}" should listen on :{{ .ListenPort }}.
+# traefik sets X-Forwarded-Proto itself.
+`,
+}
+
+var ProxyConfig = register(func(a *app.App) *cli.Command {
+	if !a.BuildInfo().ServiceEnabled {
+		return nil
+	}
+
+	// one subcommand per proxy, all doing the same thing
+	var subCommands []*cli.Command
+	for _, name := range []string{"nginx", "caddy", "traefik"} {
+		subCommands = append(subCommands, &cli.Command{
+			Name:  name,
+			Usage: fmt.Sprintf("print a %s config snippet", name),
+			Action: func(ctx context.Context, cmd *cli.Command) error {
+				return printProxyConfig(a, name)
+			},
+		})
+	}
+
+	return &cli.Command{
+		Name:        "proxy-config",
+		Usage:       "print a reverse proxy config snippet for the current settings",
+		Description: "Uses host, port, and proxyPort from the config. A proxyPort of 443 produces a TLS setup, set it with 'service set --proxy 443'.",
+		Commands:    subCommands,
+	}
+})
+
+func printProxyConfig(a *app.App, proxy string) error {
+	cfg, err := config.View(a.DB)
+	if err != nil {
+		return fmt.Errorf("failed to get configuration from database: %w", err)
+	}
+
+	data := proxyData{
+		Name:       a.BuildInfo().Name,
+		ServerName: x.Ternary(cfg.Host == "" || cfg.Host == "localhost" || cfg.Host == "0.0.0.0", "example.com", cfg.Host),
+		ListenPort: x.Ternary(cfg.ProxyPort != 0, cfg.ProxyPort, 80),
+		Upstream:   fmt.Sprintf("127.0.0.1:%d", cfg.Port),
+		TLS:        cfg.ProxyPort == 443,
+	}
+	if data.ServerName == "example.com" {
+		fmt.Fprintln(os.Stderr, "note: host is not a public hostname, using example.com. Set it with 'service set --host <domain>'.")
+	}
+
+	tmpl, err := template.New(proxy).Parse(proxyTemplates[proxy])
+	if err != nil {
+		return fmt.Errorf("failed to parse %s template: %w", proxy, err)
+	}
+	return tmpl.Execute(os.Stdout, data)
+}
@@ -0,0 +1,70 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sprout/internal/app"
+	"sprout/internal/platform/release"
+	"sprout/pkg/errs"
+	"sprout/pkg/progress"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+var Rollback = register(func(a *app.App) *cli.Command {
+	return &cli.Command{
+		Name:        "rollback",
+		Usage:       "reinstall the previously installed version",
+		Description: "Reinstalls the version that was installed before the running one, using the binary the installer kept if it's still there, otherwise downloading that version. Running it again returns to the version you rolled back from. If the database was migrated past what the previous version supports, the install rolls back and nothing changes.",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "yes",
+				Usage: "don't ask for confirmation",
+			},
+			&cli.BoolFlag{
+				Name:  "insecure-skip-verify",
+				Usage: "don't check release signatures, e.g. to install an unsigned dev release (checksums are still checked)",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			w := cmd.Root().Writer
+			a.InsecureSkipVerify = cmd.Bool("insecure-skip-verify")
+			if a.UpdatesDisabled() {
+				return app.ErrDevBuild
+			}
+			bi := a.BuildInfo()
+			t, err := a.RollbackTarget()
+			if err != nil {
+				return err
+			}
+
+			if t.Binary != "" {
+				fmt.Fprintf(w, "Rolling back from %s to %s (kept binary %s).\n", bi.Version, t.Version, t.Binary)
+			} else {
+				fmt.Fprintf(w, "Rolling back from %s to %s (kept binary missing, downloading it).\n", bi.Version, t.Version)
+				fCtx, fCancel := context.WithTimeout(ctx, 30*time.Second)
+				defer fCancel()
+				step := progress.New(w).Step("Checking " + t.Version + " was published")
+				if err := step.End(release.FindVersion(fCtx, a.ReleaseSource, bi.ReleaseURL, t.Version)); errors.Is(err, release.ErrUnknownVersion) {
+					return errs.Wrap(errs.NotFound, err, fmt.Sprintf("%s can't be downloaded, it was released before versions were kept", t.Version))
+				} else if err != nil {
+					return errs.Wrap(errs.Unavailable, err, "failed to reach release source")
+				}
+			}
+
+			yes := cmd.Bool("yes")
+			if !yes {
+				if yes, err = confirm(cmd, "Continue?"); err != nil {
+					return fmt.Errorf("prompt failed: %w", err)
+				}
+			}
+			if !yes {
+				fmt.Fprintln(w, "Rollback cancelled.")
+				return nil
+			}
+			return a.DeferRollback(t)
+		},
+	}
+})
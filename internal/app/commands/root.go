@@ -0,0 +1,102 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sprout/internal/app"
+	"sprout/internal/platform/database/config"
+
+	"github.com/urfave/cli/v3"
+)
+
+// noDB is set in a command's Metadata if it must run without the database
+// open, Init then stops before opening it.
+const noDB = "noDB"
+
+// wantsDB walks the args down the command tree to the command about to run.
+// Root's Before runs before any subcommand is resolved, so it has to look ahead.
+func wantsDB(root *cli.Command) bool {
+	c := root
+	for _, arg := range root.Args().Slice() {
+		sub := c.Command(arg)
+		if sub == nil {
+			break
+		}
+		c = sub
+	}
+	return c.Metadata[noDB] != true
+}
+
+// Root builds the root command with every registered subcommand.
+// Used by main and by tests that run the command tree in-process.
+func Root(a *app.App) *cli.Command {
+	var subCommands []*cli.Command
+	for _, regFunc := range Registry {
+		// commands may opt out (e.g. service when disabled) by returning nil
+		if cmd := regFunc(a); cmd != nil {
+			subCommands = append(subCommands, cmd)
+		}
+	}
+
+	return &cli.Command{
+		Name:    a.BuildInfo().Name,
+		Version: a.BuildInfo().Version,
+		Usage:   "Sprout is a template for building Go services / cli apps.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:    "log",
+				Aliases: []string{"l"},
+				Value:   a.BuildInfo().DefaultLogLevel,
+				Usage:   "override log level (debug|info|warn|error|none)",
+			},
+			&cli.BoolFlag{
+				Name:    "version",
+				Aliases: []string{"v"},
+				Usage:   "print version and exit",
+			},
+			&cli.IntFlag{
+				Name:    "port",
+				Aliases: []string{"p"},
+				Usage:   "set the port for this run, over the config file and environment (see `config sources`)",
+			},
+			&cli.StringFlag{
+				Name:    "profile",
+				Usage:   "use this config profile instead of the one `config profile use` picked (\"" + config.DefaultProfile + "\" for none)",
+				Sources: cli.EnvVars(config.ProfileEnv),
+			},
+			&cli.BoolFlag{
+				Name:  "dev",
+				Usage: "development mode: live templates/assets, debug logs, throwaway database copy, no updates",
+			},
+			&cli.BoolFlag{
+				Name:    "migrate",
+				Aliases: []string{"m"},
+				Hidden:  true,
+				Usage:   "skip migration guard (for the migrator)",
+			},
+			&cli.BoolFlag{
+				Name:   "build-vars",
+				Hidden: true,
+				Usage:  "print build variables and exit",
+			},
+		},
+		Before: func(ctx context.Context, cmd *cli.Command) (context.Context, error) {
+			w := cmd.Root().Writer
+			if cmd.Bool("build-vars") {
+				fmt.Fprintln(w, a.BuildInfo().PrintJSON())
+				os.Exit(0)
+			}
+			a.SkipDB = !wantsDB(cmd)
+			return a.Init(ctx, cmd)
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			w := cmd.Root().Writer
+			a.Log.Info("Ran with no arguments.")
+			fmt.Fprintf(w, "%s version %s\n", a.BuildInfo().Name, a.BuildInfo().Version)
+			fmt.Fprintf(w, "Use '%s help' to see available commands.\n", a.BuildInfo().Name)
+			return nil
+		},
+		Commands: subCommands,
+	}
+}
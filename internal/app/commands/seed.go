@@ -0,0 +1,85 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"sprout/internal/app"
+	"sprout/internal/platform/database"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+var Seed = register(func(a *app.App) *cli.Command {
+	return &cli.Command{
+		Name:        "seed",
+		Usage:       "populate the database with development / demo fixtures",
+		Description: "Fixtures are defined in internal/platform/database/seed.go (or registered by feature packages). Without --fixture, all of them meant for this kind of build are applied: dev builds and --dev take dev fixtures, release builds only the ones marked for production. Each fixture is applied once per database, later runs skip it unless --again.",
+		Flags: []cli.Flag{
+			&cli.StringSliceFlag{
+				Name:  "fixture",
+				Usage: "fixture to apply, repeatable",
+			},
+			&cli.BoolFlag{
+				Name:  "list",
+				Usage: "list available fixtures and exit",
+			},
+			&cli.BoolFlag{
+				Name:  "again",
+				Usage: "reapply fixtures that were already applied",
+			},
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "allow dev fixtures in a release build's database",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			w := cmd.Root().Writer
+			// demo data has no business in a real install unless asked for explicitly
+			env := database.SeedProduction
+			if a.BuildInfo().Version == "vX.X.X" || a.Dev || cmd.Bool("force") {
+				env = database.SeedDev
+			}
+
+			if cmd.Bool("list") {
+				seeds, err := database.AppliedFixtures(a.DB)
+				if err != nil {
+					return err
+				}
+				for _, f := range database.Fixtures() {
+					state := "not for " + string(env)
+					if t, ok := seeds[f.Name]; ok {
+						state = "applied " + t.Local().Format(time.DateTime)
+					} else if f.Allowed(env) {
+						state = "pending"
+					}
+					fmt.Fprintf(w, "%-16s %-28s %s\n", f.Name, state, f.Desc)
+				}
+				return nil
+			}
+
+			if a.Dev {
+				fmt.Fprintln(w, "note: dev mode works on a throwaway database copy, seeded data is gone on exit.")
+			}
+			res, err := database.Seed(a.DB, a.Log, database.SeedOptions{
+				Env:   env,
+				Names: cmd.StringSlice("fixture"),
+				Again: cmd.Bool("again"),
+			})
+			if err != nil {
+				return err
+			}
+			if len(res.Applied) > 0 {
+				fmt.Fprintf(w, "Applied fixtures: %s\n", strings.Join(res.Applied, ", "))
+			}
+			if len(res.Skipped) > 0 {
+				fmt.Fprintf(w, "Already applied: %s (use --again to reapply)\n", strings.Join(res.Skipped, ", "))
+			}
+			if len(res.Applied)+len(res.Skipped) == 0 {
+				fmt.Fprintf(w, "No fixtures for %s databases.\n", env)
+			}
+			return nil
+		},
+	}
+})
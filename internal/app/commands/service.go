@@ -2,12 +2,31 @@ package commands
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
 	"sprout/internal/app"
+	"sprout/internal/platform/backup"
 	"sprout/internal/platform/database/config"
 	"sprout/internal/platform/http/router"
+	"sprout/internal/platform/http/router/settings"
 	"sprout/internal/platform/http/server"
+	"sprout/internal/platform/janitor"
+	"sprout/internal/platform/notify"
+	"sprout/internal/platform/remoteconfig"
+	"sprout/internal/platform/scheduler"
+	"sprout/internal/platform/selftest"
+	"sprout/internal/platform/storage"
 	"sprout/internal/types"
+	"sprout/pkg/errs"
+	"sprout/pkg/humanize"
+	"sprout/pkg/sdnotify"
+	"sprout/pkg/x"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/Data-Corruption/stdx/xnet"
@@ -15,7 +34,8 @@ import (
 )
 
 const (
-	botShutdownTimeout = 10 * time.Second
+	botShutdownTimeout    = 10 * time.Second
+	netWaitDefaultTimeout = 30 * time.Second
 )
 
 var Service = register(func(a *app.App) *cli.Command {
@@ -26,6 +46,7 @@ var Service = register(func(a *app.App) *cli.Command {
 		Name:  "service",
 		Usage: "service management commands",
 		Action: func(ctx context.Context, cmd *cli.Command) error {
+			w := cmd.Root().Writer
 			// get service name / env file path
 			if a.BuildInfo().Name == "" || a.StorageDir == "" {
 				return fmt.Errorf("app name or storage path not found")
@@ -34,18 +55,18 @@ var Service = register(func(a *app.App) *cli.Command {
 			envFilePath := fmt.Sprintf("%s/%s.env", a.StorageDir, a.BuildInfo().Name)
 
 			// print service management commands
-			fmt.Printf("🖧 Service Cheat Sheet\n\n")
-			fmt.Printf("    Status:  systemctl --user status %s\n", serviceName)
-			fmt.Printf("    Enable:  systemctl --user enable %s\n", serviceName)
-			fmt.Printf("    Disable: systemctl --user disable %s\n\n", serviceName)
-			fmt.Printf("    Start:   systemctl --user start %s\n", serviceName)
-			fmt.Printf("    Stop:    systemctl --user stop %s\n", serviceName)
-			fmt.Printf("    Restart: systemctl --user restart %s\n\n", serviceName)
-			fmt.Printf("    Reset:   systemctl --user reset-failed %s\n\n", serviceName)
-			fmt.Printf("    Env:     edit %s then restart the service\n\n", envFilePath)
-			fmt.Printf("    Logs:        journalctl --user -u %s -n 200 --no-pager\n", serviceName)
-			fmt.Printf("    Stop Logs:   journalctl --user -u %s-stop* -n 200 --no-pager\n", serviceName)
-			fmt.Printf("    Update Logs: journalctl --user -u %s-update* -n 200 -f\n", a.BuildInfo().Name)
+			fmt.Fprintf(w, "🖧 Service Cheat Sheet\n\n")
+			fmt.Fprintf(w, "    Status:  systemctl --user status %s\n", serviceName)
+			fmt.Fprintf(w, "    Enable:  systemctl --user enable %s\n", serviceName)
+			fmt.Fprintf(w, "    Disable: systemctl --user disable %s\n\n", serviceName)
+			fmt.Fprintf(w, "    Start:   systemctl --user start %s\n", serviceName)
+			fmt.Fprintf(w, "    Stop:    systemctl --user stop %s\n", serviceName)
+			fmt.Fprintf(w, "    Restart: systemctl --user restart %s\n\n", serviceName)
+			fmt.Fprintf(w, "    Reset:   systemctl --user reset-failed %s\n\n", serviceName)
+			fmt.Fprintf(w, "    Env:     edit %s then restart the service\n\n", envFilePath)
+			fmt.Fprintf(w, "    Logs:        journalctl --user -u %s -n 200 --no-pager\n", serviceName)
+			fmt.Fprintf(w, "    Stop Logs:   journalctl --user -u %s-stop* -n 200 --no-pager\n", serviceName)
+			fmt.Fprintf(w, "    Update Logs: journalctl --user -u %s-update* -n 200 -f\n", a.BuildInfo().Name)
 
 			return nil
 		},
@@ -60,7 +81,11 @@ var Service = register(func(a *app.App) *cli.Command {
 					},
 					&cli.IntFlag{
 						Name:  "port",
-						Usage: "set server port",
+						Usage: "set server port, checked to be free and bindable by this user",
+					},
+					&cli.BoolFlag{
+						Name:  "force",
+						Usage: "save a --port the check finds in use",
 					},
 					&cli.StringFlag{
 						Name:  "host",
@@ -70,36 +95,141 @@ var Service = register(func(a *app.App) *cli.Command {
 						Name:  "proxy",
 						Usage: "set proxy port (0 = no proxy)",
 					},
+					&cli.StringFlag{
+						Name:  "backup-schedule",
+						Usage: "cron schedule for automatic backups, e.g. \"0 3 * * *\" or @daily (empty = off)",
+					},
+					&cli.StringFlag{
+						Name:  "backup-dir",
+						Usage: "backup archive directory (empty = <storage>/backups)",
+					},
+					&cli.StringFlag{
+						Name:  "backup-encrypt",
+						Usage: "encrypt backups: key (generated " + backup.KeyFile + " in storage), passphrase (" + backup.PassphraseEnv + " in the service env file), or none",
+					},
+					&cli.IntFlag{
+						Name:  "backup-keep-last",
+						Usage: "keep the newest N backups",
+					},
+					&cli.IntFlag{
+						Name:  "backup-keep-daily",
+						Usage: "keep one backup per day for the last N days",
+					},
+					&cli.IntFlag{
+						Name:  "backup-keep-weekly",
+						Usage: "keep one backup per week for the last N weeks",
+					},
+					&cli.StringFlag{
+						Name:  "janitor-schedule",
+						Usage: "cron schedule for log / runtime file cleanup (empty = " + janitor.DefaultSchedule + ", off = disabled)",
+					},
+					&cli.IntFlag{
+						Name:  "log-max-age-days",
+						Usage: fmt.Sprintf("remove rotated logs older than N days (0 = %d, -1 = keep)", janitor.DefaultLogMaxAgeDays),
+					},
+					&cli.IntFlag{
+						Name:  "log-max-files",
+						Usage: fmt.Sprintf("keep at most N rotated logs (0 = %d, -1 = no limit)", janitor.DefaultLogMaxFiles),
+					},
+					&cli.IntFlag{
+						Name:  "update-log-max-kib",
+						Usage: fmt.Sprintf("trim update.log to its last N KiB (0 = %d, -1 = never)", janitor.DefaultUpdateLogMaxKiB),
+					},
 				},
 				Action: func(ctx context.Context, cmd *cli.Command) error {
-					updated := false
+					w := cmd.Root().Writer
+					var changed []string
+					var warning string
 
-					if err := config.Update(a.DB, func(cfg *types.Configuration) error {
+					if err := config.UpdateFrom(a.DB, config.SourceCLI, func(cfg *types.Configuration) error {
+						port := cfg.Port
 						if cmd.IsSet("log") {
 							cfg.LogLevel = cmd.String("log")
-							updated = true
+							changed = append(changed, "logLevel")
 						}
 						if cmd.IsSet("port") {
 							cfg.Port = int(cmd.Int("port"))
-							updated = true
+							changed = append(changed, "port")
 						}
 						if cmd.IsSet("host") {
 							cfg.Host = cmd.String("host")
-							updated = true
+							changed = append(changed, "host")
 						}
 						if cmd.IsSet("proxy") {
 							cfg.ProxyPort = int(cmd.Int("proxy"))
-							updated = true
+							changed = append(changed, "proxyPort")
+						}
+						if cmd.IsSet("backup-schedule") {
+							cfg.Backup.Schedule = cmd.String("backup-schedule")
+							changed = append(changed, "backup.schedule")
+						}
+						if cmd.IsSet("backup-encrypt") {
+							cfg.Backup.Encrypt = x.Ternary(cmd.String("backup-encrypt") == "none", backup.EncryptNone, cmd.String("backup-encrypt"))
+							changed = append(changed, "backup.encrypt")
+						}
+						if cmd.IsSet("backup-dir") {
+							cfg.Backup.Dir = cmd.String("backup-dir")
+							changed = append(changed, "backup.dir")
+						}
+						for _, k := range []struct {
+							flag, field string
+							dst         *int
+						}{
+							{"backup-keep-last", "backup.keepLast", &cfg.Backup.KeepLast},
+							{"backup-keep-daily", "backup.keepDaily", &cfg.Backup.KeepDaily},
+							{"backup-keep-weekly", "backup.keepWeekly", &cfg.Backup.KeepWeekly},
+						} {
+							if cmd.IsSet(k.flag) {
+								*k.dst = int(cmd.Int(k.flag))
+								changed = append(changed, k.field)
+							}
+						}
+						if cmd.IsSet("janitor-schedule") {
+							cfg.Janitor.Schedule = cmd.String("janitor-schedule")
+							changed = append(changed, "janitor.schedule")
+						}
+						for _, k := range []struct {
+							flag, field string
+							dst         *int
+						}{
+							{"log-max-age-days", "janitor.logMaxAgeDays", &cfg.Janitor.LogMaxAgeDays},
+							{"log-max-files", "janitor.logMaxFiles", &cfg.Janitor.LogMaxFiles},
+							{"update-log-max-kib", "janitor.updateLogMaxKiB", &cfg.Janitor.UpdateLogMaxKiB},
+						} {
+							if cmd.IsSet(k.flag) {
+								*k.dst = int(cmd.Int(k.flag))
+								changed = append(changed, k.field)
+							}
+						}
+						if fe := cfg.Validate().For(changed...); fe != nil {
+							return errs.Wrap(errs.Invalid, fe, "invalid setting")
+						}
+						if cfg.Port != port {
+							var err error
+							warning, err = checkPort(cfg.Port, cmd.Bool("force"))
+							return err
 						}
 						return nil
 					}); err != nil {
+						if errs.Is(err, errs.Invalid) || errs.Is(err, errs.Conflict) {
+							return err
+						}
 						return fmt.Errorf("failed to update config: %w", err)
 					}
 
-					if updated {
-						fmt.Println("Configuration updated successfully.")
+					if len(changed) > 0 {
+						a.Notify.Dispatch(notify.Event{
+							Kind:    notify.EventConfigChanged,
+							Title:   "Configuration changed",
+							Message: "changed via cli: " + strings.Join(changed, ", "),
+							Fields:  map[string]string{"source": "cli", "fields": strings.Join(changed, ",")},
+						})
+						fmt.Fprintln(w, "Configuration updated successfully.")
+						if warning != "" {
+							fmt.Fprintf(w, "warning: %s\n", warning)
+						}
 					} else {
-						fmt.Println("No configuration values were changed. Use --help to see available options.")
+						fmt.Fprintln(w, "No configuration values were changed. Use --help to see available options.")
 					}
 
 					return nil
@@ -113,36 +243,117 @@ var Service = register(func(a *app.App) *cli.Command {
 						Name:  "rc",
 						Usage: "register commands on startup",
 					},
+					&cli.BoolFlag{
+						Name:  "skip-net-wait",
+						Usage: "don't wait for the network before starting (overrides config)",
+					},
+					&cli.BoolFlag{
+						Name:  "skip-self-test",
+						Usage: "don't run the startup self-test (database, templates, port, runtime dir)",
+					},
+					&cli.StringFlag{
+						Name:  "ready-notify",
+						Usage: "write a JSON line {pid, port, addr, baseURL, version} when ready (stdout|stderr)",
+					},
+					&cli.IntFlag{
+						Name:  "ready-fd",
+						Usage: "like --ready-notify but to an inherited file descriptor, closed after writing",
+					},
 				},
 				Action: func(ctx context.Context, cmd *cli.Command) error {
-					// wait for network (systemd user mode Wants/After is unreliable)
-					if err := xnet.Wait(ctx, 0); err != nil {
-						return fmt.Errorf("failed to wait for network: %w", err)
-					}
-
+					w := cmd.Root().Writer
 					// get config
 					cfg, err := config.View(a.DB)
 					if err != nil {
 						return fmt.Errorf("failed to get configuration from database: %w", err)
 					}
 
-					// get port, handle override
-					port := cmd.Int("port")
-					if port == 0 {
-						port = cfg.Port
+					ready, err := readyWriter(cmd.String("ready-notify"), cmd.Int("ready-fd"))
+					if err != nil {
+						return err
+					}
+
+					// wait for network (systemd user mode Wants/After is unreliable)
+					if cmd.Bool("skip-net-wait") || cfg.NetWaitSkip {
+						a.Log.Info("Skipping network wait")
+					} else if err := waitForNetwork(ctx, a, cfg); err != nil {
+						return fmt.Errorf("failed to wait for network: %w", err)
+					}
+
+					// fail now rather than mid-request
+					if !cmd.Bool("skip-self-test") {
+						took, err := selftest.Run(selfTests(a, cfg, cfg.Port))
+						if err != nil {
+							return err
+						}
+						a.Log.Debugf("Self-test passed in %v", took.Round(time.Millisecond))
 					}
 
 					// create server
 					mux := router.New(a)
-					if err := server.New(a, port, mux); err != nil {
+					srv, err := server.New(a, mux, ready)
+					if err != nil {
 						return fmt.Errorf("failed to create server: %w", err)
 					}
 
+					// watch disk space while serving
+					a.Storage = storage.NewMonitor(a.StorageDir, cfg.DiskFreeWarnMiB, a.Log, a.Notify)
+					a.Storage.Start()
+					a.AddCleanup(a.Storage.Stop)
+
+					// background jobs
+					sched := scheduler.New(a.Log)
+					if err := addBackupJob(a, sched, cfg); err != nil {
+						return err
+					}
+					if err := addUpdateWindowJob(a, sched, cfg); err != nil {
+						return err
+					}
+					if cfg.AutoUpdate && cfg.UpdateWindow == "" && !a.UpdatesDisabled() {
+						if err := sched.Add("auto-update", autoUpdateSpec, func(ctx context.Context) error {
+							_, err := a.AutoUpdate()
+							return err
+						}); err != nil {
+							return fmt.Errorf("invalid auto-update schedule: %w", err)
+						}
+					}
+					if !a.UpdatesDisabled() {
+						if err := sched.Add("update-retry", updateRetrySpec, func(ctx context.Context) error {
+							_, err := a.RetryUpdate(ctx)
+							return err
+						}); err != nil {
+							return fmt.Errorf("invalid update retry schedule: %w", err)
+						}
+					}
+					if spec, limits := janitor.FromConfig(cfg.Janitor); spec != "" {
+						if err := sched.Add("janitor", spec, func(ctx context.Context) error {
+							_, err := janitor.Run(janitorPaths(a), limits, time.Now(), false, a.Log)
+							return err
+						}); err != nil {
+							return fmt.Errorf("invalid janitor schedule: %w", err)
+						}
+					}
+					if err := addRemoteConfigJob(a, sched, cfg); err != nil {
+						return err
+					}
+					if cfg.TLS.DNSProvider != "" {
+						if err := sched.Add("cert-renew", certRenewSpec, func(ctx context.Context) error {
+							return renewCert(ctx, a, srv)
+						}); err != nil {
+							return fmt.Errorf("invalid certificate renewal schedule: %w", err)
+						}
+					}
+					sched.Start()
+					a.AddCleanup(sched.Stop)
+
+					// apply changes made elsewhere on SIGHUP (`systemctl --user reload`), see app.OnReload
+					a.ReloadOnSignal(ctx)
+
 					// start http server
-					if err := a.Server.Listen(); err != nil { // blocks until server stops or shutdown signal received
+					if err := srv.Listen(); err != nil { // blocks until server stops or shutdown signal received
 						return fmt.Errorf("server stopped with error: %w", err)
 					} else {
-						fmt.Println("server stopped gracefully")
+						fmt.Fprintln(w, "server stopped gracefully")
 					}
 
 					return nil
@@ -151,3 +362,255 @@ var Service = register(func(a *app.App) *cli.Command {
 		},
 	}
 })
+
+// selfTests are the startup checks run before the server starts.
+func selfTests(a *app.App, cfg *types.Configuration, port int) []selftest.Check {
+	name := a.BuildInfo().Name
+	return []selftest.Check{
+		{
+			Name: "database",
+			Run:  func() error { return selftest.DB(a.DB) },
+			Hint: fmt.Sprintf("check permissions and free space of %s, if a crash left it locked run '%s db repair'", a.DBDir(), name),
+		},
+		{
+			Name: "templates",
+			Run: func() error {
+				return selftest.Render(func(w io.Writer) error {
+					return a.UI.Execute(w, settings.PageTemplate, settings.PageData(a, cfg))
+				})
+			},
+			Hint: "the UI templates don't render, reinstall (or fix them, in dev mode)",
+		},
+		{
+			Name: "port",
+			Run:  func() error { return selftest.Port(port) },
+			Hint: fmt.Sprintf("stop whatever holds it (another instance?) or pick another with '%s service set --port'", name),
+		},
+		{
+			Name: "runtime dir",
+			Run:  func() error { return selftest.Writable(a.RuntimeDir) },
+			Hint: fmt.Sprintf("%s must be writable by this user, check XDG_RUNTIME_DIR", a.RuntimeDir),
+		},
+	}
+}
+
+// checkPort tests a new port the way the startup self-test will before it's
+// saved, rather than letting the next restart fail on it. One in use is
+// refused unless force, one that needs privileges this user lacks only gets
+// a warning: the service may be granted them (e.g. AmbientCapabilities).
+func checkPort(port int, force bool) (warning string, err error) {
+	switch err := selftest.Port(port); {
+	case err == nil:
+		return "", nil
+	case errors.Is(err, selftest.ErrPortPrivileged) || force:
+		return err.Error(), nil
+	case errors.Is(err, selftest.ErrPortInUse):
+		return "", errs.Wrap(errs.Conflict, err, "can't use the new port (--force saves it anyway)")
+	default:
+		return "", errs.Wrap(errs.Invalid, err, "can't use the new port (--force saves it anyway)")
+	}
+}
+
+// addBackupJob schedules automatic backups when a schedule is configured. Skipped in dev mode.
+func addBackupJob(a *app.App, sched *scheduler.Scheduler, cfg *types.Configuration) error {
+	bc := cfg.Backup
+	if bc.Schedule == "" || a.Dev {
+		return nil
+	}
+	opts, err := a.BackupOptions(bc, "schedule")
+	if err != nil {
+		return err
+	}
+	if err := sched.Add("backup", bc.Schedule, func(ctx context.Context) error {
+		res := backup.Run(a.DB, opts)
+		if !res.OK() {
+			a.Notify.Dispatch(notify.Event{
+				Kind:    notify.EventBackupFailed,
+				Title:   "Backup failed",
+				Message: res.Error,
+			})
+			return fmt.Errorf("backup failed: %s", res.Error)
+		}
+		if res.PruneError != "" {
+			a.Log.Warnf("Backup retention failed: %s", res.PruneError)
+		}
+		a.Log.Infof("Backup written to %s (%s), pruned %d", res.Path, humanize.Bytes(res.Size), len(res.Pruned))
+		a.Notify.Dispatch(notify.Event{
+			Kind:    notify.EventBackupCompleted,
+			Title:   "Backup completed",
+			Message: fmt.Sprintf("%s (%s)", filepath.Base(res.Path), humanize.Bytes(res.Size)),
+			Fields:  map[string]string{"path": res.Path, "pruned": strconv.Itoa(len(res.Pruned))},
+		})
+		return nil
+	}); err != nil {
+		return fmt.Errorf("invalid backup schedule: %w", err)
+	}
+	return nil
+}
+
+// addRemoteConfigJob pulls the config overlay at remoteConfig.url on its
+// schedule, when one is set. What it changes is applied like any other
+// config change, see app.OnReload.
+func addRemoteConfigJob(a *app.App, sched *scheduler.Scheduler, cfg *types.Configuration) error {
+	if cfg.RemoteConfig.URL == "" {
+		return nil
+	}
+	if err := sched.Add("remote-config", remoteconfig.Schedule(cfg.RemoteConfig), func(ctx context.Context) error {
+		res, err := remoteconfig.Pull(ctx, a.HTTP, a.DB, a.BuildInfo().SigningKey)
+		if err != nil {
+			return fmt.Errorf("remote config pull failed: %w", err)
+		}
+		if len(res.Changed) == 0 {
+			return nil
+		}
+		a.Log.Infof("Remote config changed %s", strings.Join(res.Changed, ", "))
+		a.Notify.Dispatch(notify.Event{
+			Kind:    notify.EventConfigChanged,
+			Title:   "Configuration changed",
+			Message: "changed via remote config: " + strings.Join(res.Changed, ", "),
+			Fields:  map[string]string{"source": config.SourceRemote, "fields": strings.Join(res.Changed, ",")},
+		})
+		return nil
+	}); err != nil {
+		return fmt.Errorf("invalid remote config schedule: %w", err)
+	}
+	return nil
+}
+
+// renewCert renews the server's ACME certificate when it's due, see
+// server.RenewCert, notifying either way.
+func renewCert(ctx context.Context, a *app.App, srv *server.Server) error {
+	renewed, err := srv.RenewCert(ctx)
+	if err != nil {
+		a.Notify.Dispatch(notify.Event{
+			Kind:    notify.EventCertFailed,
+			Title:   "Certificate renewal failed",
+			Message: err.Error(),
+		})
+		return fmt.Errorf("certificate renewal failed: %w", err)
+	}
+	if renewed {
+		a.Notify.Dispatch(notify.Event{
+			Kind:    notify.EventCertRenewed,
+			Title:   "Certificate renewed",
+			Message: "serving a new TLS certificate for " + a.BaseURL,
+		})
+	}
+	return nil
+}
+
+// certRenewSpec is when `service run` checks whether the ACME certificate
+// is due for renewal (within acme.RenewBefore of expiring).
+const certRenewSpec = "17 3 * * *"
+
+// autoUpdateSpec is how often `service run` looks for an update to apply
+// with autoUpdate on. Cheap, it mostly reads what the daily check found.
+const autoUpdateSpec = "*/10 * * * *"
+
+// updateRetrySpec is how often `service run` checks on the last detached
+// update and retries failed ones that are due, see app.RetryUpdate.
+const updateRetrySpec = "* * * * *"
+
+// addUpdateWindowJob applies updates found by the daily check when the
+// configured maintenance window opens.
+func addUpdateWindowJob(a *app.App, sched *scheduler.Scheduler, cfg *types.Configuration) error {
+	w, err := app.ParseUpdateWindow(cfg.UpdateWindow)
+	if err != nil {
+		return err
+	}
+	if w.IsZero() || a.UpdatesDisabled() {
+		return nil
+	}
+	return sched.Add("update-window", w.Cron(), func(ctx context.Context) error {
+		_, err := a.UpdateInWindow(w)
+		return err
+	})
+}
+
+// readyWriter resolves the --ready-notify / --ready-fd flags, nil if neither is set.
+func readyWriter(target string, fd int) (io.Writer, error) {
+	switch {
+	case target != "" && fd != 0:
+		return nil, fmt.Errorf("--ready-notify and --ready-fd are mutually exclusive")
+	case fd != 0:
+		if fd < 3 {
+			return nil, fmt.Errorf("--ready-fd must be 3 or higher, use --ready-notify for stdout/stderr")
+		}
+		// make sure it's an inherited file / pipe / socket. If the parent didn't pass it, the
+		// number may belong to something of ours (e.g. the runtime's epoll fd, an anonymous inode)
+		if !inheritedFD(fd) {
+			return nil, fmt.Errorf("--ready-fd %d is not an inherited file descriptor", fd)
+		}
+		return os.NewFile(uintptr(fd), "ready-fd"), nil
+	case target == "stdout":
+		return os.Stdout, nil
+	case target == "stderr":
+		return os.Stderr, nil
+	case target == "":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("invalid --ready-notify %q, want stdout or stderr", target)
+	}
+}
+
+// waitForNetwork blocks until the network is usable according to the net wait
+// config, reporting progress via sd_notify STATUS so a slow start is visible in
+// `systemctl status` instead of looking hung.
+func waitForNetwork(ctx context.Context, a *app.App, cfg *types.Configuration) error {
+	timeout := x.Ternary(cfg.NetWaitTimeout > 0, time.Duration(cfg.NetWaitTimeout)*time.Second, netWaitDefaultTimeout)
+	deadline := time.Now().Add(timeout)
+	start := time.Now()
+
+	status := func(msg string) {
+		if err := sdnotify.Status(msg); err != nil {
+			a.Log.Debugf("sd_notify STATUS failed: %v", err)
+		}
+	}
+
+	// required interface
+	if cfg.NetWaitInterface != "" {
+		status(fmt.Sprintf("Waiting for interface %s ...", cfg.NetWaitInterface))
+		policy := x.RetryPolicy{MaxAttempts: -1, MaxElapsed: timeout, Initial: 250 * time.Millisecond, Max: 2 * time.Second}
+		if err := x.Retry(ctx, policy, func(attempt int) error {
+			if !interfaceReady(cfg.NetWaitInterface) {
+				return fmt.Errorf("interface %s not up after %v", cfg.NetWaitInterface, timeout)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+	}
+
+	// probes
+	status("Waiting for network ...")
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		return fmt.Errorf("network not ready after %v", timeout)
+	}
+	if err := xnet.Wait(ctx, remaining, cfg.NetWaitProbes...); err != nil {
+		status(fmt.Sprintf("Network not ready after %v", timeout))
+		return err
+	}
+
+	a.Log.Debugf("Network ready after %v", time.Since(start).Round(time.Millisecond))
+	status("Network ready, starting server ...")
+	return nil
+}
+
+// interfaceReady reports whether the named interface is up and has a global unicast address.
+func interfaceReady(name string) bool {
+	ifi, err := net.InterfaceByName(name)
+	if err != nil || ifi.Flags&net.FlagUp == 0 {
+		return false
+	}
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.IsGlobalUnicast() {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"sprout/internal/app"
+	"sprout/internal/platform/backup"
+	"sprout/internal/platform/database"
+	"sprout/internal/platform/database/config"
+	"sprout/internal/platform/release"
+	"sprout/internal/platform/storage"
+	"sprout/pkg/cron"
+	"sprout/pkg/humanize"
+	"sprout/pkg/x"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+var Status = register(func(a *app.App) *cli.Command {
+	return &cli.Command{
+		Name:  "status",
+		Usage: "show version, paths, update state, backups, and disk usage",
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			w := cmd.Root().Writer
+			cfg, err := config.View(a.DB)
+			if err != nil {
+				return fmt.Errorf("failed to get configuration from database: %w", err)
+			}
+
+			fmt.Fprintf(w, "%s %s\n\n", a.BuildInfo().Name, a.BuildInfo().Version)
+			fmt.Fprintf(w, "Storage:  %s\n", a.StorageDir)
+			fmt.Fprintf(w, "Runtime:  %s\n", a.RuntimeDir)
+			if n := database.StaleReaders(); n > 0 {
+				fmt.Fprintf(w, "Database: cleared %d stale reader slot(s) on open, left by a crashed process. If it keeps happening, or the service reports the database locked, run '%s db repair'\n", n, a.BuildInfo().Name)
+			}
+			if a.BuildInfo().ServiceEnabled {
+				fmt.Fprintf(w, "URL:      %s\n", a.BaseURL)
+			}
+			if a.UpdatesDisabled() {
+				fmt.Fprintf(w, "Updates:  disabled (dev build / mode)\n")
+			} else {
+				checked := x.Ternary(cfg.LastUpdateCheck.IsZero(), "never checked", "checked "+humanize.Ago(cfg.LastUpdateCheck))
+				fmt.Fprintf(w, "Updates:  %s channel, %s, %s\n", x.Ternary(cfg.Channel == "", release.ChannelStable, cfg.Channel), checked, x.Ternary(cfg.UpdateAvailable, "update available", "up to date"))
+				if win, err := app.ParseUpdateWindow(cfg.UpdateWindow); err == nil && !win.IsZero() && a.BuildInfo().ServiceEnabled {
+					fmt.Fprintf(w, "          applied in window %s", win)
+					if sched, err := cron.Parse(win.Cron()); err == nil {
+						fmt.Fprintf(w, ", next opens %s", sched.Next(time.Now()).Format(time.DateTime))
+					}
+					fmt.Fprintln(w)
+				} else if cfg.AutoUpdate && a.BuildInfo().ServiceEnabled {
+					fmt.Fprintf(w, "          applied automatically\n")
+				}
+				if r := cfg.UpdateRetry; r.Failures > 0 {
+					fmt.Fprintf(w, "          last %d update(s) FAILED (%s), %s\n", r.Failures, r.LastError,
+						x.Ternary(r.Failures >= app.UpdateRetryLimit, "not retried", "retry "+r.NextAt.Format(time.DateTime)))
+				}
+			}
+
+			if a.BuildInfo().ServiceEnabled {
+				if cfg.Backup.Schedule == "" {
+					fmt.Fprintf(w, "Backups:  not scheduled\n")
+				} else {
+					fmt.Fprintf(w, "Backups:  %s%s", cfg.Backup.Schedule, x.Ternary(cfg.Backup.Encrypt != "", ", encrypted ("+cfg.Backup.Encrypt+")", ""))
+					if sched, err := cron.Parse(cfg.Backup.Schedule); err == nil {
+						fmt.Fprintf(w, ", next %s", sched.Next(time.Now()).Format(time.DateTime))
+					}
+					fmt.Fprintln(w)
+				}
+				history, err := backup.History(a.DB, 1)
+				if err != nil {
+					return fmt.Errorf("failed to get backup history: %w", err)
+				}
+				if len(history) > 0 {
+					last := history[0]
+					fmt.Fprintf(w, "          last %s %s", humanize.Ago(last.Time), x.Ternary(last.OK(), "ok", "FAILED"))
+					if last.OK() {
+						fmt.Fprintf(w, "%s, %s (%s)\n", x.Ternary(last.Verified, " (verified)", ""), last.Path, humanize.Bytes(last.Size))
+					} else {
+						fmt.Fprintf(w, ": %s\n", last.Error)
+					}
+				}
+			}
+
+			usage, err := storage.Measure(a.StorageDir)
+			if err != nil {
+				return fmt.Errorf("failed to measure disk usage: %w", err)
+			}
+			fmt.Fprintf(w, "\nDisk usage\n%s", usage)
+			return nil
+		},
+	}
+})
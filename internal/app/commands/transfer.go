@@ -0,0 +1,169 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"sprout/internal/app"
+	"sprout/internal/platform/backup"
+	"sprout/internal/platform/database/config"
+	"sprout/internal/platform/transfer"
+	"sprout/internal/types"
+	"sprout/pkg/errs"
+	"sprout/pkg/progress"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+var ExportAll = register(func(a *app.App) *cli.Command {
+	return &cli.Command{
+		Name:        "export-all",
+		Usage:       "export all data to a portable archive",
+		Description: "Writes every database bucket as JSON to a tar.gz, for moving to another machine with import-all. The archive holds config secrets (tokens, webhook keys), keep it safe.",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:  "out",
+				Usage: "output file, default <name>-export-<time>.tar.gz in the current dir",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			w := cmd.Root().Writer
+			now := time.Now()
+			out := cmd.String("out")
+			if out == "" {
+				out = fmt.Sprintf("%s-export-%s.tar.gz", a.BuildInfo().Name, now.Format("20060102-150405"))
+			}
+
+			f, err := os.OpenFile(out, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+			if err != nil {
+				return fmt.Errorf("failed to create %s: %w", out, err)
+			}
+			defer f.Close()
+			bar := progress.New(w).Bar("Exporting to "+out, 0)
+			h, err := transfer.Export(a.DB, io.MultiWriter(f, bar), transfer.Header{
+				App:        a.BuildInfo().Name,
+				Version:    a.BuildInfo().Version,
+				StorageDir: a.StorageDir,
+				CreatedAt:  now,
+			})
+			if err == nil {
+				err = f.Close()
+			}
+			if bar.End(err) != nil {
+				os.Remove(out)
+				return fmt.Errorf("failed to export: %w", err)
+			}
+
+			fmt.Fprintf(w, "Schema %s\n", h.SchemaVersion)
+			for _, name := range slices.Sorted(maps.Keys(h.Entries)) {
+				fmt.Fprintf(w, "  %-10s %d entries\n", name, h.Entries[name])
+			}
+			return nil
+		},
+	}
+})
+
+var ImportAll = register(func(a *app.App) *cli.Command {
+	return &cli.Command{
+		Name:        "import-all",
+		Usage:       "replace all data with an export-all archive",
+		Description: "Replaces every database bucket with the archive's contents and migrates it to this version's schema, in one transaction. A backup is taken first. Stop the service before importing and start it afterwards.",
+		ArgsUsage:   "<archive>",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "yes",
+				Usage: "don't ask for confirmation",
+			},
+			&cli.BoolFlag{
+				Name:  "no-backup",
+				Usage: "skip the backup of the current data",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			w := cmd.Root().Writer
+			path := cmd.Args().First()
+			if path == "" {
+				return errs.New(errs.Invalid, "missing archive argument")
+			}
+			f, err := os.Open(path)
+			if err != nil {
+				return errs.Wrap(errs.NotFound, err, fmt.Sprintf("failed to open %s", path))
+			}
+			defer f.Close()
+			cfg, err := config.View(a.DB)
+			if err != nil {
+				return fmt.Errorf("failed to get configuration from database: %w", err)
+			}
+
+			p := progress.New(w)
+			var cancelled bool
+			var step *progress.Task
+			h, err := transfer.Import(a.DB, f, a.Log, func(h *transfer.Header) error {
+				if h.App != a.BuildInfo().Name {
+					return errs.New(errs.Invalid, fmt.Sprintf("archive is from %q, not %s", h.App, a.BuildInfo().Name))
+				}
+				fmt.Fprintf(w, "Archive from %s %s (schema %s), exported %s\n", h.App, h.Version, h.SchemaVersion, h.CreatedAt.Local().Format(time.DateTime))
+				if !cmd.Bool("yes") {
+					yes, err := confirm(cmd, "Replace ALL current data with it?")
+					if err != nil {
+						return fmt.Errorf("prompt failed: %w", err)
+					}
+					if cancelled = !yes; cancelled {
+						return errs.New(errs.Conflict, "import cancelled")
+					}
+				}
+				if !cmd.Bool("no-backup") {
+					s := p.Step("Backing up current data")
+					path, err := backup.Create(a.DB, backup.Options{Dir: backup.Dir(a.StorageDir, cfg.Backup.Dir), App: a.BuildInfo().Name, Version: a.BuildInfo().Version}, time.Now())
+					if s.End(err) != nil {
+						return fmt.Errorf("failed to back up current data (use --no-backup to skip): %w", err)
+					}
+					fmt.Fprintf(w, "Current data backed up to %s\n", path)
+				}
+				step = p.Step("Importing and migrating")
+				return nil
+			})
+			if step != nil {
+				step.End(err)
+			}
+			if cancelled {
+				fmt.Fprintln(w, "Import cancelled.")
+				return nil
+			} else if err != nil {
+				if errs.KindOf(err) != errs.Internal {
+					return err
+				}
+				return fmt.Errorf("failed to import: %w", err)
+			}
+
+			if err := moveStoragePaths(a, h); err != nil {
+				return err
+			}
+			fmt.Fprintln(w, "Import complete. Restart the service if it's running.")
+			return nil
+		},
+	}
+})
+
+// moveStoragePaths rewrites configured paths inside the storage dir of the
+// install an import came from, they move along with it.
+func moveStoragePaths(a *app.App, h *transfer.Header) error {
+	if h.StorageDir == "" || h.StorageDir == a.StorageDir {
+		return nil
+	}
+	if err := config.Update(a.DB, func(cfg *types.Configuration) error {
+		if rest, ok := strings.CutPrefix(cfg.Backup.Dir, h.StorageDir); ok {
+			cfg.Backup.Dir = filepath.Join(a.StorageDir, rest)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("failed to rewrite paths: %w", err)
+	}
+	return nil
+}
@@ -10,7 +10,6 @@ import (
 	"sprout/pkg/x"
 	"time"
 
-	"github.com/Data-Corruption/stdx/xterm/prompt"
 	"github.com/urfave/cli/v3"
 )
 
@@ -18,50 +17,74 @@ var Uninstall = register(func(a *app.App) *cli.Command {
 	return &cli.Command{
 		Name:  "uninstall",
 		Usage: "uninstall the app",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "print what would be removed without removing anything",
+			},
+		},
 		Action: func(ctx context.Context, cmd *cli.Command) error {
-			// confirmation
-			msg := fmt.Sprintf("Are you sure you want to uninstall %s? This will delete all data and the application binary.", a.BuildInfo().Name)
-			if yes, err := prompt.YesNo(msg); err != nil {
-				return fmt.Errorf("prompt failed: %w", err)
-			} else if !yes {
-				fmt.Println("Uninstall cancelled.")
-				return nil
-			}
+			w := cmd.Root().Writer
 
 			// prepare paths
 			serviceName := a.BuildInfo().Name + ".service"
-			home, err := x.GetUserHomeDir()
-			if err != nil {
-				return fmt.Errorf("failed to get user home dir: %w", err)
+			var serviceFile string
+			if a.BuildInfo().ServiceEnabled {
+				home, err := x.GetUserHomeDir()
+				if err != nil {
+					return fmt.Errorf("failed to get user home dir: %w", err)
+				}
+				serviceFile = filepath.Join(home, ".config/systemd/user", serviceName)
 			}
-			serviceFile := filepath.Join(home, ".config/systemd/user", serviceName)
 			storagePath := a.StorageDir
 			binPath, err := getBinPath()
 			if err != nil {
 				return fmt.Errorf("failed to get executable path: %w", err)
 			}
 
-			fmt.Println("Uninstalling...")
+			if cmd.Bool("dry-run") {
+				fmt.Fprintln(w, "Uninstall would:")
+				if a.BuildInfo().ServiceEnabled {
+					fmt.Fprintf(w, "  stop and disable %s\n", serviceName)
+					fmt.Fprintf(w, "  remove service file: %s\n", serviceFile)
+				}
+				if storagePath != "" {
+					fmt.Fprintf(w, "  remove storage directory: %s\n", storagePath)
+				}
+				fmt.Fprintf(w, "  remove binary: %s\n", binPath)
+				return nil
+			}
+
+			// confirmation
+			msg := fmt.Sprintf("Are you sure you want to uninstall %s? This will delete all data and the application binary.", a.BuildInfo().Name)
+			if yes, err := confirm(cmd, msg); err != nil {
+				return fmt.Errorf("prompt failed: %w", err)
+			} else if !yes {
+				fmt.Fprintln(w, "Uninstall cancelled.")
+				return nil
+			}
+
+			fmt.Fprintln(w, "Uninstalling...")
 
 			// schedule cleanup
 			a.SetPostCleanup(func() error {
 				// stop / disable service
 				if a.BuildInfo().ServiceEnabled {
-					fmt.Println("Stopping service...")
+					fmt.Fprintln(w, "Stopping service...")
 					ctxStop, cancelStop := context.WithTimeout(context.Background(), 30*time.Second)
 					defer cancelStop()
 					_ = exec.CommandContext(ctxStop, "systemctl", "--user", "stop", serviceName).Run()
 
-					fmt.Println("Disabling service...")
+					fmt.Fprintln(w, "Disabling service...")
 					ctxDisable, cancelDisable := context.WithTimeout(context.Background(), 5*time.Second)
 					defer cancelDisable()
 					_ = exec.CommandContext(ctxDisable, "systemctl", "--user", "disable", serviceName).Run()
 
 					// remove service file
 					if _, err := os.Stat(serviceFile); err == nil {
-						fmt.Printf("Removing service file: %s\n", serviceFile)
+						fmt.Fprintf(w, "Removing service file: %s\n", serviceFile)
 						if err := os.Remove(serviceFile); err != nil {
-							fmt.Printf("Failed to remove service file: %v\n", err)
+							fmt.Fprintf(w, "Failed to remove service file: %v\n", err)
 						}
 					}
 
@@ -73,21 +96,21 @@ var Uninstall = register(func(a *app.App) *cli.Command {
 
 				// remove storage
 				if storagePath != "" {
-					fmt.Printf("Removing storage directory: %s\n", storagePath)
+					fmt.Fprintf(w, "Removing storage directory: %s\n", storagePath)
 					if err := os.RemoveAll(storagePath); err != nil {
-						fmt.Printf("Failed to remove storage directory: %v\n", err)
+						fmt.Fprintf(w, "Failed to remove storage directory: %v\n", err)
 					}
 				}
 
 				// remove binary
-				fmt.Printf("Removing binary: %s\n", binPath)
+				fmt.Fprintf(w, "Removing binary: %s\n", binPath)
 				if err := os.Remove(binPath); err != nil {
-					fmt.Printf("Failed to remove binary: %v\n", err)
+					fmt.Fprintf(w, "Failed to remove binary: %v\n", err)
 					// if we can't remove it (e.g. running), we might need to try a different approach or warn.
 					// but usually on Linux you can unlink a running binary.
 				}
 
-				fmt.Println("Uninstall complete.")
+				fmt.Fprintln(w, "Uninstall complete.")
 				return nil
 			})
 
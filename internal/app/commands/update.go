@@ -2,12 +2,23 @@ package commands
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"sprout/internal/app"
 	"sprout/internal/platform/database/config"
+	"sprout/internal/platform/release"
 	"sprout/internal/types"
+	"sprout/pkg/errs"
+	"sprout/pkg/progress"
+	"sprout/pkg/x"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/urfave/cli/v3"
+	"golang.org/x/mod/semver"
 )
 
 var Update = register(func(a *app.App) *cli.Command {
@@ -23,12 +34,42 @@ var Update = register(func(a *app.App) *cli.Command {
 				Name:  "check",
 				Usage: "just check for updates",
 			},
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: fmt.Sprintf("with --check, print {current, latest, updateAvailable} as JSON and exit with %d if outdated", UpdateAvailableExit),
+			},
+			&cli.StringFlag{
+				Name:  "channel",
+				Usage: "set the update channel (" + strings.Join(release.Channels, "|") + ")",
+			},
+			&cli.StringFlag{
+				Name:  "to",
+				Usage: "install a specific published version (e.g. v1.2.0) instead of the latest",
+			},
+			&cli.BoolFlag{
+				Name:  "native",
+				Usage: "update in-process without the install script (no curl / sh needed), regardless of the configured updateMethod",
+			},
+			&cli.BoolFlag{
+				Name:  "all-instances",
+				Usage: "update natively, stopping every running instance, migrating once and starting them again in order",
+			},
+			&cli.BoolFlag{
+				Name:  "dry-run",
+				Usage: "print what the update would fetch, replace and stop, without changing anything",
+			},
+			&cli.BoolFlag{
+				Name:  "insecure-skip-verify",
+				Usage: "don't check release signatures, e.g. to install an unsigned dev release (checksums are still checked)",
+			},
 		},
 		Action: func(ctx context.Context, cmd *cli.Command) error {
+			w := cmd.Root().Writer
+			a.InsecureSkipVerify = cmd.Bool("insecure-skip-verify")
 			notify := cmd.Bool("notify")
 			if notify {
 				var updateNotifications bool
-				if err := config.Update(a.DB, func(cfg *types.Configuration) error {
+				if err := config.UpdateFrom(a.DB, config.SourceCLI, func(cfg *types.Configuration) error {
 					cfg.UpdateNotifications = !cfg.UpdateNotifications
 					updateNotifications = cfg.UpdateNotifications
 					return nil
@@ -37,26 +78,160 @@ var Update = register(func(a *app.App) *cli.Command {
 				}
 				// print status
 				if updateNotifications {
-					fmt.Println("Update notifications are now enabled.")
+					fmt.Fprintln(w, "Update notifications are now enabled.")
 				} else {
-					fmt.Println("Update notifications are now disabled.")
+					fmt.Fprintln(w, "Update notifications are now disabled.")
 				}
 				return nil
 			}
 
+			if cmd.IsSet("channel") {
+				channel := cmd.String("channel")
+				if !release.ValidChannel(channel) {
+					return errs.New(errs.Invalid, fmt.Sprintf("invalid channel %q, want one of %s", channel, strings.Join(release.Channels, ", ")))
+				}
+				if err := config.UpdateFrom(a.DB, config.SourceCLI, func(cfg *types.Configuration) error {
+					cfg.Channel = x.Ternary(channel == release.ChannelStable, "", channel)
+					cfg.LastUpdateCheck = time.Time{} // recheck against the new channel
+					cfg.UpdateAvailable = false
+					return nil
+				}); err != nil {
+					return fmt.Errorf("failed to update channel in config: %w", err)
+				}
+				fmt.Fprintf(w, "Update channel set to %s.\n", x.Ternary(channel == "", release.ChannelStable, channel))
+				return nil
+			}
+
 			check := cmd.Bool("check")
+			if check && cmd.Bool("json") {
+				latest, updateAvailable, err := a.CheckLatest()
+				if err != nil {
+					return fmt.Errorf("failed to check for updates: %w", err)
+				}
+				out, err := json.Marshal(struct {
+					Current         string `json:"current"`
+					Latest          string `json:"latest"`
+					UpdateAvailable bool   `json:"updateAvailable"`
+				}{a.BuildInfo().Version, latest, updateAvailable})
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(w, string(out))
+				if updateAvailable {
+					return errs.Status(UpdateAvailableExit)
+				}
+				return nil
+			}
 			if check {
-				if updateAvailable, err := a.CheckForUpdate(); err != nil {
+				step := progress.New(w).Step("Checking for updates")
+				if updateAvailable, err := a.CheckForUpdate(); step.End(err) != nil {
 					return fmt.Errorf("failed to check for updates: %w", err)
 				} else if updateAvailable {
-					fmt.Println("Update available! Run 'sprout update' to update to the latest version.")
+					fmt.Fprintln(w, "Update available! Run 'sprout update' to update to the latest version.")
 				} else {
-					fmt.Println("No updates available.")
+					fmt.Fprintln(w, "No updates available.")
 				}
 				return nil
 			}
 
+			a.AllInstances = cmd.Bool("all-instances")
+			native := cmd.Bool("native") || a.AllInstances
+			if cmd.Bool("dry-run") {
+				return updateDryRun(ctx, a, w, cmd.String("to"), native)
+			}
+			if cmd.IsSet("to") {
+				return updateTo(ctx, a, w, cmd.String("to"), native)
+			}
+			if native {
+				return nativeUpdate(a, w, "")
+			}
 			return a.DeferUpdate()
 		},
 	}
 })
+
+// UpdateAvailableExit is the exit code of `update --check --json` when an
+// update is available (like dnf check-update).
+const UpdateAvailableExit = 100
+
+// updateTo checks version was published and prepares installing it on exit,
+// or installs it right away with native.
+func updateTo(ctx context.Context, a *app.App, w io.Writer, version string, native bool) error {
+	if !semver.IsValid(version) {
+		return errs.New(errs.Invalid, fmt.Sprintf("invalid version %q, want a release tag like v1.2.0", version))
+	}
+	if a.UpdatesDisabled() {
+		return app.ErrDevBuild
+	}
+	bi := a.BuildInfo()
+
+	fCtx, fCancel := context.WithTimeout(ctx, 30*time.Second)
+	defer fCancel()
+	step := progress.New(w).Step("Checking " + version + " was published")
+	if err := step.End(release.FindVersion(fCtx, a.ReleaseSource, bi.ReleaseURL, version)); errors.Is(err, release.ErrUnknownVersion) {
+		return errs.Wrap(errs.NotFound, err, fmt.Sprintf("%s was never published, see %s%s", version, bi.ReleaseURL, release.VersionsAsset))
+	} else if err != nil {
+		return errs.Wrap(errs.Unavailable, err, "failed to reach release source")
+	}
+
+	switch c := semver.Compare(version, bi.Version); {
+	case c == 0:
+		fmt.Fprintf(w, "Reinstalling %s.\n", version)
+	case c < 0:
+		// install.sh migrates with the new binary and rolls back if that fails
+		fmt.Fprintf(w, "Downgrading from %s to %s. If the database was migrated past what %s supports, the install rolls back.\n", bi.Version, version, version)
+	default:
+		fmt.Fprintf(w, "Updating from %s to %s.\n", bi.Version, version)
+	}
+	if native {
+		return nativeUpdate(a, w, version)
+	}
+	return a.DeferUpdateTo(version)
+}
+
+// updateDryRun prints the plan for updating to version ("" = latest).
+func updateDryRun(ctx context.Context, a *app.App, w io.Writer, version string, native bool) error {
+	if version != "" && !semver.IsValid(version) {
+		return errs.New(errs.Invalid, fmt.Sprintf("invalid version %q, want a release tag like v1.2.0", version))
+	}
+	step := progress.New(w).Step("Resolving update")
+	p, err := a.PlanUpdate(ctx, version, native)
+	if step.End(err) != nil {
+		return err
+	}
+
+	target := p.Target
+	if p.Channel != "" {
+		target += " (latest on " + p.Channel + ")"
+	}
+	fmt.Fprintf(w, "Current:   %s\n", p.Current)
+	fmt.Fprintf(w, "Target:    %s%s\n", target, x.Ternary(p.Target == p.Current, ", reinstall", ""))
+	fmt.Fprintf(w, "Method:    %s\n", p.Method)
+	fmt.Fprintf(w, "Fetch:\n")
+	for _, u := range p.Fetch {
+		fmt.Fprintf(w, "  %s\n", u)
+	}
+	fmt.Fprintf(w, "Install:   %s\n", p.InstallPath)
+	if len(p.Instances) == 0 {
+		fmt.Fprintf(w, "Instances: none running\n")
+	} else {
+		pids := make([]string, len(p.Instances))
+		for i, pid := range p.Instances {
+			pids[i] = strconv.Itoa(pid)
+		}
+		fmt.Fprintf(w, "Instances: %s (%s)\n", strings.Join(pids, ", "), x.Ternary(a.AllInstances, "stopped, started again after migrating", "sent SIGTERM"))
+	}
+	fmt.Fprintf(w, "Service:   %s\n", x.Ternary(p.Service, "running, restarted", "not running"))
+	fmt.Fprintln(w, "Dry run, nothing was changed.")
+	return nil
+}
+
+// nativeUpdate runs [app.App.NativeUpdate] with progress output.
+func nativeUpdate(a *app.App, w io.Writer, version string) error {
+	step := progress.New(w).Step("Downloading, verifying and installing")
+	if err := step.End(a.NativeUpdate(version)); err != nil {
+		return err
+	}
+	fmt.Fprintln(w, "Updated.")
+	return nil
+}
@@ -0,0 +1,100 @@
+package commands
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sprout/internal/app"
+	"sprout/internal/platform/database/config"
+	"sprout/internal/platform/release"
+	"sprout/pkg/errs"
+	"sprout/pkg/progress"
+	"sprout/pkg/x"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+var VerifyInstall = register(func(a *app.App) *cli.Command {
+	return &cli.Command{
+		Name:        "verify-install",
+		Usage:       "check the installed binary against the published release",
+		Description: "Downloads the published binary for this version, checks it against its published checksum, and compares it with the running executable. Exits non-zero if they differ. Versions released before per-version publishing can only be verified while they're the latest.",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "print the result as JSON",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			w := cmd.Root().Writer
+			bi := a.BuildInfo()
+			if a.UpdatesDisabled() {
+				return errs.New(errs.Unavailable, "development build, there is no published release to verify against")
+			}
+			exe, err := os.Executable()
+			if err == nil {
+				exe, err = filepath.EvalSymlinks(exe)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to locate executable: %w", err)
+			}
+
+			vCtx, vCancel := context.WithTimeout(ctx, 2*time.Minute)
+			defer vCancel()
+			// progress goes to stderr with --json so stdout stays parseable
+			step := progress.New(x.Ternary(cmd.Bool("json"), cmd.Root().ErrWriter, w)).Step("Downloading and hashing the " + bi.Version + " release")
+			cfg, err := config.View(a.DB)
+			if err != nil {
+				return fmt.Errorf("failed to get configuration from database: %w", err)
+			}
+			// the binary is published on whichever channel the latest release
+			// came from, older versions are kept in their own directory
+			latest, err := release.ResolveLatest(vCtx, a.ReleaseSource, bi.ReleaseURL, cfg.Channel)
+			var v *release.Verification
+			if err == nil {
+				srcURL := release.ChannelURL(bi.ReleaseURL, latest.Channel)
+				if latest.Version != bi.Version {
+					srcURL = release.VersionURL(bi.ReleaseURL, bi.Version)
+				}
+				v, err = release.VerifyBinary(vCtx, a.ReleaseSource, srcURL, bi.Version, exe)
+			}
+			step.End(err)
+			switch {
+			case errors.Is(err, release.ErrNotLatest):
+				return errs.Wrap(errs.Unavailable, err, err.Error()+", update first or verify against the release manually")
+			case errors.Is(err, release.ErrBadAsset):
+				return errs.Wrap(errs.Invalid, err, err.Error()+", the release source can't be trusted")
+			case err != nil:
+				return errs.Wrap(errs.Unavailable, err, "failed to verify against the release source")
+			}
+
+			if cmd.Bool("json") {
+				out, err := json.MarshalIndent(struct {
+					*release.Verification
+					Match bool `json:"match"`
+				}{v, v.Match()}, "", "  ")
+				if err != nil {
+					return err
+				}
+				fmt.Fprintln(w, string(out))
+			} else {
+				fmt.Fprintf(w, "Binary:    %s\n", v.Path)
+				fmt.Fprintf(w, "Version:   %s\n", v.Version)
+				fmt.Fprintf(w, "Published: sha256:%s (%s)\n", v.Published, v.Asset)
+				fmt.Fprintf(w, "Expected:  sha256:%s\n", v.Expected)
+				fmt.Fprintf(w, "Actual:    sha256:%s\n\n", v.Actual)
+			}
+			if !v.Match() {
+				return errs.New(errs.Invalid, fmt.Sprintf("%s does not match the published %s binary, it may have been modified or replaced", v.Path, v.Version))
+			}
+			if !cmd.Bool("json") {
+				fmt.Fprintln(w, "OK, binary matches the published release.")
+			}
+			return nil
+		},
+	}
+})
@@ -0,0 +1,44 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"sprout/internal/app"
+	"sprout/pkg/x"
+	"time"
+
+	"github.com/urfave/cli/v3"
+)
+
+var Version = register(func(a *app.App) *cli.Command {
+	return &cli.Command{
+		Name:  "version",
+		Usage: "print version and build details",
+		Flags: []cli.Flag{
+			&cli.BoolFlag{
+				Name:  "json",
+				Usage: "print as JSON (same as --build-vars)",
+			},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			w := cmd.Root().Writer
+			bi := a.BuildInfo()
+			if cmd.Bool("json") {
+				fmt.Fprintln(w, bi.PrintJSON())
+				return nil
+			}
+
+			fmt.Fprintf(w, "%s %s\n\n", bi.Name, bi.Version)
+			if bi.Commit != "" {
+				fmt.Fprintf(w, "Commit:  %s%s\n", bi.Commit, x.Ternary(bi.Dirty, " (dirty)", ""))
+			}
+			if !bi.CommitTime.IsZero() {
+				fmt.Fprintf(w, "Date:    %s\n", bi.CommitTime.UTC().Format(time.RFC3339))
+			}
+			fmt.Fprintf(w, "Module:  %s\n", bi.ModuleVersion)
+			fmt.Fprintf(w, "Go:      %s\n", bi.GoVersion)
+			fmt.Fprintf(w, "Service: %s\n", x.Ternary(bi.ServiceEnabled, "enabled", "disabled"))
+			return nil
+		},
+	}
+})
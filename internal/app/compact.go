@@ -0,0 +1,107 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sprout/internal/platform/database"
+	"sprout/internal/platform/database/kv"
+	"sprout/pkg/errs"
+	"sprout/pkg/progress"
+)
+
+// CompactResult is what a compaction reclaimed, passed to DeferCompact's done.
+type CompactResult struct {
+	Before, After int64 // size of the data file (kv.DataFile)
+}
+
+// DeferCompact prepares to replace the database on exit, once this process
+// has released it, with a compacted copy that drops free pages and deleted
+// data. The service and other instances are stopped, the copy is written
+// next to the database under the exclusive migration lock and renamed into
+// place, then the service is started again if it was running. The database
+// is left as is if anything fails before the swap.
+//
+// done is called with the result once swapped. Like [App.DeferUpdate], exit
+// soon after.
+func (a *App) DeferCompact(done func(CompactResult)) error {
+	if a.Dev {
+		return errs.New(errs.Invalid, "dev mode works on a copy of the database, compact without --dev")
+	}
+	if _, err := os.Stat(filepath.Join(a.DBDir(), kv.DataFile)); err != nil {
+		return errs.Wrap(errs.NotFound, err, "no database to compact")
+	}
+	exe, err := executablePath()
+	if err != nil {
+		return err
+	}
+	wasActive := a.serviceActive()
+	return a.SetPostCleanup(func() error {
+		return a.compact(exe, wasActive, done)
+	})
+}
+
+// compact swaps a compacted copy of the database in, see [App.DeferCompact].
+func (a *App) compact(exe string, wasActive bool, done func(CompactResult)) error {
+	ctx, cancel := context.WithTimeout(context.Background(), UpdateTimeout)
+	defer cancel()
+	p := progress.New(os.Stdout)
+	release, err := a.stopDatabaseUsers(ctx, p, exe, wasActive)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	dbDir := a.DBDir()
+	fi, err := os.Stat(dbDir)
+	if err != nil {
+		return fmt.Errorf("failed to stat database dir: %w", err)
+	}
+	before, err := fileSize(filepath.Join(dbDir, kv.DataFile))
+	if err != nil {
+		return err
+	}
+
+	// same filesystem as the database, so it's renamed into place
+	staged, err := os.MkdirTemp(a.StorageDir, ".compact-")
+	if err != nil {
+		return fmt.Errorf("failed to create compaction dir: %w", err)
+	}
+	defer os.RemoveAll(staged)
+	step := p.Step("Writing compacted copy")
+	if err := database.Snapshot(dbDir, staged); step.End(err) != nil {
+		return fmt.Errorf("failed to write compacted copy: %w", err)
+	}
+	os.Chmod(staged, fi.Mode().Perm())
+
+	// swap, the old copy only goes once the new one is in place
+	old := staged + ".old"
+	if err := os.Rename(dbDir, old); err != nil {
+		return fmt.Errorf("failed to move current database aside: %w", err)
+	}
+	if err := os.Rename(staged, dbDir); err != nil {
+		if rbErr := os.Rename(old, dbDir); rbErr != nil {
+			return fmt.Errorf("failed to move compacted database into place: %w, and failed to put back the previous one (it's in %s): %w", err, old, rbErr)
+		}
+		return fmt.Errorf("failed to move compacted database into place: %w", err)
+	}
+	if err := os.RemoveAll(old); err != nil {
+		a.Log.Warnf("Failed to remove pre-compaction database %s: %v", old, err)
+	}
+
+	after, err := fileSize(filepath.Join(dbDir, kv.DataFile))
+	if err != nil {
+		return err
+	}
+	done(CompactResult{Before: before, After: after})
+	return nil
+}
+
+func fileSize(path string) (int64, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to stat %s: %w", filepath.Base(path), err)
+	}
+	return fi.Size(), nil
+}
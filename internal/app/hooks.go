@@ -0,0 +1,146 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sprout/internal/platform/database/config"
+	"sprout/internal/types"
+	"sprout/pkg/errs"
+	"strings"
+	"time"
+)
+
+// UpdatePhase says when an [UpdateHook] runs.
+type UpdatePhase int
+
+const (
+	// BeforeUpdate hooks run once the install script is downloaded and
+	// verified, right before it starts. An error cancels the update.
+	BeforeUpdate UpdatePhase = iota
+	// AfterUpdate hooks run once the new version has booted: when the service
+	// starts, or on the first command for builds without one. They're recorded
+	// in the config when the update is prepared, so they survive the restart.
+	AfterUpdate
+)
+
+// DefaultHookTimeout bounds an update hook without its own Timeout.
+const DefaultHookTimeout = 2 * time.Minute
+
+// UpdateHook is a shell command or Go callback run around updates (e.g. drain
+// traffic before, warm caches after). Set Command or Func.
+//
+// AfterUpdate callbacks run in the new version, which looks them up by Name,
+// so keep names stable across versions. Commands are recorded as is.
+type UpdateHook struct {
+	Name    string
+	Phase   UpdatePhase
+	Command string                                           // run with sh -c (cmd /C on Windows), FROM_VERSION / TO_VERSION set
+	Func    func(ctx context.Context, from, to string) error // to is "" if not known yet (latest of the channel)
+	Timeout time.Duration                                    // 0 = DefaultHookTimeout
+}
+
+// AddUpdateHook registers h. Register right after [New] (e.g. in cmd/main.go),
+// Init may already run pending AfterUpdate hooks.
+func (a *App) AddUpdateHook(h UpdateHook) {
+	a.updateHooks = append(a.updateHooks, h)
+}
+
+// beforeUpdate runs the BeforeUpdate hooks, then records the AfterUpdate
+// ones for the next version to run. to is the version being installed, ""
+// meaning the latest of the channel.
+func (a *App) beforeUpdate(to string) error {
+	from := a.buildInfo.Version
+	if to == "" {
+		if latest, err := a.latestRelease(); err == nil {
+			to = latest.Version
+		}
+	}
+	var pending []types.PendingHook
+	for _, h := range a.updateHooks {
+		if h.Phase == AfterUpdate {
+			pending = append(pending, types.PendingHook{Name: h.Name, Command: h.Command})
+			continue
+		}
+		if err := a.runHook(h, from, to); err != nil {
+			return errs.Wrap(errs.Unavailable, err, fmt.Sprintf("update cancelled, pre-update hook %s failed", h.Name))
+		}
+	}
+	// always replace, hooks of an earlier update that never applied mustn't run
+	return config.Update(a.DB, func(cfg *types.Configuration) error {
+		cfg.PendingUpdateHooks = types.PendingUpdateHooks{From: from, Hooks: pending}
+		return nil
+	})
+}
+
+// RunPendingUpdateHooks runs the AfterUpdate hooks recorded by the version
+// this one replaced. They're taken from the config first, so each runs at most
+// once. Nothing happens while the recording version is still the one running
+// (the update hasn't been applied yet).
+func (a *App) RunPendingUpdateHooks() {
+	version := a.buildInfo.Version
+	var p types.PendingUpdateHooks
+	if err := config.Update(a.DB, func(cfg *types.Configuration) error {
+		if len(cfg.PendingUpdateHooks.Hooks) == 0 || cfg.PendingUpdateHooks.From == version {
+			return nil
+		}
+		p, cfg.PendingUpdateHooks = cfg.PendingUpdateHooks, types.PendingUpdateHooks{}
+		return nil
+	}); err != nil {
+		a.Log.Errorf("Failed to take pending update hooks: %v", err)
+		return
+	}
+	for _, ph := range p.Hooks {
+		h, ok := a.afterUpdateHook(ph)
+		if !ok {
+			a.Log.Warnf("Post-update hook %s isn't registered in %s, skipped", ph.Name, version)
+			continue
+		}
+		if err := a.runHook(h, p.From, version); err != nil {
+			a.Log.Errorf("Post-update hook %s failed: %v", h.Name, err)
+		}
+	}
+}
+
+// afterUpdateHook resolves a recorded hook, commands as recorded, callbacks
+// by name among this version's hooks.
+func (a *App) afterUpdateHook(ph types.PendingHook) (UpdateHook, bool) {
+	if ph.Command != "" {
+		return UpdateHook{Name: ph.Name, Phase: AfterUpdate, Command: ph.Command}, true
+	}
+	for _, h := range a.updateHooks {
+		if h.Phase == AfterUpdate && h.Name == ph.Name && h.Func != nil {
+			return h, true
+		}
+	}
+	return UpdateHook{}, false
+}
+
+func (a *App) runHook(h UpdateHook, from, to string) error {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = DefaultHookTimeout
+	}
+	ctx, cancel := context.WithTimeout(a.Context, timeout)
+	defer cancel()
+
+	a.Log.Infof("Running update hook %s (%s -> %s)", h.Name, from, to)
+	switch {
+	case h.Func != nil:
+		return h.Func(ctx, from, to)
+	case h.Command != "":
+		cmd := shellCommand(ctx, h.Command)
+		cmd.Env = append(os.Environ(), "FROM_VERSION="+from, "TO_VERSION="+to)
+		out, err := cmd.CombinedOutput()
+		if s := strings.TrimSpace(string(out)); s != "" {
+			a.Log.Infof("Update hook %s output: %s", h.Name, s)
+		}
+		if err != nil {
+			return fmt.Errorf("command failed: %w", err)
+		}
+		return nil
+	default:
+		return errors.New("hook has neither a command nor a func")
+	}
+}
@@ -0,0 +1,74 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sprout/internal/build"
+	"sprout/internal/platform/database"
+	"sprout/internal/platform/database/config"
+	"sprout/pkg/errs"
+	"testing"
+
+	"github.com/Data-Corruption/stdx/xlog"
+)
+
+func TestUpdateHooks(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger, err := xlog.New(filepath.Join(tmpDir, "logs"), "debug")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+	db, err := database.New(filepath.Join(tmpDir, "db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to create db: %v", err)
+	}
+	defer db.Close()
+
+	newApp := func(version string) *App {
+		bi := build.Info()
+		bi.Version = version
+		return &App{DB: db, Log: logger, buildInfo: bi, Context: context.Background()}
+	}
+
+	// a failing pre-update hook cancels the update
+	old := newApp("v1.0.0")
+	old.AddUpdateHook(UpdateHook{Name: "drain", Phase: BeforeUpdate, Command: "exit 3"})
+	if err := old.beforeUpdate("v1.1.0"); errs.KindOf(err) != errs.Unavailable {
+		t.Fatalf("beforeUpdate() with failing hook = %v, want Unavailable", err)
+	}
+
+	// passing ones record the post-update hooks for the next version
+	marker := filepath.Join(tmpDir, "marker")
+	old = newApp("v1.0.0")
+	old.AddUpdateHook(UpdateHook{Name: "drain", Phase: BeforeUpdate, Command: "true"})
+	old.AddUpdateHook(UpdateHook{Name: "warm", Phase: AfterUpdate, Command: `echo "$FROM_VERSION $TO_VERSION" > ` + marker})
+	old.AddUpdateHook(UpdateHook{Name: "reindex", Phase: AfterUpdate, Func: func(context.Context, string, string) error { return nil }})
+	if err := old.beforeUpdate("v1.1.0"); err != nil {
+		t.Fatalf("beforeUpdate() = %v", err)
+	}
+	old.RunPendingUpdateHooks() // not updated yet, nothing runs
+	if cfg, _ := config.View(db); len(cfg.PendingUpdateHooks.Hooks) != 2 {
+		t.Fatalf("pending hooks = %+v, want 2", cfg.PendingUpdateHooks)
+	}
+
+	// the new version runs them once, callbacks by name
+	var gotFrom, gotTo string
+	updated := newApp("v1.1.0")
+	updated.AddUpdateHook(UpdateHook{Name: "reindex", Phase: AfterUpdate, Func: func(_ context.Context, from, to string) error {
+		gotFrom, gotTo = from, to
+		return errors.New("logged, not fatal")
+	}})
+	updated.RunPendingUpdateHooks()
+	if gotFrom != "v1.0.0" || gotTo != "v1.1.0" {
+		t.Errorf("callback got %q -> %q", gotFrom, gotTo)
+	}
+	if out, err := os.ReadFile(marker); err != nil || string(out) != "v1.0.0 v1.1.0\n" {
+		t.Errorf("command hook output = %q, %v", out, err)
+	}
+	if cfg, _ := config.View(db); len(cfg.PendingUpdateHooks.Hooks) != 0 {
+		t.Errorf("pending hooks left after running: %+v", cfg.PendingUpdateHooks)
+	}
+}
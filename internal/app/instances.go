@@ -0,0 +1,174 @@
+//go:build linux
+
+package app
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// DrainTimeout bounds how long update --all-instances waits for instances
+// to exit after SIGTERM.
+const DrainTimeout = 2 * time.Minute
+
+// instanceProc is a running instance, enough to start it again.
+type instanceProc struct {
+	pid   int
+	start uint64 // clock ticks after boot, orders instances by age
+	args  []string
+	dir   string
+	env   []string
+}
+
+// activateAll is activateNative for [App.AllInstances]: it stops every
+// instance of exe and waits for them to exit, migrates once under the
+// exclusive lock, then starts them again in the order they were started,
+// the service first. If they don't all exit or the migration fails, the old
+// binary is put back before they're started again.
+func (a *App) activateAll(ctx context.Context, exe, oldBin string) error {
+	wasActive := a.serviceActive()
+	var servicePID int
+	if wasActive {
+		out, _ := a.systemctl(ctx, "show", "-p", "MainPID", "--value")
+		servicePID, _ = strconv.Atoi(string(bytes.TrimSpace(out)))
+	}
+	var procs []instanceProc
+	for _, pid := range a.instancesOf(exe) {
+		if pid == servicePID {
+			continue // systemd starts it again
+		}
+		p, err := readInstance(pid)
+		if err != nil {
+			a.Log.Warnf("Instance %d won't be restarted: %v", pid, err)
+			continue
+		}
+		procs = append(procs, p)
+	}
+	slices.SortFunc(procs, func(x, y instanceProc) int { return cmp.Compare(x.start, y.start) })
+
+	if wasActive {
+		if out, err := a.systemctl(ctx, "stop"); err != nil {
+			return fmt.Errorf("failed to stop service: %w: %s", err, bytes.TrimSpace(out))
+		}
+	}
+	a.stopInstances(exe)
+	dCtx, dCancel := context.WithTimeout(ctx, DrainTimeout)
+	err := waitExited(dCtx, a.instancesOf(exe))
+	dCancel()
+	if err == nil {
+		err = a.migrateExclusive(ctx, exe)
+	}
+	if err != nil {
+		if rbErr := os.Rename(oldBin, exe); rbErr != nil {
+			err = fmt.Errorf("%w, and failed to restore the previous binary: %w", err, rbErr)
+		} else {
+			err = fmt.Errorf("%w, rolled back to %s", err, a.buildInfo.Version)
+		}
+	}
+
+	if wasActive {
+		if out, sErr := a.systemctl(ctx, "start"); sErr != nil {
+			a.Log.Errorf("Failed to start service: %v: %s", sErr, bytes.TrimSpace(out))
+		}
+	}
+	for _, p := range procs {
+		if processAlive(p.pid) {
+			continue // never stopped
+		}
+		pid, sErr := respawn(exe, p)
+		if sErr != nil {
+			a.Log.Errorf("Failed to restart instance %d (%s): %v", p.pid, strings.Join(p.args, " "), sErr)
+			continue
+		}
+		a.Log.Infof("Restarted instance %d as %d", p.pid, pid)
+	}
+	return err
+}
+
+// readInstance reads what's needed to start pid again from /proc.
+func readInstance(pid int) (instanceProc, error) {
+	p := instanceProc{pid: pid}
+	proc := "/proc/" + strconv.Itoa(pid)
+	stat, err := os.ReadFile(proc + "/stat")
+	if err != nil {
+		return p, err
+	}
+	// fields after the command name, which may contain spaces; starttime is the 22nd
+	if i := bytes.LastIndexByte(stat, ')'); i >= 0 {
+		if f := strings.Fields(string(stat[i+1:])); len(f) > 19 {
+			p.start, _ = strconv.ParseUint(f[19], 10, 64)
+		}
+	}
+	cmdline, err := os.ReadFile(proc + "/cmdline")
+	if err != nil {
+		return p, err
+	}
+	p.args = nulSplit(cmdline)
+	if len(p.args) == 0 {
+		return p, errors.New("empty command line")
+	}
+	if p.dir, err = os.Readlink(proc + "/cwd"); err != nil {
+		return p, err
+	}
+	environ, err := os.ReadFile(proc + "/environ")
+	if err != nil {
+		return p, err
+	}
+	p.env = nulSplit(environ)
+	return p, nil
+}
+
+func nulSplit(b []byte) []string {
+	b = bytes.TrimSuffix(b, []byte{0})
+	if len(b) == 0 {
+		return nil
+	}
+	return strings.Split(string(b), "\x00")
+}
+
+// waitExited waits until none of pids is running.
+func waitExited(ctx context.Context, pids []int) error {
+	for {
+		var left []string
+		for _, pid := range pids {
+			if processAlive(pid) {
+				left = append(left, strconv.Itoa(pid))
+			}
+		}
+		if len(left) == 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("instances %s didn't exit: %w", strings.Join(left, ", "), ctx.Err())
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+func processAlive(pid int) bool {
+	return syscall.Kill(pid, 0) == nil
+}
+
+// respawn starts exe like p was started, detached. Output is discarded, the
+// app logs to its own files.
+func respawn(exe string, p instanceProc) (int, error) {
+	cmd := exec.Command(exe, p.args[1:]...)
+	cmd.Dir, cmd.Env = p.dir, p.env
+	cmd.SysProcAttr = detachedProcAttr()
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+	pid := cmd.Process.Pid
+	return pid, cmd.Process.Release()
+}
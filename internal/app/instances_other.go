@@ -0,0 +1,11 @@
+//go:build !linux
+
+package app
+
+import "context"
+
+// activateAll needs /proc to start instances again the way they were
+// started. nativeUpdate refuses [App.AllInstances] before getting here.
+func (a *App) activateAll(context.Context, string, string) error {
+	return errAllInstances
+}
@@ -0,0 +1,75 @@
+//go:build linux
+
+package app
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/Data-Corruption/stdx/xlog"
+)
+
+func TestInstanceRestart(t *testing.T) {
+	logger, err := xlog.New(t.TempDir(), "none")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	t.Cleanup(func() { logger.Close() })
+	sleep, err := exec.LookPath("sleep")
+	if err == nil {
+		sleep, err = filepath.EvalSymlinks(sleep)
+	}
+	if err != nil {
+		t.Skip("no sleep binary")
+	}
+
+	// a registered instance of "exe"
+	dir := t.TempDir()
+	a := &App{Log: logger, RuntimeDir: dir}
+	os.MkdirAll(filepath.Join(dir, InstancesDir), 0o755)
+	cmd := exec.Command(sleep, "60")
+	cmd.Env = []string{"INSTANCE=1"}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	exited := make(chan struct{})
+	go func() { cmd.Wait(); close(exited) }()
+	defer cmd.Process.Kill()
+	os.WriteFile(filepath.Join(dir, InstancesDir, strconv.Itoa(cmd.Process.Pid)), nil, 0o644)
+
+	if got := a.instancesOf(sleep); !slices.Equal(got, []int{cmd.Process.Pid}) {
+		t.Fatalf("instancesOf() = %v, want %d", got, cmd.Process.Pid)
+	}
+	p, err := readInstance(cmd.Process.Pid)
+	if err != nil {
+		t.Fatalf("readInstance() = %v", err)
+	}
+	if !slices.Equal(p.args[1:], []string{"60"}) || !slices.Contains(p.env, "INSTANCE=1") || p.start == 0 {
+		t.Errorf("readInstance() = %+v", p)
+	}
+
+	// drained, then started the same way
+	a.stopInstances(sleep)
+	<-exited
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := waitExited(ctx, []int{cmd.Process.Pid}); err != nil {
+		t.Fatalf("waitExited() = %v", err)
+	}
+	pid, err := respawn(sleep, p)
+	if err != nil {
+		t.Fatalf("respawn() = %v", err)
+	}
+	defer syscall.Kill(pid, syscall.SIGKILL)
+	again, err := readInstance(pid)
+	if err != nil || !slices.Equal(again.args[1:], p.args[1:]) || !slices.Equal(again.env, p.env) {
+		t.Errorf("respawned instance = %+v, %v, want started like %+v", again, err, p)
+	}
+}
@@ -6,8 +6,6 @@ import (
 	"path/filepath"
 	"strconv"
 	"time"
-
-	"golang.org/x/sys/unix"
 )
 
 const (
@@ -41,7 +39,7 @@ func (a *App) mguard() error {
 	// acquire shared lock with timeout
 	done := make(chan error, 1)
 	go func() {
-		done <- unix.Flock(int(f.Fd()), unix.LOCK_SH)
+		done <- lockShared(f)
 	}()
 	select {
 	case err := <-done:
@@ -63,6 +61,7 @@ func (a *App) mguard() error {
 	}
 	_ = pidFile.Close() // file just needs to exist
 
+	a.guard = f
 	a.AddCleanup(func() error {
 		_ = os.Remove(pidPath)
 		return f.Close() // release shared lock
@@ -0,0 +1,414 @@
+package app
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sprout/internal/platform/database/config"
+	"sprout/internal/platform/release"
+	"sprout/pkg/bspatch"
+	"sprout/pkg/errs"
+	"sprout/pkg/humanize"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Update methods, see types.Configuration.UpdateMethod.
+const (
+	UpdateMethodScript = "script" // the published install script, run through sh (default)
+	UpdateMethodNative = "native" // NativeUpdate, for hosts without curl or where piping scripts isn't allowed. Always used off Linux
+)
+
+// errAllInstances refuses [App.AllInstances] where it isn't supported.
+var errAllInstances = errs.New(errs.Invalid, "--all-instances is only supported on Linux")
+
+// maxBinarySize bounds the decompressed binary.
+const maxBinarySize = 1 << 30
+
+// nativeUpdates reports whether updates should go through [App.NativeUpdate].
+// The install script only supports Linux.
+func (a *App) nativeUpdates() bool {
+	if runtime.GOOS != "linux" {
+		return true
+	}
+	cfg, err := config.View(a.DB)
+	return err == nil && cfg.UpdateMethod == UpdateMethodNative
+}
+
+// NativeUpdate installs version ("" = the channel's latest) without the
+// install script or curl: it downloads the binary for this GOOS/GOARCH,
+// verifies it like the script does (checksum, signature for signed builds),
+// atomically swaps it over the running executable and restarts.
+//
+// Restarting mirrors the script: other instances are sent SIGTERM, the new
+// binary migrates the database (-m) under the exclusive migration lock, and
+// the service is restarted if it's running. If the migration fails the old
+// binary is put back. Called from the service itself the service is just
+// restarted, the new version migrating as it opens the database.
+//
+// With [App.AllInstances] it waits for the instances to exit and starts them
+// again after migrating, in the order they were started.
+//
+// Unlike the script it doesn't touch the service unit or PATH. Like
+// [App.DetachUpdate] only the first call has any effect.
+func (a *App) NativeUpdate(version string) error {
+	var rErr error
+	a.updateOnce(func() {
+		rErr = a.nativeUpdate(version)
+	})
+	return rErr
+}
+
+func (a *App) nativeUpdate(version string) error {
+	if a.UpdatesDisabled() {
+		return ErrDevBuild
+	}
+	if a.AllInstances && runtime.GOOS != "linux" {
+		return errAllInstances
+	}
+	ctx, cancel := context.WithTimeout(a.Context, UpdateTimeout)
+	defer cancel()
+
+	exe, err := executablePath()
+	if err != nil {
+		return err
+	}
+
+	// download (or patch), verify and check the new binary runs here
+	if a.buildInfo.SigningKey != "" && a.InsecureSkipVerify {
+		a.Log.Warnf("Skipping release signature verification (--insecure-skip-verify)")
+	}
+	_, assetURL := a.updateEnv(version)
+	bin, err := a.nativeBinary(ctx, assetURL, exe)
+	if err != nil {
+		return err
+	}
+	newBin, err := writeTemp(filepath.Dir(exe), "."+filepath.Base(exe)+"-new-*"+filepath.Ext(exe), bin)
+	if err != nil {
+		return fmt.Errorf("failed to write new binary: %w", err)
+	}
+	defer os.Remove(newBin) // gone after the swap
+	if err := os.Chmod(newBin, 0o755); err != nil {
+		return fmt.Errorf("failed to write new binary: %w", err)
+	}
+	to, err := binaryVersion(ctx, newBin)
+	if err != nil {
+		return errs.Wrap(errs.Invalid, err, "downloaded binary doesn't run on this host")
+	}
+	if version != "" && to != version {
+		return errs.New(errs.Invalid, fmt.Sprintf("downloaded binary is %s, not %s", to, version))
+	}
+	a.Log.Infof("Updating natively from %s to %s", a.buildInfo.Version, to)
+
+	if err := a.beforeUpdate(to); err != nil {
+		return err
+	}
+	if err := uPrep(a.buildInfo.Version, a.DB); err != nil {
+		return err
+	}
+
+	// keep the old binary for rollback (where install.sh keeps it) and in
+	// case the migration fails, then swap
+	if to != a.buildInfo.Version {
+		if err := copyFile(exe, a.PrevBinaryPath(), 0o755); err != nil {
+			a.Log.Warnf("Failed to keep previous binary for rollback: %v", err)
+		}
+	}
+	oldBin := filepath.Join(filepath.Dir(exe), "."+filepath.Base(exe)+"-old-"+strconv.Itoa(os.Getpid()))
+	if err := swapBinary(exe, newBin, oldBin); err != nil {
+		return fmt.Errorf("failed to replace binary: %w", err)
+	}
+	defer os.Remove(oldBin) // fails while it's running on Windows, removed by the next update
+
+	return a.activateNative(ctx, exe, oldBin)
+}
+
+// nativeBinary returns the binary for this platform at assetURL. It tries
+// the patch from the running version first, applied to current (the running
+// executable), falling back to downloading the whole binary. Either is
+// checked against its published checksum and, for signed builds, the
+// checksum's signature.
+func (a *App) nativeBinary(ctx context.Context, assetURL, current string) ([]byte, error) {
+	name := release.BinaryAssetFor(runtime.GOOS, runtime.GOARCH)
+	if current != "" {
+		bin, err := a.patchedBinary(ctx, assetURL, name, current)
+		if err == nil {
+			return bin, nil
+		}
+		a.Log.Infof("No usable patch from %s, downloading the whole binary: %v", a.buildInfo.Version, err)
+	}
+
+	gz, sum, err := release.FetchVerified(ctx, a.ReleaseSource, assetURL, name)
+	if errors.Is(err, release.ErrBadAsset) {
+		return nil, errs.Wrap(errs.Invalid, err, "refusing to install the downloaded binary")
+	} else if err != nil {
+		return nil, errs.Wrap(errs.Unavailable, err, "failed to download the release binary")
+	}
+	if a.verifiesSignatures() {
+		// the checksum the binary was checked against must be the signed one
+		signed, err := a.publishedChecksum(ctx, assetURL, name+".sha256")
+		if err != nil {
+			return nil, err
+		}
+		if signed != sum {
+			return nil, errs.Wrap(errs.Invalid, fmt.Errorf("%w (%s.sha256 changed during the update)", release.ErrBadSignature, name), "refusing to install the downloaded binary")
+		}
+	}
+	return decompressBinary(gz, maxBinarySize)
+}
+
+// decompressBinary returns the gzipped binary gz, failing rather than
+// truncating it if it decompresses to more than limit bytes.
+func decompressBinary(gz []byte, limit int64) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(gz))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress binary: %w", err)
+	}
+	bin, err := io.ReadAll(io.LimitReader(zr, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress binary: %w", err)
+	}
+	if int64(len(bin)) > limit {
+		return nil, errs.New(errs.Invalid, fmt.Sprintf("refusing to install the downloaded binary, it's larger than %s", humanize.Bytes(limit)))
+	}
+	return bin, nil
+}
+
+// patchedBinary applies the published patch from the running version to the
+// binary at current, checking the result against the uncompressed binary's
+// checksum.
+func (a *App) patchedBinary(ctx context.Context, assetURL, name, current string) ([]byte, error) {
+	patch, _, err := release.FetchVerified(ctx, a.ReleaseSource, assetURL, release.PatchAsset(name, a.buildInfo.Version))
+	if err != nil {
+		return nil, err
+	}
+	want, err := a.publishedChecksum(ctx, assetURL, release.RawChecksumAsset(name))
+	if err != nil {
+		return nil, err
+	}
+	old, err := os.ReadFile(current)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read executable: %w", err)
+	}
+	bin, err := bspatch.Apply(old, patch, maxBinarySize)
+	if err != nil {
+		return nil, err
+	}
+	if sum := sha256.Sum256(bin); hex.EncodeToString(sum[:]) != want {
+		return nil, fmt.Errorf("%w (patched binary doesn't match %s)", release.ErrBadAsset, release.RawChecksumAsset(name))
+	}
+	a.Log.Infof("Applied %s (%s instead of the whole binary)", release.PatchAsset(name, a.buildInfo.Version), humanize.Bytes(int64(len(patch))))
+	return bin, nil
+}
+
+// verifiesSignatures reports whether release signatures are checked, i.e.
+// the build has a signing key and --insecure-skip-verify isn't set.
+func (a *App) verifiesSignatures() bool {
+	return a.buildInfo.SigningKey != "" && !a.InsecureSkipVerify
+}
+
+// publishedChecksum reads the checksum file sumName at assetURL, verifying
+// its signature if [App.verifiesSignatures].
+func (a *App) publishedChecksum(ctx context.Context, assetURL, sumName string) (string, error) {
+	sumFile, err := a.ReleaseSource.GetAsset(ctx, assetURL, sumName)
+	if err != nil {
+		return "", errs.Wrap(errs.Unavailable, err, "failed to get "+sumName)
+	}
+	if a.verifiesSignatures() {
+		err := release.VerifySignature(ctx, a.ReleaseSource, assetURL, sumName, sumFile, a.buildInfo.SigningKey)
+		if errors.Is(err, release.ErrBadSignature) {
+			return "", errs.Wrap(errs.Invalid, err, "refusing to install the downloaded binary")
+		} else if err != nil {
+			return "", errs.Wrap(errs.Unavailable, err, "failed to verify release signatures")
+		}
+	}
+	fields := strings.Fields(string(sumFile))
+	if len(fields) == 0 || len(fields[0]) != sha256.Size*2 {
+		return "", fmt.Errorf("malformed %s", sumName)
+	}
+	return strings.ToLower(fields[0]), nil
+}
+
+// activateNative gets the swapped in binary at exe running, putting oldBin
+// back if it can't migrate the database. See [App.NativeUpdate].
+func (a *App) activateNative(ctx context.Context, exe, oldBin string) error {
+	a.stopInstances(exe)
+
+	// the service can't migrate under the exclusive lock while it has the
+	// database open itself, it's restarted and the new version migrates on open
+	if a.Server != nil {
+		if label := launchdLabel(); label != "" {
+			return restartLaunchd(label)
+		}
+		if !a.systemdService() || os.Getenv("INVOCATION_ID") == "" {
+			a.Log.Warnf("Not running as the systemd service, restart to run the new version")
+			return nil
+		}
+		if out, err := a.systemctl(ctx, "restart", "--no-block"); err != nil { // systemd stops this process
+			return fmt.Errorf("failed to restart service: %w: %s", err, bytes.TrimSpace(out))
+		}
+		return nil
+	}
+
+	if a.AllInstances {
+		return a.activateAll(ctx, exe, oldBin)
+	}
+	wasActive := a.serviceActive()
+	if wasActive {
+		if out, err := a.systemctl(ctx, "stop"); err != nil {
+			return fmt.Errorf("failed to stop service: %w: %s", err, bytes.TrimSpace(out))
+		}
+	}
+	err := a.migrateExclusive(ctx, exe)
+	if err != nil {
+		if rbErr := os.Rename(oldBin, exe); rbErr != nil {
+			err = fmt.Errorf("%w, and failed to restore the previous binary: %w", err, rbErr)
+		} else {
+			err = fmt.Errorf("%w, rolled back to %s", err, a.buildInfo.Version)
+		}
+	}
+	if wasActive {
+		if out, sErr := a.systemctl(ctx, "start"); sErr != nil {
+			a.Log.Errorf("Failed to start service: %v: %s", sErr, bytes.TrimSpace(out))
+		}
+	}
+	return err
+}
+
+// launchdLabel is the label of the launchd job running this process on
+// macOS, "" if it isn't one.
+func launchdLabel() string {
+	if runtime.GOOS != "darwin" {
+		return ""
+	}
+	if label := os.Getenv("XPC_SERVICE_NAME"); label != "0" {
+		return label
+	}
+	return ""
+}
+
+// restartLaunchd has launchd restart the job label, stopping this process.
+// launchctl is detached so it isn't stopped along with it.
+func restartLaunchd(label string) error {
+	cmd := exec.Command("launchctl", "kickstart", "-k", fmt.Sprintf("gui/%d/%s", os.Getuid(), label))
+	cmd.SysProcAttr = detachedProcAttr()
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to restart launchd job %s: %w", label, err)
+	}
+	return cmd.Process.Release()
+}
+
+// migrateExclusive runs the binary at exe as the migrator (-m) while holding
+// the migration lock exclusively, i.e. once every other instance has exited.
+func (a *App) migrateExclusive(ctx context.Context, exe string) error {
+	if a.guard != nil {
+		lCtx, lCancel := context.WithTimeout(ctx, 2*time.Minute)
+		defer lCancel()
+		if err := lockExclusiveCtx(lCtx, a.guard); err != nil {
+			return fmt.Errorf("timeout waiting for other instances to exit: %w", err)
+		}
+		defer lockShared(a.guard) // back to how mguard left it
+	}
+	out, err := exec.CommandContext(ctx, exe, "-m").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s -m failed: %w: %s", exe, err, bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// lockExclusiveCtx upgrades the lock on f to exclusive, giving up when ctx is done.
+func lockExclusiveCtx(ctx context.Context, f *os.File) error {
+	for {
+		if ok, err := tryLockExclusive(f); ok || err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+}
+
+// stopInstances sends SIGTERM to the other instances of the binary at exe
+// registered in the instances dir, like install.sh does.
+func (a *App) stopInstances(exe string) {
+	for _, pid := range a.instancesOf(exe) {
+		a.Log.Debugf("Stopping instance %d", pid)
+		_ = terminate(pid)
+	}
+}
+
+// instancesOf returns the PIDs registered in the instances dir that run exe,
+// other than this process.
+func (a *App) instancesOf(exe string) []int {
+	var pids []int
+	entries, _ := os.ReadDir(filepath.Join(a.RuntimeDir, InstancesDir))
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || pid == os.Getpid() || !instanceRuns(pid, exe) {
+			continue
+		}
+		pids = append(pids, pid)
+	}
+	return pids
+}
+
+// executablePath is this process's binary, symlinks resolved.
+func executablePath() (string, error) {
+	exe, err := os.Executable()
+	if err == nil {
+		exe, err = filepath.EvalSymlinks(exe)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to locate executable: %w", err)
+	}
+	return exe, nil
+}
+
+// systemdService reports whether the app is installed as a systemd user
+// service, builds with a service on Linux. Elsewhere it runs in the
+// foreground or under whatever the user set up.
+func (a *App) systemdService() bool {
+	return a.buildInfo.ServiceEnabled && runtime.GOOS == "linux"
+}
+
+// serviceActive reports whether the app's systemd user service is running.
+func (a *App) serviceActive() bool {
+	if !a.systemdService() {
+		return false
+	}
+	_, err := a.systemctl(a.Context, "is-active", "--quiet")
+	return err == nil
+}
+
+func (a *App) systemctl(ctx context.Context, args ...string) ([]byte, error) {
+	sCtx, sCancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer sCancel()
+	args = append([]string{"--user"}, args...)
+	args = append(args, a.buildInfo.Name+".service")
+	return exec.CommandContext(sCtx, "systemctl", args...).CombinedOutput()
+}
+
+// copyFile copies src to dst with perm, replacing dst.
+func copyFile(src, dst string, perm os.FileMode) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	tmp := dst + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
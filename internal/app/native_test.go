@@ -0,0 +1,114 @@
+package app
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sprout/internal/build"
+	"sprout/internal/platform/release"
+	"sprout/internal/testsupport/releasetest"
+	"sprout/pkg/errs"
+	"strings"
+	"testing"
+
+	"github.com/Data-Corruption/stdx/xlog"
+)
+
+// a bsdiff 4 patch built with Python's bz2, see pkg/bspatch
+const patchHex = "42534449464634302e000000000000002b000000000000003c00000000000000425a6839314159265359965aa19f000005f00048080800002020002129a6d066817c0ae177245385090965aa19f0425a683931415926535942d2802b000000e00060040400200030cd34126836932717724538509042d2802b425a6839314159265359232bc7850000025180001040042a61cc802000229a3d2198a100000efac2622a7ca094c7c5dc914e142408caf1e140"
+
+func TestNativeUpdate(t *testing.T) {
+	logger, err := xlog.New(t.TempDir(), "none")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	t.Cleanup(func() { logger.Close() })
+	newApp := func(signingKey string, assets map[string][]byte) *App {
+		bi := build.Info()
+		bi.Version = "v1.0.0"
+		bi.SigningKey = signingKey
+		return &App{Log: logger, ReleaseSource: &releasetest.MockReleaseSource{Assets: assets}, buildInfo: bi, Context: context.Background()}
+	}
+	bin := []byte("#!/bin/sh\necho v1.1.0\n")
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	zw.Write(bin)
+	zw.Close()
+	name := release.BinaryAssetFor(runtime.GOOS, runtime.GOARCH)
+	ctx := context.Background()
+
+	a := newApp("", map[string][]byte{name: gz.Bytes()})
+	if got, err := a.nativeBinary(ctx, "", ""); err != nil || !bytes.Equal(got, bin) {
+		t.Fatalf("nativeBinary() = %q, %v", got, err)
+	}
+	// a binary past the size limit is refused rather than truncated
+	if got, err := decompressBinary(gz.Bytes(), int64(len(bin))); err != nil || !bytes.Equal(got, bin) {
+		t.Errorf("decompressBinary() at the limit = %q, %v", got, err)
+	}
+	if got, err := decompressBinary(gz.Bytes(), int64(len(bin))-1); errs.KindOf(err) != errs.Invalid {
+		t.Errorf("decompressBinary() past the limit = %q, %v, want Invalid", got, err)
+	}
+
+	// tampered binary
+	a = newApp("", map[string][]byte{name: []byte("evil"), name + ".sha256": []byte(releasetest.Checksum(gz.Bytes()) + "  " + name + "\n")})
+	if _, err := a.nativeBinary(ctx, "", ""); !errors.Is(err, release.ErrBadAsset) || errs.KindOf(err) != errs.Invalid {
+		t.Errorf("nativeBinary() with bad checksum = %v, want Invalid ErrBadAsset", err)
+	}
+
+	// signed builds check the checksum file's signature
+	signer := releasetest.NewSigner()
+	sums := []byte(releasetest.Checksum(gz.Bytes()) + "  " + name + "\n")
+	signed := map[string][]byte{name: gz.Bytes(), name + ".sha256": sums, name + ".sha256" + release.SignatureSuffix: signer.Sign(sums)}
+	a = newApp(signer.PublicKey, signed)
+	if _, err := a.nativeBinary(ctx, "", ""); err != nil {
+		t.Errorf("nativeBinary() signed = %v", err)
+	}
+	signed[name+".sha256"+release.SignatureSuffix] = releasetest.NewSigner().Sign(sums)
+	if _, err := a.nativeBinary(ctx, "", ""); !errors.Is(err, release.ErrBadSignature) || errs.KindOf(err) != errs.Invalid {
+		t.Errorf("nativeBinary() signed by another key = %v, want Invalid ErrBadSignature", err)
+	}
+
+	// a patch from the running version is preferred, if the result checks out
+	current := filepath.Join(t.TempDir(), "current")
+	os.WriteFile(current, []byte("hello sprout, version 1.0.0 of the binary\n"), 0o755)
+	patched := []byte("hello sprout, version 1.1.0 of the binary, now with patches\n")
+	patch, _ := hex.DecodeString(patchHex)
+	assets := map[string][]byte{
+		name:                               gz.Bytes(),
+		release.PatchAsset(name, "v1.0.0"): patch,
+		release.RawChecksumAsset(name):     []byte(releasetest.Checksum(patched) + "  linux-amd64\n"),
+	}
+	a = newApp("", assets)
+	if got, err := a.nativeBinary(ctx, "", current); err != nil || !bytes.Equal(got, patched) {
+		t.Errorf("nativeBinary() with patch = %q, %v", got, err)
+	}
+	assets[release.RawChecksumAsset(name)] = []byte(releasetest.Checksum(bin) + "  linux-amd64\n")
+	if got, err := a.nativeBinary(ctx, "", current); err != nil || !bytes.Equal(got, bin) {
+		t.Errorf("nativeBinary() with mismatching patch = %q, %v, want the whole binary", got, err)
+	}
+
+	// the new binary migrates under the exclusive lock, failures are reported
+	dir := t.TempDir()
+	a.guard, err = os.Create(filepath.Join(dir, LockFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer a.guard.Close()
+	exe := filepath.Join(dir, "app")
+	os.WriteFile(exe, []byte("#!/bin/sh\n[ \"$1\" = -m ] && echo migrated > \"$(dirname \"$0\")/out\"\n"), 0o755)
+	if err := a.migrateExclusive(ctx, exe); err != nil {
+		t.Fatalf("migrateExclusive() = %v", err)
+	}
+	if out, _ := os.ReadFile(filepath.Join(dir, "out")); string(out) != "migrated\n" {
+		t.Errorf("migrator not run with -m, got %q", out)
+	}
+	os.WriteFile(exe, []byte("#!/bin/sh\necho schema too new; exit 1\n"), 0o755)
+	if err := a.migrateExclusive(ctx, exe); err == nil || !strings.Contains(err.Error(), "schema too new") {
+		t.Errorf("failing migration = %v", err)
+	}
+}
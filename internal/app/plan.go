@@ -0,0 +1,97 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sprout/internal/platform/release"
+	"sprout/pkg/errs"
+	"time"
+)
+
+// UpdatePlan is what an update would do, see [App.PlanUpdate].
+type UpdatePlan struct {
+	Current string
+	Target  string // version that would be installed
+	Channel string // channel Target was resolved from, "" for a pinned version
+	Method  string // UpdateMethodScript or UpdateMethodNative
+	// release files that would be downloaded. Native updates only
+	// fetch the whole binary if the patch is missing or doesn't apply.
+	Fetch       []string
+	InstallPath string // binary that would be replaced
+	Instances   []int  // PIDs of the running instances that would get SIGTERM
+	Service     bool   // the service is running and would be restarted
+}
+
+// PlanUpdate resolves what updating to version ("" = the channel's latest)
+// would do, without downloading or changing anything. native picks the
+// native method regardless of the config.
+func (a *App) PlanUpdate(ctx context.Context, version string, native bool) (UpdatePlan, error) {
+	if a.UpdatesDisabled() {
+		return UpdatePlan{}, ErrDevBuild
+	}
+	p := UpdatePlan{Current: a.buildInfo.Version, Target: version, Method: UpdateMethodScript}
+	if native || a.nativeUpdates() {
+		p.Method = UpdateMethodNative
+	}
+
+	fCtx, fCancel := context.WithTimeout(ctx, 30*time.Second)
+	defer fCancel()
+	var assetURL string
+	if version != "" {
+		if err := release.FindVersion(fCtx, a.ReleaseSource, a.buildInfo.ReleaseURL, version); errors.Is(err, release.ErrUnknownVersion) {
+			return UpdatePlan{}, errs.Wrap(errs.NotFound, err, version+" was never published")
+		} else if err != nil {
+			return UpdatePlan{}, errs.Wrap(errs.Unavailable, err, "failed to reach release source")
+		}
+		assetURL = release.VersionURL(a.buildInfo.ReleaseURL, version)
+	} else {
+		latest, err := a.latestRelease()
+		if err != nil {
+			return UpdatePlan{}, errs.Wrap(errs.Unavailable, err, "failed to resolve the latest release")
+		}
+		p.Target, p.Channel = latest.Version, latest.Channel
+		assetURL = release.ChannelURL(a.buildInfo.ReleaseURL, latest.Channel)
+	}
+
+	// signed files are followed by their signature, as they're checked
+	signed := func(url string) []string {
+		if a.verifiesSignatures() {
+			return []string{url, url + release.SignatureSuffix}
+		}
+		return []string{url}
+	}
+	if p.Method == UpdateMethodNative {
+		bin := release.BinaryAssetFor(runtime.GOOS, runtime.GOARCH)
+		p.Fetch = append(p.Fetch, assetURL+release.PatchAsset(bin, a.buildInfo.Version))
+		p.Fetch = append(p.Fetch, signed(assetURL+release.RawChecksumAsset(bin))...)
+		p.Fetch = append(p.Fetch, assetURL+bin)
+		p.Fetch = append(p.Fetch, signed(assetURL+bin+".sha256")...)
+
+		exe, err := executablePath()
+		if err != nil {
+			return UpdatePlan{}, err
+		}
+		p.InstallPath = exe
+	} else {
+		p.Fetch = append(p.Fetch, signed(a.buildInfo.ReleaseURL+release.InstallScript)...)
+		p.Fetch = append(p.Fetch, a.buildInfo.ReleaseURL+release.InstallScript+".sha256")
+		p.Fetch = append(p.Fetch, assetURL+release.BinaryAsset)
+		p.Fetch = append(p.Fetch, signed(assetURL+release.BinaryAsset+".sha256")...)
+
+		// where install.sh puts it
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return UpdatePlan{}, err
+		}
+		p.InstallPath = filepath.Join(home, ".local", "bin", a.buildInfo.Name)
+		if resolved, err := filepath.EvalSymlinks(p.InstallPath); err == nil {
+			p.InstallPath = resolved
+		}
+	}
+	p.Instances = a.instancesOf(p.InstallPath)
+	p.Service = a.serviceActive()
+	return p, nil
+}
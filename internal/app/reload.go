@@ -0,0 +1,127 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sprout/internal/platform/database/config"
+	"sprout/internal/types"
+	"sprout/pkg/x"
+	"sync"
+	"syscall"
+)
+
+// ReloadFunc applies a configuration change to a running subsystem. prev is
+// the configuration the last reload (or Init) applied, compare the settings
+// the subsystem uses rather than acting on every change.
+type ReloadFunc func(prev, next *types.Configuration) error
+
+type reloadHandler struct {
+	name    string
+	fn      ReloadFunc
+	applied *types.Configuration // the last configuration fn applied, nil for reloader.applied
+}
+
+// reloader is the state behind OnReload / Reload.
+type reloader struct {
+	mu       sync.Mutex // held while applying, reloads don't overlap
+	handlers []*reloadHandler
+	applied  *types.Configuration // the last configuration every handler applied
+}
+
+// OnReload registers fn to apply configuration changes without a restart, see
+// Reload. Handlers run in registration order.
+func (a *App) OnReload(name string, fn ReloadFunc) {
+	a.reload.mu.Lock()
+	defer a.reload.mu.Unlock()
+	a.reload.handlers = append(a.reload.handlers, &reloadHandler{name: name, fn: fn})
+}
+
+// Reload hands cfg to the OnReload handlers. A failing handler is logged and
+// doesn't stop the others, the errors are returned joined. cfg only counts as
+// applied for the handlers that succeeded, a failed one gets the settings it
+// last applied as prev again on the next reload, so it's retried. Init
+// reloads on every config.Update in this process (e.g. the settings page),
+// ReloadOnSignal on SIGHUP for changes made elsewhere.
+func (a *App) Reload(cfg types.Configuration) error {
+	a.reload.mu.Lock()
+	defer a.reload.mu.Unlock()
+	var failed []error
+	for _, h := range a.reload.handlers {
+		prev := x.Ternary(h.applied != nil, h.applied, a.reload.applied)
+		if prev == nil {
+			prev = &cfg
+		}
+		if err := h.fn(prev, &cfg); err != nil {
+			a.Log.Errorf("Failed to reload %s: %v", h.name, err)
+			failed = append(failed, fmt.Errorf("%s: %w", h.name, err))
+			h.applied = prev
+			continue
+		}
+		h.applied = &cfg
+	}
+	if len(failed) > 0 {
+		return errors.Join(failed...)
+	}
+	// all caught up, handlers registered later start from here
+	a.reload.applied = &cfg
+	for _, h := range a.reload.handlers {
+		h.applied = nil
+	}
+	return nil
+}
+
+// ReloadFromStorage re-reads the config file and the database's config and
+// reloads them, for changes made by other processes (`service set`, `config
+// set`) or by editing the config file. An invalid config file is an error and
+// the one in use stays.
+func (a *App) ReloadFromStorage() error {
+	f, err := a.loadConfigFile()
+	if err != nil {
+		return err
+	}
+	config.UseFile(a.DB, f)
+	cfg, err := config.View(a.DB)
+	if err != nil {
+		return err
+	}
+	return a.Reload(*cfg)
+}
+
+// ReloadOnSignal calls ReloadFromStorage on SIGHUP until ctx is done, e.g.
+// `systemctl --user reload` or `kill -HUP`. Without it SIGHUP ends the
+// process, only `service run` listens for it.
+func (a *App) ReloadOnSignal(ctx context.Context) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP)
+	go func() {
+		defer signal.Stop(sig)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sig:
+				a.Log.Info("SIGHUP received, reloading configuration")
+				if err := a.ReloadFromStorage(); err != nil {
+					a.Log.Errorf("Failed to reload configuration: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// watchReload reloads after every config.Update of the database in this
+// process until ctx is done, starting from cfg.
+func (a *App) watchReload(ctx context.Context, cfg types.Configuration) {
+	a.reload.mu.Lock()
+	a.reload.applied = &cfg
+	a.reload.mu.Unlock()
+	changes := config.Watch(ctx, a.DB)
+	go func() {
+		for cfg := range changes {
+			_ = a.Reload(cfg) // logged
+		}
+	}()
+}
@@ -0,0 +1,140 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sprout/internal/build"
+	"sprout/internal/platform/database"
+	"sprout/internal/platform/database/config"
+	"sprout/internal/types"
+	"testing"
+	"time"
+
+	"github.com/Data-Corruption/stdx/xlog"
+)
+
+func TestReload(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger, err := xlog.New(filepath.Join(tmpDir, "logs"), "debug")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+	db, err := database.New(filepath.Join(tmpDir, "db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to create db: %v", err)
+	}
+	defer db.Close()
+	a := &App{DB: db, Log: logger, StorageDir: tmpDir, buildInfo: build.Info(), Context: context.Background()}
+
+	ports := make(chan [2]int, 4)
+	a.OnReload("port", func(prev, next *types.Configuration) error {
+		ports <- [2]int{prev.Port, next.Port}
+		return nil
+	})
+	a.OnReload("broken", func(prev, next *types.Configuration) error { return errors.New("nope") })
+
+	cfg, err := config.View(db)
+	if err != nil {
+		t.Fatalf("config.View() = %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	a.watchReload(ctx, *cfg)
+
+	// in-process updates reload, handlers see what changed
+	if err := config.Update(db, func(c *types.Configuration) error { c.Port = 9001; return nil }); err != nil {
+		t.Fatalf("config.Update() = %v", err)
+	}
+	select {
+	case got := <-ports:
+		if got != [2]int{cfg.Port, 9001} {
+			t.Errorf("port reload got %v, want [%d 9001]", got, cfg.Port)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no reload after config.Update")
+	}
+
+	// a failing handler is reported without stopping the others
+	if err := a.Reload(*cfg); err == nil {
+		t.Error("Reload() with a failing handler = nil")
+	}
+	if got := <-ports; got != [2]int{9001, cfg.Port} {
+		t.Errorf("port reload got %v, want [9001 %d]", got, cfg.Port)
+	}
+
+	// a reload from storage picks up the config file, an invalid one is refused
+	file := filepath.Join(tmpDir, config.FileName)
+	if err := os.WriteFile(file, []byte("port: 9002\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_ = a.ReloadFromStorage() // "broken" fails
+	if got := <-ports; got[1] != 9002 {
+		t.Errorf("port after reloading %s = %d, want 9002", config.FileName, got[1])
+	}
+	if err := os.WriteFile(file, []byte("port: 0\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.ReloadFromStorage(); err == nil {
+		t.Errorf("ReloadFromStorage() with invalid %s = nil", config.FileName)
+	}
+	if f := config.FileOf(db); f == nil || !f.Sets("port") {
+		t.Errorf("config file after invalid reload = %v, want the previous one", f)
+	}
+	config.UseFile(db, nil)
+}
+
+func TestReloadRetriesFailed(t *testing.T) {
+	logger, err := xlog.New(t.TempDir(), "none")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+	a := &App{Log: logger}
+
+	var moves, tries [][2]int
+	fail := true
+	a.OnReload("moves", func(prev, next *types.Configuration) error {
+		if prev.Port != next.Port {
+			moves = append(moves, [2]int{prev.Port, next.Port})
+		}
+		return nil
+	})
+	a.OnReload("flaky", func(prev, next *types.Configuration) error {
+		tries = append(tries, [2]int{prev.Port, next.Port})
+		if fail {
+			return errors.New("port in use")
+		}
+		return nil
+	})
+	cfg := types.DefaultConfig()
+	cfg.Port = 8080
+	if err := a.Reload(cfg); err == nil {
+		t.Fatal("first Reload() with a failing handler = nil")
+	}
+	cfg.Port = 9001
+	if err := a.Reload(cfg); err == nil {
+		t.Fatal("Reload() with a failing handler = nil")
+	}
+
+	// the failed change is retried, the applied one isn't redone
+	fail = false
+	if err := a.Reload(cfg); err != nil {
+		t.Fatalf("Reload() = %v", err)
+	}
+	if want := [][2]int{{8080, 8080}, {8080, 9001}, {8080, 9001}}; !slices.Equal(tries, want) {
+		t.Errorf("flaky handler got %v, want %v", tries, want)
+	}
+	if want := [][2]int{{8080, 9001}}; !slices.Equal(moves, want) {
+		t.Errorf("moves = %v, want %v", moves, want)
+	}
+
+	// caught up, the next change starts from it
+	cfg.Port = 9002
+	if err := a.Reload(cfg); err != nil || tries[len(tries)-1] != [2]int{9001, 9002} {
+		t.Errorf("Reload() = %v, flaky handler got %v", err, tries[len(tries)-1])
+	}
+}
@@ -0,0 +1,177 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sprout/internal/platform/backup"
+	"sprout/internal/types"
+	"sprout/pkg/errs"
+	"sprout/pkg/progress"
+	"time"
+)
+
+// PreRestoreSuffix is appended to the database dir (plus a timestamp) for
+// the copy a restore replaced.
+const PreRestoreSuffix = ".pre-restore-"
+
+// BackupOptions are the configured backup settings, for runs started by
+// trigger (see [backup.Options]).
+func (a *App) BackupOptions(bc types.BackupConfig, trigger string) (backup.Options, error) {
+	enc, err := backup.NewEncryption(bc.Encrypt, a.StorageDir)
+	if err != nil {
+		return backup.Options{}, fmt.Errorf("failed to set up backup encryption: %w", err)
+	}
+	return backup.Options{
+		Dir:        backup.Dir(a.StorageDir, bc.Dir),
+		App:        a.buildInfo.Name,
+		Version:    a.buildInfo.Version,
+		Trigger:    trigger,
+		Retention:  backup.Retention{KeepLast: bc.KeepLast, KeepDaily: bc.KeepDaily, KeepWeekly: bc.KeepWeekly},
+		Encryption: enc,
+	}, nil
+}
+
+// DeferRestore checks the backup archive at path (see [backup.Extract]) and
+// prepares it to replace the database on exit, once this process has closed
+// it. The service and other instances are stopped, the current database is
+// moved aside to db.pre-restore-<time> in the storage dir and the archive's
+// copy takes its place. This binary then migrates it to its schema (-m)
+// under the exclusive migration lock, putting the previous database back if
+// that fails, and the service is started again if it was running.
+//
+// check is called with what the archive holds before anything is prepared,
+// an error cancels the restore. Like [App.DeferUpdate], exit soon after.
+func (a *App) DeferRestore(path string, check func(*backup.Verification) error) error {
+	if a.Dev {
+		return errs.New(errs.Invalid, "dev mode works on a copy of the database, restore without --dev")
+	}
+	keys, err := backup.Keys(a.StorageDir)
+	if err != nil {
+		return fmt.Errorf("failed to load backup key: %w", err)
+	}
+	exe, err := executablePath()
+	if err != nil {
+		return err
+	}
+
+	// same filesystem as the database, so it's renamed into place
+	staged, err := os.MkdirTemp(a.StorageDir, ".restore-")
+	if err != nil {
+		return fmt.Errorf("failed to create restore dir: %w", err)
+	}
+	v, err := backup.Extract(path, keys, staged)
+	if err == nil && v.Manifest.App != a.buildInfo.Name {
+		err = errs.New(errs.Invalid, fmt.Sprintf("archive is from %q, not %s", v.Manifest.App, a.buildInfo.Name))
+	} else if err != nil {
+		err = errs.Wrap(errs.Invalid, err, fmt.Sprintf("%s is not a usable backup", filepath.Base(path)))
+	}
+	if err == nil {
+		err = check(v)
+	}
+	if err != nil {
+		os.RemoveAll(staged)
+		return err
+	}
+
+	wasActive := a.serviceActive()
+	if err := a.SetPostCleanup(func() error {
+		defer os.RemoveAll(staged)
+		return a.restore(staged, exe, wasActive)
+	}); err != nil {
+		os.RemoveAll(staged)
+		return err
+	}
+	return nil
+}
+
+// restore swaps the database in staged in, see [App.DeferRestore].
+func (a *App) restore(staged, exe string, wasActive bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), UpdateTimeout)
+	defer cancel()
+	p := progress.New(os.Stdout)
+	release, err := a.stopDatabaseUsers(ctx, p, exe, wasActive)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// swap, keeping the current database
+	dbDir := a.DBDir()
+	kept := dbDir + PreRestoreSuffix + time.Now().Format("20060102-150405")
+	if fi, err := os.Stat(dbDir); err == nil {
+		os.Chmod(staged, fi.Mode().Perm())
+	}
+	if err := os.Rename(dbDir, kept); err != nil {
+		return fmt.Errorf("failed to move current database aside: %w", err)
+	}
+	if err := os.Rename(staged, dbDir); err != nil {
+		if rbErr := os.Rename(kept, dbDir); rbErr != nil {
+			return fmt.Errorf("failed to move restored database into place: %w, and failed to put back the previous one (it's in %s): %w", err, kept, rbErr)
+		}
+		return fmt.Errorf("failed to move restored database into place: %w", err)
+	}
+
+	step := p.Step("Migrating restored database")
+	out, err := exec.CommandContext(ctx, exe, "-m").CombinedOutput()
+	if step.End(err) != nil {
+		err = fmt.Errorf("%s -m failed: %w: %s", exe, err, bytes.TrimSpace(out))
+		// the archive still has it, the restored copy goes with staged
+		if rbErr := os.Rename(dbDir, staged); rbErr != nil {
+			return fmt.Errorf("%w, and failed to put back the previous database (it's in %s): %w", err, kept, rbErr)
+		}
+		if rbErr := os.Rename(kept, dbDir); rbErr != nil {
+			return fmt.Errorf("%w, and failed to put back the previous database (it's in %s): %w", err, kept, rbErr)
+		}
+		return fmt.Errorf("%w, previous database put back", err)
+	}
+	fmt.Printf("Database restored, the previous one is kept in %s\n", kept)
+	return nil
+}
+
+// stopDatabaseUsers stops the service (if wasActive) and other instances of
+// exe, then waits for the exclusive migration lock, so nothing has the
+// database open until release is called. release unlocks and starts the
+// service again.
+func (a *App) stopDatabaseUsers(ctx context.Context, p *progress.Printer, exe string, wasActive bool) (release func(), err error) {
+	var undo []func()
+	release = func() {
+		for _, fn := range slices.Backward(undo) {
+			fn()
+		}
+	}
+	defer func() {
+		if err != nil {
+			release()
+		}
+	}()
+
+	if wasActive {
+		step := p.Step("Stopping service")
+		if out, err := a.systemctl(ctx, "stop"); step.End(err) != nil {
+			return nil, fmt.Errorf("failed to stop service: %w: %s", err, bytes.TrimSpace(out))
+		}
+		undo = append(undo, func() {
+			step := p.Step("Starting service")
+			if out, err := a.systemctl(ctx, "start"); step.End(err) != nil {
+				a.Log.Errorf("Failed to start service: %v: %s", err, bytes.TrimSpace(out))
+			}
+		})
+	}
+	a.stopInstances(exe)
+	lock, err := os.OpenFile(filepath.Join(a.RuntimeDir, LockFileName), os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open migration lock: %w", err)
+	}
+	undo = append(undo, func() { lock.Close() })
+	lCtx, lCancel := context.WithTimeout(ctx, 2*time.Minute)
+	defer lCancel()
+	if err := lockExclusiveCtx(lCtx, lock); err != nil {
+		return nil, fmt.Errorf("timeout waiting for other instances to exit: %w", err)
+	}
+	return release, nil
+}
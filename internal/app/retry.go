@@ -0,0 +1,126 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sprout/internal/platform/database/config"
+	"sprout/internal/platform/notify"
+	"sprout/internal/types"
+	"strconv"
+	"time"
+)
+
+const (
+	UpdateRetryBase  = 5 * time.Minute // wait after the first failure, doubled for each one after
+	UpdateRetryMax   = 6 * time.Hour   // longest wait between attempts
+	UpdateRetryLimit = 8               // failures in a row before retrying stops (until an update succeeds)
+)
+
+// RetryUpdate is run by `service run` every minute. It records how the last
+// detached update went (waiting for it if it's still running), then starts
+// another if a failed one is due. Retries back off exponentially from
+// [UpdateRetryBase] to [UpdateRetryMax] and stop after [UpdateRetryLimit]
+// failures in a row. Failures are kept in the config, so they're retried
+// after restarts too. Returns whether it started an update.
+func (a *App) RetryUpdate(ctx context.Context) (bool, error) {
+	if err := a.judgeUpdateRun(ctx); err != nil {
+		if errors.Is(err, context.Canceled) {
+			return false, nil
+		}
+		return false, err
+	}
+	if a.UpdatesDisabled() {
+		return false, nil
+	}
+	cfg, err := config.View(a.DB)
+	if err != nil {
+		return false, err
+	}
+	r := cfg.UpdateRetry
+	if r.Failures == 0 || r.Failures >= UpdateRetryLimit || time.Now().Before(r.NextAt) {
+		return false, nil
+	}
+	a.Log.Infof("Retrying update after %d failed attempt(s), last: %s", r.Failures, r.LastError)
+	if err := a.DetachUpdate(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// judgeUpdateRun records the outcome of the last detached update, once.
+func (a *App) judgeUpdateRun(ctx context.Context) error {
+	cfg, err := config.View(a.DB)
+	if err != nil {
+		return err
+	}
+	r, run := cfg.UpdateRetry, cfg.LastUpdateRun
+	if r.Failures > 0 && r.Version != a.buildInfo.Version {
+		// running another version, an update applied since (e.g. native or by hand)
+		return a.updateSucceeded()
+	}
+	if run.Started.IsZero() || r.Run.Equal(run.Started) {
+		return nil
+	}
+	res, err := a.FollowUpdate(ctx, "", func(UpdateLine) error { return nil })
+	if err != nil {
+		return fmt.Errorf("failed to follow update: %w", err)
+	}
+	if res.Failed {
+		a.updateFailed(res.Detail)
+		return nil
+	}
+	return a.updateSucceeded()
+}
+
+// updateSucceeded clears the failures. Like updateFailed it marks the last
+// detached update's outcome as recorded.
+func (a *App) updateSucceeded() error {
+	return config.Update(a.DB, func(cfg *types.Configuration) error {
+		cfg.UpdateRetry = types.UpdateRetry{Run: cfg.LastUpdateRun.Started}
+		return nil
+	})
+}
+
+// updateFailed records a failed update and schedules the next attempt. The
+// process wasn't replaced, so it may start another update.
+func (a *App) updateFailed(detail string) {
+	var r types.UpdateRetry
+	if err := config.Update(a.DB, func(cfg *types.Configuration) error {
+		r = cfg.UpdateRetry
+		r.Run = cfg.LastUpdateRun.Started // one that failed to start isn't followed
+		r.Failures++
+		r.LastError = detail
+		r.Version = a.buildInfo.Version
+		r.NextAt = time.Now().Add(updateRetryDelay(r.Failures))
+		cfg.UpdateRetry = r
+		return nil
+	}); err != nil {
+		a.Log.Errorf("Failed to record failed update: %v", err)
+	}
+
+	a.uMu.Lock()
+	a.uStarted = false
+	a.uMu.Unlock()
+
+	msg := fmt.Sprintf("%s, retrying at %s", detail, r.NextAt.Format(time.DateTime))
+	if r.Failures >= UpdateRetryLimit {
+		msg = fmt.Sprintf("%s, gave up after %d attempts", detail, r.Failures)
+	}
+	a.Log.Errorf("Update failed: %s", msg)
+	a.Notify.Dispatch(notify.Event{
+		Kind:    notify.EventUpdateFailed,
+		Title:   "Update failed",
+		Message: msg,
+		Fields:  map[string]string{"failures": strconv.Itoa(r.Failures), "version": r.Version},
+	})
+}
+
+// updateRetryDelay is the wait before retrying after failures updates failed in a row.
+func updateRetryDelay(failures int) time.Duration {
+	d := UpdateRetryBase
+	for i := 1; i < failures && d < UpdateRetryMax; i++ {
+		d *= 2
+	}
+	return min(d, UpdateRetryMax)
+}
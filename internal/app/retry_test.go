@@ -0,0 +1,103 @@
+package app
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sprout/internal/build"
+	"sprout/internal/platform/database"
+	"sprout/internal/platform/database/config"
+	"sprout/internal/testsupport/releasetest"
+	"sprout/internal/types"
+	"testing"
+	"time"
+
+	"github.com/Data-Corruption/stdx/xlog"
+)
+
+func TestUpdateRetry(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger, err := xlog.New(filepath.Join(tmpDir, "logs"), "debug")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+	db, err := database.New(filepath.Join(tmpDir, "db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to create db: %v", err)
+	}
+	defer db.Close()
+
+	bi := build.Info()
+	bi.Version = "v1.0.0"
+	bi.ServiceEnabled = false
+	bi.ReleaseURL = "https://download.example-app.com/release/"
+	a := &App{
+		DB:            db,
+		Log:           logger,
+		ReleaseSource: &releasetest.MockReleaseSource{LatestVersion: "v1.1.0"}, // no install script, updates fail to start
+		StorageDir:    tmpDir,
+		buildInfo:     bi,
+		Context:       context.Background(),
+	}
+	retry := func() types.UpdateRetry {
+		t.Helper()
+		cfg, err := config.View(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cfg.UpdateRetry
+	}
+
+	// a detached update that failed after starting
+	if err := os.WriteFile(filepath.Join(tmpDir, "update.log"), []byte("download failed\n--- update exited with status 1\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.Update(db, func(cfg *types.Configuration) error {
+		cfg.LastUpdateRun = types.UpdateRun{Started: time.Now()}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	a.uStarted = true
+	for range 2 { // recorded once
+		if started, err := a.RetryUpdate(t.Context()); started || err != nil {
+			t.Fatalf("RetryUpdate() = %t, %v, want not due yet", started, err)
+		}
+	}
+	if r := retry(); r.Failures != 1 || r.LastError != "exit status 1" || time.Until(r.NextAt) < UpdateRetryBase-time.Minute {
+		t.Errorf("after a failed run: %+v, want 1 failure retried in %v", r, UpdateRetryBase)
+	}
+	if a.uStarted {
+		t.Error("a failed update still blocks starting another")
+	}
+
+	// due, the retry fails to start
+	if err := config.Update(db, func(cfg *types.Configuration) error {
+		cfg.UpdateRetry.NextAt = time.Now().Add(-time.Second)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.RetryUpdate(t.Context()); err == nil {
+		t.Fatal("RetryUpdate() without an install script succeeded")
+	}
+	if r := retry(); r.Failures != 2 || time.Until(r.NextAt) < 2*UpdateRetryBase-time.Minute {
+		t.Errorf("after a failed retry: %+v, want 2 failures backing off", r)
+	}
+
+	// another version running means an update applied
+	a.buildInfo.Version = "v1.1.0"
+	if _, err := a.RetryUpdate(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+	if r := retry(); r.Failures != 0 {
+		t.Errorf("after updating: %+v, want failures cleared", r)
+	}
+
+	for failures, want := range map[int]time.Duration{1: UpdateRetryBase, 2: 2 * UpdateRetryBase, 3: 4 * UpdateRetryBase, UpdateRetryLimit: UpdateRetryMax} {
+		if got := updateRetryDelay(failures); got != want {
+			t.Errorf("updateRetryDelay(%d) = %v, want %v", failures, got, want)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"sprout/internal/platform/database/config"
+	"sprout/internal/types"
+	"sprout/pkg/errs"
+	"time"
+)
+
+// PrevBinarySuffix is appended to the app name for the binary install.sh
+// keeps in the storage dir when it replaces one with a different version.
+const PrevBinarySuffix = ".prev"
+
+// RollbackTarget is what [App.DeferRollback] installs.
+type RollbackTarget struct {
+	Version string // previously installed version
+	Binary  string // kept binary of that version, "" = download it instead
+}
+
+// PrevBinaryPath is where install.sh keeps the binary it last replaced.
+func (a *App) PrevBinaryPath() string {
+	return filepath.Join(a.StorageDir, a.buildInfo.Name+PrevBinarySuffix)
+}
+
+// recordVersion moves the installed version in cfg to PreviousVersion when
+// the running one differs, i.e. on the first run after an update or rollback.
+// Dev builds aren't recorded, they'd just get in the way of rolling back.
+func (a *App) recordVersion(cfg *types.Configuration) error {
+	if a.UpdatesDisabled() || cfg.InstalledVersion == a.buildInfo.Version {
+		return nil
+	}
+	return config.Update(a.DB, func(cfg *types.Configuration) error {
+		if cfg.InstalledVersion != "" && cfg.InstalledVersion != a.buildInfo.Version {
+			cfg.PreviousVersion = cfg.InstalledVersion
+		}
+		cfg.InstalledVersion = a.buildInfo.Version
+		return nil
+	})
+}
+
+// RollbackTarget returns the version installed before the running one, and
+// the kept binary if it's still there and reports that version.
+func (a *App) RollbackTarget() (RollbackTarget, error) {
+	cfg, err := config.View(a.DB)
+	if err != nil {
+		return RollbackTarget{}, fmt.Errorf("failed to view config: %w", err)
+	}
+	if cfg.PreviousVersion == "" {
+		return RollbackTarget{}, errs.New(errs.NotFound, "no previous version recorded, nothing to roll back to")
+	}
+	t := RollbackTarget{Version: cfg.PreviousVersion}
+	path := a.PrevBinaryPath()
+	if v, err := binaryVersion(a.Context, path); err == nil && v == t.Version {
+		t.Binary = path
+	} else if err != nil {
+		a.Log.Debugf("kept binary %s unusable, rollback will download %s: %v", path, t.Version, err)
+	}
+	return t, nil
+}
+
+// DeferRollback prepares the install script to reinstall t on exit, see
+// [App.DeferUpdate]. The version that's replaced becomes the next rollback
+// target, so rolling back twice returns to where you started.
+func (a *App) DeferRollback(t RollbackTarget) error {
+	return a.deferInstall(t.Version, func() (string, string) {
+		env, assetURL := a.updateEnv(t.Version)
+		if t.Binary == "" {
+			return env, assetURL
+		}
+		// the script knows where the kept binary lives, nothing is downloaded
+		return env + " INSTALL_PREV=true", ""
+	})
+}
+
+// binaryVersion asks the binary at path for its version.
+func binaryVersion(ctx context.Context, path string) (string, error) {
+	vCtx, vCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer vCancel()
+	out, err := exec.CommandContext(vCtx, path, "--build-vars").Output()
+	if err != nil {
+		return "", err
+	}
+	var bi struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(out, &bi); err != nil {
+		return "", fmt.Errorf("failed to parse build vars: %w", err)
+	}
+	return bi.Version, nil
+}
@@ -0,0 +1,111 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sprout/internal/platform/database/config"
+	"sprout/internal/types"
+	"sprout/pkg/errs"
+	"strings"
+
+	"github.com/urfave/cli/v3"
+)
+
+func init() {
+	types.AddSchemaHint("updateMethod", types.SchemaHint{Enum: []string{"", UpdateMethodScript, UpdateMethodNative}})
+	types.AddValidator(func(c *types.Configuration) (e types.FieldErrors) {
+		if c.UpdateMethod != "" && c.UpdateMethod != UpdateMethodScript && c.UpdateMethod != UpdateMethodNative {
+			e = append(e, types.FieldError{Field: "updateMethod", Message: fmt.Sprintf("%q isn't a method, want %s or %s", c.UpdateMethod, UpdateMethodScript, UpdateMethodNative)})
+		}
+		if c.UpdateWindow != "" {
+			if _, err := ParseUpdateWindow(c.UpdateWindow); err != nil {
+				e = append(e, types.FieldError{Field: "updateWindow", Message: err.Error()})
+			}
+		}
+		return e
+	})
+}
+
+// flagSettings are the global flags that set a setting for one run, by flag
+// name, see useFlags. --log isn't one, it sets the logger's level rather
+// than the setting (and takes "none").
+var flagSettings = map[string]string{
+	"port": "port",
+}
+
+// useFlags layers the settings set with global flags (flagSettings) over the
+// config file's and the environment's, after validating them.
+func (a *App) useFlags(cmd *cli.Command) error {
+	values := map[string]string{}
+	for name, key := range flagSettings {
+		if cmd.IsSet(name) {
+			values[key] = fmt.Sprint(cmd.Value(name))
+		}
+	}
+	f, err := config.LoadFlags(values)
+	if err == nil {
+		err = a.checkLayer(f)
+	}
+	if err != nil {
+		return err
+	}
+	config.UseFlags(a.DB, f)
+	a.AddCleanup(func() error {
+		config.UseFlags(a.DB, nil)
+		return nil
+	})
+	return nil
+}
+
+// useConfigFile layers the config file in the storage dir (config.FileName)
+// and then the settings in the environment (config.LoadEnv) over the
+// database's config, after validating the values they set.
+func (a *App) useConfigFile() error {
+	f, err := a.loadConfigFile()
+	if err != nil {
+		return err
+	}
+	env, err := config.LoadEnv(config.EnvPrefix(a.buildInfo.Name), os.LookupEnv)
+	if err == nil {
+		err = a.checkLayer(env)
+	}
+	if err != nil {
+		return err
+	}
+	config.UseFile(a.DB, f)
+	config.UseEnv(a.DB, env)
+	// also drops one a reload picked up later, see ReloadFromStorage
+	a.AddCleanup(func() error {
+		config.UseFile(a.DB, nil)
+		config.UseEnv(a.DB, nil)
+		return nil
+	})
+	return nil
+}
+
+// loadConfigFile reads and validates the config file, nil if there's none.
+func (a *App) loadConfigFile() (*config.File, error) {
+	f, err := config.LoadFile(filepath.Join(a.StorageDir, config.FileName))
+	if err != nil {
+		return nil, err
+	}
+	return f, a.checkLayer(f)
+}
+
+// checkLayer validates the values f (the config file, the environment's or
+// the flags' settings) sets, nil is fine.
+func (a *App) checkLayer(f *config.File) error {
+	if f == nil {
+		return nil
+	}
+	cfg := types.DefaultConfig()
+	if err := f.Apply(&cfg); err != nil {
+		return err
+	}
+	if fe := cfg.Validate().For(f.Keys...); fe != nil {
+		return errs.Wrap(errs.Invalid, fe, "invalid settings in "+f.Path)
+	}
+	a.Log.Infof("Settings from %s: %s", f.Path, strings.Join(f.Keys, ", "))
+	return nil
+}
@@ -0,0 +1,19 @@
+package app
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// instanceRuns reports whether pid is running the binary at exe. There's no
+// /proc, ps reports the path it was started from.
+func instanceRuns(pid int, exe string) bool {
+	out, err := exec.Command("ps", "-o", "comm=", "-p", strconv.Itoa(pid)).Output()
+	if err != nil {
+		return false
+	}
+	path, err := filepath.EvalSymlinks(strings.TrimSpace(string(out)))
+	return err == nil && path == exe
+}
@@ -0,0 +1,14 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// instanceRuns reports whether pid is running the binary at exe.
+func instanceRuns(pid int, exe string) bool {
+	// the old binary was replaced, so its instances show as deleted
+	link, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+	return err == nil && strings.TrimSuffix(link, " (deleted)") == exe
+}
@@ -0,0 +1,57 @@
+//go:build unix
+
+package app
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// lockShared takes a shared flock on f, or turns an exclusive one shared.
+func lockShared(f *os.File) error {
+	return unix.Flock(int(f.Fd()), unix.LOCK_SH)
+}
+
+// tryLockExclusive upgrades the lock on f to exclusive, false if another
+// process holds it.
+func tryLockExclusive(f *os.File) (bool, error) {
+	err := unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+	if errors.Is(err, unix.EWOULDBLOCK) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// terminate asks pid to shut down.
+func terminate(pid int) error {
+	return syscall.Kill(pid, syscall.SIGTERM)
+}
+
+// detachedProcAttr starts a process in its own session, so it outlives this one.
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
+
+// shellCommand runs command with the system shell.
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
+// swapBinary atomically replaces exe with newBin, keeping a hard link to the
+// old one at oldBin.
+func swapBinary(exe, newBin, oldBin string) error {
+	os.Remove(oldBin)
+	if err := os.Link(exe, oldBin); err != nil {
+		return err
+	}
+	if err := os.Rename(newBin, exe); err != nil {
+		os.Remove(oldBin)
+		return err
+	}
+	return nil
+}
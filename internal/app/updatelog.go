@@ -0,0 +1,221 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sprout/internal/platform/database/config"
+	"sprout/internal/types"
+	"sprout/pkg/errs"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// updateExitMarker prefixes the exit status appended to update.log.
+	updateExitMarker = "--- update exited with status "
+	// followInterval is how often FollowUpdate looks for new output.
+	followInterval = 500 * time.Millisecond
+	// unitStartGrace is how long an inactive update unit is assumed to be
+	// queued rather than finished, systemd-run doesn't wait for it to start.
+	unitStartGrace = 30 * time.Second
+)
+
+// ErrNoUpdateRun means there's no detached update to follow.
+var ErrNoUpdateRun = errs.New(errs.NotFound, "no detached update has run")
+
+// UpdateLine is a line of a detached update's output.
+type UpdateLine struct {
+	ID   string // pass as after to [App.FollowUpdate] to resume past this line
+	Text string
+}
+
+// UpdateResult is how a detached update ended.
+type UpdateResult struct {
+	Failed bool   `json:"failed"`
+	Detail string `json:"detail"` // systemd's result or the exit status
+}
+
+// recordUpdateRun records where the detached update about to start writes its
+// output, for [App.FollowUpdate].
+func (a *App) recordUpdateRun(unitName, logPath string) error {
+	run := types.UpdateRun{Started: time.Now()}
+	if a.buildInfo.ServiceEnabled {
+		run.Unit = unitName
+	} else if fi, err := os.Stat(logPath); err == nil {
+		run.LogOffset = fi.Size()
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to stat update log: %w", err)
+	}
+	return config.Update(a.DB, func(cfg *types.Configuration) error {
+		cfg.LastUpdateRun = run
+		return nil
+	})
+}
+
+// FollowUpdate calls fn with each output line of the last detached update
+// ([App.DetachUpdate]) after the line with ID after, "" = from the start. It
+// returns once the update has exited, or with ctx's error. Output is read from
+// the journal of the update's transient unit for builds with a service,
+// update.log otherwise.
+//
+// The update usually restarts this process, so followers resume with the ID
+// of the last line they got once the new version is up.
+func (a *App) FollowUpdate(ctx context.Context, after string, fn func(UpdateLine) error) (UpdateResult, error) {
+	cfg, err := config.View(a.DB)
+	if err != nil {
+		return UpdateResult{}, err
+	}
+	run := cfg.LastUpdateRun
+	switch {
+	case run.Started.IsZero():
+		return UpdateResult{}, ErrNoUpdateRun
+	case run.Unit != "":
+		return a.followJournal(ctx, run, after, fn)
+	default:
+		offset := run.LogOffset
+		if after != "" {
+			if offset, err = strconv.ParseInt(after, 10, 64); err != nil || offset < run.LogOffset {
+				return UpdateResult{}, errs.New(errs.Invalid, "invalid update log position")
+			}
+		}
+		return a.followLog(ctx, run, offset, fn)
+	}
+}
+
+// followJournal follows run's unit in the user journal, line IDs are journal cursors.
+func (a *App) followJournal(ctx context.Context, run types.UpdateRun, cursor string, fn func(UpdateLine) error) (UpdateResult, error) {
+	var seen bool
+	for {
+		// state first, so output written before the unit exited is still read below
+		state, result, err := unitState(ctx, run.Unit)
+		if err != nil {
+			return UpdateResult{}, err
+		}
+		args := []string{"--user", "-u", run.Unit, "-o", "json", "--no-pager", "-q"}
+		if cursor != "" {
+			args = append(args, "--after-cursor="+cursor)
+		}
+		out, err := exec.CommandContext(ctx, "journalctl", args...).Output()
+		if err != nil {
+			return UpdateResult{}, fmt.Errorf("failed to read journal: %w", err)
+		}
+		for _, line := range bytes.Split(out, []byte("\n")) {
+			var e struct {
+				Cursor  string          `json:"__CURSOR"`
+				Message json.RawMessage `json:"MESSAGE"`
+			}
+			if len(line) == 0 || json.Unmarshal(line, &e) != nil || e.Cursor == "" {
+				continue
+			}
+			cursor, seen = e.Cursor, true
+			if err := fn(UpdateLine{ID: e.Cursor, Text: journalText(e.Message)}); err != nil {
+				return UpdateResult{}, err
+			}
+		}
+
+		switch {
+		case state == "failed":
+			return UpdateResult{Failed: true, Detail: result}, nil
+		case state == "inactive" && (seen || time.Since(run.Started) > unitStartGrace):
+			return UpdateResult{Failed: result != "success", Detail: result}, nil
+		case time.Since(run.Started) > UpdateTimeout+unitStartGrace:
+			return UpdateResult{Failed: true, Detail: "timed out"}, nil
+		}
+		if err := sleepCtx(ctx, followInterval); err != nil {
+			return UpdateResult{}, err
+		}
+	}
+}
+
+// unitState returns a user unit's ActiveState and Result. Units that finished
+// and were garbage collected read as inactive / success.
+func unitState(ctx context.Context, unit string) (state, result string, err error) {
+	out, err := exec.CommandContext(ctx, "systemctl", "--user", "show", "-p", "ActiveState", "-p", "Result", unit).Output()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get unit state: %w", err)
+	}
+	for _, line := range strings.Split(string(out), "\n") {
+		k, v, _ := strings.Cut(line, "=")
+		switch k {
+		case "ActiveState":
+			state = v
+		case "Result":
+			result = v
+		}
+	}
+	return state, result, nil
+}
+
+// journalText decodes a journal MESSAGE, a string or, if it isn't valid UTF-8,
+// an array of bytes.
+func journalText(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var b []byte
+	var ints []int
+	if json.Unmarshal(raw, &ints) == nil {
+		for _, i := range ints {
+			b = append(b, byte(i))
+		}
+	}
+	return strings.ToValidUTF8(string(b), "�")
+}
+
+// followLog follows update.log from offset, line IDs are the offset after the line.
+func (a *App) followLog(ctx context.Context, run types.UpdateRun, offset int64, fn func(UpdateLine) error) (UpdateResult, error) {
+	f, err := os.Open(filepath.Join(a.StorageDir, "update.log"))
+	if err != nil {
+		return UpdateResult{}, fmt.Errorf("failed to open update log: %w", err)
+	}
+	defer f.Close()
+	for {
+		if _, err := f.Seek(offset, io.SeekStart); err != nil {
+			return UpdateResult{}, fmt.Errorf("failed to seek update log: %w", err)
+		}
+		r := bufio.NewReader(f)
+		for {
+			line, err := r.ReadString('\n')
+			if err == io.EOF {
+				break // partial lines are read again once complete
+			} else if err != nil {
+				return UpdateResult{}, fmt.Errorf("failed to read update log: %w", err)
+			}
+			offset += int64(len(line))
+			text := strings.TrimRight(line, "\r\n")
+			if status, ok := strings.CutPrefix(text, updateExitMarker); ok {
+				return UpdateResult{Failed: status != "0", Detail: "exit status " + status}, nil
+			}
+			if err := fn(UpdateLine{ID: strconv.FormatInt(offset, 10), Text: text}); err != nil {
+				return UpdateResult{}, err
+			}
+		}
+		if time.Since(run.Started) > UpdateTimeout+unitStartGrace {
+			return UpdateResult{Failed: true, Detail: "no exit status recorded"}, nil
+		}
+		if err := sleepCtx(ctx, followInterval); err != nil {
+			return UpdateResult{}, err
+		}
+	}
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
@@ -0,0 +1,127 @@
+package app
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UpdateWindow is a recurring maintenance window updates may be applied in,
+// see [ParseUpdateWindow]. The zero value is no window.
+type UpdateWindow struct {
+	start, end int   // minutes since midnight, end <= start = crosses midnight
+	days       uint8 // weekday bit set (Sunday = bit 0), of the day the window opens
+	spec       string
+}
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// ParseUpdateWindow parses "HH:MM-HH:MM [days]", in local time. Days are
+// comma separated weekdays or ranges (e.g. "Sat", "Sat,Sun", "Mon-Fri"),
+// omitted = every day. A window ending before it starts crosses midnight, its
+// days being the ones it opens on. "" parses to the zero window.
+func ParseUpdateWindow(spec string) (UpdateWindow, error) {
+	fields := strings.Fields(spec)
+	if len(fields) == 0 {
+		return UpdateWindow{}, nil
+	}
+	if len(fields) > 2 {
+		return UpdateWindow{}, fmt.Errorf("update window %q: expected \"HH:MM-HH:MM [days]\"", spec)
+	}
+	w := UpdateWindow{spec: spec, days: 1<<7 - 1}
+	from, to, ok := strings.Cut(fields[0], "-")
+	if !ok {
+		return UpdateWindow{}, fmt.Errorf("update window %q: expected a time range", spec)
+	}
+	var err error
+	if w.start, err = parseClock(from); err != nil {
+		return UpdateWindow{}, fmt.Errorf("update window %q: %w", spec, err)
+	}
+	if w.end, err = parseClock(to); err != nil {
+		return UpdateWindow{}, fmt.Errorf("update window %q: %w", spec, err)
+	}
+	if w.start == w.end {
+		return UpdateWindow{}, fmt.Errorf("update window %q: empty time range", spec)
+	}
+	if len(fields) == 2 {
+		if w.days, err = parseWeekdays(fields[1]); err != nil {
+			return UpdateWindow{}, fmt.Errorf("update window %q: %w", spec, err)
+		}
+	}
+	return w, nil
+}
+
+func parseClock(s string) (int, error) {
+	h, m, ok := strings.Cut(s, ":")
+	hour, errH := strconv.Atoi(h)
+	minute, errM := strconv.Atoi(m)
+	if !ok || errH != nil || errM != nil || hour < 0 || hour > 23 || minute < 0 || minute > 59 {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return hour*60 + minute, nil
+}
+
+func parseWeekdays(s string) (uint8, error) {
+	day := func(name string) (int, error) {
+		for i, d := range weekdays {
+			if strings.EqualFold(name, d) {
+				return i, nil
+			}
+		}
+		return 0, fmt.Errorf("invalid weekday %q", name)
+	}
+	var set uint8
+	for _, part := range strings.Split(s, ",") {
+		lo, hi, isRange := strings.Cut(part, "-")
+		first, err := day(lo)
+		if err != nil {
+			return 0, err
+		}
+		last := first
+		if isRange {
+			if last, err = day(hi); err != nil {
+				return 0, err
+			}
+		}
+		for d := first; ; d = (d + 1) % 7 { // ranges may wrap, e.g. Sat-Sun
+			set |= 1 << d
+			if d == last {
+				break
+			}
+		}
+	}
+	return set, nil
+}
+
+// IsZero reports whether w is no window.
+func (w UpdateWindow) IsZero() bool { return w.spec == "" }
+
+func (w UpdateWindow) String() string { return w.spec }
+
+// Contains reports whether t is inside the window.
+func (w UpdateWindow) Contains(t time.Time) bool {
+	if w.IsZero() {
+		return false
+	}
+	m := t.Hour()*60 + t.Minute()
+	on := func(d time.Weekday) bool { return w.days&(1<<d) != 0 }
+	if w.start < w.end {
+		return on(t.Weekday()) && m >= w.start && m < w.end
+	}
+	return (on(t.Weekday()) && m >= w.start) || (on((t.Weekday()+6)%7) && m < w.end)
+}
+
+// Cron returns the cron expression for the window opening (see pkg/cron).
+func (w UpdateWindow) Cron() string {
+	if w.days == 1<<7-1 {
+		return fmt.Sprintf("%d %d * * *", w.start%60, w.start/60)
+	}
+	var days []string
+	for d := range 7 {
+		if w.days&(1<<d) != 0 {
+			days = append(days, strconv.Itoa(d))
+		}
+	}
+	return fmt.Sprintf("%d %d * * %s", w.start%60, w.start/60, strings.Join(days, ","))
+}
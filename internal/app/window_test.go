@@ -0,0 +1,65 @@
+package app
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUpdateWindow(t *testing.T) {
+	at := func(day, clock string) time.Time {
+		tm, err := time.ParseInLocation("2006-01-02 15:04", day+" "+clock, time.Local)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	// 2026-10-17 is a Saturday
+	tests := []struct {
+		spec string
+		cron string
+		in   []time.Time
+		out  []time.Time
+	}{
+		{"03:00-05:00 Sat", "0 3 * * 6",
+			[]time.Time{at("2026-10-17", "03:00"), at("2026-10-17", "04:59")},
+			[]time.Time{at("2026-10-17", "05:00"), at("2026-10-17", "02:59"), at("2026-10-18", "04:00")}},
+		{"22:30-01:00 mon-fri", "30 22 * * 1,2,3,4,5",
+			[]time.Time{at("2026-10-16", "23:00"), at("2026-10-17", "00:30"), at("2026-10-12", "22:30")},
+			[]time.Time{at("2026-10-17", "23:00"), at("2026-10-12", "00:30"), at("2026-10-16", "01:00")}},
+		{"Sat-Sun", "", nil, nil},
+		{"02:00-02:00", "", nil, nil},
+		{"02:00-04:00 Fri,Sat-Sun", "0 2 * * 0,5,6", []time.Time{at("2026-10-18", "03:00")}, []time.Time{at("2026-10-15", "03:00")}},
+		{"01:15-01:45", "15 1 * * *", []time.Time{at("2026-10-14", "01:30")}, []time.Time{at("2026-10-14", "01:45")}},
+		{"25:00-26:00", "", nil, nil},
+	}
+	for _, tt := range tests {
+		w, err := ParseUpdateWindow(tt.spec)
+		if tt.cron == "" {
+			if err == nil {
+				t.Errorf("ParseUpdateWindow(%q) succeeded, want an error", tt.spec)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseUpdateWindow(%q) = %v", tt.spec, err)
+			continue
+		}
+		if got := w.Cron(); got != tt.cron {
+			t.Errorf("%q: Cron() = %q, want %q", tt.spec, got, tt.cron)
+		}
+		for _, tm := range tt.in {
+			if !w.Contains(tm) {
+				t.Errorf("%q doesn't contain %s", tt.spec, tm.Format("Mon 15:04"))
+			}
+		}
+		for _, tm := range tt.out {
+			if w.Contains(tm) {
+				t.Errorf("%q contains %s", tt.spec, tm.Format("Mon 15:04"))
+			}
+		}
+	}
+
+	if w, err := ParseUpdateWindow(""); err != nil || !w.IsZero() || w.Contains(time.Now()) {
+		t.Errorf("empty window = %v, %v", w, err)
+	}
+}
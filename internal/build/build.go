@@ -1,9 +1,19 @@
 // Package build provides build-time information about the application.
+//
+// App settings (name, release URL, ...) are injected by build.sh via ldflags.
+// Everything the go tool records itself (VCS commit, Go version, module
+// version) comes from debug.ReadBuildInfo, so it needn't be injected.
 package build
 
 import (
 	"encoding/json"
+	"runtime/debug"
 	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
 )
 
 // set by build.sh
@@ -11,24 +21,35 @@ var (
 	name               string
 	version            string
 	releaseURL         string
+	releaseSource      string
 	contactURL         string
 	defaultLogLevel    string
 	serviceEnabled     string
 	serviceDesc        string
 	serviceArgs        string
 	serviceDefaultPort string
+	signingKey         string
 )
 
 type BuildInfo struct {
 	Name               string `json:"name"`
 	Version            string `json:"version"`
 	ReleaseURL         string `json:"releaseURL"`
+	ReleaseSource      string `json:"releaseSource"` // how ReleaseURL is read, "static" or "manifest" (see release.SourceStatic)
 	ContactURL         string `json:"contactURL"`
 	DefaultLogLevel    string `json:"defaultLogLevel"`
 	ServiceEnabled     bool   `json:"serviceEnabled"`
 	ServiceDesc        string `json:"serviceDesc"`
 	ServiceArgs        string `json:"serviceArgs"`
 	ServiceDefaultPort int    `json:"serviceDefaultPort"`
+	SigningKey         string `json:"signingKey"` // minisign public key releases are verified with, "" = checksums only
+
+	// from debug.ReadBuildInfo
+	GoVersion     string    `json:"goVersion"`
+	ModuleVersion string    `json:"moduleVersion"`       // main module version per the go tool, "(devel)" for local builds without VCS info
+	Commit        string    `json:"commit,omitempty"`    // VCS revision
+	CommitTime    time.Time `json:"commitTime,omitzero"` // of Commit, stands in for build time since it's reproducible
+	Dirty         bool      `json:"dirty,omitempty"`     // built with uncommitted changes
 }
 
 // PrintJSON prints the build info as JSON to stdout
@@ -46,20 +67,57 @@ func Info() BuildInfo {
 		// fallback to 8080
 		port = 8080
 	}
+	source := releaseSource
+	if source == "" {
+		// fallback to the static layout
+		source = "static"
+	}
 	logLevel := defaultLogLevel
 	if logLevel == "" {
 		// fallback to DEBUG
 		logLevel = "DEBUG"
 	}
-	return BuildInfo{
+	bi := BuildInfo{
 		Name:               name,
 		Version:            version,
 		ReleaseURL:         releaseURL,
+		ReleaseSource:      source,
 		ContactURL:         contactURL,
 		DefaultLogLevel:    logLevel,
 		ServiceEnabled:     serviceEnabled == "true",
 		ServiceDesc:        serviceDesc,
 		ServiceArgs:        serviceArgs,
 		ServiceDefaultPort: port,
+		SigningKey:         signingKey,
+	}
+	if info := readBuildInfo(); info != nil {
+		merge(&bi, info)
+	}
+	return bi
+}
+
+var readBuildInfo = sync.OnceValue(func() *debug.BuildInfo {
+	info, _ := debug.ReadBuildInfo()
+	return info
+})
+
+// merge fills in what the go tool recorded. An injected version wins, without
+// one a clean release version of the main module is used (e.g. when built from
+// a tagged checkout), since pseudo / dirty versions aren't valid for updates.
+func merge(bi *BuildInfo, info *debug.BuildInfo) {
+	bi.GoVersion = info.GoVersion
+	bi.ModuleVersion = info.Main.Version
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			bi.Commit = s.Value
+		case "vcs.time":
+			bi.CommitTime, _ = time.Parse(time.RFC3339, s.Value)
+		case "vcs.modified":
+			bi.Dirty = s.Value == "true"
+		}
+	}
+	if v := info.Main.Version; bi.Version == "" && semver.IsValid(v) && semver.Build(v) == "" && !module.IsPseudoVersion(v) {
+		bi.Version = v
 	}
 }
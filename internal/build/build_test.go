@@ -0,0 +1,41 @@
+package build
+
+import (
+	"runtime/debug"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	info := func(version string, settings ...debug.BuildSetting) *debug.BuildInfo {
+		return &debug.BuildInfo{GoVersion: "go1.24.0", Main: debug.Module{Path: "sprout", Version: version}, Settings: settings}
+	}
+	vcs := []debug.BuildSetting{
+		{Key: "vcs.revision", Value: "abc123"},
+		{Key: "vcs.time", Value: "2025-01-02T03:04:05Z"},
+		{Key: "vcs.modified", Value: "true"},
+	}
+
+	var bi BuildInfo
+	merge(&bi, info("(devel)", vcs...))
+	if bi.Commit != "abc123" || !bi.Dirty || bi.CommitTime.Year() != 2025 || bi.GoVersion != "go1.24.0" {
+		t.Errorf("vcs fields not merged: %+v", bi)
+	}
+
+	tests := []struct {
+		injected, module, want string
+	}{
+		{"v1.0.0", "v2.0.0", "v1.0.0"},                         // injected wins
+		{"", "v1.2.3", "v1.2.3"},                               // clean tag
+		{"", "v1.2.3+dirty", ""},                               // uncommitted changes
+		{"", "v0.0.0-20250102030405-abcdefabcdef", ""},         // pseudo-version
+		{"", "v1.2.4-0.20250102030405-abcdefabcdef+dirty", ""}, // pseudo after a tag
+		{"", "(devel)", ""},
+	}
+	for _, tt := range tests {
+		bi := BuildInfo{Version: tt.injected}
+		merge(&bi, info(tt.module))
+		if bi.Version != tt.want {
+			t.Errorf("injected %q, module %q: version = %q, want %q", tt.injected, tt.module, bi.Version, tt.want)
+		}
+	}
+}
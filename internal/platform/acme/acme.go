@@ -0,0 +1,320 @@
+// Package acme gets the server's TLS certificate from an ACME CA (Let's
+// Encrypt by default) with DNS-01 challenges, see types.TLSConfig.
+//
+// DNS-01 proves control of the domain with a TXT record at
+// _acme-challenge.<host> instead of a request to port 80, so it works for
+// instances behind NAT or serving on another port. The record is set through
+// a [Provider]: cloudflare's API, or an executable (exec) for anything else.
+// More can be added with [RegisterProvider].
+//
+// The account key, certificate and its key are kept in <storage>/tls. The
+// certificate is renewed once it's within [RenewBefore] of expiring.
+package acme
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sprout/internal/types"
+	"strings"
+	"time"
+
+	"github.com/Data-Corruption/stdx/xlog"
+	"golang.org/x/crypto/acme"
+)
+
+const (
+	// LetsEncrypt is the directory used when none is configured.
+	LetsEncrypt = acme.LetsEncryptURL
+	// RenewBefore is how long before expiry the certificate is renewed.
+	RenewBefore = 30 * 24 * time.Hour
+
+	dirName     = "tls"
+	accountFile = "account.key"
+	certFile    = "cert.pem"
+	keyFile     = "key.pem"
+)
+
+// Propagation is how long to wait after setting a TXT record before asking
+// the CA to check it, DNS providers take a moment to serve new records.
+var Propagation = time.Minute
+
+// Provider sets and removes the TXT records of DNS-01 challenges.
+type Provider interface {
+	// Present creates a TXT record at fqdn (e.g. "_acme-challenge.example.com")
+	// with value.
+	Present(ctx context.Context, fqdn, value string) error
+	// CleanUp removes the record Present created.
+	CleanUp(ctx context.Context, fqdn, value string) error
+}
+
+// ProviderFunc creates a provider from the TLS settings. client is the app's
+// outbound client.
+type ProviderFunc func(cfg types.TLSConfig, client *http.Client) (Provider, error)
+
+var providers = map[string]ProviderFunc{
+	"cloudflare": newCloudflare,
+	"exec":       newExec,
+}
+
+// RegisterProvider makes a provider available as a tls.dnsProvider value.
+// Call it at init.
+func RegisterProvider(name string, fn ProviderFunc) {
+	providers[name] = fn
+	types.AddSchemaHint("tls.dnsProvider", types.SchemaHint{Enum: append([]string{""}, Providers()...)})
+}
+
+// Providers returns the registered provider names, sorted.
+func Providers() []string {
+	return slices.Sorted(maps.Keys(providers))
+}
+
+func init() {
+	types.AddSchemaHint("tls.dnsProvider", types.SchemaHint{Enum: append([]string{""}, Providers()...)})
+	types.AddValidator(func(c *types.Configuration) (e types.FieldErrors) {
+		t := c.TLS
+		if t.DNSProvider == "" {
+			return nil
+		}
+		if _, ok := providers[t.DNSProvider]; !ok {
+			return types.FieldErrors{{Field: "tls.dnsProvider", Message: fmt.Sprintf("unknown provider %q, want one of %s", t.DNSProvider, strings.Join(Providers(), ", "))}}
+		}
+		if !strings.Contains(c.Host, ".") || c.Host == "localhost" {
+			e = append(e, types.FieldError{Field: "tls.dnsProvider", Message: fmt.Sprintf("host %q isn't a public domain name, the certificate is issued for it", c.Host)})
+		}
+		switch {
+		case t.DNSProvider == "cloudflare" && t.DNSToken == "":
+			e = append(e, types.FieldError{Field: "tls.dnsToken", Message: "cloudflare needs an API token"})
+		case t.DNSProvider == "exec" && t.DNSCommand == "":
+			e = append(e, types.FieldError{Field: "tls.dnsCommand", Message: "exec needs a command"})
+		}
+		return e
+	})
+}
+
+// Manager obtains and renews the certificate for one domain.
+type Manager struct {
+	Dir       string // where the account key, certificate and key are kept
+	Domain    string
+	Email     string // account contact, "" = none
+	Directory string // ACME directory URL
+	Provider  Provider
+	Client    *http.Client
+	Log       *xlog.Logger
+}
+
+// New creates a manager for host with the configured provider, keeping its
+// files in storageDir.
+func New(storageDir, host string, cfg types.TLSConfig, client *http.Client, log *xlog.Logger) (*Manager, error) {
+	fn, ok := providers[cfg.DNSProvider]
+	if !ok {
+		return nil, fmt.Errorf("unknown DNS provider %q", cfg.DNSProvider)
+	}
+	p, err := fn(cfg, client)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set up DNS provider %s: %w", cfg.DNSProvider, err)
+	}
+	dir := cfg.ACMEDirectory
+	if dir == "" {
+		dir = LetsEncrypt
+	}
+	return &Manager{
+		Dir:       filepath.Join(storageDir, dirName),
+		Domain:    host,
+		Email:     cfg.ACMEEmail,
+		Directory: dir,
+		Provider:  p,
+		Client:    client,
+		Log:       log,
+	}, nil
+}
+
+// CertFile is the PEM certificate chain, KeyFile its key.
+func (m *Manager) CertFile() string { return filepath.Join(m.Dir, certFile) }
+func (m *Manager) KeyFile() string  { return filepath.Join(m.Dir, keyFile) }
+
+// Expiry returns when the stored certificate expires, zero if there is none
+// usable for the domain.
+func (m *Manager) Expiry() time.Time {
+	pair, err := tls.LoadX509KeyPair(m.CertFile(), m.KeyFile())
+	if err != nil {
+		return time.Time{}
+	}
+	leaf, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil || leaf.VerifyHostname(m.Domain) != nil {
+		return time.Time{}
+	}
+	return leaf.NotAfter
+}
+
+// Renew obtains a certificate when there's none yet or the stored one is
+// within RenewBefore of expiring. It reports whether it got a new one.
+func (m *Manager) Renew(ctx context.Context) (bool, error) {
+	if exp := m.Expiry(); time.Until(exp) > RenewBefore {
+		m.Log.Debugf("TLS certificate for %s valid until %s", m.Domain, exp.Format(time.DateTime))
+		return false, nil
+	}
+	if err := m.Obtain(ctx); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Obtain gets a new certificate for the domain and stores it.
+func (m *Manager) Obtain(ctx context.Context) error {
+	if err := os.MkdirAll(m.Dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create %s: %w", m.Dir, err)
+	}
+	key, err := loadKey(filepath.Join(m.Dir, accountFile))
+	if err != nil {
+		return fmt.Errorf("failed to load ACME account key: %w", err)
+	}
+	client := &acme.Client{Key: key, DirectoryURL: m.Directory, HTTPClient: m.Client}
+	acct := &acme.Account{}
+	if m.Email != "" {
+		acct.Contact = []string{"mailto:" + m.Email}
+	}
+	if _, err := client.Register(ctx, acct, acme.AcceptTOS); err != nil && !errors.Is(err, acme.ErrAccountAlreadyExists) {
+		return fmt.Errorf("failed to register ACME account: %w", err)
+	}
+
+	m.Log.Infof("Requesting a TLS certificate for %s from %s", m.Domain, m.Directory)
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(m.Domain))
+	if err != nil {
+		return fmt.Errorf("failed to create order: %w", err)
+	}
+	for _, u := range order.AuthzURLs {
+		if err := m.authorize(ctx, client, u); err != nil {
+			return err
+		}
+	}
+	if order, err = client.WaitOrder(ctx, order.URI); err != nil {
+		return fmt.Errorf("order failed: %w", err)
+	}
+
+	certKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{DNSNames: []string{m.Domain}}, certKey)
+	if err != nil {
+		return fmt.Errorf("failed to create CSR: %w", err)
+	}
+	chain, _, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return fmt.Errorf("failed to finalize order: %w", err)
+	}
+	var certPEM []byte
+	for _, der := range chain {
+		certPEM = append(certPEM, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(certKey)
+	if err != nil {
+		return err
+	}
+	// key first, a cert next to the old key would fail to load
+	if err := writeFile(m.KeyFile(), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})); err != nil {
+		return err
+	}
+	if err := writeFile(m.CertFile(), certPEM); err != nil {
+		return err
+	}
+	m.Log.Infof("Got a TLS certificate for %s, valid until %s", m.Domain, m.Expiry().Format(time.DateTime))
+	return nil
+}
+
+// authorize answers the DNS-01 challenge of one authorization.
+func (m *Manager) authorize(ctx context.Context, client *acme.Client, url string) error {
+	z, err := client.GetAuthorization(ctx, url)
+	if err != nil {
+		return fmt.Errorf("failed to get authorization: %w", err)
+	}
+	if z.Status == acme.StatusValid {
+		return nil
+	}
+	var chal *acme.Challenge
+	for _, c := range z.Challenges {
+		if c.Type == "dns-01" {
+			chal = c
+			break
+		}
+	}
+	if chal == nil {
+		return fmt.Errorf("the CA offers no dns-01 challenge for %s", z.Identifier.Value)
+	}
+	value, err := client.DNS01ChallengeRecord(chal.Token)
+	if err != nil {
+		return err
+	}
+	fqdn := "_acme-challenge." + strings.TrimPrefix(z.Identifier.Value, "*.")
+	if err := m.Provider.Present(ctx, fqdn, value); err != nil {
+		return fmt.Errorf("failed to set TXT record %s: %w", fqdn, err)
+	}
+	defer func() {
+		if err := m.Provider.CleanUp(context.WithoutCancel(ctx), fqdn, value); err != nil {
+			m.Log.Warnf("Failed to remove TXT record %s: %v", fqdn, err)
+		}
+	}()
+
+	m.Log.Debugf("Set TXT record %s, waiting %v for it to propagate", fqdn, Propagation)
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(Propagation):
+	}
+	if _, err := client.Accept(ctx, chal); err != nil {
+		return fmt.Errorf("failed to accept challenge: %w", err)
+	}
+	if _, err := client.WaitAuthorization(ctx, z.URI); err != nil {
+		return fmt.Errorf("%s wasn't authorized: %w", z.Identifier.Value, err)
+	}
+	return nil
+}
+
+// loadKey reads an EC key, generating one (mode 0600) if the file doesn't exist.
+func loadKey(path string) (crypto.Signer, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		der, err := x509.MarshalECPrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		return key, writeFile(path, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}))
+	} else if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s isn't PEM", path)
+	}
+	return x509.ParseECPrivateKey(block.Bytes)
+}
+
+// writeFile replaces path atomically, readable by the owner only.
+func writeFile(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
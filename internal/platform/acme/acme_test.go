@@ -0,0 +1,226 @@
+package acme
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sprout/internal/types"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Data-Corruption/stdx/xlog"
+)
+
+func TestCloudflare(t *testing.T) {
+	var mu sync.Mutex
+	records := map[string]string{} // id -> name
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer tok" {
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]any{"success": false, "errors": []map[string]string{{"message": "bad token"}}})
+			return
+		}
+		var result any
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/zones":
+			// only the apex is a zone
+			result = []map[string]string{}
+			if r.URL.Query().Get("name") == "example.com" {
+				result = []map[string]string{{"id": "z1"}}
+			}
+		case r.Method == http.MethodPost && r.URL.Path == "/zones/z1/dns_records":
+			var rec map[string]any
+			json.NewDecoder(r.Body).Decode(&rec)
+			if rec["type"] != "TXT" || rec["content"] != "v4lue" {
+				t.Errorf("record = %v, want TXT with the challenge value", rec)
+			}
+			records["r1"] = rec["name"].(string)
+			result = map[string]string{"id": "r1"}
+		case r.Method == http.MethodDelete && r.URL.Path == "/zones/z1/dns_records/r1":
+			delete(records, "r1")
+			result = map[string]string{"id": "r1"}
+		default:
+			t.Errorf("unexpected %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusNotFound)
+		}
+		json.NewEncoder(w).Encode(map[string]any{"success": true, "result": result})
+	}))
+	defer srv.Close()
+	api := CloudflareAPI
+	CloudflareAPI = srv.URL
+	defer func() { CloudflareAPI = api }()
+
+	if _, err := newCloudflare(types.TLSConfig{}, srv.Client()); err == nil {
+		t.Error("expected an error without a token")
+	}
+	p, err := newCloudflare(types.TLSConfig{DNSToken: "tok"}, srv.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	fqdn := "_acme-challenge.app.example.com"
+	if err := p.Present(ctx, fqdn, "v4lue"); err != nil {
+		t.Fatalf("Present: %v", err)
+	}
+	if records["r1"] != fqdn {
+		t.Errorf("records = %v, want r1 at %s", records, fqdn)
+	}
+	if err := p.CleanUp(ctx, fqdn, "v4lue"); err != nil {
+		t.Fatalf("CleanUp: %v", err)
+	}
+	if len(records) != 0 {
+		t.Errorf("records after CleanUp = %v, want none", records)
+	}
+
+	if err := p.Present(ctx, "_acme-challenge.other.org", "v4lue"); err == nil || !strings.Contains(err.Error(), "no cloudflare zone") {
+		t.Errorf("Present outside the token's zones = %v, want no zone found", err)
+	}
+	bad, _ := newCloudflare(types.TLSConfig{DNSToken: "wrong"}, srv.Client())
+	if err := bad.Present(ctx, fqdn, "v4lue"); err == nil || !strings.Contains(err.Error(), "bad token") {
+		t.Errorf("Present with a bad token = %v, want the API's error", err)
+	}
+}
+
+func TestExec(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script")
+	}
+	dir := t.TempDir()
+	out := filepath.Join(dir, "calls")
+	script := filepath.Join(dir, "dns.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\necho \"$@\" >> "+out+"\n[ \"$2\" != fail ] || { echo nope; exit 1; }\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	p, err := newExec(types.TLSConfig{DNSCommand: script}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := p.Present(ctx, "_acme-challenge.example.com", "v"); err != nil {
+		t.Fatalf("Present: %v", err)
+	}
+	if err := p.CleanUp(ctx, "_acme-challenge.example.com", "v"); err != nil {
+		t.Fatalf("CleanUp: %v", err)
+	}
+	data, _ := os.ReadFile(out)
+	if want := "present _acme-challenge.example.com v\ncleanup _acme-challenge.example.com v\n"; string(data) != want {
+		t.Errorf("calls = %q, want %q", data, want)
+	}
+	if err := p.Present(ctx, "fail", "v"); err == nil || !strings.Contains(err.Error(), "nope") {
+		t.Errorf("failing command = %v, want its output in the error", err)
+	}
+}
+
+func TestRenew(t *testing.T) {
+	// a CA that isn't there, Renew only gets that far when a certificate is due
+	ca := httptest.NewServer(http.NotFoundHandler())
+	defer ca.Close()
+	log, err := xlog.New(filepath.Join(t.TempDir(), "logs"), "none")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &Manager{Dir: t.TempDir(), Domain: "app.example.com", Directory: ca.URL, Client: ca.Client(), Log: log}
+
+	if !m.Expiry().IsZero() {
+		t.Error("Expiry without a certificate isn't zero")
+	}
+	if _, err := m.Renew(context.Background()); err == nil {
+		t.Error("Renew without a certificate didn't ask the CA")
+	}
+
+	writeCert(t, m, "app.example.com", 60*24*time.Hour)
+	if m.Expiry().IsZero() {
+		t.Fatal("Expiry of a stored certificate is zero")
+	}
+	if renewed, err := m.Renew(context.Background()); renewed || err != nil {
+		t.Errorf("Renew of a certificate valid for 60 days = %t, %v, want nothing to do", renewed, err)
+	}
+
+	writeCert(t, m, "app.example.com", 10*24*time.Hour)
+	if _, err := m.Renew(context.Background()); err == nil {
+		t.Error("Renew of a certificate expiring in 10 days didn't ask the CA")
+	}
+
+	writeCert(t, m, "other.example.com", 60*24*time.Hour)
+	if !m.Expiry().IsZero() {
+		t.Error("a certificate for another domain counts")
+	}
+}
+
+// writeCert stores a self-signed certificate for domain valid for d.
+func writeCert(t *testing.T, m *Manager, domain string, d time.Duration) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: domain},
+		DNSNames:     []string{domain},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(d),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(m.KeyFile(), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeFile(m.CertFile(), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		host  string
+		tls   types.TLSConfig
+		field string // "" = valid
+	}{
+		{"off", "localhost", types.TLSConfig{}, ""},
+		{"files", "localhost", types.TLSConfig{CertFile: "c.pem", KeyFile: "k.pem"}, ""},
+		{"cert without key", "localhost", types.TLSConfig{CertFile: "c.pem"}, "tls.keyFile"},
+		{"files and acme", "app.example.com", types.TLSConfig{CertFile: "c.pem", KeyFile: "k.pem", DNSProvider: "exec", DNSCommand: "x"}, "tls.dnsProvider"},
+		{"cloudflare", "app.example.com", types.TLSConfig{DNSProvider: "cloudflare", DNSToken: "tok"}, ""},
+		{"cloudflare without token", "app.example.com", types.TLSConfig{DNSProvider: "cloudflare"}, "tls.dnsToken"},
+		{"exec without command", "app.example.com", types.TLSConfig{DNSProvider: "exec"}, "tls.dnsCommand"},
+		{"unknown provider", "app.example.com", types.TLSConfig{DNSProvider: "route99"}, "tls.dnsProvider"},
+		{"acme for localhost", "localhost", types.TLSConfig{DNSProvider: "exec", DNSCommand: "x"}, "tls.dnsProvider"},
+		{"plain http directory", "app.example.com", types.TLSConfig{DNSProvider: "exec", DNSCommand: "x", ACMEDirectory: "http://ca"}, "tls.acmeDirectory"},
+		{"http3", "localhost", types.TLSConfig{CertFile: "c.pem", KeyFile: "k.pem", HTTP3: true}, ""},
+		{"http3 without tls", "localhost", types.TLSConfig{HTTP3: true}, "tls.http3"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := types.DefaultConfig()
+			cfg.LogLevel, cfg.Host, cfg.TLS = "info", tc.host, tc.tls
+			fe := cfg.Validate().For("tls", "host")
+			if tc.field == "" && fe != nil {
+				t.Errorf("Validate = %v, want valid", fe)
+			} else if tc.field != "" && !strings.Contains(fe.Error(), tc.field) {
+				t.Errorf("Validate = %v, want an error for %s", fe, tc.field)
+			}
+		})
+	}
+}
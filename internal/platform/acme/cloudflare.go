@@ -0,0 +1,128 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sprout/internal/types"
+	"strings"
+	"sync"
+)
+
+// CloudflareAPI is the base URL of Cloudflare's API, replaced in tests.
+var CloudflareAPI = "https://api.cloudflare.com/client/v4"
+
+// cloudflare sets records through Cloudflare's API with a token that may
+// edit the zone's DNS.
+type cloudflare struct {
+	token  string
+	client *http.Client
+
+	mu      sync.Mutex
+	records map[string]string // fqdn + value -> zone/record path, for CleanUp
+}
+
+func newCloudflare(cfg types.TLSConfig, client *http.Client) (Provider, error) {
+	if cfg.DNSToken == "" {
+		return nil, errors.New("no API token (tls.dnsToken)")
+	}
+	return &cloudflare{token: cfg.DNSToken.Reveal(), client: client, records: map[string]string{}}, nil
+}
+
+func (c *cloudflare) Present(ctx context.Context, fqdn, value string) error {
+	zone, err := c.zone(ctx, fqdn)
+	if err != nil {
+		return err
+	}
+	var rec struct {
+		ID string `json:"id"`
+	}
+	body := map[string]any{"type": "TXT", "name": fqdn, "content": value, "ttl": 60}
+	if err := c.do(ctx, http.MethodPost, "/zones/"+zone+"/dns_records", body, &rec); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	c.records[fqdn+" "+value] = "/zones/" + zone + "/dns_records/" + rec.ID
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *cloudflare) CleanUp(ctx context.Context, fqdn, value string) error {
+	c.mu.Lock()
+	path, ok := c.records[fqdn+" "+value]
+	delete(c.records, fqdn+" "+value)
+	c.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return c.do(ctx, http.MethodDelete, path, nil, nil)
+}
+
+// zone finds the ID of the zone fqdn is in, trying its parent domains from
+// the longest one down.
+func (c *cloudflare) zone(ctx context.Context, fqdn string) (string, error) {
+	labels := strings.Split(strings.TrimSuffix(fqdn, "."), ".")
+	for i := 1; i < len(labels)-1; i++ {
+		var zones []struct {
+			ID string `json:"id"`
+		}
+		name := strings.Join(labels[i:], ".")
+		if err := c.do(ctx, http.MethodGet, "/zones?name="+url.QueryEscape(name), nil, &zones); err != nil {
+			return "", err
+		}
+		if len(zones) > 0 {
+			return zones[0].ID, nil
+		}
+	}
+	return "", fmt.Errorf("no cloudflare zone found for %s, does the token have access to it?", fqdn)
+}
+
+// do calls the API, decoding the result field of the response into out.
+func (c *cloudflare) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, CloudflareAPI+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("cloudflare: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var res struct {
+		Success bool `json:"success"`
+		Errors  []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+		Result json.RawMessage `json:"result"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&res); err != nil {
+		return fmt.Errorf("cloudflare: %s %s: %s", method, path, resp.Status)
+	}
+	if !res.Success {
+		msgs := make([]string, len(res.Errors))
+		for i, e := range res.Errors {
+			msgs[i] = e.Message
+		}
+		return fmt.Errorf("cloudflare: %s %s: %s", method, path, strings.Join(msgs, ", "))
+	}
+	if out != nil {
+		return json.Unmarshal(res.Result, out)
+	}
+	return nil
+}
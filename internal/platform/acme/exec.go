@@ -0,0 +1,47 @@
+package acme
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"sprout/internal/types"
+	"strings"
+)
+
+// execProvider runs a user supplied executable for DNS hosts without a
+// built-in provider: `<command> present <fqdn> <value>`, then `cleanup`
+// with the same arguments. It must exit 0 once the record is set / removed.
+type execProvider struct {
+	command string
+}
+
+func newExec(cfg types.TLSConfig, _ *http.Client) (Provider, error) {
+	if cfg.DNSCommand == "" {
+		return nil, errors.New("no command (tls.dnsCommand)")
+	}
+	return &execProvider{command: cfg.DNSCommand}, nil
+}
+
+func (p *execProvider) Present(ctx context.Context, fqdn, value string) error {
+	return p.run(ctx, "present", fqdn, value)
+}
+
+func (p *execProvider) CleanUp(ctx context.Context, fqdn, value string) error {
+	return p.run(ctx, "cleanup", fqdn, value)
+}
+
+func (p *execProvider) run(ctx context.Context, args ...string) error {
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.command, args...)
+	cmd.Stdout, cmd.Stderr = &out, &out
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(out.String()); msg != "" {
+			return fmt.Errorf("%s %s: %w: %s", p.command, args[0], err, msg)
+		}
+		return fmt.Errorf("%s %s: %w", p.command, args[0], err)
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+// Package backup creates hot backups of the database as tar.gz archives,
+// prunes old ones by retention policy, and records results in the backups DBI.
+//
+// An archive holds a consistent copy of the database (kv.DataFile, see
+// database.HotCopy) and a manifest.json with checksums:
+//
+//	<name>-20250102-030000.tar.gz
+//	├── manifest.json
+//	└── data.mdb (data.db in bolt builds)
+//
+// With encryption configured the whole archive is sealed (see [Encryption])
+// and gets an extra .enc suffix.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sprout/internal/platform/database"
+	"sprout/internal/platform/database/kv"
+	"strings"
+	"time"
+)
+
+const (
+	ManifestName = "manifest.json"
+	timeLayout   = "20060102-150405"
+	ext          = ".tar.gz"
+)
+
+// Manifest describes an archive's contents.
+type Manifest struct {
+	App           string    `json:"app"`
+	Version       string    `json:"version"`       // app version that made the backup
+	SchemaVersion string    `json:"schemaVersion"` // database schema version at backup time
+	CreatedAt     time.Time `json:"createdAt"`
+	Files         []File    `json:"files"`
+}
+
+type File struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Archive is a backup found on disk.
+type Archive struct {
+	Path      string
+	CreatedAt time.Time // from the file name
+	Size      int64
+	Encrypted bool
+}
+
+// Create writes a new archive to opts.Dir (created if needed) and returns its path.
+// The archive only appears under its final name once complete.
+func Create(db kv.DB, opts Options, now time.Time) (string, error) {
+	dir := opts.Dir
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create backup dir: %w", err)
+	}
+	work, err := os.MkdirTemp(dir, ".tmp-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create work dir: %w", err)
+	}
+	defer os.RemoveAll(work)
+
+	// copy
+	copyDir := filepath.Join(work, "db")
+	if err := database.HotCopy(db, copyDir); err != nil {
+		return "", fmt.Errorf("failed to copy database: %w", err)
+	}
+	schemaVer, err := database.SchemaVersion(db)
+	if err != nil {
+		return "", fmt.Errorf("failed to get schema version: %w", err)
+	}
+	dataPath := filepath.Join(copyDir, kv.DataFile)
+	file, err := describe(dataPath)
+	if err != nil {
+		return "", err
+	}
+	manifest := Manifest{App: opts.App, Version: opts.Version, SchemaVersion: schemaVer, CreatedAt: now, Files: []File{file}}
+
+	// archive
+	name := fmt.Sprintf("%s-%s%s", opts.App, now.Local().Format(timeLayout), ext)
+	if opts.Encryption != nil {
+		name += encExt
+	}
+	final := filepath.Join(dir, name)
+	if _, err := os.Stat(final); err == nil {
+		return "", fmt.Errorf("%s already exists", final)
+	}
+	partial := filepath.Join(work, name)
+	if err := writeArchive(partial, manifest, map[string]string{file.Name: dataPath}, opts.Encryption); err != nil {
+		return "", err
+	}
+	if err := os.Rename(partial, final); err != nil {
+		return "", fmt.Errorf("failed to move archive into place: %w", err)
+	}
+	return final, nil
+}
+
+func describe(path string) (File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return File{}, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return File{}, fmt.Errorf("failed to hash %s: %w", path, err)
+	}
+	return File{Name: filepath.Base(path), Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+func writeArchive(path string, m Manifest, files map[string]string, enc *Encryption) error {
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create archive: %w", err)
+	}
+	defer out.Close()
+	var sealed io.WriteCloser = nopCloser{out}
+	if enc != nil {
+		if sealed, err = enc.NewEncryptWriter(out); err != nil {
+			return fmt.Errorf("failed to set up encryption: %w", err)
+		}
+	}
+	gz := gzip.NewWriter(sealed)
+	tw := tar.NewWriter(gz)
+
+	manifest, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: ManifestName, Mode: 0600, Size: int64(len(manifest)), ModTime: m.CreatedAt}); err != nil {
+		return err
+	}
+	if _, err := tw.Write(manifest); err != nil {
+		return err
+	}
+	for _, f := range m.Files {
+		if err := addFile(tw, f, files[f.Name], m.CreatedAt); err != nil {
+			return fmt.Errorf("failed to add %s: %w", f.Name, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+	if err := sealed.Close(); err != nil {
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+func addFile(tw *tar.Writer, f File, src string, modTime time.Time) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	if err := tw.WriteHeader(&tar.Header{Name: f.Name, Mode: 0600, Size: f.Size, ModTime: modTime}); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, in)
+	return err
+}
+
+// List returns the archives in dir made by app, newest first. A missing dir is empty.
+func List(dir, app string) ([]Archive, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var out []Archive
+	prefix := app + "-"
+	for _, e := range entries {
+		name := e.Name()
+		stamp, encrypted := strings.CutSuffix(strings.TrimPrefix(name, prefix), encExt)
+		stamp, ok := strings.CutSuffix(stamp, ext)
+		if e.IsDir() || !strings.HasPrefix(name, prefix) || !ok {
+			continue
+		}
+		t, err := time.ParseInLocation(timeLayout, stamp, time.Local)
+		if err != nil {
+			continue // not ours
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		out = append(out, Archive{Path: filepath.Join(dir, name), CreatedAt: t, Size: info.Size(), Encrypted: encrypted})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].CreatedAt.After(out[j].CreatedAt) })
+	return out, nil
+}
+
+// Options configure [Create] and [Run].
+type Options struct {
+	Dir        string
+	App        string
+	Version    string
+	Trigger    string
+	Retention  Retention
+	Encryption *Encryption // nil = plaintext
+}
+
+// Run creates an archive, verifies it, prunes old ones, and records the result
+// in the backups DBI. The returned result is also what was recorded.
+func Run(db kv.DB, opts Options) Result {
+	start := time.Now()
+	res := Result{Time: start, Trigger: opts.Trigger}
+	path, err := Create(db, opts, start)
+	res.Duration = time.Since(start)
+	if err != nil {
+		res.Error = err.Error()
+	} else {
+		res.Path = path
+		if info, err := os.Stat(path); err == nil {
+			res.Size = info.Size()
+		}
+		if _, err := Verify(path, opts.Encryption); err != nil {
+			res.Error = fmt.Sprintf("verification failed: %v", err)
+		} else {
+			res.Verified = true
+			// only prune after a good backup, a failing job shouldn't eat the old ones
+			if res.Pruned, err = Prune(opts.Dir, opts.App, opts.Retention); err != nil {
+				res.PruneError = err.Error()
+			}
+		}
+	}
+	if err := Record(db, res); err != nil && res.Error == "" {
+		res.Error = fmt.Sprintf("backup written but failed to record result: %v", err)
+	}
+	return res
+}
@@ -0,0 +1,146 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"sprout/internal/platform/database/kv"
+	"sprout/internal/testsupport/dbtest"
+	"testing"
+	"time"
+)
+
+func openDB(t *testing.T) kv.DB {
+	return dbtest.Open(t)
+}
+
+func TestCreateAndList(t *testing.T) {
+	db := openDB(t)
+	dir := t.TempDir()
+	base := time.Date(2026, 1, 5, 3, 0, 0, 0, time.UTC)
+	for i := range 3 {
+		if _, err := Create(db, Options{Dir: dir, App: "sprout", Version: "v1.0.0"}, base.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+
+	archives, err := List(dir, "sprout")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(archives) != 3 || !archives[0].CreatedAt.After(archives[1].CreatedAt) {
+		t.Fatalf("want 3 archives newest first, got %+v", archives)
+	}
+
+	// archive holds the manifest and the data file
+	f, err := os.Open(archives[0].Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(gz)
+	var names []string
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		names = append(names, hdr.Name)
+	}
+	if len(names) != 2 || names[0] != "manifest.json" || names[1] != kv.DataFile {
+		t.Errorf("archive entries = %v", names)
+	}
+}
+
+func TestRetentionKeep(t *testing.T) {
+	day := func(d, h int) Archive {
+		return Archive{CreatedAt: time.Date(2026, 1, d, h, 0, 0, 0, time.UTC)}
+	}
+	// newest first: two on the 14th, one each on the 13th, 12th, 5th
+	archives := []Archive{day(14, 12), day(14, 3), day(13, 3), day(12, 3), day(5, 3)}
+
+	tests := []struct {
+		name string
+		r    Retention
+		want []bool
+	}{
+		{"zero keeps all", Retention{}, []bool{true, true, true, true, true}},
+		{"last", Retention{KeepLast: 2}, []bool{true, true, false, false, false}},
+		{"daily", Retention{KeepDaily: 2}, []bool{true, false, true, false, false}},
+		{"weekly", Retention{KeepWeekly: 2}, []bool{true, false, false, false, true}},
+		{"combined", Retention{KeepLast: 1, KeepDaily: 3}, []bool{true, false, true, true, false}},
+	}
+	for _, tt := range tests {
+		got := tt.r.Keep(archives)
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s: keep = %v, want %v", tt.name, got, tt.want)
+				break
+			}
+		}
+	}
+}
+
+func TestRunRecordsHistory(t *testing.T) {
+	db := openDB(t)
+	dir := t.TempDir()
+
+	res := Run(db, Options{Dir: dir, App: "sprout", Version: "v1.0.0", Trigger: "test"})
+	if !res.OK() || res.Size == 0 {
+		t.Fatalf("Run: %+v", res)
+	}
+	history, err := History(db, 10)
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	if len(history) != 1 || history[0].Path != res.Path || history[0].Trigger != "test" {
+		t.Errorf("history = %+v", history)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	db := openDB(t)
+	dir := t.TempDir()
+	path, err := Create(db, Options{Dir: dir, App: "sprout", Version: "v1.0.0"}, time.Now())
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	v, err := Verify(path, nil)
+	if err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	if v.Manifest.Version != "v1.0.0" || v.Entries["config"] == 0 {
+		t.Errorf("verification = %+v", v)
+	}
+
+	// corrupt a byte in the middle of the compressed stream
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data[len(data)/2] ^= 0xff
+	bad := filepath.Join(dir, "bad.tar.gz")
+	if err := os.WriteFile(bad, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(bad, nil); err == nil {
+		t.Error("Verify of a corrupted archive succeeded")
+	}
+
+	// encrypted without keys
+	enc, err := Create(db, Options{Dir: dir, App: "sprout", Version: "v1.0.0", Encryption: &Encryption{Passphrase: "x"}}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := Verify(enc, nil); err == nil {
+		t.Error("Verify of an encrypted archive without keys succeeded")
+	}
+	if _, err := Verify(enc, &Encryption{Passphrase: "x"}); err != nil {
+		t.Errorf("Verify with passphrase: %v", err)
+	}
+}
@@ -0,0 +1,288 @@
+package backup
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sprout/internal/types"
+	"strings"
+)
+
+// Encryption modes, see [types.BackupConfig].
+const (
+	EncryptNone       = ""
+	EncryptKey        = "key"        // random key kept in the storage dir, copy it off-box separately
+	EncryptPassphrase = "passphrase" // from the PassphraseEnv environment variable
+)
+
+func init() {
+	types.AddSchemaHint("backup.encrypt", types.SchemaHint{Enum: []string{EncryptNone, EncryptKey, EncryptPassphrase}})
+	types.AddValidator(func(c *types.Configuration) types.FieldErrors {
+		if !slices.Contains([]string{EncryptNone, EncryptKey, EncryptPassphrase}, c.Backup.Encrypt) {
+			return types.FieldErrors{{Field: "backup.encrypt", Message: fmt.Sprintf("%q isn't a mode, want %s, %s or empty", c.Backup.Encrypt, EncryptKey, EncryptPassphrase)}}
+		}
+		return nil
+	})
+}
+
+const (
+	PassphraseEnv = "BACKUP_PASSPHRASE"
+	KeyFile       = "backup.key"
+	encExt        = ".enc"
+
+	keySize     = 32 // AES-256
+	saltSize    = 16
+	prefixSize  = 7 // nonce = prefix(7) | counter(4) | last(1)
+	chunkSize   = 64 << 10
+	pbkdf2Iters = 600_000
+
+	modeKey        byte = 1
+	modePassphrase byte = 2
+)
+
+var (
+	magic = []byte("SPBK\x01")
+
+	ErrNotEncrypted = errors.New("archive is not encrypted")
+	ErrDecrypt      = errors.New("failed to decrypt archive, wrong key or corrupted file")
+)
+
+// Encryption seals archives with AES-256-GCM. Sealing uses Passphrase if set,
+// otherwise Key. Opening uses whichever the archive was sealed with.
+//
+// Archives are a short header followed by 64 KiB chunks, each sealed with its
+// own nonce and the header as additional data. The final chunk is flagged in
+// its nonce, so truncation, reordering, or a swapped header fail to decrypt.
+type Encryption struct {
+	Key        []byte // 32 bytes, see LoadKey
+	Passphrase string // stretched with PBKDF2-SHA256, salt is stored per archive
+}
+
+// NewEncryption resolves a configured mode into an Encryption, nil for EncryptNone.
+// For EncryptKey the key file in storageDir is created on first use.
+func NewEncryption(mode, storageDir string) (*Encryption, error) {
+	switch mode {
+	case EncryptNone:
+		return nil, nil
+	case EncryptKey:
+		key, err := LoadKey(filepath.Join(storageDir, KeyFile), true)
+		if err != nil {
+			return nil, err
+		}
+		return &Encryption{Key: key}, nil
+	case EncryptPassphrase:
+		pass := os.Getenv(PassphraseEnv)
+		if pass == "" {
+			return nil, fmt.Errorf("backup encryption is set to passphrase but %s is empty", PassphraseEnv)
+		}
+		return &Encryption{Passphrase: pass}, nil
+	default:
+		return nil, fmt.Errorf("unknown backup encryption mode %q, want %q, %q, or empty", mode, EncryptKey, EncryptPassphrase)
+	}
+}
+
+// LoadKey reads a hex encoded key file, generating one (mode 0600) if it
+// doesn't exist and create is set.
+func LoadKey(path string, create bool) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) && create {
+		key := make([]byte, keySize)
+		rand.Read(key)
+		if err := os.WriteFile(path, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+			return nil, fmt.Errorf("failed to write backup key: %w", err)
+		}
+		return key, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read backup key: %w", err)
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != keySize {
+		return nil, fmt.Errorf("invalid backup key in %s, want %d hex encoded bytes", path, keySize)
+	}
+	return key, nil
+}
+
+// header is magic | mode | salt | nonce prefix.
+func (e *Encryption) header() []byte {
+	h := make([]byte, 0, len(magic)+1+saltSize+prefixSize)
+	h = append(h, magic...)
+	if e.Passphrase != "" {
+		h = append(h, modePassphrase)
+	} else {
+		h = append(h, modeKey)
+	}
+	random := make([]byte, saltSize+prefixSize)
+	rand.Read(random)
+	if h[len(magic)] == modeKey {
+		clear(random[:saltSize]) // no salt needed
+	}
+	return append(h, random...)
+}
+
+func (e *Encryption) aead(header []byte) (cipher.AEAD, error) {
+	var key []byte
+	switch header[len(magic)] {
+	case modeKey:
+		if len(e.Key) != keySize {
+			return nil, fmt.Errorf("archive is encrypted with a key file, no key given")
+		}
+		key = e.Key
+	case modePassphrase:
+		if e.Passphrase == "" {
+			return nil, fmt.Errorf("archive is encrypted with a passphrase, set %s", PassphraseEnv)
+		}
+		salt := header[len(magic)+1 : len(magic)+1+saltSize]
+		var err error
+		if key, err = pbkdf2.Key(sha256.New, e.Passphrase, salt, pbkdf2Iters, keySize); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown encryption mode %d", header[len(magic)])
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func nonce(header []byte, counter uint32, last bool) []byte {
+	n := make([]byte, 0, 12)
+	n = append(n, header[len(header)-prefixSize:]...)
+	n = binary.BigEndian.AppendUint32(n, counter)
+	if last {
+		return append(n, 1)
+	}
+	return append(n, 0)
+}
+
+// NewEncryptWriter returns a writer that encrypts into dst. Close must be
+// called to seal the final chunk, it doesn't close dst.
+func (e *Encryption) NewEncryptWriter(dst io.Writer) (io.WriteCloser, error) {
+	header := e.header()
+	aead, err := e.aead(header)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dst.Write(header); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{dst: dst, aead: aead, header: header, buf: make([]byte, 0, chunkSize)}, nil
+}
+
+type encryptWriter struct {
+	dst     io.Writer
+	aead    cipher.AEAD
+	header  []byte
+	buf     []byte
+	counter uint32
+}
+
+func (w *encryptWriter) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		// only seal a full chunk once more data arrives, the last one is sealed by Close
+		if len(w.buf) == chunkSize {
+			if err := w.seal(false); err != nil {
+				return n, err
+			}
+		}
+		c := copy(w.buf[len(w.buf):chunkSize], p)
+		w.buf = w.buf[:len(w.buf)+c]
+		p = p[c:]
+		n += c
+	}
+	return n, nil
+}
+
+func (w *encryptWriter) seal(last bool) error {
+	if w.counter == ^uint32(0) {
+		return fmt.Errorf("archive too large to encrypt")
+	}
+	out := w.aead.Seal(nil, nonce(w.header, w.counter, last), w.buf, w.header)
+	w.counter++
+	w.buf = w.buf[:0]
+	_, err := w.dst.Write(out)
+	return err
+}
+
+func (w *encryptWriter) Close() error { return w.seal(true) }
+
+// NewDecryptReader returns a reader of the plaintext of src. Tampering or a
+// wrong key surfaces as [ErrDecrypt] from Read, an unencrypted src as [ErrNotEncrypted].
+func (e *Encryption) NewDecryptReader(src io.Reader) (io.Reader, error) {
+	header := make([]byte, len(magic)+1+saltSize+prefixSize)
+	if _, err := io.ReadFull(src, header); err != nil || !bytes.Equal(header[:len(magic)], magic) {
+		return nil, ErrNotEncrypted
+	}
+	aead, err := e.aead(header)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{src: bufio.NewReader(src), aead: aead, header: header, chunk: make([]byte, chunkSize+aead.Overhead())}, nil
+}
+
+type decryptReader struct {
+	src     *bufio.Reader
+	aead    cipher.AEAD
+	header  []byte
+	chunk   []byte
+	plain   []byte
+	counter uint32
+	done    bool
+}
+
+func (r *decryptReader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(r.src, r.chunk)
+		last := false
+		switch {
+		case err == io.ErrUnexpectedEOF || err == io.EOF:
+			last = true
+		case err != nil:
+			return 0, err
+		default:
+			// a full chunk is the last one only if nothing follows
+			if _, err := r.src.Peek(1); err == io.EOF {
+				last = true
+			}
+		}
+		if r.plain, err = r.aead.Open(r.chunk[:0], nonce(r.header, r.counter, last), r.chunk[:n], r.header); err != nil {
+			return 0, ErrDecrypt
+		}
+		r.counter++
+		r.done = last
+	}
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+// IsEncrypted reports whether the file at path starts with an encryption header.
+func IsEncrypted(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	head := make([]byte, len(magic))
+	if _, err := io.ReadFull(f, head); err != nil {
+		return false, nil
+	}
+	return bytes.Equal(head, magic), nil
+}
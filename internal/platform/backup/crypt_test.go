@@ -0,0 +1,88 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestEncryptionRoundTrip(t *testing.T) {
+	key := make([]byte, keySize)
+	rand.Read(key)
+	for _, size := range []int{0, 10, chunkSize, 3*chunkSize + 7} {
+		for _, enc := range []*Encryption{{Key: key}, {Passphrase: "correct horse"}} {
+			plain := make([]byte, size)
+			rand.Read(plain)
+
+			var sealed bytes.Buffer
+			w, err := enc.NewEncryptWriter(&sealed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.Write(plain)
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := enc.NewDecryptReader(bytes.NewReader(sealed.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(r)
+			if err != nil || !bytes.Equal(got, plain) {
+				t.Errorf("size %d: round trip failed: %v", size, err)
+			}
+
+			// truncated to a chunk boundary, flipped bit, wrong secret
+			bad := []struct {
+				name string
+				data []byte
+				enc  *Encryption
+			}{
+				{"truncated", sealed.Bytes()[:sealed.Len()-16-aeadOverhead], enc},
+				{"tampered", flip(sealed.Bytes()), enc},
+				{"wrong key", sealed.Bytes(), &Encryption{Key: make([]byte, keySize), Passphrase: enc.Passphrase + "x"}},
+			}
+			for _, b := range bad {
+				r, err := b.enc.NewDecryptReader(bytes.NewReader(b.data))
+				if err == nil {
+					_, err = io.ReadAll(r)
+				}
+				if err == nil {
+					t.Errorf("size %d %s: expected an error", size, b.name)
+				}
+			}
+		}
+	}
+}
+
+const aeadOverhead = 16
+
+func flip(b []byte) []byte {
+	c := bytes.Clone(b)
+	c[len(c)-1] ^= 1
+	return c
+}
+
+func TestEncryptedArchive(t *testing.T) {
+	db := openDB(t)
+	dir := t.TempDir()
+	enc := &Encryption{Passphrase: "hunter2"}
+	path, err := Create(db, Options{Dir: dir, App: "sprout", Version: "v1.0.0", Encryption: enc}, time.Now())
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	archives, err := List(dir, "sprout")
+	if err != nil || len(archives) != 1 || !archives[0].Encrypted || archives[0].Path != path {
+		t.Fatalf("List = %+v, %v", archives, err)
+	}
+	if ok, _ := IsEncrypted(path); !ok {
+		t.Error("archive isn't encrypted")
+	}
+	if _, err := (&Encryption{Key: make([]byte, keySize)}).NewDecryptReader(bytes.NewReader(nil)); !errors.Is(err, ErrNotEncrypted) {
+		t.Errorf("empty input: err = %v, want ErrNotEncrypted", err)
+	}
+}
@@ -0,0 +1,78 @@
+package backup
+
+import (
+	"encoding/binary"
+	"sprout/internal/platform/database"
+	"sprout/internal/platform/database/kv"
+	"time"
+)
+
+// HistoryKeep is how many results are kept in the backups DBI.
+const HistoryKeep = 100
+
+// Result is the outcome of one backup run.
+type Result struct {
+	Time       time.Time     `json:"time"`
+	Trigger    string        `json:"trigger"` // "schedule", "cli", ...
+	Path       string        `json:"path,omitempty"`
+	Size       int64         `json:"size,omitempty"`
+	Verified   bool          `json:"verified,omitempty"` // passed Verify right after being written
+	Duration   time.Duration `json:"duration"`
+	Error      string        `json:"error,omitempty"`
+	Pruned     []string      `json:"pruned,omitempty"`
+	PruneError string        `json:"pruneError,omitempty"`
+}
+
+func (r *Result) OK() bool { return r.Error == "" }
+
+func resultKey(t time.Time) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(t.UnixNano()))
+}
+
+// Record stores a result, dropping the oldest beyond [HistoryKeep].
+func Record(db kv.DB, r Result) error {
+	return db.Update(func(txn kv.Txn) error {
+		if err := database.TxnMarshalAndPut(txn, *database.BackupsDBI, resultKey(r.Time), r); err != nil {
+			return err
+		}
+		cur, err := txn.Cursor(*database.BackupsDBI)
+		if err != nil {
+			return err
+		}
+		defer cur.Close()
+		n := 0
+		_, _, err = cur.First()
+		for ; err == nil; _, _, err = cur.Next() {
+			n++
+		}
+		if !kv.IsNotFound(err) {
+			return err
+		}
+		excess := n - HistoryKeep
+		for ; excess > 0; excess-- { // keys are big endian times, first is oldest
+			if _, _, err := cur.First(); err != nil {
+				return err
+			}
+			if err := cur.Delete(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// History returns up to n results, newest first. n <= 0 returns all.
+func History(db kv.DB, n int) ([]Result, error) {
+	all, err := database.ViewAll[Result](db, *database.BackupsDBI, nil)
+	if err != nil {
+		return nil, err
+	}
+	// ViewAll is oldest first (big endian time keys)
+	for i, j := 0, len(all)-1; i < j; i, j = i+1, j-1 {
+		all[i], all[j] = all[j], all[i]
+	}
+	if n > 0 && len(all) > n {
+		all = all[:n]
+	}
+	return all, nil
+}
@@ -0,0 +1,68 @@
+package backup
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Retention decides which archives to keep. An archive is kept if any rule
+// keeps it. All zero keeps everything.
+type Retention struct {
+	KeepLast   int `json:"keepLast"`   // newest N archives
+	KeepDaily  int `json:"keepDaily"`  // newest archive of each of the last N days that have one
+	KeepWeekly int `json:"keepWeekly"` // newest archive of each of the last N ISO weeks that have one
+}
+
+func (r Retention) IsZero() bool { return r == Retention{} }
+
+// Keep returns which of archives (newest first, as from List) to keep.
+func (r Retention) Keep(archives []Archive) []bool {
+	keep := make([]bool, len(archives))
+	if r.IsZero() {
+		for i := range keep {
+			keep[i] = true
+		}
+		return keep
+	}
+	for i := range min(r.KeepLast, len(archives)) {
+		keep[i] = true
+	}
+	bucket := func(n int, key func(time.Time) string) {
+		seen := map[string]bool{}
+		for i, a := range archives {
+			if len(seen) >= n {
+				return
+			}
+			if k := key(a.CreatedAt); !seen[k] {
+				seen[k] = true
+				keep[i] = true // newest in its bucket since archives are newest first
+			}
+		}
+	}
+	bucket(r.KeepDaily, func(t time.Time) string { return t.Format(time.DateOnly) })
+	bucket(r.KeepWeekly, func(t time.Time) string {
+		y, w := t.ISOWeek()
+		return fmt.Sprintf("%d-%d", y, w)
+	})
+	return keep
+}
+
+// Prune deletes the archives in dir that r doesn't keep, returning their paths.
+func Prune(dir, app string, r Retention) ([]string, error) {
+	archives, err := List(dir, app)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+	var removed []string
+	for i, keep := range r.Keep(archives) {
+		if keep {
+			continue
+		}
+		if err := os.Remove(archives[i].Path); err != nil {
+			return removed, fmt.Errorf("failed to remove %s: %w", archives[i].Path, err)
+		}
+		removed = append(removed, archives[i].Path)
+	}
+	return removed, nil
+}
@@ -0,0 +1,160 @@
+package backup
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sprout/internal/platform/database"
+)
+
+// Verification is what [Verify] found in a good archive.
+type Verification struct {
+	Manifest  Manifest
+	Encrypted bool
+	Entries   map[string]int // per DBI, from test-opening the copy
+}
+
+// Verify extracts the archive at path to a temp dir, checks every file against
+// the manifest checksums, and test-opens the database copy read-only. enc is
+// only needed for encrypted archives, see [Keys].
+func Verify(path string, enc *Encryption) (*Verification, error) {
+	work, err := os.MkdirTemp("", "backup-verify-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create work dir: %w", err)
+	}
+	defer os.RemoveAll(work)
+	return Extract(path, enc, work)
+}
+
+// Extract is [Verify], leaving the checked database copy (kv.DataFile) in dir,
+// which must exist and be empty. Partial output is left for the caller to
+// remove if it fails.
+func Extract(path string, enc *Encryption, dir string) (*Verification, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open archive: %w", err)
+	}
+	defer f.Close()
+
+	v := &Verification{}
+	var r io.Reader = bufio.NewReader(f)
+	if head, _ := r.(*bufio.Reader).Peek(len(magic)); bytes.Equal(head, magic) {
+		if enc == nil {
+			return nil, fmt.Errorf("archive is encrypted, no key or passphrase available")
+		}
+		if r, err = enc.NewDecryptReader(r); err != nil {
+			return nil, err
+		}
+		v.Encrypted = true
+	}
+
+	// extract, hashing as we go
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a backup archive: %w", err)
+	}
+	tr := tar.NewReader(gz)
+	found := map[string]File{}
+	var manifest []byte
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		if hdr.Name != filepath.Base(hdr.Name) || hdr.Typeflag != tar.TypeReg {
+			return nil, fmt.Errorf("unexpected entry %q in archive", hdr.Name)
+		}
+		if hdr.Name == ManifestName {
+			if manifest, err = io.ReadAll(io.LimitReader(tr, 1<<20)); err != nil {
+				return nil, fmt.Errorf("failed to read manifest: %w", err)
+			}
+			continue
+		}
+		if found[hdr.Name], err = extract(tr, filepath.Join(dir, hdr.Name)); err != nil {
+			return nil, fmt.Errorf("failed to extract %s: %w", hdr.Name, err)
+		}
+	}
+	if manifest == nil {
+		return nil, fmt.Errorf("archive has no %s", ManifestName)
+	}
+	if err := json.Unmarshal(manifest, &v.Manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+
+	// compare
+	var errs []error
+	for _, want := range v.Manifest.Files {
+		got, ok := found[want.Name]
+		switch {
+		case !ok:
+			errs = append(errs, fmt.Errorf("%s: missing", want.Name))
+		case got.Size != want.Size:
+			errs = append(errs, fmt.Errorf("%s: size %d, manifest says %d", want.Name, got.Size, want.Size))
+		case got.SHA256 != want.SHA256:
+			errs = append(errs, fmt.Errorf("%s: checksum mismatch", want.Name))
+		}
+		delete(found, want.Name)
+	}
+	for name := range found {
+		errs = append(errs, fmt.Errorf("%s: not in manifest", name))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	// test-open
+	if v.Entries, err = database.Check(dir); err != nil {
+		return nil, fmt.Errorf("database copy doesn't open: %w", err)
+	}
+	return v, nil
+}
+
+func extract(r io.Reader, path string) (File, error) {
+	out, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return File{}, err
+	}
+	defer out.Close()
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(out, h), r)
+	if err != nil {
+		return File{}, err
+	}
+	return File{Name: filepath.Base(path), Size: n, SHA256: hex.EncodeToString(h.Sum(nil))}, out.Close()
+}
+
+// Keys returns everything available to decrypt archives: the key file in
+// storageDir if it exists and the passphrase from [PassphraseEnv] if set.
+// Nil if neither is.
+func Keys(storageDir string) (*Encryption, error) {
+	enc := &Encryption{Passphrase: os.Getenv(PassphraseEnv)}
+	key, err := LoadKey(filepath.Join(storageDir, KeyFile), false)
+	if err == nil {
+		enc.Key = key
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if enc.Key == nil && enc.Passphrase == "" {
+		return nil, nil
+	}
+	return enc, nil
+}
+
+// Dir is where archives go, configured or the default under storageDir.
+func Dir(storageDir, configured string) string {
+	if configured != "" {
+		return configured
+	}
+	return filepath.Join(storageDir, "backups")
+}
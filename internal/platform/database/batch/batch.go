@@ -0,0 +1,160 @@
+// Package batch coalesces frequent small writes (counters, heartbeats) into
+// fewer transactions. Each commit syncs to disk, so many tiny Updates cost
+// far more than one Update doing all of them:
+//
+//	w := batch.New(a.DB, batch.Options{OnError: func(err error) {
+//		a.Log.Errorf("batched write failed: %v", err)
+//	}})
+//	a.AddCleanup(w.Close) // after the DB is opened, so it runs before it closes
+//	w.Queue(func(txn kv.Txn) error {
+//		return database.TxnPut(txn, *database.MyDBI, key, hits)
+//	})
+//
+// Writes queued within Window of the first pending one share a transaction.
+// Close commits whatever is pending, so nothing queued before it is lost
+// on a clean shutdown (a crash still loses up to Window of writes).
+package batch
+
+import (
+	"errors"
+	"slices"
+	"sprout/internal/platform/database/kv"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultWindow = 10 * time.Millisecond
+	DefaultMaxOps = 1000
+)
+
+// ErrClosed is returned for writes after Close.
+var ErrClosed = errors.New("batch writer is closed")
+
+type Options struct {
+	Window  time.Duration // how long the first pending write waits for company, DefaultWindow if 0
+	MaxOps  int           // pending writes that trigger a commit right away, DefaultMaxOps if 0
+	OnError func(error)   // failures of Queue'd writes, which have no caller to return them to
+}
+
+// Writer batches writes to a database. Its methods are safe for concurrent
+// use, but must not be called from inside a transaction (will deadlock).
+type Writer struct {
+	db   kv.DB
+	opts Options
+
+	flushMu sync.Mutex // one commit at a time, so batches commit in queue order
+
+	mu      sync.Mutex
+	pending []call
+	timer   *time.Timer
+	closed  bool
+}
+
+type call struct {
+	fn   func(txn kv.Txn) error
+	done chan error // nil for Queue
+}
+
+func (c call) finish(err error, onErr func(error)) {
+	if c.done != nil {
+		c.done <- err
+	} else if err != nil && onErr != nil {
+		onErr(err)
+	}
+}
+
+func New(db kv.DB, opts Options) *Writer {
+	if opts.Window <= 0 {
+		opts.Window = DefaultWindow
+	}
+	if opts.MaxOps <= 0 {
+		opts.MaxOps = DefaultMaxOps
+	}
+	return &Writer{db: db, opts: opts}
+}
+
+// Update runs fn in the next batch and waits for it to commit, returning
+// fn's error or the commit's. A failing fn doesn't affect the others in its
+// batch: the batch is rolled back and retried without it, so fn may run more
+// than once and must not have side effects outside txn.
+func (w *Writer) Update(fn func(txn kv.Txn) error) error {
+	done := make(chan error, 1)
+	if err := w.enqueue(call{fn: fn, done: done}); err != nil {
+		return err
+	}
+	return <-done
+}
+
+// Queue is Update without waiting, errors go to Options.OnError. It only
+// fails once the Writer is closed.
+func (w *Writer) Queue(fn func(txn kv.Txn) error) error {
+	return w.enqueue(call{fn: fn})
+}
+
+func (w *Writer) enqueue(c call) error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return ErrClosed
+	}
+	w.pending = append(w.pending, c)
+	full := len(w.pending) >= w.opts.MaxOps
+	if !full && w.timer == nil {
+		w.timer = time.AfterFunc(w.opts.Window, func() { w.Flush() })
+	}
+	w.mu.Unlock()
+
+	if full {
+		w.Flush() // errors reach the callers
+	}
+	return nil
+}
+
+// Flush commits the pending writes now. It returns an error if the
+// transaction couldn't be committed, failures of single writes go to their
+// callers.
+func (w *Writer) Flush() error {
+	w.flushMu.Lock()
+	defer w.flushMu.Unlock()
+
+	w.mu.Lock()
+	calls := w.pending
+	w.pending = nil
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	w.mu.Unlock()
+
+	for len(calls) > 0 {
+		failed, fnErr := -1, error(nil)
+		err := w.db.Update(func(txn kv.Txn) error {
+			for i, c := range calls {
+				if err := c.fn(txn); err != nil {
+					failed, fnErr = i, err
+					return err
+				}
+			}
+			return nil
+		})
+		if failed < 0 {
+			for _, c := range calls {
+				c.finish(err, w.opts.OnError)
+			}
+			return err
+		}
+		calls[failed].finish(fnErr, w.opts.OnError)
+		calls = slices.Delete(calls, failed, failed+1)
+	}
+	return nil
+}
+
+// Close commits the pending writes and rejects new ones. Add it as a cleanup
+// after opening the database, so it runs before the database closes.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	w.closed = true
+	w.mu.Unlock()
+	return w.Flush()
+}
@@ -0,0 +1,126 @@
+package batch_test
+
+import (
+	"errors"
+	"sprout/internal/platform/database"
+	"sprout/internal/platform/database/batch"
+	"sprout/internal/platform/database/kv"
+	"sprout/internal/testsupport/dbtest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countersDBI is the tests' own DBI, so they don't depend on a feature's schema.
+var countersDBI = database.Register("test-counters")
+
+// countingDB counts write transactions.
+type countingDB struct {
+	kv.DB
+	updates atomic.Int32
+}
+
+func (db *countingDB) Update(fn func(txn kv.Txn) error) error {
+	db.updates.Add(1)
+	return db.DB.Update(fn)
+}
+
+func openDB(t *testing.T) *countingDB {
+	return &countingDB{DB: dbtest.Open(t)}
+}
+
+func get(t *testing.T, db kv.DB, key string) int {
+	t.Helper()
+	v, err := database.View[int](db, *countersDBI, []byte(key))
+	if err != nil {
+		t.Fatalf("View %s: %v", key, err)
+	}
+	return *v
+}
+
+func incr(key string) func(txn kv.Txn) error {
+	return func(txn kv.Txn) error {
+		_, err := database.TxnUpsert(txn, *countersDBI, []byte(key), func() int { return 0 }, func(n *int) error {
+			*n++
+			return nil
+		})
+		return err
+	}
+}
+
+func TestUpdateCoalesces(t *testing.T) {
+	db := openDB(t)
+	w := batch.New(db, batch.Options{Window: 50 * time.Millisecond})
+
+	errBoom := errors.New("boom")
+	var wg sync.WaitGroup
+	errCh := make(chan error, 1)
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if i == 7 {
+				errCh <- w.Update(func(txn kv.Txn) error { return errBoom })
+				return
+			}
+			if err := w.Update(incr("hits")); err != nil {
+				t.Errorf("Update: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := <-errCh; !errors.Is(err, errBoom) {
+		t.Errorf("failing write = %v, want its own error", err)
+	}
+	if got := get(t, db, "hits"); got != 19 {
+		t.Errorf("hits = %d, want 19 (a failing write doesn't roll back the others)", got)
+	}
+	// one batch, plus a retry without the failing write
+	if n := db.updates.Load(); n > 4 {
+		t.Errorf("%d transactions for 20 writes, want them batched", n)
+	}
+}
+
+func TestCloseFlushes(t *testing.T) {
+	db := openDB(t)
+	var failures atomic.Int32
+	w := batch.New(db, batch.Options{Window: time.Hour, OnError: func(error) { failures.Add(1) }})
+
+	for range 5 {
+		if err := w.Queue(incr("beats")); err != nil {
+			t.Fatalf("Queue: %v", err)
+		}
+	}
+	if err := w.Queue(func(txn kv.Txn) error { return errors.New("boom") }); err != nil {
+		t.Fatalf("Queue: %v", err)
+	}
+	if db.updates.Load() != 0 {
+		t.Fatal("queued writes committed before the window")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if got := get(t, db, "beats"); got != 5 {
+		t.Errorf("beats = %d after Close, want 5", got)
+	}
+	if failures.Load() != 1 {
+		t.Errorf("OnError called %d times, want 1", failures.Load())
+	}
+	if err := w.Queue(incr("beats")); !errors.Is(err, batch.ErrClosed) {
+		t.Errorf("Queue after Close = %v, want ErrClosed", err)
+	}
+}
+
+func TestMaxOps(t *testing.T) {
+	db := openDB(t)
+	w := batch.New(db, batch.Options{Window: time.Hour, MaxOps: 3})
+	defer w.Close()
+	for range 3 {
+		w.Queue(incr("n"))
+	}
+	if got := get(t, db, "n"); got != 3 {
+		t.Errorf("n = %d, want a commit once MaxOps writes are pending", got)
+	}
+}
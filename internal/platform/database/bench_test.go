@@ -0,0 +1,100 @@
+package database
+
+import (
+	"path/filepath"
+	"sprout/internal/platform/database/kv"
+	"sprout/internal/types"
+	"testing"
+
+	"github.com/Data-Corruption/stdx/xlog"
+)
+
+// Run with scripts/bench.sh to compare against the saved baseline.
+
+func benchDB(b *testing.B) kv.DB {
+	b.Helper()
+	dir := b.TempDir()
+	logger, err := xlog.New(filepath.Join(dir, "logs"), "none")
+	if err != nil {
+		b.Fatalf("Failed to create logger: %v", err)
+	}
+	b.Cleanup(func() { logger.Close() })
+	db, err := New(filepath.Join(dir, "db"), logger)
+	if err != nil {
+		b.Fatalf("Failed to create db: %v", err)
+	}
+	b.Cleanup(db.Close)
+	return db
+}
+
+func BenchmarkTxnMarshalAndPut(b *testing.B) {
+	db := benchDB(b)
+	cfg := types.DefaultConfig()
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := db.Update(func(txn kv.Txn) error {
+			return TxnMarshalAndPut(txn, *ConfigDBI, []byte(ConfigDataKey), cfg)
+		}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTxnGetAndUnmarshal(b *testing.B) {
+	db := benchDB(b)
+	b.ReportAllocs()
+	for b.Loop() {
+		var cfg types.Configuration
+		if err := db.View(func(txn kv.Txn) error {
+			return TxnGetAndUnmarshal(txn, *ConfigDBI, []byte(ConfigDataKey), &cfg)
+		}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkUpdateConfig is config.Update, the read-modify-write every settings change does.
+func BenchmarkUpdateConfig(b *testing.B) {
+	db := benchDB(b)
+	b.ReportAllocs()
+	for b.Loop() {
+		if err := Update(db, *ConfigDBI, []byte(ConfigDataKey), func(cfg *types.Configuration) error {
+			cfg.StartCounter++
+			return nil
+		}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkUpdateConfigContended measures writers queuing on the single
+// update goroutine, e.g. many handlers touching the config at once.
+func BenchmarkUpdateConfigContended(b *testing.B) {
+	db := benchDB(b)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if err := Update(db, *ConfigDBI, []byte(ConfigDataKey), func(cfg *types.Configuration) error {
+				cfg.StartCounter++
+				return nil
+			}); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
+
+// BenchmarkViewConfigParallel is config.View from many readers, which LMDB should scale well.
+func BenchmarkViewConfigParallel(b *testing.B) {
+	db := benchDB(b)
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := View[types.Configuration](db, *ConfigDBI, []byte(ConfigDataKey)); err != nil {
+				b.Error(err)
+				return
+			}
+		}
+	})
+}
@@ -1,22 +1,173 @@
 package config
 
 import (
+	"context"
+	"fmt"
 	"sprout/internal/platform/database"
+	"sprout/internal/platform/database/kv"
 	"sprout/internal/types"
-
-	"github.com/Data-Corruption/lmdb-go/wrap"
+	"sprout/pkg/errs"
+	"sync"
 )
 
-// View retrieves a copy of the current configuration from the database.
+// View retrieves a copy of the current configuration from the database, with
+// the selected profile's values (see Profile) and then the config file's
+// layered over it (see UseFile).
 //
 // WARNING: Starts a transaction. Avoid nesting transactions (will deadlock).
-func View(db *wrap.DB) (*types.Configuration, error) {
-	return database.View[types.Configuration](db, *database.ConfigDBI, []byte(database.ConfigDataKey))
+func View(db kv.DB) (*types.Configuration, error) {
+	var cfg *types.Configuration
+	err := db.View(func(txn kv.Txn) error {
+		var err error
+		if cfg, err = database.TxnView[types.Configuration](txn, *database.ConfigDBI, []byte(database.ConfigDataKey)); err != nil {
+			return err
+		}
+		rec, err := txnProfiles(txn)
+		if err != nil {
+			return err
+		}
+		return rec.apply(rec.active(db), cfg)
+	})
+	if err != nil {
+		return nil, missing(err)
+	}
+	return cfg, layer(db, cfg)
 }
 
-// Update updates the configuration in the database using the provided update function.
+// Update updates the configuration in the database using the provided update
+// function. It gets the database's values and the selected profile's, without
+// the config file's. The settings it changes go to the selected profile if
+// there is one, everything else to the database. Changed settings are
+// recorded as SourceApp, see UpdateFrom.
 //
 // WARNING: Starts a transaction. Avoid nesting transactions (will deadlock).
-func Update(db *wrap.DB, updateFunc func(cfg *types.Configuration) error) error {
-	return database.Update(db, *database.ConfigDBI, []byte(database.ConfigDataKey), updateFunc)
+func Update(db kv.DB, updateFunc func(cfg *types.Configuration) error) error {
+	return UpdateFrom(db, SourceApp, updateFunc)
+}
+
+// UpdateFrom is Update for a change made through source (Source*), which
+// History shows.
+func UpdateFrom(db kv.DB, source string, updateFunc func(cfg *types.Configuration) error) error {
+	var updated types.Configuration
+	err := db.Update(func(txn kv.Txn) error {
+		cfg, err := database.TxnView[types.Configuration](txn, *database.ConfigDBI, []byte(database.ConfigDataKey))
+		if err != nil {
+			return err
+		}
+		rec, err := txnProfiles(txn)
+		if err != nil {
+			return err
+		}
+		profile := rec.active(db)
+		if profile == "" {
+			var prev types.Configuration
+			if err := copyConfig(&prev, cfg); err != nil {
+				return err
+			}
+			if err := updateFunc(cfg); err != nil {
+				return err
+			}
+			updated = *cfg
+			if err := txnRecord(txn, source, "", &prev, cfg); err != nil {
+				return fmt.Errorf("failed to record config change: %w", err)
+			}
+			return database.TxnPut(txn, *database.ConfigDBI, []byte(database.ConfigDataKey), *cfg)
+		}
+
+		var prev types.Configuration
+		if err := copyConfig(&prev, cfg); err != nil {
+			return err
+		}
+		if err := rec.apply(profile, &prev); err != nil {
+			return err
+		}
+		var next types.Configuration
+		if err := copyConfig(&next, &prev); err != nil {
+			return err
+		}
+		if err := updateFunc(&next); err != nil {
+			return err
+		}
+		for _, key := range recorded {
+			v, _ := Lookup(cfg, key)
+			nv, _ := Lookup(&next, key)
+			v.Set(nv)
+		}
+		if err := rec.set(profile, &prev, &next); err != nil {
+			return err
+		}
+		if err := txnRecord(txn, source, profile, &prev, &next); err != nil {
+			return fmt.Errorf("failed to record config change: %w", err)
+		}
+		updated = next
+		if err := database.TxnPut(txn, *database.ConfigDBI, []byte(database.ConfigDataKey), *cfg); err != nil {
+			return err
+		}
+		return database.TxnPut(txn, *database.ConfigDBI, []byte(database.ConfigProfilesKey), rec)
+	})
+	if err != nil {
+		return missing(err)
+	}
+	if err := layer(db, &updated); err != nil {
+		return err
+	}
+	publish(db, updated)
+	return nil
+}
+
+var (
+	watchMu  sync.Mutex
+	watchers = map[kv.DB]map[chan types.Configuration]struct{}{}
+)
+
+// Watch returns a channel that receives the configuration after each
+// successful Update of db in this process, so subsystems can apply settings
+// without polling or a restart. A slow receiver only gets the latest one.
+// The channel is closed once ctx is done.
+//
+// Changes made by other processes (e.g. `service set` while the service
+// runs) aren't seen, those still apply on restart. Slices and maps in the
+// value are shared between receivers, don't modify them.
+func Watch(ctx context.Context, db kv.DB) <-chan types.Configuration {
+	ch := make(chan types.Configuration, 1)
+	watchMu.Lock()
+	if watchers[db] == nil {
+		watchers[db] = make(map[chan types.Configuration]struct{})
+	}
+	watchers[db][ch] = struct{}{}
+	watchMu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		watchMu.Lock()
+		defer watchMu.Unlock()
+		delete(watchers[db], ch)
+		if len(watchers[db]) == 0 {
+			delete(watchers, db)
+		}
+		close(ch)
+	}()
+	return ch
+}
+
+// publish hands cfg to db's watchers, replacing any value not yet received.
+func publish(db kv.DB, cfg types.Configuration) {
+	watchMu.Lock()
+	defer watchMu.Unlock()
+	for ch := range watchers[db] {
+		select {
+		case <-ch:
+		default:
+		}
+		ch <- cfg // only sent under watchMu, so the drain made room
+	}
+}
+
+// missing reclassifies a missing config as internal, migrations always create
+// it so a request for it can't be what's wrong (i.e. no 404 for "/").
+func missing(err error) error {
+	if errs.Is(err, errs.NotFound) || kv.IsNotFound(err) {
+		return errs.Wrap(errs.Internal, err, "configuration missing, database not migrated?")
+	}
+	return err
 }
@@ -0,0 +1,614 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"sprout/internal/testsupport/dbtest"
+	"sprout/internal/types"
+	"sprout/pkg/errs"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWatch(t *testing.T) {
+	db := dbtest.Open(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := Watch(ctx, db)
+	setLevel := func(level string) {
+		t.Helper()
+		if err := Update(db, func(cfg *types.Configuration) error {
+			cfg.LogLevel = level
+			return nil
+		}); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+	}
+
+	// unreceived values are replaced by the latest
+	setLevel("INFO")
+	setLevel("ERROR")
+	if cfg := <-ch; cfg.LogLevel != "ERROR" {
+		t.Errorf("LogLevel = %q, want ERROR", cfg.LogLevel)
+	}
+	select {
+	case cfg := <-ch:
+		t.Errorf("got a second value %+v, want only the latest", cfg)
+	default:
+	}
+
+	// failed updates aren't published
+	if err := Update(db, func(cfg *types.Configuration) error {
+		cfg.LogLevel = "DEBUG"
+		return errors.New("nope")
+	}); err == nil {
+		t.Fatal("Update with a failing func succeeded")
+	}
+	select {
+	case cfg := <-ch:
+		t.Errorf("got %+v from a failed update", cfg)
+	default:
+	}
+
+	cancel()
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Error("channel still open after cancel")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("channel not closed after cancel")
+	}
+	setLevel("WARN") // no watchers left to block
+}
+
+func TestFields(t *testing.T) {
+	cfg := types.DefaultConfig()
+	keys := map[string]bool{}
+	for _, f := range Fields(&cfg) {
+		keys[f.Key] = true
+	}
+	for _, key := range []string{"port", "backup.schedule", "janitor.logMaxFiles", "webhooks", "lastUpdateCheck"} {
+		if !keys[key] {
+			t.Errorf("Fields() lacks %q", key)
+		}
+	}
+	if keys["backup"] {
+		t.Error("Fields() lists the backup struct instead of its fields")
+	}
+
+	for _, tt := range []struct {
+		key, value string
+		ok         bool
+	}{
+		{"port", "8080", true},
+		{"port", "http", false},
+		{"updateNotifications", "false", true},
+		{"backup.keepLast", "3", true},
+		{"netWaitProbes", `["dns:example.com"]`, true},
+		{"netWaitProbes", "dns:example.com", false},
+		{"lastUpdateCheck", "2026-01-02T03:04:05Z", true},
+		{"backup", `{"schedule": "@daily"}`, true},
+	} {
+		v, err := Lookup(&cfg, tt.key)
+		if err != nil {
+			t.Fatalf("Lookup(%q): %v", tt.key, err)
+		}
+		before := Format(v)
+		err = Parse(v, tt.value)
+		if tt.ok != (err == nil) {
+			t.Errorf("Parse(%s, %q) = %v", tt.key, tt.value, err)
+			continue
+		}
+		if err != nil {
+			if !errs.Is(err, errs.Invalid) || Format(v) != before {
+				t.Errorf("Parse(%s, %q) = %v, value now %s, want it unchanged", tt.key, tt.value, err, Format(v))
+			}
+		} else if tt.key != "backup" && Format(v) != tt.value {
+			t.Errorf("Format(%s) = %q after setting %q", tt.key, Format(v), tt.value)
+		}
+	}
+	if cfg.Port != 8080 || cfg.Backup.Schedule != "@daily" || cfg.Backup.KeepLast != 0 {
+		t.Errorf("cfg = port %d, backup %+v", cfg.Port, cfg.Backup)
+	}
+
+	for _, key := range []string{"nope", "port.x", "backup.nope", "lastUpdateCheck.year"} {
+		if _, err := Lookup(&cfg, key); !errs.Is(err, errs.NotFound) {
+			t.Errorf("Lookup(%q) = %v, want not found", key, err)
+		}
+	}
+
+	// secrets are redacted in listings only, nested ones too
+	cfg.ReleaseToken = "tok3n"
+	cfg.Webhooks = []types.Webhook{{URL: "https://example.com", Secret: "k3y"}}
+	token, _ := Lookup(&cfg, "releaseToken")
+	webhooks, _ := Lookup(&cfg, "webhooks")
+	if got := FormatRedacted(token); got != types.Redacted {
+		t.Errorf("FormatRedacted(releaseToken) = %q", got)
+	}
+	if got := FormatRedacted(webhooks); strings.Contains(got, "k3y") || !strings.Contains(got, "example.com") {
+		t.Errorf("FormatRedacted(webhooks) = %q", got)
+	}
+	if Format(token) != "tok3n" || cfg.Webhooks[0].Secret != "k3y" {
+		t.Errorf("Format(releaseToken) = %q, webhook secret %q after redacting", Format(token), cfg.Webhooks[0].Secret.Reveal())
+	}
+}
+
+func TestFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	if f, err := LoadFile(filepath.Join(dir, FileName)); f != nil || err != nil {
+		t.Fatalf("LoadFile(missing) = %v, %v, want nothing", f, err)
+	}
+	for name, content := range map[string]string{
+		"unknown.yaml":  "prot: 8080\n",
+		"type.yaml":     "port: eighty\n",
+		"recorded.yaml": "startCounter: 3\n",
+		"syntax.yaml":   "port: [\n",
+	} {
+		if _, err := LoadFile(write(name, content)); !errs.Is(err, errs.Invalid) {
+			t.Errorf("LoadFile(%s) = %v, want invalid", name, err)
+		}
+	}
+
+	f, err := LoadFile(write(FileName, "port: 9000\nbackup:\n  schedule: \"@daily\"\nnetWaitProbes: [\"dns:example.com\"]\n"))
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if want := []string{"backup.schedule", "netWaitProbes", "port"}; !slices.Equal(f.Keys, want) {
+		t.Errorf("Keys = %v, want %v", f.Keys, want)
+	}
+	if !f.Sets("backup") || !f.Sets("port") || f.Sets("backup.keepLast") || f.Sets("host") {
+		t.Error("Sets() doesn't match Keys")
+	}
+
+	// View layers it over the database, Update keeps writing the database
+	db := dbtest.Open(t)
+	if err := Update(db, func(cfg *types.Configuration) error {
+		cfg.Port, cfg.Host, cfg.Backup.KeepLast = 8080, "example.com", 3
+		return nil
+	}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	UseFile(db, f)
+	defer UseFile(db, nil)
+	cfg, err := View(db)
+	if err != nil {
+		t.Fatalf("View: %v", err)
+	}
+	if cfg.Port != 9000 || cfg.Backup.Schedule != "@daily" || cfg.Host != "example.com" || cfg.Backup.KeepLast != 3 {
+		t.Errorf("View() = port %d, host %q, backup %+v", cfg.Port, cfg.Host, cfg.Backup)
+	}
+	if err := Update(db, func(cfg *types.Configuration) error {
+		if cfg.Port != 8080 {
+			t.Errorf("Update got port %d, want the database's 8080", cfg.Port)
+		}
+		return nil
+	}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+}
+
+func TestEnv(t *testing.T) {
+	env := map[string]string{}
+	lookup := func(name string) (string, bool) {
+		v, ok := env[name]
+		return v, ok
+	}
+	if prefix := EnvPrefix("my-app"); prefix != "MY_APP_" {
+		t.Fatalf("EnvPrefix = %q", prefix)
+	}
+	if f, err := LoadEnv("APP_", lookup); f != nil || err != nil {
+		t.Fatalf("LoadEnv(empty) = %v, %v, want nothing", f, err)
+	}
+	env["APP_PORT"] = "eighty"
+	if _, err := LoadEnv("APP_", lookup); !errs.Is(err, errs.Invalid) || !strings.Contains(err.Error(), "APP_PORT") {
+		t.Errorf("LoadEnv(bad port) = %v, want invalid APP_PORT", err)
+	}
+
+	env["APP_PORT"], env["APP_BACKUP_SCHEDULE"], env["PORT"] = "9100", "@weekly", "1"
+	f, err := LoadEnv("APP_", lookup)
+	if err != nil {
+		t.Fatalf("LoadEnv: %v", err)
+	}
+	if want := []string{"backup.schedule", "port"}; !slices.Equal(f.Keys, want) {
+		t.Errorf("Keys = %v, want %v", f.Keys, want)
+	}
+
+	// over the config file, which still sets what the environment doesn't
+	path := filepath.Join(t.TempDir(), FileName)
+	if err := os.WriteFile(path, []byte("port: 9000\nhost: example.com\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	db := dbtest.Open(t)
+	UseFile(db, file)
+	defer UseFile(db, nil)
+	UseEnv(db, f)
+	defer UseEnv(db, nil)
+	cfg, err := View(db)
+	if err != nil {
+		t.Fatalf("View: %v", err)
+	}
+	if cfg.Port != 9100 || cfg.Host != "example.com" || cfg.Backup.Schedule != "@weekly" {
+		t.Errorf("View() = port %d, host %q, schedule %q", cfg.Port, cfg.Host, cfg.Backup.Schedule)
+	}
+	if layers := Layers(db); len(layers) != 2 || layers[1] != f {
+		t.Errorf("Layers() = %v, want the file then the environment", layers)
+	}
+}
+
+func TestSources(t *testing.T) {
+	db := dbtest.Open(t)
+	if err := Update(db, func(cfg *types.Configuration) error {
+		cfg.Port, cfg.Host, cfg.LogLevel = 9000, "db.example.com", "INFO"
+		return nil
+	}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := CreateProfile(db, "dev", ""); err != nil {
+		t.Fatalf("CreateProfile: %v", err)
+	}
+	if err := UseProfile(db, "dev"); err != nil {
+		t.Fatalf("UseProfile: %v", err)
+	}
+	defer UseProfile(db, "")
+	if err := Update(db, func(cfg *types.Configuration) error {
+		cfg.LogLevel = "DEBUG"
+		return nil
+	}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	if _, err := LoadFlags(map[string]string{"port": "eighty"}); !errs.Is(err, errs.Invalid) || !strings.Contains(err.Error(), "flag for port") {
+		t.Errorf("LoadFlags(bad port) = %v, want invalid flag for port", err)
+	}
+	path := filepath.Join(t.TempDir(), FileName)
+	if err := os.WriteFile(path, []byte("port: 9100\nhost: file.example.com\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	file, err := LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	env, err := LoadEnv("APP_", func(name string) (string, bool) {
+		return map[string]string{"APP_PORT": "9200"}[name], name == "APP_PORT"
+	})
+	if err != nil {
+		t.Fatalf("LoadEnv: %v", err)
+	}
+	flags, err := LoadFlags(map[string]string{"port": "9300"})
+	if err != nil {
+		t.Fatalf("LoadFlags: %v", err)
+	}
+	UseFile(db, file)
+	defer UseFile(db, nil)
+	UseEnv(db, env)
+	defer UseEnv(db, nil)
+	UseFlags(db, flags)
+	defer UseFlags(db, nil)
+
+	cfg, err := View(db)
+	if err != nil || cfg.Port != 9300 {
+		t.Fatalf("View() = port %d, %v, want the flag's 9300", cfg.Port, err)
+	}
+	sources, err := Sources(db)
+	if err != nil {
+		t.Fatalf("Sources: %v", err)
+	}
+	from := map[string]string{}
+	for _, s := range sources {
+		from[s.Key] = s.From + " " + Format(s.Value)
+		if Recorded(s.Key) {
+			t.Errorf("Sources() has recorded value %s", s.Key)
+		}
+	}
+	for key, want := range map[string]string{
+		"port":            FlagsPath + " 9300",
+		"host":            FileName + " file.example.com",
+		"logLevel":        FromProfile + " dev DEBUG",
+		"backup.schedule": FromDefault + " " + types.DefaultConfig().Backup.Schedule,
+	} {
+		if from[key] != want {
+			t.Errorf("Sources()[%s] = %q, want %q", key, from[key], want)
+		}
+	}
+
+	// without the layers and the profile the database's values show
+	UseFlags(db, nil)
+	UseEnv(db, nil)
+	UseFile(db, nil)
+	UseProfile(db, DefaultProfile)
+	if sources, err = Sources(db); err != nil {
+		t.Fatalf("Sources: %v", err)
+	}
+	for _, s := range sources {
+		if s.Key == "port" && (s.From != FromDatabase || s.Value.Int() != 9000) {
+			t.Errorf("Sources()[port] = %s %s, want database 9000", s.From, Format(s.Value))
+		}
+	}
+}
+
+func TestProfiles(t *testing.T) {
+	db := dbtest.Open(t)
+	if err := Update(db, func(cfg *types.Configuration) error {
+		cfg.Port, cfg.LogLevel = 9000, "INFO"
+		return nil
+	}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	for _, name := range []string{"Dev", "", DefaultProfile, "a/b"} {
+		if err := CreateProfile(db, name, ""); !errs.Is(err, errs.Invalid) {
+			t.Errorf("CreateProfile(%q) = %v, want invalid", name, err)
+		}
+	}
+	if err := CreateProfile(db, "dev", ""); err != nil {
+		t.Fatalf("CreateProfile: %v", err)
+	}
+	if err := CreateProfile(db, "dev", ""); !errs.Is(err, errs.Conflict) {
+		t.Errorf("CreateProfile(existing) = %v, want conflict", err)
+	}
+	if err := UseProfile(db, "prod"); !errs.Is(err, errs.NotFound) {
+		t.Errorf("UseProfile(unknown) = %v, want not found", err)
+	}
+
+	// settings changed while a profile is in use go to it, recorded values to the database
+	if err := UseProfile(db, "dev"); err != nil {
+		t.Fatalf("UseProfile: %v", err)
+	}
+	defer UseProfile(db, "")
+	if err := Update(db, func(cfg *types.Configuration) error {
+		if cfg.Port != 9000 {
+			t.Errorf("Update in an empty profile got port %d, want the database's 9000", cfg.Port)
+		}
+		cfg.Port, cfg.NetWaitProbes, cfg.StartCounter = 8080, []string{"dns:example.com"}, 7
+		return nil
+	}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	cfg, err := View(db)
+	if err != nil {
+		t.Fatalf("View: %v", err)
+	}
+	if cfg.Port != 8080 || cfg.LogLevel != "INFO" || !slices.Equal(cfg.NetWaitProbes, []string{"dns:example.com"}) {
+		t.Errorf("View(dev) = port %d, log level %q, probes %v", cfg.Port, cfg.LogLevel, cfg.NetWaitProbes)
+	}
+	if err := UseProfile(db, DefaultProfile); err != nil {
+		t.Fatalf("UseProfile: %v", err)
+	}
+	if cfg, err = View(db); err != nil || cfg.Port != 9000 || len(cfg.NetWaitProbes) != 0 || cfg.StartCounter != 7 {
+		t.Errorf("View(default) = port %d, probes %v, start counter %d, %v", cfg.Port, cfg.NetWaitProbes, cfg.StartCounter, err)
+	}
+
+	// copies, picking one for every process, deleting it
+	if err := CreateProfile(db, "prod", "dev"); err != nil {
+		t.Fatalf("CreateProfile(from): %v", err)
+	}
+	if err := ActivateProfile(db, "prod"); err != nil {
+		t.Fatalf("ActivateProfile: %v", err)
+	}
+	UseProfile(db, "")
+	if name, err := ActiveProfile(db); name != "prod" || err != nil {
+		t.Errorf("ActiveProfile() = %q, %v, want prod", name, err)
+	}
+	profiles, err := Profiles(db)
+	if err != nil || len(profiles) != 2 || !profiles[1].Active || len(profiles[1].Fields()) != 2 {
+		t.Fatalf("Profiles() = %+v, %v", profiles, err)
+	}
+	if cfg, err = View(db); err != nil || cfg.Port != 8080 {
+		t.Errorf("View(prod) = port %d, %v, want 8080", cfg.Port, err)
+	}
+	if err := DeleteProfile(db, "prod"); err != nil {
+		t.Fatalf("DeleteProfile: %v", err)
+	}
+	if cfg, err = View(db); err != nil || cfg.Port != 9000 {
+		t.Errorf("View() after deleting the active profile = port %d, %v, want 9000", cfg.Port, err)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	db := dbtest.Open(t)
+	if err := UpdateFrom(db, SourceCLI, func(cfg *types.Configuration) error {
+		cfg.Port, cfg.ReleaseToken, cfg.StartCounter = 9000, "hunter2", 3
+		return nil
+	}); err != nil {
+		t.Fatalf("UpdateFrom: %v", err)
+	}
+	// recorded values and no-ops aren't changes of the settings
+	if err := Update(db, func(cfg *types.Configuration) error {
+		cfg.StartCounter++
+		return nil
+	}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := CreateProfile(db, "dev", ""); err != nil {
+		t.Fatalf("CreateProfile: %v", err)
+	}
+	if err := UseProfile(db, "dev"); err != nil {
+		t.Fatalf("UseProfile: %v", err)
+	}
+	defer UseProfile(db, "")
+	if err := Update(db, func(cfg *types.Configuration) error {
+		cfg.LogLevel = "ERROR"
+		return nil
+	}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	history, err := History(db, 0)
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("History() = %+v, want 2 revisions", history)
+	}
+	if rev := history[0]; rev.Source != SourceApp || rev.Profile != "dev" || len(rev.Fields) != 1 || rev.Fields[0].Key != "logLevel" || rev.Fields[0].New != "ERROR" {
+		t.Errorf("newest revision = %+v", rev)
+	}
+	rev := history[1]
+	if rev.Source != SourceCLI || rev.Profile != "" || len(rev.Fields) != 2 {
+		t.Fatalf("oldest revision = %+v, want port and releaseToken from the cli", rev)
+	}
+	if f := rev.Fields[0]; f.Key != "port" || f.New != "9000" {
+		t.Errorf("port change = %+v", f)
+	}
+	if f := rev.Fields[1]; f.Key != "releaseToken" || f.Old != "" || f.New != types.Redacted {
+		t.Errorf("releaseToken change = %+v, want it redacted", f)
+	}
+	if h, _ := History(db, 1); len(h) != 1 || h[0].Source != SourceApp {
+		t.Errorf("History(1) = %+v, want the newest", h)
+	}
+}
+
+func TestRollback(t *testing.T) {
+	db := dbtest.Open(t)
+	if _, _, err := Rollback(db, SourceCLI, 1); !errs.Is(err, errs.NotFound) {
+		t.Fatalf("Rollback(no snapshots) = %v, want not found", err)
+	}
+	for _, port := range []int{9001, 9002} {
+		if err := UpdateFrom(db, SourceCLI, func(cfg *types.Configuration) error {
+			cfg.Port = port
+			return nil
+		}); err != nil {
+			t.Fatalf("UpdateFrom: %v", err)
+		}
+	}
+	if err := Update(db, func(cfg *types.Configuration) error {
+		cfg.StartCounter = 5
+		return nil
+	}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	snaps, err := Snapshots(db)
+	if err != nil || len(snaps) != 2 || snaps[0].Source != SourceCLI {
+		t.Fatalf("Snapshots() = %+v, %v, want one per change of the settings", snaps, err)
+	}
+
+	// back before the first change, recorded values stay
+	snap, changed, err := Rollback(db, SourceWeb, 2)
+	if err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+	if !snap.Time.Equal(snaps[1].Time) || len(changed) != 1 || changed[0].Key != "port" || changed[0].Old != "9002" {
+		t.Errorf("Rollback(2) = %+v, %+v", snap, changed)
+	}
+	cfg, err := View(db)
+	if err != nil {
+		t.Fatalf("View: %v", err)
+	}
+	if def := types.DefaultConfig(); cfg.Port != def.Port || cfg.StartCounter != 5 {
+		t.Errorf("after rollback port = %d, start counter = %d, want %d and 5", cfg.Port, cfg.StartCounter, def.Port)
+	}
+
+	// a rollback is a change too, rolling back again undoes it
+	if history, _ := History(db, 1); len(history) != 1 || history[0].Source != SourceWeb {
+		t.Errorf("History(1) = %+v, want the rollback", history)
+	}
+	if _, _, err := Rollback(db, SourceCLI, 1); err != nil {
+		t.Fatalf("Rollback: %v", err)
+	}
+	if cfg, _ := View(db); cfg.Port != 9002 {
+		t.Errorf("port after undoing the rollback = %d, want 9002", cfg.Port)
+	}
+}
+
+type testSection struct {
+	Addr    string `json:"addr" env:"ADDR" desc:"Listen address."`
+	Workers int    `json:"workers" env:"WORKERS" validate:"min=1,max=8" desc:"Worker count."`
+	Label   string `json:"label" desc:"Free text, not \"bad\"."`
+}
+
+func (s *testSection) Validate() types.FieldErrors {
+	if s.Label == "bad" {
+		return types.FieldErrors{{Field: "label", Message: "can't be bad"}}
+	}
+	return nil
+}
+
+var testSec = NewSection("testsec", func() testSection { return testSection{Addr: ":9100", Workers: 2} })
+
+func TestSection(t *testing.T) {
+	for _, name := range []string{"port", "testsec", "Bad", "startCounter"} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewSection(%q) didn't panic", name)
+				}
+			}()
+			NewSection(name, func() testSection { return testSection{} })
+		}()
+	}
+
+	db := dbtest.Open(t)
+	if v, err := testSec.View(db); err != nil || v.Addr != ":9100" || v.Workers != 2 {
+		t.Errorf("View(nothing stored) = %+v, %v, want the defaults", v, err)
+	}
+	if err := testSec.Update(db, func(v *testSection) error {
+		v.Workers = 4
+		return nil
+	}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	for _, fn := range []func(v *testSection){
+		func(v *testSection) { v.Workers = 9 },
+		func(v *testSection) { v.Label = "bad" },
+	} {
+		err := testSec.Update(db, func(v *testSection) error { fn(v); return nil })
+		var fe types.FieldErrors
+		if !errs.Is(err, errs.Invalid) || !errors.As(err, &fe) || !strings.HasPrefix(fe[0].Field, "testsec.") {
+			t.Errorf("Update(invalid) = %v, want invalid testsec field", err)
+		}
+	}
+	if v, err := testSec.View(db); err != nil || v.Addr != ":9100" || v.Workers != 4 || v.Label != "" {
+		t.Errorf("View() = %+v, %v, want 4 workers stored over the defaults", v, err)
+	}
+	// the Configuration is untouched
+	if cfg, err := View(db); err != nil || cfg.Port != types.DefaultConfig().Port {
+		t.Errorf("View() = %+v, %v", cfg, err)
+	}
+
+	// the config file and the environment win, under the section's name
+	if _, err := ParseFile(FileName, []byte("testsec:\n  nope: 1\n")); !errs.Is(err, errs.Invalid) {
+		t.Errorf("ParseFile(unknown section key) = %v, want invalid", err)
+	}
+	file, err := ParseFile(FileName, []byte("port: 9000\ntestsec:\n  addr: \":9200\"\n  workers: 3\n"))
+	if err != nil {
+		t.Fatalf("ParseFile: %v", err)
+	}
+	if !slices.Equal(file.Keys, []string{"port"}) {
+		t.Errorf("Keys = %v, want only the Configuration's", file.Keys)
+	}
+	env, err := LoadEnv("APP_", func(name string) (string, bool) { return "5", name == "APP_TESTSEC_WORKERS" })
+	if err != nil || env == nil {
+		t.Fatalf("LoadEnv = %v, %v", env, err)
+	}
+	if _, err := LoadEnv("APP_", func(name string) (string, bool) { return "many", name == "APP_TESTSEC_WORKERS" }); !errs.Is(err, errs.Invalid) || !strings.Contains(err.Error(), "APP_TESTSEC_WORKERS") {
+		t.Errorf("LoadEnv(bad workers) = %v, want invalid APP_TESTSEC_WORKERS", err)
+	}
+	UseFile(db, file)
+	defer UseFile(db, nil)
+	UseEnv(db, env)
+	defer UseEnv(db, nil)
+	if v, err := testSec.View(db); err != nil || v.Addr != ":9200" || v.Workers != 5 {
+		t.Errorf("View(layered) = %+v, %v, want the file's address and the environment's workers", v, err)
+	}
+	if cfg, err := View(db); err != nil || cfg.Port != 9000 {
+		t.Errorf("View(layered) = port %d, %v, want the file's 9000", cfg.Port, err)
+	}
+}
@@ -0,0 +1,147 @@
+package config
+
+import (
+	"encoding/json"
+	"maps"
+	"reflect"
+	"slices"
+	"sprout/internal/platform/database/kv"
+	"sprout/internal/types"
+	"sprout/pkg/errs"
+	"strings"
+	"sync"
+)
+
+// EnvPath is the Path of the File LoadEnv returns.
+const EnvPath = "environment"
+
+// EnvPrefix returns the prefix of the environment variables LoadEnv reads
+// for the app name, e.g. "SPROUT_".
+func EnvPrefix(name string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "_", ".", "_").Replace(name)) + "_"
+}
+
+// LoadEnv returns the settings set in the environment, nil if none. Each
+// setting with an env tag (see types.Meta) is read from prefix + the tag,
+// e.g. SPROUT_PORT, a Section's from prefix + its name + the tag, e.g.
+// SPROUT_METRICS_ADDR, and parsed like `config set` does. Values that don't
+// parse fail with errs.Invalid. The result is layered over the config
+// file's with UseEnv.
+func LoadEnv(prefix string, lookup func(string) (string, bool)) (*File, error) {
+	meta := types.Meta()
+	raw := map[string]string{}
+	for key, m := range meta {
+		if m.Env == "" {
+			continue
+		}
+		if v, ok := lookup(prefix + m.Env); ok {
+			raw[key] = v
+		}
+	}
+	f, err := parseValues(EnvPath, raw, func(key string) string { return prefix + meta[key].Env })
+	if err != nil {
+		return nil, err
+	}
+
+	for name, t := range registeredSections() {
+		meta := types.MetaOf(t)
+		envName := func(key string) string { return prefix + EnvPrefix(name) + meta[key].Env }
+		raw := map[string]string{}
+		for key, m := range meta {
+			if m.Env == "" {
+				continue
+			}
+			if v, ok := lookup(envName(key)); ok {
+				raw[key] = v
+			}
+		}
+		_, data, err := nest(reflect.New(t).Elem(), raw, envName)
+		if err != nil {
+			return nil, err
+		}
+		if data == nil {
+			continue
+		}
+		if f == nil {
+			f = &File{Path: EnvPath}
+		}
+		if f.sections == nil {
+			f.sections = map[string]json.RawMessage{}
+		}
+		f.sections[name] = data
+	}
+	return f, nil
+}
+
+// parseValues is the File at path setting raw's values by key, parsed like
+// `config set` does, nil if there are none. A value that doesn't parse fails
+// with errs.Invalid naming it by name(key).
+func parseValues(path string, raw map[string]string, name func(key string) string) (*File, error) {
+	var scratch types.Configuration
+	keys, data, err := nest(reflect.ValueOf(&scratch).Elem(), raw, name)
+	if err != nil || keys == nil {
+		return nil, err
+	}
+	return &File{Path: path, Keys: keys, data: data}, nil
+}
+
+// nest parses raw's values by key into scratch, a settings struct, and
+// returns the keys and the values as JSON nested like the config file, nil
+// if there are none.
+func nest(scratch reflect.Value, raw map[string]string, name func(key string) string) ([]string, []byte, error) {
+	values := map[string]any{}
+	var keys []string
+	for _, key := range slices.Sorted(maps.Keys(raw)) {
+		v, err := lookup(scratch, key)
+		if err != nil {
+			return nil, nil, err // a key inside a list, e.g. an env tag there
+		}
+		if err := Parse(v, raw[key]); err != nil {
+			return nil, nil, errs.Wrap(errs.Invalid, err, "invalid "+name(key))
+		}
+		// nested like the config file, Apply unmarshals it over the whole config
+		parts := strings.Split(key, ".")
+		parent := values
+		for _, p := range parts[:len(parts)-1] {
+			if parent[p] == nil {
+				parent[p] = map[string]any{}
+			}
+			parent = parent[p].(map[string]any)
+		}
+		parent[parts[len(parts)-1]] = v.Interface()
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return nil, nil, nil
+	}
+	data, err := json.Marshal(values)
+	if err != nil {
+		return nil, nil, err
+	}
+	return keys, data, nil
+}
+
+var (
+	envsMu sync.Mutex
+	envs   = map[kv.DB]*File{}
+)
+
+// UseEnv layers f (see LoadEnv) over db's config for View in this process,
+// after the config file, nil stops doing so.
+func UseEnv(db kv.DB, f *File) {
+	envsMu.Lock()
+	defer envsMu.Unlock()
+	if f == nil {
+		delete(envs, db)
+		return
+	}
+	envs[db] = f
+}
+
+// EnvOf returns the environment's settings layered over db's config, nil if
+// none.
+func EnvOf(db kv.DB) *File {
+	envsMu.Lock()
+	defer envsMu.Unlock()
+	return envs[db]
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sprout/internal/types"
+	"sprout/pkg/errs"
+)
+
+// Export returns the settings of cfg as an indented JSON object, nested like
+// the config file, for `config export`. Values the app records for itself
+// are left out. Unless secrets, set secrets are types.Redacted, which Import
+// reads as "keep the current value".
+func Export(cfg *types.Configuration, secrets bool) ([]byte, error) {
+	// redacting mustn't touch cfg
+	var cp types.Configuration
+	if err := copyConfig(&cp, cfg); err != nil {
+		return nil, err
+	}
+	if !secrets {
+		redact(reflect.ValueOf(&cp).Elem())
+	}
+
+	// through a map to drop the recorded values, encoding/json sorts its keys
+	var values map[string]any
+	b, err := json.Marshal(cp)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &values); err != nil {
+		return nil, err
+	}
+	for key := range values {
+		if Recorded(key) {
+			delete(values, key)
+		}
+	}
+	return json.MarshalIndent(values, "", "  ")
+}
+
+// Import sets the values of f (e.g. a `config export`, see ParseFile) in
+// cfg. With merge only the keys f has change, otherwise every other setting
+// is reset to its default; recorded values are kept either way. Secrets f has
+// as types.Redacted keep cfg's value. Fails with errs.Invalid, listing the
+// field errors, if the result doesn't validate.
+func Import(cfg *types.Configuration, f *File, merge bool) error {
+	var prev types.Configuration
+	if err := copyConfig(&prev, cfg); err != nil {
+		return err
+	}
+	if !merge {
+		Reset(cfg)
+	}
+	// lists and maps are replaced, json.Unmarshal would merge them item by item
+	for _, key := range f.Keys {
+		if v, err := Lookup(cfg, key); err == nil {
+			v.SetZero()
+		}
+	}
+	if err := f.Apply(cfg); err != nil {
+		return errs.Wrap(errs.Invalid, err, "invalid "+f.Path)
+	}
+	keepRedacted(reflect.ValueOf(cfg).Elem(), reflect.ValueOf(&prev).Elem())
+
+	fe := cfg.Validate()
+	if merge {
+		fe = fe.For(f.Keys...)
+	}
+	if fe != nil {
+		return errs.Wrap(errs.Invalid, fe, fmt.Sprintf("invalid settings in %s", f.Path))
+	}
+	return nil
+}
+
+// Reset sets every setting of cfg to its default (types.DefaultConfig),
+// keeping the values the app records for itself (see Recorded).
+func Reset(cfg *types.Configuration) {
+	next := types.DefaultConfig()
+	for _, field := range Fields(cfg) {
+		if Recorded(field.Key) {
+			v, _ := Lookup(&next, field.Key)
+			v.Set(field.Value)
+		}
+	}
+	*cfg = next
+}
+
+// keepRedacted sets the secrets in v that are types.Redacted to their value
+// in prev, list items matched by index.
+func keepRedacted(v, prev reflect.Value) {
+	switch {
+	case v.Type() == secretType:
+		if v.String() == types.Redacted {
+			v.SetString(prev.String())
+		}
+	case v.Kind() == reflect.Struct && v.Type() != timeType:
+		for i := range v.NumField() {
+			if v.Type().Field(i).IsExported() {
+				keepRedacted(v.Field(i), prev.Field(i))
+			}
+		}
+	case v.Kind() == reflect.Slice:
+		for i := range v.Len() {
+			if i < prev.Len() {
+				keepRedacted(v.Index(i), prev.Index(i))
+			} else {
+				keepRedacted(v.Index(i), reflect.New(v.Type().Elem()).Elem())
+			}
+		}
+	}
+}
+
+// copyConfig deep copies src to dst, sharing no lists or maps.
+func copyConfig(dst, src *types.Configuration) error {
+	b, err := json.Marshal(src)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, dst)
+}
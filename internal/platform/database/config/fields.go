@@ -0,0 +1,267 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"sprout/internal/types"
+	"sprout/pkg/errs"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Field is a configuration value addressed by its JSON path, e.g.
+// "backup.schedule", for `config get/set/list`.
+type Field struct {
+	Key   string
+	Value reflect.Value // settable, points into the Configuration it came from
+}
+
+// recorded are top level keys the app records for itself rather than
+// settings, see Recorded.
+var recorded = []string{
+	"lastUpdateCheck", "updateAvailable", "updateCheckNotBefore", "latestVersion", "autoUpdateAttempt",
+	"releaseCache", "installedVersion", "previousVersion", "pendingUpdateHooks", "lastUpdateRun",
+	"updateRetry", "preUpdateVersion", "startCounter", "recentStarts", "remoteConfigState",
+}
+
+// Recorded reports whether key is (part of) a value the app records for
+// itself, e.g. update state. Those aren't settings, `config set` and the
+// config file refuse them.
+func Recorded(key string) bool {
+	top, _, _ := strings.Cut(key, ".")
+	return slices.Contains(recorded, top)
+}
+
+var (
+	timeType   = reflect.TypeFor[time.Time]()
+	secretType = reflect.TypeFor[types.Secret]()
+)
+
+// Fields returns the values of cfg in declaration order, nested settings
+// (e.g. backup) flattened into their fields. Lists, maps and times are
+// single values.
+func Fields(cfg *types.Configuration) []Field {
+	var fields []Field
+	var walk func(prefix string, v reflect.Value)
+	walk = func(prefix string, v reflect.Value) {
+		for i := range v.NumField() {
+			name := jsonName(v.Type().Field(i))
+			if name == "" {
+				continue
+			}
+			f := v.Field(i)
+			if f.Kind() == reflect.Struct && f.Type() != timeType {
+				walk(prefix+name+".", f)
+				continue
+			}
+			fields = append(fields, Field{Key: prefix + name, Value: f})
+		}
+	}
+	walk("", reflect.ValueOf(cfg).Elem())
+	return fields
+}
+
+// Lookup returns the value at key in cfg, a single value or a whole nested
+// struct. Fails with errs.NotFound for unknown keys.
+func Lookup(cfg *types.Configuration, key string) (reflect.Value, error) {
+	return lookup(reflect.ValueOf(cfg).Elem(), key)
+}
+
+// lookup is Lookup in any settings struct v, e.g. a Section's.
+func lookup(v reflect.Value, key string) (reflect.Value, error) {
+	for part := range strings.SplitSeq(key, ".") {
+		if v.Kind() != reflect.Struct || v.Type() == timeType {
+			return reflect.Value{}, errs.New(errs.NotFound, fmt.Sprintf("unknown config key %q", key))
+		}
+		next := reflect.Value{}
+		for i := range v.NumField() {
+			if jsonName(v.Type().Field(i)) == part {
+				next = v.Field(i)
+				break
+			}
+		}
+		if !next.IsValid() {
+			return reflect.Value{}, errs.New(errs.NotFound, fmt.Sprintf("unknown config key %q", key))
+		}
+		v = next
+	}
+	return v, nil
+}
+
+// Change is a setting that differs between two configurations, see Diff.
+type Change struct {
+	Key      string
+	From, To reflect.Value
+}
+
+// Diff returns the settings that differ between from and to, in Fields
+// order, e.g. what was customized with from as types.DefaultConfig. Values
+// the app records for itself are skipped, empty and unset lists are equal.
+func Diff(from, to *types.Configuration) []Change {
+	var changes []Change
+	toFields := Fields(to)
+	for i, f := range Fields(from) {
+		t := toFields[i].Value
+		if Recorded(f.Key) || isEmpty(f.Value) && isEmpty(t) || Format(f.Value) == Format(t) {
+			continue
+		}
+		changes = append(changes, Change{Key: f.Key, From: f.Value, To: t})
+	}
+	return changes
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
+
+// Format renders v the way Parse reads it back: strings, numbers and bools
+// as is, times in RFC 3339, anything else as JSON.
+func Format(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Float32, reflect.Float64:
+		return fmt.Sprint(v.Interface())
+	}
+	if v.Type() == timeType {
+		return v.Interface().(time.Time).Format(time.RFC3339)
+	}
+	out, err := json.Marshal(v.Interface())
+	if err != nil {
+		return fmt.Sprintf("<%v>", err)
+	}
+	return string(out)
+}
+
+// FormatRedacted is Format with every set types.Secret in v, nested ones
+// too, shown as types.Redacted. For listings, `config get` shows the value.
+func FormatRedacted(v reflect.Value) string {
+	cp := reflect.New(v.Type()).Elem()
+	switch v.Kind() {
+	case reflect.Struct, reflect.Slice, reflect.Map, reflect.Pointer:
+		// deep copy, redacting mustn't touch the config v points into
+		b, err := json.Marshal(v.Interface())
+		if err == nil {
+			err = json.Unmarshal(b, cp.Addr().Interface())
+		}
+		if err != nil {
+			return fmt.Sprintf("<%v>", err)
+		}
+	default:
+		cp.Set(v)
+	}
+	redact(cp)
+	return Format(cp)
+}
+
+func redact(v reflect.Value) {
+	switch {
+	case v.Type() == secretType:
+		if !v.IsZero() {
+			v.SetString(types.Redacted)
+		}
+	case v.Kind() == reflect.Struct && v.Type() != timeType:
+		for i := range v.NumField() {
+			if v.Type().Field(i).IsExported() {
+				redact(v.Field(i))
+			}
+		}
+	case v.Kind() == reflect.Slice || v.Kind() == reflect.Array:
+		for i := range v.Len() {
+			redact(v.Index(i))
+		}
+	case v.Kind() == reflect.Map:
+		for _, k := range v.MapKeys() {
+			e := reflect.New(v.Type().Elem()).Elem()
+			e.Set(v.MapIndex(k))
+			redact(e)
+			v.SetMapIndex(k, e)
+		}
+	case v.Kind() == reflect.Pointer && !v.IsNil():
+		redact(v.Elem())
+	}
+}
+
+// Parse sets v from s according to v's type, see Format. Fails with
+// errs.Invalid if s doesn't fit, leaving v unchanged.
+func Parse(v reflect.Value, s string) error {
+	invalid := func(err error) error {
+		return errs.Wrap(errs.Invalid, err, fmt.Sprintf("want %s", typeName(v.Type())))
+	}
+	switch {
+	case v.Kind() == reflect.String:
+		v.SetString(s)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return invalid(err)
+		}
+		v.SetBool(b)
+	case v.CanInt():
+		n, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return invalid(err)
+		}
+		v.SetInt(n)
+	case v.CanUint():
+		n, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return invalid(err)
+		}
+		v.SetUint(n)
+	case v.CanFloat():
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return invalid(err)
+		}
+		v.SetFloat(n)
+	case v.Type() == timeType:
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			return invalid(err)
+		}
+		v.Set(reflect.ValueOf(t))
+	default:
+		// decoded into a fresh value, so a bad one leaves no partial changes behind
+		p := reflect.New(v.Type())
+		if err := json.Unmarshal([]byte(s), p.Interface()); err != nil {
+			return invalid(err)
+		}
+		v.Set(p.Elem())
+	}
+	return nil
+}
+
+// typeName describes t for Parse errors.
+func typeName(t reflect.Type) string {
+	switch {
+	case t == timeType:
+		return "time (RFC 3339)"
+	case t.Kind() == reflect.String:
+		return "string"
+	case t.Kind() == reflect.Bool:
+		return "bool"
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Float64:
+		return "number"
+	}
+	return "JSON " + t.String()
+}
+
+func jsonName(f reflect.StructField) string {
+	if !f.IsExported() {
+		return ""
+	}
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
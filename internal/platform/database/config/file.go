@@ -0,0 +1,199 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"sprout/internal/platform/database/kv"
+	"sprout/internal/types"
+	"sprout/pkg/errs"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FileName is the optional config file in the storage dir, see LoadFile.
+const FileName = "config.yaml"
+
+// File holds the settings of a config file, layered over the database's by
+// View so deployments can manage them declaratively. Keys are the same as
+// `config set`'s, nested ones as YAML maps:
+//
+//	port: 8080
+//	backup:
+//	  schedule: "0 3 * * *"
+//	  keepDaily: 7
+//
+// Its values win over the database's, Update keeps writing the database, so
+// settings the file doesn't mention can still be changed there. A Section's
+// settings go under its name, they're layered over its values by
+// Section.View.
+type File struct {
+	Path     string
+	Keys     []string                   // values it sets, e.g. "backup.schedule", sorted. Sections' aren't included
+	data     []byte                     // as JSON, unmarshaled over the database's values
+	sections map[string]json.RawMessage // by section name, unmarshaled over its values
+}
+
+// LoadFile reads the config file at path, nil if there is none. Unknown
+// keys, values of the wrong type and values the app records for itself
+// (see Recorded) fail with errs.Invalid.
+func LoadFile(path string) (*File, error) {
+	raw, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	return ParseFile(path, raw)
+}
+
+// ParseFile is LoadFile for a file already read, e.g. one `config import`
+// got on stdin. JSON works too, it's YAML.
+func ParseFile(path string, raw []byte) (*File, error) {
+	var values map[string]any
+	if err := yaml.Unmarshal(raw, &values); err != nil {
+		return nil, errs.Wrap(errs.Invalid, err, "invalid config file "+path)
+	}
+
+	f := &File{Path: path}
+	var scratch types.Configuration
+	var err error
+	var walk func(prefix string, values map[string]any) error
+	walk = func(prefix string, values map[string]any) error {
+		for k, value := range values {
+			key := prefix + k
+			if Recorded(key) {
+				return errs.New(errs.Invalid, fmt.Sprintf("%s: %s is recorded by the app, not a setting", path, key))
+			}
+			if t, ok := registeredSections()[key]; ok && prefix == "" {
+				if err := f.parseSection(key, t, value); err != nil {
+					return err
+				}
+				delete(values, key)
+				continue
+			}
+			v, err := Lookup(&scratch, key)
+			if err != nil {
+				return errs.New(errs.Invalid, fmt.Sprintf("%s: unknown key %q", path, key))
+			}
+			if nested, ok := value.(map[string]any); ok && v.Kind() == reflect.Struct && v.Type() != timeType {
+				if err := walk(key+".", nested); err != nil {
+					return err
+				}
+				continue
+			}
+			f.Keys = append(f.Keys, key)
+		}
+		return nil
+	}
+	if err := walk("", values); err != nil {
+		return nil, err
+	}
+	slices.Sort(f.Keys)
+
+	// YAML timestamps come back as time.Time, which marshals like the database has them
+	if f.data, err = json.Marshal(values); err != nil {
+		return nil, errs.Wrap(errs.Invalid, err, "invalid config file "+path)
+	}
+	if err := json.Unmarshal(f.data, &scratch); err != nil {
+		return nil, errs.Wrap(errs.Invalid, err, "invalid config file "+path)
+	}
+	return f, nil
+}
+
+// parseSection checks value, the settings of the Section name of type t,
+// like ParseFile does the Configuration's.
+func (f *File) parseSection(name string, t reflect.Type, value any) error {
+	values, ok := value.(map[string]any)
+	if !ok {
+		return errs.New(errs.Invalid, fmt.Sprintf("%s: %s is a section, want a map of its settings", f.Path, name))
+	}
+	scratch := reflect.New(t).Elem()
+	var walk func(prefix string, values map[string]any) error
+	walk = func(prefix string, values map[string]any) error {
+		for k, value := range values {
+			key := prefix + k
+			v, err := lookup(scratch, key)
+			if err != nil {
+				return errs.New(errs.Invalid, fmt.Sprintf("%s: unknown key %q", f.Path, name+"."+key))
+			}
+			if nested, ok := value.(map[string]any); ok && v.Kind() == reflect.Struct && v.Type() != timeType {
+				if err := walk(key+".", nested); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	if err := walk("", values); err != nil {
+		return err
+	}
+	raw, err := json.Marshal(values)
+	if err == nil {
+		err = json.Unmarshal(raw, scratch.Addr().Interface())
+	}
+	if err != nil {
+		return errs.Wrap(errs.Invalid, err, fmt.Sprintf("invalid %s in %s", name, f.Path))
+	}
+	if f.sections == nil {
+		f.sections = map[string]json.RawMessage{}
+	}
+	f.sections[name] = raw
+	return nil
+}
+
+// Apply sets the file's values in cfg, leaving everything else.
+func (f *File) Apply(cfg *types.Configuration) error {
+	if f.data == nil {
+		return nil // only sets sections
+	}
+	return json.Unmarshal(f.data, cfg)
+}
+
+// Sets reports whether the file sets key or a part of it.
+func (f *File) Sets(key string) bool {
+	return slices.ContainsFunc(f.Keys, func(k string) bool {
+		return k == key || strings.HasPrefix(k, key+".") || strings.HasPrefix(key, k+".")
+	})
+}
+
+var (
+	filesMu sync.Mutex
+	files   = map[kv.DB]*File{}
+)
+
+// UseFile layers f over db's config for View (and Watch) in this process,
+// nil stops doing so.
+func UseFile(db kv.DB, f *File) {
+	filesMu.Lock()
+	defer filesMu.Unlock()
+	if f == nil {
+		delete(files, db)
+		return
+	}
+	files[db] = f
+}
+
+// FileOf returns the config file layered over db's config, nil if none.
+func FileOf(db kv.DB) *File {
+	filesMu.Lock()
+	defer filesMu.Unlock()
+	return files[db]
+}
+
+// layer applies db's config file and then its environment (see UseEnv) to
+// cfg, if it has them.
+func layer(db kv.DB, cfg *types.Configuration) error {
+	for _, f := range Layers(db) {
+		if err := f.Apply(cfg); err != nil {
+			return fmt.Errorf("failed to apply %s: %w", f.Path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package config
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"sprout/internal/platform/database"
+	"sprout/internal/platform/database/kv"
+	"sprout/internal/types"
+	"time"
+)
+
+// HistoryKeep is how many revisions are kept in the config audit DBI.
+const HistoryKeep = 500
+
+// Where a change came from, see Revision.
+const (
+	SourceApp    = "app" // the app itself, e.g. rewriting paths after `db import`
+	SourceCLI    = "cli"
+	SourceWeb    = "web"    // the settings page
+	SourceAPI    = "api"    // the settings endpoints, called without a browser
+	SourceRemote = "remote" // an overlay pulled from remoteConfig.url, see remoteconfig.Pull
+)
+
+// Revision is a change of the settings in the audit trail, recorded by
+// Update in the same transaction. Values the app records for itself aren't
+// settings and aren't recorded.
+type Revision struct {
+	Time    time.Time       `json:"time"`
+	Source  string          `json:"source"`            // Source*
+	Profile string          `json:"profile,omitempty"` // the one it changed, see Profile
+	Fields  []RevisionField `json:"fields"`
+}
+
+// RevisionField is a setting a Revision changed, formatted like
+// FormatRedacted (secrets only show that they changed).
+type RevisionField struct {
+	Key string `json:"key"`
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+func revisionKey(t time.Time) []byte {
+	return binary.BigEndian.AppendUint64(nil, uint64(t.UnixNano()))
+}
+
+// txnRecord stores the settings that differ between prev and next, if any,
+// and prev as a Snapshot, dropping the oldest revisions beyond HistoryKeep
+// and snapshots beyond SnapshotKeep.
+func txnRecord(txn kv.Txn, source, profile string, prev, next *types.Configuration) error {
+	changes := Diff(prev, next)
+	if len(changes) == 0 {
+		return nil
+	}
+	rev := Revision{Time: time.Now().UTC(), Source: source, Profile: profile}
+	for _, c := range changes {
+		rev.Fields = append(rev.Fields, RevisionField{Key: c.Key, Old: FormatRedacted(c.From), New: FormatRedacted(c.To)})
+	}
+	if err := database.TxnMarshalAndPut(txn, *database.ConfigAuditDBI, revisionKey(rev.Time), rev); err != nil {
+		return err
+	}
+	if err := txnPrune(txn, *database.ConfigAuditDBI, HistoryKeep); err != nil {
+		return err
+	}
+
+	snap := Snapshot{Time: rev.Time, Source: source, Profile: profile}
+	var err error
+	if snap.Settings, err = json.Marshal(prev); err != nil {
+		return err
+	}
+	if err := database.TxnMarshalAndPut(txn, *database.ConfigSnapshotsDBI, revisionKey(snap.Time), snap); err != nil {
+		return err
+	}
+	return txnPrune(txn, *database.ConfigSnapshotsDBI, SnapshotKeep)
+}
+
+// txnPrune drops the oldest entries of dbi, keyed by revisionKey, beyond
+// keep.
+func txnPrune(txn kv.Txn, dbi kv.DBI, keep int) error {
+	cur, err := txn.Cursor(dbi)
+	if err != nil {
+		return err
+	}
+	defer cur.Close()
+	n := 0
+	_, _, err = cur.First()
+	for ; err == nil; _, _, err = cur.Next() {
+		n++
+	}
+	if !kv.IsNotFound(err) {
+		return err
+	}
+	for excess := n - keep; excess > 0; excess-- { // keys are big endian times, first is oldest
+		if _, _, err := cur.First(); err != nil {
+			return err
+		}
+		if err := cur.Delete(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// History returns up to n revisions, newest first. n <= 0 returns all.
+func History(db kv.DB, n int) ([]Revision, error) {
+	all, err := database.ViewAll[Revision](db, *database.ConfigAuditDBI, nil)
+	if err != nil {
+		return nil, err
+	}
+	// ViewAll is oldest first (big endian time keys)
+	for i, j := 0, len(all)-1; i < j; i, j = i+1, j-1 {
+		all[i], all[j] = all[j], all[i]
+	}
+	if n > 0 && len(all) > n {
+		all = all[:n]
+	}
+	return all, nil
+}
@@ -0,0 +1,244 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"sprout/internal/platform/database"
+	"sprout/internal/platform/database/kv"
+	"sprout/internal/types"
+	"sprout/pkg/errs"
+	"sync"
+)
+
+const (
+	// DefaultProfile names the database's own settings without a profile's,
+	// e.g. `--profile default` ignores the one `config profile use` picked.
+	DefaultProfile = "default"
+	// ProfileEnv selects a profile like --profile does.
+	ProfileEnv = "CONFIG_PROFILE"
+)
+
+var profileName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,31}$`)
+
+// Profile is a named set of settings layered over the database's by View
+// while it's selected, e.g. "dev" with debug logs on port 8080 and "prod"
+// with warnings only on 443. It holds only the settings that differ: Update
+// writes the settings it changes to the selected profile, so `--profile dev
+// config set port 8080` doesn't touch prod. Values the app records for
+// itself always go to the database, they're the same for every profile.
+type Profile struct {
+	Name   string
+	Values map[string]json.RawMessage // by key, e.g. "backup.schedule"
+	Active bool                       // picked by `config profile use`
+}
+
+// Fields returns the values of p by key, typed like Fields' (e.g. for
+// FormatRedacted). Keys a migration removed are skipped.
+func (p Profile) Fields() []Field {
+	var fields []Field
+	for _, key := range slices.Sorted(maps.Keys(p.Values)) {
+		var scratch types.Configuration
+		v, err := Lookup(&scratch, key)
+		if err != nil || json.Unmarshal(p.Values[key], v.Addr().Interface()) != nil {
+			continue
+		}
+		fields = append(fields, Field{Key: key, Value: v})
+	}
+	return fields
+}
+
+// profileRecord is stored under database.ConfigProfilesKey.
+type profileRecord struct {
+	Active   string                                `json:"active,omitempty"`
+	Profiles map[string]map[string]json.RawMessage `json:"profiles,omitempty"`
+}
+
+var (
+	profilesMu sync.Mutex
+	selected   = map[kv.DB]string{}
+)
+
+// UseProfile selects the profile name for db in this process (--profile),
+// over the one `config profile use` picked; "" stops doing so and
+// DefaultProfile selects none. Fails with errs.NotFound for unknown names.
+func UseProfile(db kv.DB, name string) error {
+	if name != "" && name != DefaultProfile {
+		var rec *profileRecord
+		err := db.View(func(txn kv.Txn) (err error) {
+			rec, err = txnProfiles(txn)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if _, ok := rec.Profiles[name]; !ok {
+			return errs.New(errs.NotFound, fmt.Sprintf("unknown profile %q, see `config profile list`", name))
+		}
+	}
+	profilesMu.Lock()
+	defer profilesMu.Unlock()
+	if name == "" {
+		delete(selected, db)
+		return nil
+	}
+	selected[db] = name
+	return nil
+}
+
+// ActiveProfile returns the name of the profile View uses for db, "" if
+// none.
+func ActiveProfile(db kv.DB) (string, error) {
+	var name string
+	err := db.View(func(txn kv.Txn) error {
+		rec, err := txnProfiles(txn)
+		name = rec.active(db)
+		return err
+	})
+	return name, err
+}
+
+// Profiles returns db's profiles by name.
+func Profiles(db kv.DB) ([]Profile, error) {
+	var rec *profileRecord
+	err := db.View(func(txn kv.Txn) (err error) {
+		rec, err = txnProfiles(txn)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	var out []Profile
+	for _, name := range slices.Sorted(maps.Keys(rec.Profiles)) {
+		out = append(out, Profile{Name: name, Values: rec.Profiles[name], Active: name == rec.Active})
+	}
+	return out, nil
+}
+
+// CreateProfile adds the profile name, with the values of the profile from
+// or none if from is "". Fails with errs.Invalid for names that aren't
+// lowercase letters, digits, - and _ (at most 32), errs.Conflict if it exists
+// and errs.NotFound if from doesn't.
+func CreateProfile(db kv.DB, name, from string) error {
+	if !profileName.MatchString(name) || name == DefaultProfile {
+		return errs.New(errs.Invalid, fmt.Sprintf("invalid profile name %q, want lowercase letters, digits, - and _ (not %q)", name, DefaultProfile))
+	}
+	return updateProfiles(db, func(rec *profileRecord) error {
+		if _, ok := rec.Profiles[name]; ok {
+			return errs.New(errs.Conflict, fmt.Sprintf("profile %q exists", name))
+		}
+		values := map[string]json.RawMessage{}
+		if from != "" {
+			src, ok := rec.Profiles[from]
+			if !ok {
+				return errs.New(errs.NotFound, fmt.Sprintf("unknown profile %q", from))
+			}
+			values = maps.Clone(src)
+		}
+		if rec.Profiles == nil {
+			rec.Profiles = map[string]map[string]json.RawMessage{}
+		}
+		rec.Profiles[name] = values
+		return nil
+	})
+}
+
+// DeleteProfile removes the profile name, if `config profile use` picked it
+// the database's settings apply again. Fails with errs.NotFound if there's
+// none.
+func DeleteProfile(db kv.DB, name string) error {
+	return updateProfiles(db, func(rec *profileRecord) error {
+		if _, ok := rec.Profiles[name]; !ok {
+			return errs.New(errs.NotFound, fmt.Sprintf("unknown profile %q", name))
+		}
+		delete(rec.Profiles, name)
+		if rec.Active == name {
+			rec.Active = ""
+		}
+		return nil
+	})
+}
+
+// ActivateProfile makes name the profile every process uses unless one is
+// selected with UseProfile, e.g. for the service; DefaultProfile picks none.
+// A running service picks it up on reload. Fails with errs.NotFound for
+// unknown names.
+func ActivateProfile(db kv.DB, name string) error {
+	return updateProfiles(db, func(rec *profileRecord) error {
+		if name == DefaultProfile {
+			rec.Active = ""
+			return nil
+		}
+		if _, ok := rec.Profiles[name]; !ok {
+			return errs.New(errs.NotFound, fmt.Sprintf("unknown profile %q", name))
+		}
+		rec.Active = name
+		return nil
+	})
+}
+
+func updateProfiles(db kv.DB, fn func(rec *profileRecord) error) error {
+	return db.Update(func(txn kv.Txn) error {
+		rec, err := txnProfiles(txn)
+		if err != nil {
+			return err
+		}
+		if err := fn(rec); err != nil {
+			return err
+		}
+		return database.TxnPut(txn, *database.ConfigDBI, []byte(database.ConfigProfilesKey), rec)
+	})
+}
+
+func txnProfiles(txn kv.Txn) (*profileRecord, error) {
+	var rec profileRecord
+	if err := database.TxnGetAndUnmarshal(txn, *database.ConfigDBI, []byte(database.ConfigProfilesKey), &rec); err != nil && !kv.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to get profiles: %w", err)
+	}
+	return &rec, nil
+}
+
+// active returns the name of the profile in use for db, "" if none.
+func (rec *profileRecord) active(db kv.DB) string {
+	profilesMu.Lock()
+	name, ok := selected[db]
+	profilesMu.Unlock()
+	if !ok {
+		name = rec.Active
+	}
+	if _, ok := rec.Profiles[name]; !ok {
+		return "" // DefaultProfile, or deleted by another process
+	}
+	return name
+}
+
+// apply sets the values of the profile name in cfg. Keys a migration
+// removed are skipped.
+func (rec *profileRecord) apply(name string, cfg *types.Configuration) error {
+	for key, raw := range rec.Profiles[name] {
+		v, err := Lookup(cfg, key)
+		if err != nil {
+			continue
+		}
+		v.SetZero() // lists and maps are replaced, not merged
+		if err := json.Unmarshal(raw, v.Addr().Interface()); err != nil {
+			return fmt.Errorf("invalid %s in profile %s: %w", key, name, err)
+		}
+	}
+	return nil
+}
+
+// set records the settings that differ between prev and next in the profile
+// name.
+func (rec *profileRecord) set(name string, prev, next *types.Configuration) error {
+	for _, c := range Diff(prev, next) {
+		raw, err := json.Marshal(c.To.Interface())
+		if err != nil {
+			return err
+		}
+		rec.Profiles[name][c.Key] = raw
+	}
+	return nil
+}
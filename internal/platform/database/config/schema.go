@@ -0,0 +1,97 @@
+package config
+
+import (
+	"reflect"
+	"sprout/internal/types"
+)
+
+// SchemaURL is the JSON Schema dialect Schema produces.
+const SchemaURL = "https://json-schema.org/draft/2020-12/schema"
+
+// JSONSchema is the subset of JSON Schema Schema uses.
+type JSONSchema struct {
+	Schema               string                 `json:"$schema,omitempty"`
+	Title                string                 `json:"title,omitempty"`
+	Description          string                 `json:"description,omitempty"`
+	Type                 string                 `json:"type,omitempty"`
+	Format               string                 `json:"format,omitempty"`
+	Enum                 []string               `json:"enum,omitempty"`
+	Minimum              *int                   `json:"minimum,omitempty"`
+	Maximum              *int                   `json:"maximum,omitempty"`
+	Default              any                    `json:"default,omitempty"`
+	WriteOnly            bool                   `json:"writeOnly,omitempty"` // secrets, shown redacted
+	Group                string                 `json:"x-group,omitempty"`   // section for forms, see types.FieldMeta
+	Properties           map[string]*JSONSchema `json:"properties,omitempty"`
+	AdditionalProperties any                    `json:"additionalProperties,omitempty"` // false or a *JSONSchema
+	Items                *JSONSchema            `json:"items,omitempty"`
+}
+
+// Schema describes the settings as a JSON Schema, for tools and forms that
+// edit them: types from the Configuration struct, defaults from
+// types.DefaultConfig, titles, descriptions, groups, enums and bounds from
+// types.Meta. Values the app records for itself (see Recorded) are left out,
+// like `config set` and the config file refuse them. Validate has the rules a
+// schema can't express (e.g. cron syntax).
+func Schema(title string) *JSONSchema {
+	meta := types.Meta()
+	def := types.DefaultConfig()
+
+	var build func(key string, t reflect.Type, v reflect.Value) *JSONSchema
+	build = func(key string, t reflect.Type, v reflect.Value) *JSONSchema {
+		s := &JSONSchema{}
+		switch {
+		case t == timeType:
+			s.Type, s.Format = "string", "date-time"
+		case t == secretType:
+			s.Type, s.WriteOnly = "string", true
+		case t.Kind() == reflect.String:
+			s.Type = "string"
+		case t.Kind() == reflect.Bool:
+			s.Type = "boolean"
+		case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+			s.Type = "integer"
+		case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+			s.Type = "number"
+		case t.Kind() == reflect.Slice:
+			s.Type = "array"
+			s.Items = build(key, t.Elem(), reflect.Value{})
+		case t.Kind() == reflect.Map:
+			s.Type = "object"
+			s.AdditionalProperties = build(key, t.Elem(), reflect.Value{})
+		case t.Kind() == reflect.Struct:
+			s.Type = "object"
+			s.AdditionalProperties = false
+			s.Properties = map[string]*JSONSchema{}
+			for i := range t.NumField() {
+				name := jsonName(t.Field(i))
+				if name == "" {
+					continue
+				}
+				sub := name
+				if key != "" {
+					sub = key + "." + name
+				}
+				if Recorded(sub) {
+					continue
+				}
+				var fv reflect.Value
+				if v.IsValid() {
+					fv = v.Field(i)
+				}
+				p := build(sub, t.Field(i).Type, fv)
+				// described here rather than in build, list items share the list's key
+				m := meta[sub]
+				p.Title, p.Description, p.Group, p.Enum, p.Minimum, p.Maximum = m.Label, m.Description, m.Group, m.Enum, m.Minimum, m.Maximum
+				s.Properties[name] = p
+			}
+		}
+		if v.IsValid() && t.Kind() != reflect.Struct && !((t.Kind() == reflect.Slice || t.Kind() == reflect.Map) && v.IsNil()) {
+			s.Default = v.Interface()
+		}
+		return s
+	}
+
+	s := build("", reflect.TypeFor[types.Configuration](), reflect.ValueOf(def))
+	s.Schema, s.Title = SchemaURL, title
+	return s
+}
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sprout/internal/platform/database"
+	"sprout/internal/platform/database/kv"
+	"sprout/internal/types"
+	"sprout/pkg/errs"
+	"sync"
+)
+
+var sectionName = regexp.MustCompile(`^[a-z][a-zA-Z0-9]{0,31}$`)
+
+var (
+	sectionsMu sync.Mutex
+	sections   = map[string]reflect.Type{}
+)
+
+// Section is a package's own settings, stored apart from types.Configuration
+// under database.ConfigSectionKey + its name, so a module doesn't need
+// fields in the one struct. T is a struct tagged like Configuration (json,
+// desc, env, validate, see types.Meta). Its values in the config file go
+// under its name and its env tags are read as <APP>_<NAME>_<TAG>, both win
+// over the stored ones like they do for the Configuration:
+//
+//	var metricsConfig = config.NewSection("metrics", func() MetricsConfig {
+//		return MetricsConfig{Addr: ":9100"}
+//	})
+//
+//	cfg, err := metricsConfig.View(a.DB)
+//
+// If T has a Validate() types.FieldErrors method, Update runs it after the
+// bounds check. Sections aren't part of profiles, the history or `config
+// export/import`.
+type Section[T any] struct {
+	name string
+	def  func() T
+}
+
+// NewSection registers the section name with its defaults def. Call it at
+// init; panics if the name isn't a lowercase letter followed by letters and
+// digits, is taken by another section or a setting, or T isn't a struct.
+func NewSection[T any](name string, def func() T) *Section[T] {
+	t := reflect.TypeFor[T]()
+	if t.Kind() != reflect.Struct {
+		panic(fmt.Sprintf("config: section %q: %s isn't a struct", name, t))
+	}
+	if !sectionName.MatchString(name) {
+		panic(fmt.Sprintf("config: invalid section name %q", name))
+	}
+	var scratch types.Configuration
+	if _, err := Lookup(&scratch, name); err == nil || Recorded(name) {
+		panic(fmt.Sprintf("config: section %q is a setting", name))
+	}
+	sectionsMu.Lock()
+	defer sectionsMu.Unlock()
+	if _, ok := sections[name]; ok {
+		panic(fmt.Sprintf("config: section %q registered twice", name))
+	}
+	sections[name] = t
+	return &Section[T]{name: name, def: def}
+}
+
+// registeredSections returns the sections' types by name.
+func registeredSections() map[string]reflect.Type {
+	sectionsMu.Lock()
+	defer sectionsMu.Unlock()
+	out := make(map[string]reflect.Type, len(sections))
+	for name, t := range sections {
+		out[name] = t
+	}
+	return out
+}
+
+// Name returns the section's name, its key in the config file.
+func (s *Section[T]) Name() string {
+	return s.name
+}
+
+// View returns the section's settings: the defaults, the stored values over
+// them, then the config file's and the environment's (see Layers).
+//
+// WARNING: Starts a transaction. Avoid nesting transactions (will deadlock).
+func (s *Section[T]) View(db kv.DB) (T, error) {
+	var v T
+	err := db.View(func(txn kv.Txn) (err error) {
+		v, err = s.txnGet(txn)
+		return err
+	})
+	if err != nil {
+		return v, err
+	}
+	for _, l := range Layers(db) {
+		if raw, ok := l.sections[s.name]; ok {
+			if err := json.Unmarshal(raw, &v); err != nil {
+				return v, fmt.Errorf("failed to apply %s: %w", l.Path, err)
+			}
+		}
+	}
+	return v, nil
+}
+
+// Update changes the stored settings with fn, which gets them without the
+// layers like Update does. The result is checked against the validate tags
+// and T's Validate method, if any; invalid settings fail with errs.Invalid,
+// listing the field errors keyed by <name>.<key>, and aren't stored.
+//
+// WARNING: Starts a transaction. Avoid nesting transactions (will deadlock).
+func (s *Section[T]) Update(db kv.DB, fn func(v *T) error) error {
+	return db.Update(func(txn kv.Txn) error {
+		v, err := s.txnGet(txn)
+		if err != nil {
+			return err
+		}
+		if err := fn(&v); err != nil {
+			return err
+		}
+		fe := types.CheckBounds(&v)
+		if vv, ok := any(&v).(interface{ Validate() types.FieldErrors }); ok {
+			fe = append(fe, vv.Validate()...)
+		}
+		if fe != nil {
+			for i := range fe {
+				fe[i].Field = s.name + "." + fe[i].Field
+			}
+			return errs.Wrap(errs.Invalid, fe, fmt.Sprintf("invalid %s settings", s.name))
+		}
+		return database.TxnPut(txn, *database.ConfigDBI, s.key(), v)
+	})
+}
+
+func (s *Section[T]) key() []byte {
+	return []byte(database.ConfigSectionKey + s.name)
+}
+
+// txnGet returns the stored settings over the defaults, the defaults if
+// none are stored.
+func (s *Section[T]) txnGet(txn kv.Txn) (T, error) {
+	v := s.def()
+	err := database.TxnGetAndUnmarshal(txn, *database.ConfigDBI, s.key(), &v)
+	if err != nil && !kv.IsNotFound(err) {
+		return v, fmt.Errorf("failed to get %s settings: %w", s.name, err)
+	}
+	return v, nil
+}
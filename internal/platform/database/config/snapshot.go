@@ -0,0 +1,83 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"sprout/internal/platform/database"
+	"sprout/internal/platform/database/kv"
+	"sprout/internal/types"
+	"sprout/pkg/errs"
+	"time"
+)
+
+// SnapshotKeep is how many versions of the settings Rollback can restore.
+const SnapshotKeep = 20
+
+// Snapshot is the whole configuration as it was before a change, recorded by
+// Update in the same transaction as the change's Revision, for Rollback.
+type Snapshot struct {
+	Time     time.Time       `json:"time"`              // of the change, like its Revision's
+	Source   string          `json:"source"`            // of the change, Source*
+	Profile  string          `json:"profile,omitempty"` // in use when it was taken
+	Settings json.RawMessage `json:"settings"`          // marshaled types.Configuration
+}
+
+// Snapshots returns the snapshots, newest first: the first is the settings
+// before the last change.
+func Snapshots(db kv.DB) ([]Snapshot, error) {
+	all, err := database.ViewAll[Snapshot](db, *database.ConfigSnapshotsDBI, nil)
+	if err != nil {
+		return nil, err
+	}
+	// ViewAll is oldest first (big endian time keys)
+	for i, j := 0, len(all)-1; i < j; i, j = i+1, j-1 {
+		all[i], all[j] = all[j], all[i]
+	}
+	return all, nil
+}
+
+// Rollback restores the settings of the n-th newest snapshot (1 = before
+// the last change), e.g. after a change locked the settings page out. It's a
+// change made through source like any other, so it's recorded too and
+// rolling back again undoes it. Values the app records for itself are kept,
+// settings go to the profile in use like Update's. Fails with errs.NotFound
+// if there's no such snapshot and errs.Invalid if the settings it would
+// change don't validate anymore. Returns the snapshot and the settings it
+// changed, formatted like History's.
+func Rollback(db kv.DB, source string, n int) (*Snapshot, []RevisionField, error) {
+	snaps, err := Snapshots(db)
+	if err != nil {
+		return nil, nil, err
+	}
+	if n < 1 || n > len(snaps) {
+		return nil, nil, errs.New(errs.NotFound, fmt.Sprintf("no snapshot %d, there are %d", n, len(snaps)))
+	}
+	snap := &snaps[n-1]
+
+	var changed []RevisionField
+	err = UpdateFrom(db, source, func(cfg *types.Configuration) error {
+		next := types.DefaultConfig() // for settings added since
+		if err := json.Unmarshal(snap.Settings, &next); err != nil {
+			return fmt.Errorf("invalid snapshot: %w", err)
+		}
+		for _, key := range recorded {
+			v, _ := Lookup(&next, key)
+			cv, _ := Lookup(cfg, key)
+			v.Set(cv)
+		}
+		var keys []string
+		for _, c := range Diff(cfg, &next) {
+			changed = append(changed, RevisionField{Key: c.Key, Old: FormatRedacted(c.From), New: FormatRedacted(c.To)})
+			keys = append(keys, c.Key)
+		}
+		if fe := next.Validate().For(keys...); fe != nil {
+			return errs.Wrap(errs.Invalid, fe, "invalid settings in snapshot")
+		}
+		*cfg = next
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return snap, changed, nil
+}
@@ -0,0 +1,129 @@
+package config
+
+import (
+	"path/filepath"
+	"reflect"
+	"sprout/internal/platform/database"
+	"sprout/internal/platform/database/kv"
+	"sprout/internal/types"
+	"sync"
+)
+
+// FlagsPath is the Path of the File LoadFlags returns.
+const FlagsPath = "flags"
+
+// Where a setting's effective value comes from, see Sources. Layers are
+// named by their Path's base: FileName, EnvPath or FlagsPath.
+const (
+	FromDefault  = "default"
+	FromDatabase = "database"
+	FromProfile  = "profile" // followed by its name, e.g. "profile dev"
+)
+
+// LoadFlags returns the settings command line flags set, by key (e.g.
+// {"port": "9000"} for --port 9000) and parsed like `config set`, nil if
+// none. Values that don't parse fail with errs.Invalid. The result is
+// layered over the environment's with UseFlags.
+func LoadFlags(values map[string]string) (*File, error) {
+	return parseValues(FlagsPath, values, func(key string) string { return "flag for " + key })
+}
+
+var (
+	flagsMu sync.Mutex
+	flags   = map[kv.DB]*File{}
+)
+
+// UseFlags layers f (see LoadFlags) over db's config for View in this
+// process, after the environment's, nil stops doing so.
+func UseFlags(db kv.DB, f *File) {
+	flagsMu.Lock()
+	defer flagsMu.Unlock()
+	if f == nil {
+		delete(flags, db)
+		return
+	}
+	flags[db] = f
+}
+
+// FlagsOf returns the flags' settings layered over db's config, nil if none.
+func FlagsOf(db kv.DB) *File {
+	flagsMu.Lock()
+	defer flagsMu.Unlock()
+	return flags[db]
+}
+
+// Layers returns what's layered over db's config, in the order View applies
+// them (the last one wins): the config file, the environment and the flags.
+// Together with profiles and the defaults that's the precedence
+//
+//	flags > environment > config file > profile > database > default
+func Layers(db kv.DB) []*File {
+	var out []*File
+	for _, f := range []*File{FileOf(db), EnvOf(db), FlagsOf(db)} {
+		if f != nil {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// Source is a setting's effective value and where it comes from.
+type Source struct {
+	Key   string
+	Value reflect.Value // as View has it
+	From  string        // From*, or the base of a layer's Path
+}
+
+// Sources returns every setting with where its effective value comes from,
+// in Fields order: the last layer setting it, else the profile in use if it
+// has it, else the database if it differs from types.DefaultConfig. Values
+// the app records for itself are left out.
+func Sources(db kv.DB) ([]Source, error) {
+	var base *types.Configuration
+	var rec *profileRecord
+	err := db.View(func(txn kv.Txn) (err error) {
+		if base, err = database.TxnView[types.Configuration](txn, *database.ConfigDBI, []byte(database.ConfigDataKey)); err != nil {
+			return err
+		}
+		rec, err = txnProfiles(txn)
+		return err
+	})
+	if err != nil {
+		return nil, missing(err)
+	}
+	profile := rec.active(db)
+	var cfg types.Configuration
+	if err := copyConfig(&cfg, base); err != nil {
+		return nil, err
+	}
+	if err := rec.apply(profile, &cfg); err != nil {
+		return nil, err
+	}
+	if err := layer(db, &cfg); err != nil {
+		return nil, err
+	}
+
+	def := types.DefaultConfig()
+	defFields, baseFields := Fields(&def), Fields(base)
+	layers := Layers(db)
+	var out []Source
+	for i, f := range Fields(&cfg) {
+		if Recorded(f.Key) {
+			continue
+		}
+		s := Source{Key: f.Key, Value: f.Value, From: FromDefault}
+		if b, d := baseFields[i].Value, defFields[i].Value; !(isEmpty(b) && isEmpty(d)) && Format(b) != Format(d) {
+			s.From = FromDatabase
+		}
+		if _, ok := rec.Profiles[profile][f.Key]; ok {
+			s.From = FromProfile + " " + profile
+		}
+		for _, l := range layers {
+			if l.Sets(f.Key) {
+				s.From = filepath.Base(l.Path)
+			}
+		}
+		out = append(out, s)
+	}
+	return out, nil
+}
@@ -1,25 +1,34 @@
-// Package database provides functions to manage the LMDB wrapper for the application.
+// Package database provides functions to manage the key-value store (see kv)
+// for the application.
 package database
 
 import (
-	"github.com/Data-Corruption/lmdb-go/lmdb"
-	"github.com/Data-Corruption/lmdb-go/wrap"
+	"fmt"
+	"slices"
+	"sprout/internal/platform/database/kv"
+	"sync/atomic"
+
 	"github.com/Data-Corruption/stdx/xlog"
 )
 
 /*
 Notes on adding new DBIs:
+  - Core DBIs are registered below, feature packages register their own with
+    Register at package level (see Register), no edit here needed.
   - Existing data is preserved, no migration is needed.
-  - Removing a DBI from the list won't delete it from the LMDB file.
+  - Removing a DBI from the list won't delete it from the database file.
     The data will still exist on disk, you just won't have a handle to access it.
     You'd need to explicitly drop the database if you wanted to reclaim space.
-  - MaxNamedDBs is set to 128 in Data-Corruption/lmdb-go/wrap.
+  - LMDB: MaxNamedDBs is set to 128 in Data-Corruption/lmdb-go/wrap.
     If you need more, you'll need to use the raw lmdb-go package.
     But at that point, you should probably be using a different database.
 */
 var (
-	ConfigDBI = register("config")
-	// MyNewDBI = register("mynew") // example
+	ConfigDBI          = Register("config")
+	HTTPLogDBI         = Register("httplog")         // see httprecord
+	BackupsDBI         = Register("backups")         // see backup
+	ConfigAuditDBI     = Register("configaudit")     // see config.History
+	ConfigSnapshotsDBI = Register("configsnapshots") // see config.Rollback
 )
 
 /* KV Layout:
@@ -27,29 +36,97 @@ var (
 Config
     "version" -> version string of database schema (not app version)
 	"data" -> marshaled config struct
+	"seal" -> sealing mode, salt and key check, only if values are sealed (see Sealing)
+	"selftest-<pid>" -> transient, written and deleted by the startup self-test
+	"version:<dbi>" -> last migration applied to a DBI registered with its own migrations
+	"history", "history:<dbi>" -> IDs and checksums of the applied migrations, verified on open
+	"cursor", "cursor:<dbi>" -> where a batched migration continues, only while one is unfinished
+	"seeds" -> names of the fixtures applied by `seed` and when (see Seed)
+	"profiles" -> named sets of settings layered over "data" and the one in use (see config.Profile)
+	"section:<name>" -> marshaled settings of a package's own config section (see config.Section)
+HTTPLog
+    "next" -> next recording id (uint64)
+    <8 byte big endian id> -> marshaled httprecord.Recording
+Backups
+    <8 byte big endian unix nanos> -> marshaled backup.Result
+ConfigAudit
+    <8 byte big endian unix nanos> -> marshaled config.Revision
+ConfigSnapshots
+    <8 byte big endian unix nanos> -> marshaled config.Snapshot, same key as the change's Revision
 Other DBIs
     "<name>" -> <data>
 
 */
 
 const (
-	ConfigVersionKey = "version"
-	ConfigDataKey    = "data"
+	ConfigVersionKey  = "version"
+	ConfigDataKey     = "data"
+	ConfigSealKey     = "seal"
+	ConfigHistoryKey  = "history"
+	ConfigCursorKey   = "cursor"
+	ConfigSeedsKey    = "seeds"
+	ConfigProfilesKey = "profiles"
+	ConfigSectionKey  = "section:" // + a config section's name, see config.NewSection
 )
 
-// dbiEntry holds a DBI name and a pointer to its cached handle.
+// dbiEntry holds a DBI name, a pointer to its cached handle and its own
+// migrations, if any.
 type dbiEntry struct {
-	name   string
-	handle *lmdb.DBI
+	name       string
+	handle     *kv.DBI
+	migrations []DBIMigration
+}
+
+// DBIMigration is a schema step of a DBI registered by a feature package,
+// see Register. Up gets the DBI's handle, which a package-level var can't
+// refer to in its own initializer. Steps rewriting lots of data set Batch
+// instead, see migrator.AddBatched.
+type DBIMigration struct {
+	ID    string // unique within the DBI, e.g. "v1"
+	Desc  string // for logs
+	Up    func(txn kv.Txn, dbi kv.DBI) error
+	Batch func(txn kv.Txn, dbi kv.DBI, cursor []byte) (next []byte, err error)
 }
 
-// dbiRegistry holds all registered DBIs. Populated at init time via register().
+// dbiRegistry holds all registered DBIs. Populated at init time via Register().
 var dbiRegistry []dbiEntry
 
-// register adds a DBI to the registry and returns a pointer to its handle.
-func register(name string) *lmdb.DBI {
-	handle := new(lmdb.DBI)
-	dbiRegistry = append(dbiRegistry, dbiEntry{name: name, handle: handle})
+// opened is set once a database is opened, the registry is fixed from then on.
+var opened atomic.Bool
+
+// staleReaders is how many reader slots of exited processes the last open
+// cleared, see StaleReaders.
+var staleReaders atomic.Int64
+
+// StaleReaders returns how many reader slots left by crashed processes were
+// cleared when this process opened the database. Crashes that keep leaving
+// them are worth a look with `db repair`.
+func StaleReaders() int { return int(staleReaders.Load()) }
+
+// Register adds a DBI and returns a pointer to its handle, valid once the
+// database is opened. Call it from a package-level var so it runs at init,
+// before anything opens the database, e.g. in a feature package:
+//
+//	var DBI = database.Register("widgets", database.DBIMigration{
+//		ID: "v1", Desc: "default widgets",
+//		Up: func(txn kv.Txn, dbi kv.DBI) error {
+//			return database.TxnPut(txn, dbi, []byte("main"), Widget{})
+//		},
+//	})
+//
+// Migrations run in order after the core schema ones (migration.go), on every
+// open that finds some pending, the last one applied is kept under
+// "version:<name>" in the config DBI. Use the first to seed default data.
+// Panics on a duplicate name or once a database was opened.
+func Register(name string, migrations ...DBIMigration) *kv.DBI {
+	if opened.Load() {
+		panic(fmt.Sprintf("database: DBI %q registered after the database was opened", name))
+	}
+	if slices.ContainsFunc(dbiRegistry, func(e dbiEntry) bool { return e.name == name }) {
+		panic(fmt.Sprintf("database: DBI %q registered twice", name))
+	}
+	handle := new(kv.DBI)
+	dbiRegistry = append(dbiRegistry, dbiEntry{name: name, handle: handle, migrations: migrations})
 	return handle
 }
 
@@ -62,38 +139,58 @@ func DBINameList() []string {
 	return names
 }
 
-func New(directory string, logger *xlog.Logger) (*wrap.DB, error) {
-	// Initialize LMDB with the specified DBIs
-	db, srClosed, err := wrap.New(directory, DBINameList())
+func New(directory string, logger *xlog.Logger) (kv.DB, error) {
+	return NewSealed(directory, logger, nil)
+}
+
+// NewSealed is New for a database whose values are encrypted with s (see
+// Sealing), or that is to have them encrypted from now on. A nil s opens it
+// like New, which fails if its values are encrypted.
+func NewSealed(directory string, logger *xlog.Logger, s *Sealing) (kv.DB, error) {
+	db, _, err := OpenMigrating(directory, logger, s, nil)
+	return db, err
+}
+
+// OpenMigrating is NewSealed reporting migration progress and results, see
+// MigrateWith.
+func OpenMigrating(directory string, logger *xlog.Logger, s *Sealing, progress func(MigrationEvent)) (kv.DB, *MigrationResult, error) {
+	// Initialize the store with the specified DBIs
+	opened.Store(true)
+	db, srClosed, err := kv.Open(directory, DBINameList())
 	if err != nil {
-		if db != nil {
-			db.Close()
-		}
-		return nil, err
+		return nil, nil, err
 	}
-	logger.Infof("LMDB initialized at %s", directory)
+	logger.Infof("Database (%s) initialized at %s", kv.Backend, directory)
+	staleReaders.Store(int64(srClosed))
 	if srClosed > 0 {
 		logger.Warnf("LMDB had %d stale readers which were closed", srClosed)
 	}
 
 	// Cache DBIs
-	if err := cacheDBIs(db); err != nil {
-		return nil, err
+	cacheDBIs(db)
+
+	// Values are read through the helpers from here on
+	if err := openSeal(db, s); err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	if s != nil {
+		logger.Info("Database values are sealed")
 	}
 
 	// Perform migrations if needed
-	if err := Migrate(db, logger); err != nil {
+	res, err := MigrateWith(db, logger, progress)
+	if err != nil {
 		db.Close()
-		return nil, err
+		return nil, nil, err
 	}
 
-	return db, nil
+	return db, res, nil
 }
 
-func cacheDBIs(db *wrap.DB) error {
-	dbis := db.GetDBis()
+func cacheDBIs(db kv.DB) {
+	dbis := db.DBIs()
 	for _, entry := range dbiRegistry {
 		*entry.handle = dbis[entry.name]
 	}
-	return nil
 }
@@ -0,0 +1,51 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sprout/internal/platform/database/kv"
+
+	"github.com/Data-Corruption/stdx/xlog"
+)
+
+// NewEphemeral is New for a throwaway database in a new temp dir, removed
+// again when it's closed. For tests and anything else that needs a real,
+// migrated database without a storage dir. A nil logger discards the logs.
+func NewEphemeral(logger *xlog.Logger) (kv.DB, error) {
+	dir, err := os.MkdirTemp("", "sprout-db-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp dir: %w", err)
+	}
+	e := &ephemeral{dir: dir}
+	if logger == nil {
+		if e.log, err = xlog.New(filepath.Join(dir, "logs"), "none"); err != nil {
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("failed to create logger: %w", err)
+		}
+		logger = e.log
+	}
+	if e.DB, err = New(filepath.Join(dir, "db"), logger); err != nil {
+		e.cleanup()
+		return nil, err
+	}
+	return e, nil
+}
+
+type ephemeral struct {
+	kv.DB
+	dir string
+	log *xlog.Logger // owned, nil if the caller passed one
+}
+
+func (e *ephemeral) Close() {
+	e.DB.Close()
+	e.cleanup()
+}
+
+func (e *ephemeral) cleanup() {
+	if e.log != nil {
+		e.log.Close()
+	}
+	os.RemoveAll(e.dir)
+}
@@ -0,0 +1,21 @@
+package database
+
+import (
+	"os"
+	"testing"
+)
+
+func TestNewEphemeral(t *testing.T) {
+	db, err := NewEphemeral(nil)
+	if err != nil {
+		t.Fatalf("NewEphemeral: %v", err)
+	}
+	dir := db.(*ephemeral).dir
+	if ver, err := SchemaVersion(db); err != nil || ver == "" {
+		t.Errorf("SchemaVersion = %q, %v, want a migrated database", ver, err)
+	}
+	db.Close()
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("temp dir left after Close: %v", err)
+	}
+}
@@ -3,9 +3,8 @@ package database
 import (
 	"encoding/json"
 	"fmt"
-
-	"github.com/Data-Corruption/lmdb-go/lmdb"
-	"github.com/Data-Corruption/lmdb-go/wrap"
+	"sprout/internal/platform/database/kv"
+	"sprout/pkg/errs"
 )
 
 // ForEachAction specifies what to do with an entry after the callback.
@@ -21,25 +20,29 @@ const (
 // Transaction-based helpers (use these when composing multiple operations)
 // =============================================================================
 
-// TxnMarshalAndPut marshals the provided value and stores it in the database under the given key.
-func TxnMarshalAndPut(txn *lmdb.Txn, dbi lmdb.DBI, key []byte, value any) error {
+// TxnMarshalAndPut marshals the provided value and stores it in the database under the given key,
+// sealed if the database has a Sealing.
+func TxnMarshalAndPut(txn kv.Txn, dbi kv.DBI, key []byte, value any) error {
 	data, err := json.Marshal(value)
 	if err != nil {
 		return err
 	}
-	if err := txn.Put(dbi, key, data, 0); err != nil {
+	if err := txn.Put(dbi, key, seal(dbi, key, data)); err != nil {
 		return err
 	}
 	return nil
 }
 
 // TxnGetAndUnmarshal retrieves a value from the database and unmarshals it into the provided value pointer.
-// lmdb.IsNotFound(err) will be true if the key was not found in the database.
-func TxnGetAndUnmarshal(txn *lmdb.Txn, dbi lmdb.DBI, key []byte, value any) error {
+// kv.IsNotFound(err) will be true if the key was not found in the database.
+func TxnGetAndUnmarshal(txn kv.Txn, dbi kv.DBI, key []byte, value any) error {
 	buf, err := txn.Get(dbi, key)
 	if err != nil {
 		return err
 	}
+	if buf, err = unseal(dbi, key, buf); err != nil {
+		return err
+	}
 	if err := json.Unmarshal(buf, value); err != nil {
 		return err
 	}
@@ -47,8 +50,8 @@ func TxnGetAndUnmarshal(txn *lmdb.Txn, dbi lmdb.DBI, key []byte, value any) erro
 }
 
 // TxnView retrieves a copy of a value from the database within an existing transaction.
-// lmdb.IsNotFound(err) will be true if the key was not found.
-func TxnView[T any](txn *lmdb.Txn, dbi lmdb.DBI, key []byte) (*T, error) {
+// kv.IsNotFound(err) will be true if the key was not found.
+func TxnView[T any](txn kv.Txn, dbi kv.DBI, key []byte) (*T, error) {
 	var value T
 	if err := TxnGetAndUnmarshal(txn, dbi, key, &value); err != nil {
 		return nil, err
@@ -57,15 +60,15 @@ func TxnView[T any](txn *lmdb.Txn, dbi lmdb.DBI, key []byte) (*T, error) {
 }
 
 // TxnPut marshals and stores a value in the database within an existing transaction.
-func TxnPut[T any](txn *lmdb.Txn, dbi lmdb.DBI, key []byte, value T) error {
+func TxnPut[T any](txn kv.Txn, dbi kv.DBI, key []byte, value T) error {
 	return TxnMarshalAndPut(txn, dbi, key, value)
 }
 
 // TxnDeleteKey removes a key from the database within an existing transaction.
 // Returns nil if key doesn't exist (idempotent).
-func TxnDeleteKey(txn *lmdb.Txn, dbi lmdb.DBI, key []byte) error {
-	err := txn.Del(dbi, key, nil)
-	if lmdb.IsNotFound(err) {
+func TxnDeleteKey(txn kv.Txn, dbi kv.DBI, key []byte) error {
+	err := txn.Delete(dbi, key)
+	if kv.IsNotFound(err) {
 		return nil // Idempotent
 	}
 	return err
@@ -77,18 +80,19 @@ func TxnDeleteKey(txn *lmdb.Txn, dbi lmdb.DBI, key []byte) error {
 // The optional filter function receives raw key/value bytes BEFORE unmarshalling.
 // Return true to include the entry, false to skip it. Pass nil to include all entries.
 // This is useful for key prefix filtering without the cost of unmarshalling skipped entries.
-func TxnViewAll[T any](txn *lmdb.Txn, dbi lmdb.DBI, filter func(key, value []byte) bool) ([]T, error) {
+// Values are as stored, i.e. still sealed if the database has a Sealing.
+func TxnViewAll[T any](txn kv.Txn, dbi kv.DBI, filter func(key, value []byte) bool) ([]T, error) {
 	var result []T
 
-	cursor, err := txn.OpenCursor(dbi)
+	cursor, err := txn.Cursor(dbi)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create cursor: %w", err)
 	}
 	defer cursor.Close()
 
 	// Start at first entry
-	k, v, err := cursor.Get(nil, nil, lmdb.First)
-	for ; !lmdb.IsNotFound(err); k, v, err = cursor.Get(nil, nil, lmdb.Next) {
+	k, v, err := cursor.First()
+	for ; !kv.IsNotFound(err); k, v, err = cursor.Next() {
 		if err != nil {
 			return nil, fmt.Errorf("failed to get entry: %w", err)
 		}
@@ -98,6 +102,9 @@ func TxnViewAll[T any](txn *lmdb.Txn, dbi lmdb.DBI, filter func(key, value []byt
 			continue
 		}
 
+		if v, err = unseal(dbi, k, v); err != nil {
+			return nil, err
+		}
 		var value T
 		if err := json.Unmarshal(v, &value); err != nil {
 			return nil, fmt.Errorf("failed to unmarshal entry: %w", err)
@@ -110,13 +117,13 @@ func TxnViewAll[T any](txn *lmdb.Txn, dbi lmdb.DBI, filter func(key, value []byt
 // TxnUpsert updates a value in the database using the provided update function,
 // creating it with defaultFn if it does not exist.
 // Returns true if the value was created.
-func TxnUpsert[T any](txn *lmdb.Txn, dbi lmdb.DBI, key []byte, defaultFn func() T, updateFn func(*T) error) (bool, error) {
+func TxnUpsert[T any](txn kv.Txn, dbi kv.DBI, key []byte, defaultFn func() T, updateFn func(*T) error) (bool, error) {
 	created := false
 
 	var value T
 	err := TxnGetAndUnmarshal(txn, dbi, key, &value)
 	if err != nil {
-		if !lmdb.IsNotFound(err) {
+		if !kv.IsNotFound(err) {
 			return false, fmt.Errorf("failed to get value: %w", err)
 		}
 		created = true
@@ -135,7 +142,7 @@ func TxnUpsert[T any](txn *lmdb.Txn, dbi lmdb.DBI, key []byte, defaultFn func()
 }
 
 // TxnUpdate updates a value in the database using the provided update function.
-func TxnUpdate[T any](txn *lmdb.Txn, dbi lmdb.DBI, key []byte, updateFn func(*T) error) error {
+func TxnUpdate[T any](txn kv.Txn, dbi kv.DBI, key []byte, updateFn func(*T) error) error {
 	var value T
 	err := TxnGetAndUnmarshal(txn, dbi, key, &value)
 	if err != nil {
@@ -160,16 +167,17 @@ func TxnUpdate[T any](txn *lmdb.Txn, dbi lmdb.DBI, key []byte, updateFn func(*T)
 // The optional filter function receives raw key/value bytes BEFORE unmarshalling.
 // Return true to process the entry, false to skip it. Pass nil to process all entries.
 // This is useful for key prefix filtering without the cost of unmarshalling skipped entries.
-func TxnForEach[T any](txn *lmdb.Txn, dbi lmdb.DBI, filter func(key, value []byte) bool, callback func(key []byte, value *T) (ForEachAction, error)) error {
-	cursor, err := txn.OpenCursor(dbi)
+// Values are as stored, i.e. still sealed if the database has a Sealing.
+func TxnForEach[T any](txn kv.Txn, dbi kv.DBI, filter func(key, value []byte) bool, callback func(key []byte, value *T) (ForEachAction, error)) error {
+	cursor, err := txn.Cursor(dbi)
 	if err != nil {
 		return fmt.Errorf("failed to create cursor: %w", err)
 	}
 	defer cursor.Close()
 
 	// Start at first entry
-	k, v, err := cursor.Get(nil, nil, lmdb.First)
-	for ; !lmdb.IsNotFound(err); k, v, err = cursor.Get(nil, nil, lmdb.Next) {
+	k, v, err := cursor.First()
+	for ; !kv.IsNotFound(err); k, v, err = cursor.Next() {
 		if err != nil {
 			return fmt.Errorf("failed to get entry: %w", err)
 		}
@@ -179,6 +187,9 @@ func TxnForEach[T any](txn *lmdb.Txn, dbi lmdb.DBI, filter func(key, value []byt
 			continue
 		}
 
+		if v, err = unseal(dbi, k, v); err != nil {
+			return err
+		}
 		var value T
 		if err := json.Unmarshal(v, &value); err != nil {
 			return fmt.Errorf("failed to unmarshal entry: %w", err)
@@ -195,11 +206,11 @@ func TxnForEach[T any](txn *lmdb.Txn, dbi lmdb.DBI, filter func(key, value []byt
 			if err != nil {
 				return fmt.Errorf("failed to marshal entry: %w", err)
 			}
-			if err := cursor.Put(k, data, lmdb.Current); err != nil {
+			if err := cursor.Put(seal(dbi, k, data)); err != nil {
 				return fmt.Errorf("failed to update entry: %w", err)
 			}
 		case ActionDelete:
-			if err := cursor.Del(0); err != nil {
+			if err := cursor.Delete(); err != nil {
 				return fmt.Errorf("failed to delete entry: %w", err)
 			}
 		}
@@ -212,16 +223,16 @@ func TxnForEach[T any](txn *lmdb.Txn, dbi lmdb.DBI, filter func(key, value []byt
 // =============================================================================
 
 // View retrieves a copy of a value from the database.
-// lmdb.IsNotFound(err) will be true if the key was not found.
+// errs.Is(err, errs.NotFound) will be true if the key was not found.
 //
 // WARNING: Starts a transaction. Use TxnView if you need to compose multiple operations.
-func View[T any](db *wrap.DB, dbi lmdb.DBI, key []byte) (*T, error) {
+func View[T any](db kv.DB, dbi kv.DBI, key []byte) (*T, error) {
 	var value T
-	err := db.View(func(txn *lmdb.Txn) error {
+	err := db.View(func(txn kv.Txn) error {
 		return TxnGetAndUnmarshal(txn, dbi, key, &value)
 	})
 	if err != nil {
-		return nil, err
+		return nil, classify(err)
 	}
 	return &value, nil
 }
@@ -230,8 +241,8 @@ func View[T any](db *wrap.DB, dbi lmdb.DBI, key []byte) (*T, error) {
 //
 // WARNING: Starts a transaction. Use TxnPut if you need to compose multiple operations.
 // If an error is returned, the transaction is rolled back and nothing is persisted.
-func Put[T any](db *wrap.DB, dbi lmdb.DBI, key []byte, value T) error {
-	return db.Update(func(txn *lmdb.Txn) error {
+func Put[T any](db kv.DB, dbi kv.DBI, key []byte, value T) error {
+	return db.Update(func(txn kv.Txn) error {
 		return TxnMarshalAndPut(txn, dbi, key, value)
 	})
 }
@@ -241,8 +252,8 @@ func Put[T any](db *wrap.DB, dbi lmdb.DBI, key []byte, value T) error {
 //
 // WARNING: Starts a transaction. Use TxnDeleteKey if you need to compose multiple operations.
 // If an error is returned, the transaction is rolled back and nothing is persisted.
-func DeleteKey(db *wrap.DB, dbi lmdb.DBI, key []byte) error {
-	return db.Update(func(txn *lmdb.Txn) error {
+func DeleteKey(db kv.DB, dbi kv.DBI, key []byte) error {
+	return db.Update(func(txn kv.Txn) error {
 		return TxnDeleteKey(txn, dbi, key)
 	})
 }
@@ -253,11 +264,12 @@ func DeleteKey(db *wrap.DB, dbi lmdb.DBI, key []byte) error {
 // The optional filter function receives raw key/value bytes BEFORE unmarshalling.
 // Return true to include the entry, false to skip it. Pass nil to include all entries.
 // This is useful for key prefix filtering without the cost of unmarshalling skipped entries.
+// Values are as stored, i.e. still sealed if the database has a Sealing.
 //
 // WARNING: Starts a transaction. Use TxnViewAll if you need to compose multiple operations.
-func ViewAll[T any](db *wrap.DB, dbi lmdb.DBI, filter func(key, value []byte) bool) ([]T, error) {
+func ViewAll[T any](db kv.DB, dbi kv.DBI, filter func(key, value []byte) bool) ([]T, error) {
 	var result []T
-	err := db.View(func(txn *lmdb.Txn) error {
+	err := db.View(func(txn kv.Txn) error {
 		var err error
 		result, err = TxnViewAll[T](txn, dbi, filter)
 		return err
@@ -274,9 +286,9 @@ func ViewAll[T any](db *wrap.DB, dbi lmdb.DBI, filter func(key, value []byte) bo
 //
 // WARNING: Starts a transaction. Use TxnUpsert if you need to compose multiple operations.
 // If updateFn returns an error, the transaction is rolled back and nothing is persisted.
-func Upsert[T any](db *wrap.DB, dbi lmdb.DBI, key []byte, defaultFn func() T, updateFn func(*T) error) (bool, error) {
+func Upsert[T any](db kv.DB, dbi kv.DBI, key []byte, defaultFn func() T, updateFn func(*T) error) (bool, error) {
 	var created bool
-	err := db.Update(func(txn *lmdb.Txn) error {
+	err := db.Update(func(txn kv.Txn) error {
 		var err error
 		created, err = TxnUpsert(txn, dbi, key, defaultFn, updateFn)
 		return err
@@ -285,13 +297,14 @@ func Upsert[T any](db *wrap.DB, dbi lmdb.DBI, key []byte, defaultFn func() T, up
 }
 
 // Update updates a value in the database using the provided update function.
+// errs.Is(err, errs.NotFound) will be true if the key was not found.
 //
 // WARNING: Starts a transaction. Use TxnUpdate if you need to compose multiple operations.
 // If updateFn returns an error, the transaction is rolled back and nothing is persisted.
-func Update[T any](db *wrap.DB, dbi lmdb.DBI, key []byte, updateFn func(*T) error) error {
-	return db.Update(func(txn *lmdb.Txn) error {
+func Update[T any](db kv.DB, dbi kv.DBI, key []byte, updateFn func(*T) error) error {
+	return classify(db.Update(func(txn kv.Txn) error {
 		return TxnUpdate(txn, dbi, key, updateFn)
-	})
+	}))
 }
 
 // ForEach iterates over all entries in a DBI, applying the callback to each.
@@ -301,11 +314,22 @@ func Update[T any](db *wrap.DB, dbi lmdb.DBI, key []byte, updateFn func(*T) erro
 // The optional filter function receives raw key/value bytes BEFORE unmarshalling.
 // Return true to process the entry, false to skip it. Pass nil to process all entries.
 // This is useful for key prefix filtering without the cost of unmarshalling skipped entries.
+// Values are as stored, i.e. still sealed if the database has a Sealing.
 //
 // WARNING: Starts a transaction. Use TxnForEach if you need to compose multiple operations.
 // If the callback returns a non-nil error, the transaction is rolled back and nothing is persisted.
-func ForEach[T any](db *wrap.DB, dbi lmdb.DBI, filter func(key, value []byte) bool, callback func(key []byte, value *T) (ForEachAction, error)) error {
-	return db.Update(func(txn *lmdb.Txn) error {
+func ForEach[T any](db kv.DB, dbi kv.DBI, filter func(key, value []byte) bool, callback func(key []byte, value *T) (ForEachAction, error)) error {
+	return db.Update(func(txn kv.Txn) error {
 		return TxnForEach(txn, dbi, filter, callback)
 	})
 }
+
+// classify marks kv.ErrNotFound as errs.NotFound for the convenience
+// wrappers. Txn helpers return raw kv errors while composing, kv.IsNotFound
+// works on both.
+func classify(err error) error {
+	if kv.IsNotFound(err) {
+		return errs.Wrap(errs.NotFound, err, "not found")
+	}
+	return err
+}
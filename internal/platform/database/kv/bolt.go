@@ -0,0 +1,220 @@
+//go:build bolt
+
+package kv
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	bolt "go.etcd.io/bbolt"
+	bolterrors "go.etcd.io/bbolt/errors"
+)
+
+const (
+	Backend  = "bolt"
+	DataFile = "data.db" // in the database dir
+)
+
+// Open opens (creating if needed) the database in dir with the named
+// buckets. bolt has no reader table, the stale reader count is always 0.
+func Open(dir string, names []string) (DB, int, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, 0, err
+	}
+	b, err := OpenBolt(dir, false)
+	if err != nil {
+		return nil, 0, err
+	}
+	db := &boltDB{b: b, dbis: make(map[string]DBI, len(names))}
+	err = b.Update(func(tx *bolt.Tx) error {
+		for _, name := range names {
+			if _, ok := db.dbis[name]; ok {
+				return fmt.Errorf("duplicate bucket name %q", name)
+			}
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return fmt.Errorf("failed to create bucket %s: %w", name, err)
+			}
+			db.dbis[name] = DBI{name: name}
+		}
+		return nil
+	})
+	if err != nil {
+		b.Close()
+		return nil, 0, err
+	}
+	return db, 0, nil
+}
+
+// OpenBolt opens the bolt file in dir directly, for maintenance (snapshots,
+// stats) that needs more than the DB interface. It waits up to OpenTimeout
+// for a process holding it.
+func OpenBolt(dir string, readOnly bool) (*bolt.DB, error) {
+	b, err := bolt.Open(filepath.Join(dir, DataFile), 0644, &bolt.Options{Timeout: OpenTimeout, ReadOnly: readOnly})
+	if errors.Is(err, bolterrors.ErrTimeout) {
+		return nil, fmt.Errorf("database is in use by another process (bolt builds allow one at a time): %w", err)
+	}
+	return b, err
+}
+
+type boltDB struct {
+	b    *bolt.DB
+	dbis map[string]DBI
+}
+
+func (db *boltDB) View(fn func(txn Txn) error) error {
+	return closedErr(db.b.View(func(tx *bolt.Tx) error {
+		return fn(boltTxn{tx})
+	}))
+}
+
+func (db *boltDB) Update(fn func(txn Txn) error) error {
+	return closedErr(db.b.Update(func(tx *bolt.Tx) error {
+		return fn(boltTxn{tx})
+	}))
+}
+
+func (db *boltDB) DBIs() map[string]DBI {
+	dbis := make(map[string]DBI, len(db.dbis))
+	for name, dbi := range db.dbis {
+		dbis[name] = dbi
+	}
+	return dbis
+}
+
+func (db *boltDB) Close() { db.b.Close() }
+
+type boltTxn struct{ tx *bolt.Tx }
+
+func (t boltTxn) bucket(dbi DBI) (*bolt.Bucket, error) {
+	b := t.tx.Bucket([]byte(dbi.name))
+	if b == nil {
+		return nil, fmt.Errorf("bucket %s doesn't exist", dbi.name)
+	}
+	return b, nil
+}
+
+func (t boltTxn) Get(dbi DBI, key []byte) ([]byte, error) {
+	b, err := t.bucket(dbi)
+	if err != nil {
+		return nil, err
+	}
+	if v := b.Get(key); v != nil {
+		return v, nil
+	}
+	return nil, ErrNotFound
+}
+
+func (t boltTxn) Put(dbi DBI, key, value []byte) error {
+	b, err := t.bucket(dbi)
+	if err != nil {
+		return err
+	}
+	if value == nil {
+		value = []byte{} // bolt reads nil as missing
+	}
+	return b.Put(key, value)
+}
+
+func (t boltTxn) Delete(dbi DBI, key []byte) error {
+	b, err := t.bucket(dbi)
+	if err != nil {
+		return err
+	}
+	if b.Get(key) == nil {
+		return ErrNotFound
+	}
+	return b.Delete(key)
+}
+
+func (t boltTxn) Clear(dbi DBI) error {
+	name := []byte(dbi.name)
+	if err := t.tx.DeleteBucket(name); err != nil && !errors.Is(err, bolterrors.ErrBucketNotFound) {
+		return err
+	}
+	_, err := t.tx.CreateBucket(name)
+	return err
+}
+
+func (t boltTxn) Cursor(dbi DBI) (Cursor, error) {
+	b, err := t.bucket(dbi)
+	if err != nil {
+		return nil, err
+	}
+	return &boltCursor{b: b, cur: b.Cursor()}, nil
+}
+
+// boltCursor repositions after writes, bolt cursors aren't valid across
+// changes to their bucket.
+type boltCursor struct {
+	b      *bolt.Bucket
+	cur    *bolt.Cursor
+	key    []byte // copy of the key at the cursor
+	reseek int    // 0, or how Next repositions after a write
+}
+
+const (
+	reseekPut    = 1 // key still there, move past it
+	reseekDelete = 2 // key gone, the next one is where Seek lands
+)
+
+func (c *boltCursor) at(k, v []byte) ([]byte, []byte, error) {
+	c.reseek = 0
+	if k == nil {
+		c.key = nil
+		return nil, nil, ErrNotFound
+	}
+	c.key = append(c.key[:0], k...)
+	return k, v, nil
+}
+
+func (c *boltCursor) First() ([]byte, []byte, error) { return c.at(c.cur.First()) }
+
+func (c *boltCursor) Next() ([]byte, []byte, error) {
+	switch c.reseek {
+	case reseekPut:
+		if k, _ := c.cur.Seek(c.key); k == nil {
+			return c.at(nil, nil)
+		}
+	case reseekDelete:
+		return c.at(c.cur.Seek(c.key))
+	}
+	return c.at(c.cur.Next())
+}
+
+func (c *boltCursor) Seek(key []byte) ([]byte, []byte, error) { return c.at(c.cur.Seek(key)) }
+
+func (c *boltCursor) Put(value []byte) error {
+	if c.key == nil {
+		return ErrNotFound
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	if err := c.b.Put(c.key, value); err != nil {
+		return err
+	}
+	c.reseek = reseekPut
+	return nil
+}
+
+func (c *boltCursor) Delete() error {
+	if c.key == nil {
+		return ErrNotFound
+	}
+	if err := c.b.Delete(c.key); err != nil {
+		return err
+	}
+	c.reseek = reseekDelete
+	return nil
+}
+
+func (c *boltCursor) Close() {}
+
+func closedErr(err error) error {
+	if errors.Is(err, bolterrors.ErrDatabaseNotOpen) {
+		return ErrClosed
+	}
+	return err
+}
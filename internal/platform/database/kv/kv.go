@@ -0,0 +1,79 @@
+// Package kv is the key-value store under the database package: named
+// buckets (DBIs) of byte keys and values, read and written in transactions.
+//
+// The backend is picked at build time. LMDB is the default, it needs CGO and
+// lets the CLI and the service use the database at the same time. Building
+// with the bolt tag (`go build -tags bolt`, CGO_ENABLED=0 works) uses bbolt
+// instead, pure Go but one process at a time: while the service runs,
+// commands that open the database fail after OpenTimeout.
+package kv
+
+import (
+	"errors"
+	"time"
+)
+
+// OpenTimeout is how long Open waits for another process to release the
+// database, for backends that lock it (bolt).
+const OpenTimeout = 5 * time.Second
+
+var (
+	// ErrNotFound is returned for missing keys and by cursors past the end.
+	ErrNotFound = errors.New("key not found")
+	// ErrClosed is returned by transactions on a closed DB.
+	ErrClosed = errors.New("database is closed")
+)
+
+// IsNotFound reports whether err is (or wraps) ErrNotFound.
+func IsNotFound(err error) bool {
+	return errors.Is(err, ErrNotFound)
+}
+
+// DBI is a handle to a named bucket, valid for the DB it came from.
+type DBI struct {
+	name string
+	id   uint // backend handle, e.g. LMDB's
+}
+
+// Name is the bucket's name, as given to Open.
+func (d DBI) Name() string { return d.name }
+
+// DB is an open database, see Open.
+type DB interface {
+	// View runs fn in a read-only transaction.
+	View(fn func(txn Txn) error) error
+	// Update runs fn in a write transaction, committed if fn returns nil and
+	// rolled back otherwise. Writes are serialized, don't nest transactions.
+	Update(fn func(txn Txn) error) error
+	// DBIs returns the handles of the buckets given to Open, by name.
+	DBIs() map[string]DBI
+	Close()
+}
+
+// Txn is a transaction, only valid inside the function it was passed to.
+type Txn interface {
+	// Get returns the value of key, ErrNotFound if there's none. The slice
+	// is only valid until the transaction ends and must not be modified.
+	Get(dbi DBI, key []byte) ([]byte, error)
+	Put(dbi DBI, key, value []byte) error
+	// Delete removes key, ErrNotFound if it wasn't there.
+	Delete(dbi DBI, key []byte) error
+	// Clear removes every entry of dbi, keeping the bucket.
+	Clear(dbi DBI) error
+	Cursor(dbi DBI) (Cursor, error)
+}
+
+// Cursor walks a bucket in key order. Positioning methods return
+// ErrNotFound once there's nothing (more) to return. Returned slices follow
+// the same rules as Txn.Get.
+type Cursor interface {
+	First() (key, value []byte, err error)
+	Next() (key, value []byte, err error)
+	// Seek moves to the first key at or after key.
+	Seek(key []byte) (k, value []byte, err error)
+	// Put replaces the value at the cursor, Next continues after it.
+	Put(value []byte) error
+	// Delete removes the entry at the cursor, Next continues after it.
+	Delete() error
+	Close()
+}
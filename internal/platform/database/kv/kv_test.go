@@ -0,0 +1,133 @@
+package kv
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+// Runs against the backend of the build, `go test -tags bolt` for bolt.
+func TestBackend(t *testing.T) {
+	dir := t.TempDir()
+	db, _, err := Open(dir, []string{"a", "b"})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer db.Close()
+	dbis := db.DBIs()
+	a, b := dbis["a"], dbis["b"]
+	if a.Name() != "a" || len(dbis) != 2 {
+		t.Fatalf("DBIs = %+v", dbis)
+	}
+
+	err = db.Update(func(txn Txn) error {
+		for i := range 5 {
+			if err := txn.Put(a, fmt.Appendf(nil, "k%d", i), fmt.Appendf(nil, "v%d", i)); err != nil {
+				return err
+			}
+		}
+		return txn.Put(b, []byte("empty"), nil)
+	})
+	if err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+
+	err = db.View(func(txn Txn) error {
+		if v, err := txn.Get(a, []byte("k2")); err != nil || string(v) != "v2" {
+			t.Errorf("Get k2 = %q, %v", v, err)
+		}
+		if _, err := txn.Get(a, []byte("nope")); !IsNotFound(err) {
+			t.Errorf("Get missing = %v, want ErrNotFound", err)
+		}
+		if v, err := txn.Get(b, []byte("empty")); err != nil || len(v) != 0 {
+			t.Errorf("Get empty = %q, %v", v, err)
+		}
+		if _, err := txn.Get(b, []byte("k2")); !IsNotFound(err) {
+			t.Errorf("buckets aren't separate, Get b/k2 = %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("View: %v", err)
+	}
+
+	// rewrite and delete while iterating, the cursor must keep its place
+	err = db.Update(func(txn Txn) error {
+		cur, err := txn.Cursor(a)
+		if err != nil {
+			return err
+		}
+		defer cur.Close()
+		k, _, err := cur.Seek([]byte("k1"))
+		for ; err == nil; k, _, err = cur.Next() {
+			if string(k) == "k3" {
+				err = cur.Delete()
+			} else {
+				err = cur.Put(append([]byte("new-"), k...))
+			}
+			if err != nil {
+				return err
+			}
+		}
+		if !IsNotFound(err) {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("cursor writes: %v", err)
+	}
+
+	var got []string
+	err = db.View(func(txn Txn) error {
+		cur, err := txn.Cursor(a)
+		if err != nil {
+			return err
+		}
+		defer cur.Close()
+		k, v, err := cur.First()
+		for ; err == nil; k, v, err = cur.Next() {
+			got = append(got, string(k)+"="+string(v))
+		}
+		if !IsNotFound(err) {
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("View: %v", err)
+	}
+	want := []string{"k0=v0", "k1=new-k1", "k2=new-k2", "k4=new-k4"}
+	if !slices.Equal(got, want) {
+		t.Errorf("after cursor writes = %v, want %v", got, want)
+	}
+
+	err = db.Update(func(txn Txn) error {
+		if err := txn.Delete(a, []byte("k3")); !IsNotFound(err) {
+			t.Errorf("Delete missing = %v, want ErrNotFound", err)
+		}
+		return txn.Clear(a)
+	})
+	if err != nil {
+		t.Fatalf("Clear: %v", err)
+	}
+	err = db.View(func(txn Txn) error {
+		cur, err := txn.Cursor(a)
+		if err != nil {
+			return err
+		}
+		defer cur.Close()
+		if _, _, err := cur.First(); !IsNotFound(err) {
+			t.Errorf("First after Clear = %v, want ErrNotFound", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("View: %v", err)
+	}
+
+	db.Close()
+	if err := db.View(func(txn Txn) error { return nil }); err != ErrClosed {
+		t.Errorf("View after Close = %v, want ErrClosed", err)
+	}
+}
@@ -0,0 +1,122 @@
+//go:build !bolt
+
+package kv
+
+import (
+	"github.com/Data-Corruption/lmdb-go/lmdb"
+	"github.com/Data-Corruption/lmdb-go/wrap"
+)
+
+const (
+	Backend  = "lmdb"
+	DataFile = "data.mdb" // in the database dir, next to LMDB's lock.mdb
+)
+
+// Open opens (creating if needed) the database in dir with the named
+// buckets, returning how many stale reader slots of crashed processes were
+// cleared on the way.
+func Open(dir string, names []string) (DB, int, error) {
+	w, stale, err := wrap.New(dir, names)
+	if err != nil {
+		if w != nil {
+			w.Close()
+		}
+		return nil, stale, err
+	}
+	db := &lmdbDB{w: w, dbis: make(map[string]DBI, len(names))}
+	for name, h := range w.GetDBis() {
+		db.dbis[name] = DBI{name: name, id: uint(h)}
+	}
+	return db, stale, nil
+}
+
+type lmdbDB struct {
+	w    *wrap.DB
+	dbis map[string]DBI
+}
+
+func (db *lmdbDB) View(fn func(txn Txn) error) error {
+	return closedErr(db.w.View(func(txn *lmdb.Txn) error {
+		return fn(lmdbTxn{txn})
+	}))
+}
+
+func (db *lmdbDB) Update(fn func(txn Txn) error) error {
+	return closedErr(db.w.Update(func(txn *lmdb.Txn) error {
+		return fn(lmdbTxn{txn})
+	}))
+}
+
+func (db *lmdbDB) DBIs() map[string]DBI {
+	dbis := make(map[string]DBI, len(db.dbis))
+	for name, dbi := range db.dbis {
+		dbis[name] = dbi
+	}
+	return dbis
+}
+
+func (db *lmdbDB) Close() { db.w.Close() }
+
+type lmdbTxn struct{ txn *lmdb.Txn }
+
+func (t lmdbTxn) Get(dbi DBI, key []byte) ([]byte, error) {
+	v, err := t.txn.Get(lmdb.DBI(dbi.id), key)
+	return v, notFound(err)
+}
+
+func (t lmdbTxn) Put(dbi DBI, key, value []byte) error {
+	return t.txn.Put(lmdb.DBI(dbi.id), key, value, 0)
+}
+
+func (t lmdbTxn) Delete(dbi DBI, key []byte) error {
+	return notFound(t.txn.Del(lmdb.DBI(dbi.id), key, nil))
+}
+
+func (t lmdbTxn) Clear(dbi DBI) error {
+	return t.txn.Drop(lmdb.DBI(dbi.id), false)
+}
+
+func (t lmdbTxn) Cursor(dbi DBI) (Cursor, error) {
+	cur, err := t.txn.OpenCursor(lmdb.DBI(dbi.id))
+	if err != nil {
+		return nil, err
+	}
+	return &lmdbCursor{cur: cur}, nil
+}
+
+type lmdbCursor struct {
+	cur *lmdb.Cursor
+	key []byte // at the cursor, lmdb.Current puts need it
+}
+
+func (c *lmdbCursor) get(key []byte, op uint) ([]byte, []byte, error) {
+	k, v, err := c.cur.Get(key, nil, op)
+	if err != nil {
+		c.key = nil
+		return nil, nil, notFound(err)
+	}
+	c.key = k
+	return k, v, nil
+}
+
+func (c *lmdbCursor) First() ([]byte, []byte, error)          { return c.get(nil, lmdb.First) }
+func (c *lmdbCursor) Next() ([]byte, []byte, error)           { return c.get(nil, lmdb.Next) }
+func (c *lmdbCursor) Seek(key []byte) ([]byte, []byte, error) { return c.get(key, lmdb.SetRange) }
+func (c *lmdbCursor) Put(value []byte) error                  { return c.cur.Put(c.key, value, lmdb.Current) }
+func (c *lmdbCursor) Delete() error                           { return c.cur.Del(0) }
+func (c *lmdbCursor) Close()                                  { c.cur.Close() }
+
+// notFound turns LMDB's not found error into ErrNotFound.
+func notFound(err error) error {
+	if lmdb.IsNotFound(err) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func closedErr(err error) error {
+	if err == wrap.ErrDBClosed {
+		return ErrClosed
+	}
+	return err
+}
@@ -1,21 +1,161 @@
 package database
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sprout/internal/platform/database/kv"
 	"sprout/internal/types"
+	"sprout/pkg/errs"
 	"sprout/pkg/migrator"
+	"sprout/pkg/x"
+	"strings"
+	"time"
 
-	"github.com/Data-Corruption/lmdb-go/lmdb"
-	"github.com/Data-Corruption/lmdb-go/wrap"
 	"github.com/Data-Corruption/stdx/xlog"
 )
 
-func Migrate(db *wrap.DB, logger *xlog.Logger) error {
-	m := migrator.New()
+func Migrate(db kv.DB, logger *xlog.Logger) error {
+	_, err := MigrateWith(db, logger, nil)
+	return err
+}
+
+// MigrationEvent reports progress of a step, see MigrateWith.
+type MigrationEvent struct {
+	DBI string // "" for the core schema, else a DBI registered with its own migrations
+	migrator.Event
+}
+
+// AppliedMigration is a step a migration applied.
+type AppliedMigration struct {
+	DBI string `json:"dbi,omitempty"` // as in MigrationEvent
+	migrator.StepResult
+}
+
+// MigrationResult describes what a migration did.
+type MigrationResult struct {
+	From    string             `json:"from"` // core schema versions
+	To      string             `json:"to"`
+	Applied []AppliedMigration `json:"applied"`
+}
+
+// Summary lists the applied steps on one line, e.g. for a notification:
+// "v2 (12ms), widgets/v3 (1.5s, 4 batches)", "none" if nothing was pending.
+func (r *MigrationResult) Summary() string {
+	if len(r.Applied) == 0 {
+		return "none"
+	}
+	steps := make([]string, len(r.Applied))
+	for i, step := range r.Applied {
+		steps[i] = x.Ternary(step.DBI == "", "", step.DBI+"/") + step.ID + " (" + step.Duration.Round(time.Millisecond).String() +
+			x.Ternary(step.Batches > 0, fmt.Sprintf(", %d batches", step.Batches), "") + ")"
+	}
+	return strings.Join(steps, ", ")
+}
+
+// MigrateWith is Migrate calling progress (if not nil) as steps start, run
+// batches and finish, and returning what was applied.
+func MigrateWith(db kv.DB, logger *xlog.Logger, progress func(MigrationEvent)) (*MigrationResult, error) {
+	// batched steps commit between batches, each round continues where the last stopped
+	results := map[string]*migrator.Result{}
+	for done := false; !done; {
+		err := db.Update(func(txn kv.Txn) (err error) {
+			done, err = migrateTxn(txn, logger, progress, results, true)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return migrationResult(results), nil
+}
+
+// MigrateTxn brings the data in txn up to the latest schema, returning the
+// versions before and after. Used directly when replacing data wholesale (e.g.
+// import), so the data and its migration commit or roll back together.
+// Batched steps run all their batches in txn.
+func MigrateTxn(txn kv.Txn, logger *xlog.Logger) (from, to string, err error) {
+	results := map[string]*migrator.Result{}
+	if _, err = migrateTxn(txn, logger, nil, results, false); err != nil {
+		return "", "", err
+	}
+	res := migrationResult(results)
+	return res.From, res.To, nil
+}
+
+// migrateTxn is MigrateTxn adding to results per migrator ("" for the core
+// one). With partial it stops after a batch of a batched step (done false) so
+// the caller can commit and call it again.
+func migrateTxn(txn kv.Txn, logger *xlog.Logger, progress func(MigrationEvent), results map[string]*migrator.Result, partial bool) (done bool, err error) {
+	run := func(name string, m *migrator.Migrator[kv.Txn]) (bool, error) {
+		if progress != nil {
+			m.OnProgress(func(ev migrator.Event) { progress(MigrationEvent{DBI: name, Event: ev}) })
+		}
+		res, err := runMigrator(txn, m, migrationKeysFor(name), logger, partial)
+		if err != nil {
+			return false, err
+		}
+		done := len(res.Cursor) == 0
+		if name == "" && done {
+			logger.Infof("Migrated from %q to %q\n", res.From, res.To)
+		} else if name != "" && res.To != res.From {
+			logger.Infof("Migrated %s from %q to %q\n", name, res.From, res.To)
+		}
+		if results[name] == nil {
+			results[name] = res
+		} else {
+			results[name].Merge(res)
+		}
+		return done, nil
+	}
+
+	// Run migrations (ConfigDBI is already cached at this point)
+	if done, err = run("", coreMigrator()); err != nil || !done {
+		return done, err
+	}
+
+	// DBIs registered with their own migrations, see Register
+	for _, entry := range dbiRegistry {
+		if len(entry.migrations) == 0 {
+			continue
+		}
+		if done, err := run(entry.name, dbiMigrator(entry)); err != nil {
+			return false, fmt.Errorf("failed to migrate %s: %w", entry.name, err)
+		} else if !done {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// migrationResult puts the results of migrateTxn in migration order.
+func migrationResult(results map[string]*migrator.Result) *MigrationResult {
+	res := &MigrationResult{Applied: []AppliedMigration{}}
+	add := func(name string) {
+		if r := results[name]; r != nil {
+			for _, step := range r.Applied {
+				res.Applied = append(res.Applied, AppliedMigration{DBI: name, StepResult: step})
+			}
+		}
+	}
+	if core := results[""]; core != nil {
+		res.From, res.To = core.From, core.To
+	}
+	add("")
+	for _, entry := range dbiRegistry {
+		add(entry.name)
+	}
+	return res
+}
+
+// coreMigrator holds the schema steps of the core DBIs.
+func coreMigrator() *migrator.Migrator[kv.Txn] {
+	m := migrator.New[kv.Txn]()
 
 	// Add steps here. Order matters!
 
-	m.Add("v1", "Initial Schema", func(txn *lmdb.Txn) error {
+	m.Add("v1", "Initial Schema", func(txn kv.Txn) error {
 		// Create Config with default values
 		cfg := types.DefaultConfig()
 
@@ -27,35 +167,314 @@ func Migrate(db *wrap.DB, logger *xlog.Logger) error {
 		return nil
 	})
 
+	// `migrate new` adds steps above this line
+
 	/* Example version bump
-	migrator.Add("v2", "Add Thing to Thing", func(txn *lmdb.Txn) error {
+	m.Add("v2", "Add Thing to Thing", func(txn kv.Txn) error {
 		// do v2 stuff
 		return nil
 	})
+
+	Example rewriting a large DBI in batches, each committed on its own
+	m.AddBatched("v3", "Rewrite all Things", func(txn kv.Txn, cursor []byte) ([]byte, error) {
+		// rewrite up to ~1000 entries from cursor, return the key to continue
+		// at, nil when done
+		return nil, nil
+	})
 	*/
 
-	return db.Update(func(txn *lmdb.Txn) error {
-		// Get current version (ConfigDBI is already cached at this point)
-		currentVer := ""
-		if err := TxnGetAndUnmarshal(txn, *ConfigDBI, []byte(ConfigVersionKey), &currentVer); err != nil {
-			if !lmdb.IsNotFound(err) {
-				return fmt.Errorf("failed to get config version: %w", err)
-			}
-			currentVer = ""
+	return m
+}
+
+// dbiMigrator holds the steps a feature package registered its DBI with.
+func dbiMigrator(entry dbiEntry) *migrator.Migrator[kv.Txn] {
+	m := migrator.New[kv.Txn]()
+	for _, step := range entry.migrations {
+		if step.Batch != nil {
+			m.AddBatched(step.ID, step.Desc, func(txn kv.Txn, cursor []byte) ([]byte, error) { return step.Batch(txn, *entry.handle, cursor) })
+		} else {
+			m.Add(step.ID, step.Desc, func(txn kv.Txn) error { return step.Up(txn, *entry.handle) })
+		}
+	}
+	return m
+}
+
+// txnVersion reads a version key, "" if it was never written.
+func txnVersion(txn kv.Txn, key []byte) (string, error) {
+	var ver string
+	if err := TxnGetAndUnmarshal(txn, *ConfigDBI, key, &ver); err != nil && !kv.IsNotFound(err) {
+		return "", err
+	}
+	return ver, nil
+}
+
+// dbiVersionKey is where the last migration applied to a registered DBI is kept.
+func dbiVersionKey(name string) []byte {
+	return []byte(ConfigVersionKey + ":" + name)
+}
+
+// migrationKeys are where the state of one migrator is kept in the config DBI.
+type migrationKeys struct {
+	version, history, cursor []byte
+}
+
+// migrationKeysFor returns the keys of the registered DBI name, or of the core
+// schema for "".
+func migrationKeysFor(name string) migrationKeys {
+	if name == "" {
+		return migrationKeys{[]byte(ConfigVersionKey), []byte(ConfigHistoryKey), []byte(ConfigCursorKey)}
+	}
+	return migrationKeys{dbiVersionKey(name), []byte(ConfigHistoryKey + ":" + name), []byte(ConfigCursorKey + ":" + name)}
+}
+
+// runMigrator applies the pending steps of m, after making sure the applied
+// ones weren't edited since. With partial it stops after a batch of a batched
+// step, keeping the cursor to continue from (also left in the result).
+func runMigrator(txn kv.Txn, m *migrator.Migrator[kv.Txn], keys migrationKeys, logger *xlog.Logger, partial bool) (*migrator.Result, error) {
+	from, err := txnVersion(txn, keys.version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get version: %w", err)
+	}
+	missing, err := verifyHistory(txn, m, keys.history)
+	if err != nil {
+		return nil, err
+	}
+	var cursor []byte
+	if err := TxnGetAndUnmarshal(txn, *ConfigDBI, keys.cursor, &cursor); err != nil && !kv.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to get migration cursor: %w", err)
+	}
+	resumed := len(cursor) > 0
+
+	res, err := m.RunPartial(txn, from, cursor, logger)
+	for !partial && err == nil && len(res.Cursor) != 0 {
+		var next *migrator.Result
+		next, err = m.RunPartial(txn, res.To, res.Cursor, logger)
+		res.Merge(next)
+	}
+	if err != nil {
+		return nil, err
+	}
+	to := res.To
+
+	if to != from {
+		if err := TxnMarshalAndPut(txn, *ConfigDBI, keys.version, to); err != nil {
+			return nil, fmt.Errorf("failed to update version: %w", err)
 		}
+	}
+	if missing || to != from {
+		if err := putHistory(txn, m, keys.history, to); err != nil {
+			return nil, err
+		}
+	}
+	if len(res.Cursor) > 0 {
+		if err := TxnMarshalAndPut(txn, *ConfigDBI, keys.cursor, res.Cursor); err != nil {
+			return nil, fmt.Errorf("failed to update migration cursor: %w", err)
+		}
+	} else if resumed {
+		if err := TxnDeleteKey(txn, *ConfigDBI, keys.cursor); err != nil {
+			return nil, fmt.Errorf("failed to clear migration cursor: %w", err)
+		}
+	}
+	return res, nil
+}
+
+// verifyHistory checks the recorded checksums of applied steps against m.
+// Databases migrated before history was kept have none (missing), it's then
+// recorded from the current version.
+func verifyHistory(txn kv.Txn, m *migrator.Migrator[kv.Txn], key []byte) (missing bool, err error) {
+	var history []migrator.Applied
+	if err := TxnGetAndUnmarshal(txn, *ConfigDBI, key, &history); kv.IsNotFound(err) {
+		return true, nil
+	} else if err != nil {
+		return false, fmt.Errorf("failed to get migration history: %w", err)
+	}
+	return false, m.Verify(history)
+}
 
-		// Run migrations
-		newVer, err := m.Run(txn, currentVer, logger)
+// putHistory records the steps of m applied up to version.
+func putHistory(txn kv.Txn, m *migrator.Migrator[kv.Txn], key []byte, version string) error {
+	history, err := m.History(version)
+	if err != nil {
+		return err
+	}
+	if err := TxnMarshalAndPut(txn, *ConfigDBI, key, history); err != nil {
+		return fmt.Errorf("failed to update migration history: %w", err)
+	}
+	return nil
+}
+
+// PendingMigration is a step the next open would apply, see Plan.
+type PendingMigration struct {
+	DBI  string `json:"dbi,omitempty"` // "" for the core schema, else a DBI registered with its own migrations
+	ID   string `json:"id"`
+	Desc string `json:"desc"`
+}
+
+// TxnPlan returns the migrations MigrateTxn would apply to txn, in order.
+func TxnPlan(txn kv.Txn) ([]PendingMigration, error) {
+	return plan(func(key []byte) (string, error) { return txnVersion(txn, key) })
+}
+
+// plan lists the pending migrations given how to read a version key.
+func plan(version func(key []byte) (string, error)) ([]PendingMigration, error) {
+	var steps []PendingMigration
+	add := func(dbi string, m *migrator.Migrator[kv.Txn], key []byte) error {
+		from, err := version(key)
+		if err != nil {
+			return fmt.Errorf("failed to get version: %w", err)
+		}
+		pending, err := m.Plan(from)
 		if err != nil {
 			return err
 		}
+		for _, step := range pending {
+			steps = append(steps, PendingMigration{DBI: dbi, ID: step.ID, Desc: step.Desc})
+		}
+		return nil
+	}
+	if err := add("", coreMigrator(), migrationKeysFor("").version); err != nil {
+		return nil, err
+	}
+	for _, entry := range dbiRegistry {
+		if len(entry.migrations) > 0 {
+			if err := add(entry.name, dbiMigrator(entry), migrationKeysFor(entry.name).version); err != nil {
+				return nil, fmt.Errorf("%s: %w", entry.name, err)
+			}
+		}
+	}
+	return steps, nil
+}
+
+// Plan returns the core schema version of the database in directory and the
+// migrations opening it would apply, without migrating: only read
+// transactions are used. A directory without a database plans every
+// migration. s is as for NewSealed, though sealing isn't turned on. Like
+// Snapshot it must not be called while this process has the database open.
+// A version this build doesn't know fails with migrator.ErrUnknownVersion,
+// the core version is still returned then.
+func Plan(directory string, s *Sealing) (string, []PendingMigration, error) {
+	if _, err := os.Stat(filepath.Join(directory, kv.DataFile)); os.IsNotExist(err) {
+		steps, err := plan(func([]byte) (string, error) { return "", nil })
+		return "", steps, err
+	}
+	opened.Store(true)
+	db, _, err := kv.Open(directory, DBINameList())
+	if err != nil {
+		return "", nil, err
+	}
+	defer db.Close()
+	cacheDBIs(db)
+	if err := viewSeal(db, s); err != nil {
+		return "", nil, err
+	}
 
-		// Update version in DB
-		if err := TxnMarshalAndPut(txn, *ConfigDBI, []byte(ConfigVersionKey), newVer); err != nil {
-			return fmt.Errorf("failed to update config version: %w", err)
+	var ver string
+	var steps []PendingMigration
+	err = db.View(func(txn kv.Txn) error {
+		if ver, err = txnVersion(txn, []byte(ConfigVersionKey)); err != nil {
+			return err
 		}
+		steps, err = TxnPlan(txn)
+		return err
+	})
+	return ver, steps, err
+}
 
-		logger.Infof("Migrated from %q to %q\n", currentVer, newVer)
-		return nil
+// Schema states, see ReadSchemaStatus.
+const (
+	SchemaNotInitialized = "not-initialized" // no database, or it was never migrated
+	SchemaBehind         = "behind"          // migrations pending
+	SchemaUpToDate       = "up-to-date"
+	SchemaAhead          = "ahead" // migrated by a newer build
+)
+
+type SchemaStatus struct {
+	Version string             `json:"version"` // core schema version of the database, "" if not initialized
+	Latest  string             `json:"latest"`  // last core migration this build knows
+	State   string             `json:"state"`
+	Pending []PendingMigration `json:"pending"`
+}
+
+// ReadSchemaStatus compares the database in directory with the migrations of
+// this build. Read-only, see Plan.
+func ReadSchemaStatus(directory string, s *Sealing) (*SchemaStatus, error) {
+	ver, steps, err := Plan(directory, s)
+	st := &SchemaStatus{Version: ver, Latest: coreMigrator().Latest(), Pending: steps}
+	switch {
+	case errors.Is(err, migrator.ErrUnknownVersion):
+		st.State = SchemaAhead
+	case err != nil:
+		return nil, err
+	case ver == "":
+		st.State = SchemaNotInitialized
+	case len(steps) > 0:
+		st.State = SchemaBehind
+	default:
+		st.State = SchemaUpToDate
+	}
+	if st.Pending == nil {
+		st.Pending = []PendingMigration{}
+	}
+	return st, nil
+}
+
+// SchemaVersion returns the ID of the last migration applied to the database.
+func SchemaVersion(db kv.DB) (string, error) {
+	var ver string
+	err := db.View(func(txn kv.Txn) error {
+		return TxnGetAndUnmarshal(txn, *ConfigDBI, []byte(ConfigVersionKey), &ver)
 	})
+	return ver, err
+}
+
+// TxnDBIVersion returns the last migration applied to the data of the DBI
+// name: its own for DBIs registered with migrations, the core schema's for
+// the rest.
+func TxnDBIVersion(txn kv.Txn, name string) (string, error) {
+	entry, err := lookupEntry(name)
+	if err != nil {
+		return "", err
+	}
+	return txnVersion(txn, migrationKeysFor(x.Ternary(len(entry.migrations) > 0, name, "")).version)
+}
+
+// TxnSetDBIVersion records the data of the DBI name as migrated up to version,
+// for data transformed out of process (see transfer.ImportDBI). The steps
+// after version run on the next migration. Only DBIs registered with
+// migrations have a version of their own, for the rest version must be the
+// current core schema version, which one DBI can't move.
+func TxnSetDBIVersion(txn kv.Txn, name, version string) error {
+	entry, err := lookupEntry(name)
+	if err != nil {
+		return err
+	}
+	if len(entry.migrations) == 0 {
+		current, err := txnVersion(txn, migrationKeysFor("").version)
+		if err != nil {
+			return fmt.Errorf("failed to get config version: %w", err)
+		}
+		if version != current {
+			return errs.New(errs.Invalid, fmt.Sprintf("%s follows the core schema, which is at %q, not %q", name, current, version))
+		}
+		return nil
+	}
+	m, keys := dbiMigrator(entry), migrationKeysFor(name)
+	if _, err := m.Plan(version); err != nil {
+		return errs.Wrap(errs.Invalid, err, fmt.Sprintf("unknown %s version", name))
+	}
+	if version == "" {
+		if err := TxnDeleteKey(txn, *ConfigDBI, keys.version); err != nil {
+			return fmt.Errorf("failed to update %s version: %w", name, err)
+		}
+	} else if err := TxnMarshalAndPut(txn, *ConfigDBI, keys.version, version); err != nil {
+		return fmt.Errorf("failed to update %s version: %w", name, err)
+	}
+	if err := putHistory(txn, m, keys.history, version); err != nil {
+		return err
+	}
+	// a batched step in progress doesn't apply to the new data
+	if err := TxnDeleteKey(txn, *ConfigDBI, keys.cursor); err != nil {
+		return fmt.Errorf("failed to clear migration cursor: %w", err)
+	}
+	return nil
 }
@@ -1,13 +1,15 @@
 package database
 
 import (
+	"errors"
 	"path/filepath"
+	"slices"
 	"sprout/internal/build"
+	"sprout/internal/platform/database/kv"
 	"sprout/internal/types"
+	"sprout/pkg/migrator"
 	"testing"
 
-	"github.com/Data-Corruption/lmdb-go/lmdb"
-	"github.com/Data-Corruption/lmdb-go/wrap"
 	"github.com/Data-Corruption/stdx/xlog"
 )
 
@@ -26,17 +28,14 @@ func TestMigrate(t *testing.T) {
 
 	// Helper to open DB without running Migrate() automatically
 	// We want to test Migrate() explicitly, but database.New() calls it.
-	// So we'll use wrap.New() directly to get a raw DB, then call Migrate().
-	openRawDB := func() *wrap.DB {
-		db, _, err := wrap.New(dbPath, DBINameList())
+	// So we'll use kv.Open() directly to get a raw DB, then call Migrate().
+	openRawDB := func() kv.DB {
+		db, _, err := kv.Open(dbPath, DBINameList())
 		if err != nil {
 			t.Fatalf("Failed to open raw DB: %v", err)
 		}
 		// Cache DBIs manually since we're bypassing database.New()
-		dbis := db.GetDBis()
-		for _, entry := range dbiRegistry {
-			*entry.handle = dbis[entry.name]
-		}
+		cacheDBIs(db)
 		return db
 	}
 
@@ -51,7 +50,7 @@ func TestMigrate(t *testing.T) {
 
 		// Verify Config Exists
 		var cfg types.Configuration
-		err := db.View(func(txn *lmdb.Txn) error {
+		err := db.View(func(txn kv.Txn) error {
 			return TxnGetAndUnmarshal(txn, *ConfigDBI, []byte(ConfigDataKey), &cfg)
 		})
 		if err != nil {
@@ -70,7 +69,7 @@ func TestMigrate(t *testing.T) {
 
 		// Verify Version
 		var version string
-		err = db.View(func(txn *lmdb.Txn) error {
+		err = db.View(func(txn kv.Txn) error {
 			return TxnGetAndUnmarshal(txn, *ConfigDBI, []byte(ConfigVersionKey), &version)
 		})
 		if err != nil {
@@ -92,7 +91,7 @@ func TestMigrate(t *testing.T) {
 
 		// Verify Version is still v1
 		var version string
-		err = db.View(func(txn *lmdb.Txn) error {
+		err = db.View(func(txn kv.Txn) error {
 			return TxnGetAndUnmarshal(txn, *ConfigDBI, []byte(ConfigVersionKey), &version)
 		})
 		if err != nil {
@@ -112,3 +111,130 @@ func TestMigrate(t *testing.T) {
 		})
 	*/
 }
+
+func TestPlan(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "db")
+	logger, err := xlog.New(filepath.Join(tmpDir, "logs"), "none")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	ids := func(steps []PendingMigration) (out []string) {
+		for _, s := range steps {
+			out = append(out, s.DBI+"/"+s.ID)
+		}
+		return out
+	}
+
+	// No database yet, everything is pending (incl. registered DBIs, see register_test)
+	ver, steps, err := Plan(dbPath, nil)
+	if err != nil {
+		t.Fatalf("Plan() on a missing database failed: %v", err)
+	}
+	if got := ids(steps); ver != "" || !slices.Equal(got, []string{"/v1", "test-widgets/v1", "test-widgets/v2", "test-batched/v1"}) {
+		t.Errorf("Plan() = %q, %v", ver, got)
+	}
+
+	// Planning an existing database writes nothing
+	db, _, err := kv.Open(dbPath, DBINameList())
+	if err != nil {
+		t.Fatalf("Failed to open raw DB: %v", err)
+	}
+	db.Close()
+	if _, steps, err = Plan(dbPath, nil); err != nil || len(steps) != 4 {
+		t.Fatalf("Plan() on an empty database = %v, %v", ids(steps), err)
+	}
+	if _, steps, err = Plan(dbPath, nil); err != nil || len(steps) != 4 {
+		t.Fatalf("second Plan() = %v, %v, want the same steps", ids(steps), err)
+	}
+
+	db, err = New(dbPath, logger)
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	db.Close()
+	if ver, steps, err = Plan(dbPath, nil); err != nil || ver != "v1" || len(steps) != 0 {
+		t.Errorf("Plan() after migrating = %q, %v, %v, want v1 and nothing pending", ver, ids(steps), err)
+	}
+}
+
+func TestReadSchemaStatus(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "db")
+	logger, err := xlog.New(filepath.Join(tmpDir, "logs"), "none")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	check := func(wantVer, wantState string, wantPending int) {
+		t.Helper()
+		st, err := ReadSchemaStatus(dbPath, nil)
+		if err != nil {
+			t.Fatalf("ReadSchemaStatus() failed: %v", err)
+		}
+		if st.Version != wantVer || st.State != wantState || len(st.Pending) != wantPending || st.Latest != "v1" {
+			t.Errorf("ReadSchemaStatus() = %+v, want version %q, state %s, %d pending", st, wantVer, wantState, wantPending)
+		}
+	}
+	check("", SchemaNotInitialized, 4)
+
+	db, err := New(dbPath, logger)
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	db.Close()
+	check("v1", SchemaUpToDate, 0)
+
+	// as left behind by a newer build
+	if db, _, err = kv.Open(dbPath, DBINameList()); err != nil {
+		t.Fatalf("Failed to open raw DB: %v", err)
+	}
+	if err := Put(db, *ConfigDBI, []byte(ConfigVersionKey), "v99"); err != nil {
+		t.Fatalf("Failed to write version: %v", err)
+	}
+	db.Close()
+	check("v99", SchemaAhead, 0)
+}
+
+func TestMigrationHistory(t *testing.T) {
+	tmpDir := t.TempDir()
+	dbPath := filepath.Join(tmpDir, "db")
+	logger, err := xlog.New(filepath.Join(tmpDir, "logs"), "none")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	db, err := New(dbPath, logger)
+	if err != nil {
+		t.Fatalf("New() failed: %v", err)
+	}
+	history, err := View[[]migrator.Applied](db, *ConfigDBI, []byte(ConfigHistoryKey))
+	if err != nil || len(*history) != 1 || (*history)[0].ID != "v1" {
+		t.Fatalf("history = %v, %v, want v1 recorded", history, err)
+	}
+	want := (*history)[0]
+
+	// Databases migrated before history was kept get it recorded
+	if err := DeleteKey(db, *ConfigDBI, []byte(ConfigHistoryKey)); err != nil {
+		t.Fatalf("Failed to delete history: %v", err)
+	}
+	if err := Migrate(db, logger); err != nil {
+		t.Fatalf("Migrate() without history failed: %v", err)
+	}
+	if history, err = View[[]migrator.Applied](db, *ConfigDBI, []byte(ConfigHistoryKey)); err != nil || len(*history) != 1 || (*history)[0] != want {
+		t.Fatalf("history = %v, %v, want %v backfilled", history, err, want)
+	}
+
+	// As if the step's description was edited after it was applied
+	if err := Put(db, *ConfigDBI, []byte(ConfigHistoryKey), []migrator.Applied{{ID: "v1", Sum: "edited"}}); err != nil {
+		t.Fatalf("Failed to write history: %v", err)
+	}
+	if err := Migrate(db, logger); !errors.Is(err, migrator.ErrHistoryChanged) {
+		t.Errorf("Migrate() with edited history = %v, want ErrHistoryChanged", err)
+	}
+	db.Close()
+}
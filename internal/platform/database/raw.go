@@ -0,0 +1,144 @@
+package database
+
+import (
+	"bytes"
+	"fmt"
+	"sprout/internal/platform/database/kv"
+	"sprout/pkg/errs"
+)
+
+// Raw access to any registered DBI by name, for debugging (`db get/put/del/list`).
+// Unlike the typed helpers nothing is marshaled or validated, but values are
+// still sealed and unsealed, so what's read and written is the plaintext.
+
+// lookupDBI returns the cached handle of the registered DBI name.
+func lookupDBI(name string) (kv.DBI, error) {
+	entry, err := lookupEntry(name)
+	if err != nil {
+		return kv.DBI{}, err
+	}
+	return *entry.handle, nil
+}
+
+// lookupEntry returns the registry entry of the DBI name.
+func lookupEntry(name string) (dbiEntry, error) {
+	for _, entry := range dbiRegistry {
+		if entry.name == name {
+			return entry, nil
+		}
+	}
+	return dbiEntry{}, errs.New(errs.Invalid, fmt.Sprintf("unknown DBI %q, registered: %v", name, DBINameList()))
+}
+
+// guardRaw refuses writes to keys the database package manages itself.
+func guardRaw(name string, key []byte) error {
+	if name == ConfigDBI.Name() && string(key) == ConfigSealKey {
+		return errs.New(errs.Invalid, "the seal record is managed by `db encrypt`, not writable")
+	}
+	return nil
+}
+
+// RawGet returns a copy of the value of key in the DBI name.
+// errs.Is(err, errs.NotFound) will be true if the key was not found.
+func RawGet(db kv.DB, name string, key []byte) ([]byte, error) {
+	dbi, err := lookupDBI(name)
+	if err != nil {
+		return nil, err
+	}
+	var value []byte
+	err = db.View(func(txn kv.Txn) error {
+		v, err := txn.Get(dbi, key)
+		if err != nil {
+			return err
+		}
+		if v, err = unseal(dbi, key, v); err != nil {
+			return err
+		}
+		value = bytes.Clone(v)
+		return nil
+	})
+	if err != nil {
+		return nil, classify(err)
+	}
+	return value, nil
+}
+
+// RawPut stores value under key in the DBI name as is.
+func RawPut(db kv.DB, name string, key, value []byte) error {
+	return db.Update(func(txn kv.Txn) error {
+		return TxnRawPut(txn, name, key, value)
+	})
+}
+
+// TxnRawPut is RawPut within txn.
+func TxnRawPut(txn kv.Txn, name string, key, value []byte) error {
+	dbi, err := lookupDBI(name)
+	if err != nil {
+		return err
+	}
+	if err := guardRaw(name, key); err != nil {
+		return err
+	}
+	return txn.Put(dbi, key, seal(dbi, key, value))
+}
+
+// RawDelete removes key from the DBI name.
+// errs.Is(err, errs.NotFound) will be true if the key was not found.
+func RawDelete(db kv.DB, name string, key []byte) error {
+	dbi, err := lookupDBI(name)
+	if err != nil {
+		return err
+	}
+	if err := guardRaw(name, key); err != nil {
+		return err
+	}
+	return classify(db.Update(func(txn kv.Txn) error {
+		return txn.Delete(dbi, key)
+	}))
+}
+
+// RawList calls fn in key order for up to limit entries (all if limit <= 0)
+// of the DBI name whose keys start with prefix. The slices are only valid
+// during the call.
+func RawList(db kv.DB, name string, prefix []byte, limit int, fn func(key, value []byte) error) error {
+	return db.View(func(txn kv.Txn) error {
+		return TxnRawList(txn, name, prefix, limit, fn)
+	})
+}
+
+// TxnRawList is RawList within txn.
+func TxnRawList(txn kv.Txn, name string, prefix []byte, limit int, fn func(key, value []byte) error) error {
+	dbi, err := lookupDBI(name)
+	if err != nil {
+		return err
+	}
+	cur, err := txn.Cursor(dbi)
+	if err != nil {
+		return fmt.Errorf("failed to create cursor: %w", err)
+	}
+	defer cur.Close()
+
+	n := 0
+	var k, v []byte
+	if len(prefix) == 0 {
+		k, v, err = cur.First() // LMDB doesn't take an empty key to seek to
+	} else {
+		k, v, err = cur.Seek(prefix)
+	}
+	for ; err == nil && bytes.HasPrefix(k, prefix); k, v, err = cur.Next() {
+		if limit > 0 && n == limit {
+			return nil
+		}
+		if v, err = unseal(dbi, k, v); err != nil {
+			return err
+		}
+		if err := fn(k, v); err != nil {
+			return err
+		}
+		n++
+	}
+	if err != nil && !kv.IsNotFound(err) {
+		return fmt.Errorf("failed to get entry: %w", err)
+	}
+	return nil
+}
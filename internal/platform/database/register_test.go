@@ -0,0 +1,151 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sprout/internal/platform/database/kv"
+	"testing"
+
+	"github.com/Data-Corruption/stdx/xlog"
+)
+
+var widgetRuns int
+
+// registered like a feature package would, at init
+var widgetsDBI = Register("test-widgets",
+	DBIMigration{ID: "v1", Desc: "default widget", Up: func(txn kv.Txn, dbi kv.DBI) error {
+		widgetRuns++
+		return TxnPut(txn, dbi, []byte("main"), 1)
+	}},
+	DBIMigration{ID: "v2", Desc: "bump widget", Up: func(txn kv.Txn, dbi kv.DBI) error {
+		widgetRuns++
+		return TxnUpdate(txn, dbi, []byte("main"), func(n *int) error { *n++; return nil })
+	}},
+)
+
+func TestRegister(t *testing.T) {
+	dir := t.TempDir()
+	logger, err := xlog.New(filepath.Join(dir, "logs"), "none")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+
+	widgetRuns = 0
+	for range 2 { // the second open finds nothing pending
+		db, err := New(filepath.Join(dir, "db"), logger)
+		if err != nil {
+			t.Fatalf("New: %v", err)
+		}
+		n, err := View[int](db, *widgetsDBI, []byte("main"))
+		if err != nil || *n != 2 {
+			t.Errorf("widget = %v, %v, want 2 after both migrations", n, err)
+		}
+		ver, err := View[string](db, *ConfigDBI, dbiVersionKey("test-widgets"))
+		if err != nil || *ver != "v2" {
+			t.Errorf("widgets version = %v, %v, want v2", ver, err)
+		}
+		db.Close()
+	}
+	if widgetRuns != 2 {
+		t.Errorf("migrations ran %d times, want once each", widgetRuns)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Register after open didn't panic")
+		}
+	}()
+	Register("too-late")
+}
+
+var (
+	batchRuns   int
+	batchFailAt = -1 // start of the batch that fails, see TestBatchedMigration
+
+	// 5 entries, 2 per batch
+	batchedDBI = Register("test-batched", DBIMigration{ID: "v1", Desc: "fill", Batch: func(txn kv.Txn, dbi kv.DBI, cursor []byte) ([]byte, error) {
+		batchRuns++
+		start := 0
+		if cursor != nil {
+			start = int(cursor[0])
+		}
+		if start == batchFailAt {
+			return nil, errors.New("interrupted")
+		}
+		for i := start; i < min(start+2, 5); i++ {
+			if err := txn.Put(dbi, []byte{byte(i)}, nil); err != nil {
+				return nil, err
+			}
+		}
+		if start+2 >= 5 {
+			return nil, nil
+		}
+		return []byte{byte(start + 2)}, nil
+	}})
+)
+
+func TestBatchedMigration(t *testing.T) {
+	dir := t.TempDir()
+	logger, err := xlog.New(filepath.Join(dir, "logs"), "none")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer logger.Close()
+	db, _, err := kv.Open(filepath.Join(dir, "db"), DBINameList())
+	if err != nil {
+		t.Fatalf("Failed to open raw DB: %v", err)
+	}
+	defer db.Close()
+	cacheDBIs(db)
+
+	// interrupted after the first batch committed
+	batchRuns, batchFailAt = 0, 2
+	if err := Migrate(db, logger); err == nil {
+		t.Fatal("Migrate() with a failing batch succeeded")
+	}
+	cursor, err := View[[]byte](db, *ConfigDBI, migrationKeysFor("test-batched").cursor)
+	if err != nil || len(*cursor) != 1 || (*cursor)[0] != 2 {
+		t.Fatalf("cursor = %v, %v, want the second batch", cursor, err)
+	}
+
+	// the next open continues there, one transaction per batch
+	batchRuns, batchFailAt = 0, -1
+	var events []string
+	res, err := MigrateWith(db, logger, func(ev MigrationEvent) {
+		events = append(events, fmt.Sprintf("%s/%s:%d", ev.DBI, ev.ID, ev.Kind))
+	})
+	if err != nil {
+		t.Fatalf("MigrateWith() failed: %v", err)
+	}
+	if batchRuns != 2 {
+		t.Errorf("%d batches ran on resume, want 2", batchRuns)
+	}
+	// resumed mid-step, so no StepStarted
+	want := []string{"test-batched/v1:1", "test-batched/v1:1", "test-batched/v1:2"}
+	if !slices.Equal(events, want) {
+		t.Errorf("events = %v, want %v", events, want)
+	}
+	if len(res.Applied) != 1 || res.Applied[0].DBI != "test-batched" || res.Applied[0].Batches != 2 {
+		t.Errorf("result = %+v, want test-batched/v1 in 2 batches", res.Applied)
+	}
+	err = db.View(func(txn kv.Txn) error {
+		for i := range 5 {
+			if _, err := txn.Get(*batchedDBI, []byte{byte(i)}); err != nil {
+				t.Errorf("entry %d: %v", i, err)
+			}
+		}
+		if _, err := txn.Get(*ConfigDBI, migrationKeysFor("test-batched").cursor); !kv.IsNotFound(err) {
+			t.Errorf("cursor left behind: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ver, err := View[string](db, *ConfigDBI, dbiVersionKey("test-batched")); err != nil || *ver != "v1" {
+		t.Errorf("version = %v, %v, want v1", ver, err)
+	}
+}
@@ -0,0 +1,14 @@
+package database
+
+// LockFile is LMDB's lock file next to data.mdb. It only holds the reader
+// table and write mutex, no data, LMDB recreates it when missing.
+const LockFile = "lock.mdb"
+
+// RepairReport describes what Repair found and did.
+type RepairReport struct {
+	Readers      []int // PIDs in the reader table before the repair, may repeat (one slot per thread)
+	StaleReaders int   // slots of exited processes that were cleared
+	LockHolder   int   // PID of a process with the environment open, 0 if none
+	LockRemoved  bool  // lock.mdb couldn't be opened, was unused, and was deleted
+	OpenErr      error // why the first open failed, if it did
+}
@@ -0,0 +1,27 @@
+//go:build bolt
+
+package database
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sprout/internal/platform/database/kv"
+)
+
+// Repair checks the database in dir opens. bolt has no reader table or lock
+// file to go stale (its file lock dies with the process), so there's nothing
+// to clear and removeLock is ignored.
+func Repair(dir string, removeLock bool) (*RepairReport, error) {
+	if _, err := os.Stat(filepath.Join(dir, kv.DataFile)); err != nil {
+		return nil, fmt.Errorf("no database in %s: %w", dir, err)
+	}
+	r := &RepairReport{}
+	db, err := kv.OpenBolt(dir, true)
+	if err != nil {
+		r.OpenErr = err
+		return r, fmt.Errorf("failed to open database: %w", err)
+	}
+	db.Close()
+	return r, nil
+}
@@ -0,0 +1,109 @@
+//go:build !bolt
+
+package database
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sprout/internal/platform/database/kv"
+	"strconv"
+	"strings"
+
+	"github.com/Data-Corruption/lmdb-go/lmdb"
+	"github.com/Data-Corruption/lmdb-go/wrap"
+	"golang.org/x/sys/unix"
+)
+
+// Repair clears stale reader slots left by crashed processes in the database
+// in dir. If the environment won't open because lock.mdb is broken and no
+// other process has it open, lock.mdb is deleted (removeLock must be set) and
+// the open retried. Like Snapshot it must not be called while this process
+// has the database open.
+func Repair(dir string, removeLock bool) (*RepairReport, error) {
+	if _, err := os.Stat(filepath.Join(dir, kv.DataFile)); err != nil {
+		return nil, fmt.Errorf("no database in %s: %w", dir, err)
+	}
+	lockPath := filepath.Join(dir, LockFile)
+	r := &RepairReport{}
+	var err error
+	if r.LockHolder, err = lockHolder(lockPath); err != nil {
+		return nil, fmt.Errorf("failed to check %s: %w", LockFile, err)
+	}
+
+	env, err := openEnv(dir)
+	if err != nil {
+		r.OpenErr = err
+		if r.LockHolder != 0 {
+			return r, fmt.Errorf("failed to open database, in use by PID %d: %w", r.LockHolder, err)
+		}
+		if !removeLock {
+			return r, fmt.Errorf("failed to open database: %w", err)
+		}
+		if err := os.Remove(lockPath); err != nil && !os.IsNotExist(err) {
+			return r, fmt.Errorf("failed to remove %s: %w", LockFile, err)
+		}
+		r.LockRemoved = true
+		if env, err = openEnv(dir); err != nil {
+			return r, fmt.Errorf("failed to open database after removing %s: %w", LockFile, err)
+		}
+	}
+	defer env.Close()
+
+	if err := env.ReaderList(func(line string) error {
+		fields := strings.Fields(line)
+		if len(fields) > 0 {
+			if pid, err := strconv.Atoi(fields[0]); err == nil {
+				r.Readers = append(r.Readers, pid)
+			}
+		}
+		return nil
+	}); err != nil {
+		return r, fmt.Errorf("failed to list readers: %w", err)
+	}
+	if r.StaleReaders, err = env.ReaderCheck(); err != nil {
+		return r, fmt.Errorf("failed to clear stale readers: %w", err)
+	}
+	return r, nil
+}
+
+func openEnv(dir string) (*lmdb.Env, error) {
+	env, err := lmdb.NewEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create environment: %w", err)
+	}
+	if err := env.SetMaxDBs(wrap.MaxNamedDBs); err == nil {
+		err = env.SetMapSize(wrap.MapSize)
+	}
+	if err == nil {
+		err = env.Open(dir, 0, 0644)
+	}
+	if err != nil {
+		env.Close()
+		return nil, err
+	}
+	return env, nil
+}
+
+// lockHolder returns the PID of a process with the environment open, 0 if
+// none. Every process using the environment holds a read lock on the first
+// byte of lock.mdb, so a write lock on it conflicts with all of them. Locks
+// of this process don't count, fcntl locks are per process.
+func lockHolder(path string) (int, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	lk := unix.Flock_t{Type: unix.F_WRLCK, Whence: 0, Start: 0, Len: 1}
+	if err := unix.FcntlFlock(f.Fd(), unix.F_GETLK, &lk); err != nil {
+		return 0, err
+	}
+	if lk.Type == unix.F_UNLCK {
+		return 0, nil
+	}
+	return int(lk.Pid), nil
+}
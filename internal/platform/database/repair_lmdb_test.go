@@ -0,0 +1,54 @@
+//go:build !bolt
+
+package database
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Data-Corruption/lmdb-go/wrap"
+)
+
+func TestRepair(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := Repair(dir, true); err == nil {
+		t.Fatal("expected error for missing database")
+	}
+
+	db, _, err := wrap.New(dir, DBINameList())
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	db.Close()
+
+	r, err := Repair(dir, false)
+	if err != nil {
+		t.Fatalf("Repair: %v", err)
+	}
+	if r.StaleReaders != 0 || r.LockHolder != 0 || r.LockRemoved {
+		t.Errorf("unexpected report for healthy database: %+v", r)
+	}
+
+	// a lock file LMDB can't use, e.g. replaced by something else after a crash
+	lockPath := filepath.Join(dir, LockFile)
+	if err := os.Remove(lockPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(lockPath, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Repair(dir, false); err == nil {
+		t.Fatal("expected open error without removeLock")
+	}
+	r, err = Repair(dir, true)
+	if err != nil {
+		t.Fatalf("Repair with removeLock: %v", err)
+	}
+	if !r.LockRemoved || r.OpenErr == nil {
+		t.Errorf("expected lock file removal, got %+v", r)
+	}
+	if info, err := os.Stat(lockPath); err != nil || info.IsDir() {
+		t.Errorf("expected a fresh lock file, stat: %v", err)
+	}
+}
@@ -0,0 +1,313 @@
+package database
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sprout/internal/platform/database/kv"
+	"sprout/pkg/errs"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	SealKeyFile       = "db.key"        // in the storage dir, see LoadSealing
+	SealPassphraseEnv = "DB_PASSPHRASE" // takes precedence over SealKeyFile
+
+	sealKeySize     = 32 // AES-256
+	sealSaltSize    = 16
+	sealPBKDF2Iters = 600_000
+)
+
+var (
+	// sealed values start with it, JSON never starts with a NUL byte
+	sealMagic = []byte("\x00SPV1")
+	sealCheck = []byte("sprout")
+
+	ErrSealed = errors.New("value is encrypted but no database key is set")
+)
+
+// Sealing encrypts values written through the helpers in this package with
+// AES-256-GCM, so tokens and user data aren't plaintext in data.mdb. Each
+// value gets a random nonce and its DBI's name and key as additional data, so
+// sealed values can't be swapped between keys or moved to another DBI. Keys,
+// index entries and anything written with txn.Put directly stay as is.
+//
+// Plaintext values keep reading fine and are sealed the next time they're
+// written, the config right when sealing is turned on. Their old pages stay
+// in data.mdb until reused, `db compact` drops them.
+type Sealing struct {
+	Key        []byte // 32 bytes, see LoadSealing
+	Passphrase string // stretched with PBKDF2-SHA256, the salt is kept in the database
+}
+
+// sealRecord is stored unsealed under ConfigSealKey once sealing is on.
+type sealRecord struct {
+	Mode  string `json:"mode"` // "key" or "passphrase"
+	Salt  []byte `json:"salt,omitempty"`
+	Check []byte `json:"check"` // sealCheck sealed, tells a wrong key apart right away
+}
+
+// sealer is the AEAD of the open database, nil if values aren't sealed.
+// There's one per process, like the cached DBI handles.
+var sealer atomic.Pointer[cipher.AEAD]
+
+// LoadSealing returns the Sealing configured for the database in storageDir:
+// the passphrase in SealPassphraseEnv if set, else the hex encoded key in
+// SealKeyFile if it exists. Nil if neither is.
+func LoadSealing(storageDir string) (*Sealing, error) {
+	if pass := os.Getenv(SealPassphraseEnv); pass != "" {
+		return &Sealing{Passphrase: pass}, nil
+	}
+	path := filepath.Join(storageDir, SealKeyFile)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read database key: %w", err)
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(key) != sealKeySize {
+		return nil, fmt.Errorf("invalid database key in %s, want %d hex encoded bytes", path, sealKeySize)
+	}
+	return &Sealing{Key: key}, nil
+}
+
+// CreateSealKey writes a new random key to SealKeyFile in storageDir (mode
+// 0600). It fails if one already exists, replacing it would lose the data.
+func CreateSealKey(storageDir string) (string, error) {
+	path := filepath.Join(storageDir, SealKeyFile)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if errors.Is(err, os.ErrExist) {
+		return path, errs.New(errs.Conflict, fmt.Sprintf("%s already exists", path))
+	} else if err != nil {
+		return path, fmt.Errorf("failed to create database key: %w", err)
+	}
+	key := make([]byte, sealKeySize)
+	rand.Read(key)
+	if _, err := f.WriteString(hex.EncodeToString(key) + "\n"); err != nil {
+		f.Close()
+		os.Remove(path)
+		return path, fmt.Errorf("failed to write database key: %w", err)
+	}
+	return path, f.Close()
+}
+
+func (s *Sealing) mode() string {
+	if s.Passphrase != "" {
+		return "passphrase"
+	}
+	return "key"
+}
+
+func (s *Sealing) aead(salt []byte) (cipher.AEAD, error) {
+	key := s.Key
+	if s.Passphrase != "" {
+		var err error
+		if key, err = pbkdf2.Key(sha256.New, s.Passphrase, salt, sealPBKDF2Iters, sealKeySize); err != nil {
+			return nil, err
+		}
+	} else if len(key) != sealKeySize {
+		return nil, fmt.Errorf("database key must be %d bytes", sealKeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// openSeal sets up sealing for db before anything reads through the helpers.
+// With s set it's turned on (or checked against the record if it already
+// is). Without, a database that has it on is refused rather than read as
+// garbage.
+func openSeal(db kv.DB, s *Sealing) error {
+	sealer.Store(nil)
+	var aead cipher.AEAD
+	err := db.Update(func(txn kv.Txn) error {
+		buf, err := txn.Get(*ConfigDBI, []byte(ConfigSealKey))
+		if kv.IsNotFound(err) {
+			if s == nil {
+				return nil
+			}
+			aead, err = enableSeal(txn, s)
+			return err
+		} else if err != nil {
+			return fmt.Errorf("failed to read seal record: %w", err)
+		}
+		aead, err = checkSeal(buf, s)
+		return err
+	})
+	if err == nil && aead != nil {
+		sealer.Store(&aead)
+	}
+	return err
+}
+
+// viewSeal is openSeal for read-only use, it never turns sealing on.
+func viewSeal(db kv.DB, s *Sealing) error {
+	sealer.Store(nil)
+	var aead cipher.AEAD
+	err := db.View(func(txn kv.Txn) error {
+		buf, err := txn.Get(*ConfigDBI, []byte(ConfigSealKey))
+		if kv.IsNotFound(err) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read seal record: %w", err)
+		}
+		aead, err = checkSeal(buf, s)
+		return err
+	})
+	if err == nil && aead != nil {
+		sealer.Store(&aead)
+	}
+	return err
+}
+
+// checkSeal returns the cipher of the seal record buf if s opens it.
+func checkSeal(buf []byte, s *Sealing) (cipher.AEAD, error) {
+	var rec sealRecord
+	if err := json.Unmarshal(buf, &rec); err != nil {
+		return nil, fmt.Errorf("failed to parse seal record: %w", err)
+	}
+	if s == nil {
+		return nil, errs.New(errs.Unavailable, fmt.Sprintf("database values are encrypted, set %s or put back %s", SealPassphraseEnv, SealKeyFile))
+	}
+	if rec.Mode != s.mode() {
+		return nil, errs.New(errs.Invalid, fmt.Sprintf("database values are encrypted with a %s, not a %s", rec.Mode, s.mode()))
+	}
+	aead, err := s.aead(rec.Salt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := unsealWith(aead, sealAAD(*ConfigDBI, []byte(ConfigSealKey)), rec.Check); err != nil {
+		return nil, errs.New(errs.Invalid, "wrong database key or passphrase")
+	}
+	return aead, nil
+}
+
+// enableSeal writes the seal record and seals the config, it holds the tokens.
+func enableSeal(txn kv.Txn, s *Sealing) (cipher.AEAD, error) {
+	rec := sealRecord{Mode: s.mode()}
+	if s.Passphrase != "" {
+		rec.Salt = make([]byte, sealSaltSize)
+		rand.Read(rec.Salt)
+	}
+	aead, err := s.aead(rec.Salt)
+	if err != nil {
+		return nil, err
+	}
+	rec.Check = sealWith(aead, sealAAD(*ConfigDBI, []byte(ConfigSealKey)), sealCheck)
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return nil, err
+	}
+	if err := txn.Put(*ConfigDBI, []byte(ConfigSealKey), data); err != nil {
+		return nil, fmt.Errorf("failed to write seal record: %w", err)
+	}
+
+	cfg, err := txn.Get(*ConfigDBI, []byte(ConfigDataKey))
+	if kv.IsNotFound(err) {
+		return aead, nil // fresh database, migrations write it sealed
+	} else if err != nil {
+		return nil, err
+	}
+	if err := txn.Put(*ConfigDBI, []byte(ConfigDataKey), sealWith(aead, sealAAD(*ConfigDBI, []byte(ConfigDataKey)), cfg)); err != nil {
+		return nil, fmt.Errorf("failed to seal config: %w", err)
+	}
+	return aead, nil
+}
+
+// TxnKeepSeal is for code replacing the config DBI wholesale (see transfer).
+// Call it first and restore once the new entries are in: it puts this
+// database's seal record back, failing if the entries came with the record of
+// another key. Sealed values only move between databases with the same key.
+func TxnKeepSeal(txn kv.Txn) (restore func() error, err error) {
+	keep, err := txn.Get(*ConfigDBI, []byte(ConfigSealKey))
+	if err != nil && !kv.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to read seal record: %w", err)
+	}
+	keep = bytes.Clone(keep) // only valid until the DBI changes
+	return func() error {
+		buf, err := txn.Get(*ConfigDBI, []byte(ConfigSealKey))
+		if kv.IsNotFound(err) {
+			if keep == nil {
+				return nil
+			}
+			return txn.Put(*ConfigDBI, []byte(ConfigSealKey), keep)
+		} else if err != nil {
+			return fmt.Errorf("failed to read imported seal record: %w", err)
+		}
+		var rec sealRecord
+		if err := json.Unmarshal(buf, &rec); err != nil {
+			return fmt.Errorf("failed to parse imported seal record: %w", err)
+		}
+		aead := sealer.Load()
+		if aead == nil {
+			return errs.New(errs.Invalid, fmt.Sprintf("the imported values are encrypted, open this database with their key (%s or %s) first", SealKeyFile, SealPassphraseEnv))
+		}
+		if _, err := unsealWith(*aead, sealAAD(*ConfigDBI, []byte(ConfigSealKey)), rec.Check); err != nil {
+			return errs.New(errs.Invalid, "the imported values are encrypted with a different key than this database's")
+		}
+		if keep == nil {
+			return nil // same key, the imported record does
+		}
+		return txn.Put(*ConfigDBI, []byte(ConfigSealKey), keep)
+	}, nil
+}
+
+// seal encrypts a value about to be stored under key in dbi, if sealing is on.
+func seal(dbi kv.DBI, key, value []byte) []byte {
+	if aead := sealer.Load(); aead != nil {
+		return sealWith(*aead, sealAAD(dbi, key), value)
+	}
+	return value
+}
+
+// unseal returns the plaintext of a value stored under key in dbi, which is
+// returned as is if it isn't sealed.
+func unseal(dbi kv.DBI, key, value []byte) ([]byte, error) {
+	if !bytes.HasPrefix(value, sealMagic) {
+		return value, nil
+	}
+	aead := sealer.Load()
+	if aead == nil {
+		return nil, ErrSealed
+	}
+	return unsealWith(*aead, sealAAD(dbi, key), value)
+}
+
+// sealAAD is the additional data a value is sealed with: dbi's name, a NUL
+// (names don't have one) and key.
+func sealAAD(dbi kv.DBI, key []byte) []byte {
+	return append([]byte(dbi.Name()+"\x00"), key...)
+}
+
+// sealWith returns magic | nonce | ciphertext.
+func sealWith(aead cipher.AEAD, aad, value []byte) []byte {
+	out := make([]byte, len(sealMagic)+aead.NonceSize(), len(sealMagic)+aead.NonceSize()+len(value)+aead.Overhead())
+	copy(out, sealMagic)
+	rand.Read(out[len(sealMagic):])
+	return aead.Seal(out, out[len(sealMagic):], value, aad)
+}
+
+func unsealWith(aead cipher.AEAD, aad, value []byte) ([]byte, error) {
+	n := len(sealMagic) + aead.NonceSize()
+	if len(value) < n || !bytes.HasPrefix(value, sealMagic) {
+		return nil, fmt.Errorf("sealed value too short")
+	}
+	out, err := aead.Open(nil, value[len(sealMagic):n], value[n:], aad)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt value, wrong key or corrupted: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,133 @@
+package database
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"sprout/internal/platform/database/kv"
+	"sprout/internal/types"
+	"sprout/pkg/errs"
+	"testing"
+
+	"github.com/Data-Corruption/stdx/xlog"
+)
+
+func TestSealing(t *testing.T) {
+	dir := t.TempDir()
+	dbDir := filepath.Join(dir, "db")
+	log, err := xlog.New(filepath.Join(dir, "logs"), "none")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer log.Close()
+	t.Cleanup(func() { sealer.Store(nil) })
+
+	const token = "secret-release-token"
+	open := func(s *Sealing) error {
+		t.Helper()
+		db, err := NewSealed(dbDir, log, s)
+		if err == nil {
+			db.Close()
+		}
+		return err
+	}
+	setToken := func(s *Sealing) {
+		t.Helper()
+		db, err := NewSealed(dbDir, log, s)
+		if err != nil {
+			t.Fatalf("NewSealed: %v", err)
+		}
+		defer db.Close()
+		if err := Update(db, *ConfigDBI, []byte(ConfigDataKey), func(cfg *types.Configuration) error {
+			cfg.ReleaseToken = token
+			return nil
+		}); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+	}
+	onDisk := func() bool {
+		t.Helper()
+		data, err := os.ReadFile(filepath.Join(dbDir, kv.DataFile))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return bytes.Contains(data, []byte(token))
+	}
+
+	// plaintext to begin with
+	setToken(nil)
+	if !onDisk() {
+		t.Fatal("token not found in an unsealed database")
+	}
+
+	// turning it on seals the config right away
+	if _, err := CreateSealKey(dir); err != nil {
+		t.Fatalf("CreateSealKey: %v", err)
+	}
+	if _, err := CreateSealKey(dir); !errs.Is(err, errs.Conflict) {
+		t.Errorf("second CreateSealKey = %v, want a conflict", err)
+	}
+	s, err := LoadSealing(dir)
+	if err != nil || s == nil {
+		t.Fatalf("LoadSealing = %v, %v", s, err)
+	}
+	db, err := NewSealed(dbDir, log, s)
+	if err != nil {
+		t.Fatalf("NewSealed: %v", err)
+	}
+	cfg, err := View[types.Configuration](db, *ConfigDBI, []byte(ConfigDataKey))
+	if err != nil || cfg.ReleaseToken != token {
+		t.Errorf("config after sealing = %+v, %v", cfg, err)
+	}
+	if err := db.View(func(txn kv.Txn) error {
+		v, err := txn.Get(*ConfigDBI, []byte(ConfigDataKey))
+		if err == nil && !bytes.HasPrefix(v, sealMagic) {
+			t.Errorf("config is stored unsealed: %q", v)
+		}
+		return err
+	}); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	// with the key it keeps working, without or with another one it won't open
+	setToken(s)
+	if err := open(nil); !errs.Is(err, errs.Unavailable) {
+		t.Errorf("open without key = %v, want unavailable", err)
+	}
+	wrong := &Sealing{Key: bytes.Repeat([]byte{1}, sealKeySize)}
+	if err := open(wrong); !errs.Is(err, errs.Invalid) {
+		t.Errorf("open with wrong key = %v, want invalid", err)
+	}
+	if err := open(&Sealing{Passphrase: "hunter2"}); !errs.Is(err, errs.Invalid) {
+		t.Errorf("open with a passphrase = %v, want invalid", err)
+	}
+	if err := open(s); err != nil {
+		t.Errorf("open with key: %v", err)
+	}
+
+	// a sealed value can't be moved to another key or DBI
+	sealer.Store(nil)
+	if _, err := unseal(*ConfigDBI, []byte("other"), seal(*ConfigDBI, []byte(ConfigDataKey), []byte(`{}`))); err != nil {
+		t.Errorf("unseal of a plaintext value: %v", err)
+	}
+	aead, err := s.aead(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealer.Store(&aead)
+	sealed := seal(*ConfigDBI, []byte("a"), []byte(`"value"`))
+	if v, err := unseal(*ConfigDBI, []byte("a"), sealed); err != nil || string(v) != `"value"` {
+		t.Errorf("unseal = %q, %v", v, err)
+	}
+	if _, err := unseal(*ConfigDBI, []byte("b"), sealed); err == nil {
+		t.Error("value sealed under key a opened under key b")
+	}
+	if _, err := unseal(*HTTPLogDBI, []byte("a"), sealed); err == nil {
+		t.Error("value sealed in config opened in httplog")
+	}
+	sealer.Store(nil)
+	if _, err := unseal(*ConfigDBI, []byte("a"), sealed); err != ErrSealed {
+		t.Errorf("unseal without a sealer = %v, want ErrSealed", err)
+	}
+}
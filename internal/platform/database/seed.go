@@ -0,0 +1,189 @@
+package database
+
+import (
+	"fmt"
+	"slices"
+	"sprout/internal/platform/database/kv"
+	"sprout/internal/types"
+	"sprout/pkg/errs"
+	"time"
+
+	"github.com/Data-Corruption/stdx/xlog"
+)
+
+/*
+Notes on fixtures vs migrations:
+  - Migrations change the shape of data and run on every install, use them for
+    schema changes and the defaults the app can't run without.
+  - Fixtures are sample / default records, only applied by `seed`. They never
+    run on open, so demo data can't ship to production by accident.
+  - Each fixture is applied once per database (recorded under "seeds" in the
+    config DBI), `seed --again` reapplies it. Keep them idempotent anyway.
+*/
+
+// SeedEnv is an environment fixtures may be applied in, see Fixture.Envs.
+type SeedEnv string
+
+const (
+	SeedDev        SeedEnv = "dev"        // dev builds and --dev
+	SeedProduction SeedEnv = "production" // release builds
+)
+
+// Fixture is named sample data for development and demo environments.
+// Unlike migrations, fixtures are never applied automatically.
+type Fixture struct {
+	Name  string
+	Desc  string
+	Envs  []SeedEnv // where it may be applied, SeedDev only when empty
+	Apply func(txn kv.Txn) error
+}
+
+// Allowed reports whether f may be applied in env.
+func (f Fixture) Allowed(env SeedEnv) bool {
+	if len(f.Envs) == 0 {
+		return env == SeedDev
+	}
+	return slices.Contains(f.Envs, env)
+}
+
+var fixtures []Fixture
+
+// AddFixture registers a fixture. Fixtures run in registration order, feature
+// packages add theirs at init like they Register their DBIs. Panics on a
+// duplicate name.
+func AddFixture(f Fixture) {
+	if _, ok := findFixture(f.Name); ok {
+		panic(fmt.Sprintf("database: fixture %q added twice", f.Name))
+	}
+	fixtures = append(fixtures, f)
+}
+
+// Add fixtures here.
+
+func init() {
+	AddFixture(Fixture{
+		Name: "demo",
+		Desc: "Quiet update checks, route every notification to the log",
+		Apply: func(txn kv.Txn) error {
+			return TxnUpdate(txn, *ConfigDBI, []byte(ConfigDataKey), func(cfg *types.Configuration) error {
+				cfg.UpdateNotifications = false
+				cfg.NotifyRoutes = []types.NotifyRoute{{Event: "*", Notifiers: []string{"log"}}}
+				return nil
+			})
+		},
+	})
+
+	/* Example fixture for another DBI, fit for real installs too
+	AddFixture(Fixture{
+		Name: "users", Desc: "A handful of example users",
+		Envs: []SeedEnv{SeedDev, SeedProduction},
+		Apply: func(txn kv.Txn) error {
+			for _, u := range []types.User{{Name: "alice"}, {Name: "bob"}} {
+				if err := TxnPut(txn, *UsersDBI, []byte(u.Name), u); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+	*/
+}
+
+// Fixtures returns the registered fixtures in order.
+func Fixtures() []Fixture {
+	return append([]Fixture(nil), fixtures...)
+}
+
+// SeedOptions selects what Seed applies.
+type SeedOptions struct {
+	Env   SeedEnv
+	Names []string // all fixtures allowed in Env when empty
+	Again bool     // reapply fixtures already applied
+}
+
+// SeedResult lists the fixtures Seed applied and the ones it skipped because
+// they already were.
+type SeedResult struct {
+	Applied []string
+	Skipped []string
+}
+
+// Seed applies fixtures (see SeedOptions) in a single transaction, so a
+// failing fixture leaves the database untouched. Naming one that isn't
+// allowed in the environment is an error.
+func Seed(db kv.DB, logger *xlog.Logger, opts SeedOptions) (*SeedResult, error) {
+	var selected []Fixture
+	for _, f := range fixtures {
+		if len(opts.Names) == 0 && f.Allowed(opts.Env) {
+			selected = append(selected, f)
+		}
+	}
+	for _, name := range opts.Names {
+		f, ok := findFixture(name)
+		if !ok {
+			return nil, errs.New(errs.NotFound, fmt.Sprintf("unknown fixture %q", name))
+		}
+		if !f.Allowed(opts.Env) {
+			return nil, errs.New(errs.Invalid, fmt.Sprintf("fixture %q isn't for %s databases", name, opts.Env))
+		}
+		selected = append(selected, f)
+	}
+
+	var res SeedResult
+	err := db.Update(func(txn kv.Txn) error {
+		seeds, err := txnAppliedFixtures(txn)
+		if err != nil {
+			return err
+		}
+		for _, f := range selected {
+			if _, done := seeds[f.Name]; done && !opts.Again {
+				res.Skipped = append(res.Skipped, f.Name)
+				continue
+			}
+			logger.Infof("Applying fixture: %s - %s", f.Name, f.Desc)
+			if err := f.Apply(txn); err != nil {
+				return fmt.Errorf("failed to apply fixture %q: %w", f.Name, err)
+			}
+			seeds[f.Name] = time.Now().UTC()
+			res.Applied = append(res.Applied, f.Name)
+		}
+		if len(res.Applied) == 0 {
+			return nil
+		}
+		if err := TxnMarshalAndPut(txn, *ConfigDBI, []byte(ConfigSeedsKey), seeds); err != nil {
+			return fmt.Errorf("failed to record applied fixtures: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// AppliedFixtures returns when each fixture applied to db was last applied.
+func AppliedFixtures(db kv.DB) (map[string]time.Time, error) {
+	var seeds map[string]time.Time
+	err := db.View(func(txn kv.Txn) (err error) {
+		seeds, err = txnAppliedFixtures(txn)
+		return err
+	})
+	return seeds, err
+}
+
+func txnAppliedFixtures(txn kv.Txn) (map[string]time.Time, error) {
+	seeds := map[string]time.Time{}
+	if err := TxnGetAndUnmarshal(txn, *ConfigDBI, []byte(ConfigSeedsKey), &seeds); err != nil && !kv.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to get applied fixtures: %w", err)
+	}
+	return seeds, nil
+}
+
+func findFixture(name string) (Fixture, bool) {
+	for _, f := range fixtures {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Fixture{}, false
+}
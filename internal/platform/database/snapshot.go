@@ -0,0 +1,47 @@
+package database
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sprout/internal/platform/database/kv"
+)
+
+// HotCopy writes a consistent copy of every registered DBI in the open db to a
+// new database in dstDir (created if needed, must not already contain one).
+// Unlike Snapshot it works on the handle this process already has, reading
+// everything in a single read transaction so writers aren't blocked.
+func HotCopy(db kv.DB, dstDir string) error {
+	if _, err := os.Stat(filepath.Join(dstDir, kv.DataFile)); err == nil {
+		return fmt.Errorf("%s already contains a database", dstDir)
+	}
+	dst, _, err := kv.Open(dstDir, DBINameList())
+	if err != nil {
+		return fmt.Errorf("failed to create destination database: %w", err)
+	}
+	defer dst.Close()
+	srcDBIs, dstDBIs := db.DBIs(), dst.DBIs()
+
+	return db.View(func(src kv.Txn) error {
+		return dst.Update(func(txn kv.Txn) error {
+			for _, name := range DBINameList() {
+				cur, err := src.Cursor(srcDBIs[name])
+				if err != nil {
+					return fmt.Errorf("failed to open cursor on %s: %w", name, err)
+				}
+				k, v, err := cur.First()
+				for ; err == nil; k, v, err = cur.Next() {
+					if err := txn.Put(dstDBIs[name], k, v); err != nil {
+						cur.Close()
+						return fmt.Errorf("failed to copy %s: %w", name, err)
+					}
+				}
+				cur.Close()
+				if !kv.IsNotFound(err) {
+					return fmt.Errorf("failed to read %s: %w", name, err)
+				}
+			}
+			return nil
+		})
+	})
+}
@@ -0,0 +1,74 @@
+//go:build bolt
+
+package database
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sprout/internal/platform/database/kv"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// Snapshot writes a consistent, compacted copy of the database in srcDir to
+// dstDir (created if needed, must not already contain a database). bolt locks
+// the file, so it fails if another process (or this one) has it open.
+func Snapshot(srcDir, dstDir string) error {
+	if _, err := os.Stat(filepath.Join(srcDir, kv.DataFile)); err != nil {
+		return fmt.Errorf("no database in %s: %w", srcDir, err)
+	}
+	src, err := kv.OpenBolt(srcDir, true)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", srcDir, err)
+	}
+	defer src.Close()
+
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dstDir, err)
+	}
+	if _, err := os.Stat(filepath.Join(dstDir, kv.DataFile)); err == nil {
+		return fmt.Errorf("%s already contains a database", dstDir)
+	}
+	dst, err := kv.OpenBolt(dstDir, false)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", dstDir, err)
+	}
+	defer dst.Close()
+	if err := bolt.Compact(dst, src, 0); err != nil {
+		return fmt.Errorf("failed to copy database: %w", err)
+	}
+	return nil
+}
+
+// Check opens the database in dir read-only and walks every registered
+// bucket, returning the entry count of each. It's for copies (e.g. an
+// extracted backup), bolt locks the file against other opens.
+func Check(dir string) (map[string]int, error) {
+	if _, err := os.Stat(filepath.Join(dir, kv.DataFile)); err != nil {
+		return nil, fmt.Errorf("no database in %s: %w", dir, err)
+	}
+	db, err := kv.OpenBolt(dir, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", dir, err)
+	}
+	defer db.Close()
+
+	counts := make(map[string]int)
+	err = db.View(func(tx *bolt.Tx) error {
+		for _, name := range DBINameList() {
+			b := tx.Bucket([]byte(name))
+			if b == nil {
+				continue // registered after the copy was made
+			}
+			if err := b.ForEach(func(k, v []byte) error {
+				counts[name]++
+				return nil
+			}); err != nil {
+				return fmt.Errorf("failed to read %s: %w", name, err)
+			}
+		}
+		return nil
+	})
+	return counts, err
+}
@@ -0,0 +1,96 @@
+//go:build !bolt
+
+package database
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sprout/internal/platform/database/kv"
+
+	"github.com/Data-Corruption/lmdb-go/lmdb"
+	"github.com/Data-Corruption/lmdb-go/wrap"
+)
+
+// Snapshot writes a consistent, compacted copy of the database in srcDir to
+// dstDir (created if needed, must not already contain a database). It's safe
+// while other processes use the source, but not while this process has it
+// open, LMDB doesn't allow opening the same environment twice in one process.
+func Snapshot(srcDir, dstDir string) error {
+	if _, err := os.Stat(filepath.Join(srcDir, kv.DataFile)); err != nil {
+		return fmt.Errorf("no database in %s: %w", srcDir, err)
+	}
+
+	env, err := lmdb.NewEnv()
+	if err != nil {
+		return fmt.Errorf("failed to create environment: %w", err)
+	}
+	defer env.Close()
+	if err := env.SetMaxDBs(wrap.MaxNamedDBs); err != nil {
+		return err
+	}
+	if err := env.SetMapSize(wrap.MapSize); err != nil {
+		return err
+	}
+	if err := env.Open(srcDir, lmdb.Readonly, 0644); err != nil {
+		return fmt.Errorf("failed to open %s: %w", srcDir, err)
+	}
+
+	if err := os.MkdirAll(dstDir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dstDir, err)
+	}
+	if err := env.CopyFlag(dstDir, lmdb.CopyCompact); err != nil {
+		return fmt.Errorf("failed to copy database: %w", err)
+	}
+	return nil
+}
+
+// Check opens the database in dir read-only and walks every registered DBI,
+// returning the entry count of each. It's for copies (e.g. an extracted
+// backup), LMDB doesn't allow opening an environment this process has open.
+func Check(dir string) (map[string]int, error) {
+	if _, err := os.Stat(filepath.Join(dir, kv.DataFile)); err != nil {
+		return nil, fmt.Errorf("no database in %s: %w", dir, err)
+	}
+
+	env, err := lmdb.NewEnv()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create environment: %w", err)
+	}
+	defer env.Close()
+	if err := env.SetMaxDBs(wrap.MaxNamedDBs); err != nil {
+		return nil, err
+	}
+	if err := env.SetMapSize(wrap.MapSize); err != nil {
+		return nil, err
+	}
+	if err := env.Open(dir, lmdb.Readonly, 0644); err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", dir, err)
+	}
+
+	counts := make(map[string]int)
+	err = env.View(func(txn *lmdb.Txn) error {
+		for _, name := range DBINameList() {
+			dbi, err := txn.OpenDBI(name, 0)
+			if lmdb.IsNotFound(err) {
+				continue // registered after the copy was made
+			} else if err != nil {
+				return fmt.Errorf("failed to open %s: %w", name, err)
+			}
+			cur, err := txn.OpenCursor(dbi)
+			if err != nil {
+				return fmt.Errorf("failed to open cursor on %s: %w", name, err)
+			}
+			_, _, err = cur.Get(nil, nil, lmdb.First)
+			for ; err == nil; _, _, err = cur.Get(nil, nil, lmdb.Next) {
+				counts[name]++
+			}
+			cur.Close()
+			if !lmdb.IsNotFound(err) {
+				return fmt.Errorf("failed to read %s: %w", name, err)
+			}
+		}
+		return nil
+	})
+	return counts, err
+}
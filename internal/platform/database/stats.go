@@ -0,0 +1,35 @@
+package database
+
+// DBIStats is the B-tree of one DBI.
+type DBIStats struct {
+	Name          string `json:"name"`
+	Entries       uint64 `json:"entries"`
+	Depth         uint   `json:"depth"`
+	BranchPages   uint64 `json:"branchPages"`
+	LeafPages     uint64 `json:"leafPages"`
+	OverflowPages uint64 `json:"overflowPages"` // values larger than half a page
+}
+
+// Pages is the number of pages the DBI's tree occupies.
+func (s DBIStats) Pages() uint64 {
+	return s.BranchPages + s.LeafPages + s.OverflowPages
+}
+
+// Stats describes the space use of a database, see [ReadStats].
+type Stats struct {
+	PageSize   uint       `json:"pageSize"`
+	MapSize    int64      `json:"mapSize"`    // how large the data file may grow, in bytes (LMDB, 0 if unbounded)
+	FileSize   int64      `json:"fileSize"`   // size of the data file on disk
+	UsedPages  int64      `json:"usedPages"`  // pages up to the highest one in use
+	FreePages  int64      `json:"freePages"`  // of UsedPages, freed and waiting for reuse
+	Readers    int        `json:"readers"`    // reader table slots held by open read transactions (LMDB) / open transactions (bolt)
+	MaxReaders uint       `json:"maxReaders"` // reader table size (LMDB, 0 for bolt)
+	DBIs       []DBIStats `json:"dbis"`       // registered DBIs, in registration order
+}
+
+// Used is the space in use inside the map, free pages included.
+func (s *Stats) Used() int64 { return s.UsedPages * int64(s.PageSize) }
+
+// Free is the space of free pages, which writes reuse before growing the
+// file and a compacting copy drops.
+func (s *Stats) Free() int64 { return s.FreePages * int64(s.PageSize) }
@@ -0,0 +1,49 @@
+//go:build bolt
+
+package database
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sprout/internal/platform/database/kv"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ReadStats opens the database in dir read-only and reports its space use.
+// bolt locks the file, so it fails while another process has it open. There's
+// no map size or reader table, MapSize and MaxReaders are 0.
+func ReadStats(dir string) (*Stats, error) {
+	fi, err := os.Stat(filepath.Join(dir, kv.DataFile))
+	if err != nil {
+		return nil, fmt.Errorf("no database in %s: %w", dir, err)
+	}
+	db, err := kv.OpenBolt(dir, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	s := &Stats{FileSize: fi.Size(), PageSize: uint(db.Info().PageSize)}
+	err = db.View(func(tx *bolt.Tx) error {
+		s.UsedPages = tx.Size() / int64(s.PageSize)
+		for _, name := range DBINameList() {
+			ds := DBIStats{Name: name}
+			if b := tx.Bucket([]byte(name)); b != nil {
+				st := b.Stats()
+				ds.Entries, ds.Depth = uint64(st.KeyN), uint(st.Depth)
+				ds.BranchPages, ds.LeafPages = uint64(st.BranchPageN), uint64(st.LeafPageN)
+				ds.OverflowPages = uint64(st.BranchOverflowN + st.LeafOverflowN)
+			}
+			s.DBIs = append(s.DBIs, ds)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	st := db.Stats()
+	s.FreePages, s.Readers = int64(st.FreePageN+st.PendingPageN), st.OpenTxN
+	return s, nil
+}
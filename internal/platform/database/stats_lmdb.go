@@ -0,0 +1,108 @@
+//go:build !bolt
+
+package database
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sprout/internal/platform/database/kv"
+	"strconv"
+	"strings"
+
+	"github.com/Data-Corruption/lmdb-go/lmdb"
+)
+
+// freeDBI is LMDB's internal DBI listing pages freed by past transactions,
+// which new writes reuse before growing the file.
+const freeDBI lmdb.DBI = 0
+
+// ReadStats opens the database in dir read-only alongside any process
+// already using it and reports its space use. Like Repair it must not be
+// called while this process has the database open.
+func ReadStats(dir string) (*Stats, error) {
+	fi, err := os.Stat(filepath.Join(dir, kv.DataFile))
+	if err != nil {
+		return nil, fmt.Errorf("no database in %s: %w", dir, err)
+	}
+	env, err := openEnv(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+	defer env.Close()
+
+	s := &Stats{FileSize: fi.Size()}
+	info, err := env.Info()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get environment info: %w", err)
+	}
+	s.MapSize, s.UsedPages, s.MaxReaders = info.MapSize, info.LastPNO+1, info.MaxReaders
+	if err := env.ReaderList(func(line string) error {
+		// header and "(no active readers)" don't start with a PID
+		if fields := strings.Fields(line); len(fields) > 0 {
+			if _, err := strconv.Atoi(fields[0]); err == nil {
+				s.Readers++
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("failed to list readers: %w", err)
+	}
+
+	err = env.View(func(txn *lmdb.Txn) error {
+		st, err := env.Stat()
+		if err != nil {
+			return err
+		}
+		s.PageSize = st.PSize
+		for _, name := range DBINameList() {
+			ds := DBIStats{Name: name}
+			dbi, err := txn.OpenDBI(name, 0)
+			if lmdb.IsNotFound(err) {
+				s.DBIs = append(s.DBIs, ds) // not created yet
+				continue
+			} else if err != nil {
+				return fmt.Errorf("failed to open %s: %w", name, err)
+			}
+			st, err := txn.Stat(dbi)
+			if err != nil {
+				return fmt.Errorf("failed to stat %s: %w", name, err)
+			}
+			ds.Entries, ds.Depth = st.Entries, st.Depth
+			ds.BranchPages, ds.LeafPages, ds.OverflowPages = st.BranchPages, st.LeafPages, st.OverflowPages
+			s.DBIs = append(s.DBIs, ds)
+		}
+		s.FreePages, err = freePages(txn)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// freePages counts the pages listed in the free DBI. Each value is a list
+// of page numbers prefixed with its length, all native size_t.
+func freePages(txn *lmdb.Txn) (int64, error) {
+	cur, err := txn.OpenCursor(freeDBI)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open free list: %w", err)
+	}
+	defer cur.Close()
+
+	var n int64
+	_, v, err := cur.Get(nil, nil, lmdb.First)
+	for ; !lmdb.IsNotFound(err); _, v, err = cur.Get(nil, nil, lmdb.Next) {
+		if err != nil {
+			return 0, fmt.Errorf("failed to read free list: %w", err)
+		}
+		switch {
+		case strconv.IntSize == 64 && len(v) >= 8:
+			n += int64(binary.NativeEndian.Uint64(v))
+		case strconv.IntSize == 32 && len(v) >= 4:
+			n += int64(binary.NativeEndian.Uint32(v))
+		}
+	}
+	return n, nil
+}
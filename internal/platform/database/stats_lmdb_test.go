@@ -0,0 +1,60 @@
+//go:build !bolt
+
+package database
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Data-Corruption/lmdb-go/lmdb"
+	"github.com/Data-Corruption/lmdb-go/wrap"
+)
+
+func TestReadStats(t *testing.T) {
+	dir := t.TempDir()
+	db, _, err := wrap.New(dir, DBINameList())
+	if err != nil {
+		t.Fatalf("failed to create database: %v", err)
+	}
+	dbi := db.GetDBis()["httplog"]
+	put := func(n int) error {
+		return db.Update(func(txn *lmdb.Txn) error {
+			for i := range n {
+				if err := txn.Put(dbi, fmt.Appendf(nil, "%04d", i), make([]byte, 512), 0); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	// pages of the first tree are freed by the second write
+	if err := put(400); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Update(func(txn *lmdb.Txn) error { return txn.Drop(dbi, false) }); err != nil {
+		t.Fatal(err)
+	}
+	if err := put(10); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	s, err := ReadStats(dir)
+	if err != nil {
+		t.Fatalf("ReadStats: %v", err)
+	}
+	if s.PageSize == 0 || s.MapSize != wrap.MapSize || s.MaxReaders == 0 {
+		t.Errorf("environment = %+v", s)
+	}
+	if s.FreePages == 0 || s.FreePages >= s.UsedPages {
+		t.Errorf("free pages = %d of %d used, want some", s.FreePages, s.UsedPages)
+	}
+	if len(s.DBIs) != len(DBINameList()) {
+		t.Fatalf("DBIs = %+v, want one per registered DBI", s.DBIs)
+	}
+	for _, d := range s.DBIs {
+		if d.Name == "httplog" && (d.Entries != 10 || d.Pages() == 0) {
+			t.Errorf("httplog = %+v, want 10 entries", d)
+		}
+	}
+}
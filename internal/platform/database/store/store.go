@@ -0,0 +1,282 @@
+// Package store provides typed access to a DBI holding one JSON value per
+// string key, so a new bucket doesn't need its own View/Update wrappers:
+//
+//	var users = store.New[User](db, "users")
+//	u, err := users.Get("alice")
+//
+// Values can be looked up by other fields through indexes, see
+// [Store.WithIndex]. Their entries are kept in the same DBI under
+// "index:<name>:<value>\x00<key>" -> key, written in the same transaction as
+// the value, so keys starting with "index:" are reserved.
+//
+// For keys that aren't strings, or to compose several operations in one
+// transaction, use the Txn helpers in package database directly.
+package store
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"sprout/internal/platform/database"
+	"sprout/internal/platform/database/kv"
+	"sprout/pkg/errs"
+	"sprout/pkg/x"
+	"strings"
+)
+
+// Store is a typed view of a DBI. Every method starts its own transaction,
+// don't call them from inside another one (will deadlock).
+type Store[T any] struct {
+	db      kv.DB
+	dbi     kv.DBI
+	indexes []index[T]
+}
+
+// indexPrefix starts every index entry's key.
+const indexPrefix = "index:"
+
+type index[T any] struct {
+	name string
+	key  func(*T) string
+}
+
+// entry returns the key of the index entry mapping value to key.
+func (i index[T]) entry(value, key string) []byte {
+	return []byte(indexPrefix + i.name + ":" + value + "\x00" + key)
+}
+
+// Item is a stored value with its key, see [Store.List].
+type Item[T any] struct {
+	Key   string
+	Value T
+}
+
+// New returns a Store for the DBI registered as name in database.go, on a
+// database opened with database.New. Panics if no such DBI is open, that's
+// a missing register() call rather than something to handle at runtime.
+func New[T any](db kv.DB, name string) *Store[T] {
+	dbi, ok := db.DBIs()[name]
+	if !ok {
+		panic(fmt.Sprintf("store: DBI %q is not registered", name))
+	}
+	return &Store[T]{db: db, dbi: dbi}
+}
+
+// WithIndex maintains an index of values by key(v), for [Store.Find] with
+// name. Values it returns "" for aren't indexed. Several values may share an
+// index value. Declare indexes before writing, then call [Store.Reindex] once
+// if the DBI already held values.
+func (s *Store[T]) WithIndex(name string, key func(v *T) string) *Store[T] {
+	s.indexes = append(s.indexes, index[T]{name: name, key: key})
+	return s
+}
+
+// Get returns a copy of the value stored under key.
+// errs.Is(err, errs.NotFound) will be true if there is none.
+func (s *Store[T]) Get(key string) (*T, error) {
+	return database.View[T](s.db, s.dbi, []byte(key))
+}
+
+// Put stores value under key, replacing any previous value.
+func (s *Store[T]) Put(key string, value T) error {
+	if strings.HasPrefix(key, indexPrefix) {
+		return errs.New(errs.Invalid, fmt.Sprintf("key %q uses the reserved %q prefix", key, indexPrefix))
+	}
+	return s.db.Update(func(txn kv.Txn) error {
+		old, err := s.txnIndexValues(txn, key)
+		if err != nil && !kv.IsNotFound(err) {
+			return err
+		}
+		return s.txnPut(txn, key, old, &value)
+	})
+}
+
+// Delete removes key. Returns nil if it doesn't exist (idempotent).
+func (s *Store[T]) Delete(key string) error {
+	return s.db.Update(func(txn kv.Txn) error {
+		old, err := s.txnIndexValues(txn, key)
+		if kv.IsNotFound(err) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		for i, idx := range s.indexes {
+			if old[i] != "" {
+				if err := database.TxnDeleteKey(txn, s.dbi, idx.entry(old[i], key)); err != nil {
+					return fmt.Errorf("failed to delete %s index entry: %w", idx.name, err)
+				}
+			}
+		}
+		return database.TxnDeleteKey(txn, s.dbi, []byte(key))
+	})
+}
+
+// List returns every stored value in key order.
+func (s *Store[T]) List() ([]Item[T], error) {
+	var items []Item[T]
+	err := s.db.View(func(txn kv.Txn) error {
+		var err error
+		items, err = s.txnList(txn)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// UpdateFn applies fn to the value stored under key and stores the result.
+// errs.Is(err, errs.NotFound) will be true if there is none, use Put to
+// create it. If fn returns an error nothing is stored.
+func (s *Store[T]) UpdateFn(key string, fn func(*T) error) error {
+	return s.db.Update(func(txn kv.Txn) error {
+		old, err := s.txnIndexValues(txn, key)
+		if kv.IsNotFound(err) {
+			return errs.Wrap(errs.NotFound, err, "not found")
+		} else if err != nil {
+			return err
+		}
+		value, err := database.TxnView[T](txn, s.dbi, []byte(key))
+		if err != nil {
+			return fmt.Errorf("failed to get value: %w", err)
+		}
+		if err := fn(value); err != nil {
+			return fmt.Errorf("update function failed: %w", err)
+		}
+		return s.txnPut(txn, key, old, value)
+	})
+}
+
+// Find returns the values the index name maps value to, in key order.
+func (s *Store[T]) Find(name, value string) ([]Item[T], error) {
+	i := slices.IndexFunc(s.indexes, func(idx index[T]) bool { return idx.name == name })
+	if i < 0 {
+		return nil, fmt.Errorf("store has no index %q", name)
+	}
+	prefix := s.indexes[i].entry(value, "")
+
+	var items []Item[T]
+	err := s.db.View(func(txn kv.Txn) error {
+		keys, err := txnKeys(txn, s.dbi, prefix, true)
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			v, err := database.TxnView[T](txn, s.dbi, key)
+			if err != nil {
+				return fmt.Errorf("failed to get %s indexed by %s: %w", key, name, err)
+			}
+			items = append(items, Item[T]{Key: string(key), Value: *v})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// Reindex rebuilds every index from the stored values, for indexes added
+// while the DBI already held values. Entries of indexes no longer declared
+// are removed.
+func (s *Store[T]) Reindex() error {
+	return s.db.Update(func(txn kv.Txn) error {
+		entries, err := txnKeys(txn, s.dbi, []byte(indexPrefix), false)
+		if err != nil {
+			return err
+		}
+		for _, k := range entries {
+			if err := txn.Delete(s.dbi, k); err != nil {
+				return fmt.Errorf("failed to delete index entry: %w", err)
+			}
+		}
+		items, err := s.txnList(txn)
+		if err != nil {
+			return err
+		}
+		for _, it := range items {
+			if err := s.txnPutIndexes(txn, it.Key, nil, &it.Value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// txnIndexValues returns what each index maps the value under key by.
+// kv.IsNotFound(err) will be true if there is none.
+func (s *Store[T]) txnIndexValues(txn kv.Txn, key string) ([]string, error) {
+	v, err := database.TxnView[T](txn, s.dbi, []byte(key))
+	if err != nil {
+		return nil, err
+	}
+	values := make([]string, len(s.indexes))
+	for i, idx := range s.indexes {
+		values[i] = idx.key(v)
+	}
+	return values, nil
+}
+
+// txnPut stores value under key and moves its index entries from old (see
+// txnIndexValues, nil for a new key) to what value is indexed by now.
+func (s *Store[T]) txnPut(txn kv.Txn, key string, old []string, value *T) error {
+	if err := s.txnPutIndexes(txn, key, old, value); err != nil {
+		return err
+	}
+	return database.TxnPut(txn, s.dbi, []byte(key), value)
+}
+
+func (s *Store[T]) txnPutIndexes(txn kv.Txn, key string, old []string, value *T) error {
+	for i, idx := range s.indexes {
+		v := idx.key(value)
+		if old != nil && old[i] == v {
+			continue
+		}
+		if old != nil && old[i] != "" {
+			if err := database.TxnDeleteKey(txn, s.dbi, idx.entry(old[i], key)); err != nil {
+				return fmt.Errorf("failed to delete %s index entry: %w", idx.name, err)
+			}
+		}
+		if v != "" {
+			if err := txn.Put(s.dbi, idx.entry(v, key), []byte(key)); err != nil {
+				return fmt.Errorf("failed to write %s index entry: %w", idx.name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// txnList is List within an existing transaction.
+func (s *Store[T]) txnList(txn kv.Txn) ([]Item[T], error) {
+	var items []Item[T]
+	err := database.TxnForEach(txn, s.dbi, func(key, value []byte) bool {
+		return !bytes.HasPrefix(key, []byte(indexPrefix))
+	}, func(key []byte, value *T) (database.ForEachAction, error) {
+		items = append(items, Item[T]{Key: string(key), Value: *value})
+		return database.ActionKeep, nil
+	})
+	return items, err
+}
+
+// txnKeys returns the keys starting with prefix, or their values with values
+// set (copied, they're only valid during the transaction).
+func txnKeys(txn kv.Txn, dbi kv.DBI, prefix []byte, values bool) ([][]byte, error) {
+	cur, err := txn.Cursor(dbi)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cursor: %w", err)
+	}
+	defer cur.Close()
+
+	var out [][]byte
+	k, v, err := cur.Seek(prefix)
+	for ; !kv.IsNotFound(err); k, v, err = cur.Next() {
+		if err != nil {
+			return nil, fmt.Errorf("failed to get entry: %w", err)
+		}
+		if !bytes.HasPrefix(k, prefix) {
+			break
+		}
+		out = append(out, bytes.Clone(x.Ternary(values, v, k)))
+	}
+	return out, nil
+}
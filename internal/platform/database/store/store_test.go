@@ -0,0 +1,129 @@
+package store_test
+
+import (
+	"slices"
+	"sprout/internal/platform/database"
+	"sprout/internal/platform/database/kv"
+	"sprout/internal/platform/database/store"
+	"sprout/internal/testsupport/dbtest"
+	"sprout/pkg/errs"
+	"testing"
+)
+
+// notesDBI is the tests' own DBI, so they don't depend on a feature's schema.
+const notesDBI = "test-notes"
+
+var _ = database.Register(notesDBI)
+
+type note struct {
+	Text string `json:"text"`
+	Tag  string `json:"tag"`
+}
+
+func openDB(t *testing.T) kv.DB {
+	return dbtest.Open(t)
+}
+
+func TestStore(t *testing.T) {
+	db := openDB(t)
+
+	notes := store.New[note](db, notesDBI)
+	if _, err := notes.Get("a"); !errs.Is(err, errs.NotFound) {
+		t.Errorf("Get missing = %v, want NotFound", err)
+	}
+	if err := notes.UpdateFn("a", func(n *note) error { return nil }); !errs.Is(err, errs.NotFound) {
+		t.Errorf("UpdateFn missing = %v, want NotFound", err)
+	}
+
+	for _, k := range []string{"b", "a"} {
+		if err := notes.Put(k, note{Text: k}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := notes.UpdateFn("a", func(n *note) error {
+		n.Text += "!"
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := notes.Get("a"); err != nil || n.Text != "a!" {
+		t.Errorf("Get = %v, %v, want a!", n, err)
+	}
+
+	if err := notes.Delete("b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := notes.Delete("b"); err != nil {
+		t.Errorf("second Delete = %v, want nil", err)
+	}
+	items, err := notes.List()
+	if err != nil || len(items) != 1 || items[0].Key != "a" {
+		t.Errorf("List = %+v, %v, want only a", items, err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("New with an unregistered DBI didn't panic")
+		}
+	}()
+	store.New[note](db, "nope")
+}
+
+func TestIndex(t *testing.T) {
+	db := openDB(t)
+	notes := store.New[note](db, notesDBI)
+	for k, tag := range map[string]string{"a": "red", "b": "red", "c": "blue", "d": ""} {
+		if err := notes.Put(k, note{Text: k, Tag: tag}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// existing values are indexed once it's declared
+	notes.WithIndex("tag", func(n *note) string { return n.Tag })
+	if err := notes.Reindex(); err != nil {
+		t.Fatal(err)
+	}
+	find := func(tag string) []string {
+		t.Helper()
+		items, err := notes.Find("tag", tag)
+		if err != nil {
+			t.Fatalf("Find(%q): %v", tag, err)
+		}
+		var keys []string
+		for _, it := range items {
+			keys = append(keys, it.Key)
+		}
+		return keys
+	}
+	if got := find("red"); !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("red = %v, want [a b]", got)
+	}
+
+	// writes move entries along
+	if err := notes.UpdateFn("a", func(n *note) error {
+		n.Tag = "blue"
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := notes.Delete("c"); err != nil {
+		t.Fatal(err)
+	}
+	if err := notes.Put("e", note{Tag: "blue"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := find("red"); !slices.Equal(got, []string{"b"}) {
+		t.Errorf("red = %v, want [b]", got)
+	}
+	if got := find("blue"); !slices.Equal(got, []string{"a", "e"}) {
+		t.Errorf("blue = %v, want [a e]", got)
+	}
+
+	// index entries stay out of List
+	if items, err := notes.List(); err != nil || len(items) != 4 {
+		t.Errorf("List = %+v, %v, want 4 items", items, err)
+	}
+	if err := notes.Put("index:x", note{}); !errs.Is(err, errs.Invalid) {
+		t.Errorf("Put reserved key = %v, want Invalid", err)
+	}
+}
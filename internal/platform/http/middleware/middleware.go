@@ -0,0 +1,83 @@
+// Package middleware provides HTTP middleware shared by route packages.
+// Router-wide middleware (security headers, etc.) lives in the router package itself.
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	opsMu sync.Mutex
+	ops   = map[string]*sync.Mutex{} // operation name -> lock
+)
+
+// opLock returns the lock for the named operation, creating it if needed.
+func opLock(name string) *sync.Mutex {
+	opsMu.Lock()
+	defer opsMu.Unlock()
+	if ops[name] == nil {
+		ops[name] = &sync.Mutex{}
+	}
+	return ops[name]
+}
+
+// Exclusive allows only one request at a time to run the named operation.
+// Routes sharing a name share the limit, e.g. restart and stop both use "lifecycle".
+// While the operation is running, other requests get a 409 with a JSON body:
+//
+//	{"error": "lifecycle already in progress", "operation": "lifecycle"}
+//
+// The operation ends when the handler returns, unless it calls [Detach] to
+// keep it running past the response.
+func Exclusive(name string) func(http.Handler) http.Handler {
+	mu := opLock(name)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !mu.TryLock() {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusConflict)
+				_ = json.NewEncoder(w).Encode(map[string]string{
+					"error":     fmt.Sprintf("%s already in progress", name),
+					"operation": name,
+				})
+				return
+			}
+			o := &op{mu: mu}
+			defer func() {
+				if !o.detached.Load() {
+					o.done()
+				}
+			}()
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), opKey{}, o)))
+		})
+	}
+}
+
+type opKey struct{}
+
+// op is a running [Exclusive] operation.
+type op struct {
+	mu       *sync.Mutex
+	once     sync.Once
+	detached atomic.Bool
+}
+
+func (o *op) done() { o.once.Do(o.mu.Unlock) }
+
+// Detach keeps the [Exclusive] operation of r running after its handler
+// returns, for work it hands off (a detached update, a shutdown). Call done
+// once that work has finished, later calls do nothing. Outside Exclusive it
+// returns a no-op.
+func Detach(r *http.Request) (done func()) {
+	o, ok := r.Context().Value(opKey{}).(*op)
+	if !ok {
+		return func() {}
+	}
+	o.detached.Store(true)
+	return o.done
+}
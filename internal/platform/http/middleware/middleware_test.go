@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestExclusive(t *testing.T) {
+	// stop and restart share the lifecycle lock
+	started, release := make(chan struct{}), make(chan struct{})
+	stop := Exclusive("lifecycle")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+	restart := Exclusive("lifecycle")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	other := Exclusive("backup")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	serve := func(h http.Handler) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/", nil))
+		return rr
+	}
+
+	done := make(chan int)
+	go func() { done <- serve(stop).Code }()
+	<-started
+	rr := serve(restart)
+	var body map[string]string
+	if err := json.NewDecoder(rr.Body).Decode(&body); err != nil || rr.Code != http.StatusConflict || body["operation"] != "lifecycle" {
+		t.Errorf("restart during stop = %d %v (%v), want 409 for lifecycle", rr.Code, body, err)
+	}
+	if rr := serve(stop); rr.Code != http.StatusConflict {
+		t.Errorf("second stop = %d, want 409", rr.Code)
+	}
+	if rr := serve(other); rr.Code != http.StatusOK {
+		t.Errorf("another operation during stop = %d, want 200", rr.Code)
+	}
+
+	close(release)
+	if code := <-done; code != http.StatusOK {
+		t.Errorf("stop = %d, want 200", code)
+	}
+	if rr := serve(restart); rr.Code != http.StatusOK {
+		t.Errorf("restart after stop = %d, want 200", rr.Code)
+	}
+}
+
+func TestExclusiveDetach(t *testing.T) {
+	var done func()
+	update := Exclusive("update")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		done = Detach(r)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	serve := func() int {
+		rr := httptest.NewRecorder()
+		update.ServeHTTP(rr, httptest.NewRequest(http.MethodPost, "/", nil))
+		return rr.Code
+	}
+
+	if code := serve(); code != http.StatusAccepted {
+		t.Fatalf("update = %d, want 202", code)
+	}
+	if code := serve(); code != http.StatusConflict {
+		t.Errorf("update while the first one runs detached = %d, want 409", code)
+	}
+	done()
+	done() // only the first call releases
+	if code := serve(); code != http.StatusAccepted {
+		t.Errorf("update after done = %d, want 202", code)
+	}
+	done()
+
+	// outside Exclusive there is nothing to hold
+	Detach(httptest.NewRequest(http.MethodPost, "/", nil))()
+}
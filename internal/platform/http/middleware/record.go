@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sprout/internal/platform/database/kv"
+	"sprout/internal/platform/httprecord"
+	"strings"
+	"time"
+
+	"github.com/Data-Corruption/stdx/xlog"
+)
+
+// Record stores a sanitized copy of every request and its response in the
+// httplog ring buffer (keep entries, 0 = default). Static assets are skipped.
+// Adds a DB write per request, so it's meant to be switched on while chasing a bug.
+func Record(db kv.DB, keep int, log *xlog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, "/assets/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// read (bounded) body, then hand the handler an equivalent reader
+			reqBody, _ := io.ReadAll(io.LimitReader(r.Body, httprecord.MaxBodyBytes+1))
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(reqBody), r.Body), r.Body}
+
+			rw := &recordingWriter{ResponseWriter: w, status: http.StatusOK}
+			start := time.Now()
+			next.ServeHTTP(rw, r)
+
+			rec := httprecord.Recording{
+				Time:       start,
+				Duration:   time.Since(start),
+				Method:     r.Method,
+				URI:        httprecord.SanitizeURI(r.URL),
+				ReqHeader:  httprecord.SanitizeHeader(r.Header),
+				Status:     rw.status,
+				RespHeader: httprecord.SanitizeHeader(w.Header()),
+			}
+			var t1, t2 bool
+			rec.ReqBody, t1 = httprecord.SanitizeBody(reqBody)
+			rec.RespBody, t2 = httprecord.SanitizeBody(rw.body.Bytes())
+			rec.Truncated = t1 || t2 || rw.truncated
+			if _, err := httprecord.Append(db, rec, keep); err != nil {
+				log.Errorf("failed to record request: %v", err)
+			}
+		})
+	}
+}
+
+// recordingWriter captures the status and up to MaxBodyBytes of the body.
+type recordingWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+	truncated   bool
+}
+
+func (w *recordingWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	if room := httprecord.MaxBodyBytes - w.body.Len(); room > 0 {
+		w.body.Write(b[:min(room, len(b))])
+	}
+	if w.body.Len() >= httprecord.MaxBodyBytes && len(b) > 0 {
+		w.truncated = true
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush keeps streaming responses working through the wrapper.
+func (w *recordingWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *recordingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sprout/internal/platform/httprecord"
+	"sprout/internal/testsupport/dbtest"
+	"strings"
+	"testing"
+
+	"github.com/Data-Corruption/stdx/xlog"
+)
+
+func TestRecord(t *testing.T) {
+	db := dbtest.Open(t)
+	log, err := xlog.New(t.TempDir(), "none")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { log.Close() })
+
+	h := Record(db, 0, log)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if r.Method == http.MethodPost && string(body) != `{"password":"hunter2"}` {
+			t.Errorf("handler got body %q, want the original", body)
+		}
+		w.Header().Set("Set-Cookie", "session=abc")
+		w.WriteHeader(http.StatusTeapot)
+		io.WriteString(w, `{"token":"t","ok":true}`)
+	}))
+	req := httptest.NewRequest(http.MethodPost, "/api/login?x=1&token=hunter2", strings.NewReader(`{"password":"hunter2"}`))
+	req.Header.Set("Authorization", "Bearer hunter2")
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Code != http.StatusTeapot || rr.Body.String() != `{"token":"t","ok":true}` {
+		t.Errorf("response = %d %q, want it untouched", rr.Code, rr.Body)
+	}
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/assets/app.js", nil))
+
+	recs, err := httprecord.List(db)
+	if err != nil || len(recs) != 1 {
+		t.Fatalf("List() = %d recordings, %v, want 1 (assets skipped)", len(recs), err)
+	}
+	rec := recs[0]
+	if rec.Method != http.MethodPost || rec.URI != "/api/login?x=1&token=%5BREDACTED%5D" || rec.Status != http.StatusTeapot || rec.Truncated {
+		t.Errorf("recording = %s %s %d truncated %v", rec.Method, rec.URI, rec.Status, rec.Truncated)
+	}
+	if rec.ReqBody != `{"password":"`+httprecord.Redacted+`"}` || rec.RespBody != `{"ok":true,"token":"`+httprecord.Redacted+`"}` {
+		t.Errorf("bodies = %q, %q", rec.ReqBody, rec.RespBody)
+	}
+	if rec.ReqHeader.Get("Authorization") != "" || rec.RespHeader.Get("Set-Cookie") != "" {
+		t.Errorf("credentials recorded: %v, %v", rec.ReqHeader, rec.RespHeader)
+	}
+
+	// a body past the limit is flagged, not stored raw
+	big := Record(db, 0, log)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, strings.Repeat("x", httprecord.MaxBodyBytes+1))
+	}))
+	big.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/big", nil))
+	if recs, _ = httprecord.List(db); len(recs) != 2 || !recs[1].Truncated || recs[1].RespBody != httprecord.UnparsedBody {
+		t.Errorf("big recording = %+v", recs[len(recs)-1])
+	}
+}
@@ -0,0 +1,75 @@
+// Package api serves the versioned JSON API under /api/v1.
+//
+// Endpoints are read-only and unauthenticated unless noted, meant for
+// dashboards and companion tools rather than the browser UI.
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sprout/internal/app"
+	"sprout/internal/build"
+	"sprout/internal/platform/database"
+	"sprout/internal/platform/storage"
+	"sprout/pkg/errs"
+	"time"
+
+	"github.com/Data-Corruption/stdx/xhttp"
+	"github.com/go-chi/chi/v5"
+)
+
+func Register(a *app.App, r chi.Router) {
+	r.Route("/api/v1", func(r chi.Router) {
+		r.Get("/version", handleVersion(a))
+		r.Get("/storage", handleStorage(a))
+	})
+}
+
+// Version is the /api/v1/version response, the build info plus runtime state.
+type Version struct {
+	build.BuildInfo
+	SchemaVersion string    `json:"schemaVersion"`
+	StartedAt     time.Time `json:"startedAt"`
+	UptimeSeconds int64     `json:"uptimeSeconds"`
+}
+
+func handleVersion(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		schema, err := database.SchemaVersion(a.DB)
+		if err != nil {
+			xhttp.Error(r.Context(), w, errs.HTTP(err))
+			return
+		}
+		writeJSON(w, Version{
+			BuildInfo:     a.BuildInfo(),
+			SchemaVersion: schema,
+			StartedAt:     a.StartedAt,
+			UptimeSeconds: int64(time.Since(a.StartedAt).Seconds()),
+		})
+	}
+}
+
+// handleStorage serves the disk usage the storage monitor measured last
+// ([storage.Usage]), measuring now before its first check.
+func handleStorage(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var u *storage.Usage
+		if a.Storage != nil {
+			u = a.Storage.Latest()
+		}
+		if u == nil {
+			var err error
+			if u, err = storage.Measure(a.StorageDir); err != nil {
+				xhttp.Error(r.Context(), w, errs.HTTP(err))
+				return
+			}
+		}
+		writeJSON(w, u)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	_ = json.NewEncoder(w).Encode(v)
+}
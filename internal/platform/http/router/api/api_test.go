@@ -0,0 +1,47 @@
+package api_test
+
+import (
+	"net/http"
+	"sprout/internal/platform/http/router/api"
+	"sprout/internal/platform/storage"
+	"sprout/internal/testsupport/routertest"
+	"testing"
+)
+
+func TestVersion(t *testing.T) {
+	s := routertest.New(t, routertest.WithRoutes(api.Register))
+
+	var v api.Version
+	s.Get("/api/v1/version").
+		AssertStatus(http.StatusOK).
+		AssertHeader("Content-Type", "application/json").
+		DecodeJSON(&v)
+	if v.Version != "v1.0.0" || v.SchemaVersion == "" || v.GoVersion == "" {
+		t.Errorf("version = %+v, want version v1.0.0 with schema and Go versions", v)
+	}
+	if v.StartedAt.IsZero() || v.UptimeSeconds < 0 {
+		t.Errorf("startedAt / uptime = %v / %d", v.StartedAt, v.UptimeSeconds)
+	}
+}
+
+func TestStorage(t *testing.T) {
+	s := routertest.New(t, routertest.WithRoutes(api.Register))
+
+	var u storage.Usage
+	s.Get("/api/v1/storage").
+		AssertStatus(http.StatusOK).
+		AssertHeader("Content-Type", "application/json").
+		DecodeJSON(&u)
+	if u.VolumeSize <= 0 || u.MeasuredAt.IsZero() {
+		t.Errorf("usage = %+v, want the volume measured", u)
+	}
+
+	// the monitor's last sample while serving
+	s.App.Storage = storage.NewMonitor(s.App.StorageDir, -1, s.App.Log, s.App.Notify)
+	s.App.Storage.Check()
+	want := s.App.Storage.Latest().MeasuredAt
+	s.Get("/api/v1/storage").DecodeJSON(&u)
+	if !u.MeasuredAt.Equal(want) {
+		t.Errorf("measuredAt = %v, want the monitor's %v", u.MeasuredAt, want)
+	}
+}
@@ -3,13 +3,22 @@ package router
 import (
 	"net/http"
 	"sprout/internal/app"
+	"sprout/internal/platform/database/config"
+	"sprout/internal/platform/http/middleware"
+	"sprout/internal/platform/http/router/api"
 	"sprout/internal/platform/http/router/settings"
+	"sprout/internal/types"
+	"sprout/pkg/x"
+	"strconv"
 	"strings"
+	"sync/atomic"
 
 	"github.com/Data-Corruption/stdx/xlog"
 	"github.com/go-chi/chi/v5"
 )
 
+const retryAfterSeconds = 2 // sent with 503s when the concurrency limit is hit
+
 func New(a *app.App) *chi.Mux {
 	r := chi.NewRouter()
 
@@ -21,10 +30,27 @@ func New(a *app.App) *chi.Mux {
 	})
 
 	// basic security hardening
-	if a.BuildInfo().Version != "vX.X.X" && strings.HasPrefix(a.BaseURL, "https://") {
+	if a.BuildInfo().Version != "vX.X.X" && !a.Dev && strings.HasPrefix(a.BaseURL, "https://") {
 		r.Use(httpsRedirect)
 	}
-	r.Use(securityHeaders)
+	r.Use(securityHeaders(x.Ternary(a.Dev, devCSP, defaultCSP)))
+
+	if cfg, err := config.View(a.DB); err != nil {
+		a.Log.Errorf("failed to get config for router middleware: %v", err)
+	} else {
+		// shed load past the concurrent request limit, which follows the config
+		limit := &concurrencyLimit{}
+		limit.max.Store(int64(cfg.MaxConnections))
+		r.Use(limit.middleware)
+		a.OnReload("max connections", func(prev, next *types.Configuration) error {
+			limit.max.Store(int64(next.MaxConnections))
+			return nil
+		})
+		// opt-in request recording, see `http record`
+		if cfg.HTTPRecord {
+			r.Use(middleware.Record(a.DB, cfg.HTTPRecordKeep, a.Log))
+		}
+	}
 
 	// serve embedded assets with cache busting
 	r.Get("/assets/*", a.UI.ServeAsset)
@@ -32,19 +58,30 @@ func New(a *app.App) *chi.Mux {
 	// serve settings page / routes
 	settings.Register(a, r)
 
+	// JSON API
+	api.Register(a, r)
+
 	return r
 }
 
-func securityHeaders(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		h := w.Header()
-		h.Set("X-Frame-Options", "SAMEORIGIN")
-		h.Set("X-Content-Type-Options", "nosniff")
-		h.Set("Referrer-Policy", "strict-origin-when-cross-origin")
-		h.Set("Content-Security-Policy", "default-src 'self'; script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'; img-src 'self' data:; frame-ancestors 'self'")
-		h.Set("Permissions-Policy", "geolocation=(), microphone=(), camera=()")
-		next.ServeHTTP(w, r)
-	})
+const (
+	defaultCSP = "default-src 'self'; script-src 'self' 'unsafe-inline'; style-src 'self' 'unsafe-inline'; img-src 'self' data:; frame-ancestors 'self'"
+	// dev mode: allow eval, websockets, and external hosts so live reload / dev tooling and CDN experiments work
+	devCSP = "default-src 'self' * data: blob:; script-src 'self' * 'unsafe-inline' 'unsafe-eval'; style-src 'self' * 'unsafe-inline'; connect-src 'self' * ws: wss:; frame-ancestors 'self'"
+)
+
+func securityHeaders(csp string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h := w.Header()
+			h.Set("X-Frame-Options", "SAMEORIGIN")
+			h.Set("X-Content-Type-Options", "nosniff")
+			h.Set("Referrer-Policy", "strict-origin-when-cross-origin")
+			h.Set("Content-Security-Policy", csp)
+			h.Set("Permissions-Policy", "geolocation=(), microphone=(), camera=()")
+			next.ServeHTTP(w, r)
+		})
+	}
 }
 
 func httpsRedirect(next http.Handler) http.Handler {
@@ -59,3 +96,23 @@ func httpsRedirect(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// concurrencyLimit responds 503 with a Retry-After header once max requests
+// are in flight, max <= 0 = unlimited. max may change while serving.
+type concurrencyLimit struct {
+	max      atomic.Int64
+	inFlight atomic.Int64
+}
+
+func (l *concurrencyLimit) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := l.inFlight.Add(1)
+		defer l.inFlight.Add(-1)
+		if max := l.max.Load(); max > 0 && n > max {
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds))
+			http.Error(w, "Server busy, try again shortly", http.StatusServiceUnavailable)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,59 @@
+package router
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+func TestConcurrencyLimit(t *testing.T) {
+	const limit = 3
+	l := &concurrencyLimit{}
+	l.max.Store(limit)
+	started, release := make(chan struct{}), make(chan struct{})
+	h := l.middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+	}))
+	serve := func() *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rr
+	}
+
+	var wg sync.WaitGroup
+	codes := make(chan int, limit+1)
+	for range limit {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- serve().Code
+		}()
+		<-started
+	}
+	// the limit is in flight, the next one is turned away
+	if rr := serve(); rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") == "" {
+		t.Errorf("request %d = %d, Retry-After %q, want 503 with Retry-After", limit+1, rr.Code, rr.Header().Get("Retry-After"))
+	}
+
+	// raising the limit takes effect right away
+	l.max.Store(limit + 1)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		codes <- serve().Code
+	}()
+	<-started
+	close(release)
+	wg.Wait()
+	close(codes)
+	for code := range codes {
+		if code != http.StatusOK {
+			t.Errorf("request within the limit = %d", code)
+		}
+	}
+	if n := l.inFlight.Load(); n != 0 {
+		t.Errorf("in flight after all finished = %d", n)
+	}
+}
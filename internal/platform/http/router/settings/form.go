@@ -0,0 +1,200 @@
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sprout/internal/platform/database/config"
+	"sprout/internal/types"
+	"sprout/pkg/errs"
+	"strings"
+)
+
+// FormGroup is a card of the settings page, the settings of a group (see
+// types.FieldMeta).
+type FormGroup struct {
+	Name    string
+	Title   string
+	Fields  []FormField
+	Omitted []string // keys of lists and maps, edited with `config set` or the config file
+}
+
+// FormField is an input of the settings page, posted to /settings by key.
+type FormField struct {
+	Key         string // e.g. "backup.schedule"
+	ID          string // element id, e.g. "settings-backup-schedule"
+	Label       string
+	Description string
+	Input       string   // "select", "checkbox", "number", "password" or "text"
+	Value       string   // as Format has it, "" for secrets
+	Checked     bool     // checkboxes
+	Secret      bool     // whether a secret is set, its value isn't shown
+	Options     []string // selects, "" is the default
+	Min, Max    *int
+	Live        bool   // applied without a restart
+	By          string // the config file or environment whose value wins, "" if none
+}
+
+// groups orders the cards, groups not listed follow by name.
+var groups = []struct{ name, title string }{
+	{"server", "Server Settings"},
+	{"tls", "TLS"},
+	{"updates", "Updates"},
+	{"backup", "Backups"},
+	{"maintenance", "Maintenance"},
+	{"network", "Network"},
+	{"outbound", "Outbound Requests"},
+	{"notifications", "Notifications"},
+	{"remote", "Remote Config"},
+	{"debug", "Debugging"},
+}
+
+// Form returns the settings page's inputs for cfg, from the settings' struct
+// tags (see types.Meta), so a new setting shows up without editing the page.
+// layers are config.Layers, their settings are marked.
+func Form(cfg *types.Configuration, layers []*config.File) []FormGroup {
+	meta := types.Meta()
+	byName := map[string]*FormGroup{}
+	var out []*FormGroup
+	group := func(name string) *FormGroup {
+		if g, ok := byName[name]; ok {
+			return g
+		}
+		g := &FormGroup{Name: name, Title: strings.ToUpper(name[:1]) + name[1:]}
+		for _, known := range groups {
+			if known.name == name {
+				g.Title = known.title
+			}
+		}
+		byName[name] = g
+		out = append(out, g)
+		return g
+	}
+
+	for _, f := range config.Fields(cfg) {
+		m, ok := meta[f.Key]
+		if !ok || m.Group == "" {
+			continue
+		}
+		g := group(m.Group)
+		field := FormField{
+			Key:         f.Key,
+			ID:          "settings-" + kebab(f.Key),
+			Label:       m.Label,
+			Description: m.Description,
+			Value:       config.Format(f.Value),
+			Min:         m.Minimum,
+			Max:         m.Maximum,
+			Live:        m.Live,
+		}
+		for _, l := range layers {
+			if l.Sets(f.Key) {
+				field.By = filepath.Base(l.Path) // the last layer wins
+			}
+		}
+		switch t := f.Value.Type(); {
+		case t == reflect.TypeFor[types.Secret]():
+			field.Input, field.Secret, field.Value = "password", f.Value.String() != "", ""
+		case len(m.Enum) > 0:
+			field.Input = "select"
+			for _, opt := range m.Enum {
+				if !slices.ContainsFunc(field.Options, func(o string) bool { return strings.EqualFold(o, opt) }) {
+					field.Options = append(field.Options, opt)
+				}
+			}
+			for _, opt := range field.Options {
+				if strings.EqualFold(opt, field.Value) {
+					field.Value = opt // selects the option whatever the case of the value
+				}
+			}
+		case t.Kind() == reflect.Bool:
+			field.Input, field.Checked = "checkbox", f.Value.Bool()
+		case f.Value.CanInt():
+			field.Input = "number"
+		case t.Kind() == reflect.String:
+			field.Input = "text"
+		default:
+			g.Omitted = append(g.Omitted, f.Key)
+			continue
+		}
+		g.Fields = append(g.Fields, field)
+	}
+
+	slices.SortStableFunc(out, func(a, b *FormGroup) int {
+		return rank(a.Name) - rank(b.Name)
+	})
+	form := make([]FormGroup, len(out))
+	for i, g := range out {
+		form[i] = *g
+	}
+	return form
+}
+
+func rank(group string) int {
+	for i, g := range groups {
+		if g.name == group {
+			return i
+		}
+	}
+	return len(groups)
+}
+
+// kebab turns a key into an element id part: "backup.keepLast" is
+// "backup-keep-last".
+func kebab(key string) string {
+	var b strings.Builder
+	for i, c := range key {
+		switch {
+		case c == '.':
+			b.WriteByte('-')
+		case c >= 'A' && c <= 'Z':
+			if i > 0 && key[i-1] != '.' && !(key[i-1] >= 'A' && key[i-1] <= 'Z') {
+				b.WriteByte('-')
+			}
+			b.WriteRune(c + 'a' - 'A')
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// legacyKeys are the names the settings page posted the backup settings as
+// before it posted keys, still accepted for scripts using them.
+var legacyKeys = map[string]string{
+	"backupSchedule":   "backup.schedule",
+	"backupKeepLast":   "backup.keepLast",
+	"backupKeepDaily":  "backup.keepDaily",
+	"backupKeepWeekly": "backup.keepWeekly",
+}
+
+// patch sets key in cfg to raw, a JSON value of its type or a string Parse
+// reads like `config set` does (e.g. "8080"). Values the app records for
+// itself are refused.
+func patch(cfg *types.Configuration, key string, raw json.RawMessage) error {
+	if config.Recorded(key) {
+		return errors.New("recorded by the app, not a setting")
+	}
+	v, err := config.Lookup(cfg, key)
+	if err != nil {
+		return errors.New("unknown setting")
+	}
+	// decoded into a fresh value, so a bad one leaves no partial changes behind
+	p := reflect.New(v.Type())
+	if err := json.Unmarshal(raw, p.Interface()); err == nil {
+		v.Set(p.Elem())
+		return nil
+	}
+	s := string(raw)
+	_ = json.Unmarshal(raw, &s) // a JSON string is parsed without its quotes
+	if err := config.Parse(v, s); err != nil {
+		var e *errs.Error
+		if errors.As(err, &e) {
+			return errors.New(e.Msg) // "want number", without strconv's details
+		}
+		return err
+	}
+	return nil
+}
@@ -1,14 +1,28 @@
 package settings
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"html/template"
+	"io"
+	"maps"
 	"net/http"
 	"os/exec"
+	"slices"
 	"sprout/internal/app"
+	"sprout/internal/platform/backup"
 	"sprout/internal/platform/database/config"
+	"sprout/internal/platform/http/middleware"
+	"sprout/internal/platform/lifecycle"
+	"sprout/internal/platform/notify"
+	"sprout/internal/platform/selftest"
+	"sprout/internal/platform/transfer"
 	"sprout/internal/types"
+	"sprout/pkg/errs"
+	"sprout/pkg/humanize"
+	"strings"
 	"time"
 
 	"github.com/Data-Corruption/stdx/xhttp"
@@ -18,34 +32,72 @@ import (
 func Register(a *app.App, r chi.Router) {
 	r.Get("/", handleGetSettings(a))
 	r.Post("/settings", handleUpdateSettings(a))
-	r.Post("/settings/stop", handleStop(a))
-	r.Post("/settings/restart", handleRestart(a))
+	r.Get("/settings/schema", handleSchema(a))
+	r.Post("/settings/reset", handleReset(a))
+	r.Post("/settings/rollback", handleRollback(a))
+	// stop/restart (and the update it may trigger) must not overlap, they hold
+	// the lock until the stop or update is done, see middleware.Detach
+	r.With(middleware.Exclusive("lifecycle")).Post("/settings/stop", handleStop(a))
+	r.With(middleware.Exclusive("lifecycle")).Post("/settings/restart", handleRestart(a))
 	r.Get("/settings/restart-status", handleRestartStatus(a))
+	r.Get("/settings/update-log", handleUpdateLog(a))
+	r.With(middleware.Exclusive("backup")).Post("/settings/backup", handleBackup(a))
+	r.With(middleware.Exclusive("export")).Get("/settings/db-export", handleExport(a))
+}
+
+// PageTemplate is the settings page template, rendered with [PageData].
+const PageTemplate = "settings.html"
+
+// PageHistory is how many config changes the settings page lists, `config
+// history` has the rest.
+const PageHistory = 10
+
+// PageData is the template data for the settings page.
+func PageData(a *app.App, cfg *types.Configuration) map[string]any {
+	// settings a config file or the environment manages show its values,
+	// changes here don't stick
+	var fileKeys, envKeys []string
+	if f := config.FileOf(a.DB); f != nil {
+		fileKeys = f.Keys
+	}
+	if f := config.EnvOf(a.DB); f != nil {
+		envKeys = f.Keys
+	}
+	history, err := config.History(a.DB, PageHistory)
+	if err != nil {
+		a.Log.Warnf("Failed to read config history: %v", err)
+	}
+	snaps, err := config.Snapshots(a.DB)
+	if err != nil {
+		a.Log.Warnf("Failed to read config snapshots: %v", err)
+	}
+	return map[string]any{
+		"CSS":             a.UI.CSS.URLPath,
+		"JS":              a.UI.JS.URLPath,
+		"Favicon":         template.URL(`data:image/svg+xml,<svg xmlns='http://www.w3.org/2000/svg' viewBox='0 0 100 100'><text x='50%' y='.9em' font-size='90' text-anchor='middle'>🌱</text></svg>`),
+		"Title":           "Settings",
+		"Version":         a.BuildInfo().Version,
+		"UpdateAvailable": cfg.UpdateAvailable && !a.UpdatesDisabled(),
+		"LastUpdateCheck": cfg.LastUpdateCheck,
+		"Form":            Form(cfg, config.Layers(a.DB)),
+		"FileKeys":        fileKeys,
+		"FileName":        config.FileName,
+		"EnvKeys":         envKeys,
+		"History":         history,
+		"CanRollback":     len(snaps) > 0,
+	}
 }
 
 func handleGetSettings(a *app.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		cfg, err := config.View(a.DB)
 		if err != nil {
-			xhttp.Error(r.Context(), w, err)
+			xhttp.Error(r.Context(), w, errs.HTTP(err))
 			return
 		}
 
-		data := map[string]any{
-			"CSS":             a.UI.CSS.URLPath,
-			"JS":              a.UI.JS.URLPath,
-			"Favicon":         template.URL(`data:image/svg+xml,<svg xmlns='http://www.w3.org/2000/svg' viewBox='0 0 100 100'><text x='50%' y='.9em' font-size='90' text-anchor='middle'>🌱</text></svg>`),
-			"Title":           "Settings",
-			"Version":         a.BuildInfo().Version,
-			"UpdateAvailable": cfg.UpdateAvailable && (a.BuildInfo().Version != "vX.X.X"),
-			//  config fields
-			"LogLevel":  cfg.LogLevel,
-			"Port":      cfg.Port,
-			"Host":      cfg.Host,
-			"ProxyPort": cfg.ProxyPort,
-		}
-		if err := a.UI.Execute(w, "settings.html", data); err != nil {
-			xhttp.Error(r.Context(), w, err)
+		if err := a.UI.Execute(w, PageTemplate, PageData(a, cfg)); err != nil {
+			xhttp.Error(r.Context(), w, errs.HTTP(err))
 			return
 		}
 	}
@@ -55,54 +107,153 @@ func handleUpdateSettings(a *app.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
 
-		// Parse body - all fields are optional
-		var body struct {
-			LogLevel  *string `json:"logLevel"`
-			Host      *string `json:"host"`
-			Port      *int    `json:"port"`
-			ProxyPort *int    `json:"proxyPort"`
-		}
+		// keys of the settings to change, e.g. {"port": 9000, "backup.schedule": "@daily"}
+		var body map[string]json.RawMessage
 		dec := json.NewDecoder(r.Body)
 		if err := dec.Decode(&body); err != nil {
-			xhttp.Error(r.Context(), w, &xhttp.Err{Code: 400, Msg: "bad request", Err: err})
+			xhttp.Error(r.Context(), w, errs.HTTP(errs.Wrap(errs.Invalid, err, "bad request")))
 			return
 		}
-
 		// Update only the fields that were provided
-		if err := config.Update(a.DB, func(cfg *types.Configuration) error {
-			if body.LogLevel != nil {
-				cfg.LogLevel = *body.LogLevel
+		var changed []string
+		if err := config.UpdateFrom(a.DB, source(r), func(cfg *types.Configuration) error {
+			port := cfg.Port
+			var fe types.FieldErrors
+			for _, key := range slices.Sorted(maps.Keys(body)) {
+				raw := body[key]
+				if k, ok := legacyKeys[key]; ok {
+					key = k
+				}
+				if err := patch(cfg, key, raw); err != nil {
+					fe = append(fe, types.FieldError{Field: key, Message: err.Error()})
+					continue
+				}
+				changed = append(changed, key)
+			}
+			if fe != nil {
+				return fe
 			}
-			if body.Host != nil {
-				cfg.Host = *body.Host
+			if fe := cfg.Validate().For(changed...); fe != nil {
+				return fe
 			}
-			if body.Port != nil {
-				cfg.Port = *body.Port
+			// the server moves there right away (see server.Listen), refuse one it can't bind
+			if cfg.Port != port {
+				if err := selftest.Port(cfg.Port); err != nil {
+					return types.FieldErrors{{Field: "port", Message: err.Error()}}
+				}
 			}
-			if body.ProxyPort != nil {
-				cfg.ProxyPort = *body.ProxyPort
+			return nil
+		}); err != nil {
+			var fe types.FieldErrors
+			if errors.As(err, &fe) {
+				writeFieldErrors(w, fe)
+				return
 			}
+			xhttp.Error(r.Context(), w, errs.HTTP(errs.Wrap(errs.Internal, err, "failed to update config")))
+			return
+		}
+		if len(changed) > 0 {
+			a.Notify.Dispatch(notify.Event{
+				Kind:    notify.EventConfigChanged,
+				Title:   "Configuration changed",
+				Message: "changed via settings page: " + strings.Join(changed, ", "),
+				Fields:  map[string]string{"source": "web", "fields": strings.Join(changed, ",")},
+			})
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// handleReset restores the default settings, see config.Reset.
+func handleReset(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := config.UpdateFrom(a.DB, source(r), func(cfg *types.Configuration) error {
+			config.Reset(cfg)
 			return nil
 		}); err != nil {
-			xhttp.Error(r.Context(), w, &xhttp.Err{Code: 500, Msg: "failed to update config", Err: err})
+			xhttp.Error(r.Context(), w, errs.HTTP(errs.Wrap(errs.Internal, err, "failed to reset config")))
 			return
 		}
+		a.Notify.Dispatch(notify.Event{
+			Kind:    notify.EventConfigChanged,
+			Title:   "Configuration reset",
+			Message: "reset to defaults via settings page",
+			Fields:  map[string]string{"source": "web", "fields": "*"},
+		})
+		w.WriteHeader(http.StatusOK)
+	}
+}
 
+// handleRollback restores the settings from before the last change, see
+// config.Rollback.
+func handleRollback(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, changed, err := config.Rollback(a.DB, source(r), 1)
+		if err != nil {
+			xhttp.Error(r.Context(), w, errs.HTTP(err))
+			return
+		}
+		if len(changed) > 0 {
+			keys := make([]string, len(changed))
+			for i, f := range changed {
+				keys[i] = f.Key
+			}
+			a.Notify.Dispatch(notify.Event{
+				Kind:    notify.EventConfigChanged,
+				Title:   "Configuration rolled back",
+				Message: "rolled back via settings page: " + strings.Join(keys, ", "),
+				Fields:  map[string]string{"source": "web", "fields": strings.Join(keys, ",")},
+			})
+		}
 		w.WriteHeader(http.StatusOK)
 	}
 }
 
+// source tells the settings page's requests (a browser sends
+// Sec-Fetch-Site) apart from scripts calling the endpoints, for
+// config.History.
+func source(r *http.Request) string {
+	if r.Header.Get("Sec-Fetch-Site") != "" {
+		return config.SourceWeb
+	}
+	return config.SourceAPI
+}
+
+// handleSchema serves the settings' JSON Schema, see config.Schema.
+func handleSchema(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/schema+json")
+		_ = json.NewEncoder(w).Encode(config.Schema(a.BuildInfo().Name + " configuration"))
+	}
+}
+
+// FieldErrorsResponse is the 400 body of a settings change with invalid
+// values, for the form to show next to each field.
+type FieldErrorsResponse struct {
+	Error  string            `json:"error"`
+	Fields types.FieldErrors `json:"fields"`
+}
+
+func writeFieldErrors(w http.ResponseWriter, fe types.FieldErrors) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	_ = json.NewEncoder(w).Encode(FieldErrorsResponse{Error: "invalid settings: " + fe.Error(), Fields: fe})
+}
+
 func handleStop(a *app.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		defer r.Body.Close()
+		// held until we're gone, or the stop unit failed to start
+		done := middleware.Detach(r)
 		w.WriteHeader(http.StatusAccepted)
 
-		if a.BuildInfo().ServiceEnabled && a.BuildInfo().Version != "vX.X.X" {
+		if a.BuildInfo().ServiceEnabled && a.BuildInfo().Version != "vX.X.X" && !a.Dev {
 			// Use systemd-run to create a transient unit that survives our process dying.
 			// This ensures the stop command completes and logs reliably.
 			go func() {
 				serviceName := a.BuildInfo().Name + ".service"
-				unitName := fmt.Sprintf("%s-stop-%s", a.BuildInfo().Name, time.Now().Format("20060102-150405"))
+				unitName := fmt.Sprintf("%s-stop-%s", a.BuildInfo().Name, a.IDs.NewID())
 				syslogIdent := fmt.Sprintf("SyslogIdentifier=%s-stop", a.BuildInfo().Name)
 
 				cmd := exec.CommandContext(
@@ -119,6 +270,7 @@ func handleStop(a *app.App) http.HandlerFunc {
 				)
 				if err := cmd.Run(); err != nil {
 					a.Log.Errorf("failed to start stop unit: %v", err)
+					done()
 				}
 			}()
 		} else {
@@ -137,27 +289,25 @@ func handleRestart(a *app.App) http.HandlerFunc {
 		}
 		dec := json.NewDecoder(r.Body)
 		if err := dec.Decode(&body); err != nil {
-			xhttp.Error(r.Context(), w, &xhttp.Err{Code: 400, Msg: "bad request", Err: err})
+			xhttp.Error(r.Context(), w, errs.HTTP(errs.Wrap(errs.Invalid, err, "bad request")))
 			return
 		}
 
-		// skip update if dev build
+		// skip update if dev build / mode
 		var doUpdate bool
-		if body.Update && a.BuildInfo().Version != "vX.X.X" {
+		if body.Update && !a.UpdatesDisabled() {
 			doUpdate = true
 		}
 
 		a.Log.Debugf("Restart requested. Update: %t, DoUpdate: %t", body.Update, doUpdate)
 
-		// set StartCounter to 0 (post migrate restart will increment)
-		if err := config.Update(a.DB, func(cfg *types.Configuration) error {
-			cfg.StartCounter = 0
-			return nil
-		}); err != nil {
-			xhttp.Error(r.Context(), w, &xhttp.Err{Code: 500, Msg: "failed to update config", Err: err})
+		// reset start tracking (post migrate restart will record a start)
+		if err := lifecycle.ExpectRestart(a.DB); err != nil {
+			xhttp.Error(r.Context(), w, errs.HTTP(errs.Wrap(errs.Internal, err, "failed to update config")))
 			return
 		}
 
+		done := middleware.Detach(r)
 		w.WriteHeader(http.StatusAccepted)
 
 		// do the restart
@@ -165,7 +315,16 @@ func handleRestart(a *app.App) http.HandlerFunc {
 			// detach update will close us externally
 			if err := a.DetachUpdate(); err != nil {
 				a.Log.Errorf("failed to detach update: %v", err)
+				done()
+				return
 			}
+			// a failed update leaves us running, allow another try once it exited
+			go func() {
+				defer done()
+				if _, err := a.FollowUpdate(a.Context, "", func(app.UpdateLine) error { return nil }); err != nil {
+					a.Log.Debugf("Stopped waiting for the update: %v", err)
+				}
+			}()
 		} else {
 			// otherwise we need to close ourselves
 			go a.Server.Shutdown()
@@ -177,19 +336,152 @@ func handleRestartStatus(a *app.App) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		cfg, err := config.View(a.DB)
 		if err != nil {
-			xhttp.Error(r.Context(), w, err)
+			xhttp.Error(r.Context(), w, errs.HTTP(err))
 			return
 		}
 
-		restarted := cfg.StartCounter > 0
-		updated := cfg.PreUpdateVersion != "" && cfg.PreUpdateVersion != a.BuildInfo().Version
+		restarted := lifecycle.WasRestarted(cfg)
+		updated := lifecycle.WasUpdated(cfg, a.BuildInfo().Version)
 
 		a.Log.Debugf("Restart status check: StartCounter=%d, PreUpdateVersion=%q, CurrentVersion=%q, Restarted=%t, Updated=%t",
 			cfg.StartCounter, cfg.PreUpdateVersion, a.BuildInfo().Version, restarted, updated)
 
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(map[string]bool{"restarted": restarted, "updated": updated}); err != nil {
-			xhttp.Error(r.Context(), w, err)
+			xhttp.Error(r.Context(), w, errs.HTTP(err))
 		}
 	}
 }
+
+var eventLine = strings.NewReplacer("\r", "", "\n", " ")
+
+// handleUpdateLog streams the output of the last detached update as server-sent
+// events, one "message" per line with the line's ID as the event id, then a
+// "done" event with the [app.UpdateResult]. The update restarts the server,
+// EventSource reconnects with Last-Event-ID and the stream resumes from there.
+func handleUpdateLog(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		after := r.Header.Get("Last-Event-ID")
+		rc := http.NewResponseController(w)
+		// the stream outlives the server's write timeout
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+			a.Log.Debugf("Update log stream keeps the write timeout: %v", err)
+		}
+
+		started := false
+		send := func(event, id, data string) error {
+			if !started {
+				w.Header().Set("Content-Type", "text/event-stream")
+				w.Header().Set("Cache-Control", "no-cache")
+				w.Header().Set("X-Accel-Buffering", "no") // stop proxies buffering the stream
+				w.WriteHeader(http.StatusOK)
+				started = true
+			}
+			if event != "" {
+				fmt.Fprintf(w, "event: %s\n", event)
+			}
+			if id != "" {
+				fmt.Fprintf(w, "id: %s\n", id)
+			}
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+				return err
+			}
+			return rc.Flush()
+		}
+
+		res, err := a.FollowUpdate(r.Context(), after, func(l app.UpdateLine) error {
+			// newlines would end the data field early
+			return send("", l.ID, eventLine.Replace(l.Text))
+		})
+		switch {
+		case errors.Is(err, context.Canceled):
+			return // client went away
+		case err != nil && !started:
+			xhttp.Error(r.Context(), w, errs.HTTP(err))
+			return
+		case err != nil:
+			a.Log.Errorf("Failed to follow update: %v", err)
+			send("failure", "", "failed to follow update")
+			return
+		}
+		data, _ := json.Marshal(res)
+		send("done", "", string(data))
+	}
+}
+
+// handleBackup backs the database up now and responds with the
+// [backup.Result], like `backup` does.
+func handleBackup(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.Dev {
+			xhttp.Error(r.Context(), w, errs.HTTP(errs.New(errs.Invalid, "dev mode works on a copy of the database, back up without --dev")))
+			return
+		}
+		cfg, err := config.View(a.DB)
+		if err != nil {
+			xhttp.Error(r.Context(), w, errs.HTTP(err))
+			return
+		}
+		opts, err := a.BackupOptions(cfg.Backup, source(r))
+		if err != nil {
+			xhttp.Error(r.Context(), w, errs.HTTP(err))
+			return
+		}
+		// large databases take longer than the server's write timeout
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+			a.Log.Debugf("Backup request keeps the write timeout: %v", err)
+		}
+
+		res := backup.Run(a.DB, opts)
+		status := http.StatusOK
+		if !res.OK() {
+			a.Log.Errorf("Backup failed: %s", res.Error)
+			status = http.StatusInternalServerError
+		} else {
+			a.Log.Infof("Backup written to %s (%s), pruned %d", res.Path, humanize.Bytes(res.Size), len(res.Pruned))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(res)
+	}
+}
+
+// handleExport downloads the database as a `db export` JSON dump. It holds
+// config secrets like the command's output does.
+func handleExport(a *app.App) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rc := http.NewResponseController(w)
+		if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+			a.Log.Debugf("Export keeps the write timeout: %v", err)
+		}
+		now := time.Now()
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.json"`, a.BuildInfo().Name, now.Format("20060102-150405")))
+		sw := &startedWriter{w: w}
+		if _, err := transfer.ExportJSON(a.DB, sw, transfer.Header{
+			App:        a.BuildInfo().Name,
+			Version:    a.BuildInfo().Version,
+			StorageDir: a.StorageDir,
+			CreatedAt:  now,
+		}); err != nil {
+			if !sw.started {
+				w.Header().Del("Content-Disposition")
+				xhttp.Error(r.Context(), w, errs.HTTP(errs.Wrap(errs.Internal, err, "failed to export")))
+				return
+			}
+			// the status is already sent, the cut off dump won't parse
+			a.Log.Errorf("Failed to export: %v", err)
+		}
+	}
+}
+
+// startedWriter tells whether anything was written to w yet.
+type startedWriter struct {
+	w       io.Writer
+	started bool
+}
+
+func (s *startedWriter) Write(p []byte) (int, error) {
+	s.started = true
+	return s.w.Write(p)
+}
@@ -0,0 +1,240 @@
+package settings_test
+
+import (
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sprout/internal/platform/database/config"
+	"sprout/internal/platform/http/router/settings"
+	"sprout/internal/testsupport/routertest"
+	"sprout/internal/types"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpdateSettings(t *testing.T) {
+	s := routertest.New(t, routertest.WithRoutes(settings.Register), routertest.WithConfig(func(cfg *types.Configuration) error {
+		cfg.Host = "example.com"
+		return nil
+	}))
+
+	s.Get("/").AssertStatus(http.StatusOK).AssertContains("example.com")
+	s.Get("/settings/schema").AssertStatus(http.StatusOK).AssertContains(`"backup":{`)
+
+	s.PostJSON("/settings", map[string]any{"port": 9000, "logLevel": "error"}).AssertStatus(http.StatusOK)
+	cfg := s.Config()
+	if cfg.Port != 9000 || cfg.LogLevel != "error" {
+		t.Errorf("config port/logLevel = %d/%q, want 9000/%q", cfg.Port, cfg.LogLevel, "error")
+	}
+	if cfg.Host != "example.com" {
+		t.Errorf("config host = %q, want unchanged %q", cfg.Host, "example.com")
+	}
+
+	s.Do(http.MethodPost, "/settings", nil, nil).AssertStatus(http.StatusBadRequest)
+
+	s.PostJSON("/settings", map[string]any{"backupSchedule": "0 3 * * *", "backupKeepLast": 7}).AssertStatus(http.StatusOK)
+	if cfg := s.Config(); cfg.Backup.Schedule != "0 3 * * *" || cfg.Backup.KeepLast != 7 {
+		t.Errorf("config backup = %+v, want schedule %q and keepLast 7", cfg.Backup, "0 3 * * *")
+	}
+	s.PostJSON("/settings", map[string]any{"backupSchedule": "every day"}).AssertStatus(http.StatusBadRequest)
+	s.PostJSON("/settings", map[string]any{"backupKeepDaily": -1}).AssertStatus(http.StatusBadRequest)
+
+	// invalid values come back per field and change nothing
+	s.PostJSON("/settings", map[string]any{"port": 0, "logLevel": "loud"}).
+		AssertStatus(http.StatusBadRequest).
+		AssertContains(`"field":"logLevel"`).
+		AssertContains(`"field":"port"`)
+	if cfg := s.Config(); cfg.Port != 9000 || cfg.LogLevel != "error" {
+		t.Errorf("config port/logLevel = %d/%q after invalid update, want 9000/%q", cfg.Port, cfg.LogLevel, "error")
+	}
+}
+
+func TestUpdateAnySetting(t *testing.T) {
+	s := routertest.New(t, routertest.WithRoutes(settings.Register))
+
+	// any setting by key, values as JSON or as strings `config set` parses
+	s.PostJSON("/settings", map[string]any{
+		"outboundTimeout":   "45",
+		"httpRecord":        true,
+		"janitor.schedule":  "off",
+		"releaseToken":      "hunter2",
+		"backup.keepWeekly": 2,
+	}).AssertStatus(http.StatusOK)
+	cfg := s.Config()
+	if cfg.OutboundTimeout != 45 || !cfg.HTTPRecord || cfg.Janitor.Schedule != "off" || cfg.ReleaseToken != "hunter2" || cfg.Backup.KeepWeekly != 2 {
+		t.Errorf("config = timeout %d, record %v, janitor %q, token %q, keepWeekly %d", cfg.OutboundTimeout, cfg.HTTPRecord, cfg.Janitor.Schedule, cfg.ReleaseToken, cfg.Backup.KeepWeekly)
+	}
+
+	s.PostJSON("/settings", map[string]any{"startCounter": 9, "prot": 1, "maxConnections": "many"}).
+		AssertStatus(http.StatusBadRequest).
+		AssertContains(`"field":"startCounter"`).
+		AssertContains(`"field":"prot"`).
+		AssertContains(`want number`)
+	if cfg := s.Config(); cfg.StartCounter == 9 {
+		t.Error("recorded startCounter changed")
+	}
+}
+
+func TestForm(t *testing.T) {
+	cfg := types.DefaultConfig()
+	cfg.ReleaseToken, cfg.LogLevel = "hunter2", "WARN"
+	form := settings.Form(&cfg, []*config.File{{Path: "/etc/sprout/" + config.FileName, Keys: []string{"port"}}})
+	if len(form) == 0 || form[0].Name != "server" {
+		t.Fatalf("Form() starts with %+v, want the server group", form)
+	}
+	fields := map[string]settings.FormField{}
+	for _, g := range form {
+		for _, f := range g.Fields {
+			fields[f.Key] = f
+		}
+	}
+	if f := fields["logLevel"]; f.Input != "select" || f.Value != "warn" || !f.Live || f.ID != "settings-log-level" {
+		t.Errorf("logLevel = %+v, want a live select with warn selected", f)
+	}
+	if f := fields["port"]; f.Input != "number" || f.Min == nil || *f.Min != 1 || f.By != config.FileName {
+		t.Errorf("port = %+v, want a number from 1 set by %s", f, config.FileName)
+	}
+	if f := fields["releaseToken"]; f.Input != "password" || f.Value != "" || !f.Secret {
+		t.Errorf("releaseToken = %+v, want a set secret without its value", f)
+	}
+	if f := fields["httpRecord"]; f.Input != "checkbox" || f.Label != "HTTP Record" {
+		t.Errorf("httpRecord = %+v", f)
+	}
+	if f, ok := fields["backup.keepLast"]; !ok || f.ID != "settings-backup-keep-last" {
+		t.Errorf("backup.keepLast = %+v", f)
+	}
+	for _, key := range []string{"startCounter", "webhooks", "lastUpdateCheck"} {
+		if _, ok := fields[key]; ok {
+			t.Errorf("%s has an input", key)
+		}
+	}
+}
+
+func TestResetSettings(t *testing.T) {
+	s := routertest.New(t, routertest.WithRoutes(settings.Register), routertest.WithConfig(func(cfg *types.Configuration) error {
+		cfg.Host = "example.com"
+		cfg.StartCounter = 7
+		return nil
+	}))
+
+	s.PostJSON("/settings/reset", nil).AssertStatus(http.StatusOK)
+	cfg := s.Config()
+	if def := types.DefaultConfig(); cfg.Host != def.Host {
+		t.Errorf("host after reset = %q, want %q", cfg.Host, def.Host)
+	}
+	if cfg.StartCounter != 7 {
+		t.Errorf("start counter after reset = %d, want it kept (7)", cfg.StartCounter)
+	}
+}
+
+func TestSettingsHistory(t *testing.T) {
+	s := routertest.New(t, routertest.WithRoutes(settings.Register))
+
+	s.Get("/").AssertStatus(http.StatusOK).AssertContains("No settings changed yet")
+	s.PostJSON("/settings", map[string]any{"host": "api.example.com"}).AssertStatus(http.StatusOK)
+	s.Do(http.MethodPost, "/settings", strings.NewReader(`{"host":"web.example.com"}`), http.Header{
+		"Content-Type":   {"application/json"},
+		"Sec-Fetch-Site": {"same-origin"},
+	}).AssertStatus(http.StatusOK)
+
+	history, err := config.History(s.App.DB, 0)
+	if err != nil {
+		t.Fatalf("History: %v", err)
+	}
+	if len(history) < 2 || history[0].Source != config.SourceWeb || history[1].Source != config.SourceAPI {
+		t.Fatalf("History() = %+v, want a web change after an api one", history)
+	}
+	if f := history[0].Fields; len(f) != 1 || f[0].Key != "host" || f[0].Old != "api.example.com" || f[0].New != "web.example.com" {
+		t.Errorf("web change = %+v", f)
+	}
+	s.Get("/").AssertStatus(http.StatusOK).AssertContains("Recent Changes").AssertContains("web.example.com")
+}
+
+func TestSettingsRollback(t *testing.T) {
+	s := routertest.New(t, routertest.WithRoutes(settings.Register))
+
+	s.PostJSON("/settings/rollback", nil).AssertStatus(http.StatusNotFound)
+	if page := s.Get("/").AssertStatus(http.StatusOK); strings.Contains(string(page.Body), "Undo last change") {
+		t.Error("page offers to undo without a change")
+	}
+	s.PostJSON("/settings", map[string]any{"host": "before.example.com"}).AssertStatus(http.StatusOK)
+	s.PostJSON("/settings", map[string]any{"host": "after.example.com"}).AssertStatus(http.StatusOK)
+	s.Get("/").AssertStatus(http.StatusOK).AssertContains("Undo last change")
+
+	s.PostJSON("/settings/rollback", nil).AssertStatus(http.StatusOK)
+	if host := s.Config().Host; host != "before.example.com" {
+		t.Errorf("host after rollback = %q, want before.example.com", host)
+	}
+}
+
+func TestUpdateLog(t *testing.T) {
+	s := routertest.New(t, routertest.WithRoutes(settings.Register))
+	s.Get("/settings/update-log").AssertStatus(http.StatusNotFound)
+
+	// update.log already holds an earlier update's output
+	log := "old run\n" + "step 1\n" + "step 2\n" + "--- update exited with status 1\n"
+	s = routertest.New(t, routertest.WithRoutes(settings.Register), routertest.WithConfig(func(cfg *types.Configuration) error {
+		cfg.LastUpdateRun = types.UpdateRun{LogOffset: int64(len("old run\n")), Started: time.Now()}
+		return nil
+	}))
+	if err := os.WriteFile(filepath.Join(s.App.StorageDir, "update.log"), []byte(log), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := s.Get("/settings/update-log").
+		AssertStatus(http.StatusOK).
+		AssertHeader("Content-Type", "text/event-stream").
+		AssertContains("id: 15\ndata: step 1\n\n").
+		AssertContains("data: step 2\n\n").
+		AssertContains("event: done\ndata: {\"failed\":true,\"detail\":\"exit status 1\"}\n\n")
+	if strings.Contains(string(resp.Body), "old run") {
+		t.Errorf("stream includes output from before the update:\n%s", resp.Body)
+	}
+
+	// resuming after a reconnect skips what was sent
+	resp = s.Do(http.MethodGet, "/settings/update-log", nil, http.Header{"Last-Event-Id": {"15"}}).AssertContains("data: step 2")
+	if strings.Contains(string(resp.Body), "step 1") {
+		t.Errorf("resumed stream repeats step 1:\n%s", resp.Body)
+	}
+	s.Do(http.MethodGet, "/settings/update-log", nil, http.Header{"Last-Event-Id": {"x"}}).AssertStatus(http.StatusBadRequest)
+}
+
+func TestBackupAndExport(t *testing.T) {
+	s := routertest.New(t, routertest.WithRoutes(settings.Register), routertest.WithConfig(func(cfg *types.Configuration) error {
+		cfg.Host = "export.example.com"
+		return nil
+	}))
+
+	s.PostJSON("/settings/backup", nil).
+		AssertStatus(http.StatusOK).
+		AssertContains(`"trigger":"api"`).
+		AssertContains(`"verified":true`)
+
+	s.Get("/settings/db-export").
+		AssertStatus(http.StatusOK).
+		AssertHeader("Content-Type", "application/json").
+		AssertContains(`"dbis"`).
+		AssertContains("export.example.com")
+}
+
+// FuzzUpdateSettings sends arbitrary bodies to the settings decoder. Anything
+// other than 200 (applied) or 400 (rejected) means the handler misbehaved.
+func FuzzUpdateSettings(f *testing.F) {
+	s := routertest.New(f, routertest.WithRoutes(settings.Register))
+
+	f.Add([]byte(`{"logLevel":"debug","host":"example.com","port":8080,"proxyPort":443}`))
+	f.Add([]byte(`{}`))
+	f.Add([]byte(`null`))
+	f.Add([]byte(`{"port":"8080"}`))
+	f.Add([]byte(`{"port":1e400}`))
+	f.Add([]byte(`[`))
+
+	f.Fuzz(func(t *testing.T, body []byte) {
+		resp := s.WithT(t).Do(http.MethodPost, "/settings", bytes.NewReader(body), http.Header{"Content-Type": {"application/json"}})
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("status = %d for body %q: %s", resp.StatusCode, body, resp.Body)
+		}
+	})
+}
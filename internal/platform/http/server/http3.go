@@ -0,0 +1,58 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/Data-Corruption/stdx/xhttp"
+	"github.com/quic-go/quic-go/http3"
+)
+
+// http3Timeout bounds waiting for HTTP/3 requests in flight on shutdown.
+const http3Timeout = 10 * time.Second
+
+// withHTTP3 adds an HTTP/3 listener to cfg when tls.http3 is on: the same
+// handler served over QUIC on the same port (UDP), with the same
+// certificate. It starts once the TCP listener is up and stops with it,
+// responses over TCP advertise it with an Alt-Svc header so browsers switch.
+// A failing HTTP/3 listener is logged, TCP keeps serving.
+func (s *Server) withHTTP3(cfg *xhttp.ServerConfig) *http3.Server {
+	if !s.http3 {
+		return nil
+	}
+	h3 := &http3.Server{
+		Addr:      cfg.Addr,
+		Handler:   cfg.Handler,
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{MinVersion: tls.VersionTLS13}),
+	}
+	next := cfg.Handler
+	cfg.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor < 3 {
+			_ = h3.SetQUICHeaders(w.Header()) // fails until it's listening
+		}
+		next.ServeHTTP(w, r)
+	})
+
+	afterListen, onShutdown := cfg.AfterListen, cfg.OnShutdown
+	certFile, keyFile := cfg.TLSCertPath, cfg.TLSKeyPath
+	cfg.AfterListen = func() {
+		go func() {
+			if err := h3.ListenAndServeTLS(certFile, keyFile); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				s.app.Log.Errorf("HTTP/3 listener failed: %v", err)
+			}
+		}()
+		afterListen()
+	}
+	cfg.OnShutdown = func() {
+		ctx, cancel := context.WithTimeout(context.Background(), http3Timeout)
+		defer cancel()
+		if err := h3.Shutdown(ctx); err != nil {
+			s.app.Log.Debugf("HTTP/3 shutdown: %v", err)
+		}
+		onShutdown()
+	}
+	return h3
+}
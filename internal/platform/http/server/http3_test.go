@@ -0,0 +1,136 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sprout/internal/app"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Data-Corruption/stdx/xhttp"
+	"github.com/Data-Corruption/stdx/xlog"
+	"github.com/quic-go/quic-go/http3"
+)
+
+func TestHTTP3(t *testing.T) {
+	log, err := xlog.New(filepath.Join(t.TempDir(), "logs"), "none")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{app: &app.App{Log: log}}
+	if s.withHTTP3(&xhttp.ServerConfig{}) != nil {
+		t.Fatal("withHTTP3 with tls.http3 off returned a server")
+	}
+
+	// a free UDP port
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := pc.LocalAddr().String()
+	pc.Close()
+
+	certFile, keyFile := writeCert(t)
+	var listened, shutdown bool
+	cfg := xhttp.ServerConfig{
+		Addr: addr,
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "HTTP/%d", r.ProtoMajor)
+		}),
+		TLSCertPath: certFile,
+		TLSKeyPath:  keyFile,
+		AfterListen: func() { listened = true },
+		OnShutdown:  func() { shutdown = true },
+	}
+	s.http3 = true
+	h3 := s.withHTTP3(&cfg)
+	if h3 == nil {
+		t.Fatal("withHTTP3 with tls.http3 on returned nil")
+	}
+	cfg.AfterListen()
+	if !listened {
+		t.Error("the original AfterListen wasn't called")
+	}
+
+	client := &http.Client{Transport: &http3.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}, Timeout: 5 * time.Second}
+	var body string
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		resp, err := client.Get("https://" + addr + "/")
+		if err == nil {
+			data, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			body = string(data)
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("GET over HTTP/3: %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if body != "HTTP/3" {
+		t.Errorf("response over QUIC = %q, want it served by the handler as HTTP/3", body)
+	}
+
+	// over TCP the handler advertises it
+	rec := httptest.NewRecorder()
+	cfg.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if alt := rec.Header().Get("Alt-Svc"); !strings.Contains(alt, `h3=":`) {
+		t.Errorf("Alt-Svc = %q, want h3 advertised", alt)
+	}
+
+	cfg.OnShutdown()
+	if !shutdown {
+		t.Error("the original OnShutdown wasn't called")
+	}
+	client.Timeout = time.Second
+	if _, err := client.Get("https://" + addr + "/"); err == nil {
+		t.Error("HTTP/3 still served after shutdown")
+	}
+}
+
+// writeCert writes a self-signed certificate for 127.0.0.1 and its key.
+func writeCert(t *testing.T) (certFile, keyFile string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return certFile, keyFile
+}
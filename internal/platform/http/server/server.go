@@ -1,23 +1,85 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
+	"os"
 	"sprout/internal/app"
+	"sprout/internal/platform/acme"
 	"sprout/internal/platform/database/config"
+	"sprout/internal/platform/lifecycle"
+	"sprout/internal/platform/notify"
+	"sprout/internal/platform/selftest"
 	"sprout/internal/types"
 	"sprout/pkg/sdnotify"
+	"strconv"
+	"sync/atomic"
+	"time"
 
 	"github.com/Data-Corruption/stdx/xhttp"
+	"github.com/quic-go/quic-go/http3"
 )
 
-func New(app *app.App, port int, handler http.Handler) error {
+// Ready is written as a single JSON line to the ready writer once the server
+// is listening and startup bookkeeping is done.
+type Ready struct {
+	PID     int    `json:"pid"`
+	Port    int    `json:"port"`
+	Addr    string `json:"addr"`
+	BaseURL string `json:"baseURL"`
+	Version string `json:"version"`
+}
+
+// Server is the service's http server, app.Server is the listener it's
+// currently serving on.
+type Server struct {
+	app    *app.App
+	config xhttp.ServerConfig // of the first listener, see listener
+	certs  *acme.Manager      // nil unless the certificate comes from ACME
+	http3  bool               // serve HTTP/3 too, see withHTTP3
+	h3     *http3.Server      // of the current listener, nil without http3
+	port   atomic.Int64       // of the current listener
+	moveTo atomic.Int64       // port a reload asked for, see Listen
+	// set once the current listener is shut down to move rather than to stop
+	moving atomic.Pointer[atomic.Bool]
+}
+
+// New creates the server and sets app.Server. If ready is non-nil, a [Ready]
+// line is written to it once fully started, and it's closed afterwards if it's
+// an io.Closer (e.g. a --ready-fd pipe).
+//
+// It listens on the port setting, changing it moves the server to the new
+// port (see Listen) unless --port pins it (see config.Layers).
+func New(app *app.App, handler http.Handler, ready io.Writer) (*Server, error) {
+	cfg, err := config.View(app.DB)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get configuration from database: %w", err)
+	}
+	s := &Server{app: app}
+
+	// only one instance tracks starts / stops, see lifecycle
+	tracker, owner, err := lifecycle.Claim(app.DB, app.RuntimeDir, app.BuildInfo().Version)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim lifecycle tracking: %w", err)
+	}
+	if owner {
+		app.AddCleanup(tracker.Release)
+	} else {
+		app.Log.Warn("another instance is tracking service starts, restart / update detection is left to it")
+	}
+
 	// create http server
-	var err error
-	app.Server, err = xhttp.NewServer(&xhttp.ServerConfig{
-		Addr:    fmt.Sprintf(":%d", port),
-		UseTLS:  false,
-		Handler: handler,
+	s.config = xhttp.ServerConfig{
+		Addr:         fmt.Sprintf(":%d", cfg.Port),
+		UseTLS:       false,
+		Handler:      handler,
+		ReadTimeout:  time.Duration(cfg.ServerReadTimeout) * time.Second, // 0 = xhttp default
+		WriteTimeout: time.Duration(cfg.ServerWriteTimeout) * time.Second,
+		IdleTimeout:  time.Duration(cfg.ServerIdleTimeout) * time.Second,
 		AfterListen: func() {
 			// tell systemd we're ready
 			fmt.Println("Listening on", app.BaseURL) // for user
@@ -25,12 +87,35 @@ func New(app *app.App, port int, handler http.Handler) error {
 			if err := sdnotify.Ready(status); err != nil {
 				app.Log.Warnf("sd_notify READY failed: %v", err)
 			}
-			// increment start counter
-			if err := config.Update(app.DB, func(cfg *types.Configuration) error {
-				cfg.StartCounter++
-				return nil
-			}); err != nil {
-				app.Log.Errorf("failed to increment start counter: %v", err)
+			// record start
+			var preUpdateVersion string
+			var updated bool
+			if owner {
+				if preUpdateVersion, updated, err = tracker.RecordStart(); err != nil {
+					app.Log.Errorf("failed to record start: %v", err)
+				}
+			}
+			// lifecycle events
+			version := app.BuildInfo().Version
+			app.Notify.Dispatch(notify.Event{
+				Kind:    notify.EventServiceStarted,
+				Title:   "Service started",
+				Message: status,
+				Fields:  map[string]string{"baseURL": app.BaseURL, "version": version},
+			})
+			if updated {
+				app.Notify.Dispatch(notify.Event{
+					Kind:    notify.EventUpdateApplied,
+					Title:   "Update applied",
+					Message: fmt.Sprintf("%s -> %s", preUpdateVersion, version),
+					Fields:  map[string]string{"from": preUpdateVersion, "to": version},
+				})
+			}
+			// post-update hooks (warm caches, ...) mustn't hold up the ready line
+			go app.RunPendingUpdateHooks()
+			// readiness line for test harnesses / supervisors, written last
+			if ready != nil {
+				writeReady(app, ready)
 			}
 		},
 		OnShutdown: func() {
@@ -39,7 +124,160 @@ func New(app *app.App, port int, handler http.Handler) error {
 				app.Log.Debugf("sd_notify STOPPING failed: %v", err)
 			}
 			fmt.Println("shutting down, cleaning up resources ...")
+			app.Notify.Dispatch(notify.Event{Kind: notify.EventServiceStopping, Title: "Service stopping"})
 		},
+	}
+	if err := s.setupTLS(cfg); err != nil {
+		return nil, err
+	}
+	s.port.Store(int64(cfg.Port))
+	if app.Server, err = s.listener(s.config.Addr, s.config.AfterListen); err != nil {
+		return nil, err
+	}
+
+	// a --port flag wins over the setting in every config read, so it stays put
+	app.OnReload("port", func(prev, next *types.Configuration) error {
+		if next.Port == prev.Port {
+			return nil
+		}
+		// fail the reload rather than the server, it keeps its port
+		if err := selftest.Port(next.Port); err != nil {
+			return err
+		}
+		s.moveTo.Store(int64(next.Port))
+		s.moving.Load().Store(true)
+		app.SetBaseURL(next) // links and webhooks point at the new port
+		go app.Server.Shutdown()
+		return nil
 	})
-	return err
+	return s, nil
+}
+
+// Listen serves until the server is shut down or fails, see
+// xhttp.Server.Listen. When a reload changes the port, the current listener
+// is shut down gracefully (requests in flight finish) and the server starts
+// again on the new port; the startup bookkeeping of New isn't repeated. A
+// renewed certificate restarts it on the same port the same way.
+func (s *Server) Listen() error {
+	for {
+		err := s.app.Server.Listen()
+		if s.h3 != nil {
+			s.h3.Close() // shut down with the TCP listener, unless that failed
+		}
+		if err != nil {
+			return err
+		}
+		port := s.moveTo.Swap(0)
+		if port == 0 {
+			return nil
+		}
+		moved := port != s.port.Load() // or restarted, see RenewCert
+		srv, err := s.listener(fmt.Sprintf(":%d", port), func() {
+			status := fmt.Sprintf("Listening on %s", s.app.Server.Addr())
+			if err := sdnotify.Status(status); err != nil {
+				s.app.Log.Debugf("sd_notify STATUS failed: %v", err)
+			}
+			if moved {
+				s.app.Log.Infof("Moved to port %d", port)
+			} else {
+				s.app.Log.Infof("Restarted the listener on port %d", port)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		s.port.Store(port)
+		s.app.Server = srv
+	}
+}
+
+// setupTLS has the listeners serve HTTPS when the config asks for it, see
+// types.TLSConfig. With ACME, a certificate is obtained first if there's no
+// valid one yet.
+func (s *Server) setupTLS(cfg *types.Configuration) error {
+	t := cfg.TLS
+	if !t.Enabled() {
+		return nil
+	}
+	s.config.UseTLS, s.http3 = true, t.HTTP3
+	s.config.TLSCertPath, s.config.TLSKeyPath = t.CertFile, t.KeyFile
+	if t.DNSProvider == "" {
+		return nil
+	}
+	certs, err := acme.New(s.app.StorageDir, cfg.Host, t, s.app.HTTP, s.app.Log)
+	if err != nil {
+		return err
+	}
+	s.certs = certs
+	s.config.TLSCertPath, s.config.TLSKeyPath = certs.CertFile(), certs.KeyFile()
+	if !certs.Expiry().IsZero() {
+		return nil // a renewal can wait for the job, see RenewCert
+	}
+	// the DNS challenge takes longer than systemd waits for us by default
+	_ = sdnotify.ExtendTimeout(certTimeout)
+	_ = sdnotify.Status("Requesting a TLS certificate for " + cfg.Host)
+	ctx, cancel := context.WithTimeout(s.app.Context, certTimeout)
+	defer cancel()
+	if err := certs.Obtain(ctx); err != nil {
+		return fmt.Errorf("failed to get a TLS certificate for %s: %w", cfg.Host, err)
+	}
+	return nil
+}
+
+// certTimeout bounds getting a certificate.
+const certTimeout = 5 * time.Minute
+
+// RenewCert renews the ACME certificate if it's close to expiring, see
+// acme.Manager.Renew, and restarts the listener to serve the new one.
+// Requests in flight finish first, like moving to another port. Does
+// nothing unless the certificate comes from ACME.
+func (s *Server) RenewCert(ctx context.Context) (renewed bool, err error) {
+	if s.certs == nil {
+		return false, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, certTimeout)
+	defer cancel()
+	if renewed, err = s.certs.Renew(ctx); err != nil || !renewed {
+		return false, err
+	}
+	s.restart()
+	return true, nil
+}
+
+// restart starts the listener again on its port, see Listen.
+func (s *Server) restart() {
+	s.moveTo.CompareAndSwap(0, s.port.Load())
+	s.moving.Load().Store(true)
+	go s.app.Server.Shutdown()
+}
+
+// listener creates a listener on addr with the settings New made, plus its
+// HTTP/3 listener if enabled. Its OnShutdown is skipped when it's shut down
+// to move.
+func (s *Server) listener(addr string, afterListen func()) (*xhttp.Server, error) {
+	cfg := s.config
+	cfg.Addr, cfg.AfterListen = addr, afterListen
+	moving := &atomic.Bool{}
+	cfg.OnShutdown = func() {
+		if !moving.Load() {
+			s.config.OnShutdown()
+		}
+	}
+	s.moving.Store(moving)
+	s.h3 = s.withHTTP3(&cfg)
+	return xhttp.NewServer(&cfg)
+}
+
+func writeReady(app *app.App, w io.Writer) {
+	addr := app.Server.Addr()
+	r := Ready{PID: os.Getpid(), Addr: addr, BaseURL: app.BaseURL, Version: app.BuildInfo().Version}
+	if _, portStr, err := net.SplitHostPort(addr); err == nil {
+		r.Port, _ = strconv.Atoi(portStr)
+	}
+	if err := json.NewEncoder(w).Encode(r); err != nil {
+		app.Log.Errorf("failed to write ready notification: %v", err)
+	}
+	if c, ok := w.(io.Closer); ok && w != os.Stdout && w != os.Stderr {
+		_ = c.Close()
+	}
 }
@@ -0,0 +1,107 @@
+// Package httpclient builds the outbound HTTP client shared by everything that
+// talks to the outside world (release checks, webhooks, etc), so proxy, CA,
+// timeout, and user-agent settings are honored consistently.
+package httpclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"sprout/internal/types"
+)
+
+const DefaultTimeout = 30 * time.Second
+
+// Options configures [New]. Zero values fall back to sensible defaults.
+type Options struct {
+	Timeout   time.Duration // overall request timeout, default [DefaultTimeout]
+	UserAgent string        // set on requests that don't already have one
+	Proxy     string        // proxy URL, empty = use HTTPS_PROXY/HTTP_PROXY/NO_PROXY env
+	CABundle  string        // path to a PEM bundle trusted in addition to the system roots
+}
+
+// FromConfig returns the client options described by the configuration.
+func FromConfig(cfg *types.Configuration, userAgent string) Options {
+	return Options{
+		Timeout:   time.Duration(cfg.OutboundTimeout) * time.Second,
+		UserAgent: userAgent,
+		Proxy:     cfg.OutboundProxy,
+		CABundle:  cfg.OutboundCABundle,
+	}
+}
+
+// ProxyFor returns the proxy the client uses for requests to rawURL, nil for
+// a direct connection. For handing the setting to child processes (e.g. the
+// install script's curl) that don't share the configuration or environment.
+func (o Options) ProxyFor(rawURL string) (*url.URL, error) {
+	if o.Proxy != "" {
+		proxyURL, err := url.Parse(o.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL %q: %w", o.Proxy, err)
+		}
+		return proxyURL, nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %q: %w", rawURL, err)
+	}
+	return http.ProxyFromEnvironment(&http.Request{URL: u})
+}
+
+// New creates an outbound client. Callers should still pass a context with
+// their own deadline for anything user facing, Timeout is just a backstop.
+func New(opts Options) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if opts.Proxy != "" {
+		proxyURL, err := url.Parse(opts.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL %q: %w", opts.Proxy, err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+	}
+
+	if opts.CABundle != "" {
+		pem, err := os.ReadFile(opts.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", opts.CABundle)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12}
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: &uaTransport{next: transport, userAgent: opts.UserAgent},
+	}, nil
+}
+
+// uaTransport sets a default User-Agent on outgoing requests.
+type uaTransport struct {
+	next      http.RoundTripper
+	userAgent string
+}
+
+func (t *uaTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.userAgent != "" && req.Header.Get("User-Agent") == "" {
+		req = req.Clone(req.Context()) // RoundTrippers must not modify the request
+		req.Header.Set("User-Agent", t.userAgent)
+	}
+	return t.next.RoundTrip(req)
+}
@@ -0,0 +1,16 @@
+package httpclient
+
+import "testing"
+
+func TestProxyFor(t *testing.T) {
+	p, err := Options{Proxy: "http://user:pw@proxy.corp:3128"}.ProxyFor("https://cd.example.com/release/")
+	if err != nil || p == nil || p.Host != "proxy.corp:3128" || p.User.Username() != "user" {
+		t.Errorf("ProxyFor(configured) = %v, %v", p, err)
+	}
+	if _, err := (Options{Proxy: "http://[bad"}).ProxyFor("https://cd.example.com/"); err == nil {
+		t.Error("ProxyFor accepted an invalid proxy URL")
+	}
+	if _, err := (Options{}).ProxyFor("://nope"); err == nil {
+		t.Error("ProxyFor accepted an invalid URL")
+	}
+}
@@ -0,0 +1,210 @@
+// Package httprecord stores sanitized HTTP request/response pairs in a ring
+// buffer DBI, so a failure someone saw once can be inspected and replayed
+// (`http list|show|replay`). Recording is opt-in, see types.Configuration.HTTPRecord.
+package httprecord
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sprout/internal/platform/database"
+	"sprout/internal/platform/database/kv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultKeep  = 200      // recordings kept when the config says 0
+	MaxBodyBytes = 64 << 10 // bodies are truncated past this
+	Redacted     = "[REDACTED]"
+	UnparsedBody = "[unparsed body redacted]" // stored for bodies that aren't JSON
+)
+
+// nextIDKey holds the next ID. Recordings use 8 byte big endian keys, so
+// they sort in order and the counter (different length) is easy to skip.
+var nextIDKey = []byte("next")
+
+// Recording is one request/response pair.
+type Recording struct {
+	ID         uint64        `json:"id"`
+	Time       time.Time     `json:"time"`
+	Duration   time.Duration `json:"duration"`
+	Method     string        `json:"method"`
+	URI        string        `json:"uri"` // path and query
+	ReqHeader  http.Header   `json:"reqHeader"`
+	ReqBody    string        `json:"reqBody"`
+	Status     int           `json:"status"`
+	RespHeader http.Header   `json:"respHeader"`
+	RespBody   string        `json:"respBody"`
+	Truncated  bool          `json:"truncated"` // a body was cut at MaxBodyBytes
+}
+
+// sensitiveHeaders are dropped entirely.
+var sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie", "X-Api-Key"}
+
+// sensitiveKeys are substrings of JSON keys and query parameters whose values
+// get redacted.
+var sensitiveKeys = []string{"password", "secret", "token", "apikey", "api_key"}
+
+// SanitizeHeader returns a copy of h without credentials.
+func SanitizeHeader(h http.Header) http.Header {
+	out := h.Clone()
+	for _, k := range sensitiveHeaders {
+		out.Del(k)
+	}
+	return out
+}
+
+// SanitizeURI returns u's path and query with the values of sensitive query
+// parameters redacted. The other parameters are kept as sent, in order.
+func SanitizeURI(u *url.URL) string {
+	if u.RawQuery == "" {
+		return u.RequestURI()
+	}
+	params := strings.Split(u.RawQuery, "&")
+	for i, p := range params {
+		k, _, _ := strings.Cut(p, "=")
+		name, err := url.QueryUnescape(k)
+		if err != nil {
+			name = k
+		}
+		if isSensitiveKey(name) {
+			params[i] = k + "=" + url.QueryEscape(Redacted)
+		}
+	}
+	out := *u
+	out.RawQuery = strings.Join(params, "&")
+	return out.RequestURI()
+}
+
+// SanitizeBody redacts sensitive values in JSON bodies, then truncates long
+// ones. Bodies that aren't JSON, or were cut short before they got here, can't
+// be searched for credentials and are stored as UnparsedBody.
+func SanitizeBody(body []byte) (string, bool) {
+	if len(body) == 0 {
+		return "", false
+	}
+	var v any
+	if err := json.Unmarshal(body, &v); err != nil {
+		return UnparsedBody, len(body) > MaxBodyBytes
+	}
+	out, err := json.Marshal(redact(v))
+	if err != nil {
+		return UnparsedBody, len(body) > MaxBodyBytes
+	}
+	if len(out) > MaxBodyBytes {
+		return string(out[:MaxBodyBytes]), true
+	}
+	return string(out), false
+}
+
+func redact(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, val := range t {
+			if isSensitiveKey(k) {
+				t[k] = Redacted
+			} else {
+				t[k] = redact(val)
+			}
+		}
+	case []any:
+		for i := range t {
+			t[i] = redact(t[i])
+		}
+	}
+	return v
+}
+
+func isSensitiveKey(k string) bool {
+	k = strings.ToLower(k)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(k, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func idKey(id uint64) []byte {
+	return binary.BigEndian.AppendUint64(nil, id)
+}
+
+// Append stores rec under the next ID, dropping the oldest recordings past keep.
+func Append(db kv.DB, rec Recording, keep int) (uint64, error) {
+	if keep <= 0 {
+		keep = DefaultKeep
+	}
+	err := db.Update(func(txn kv.Txn) error {
+		var next uint64 = 1
+		if err := database.TxnGetAndUnmarshal(txn, *database.HTTPLogDBI, nextIDKey, &next); err != nil && !kv.IsNotFound(err) {
+			return fmt.Errorf("failed to get next recording id: %w", err)
+		}
+		rec.ID = next
+		if err := database.TxnPut(txn, *database.HTTPLogDBI, idKey(rec.ID), rec); err != nil {
+			return fmt.Errorf("failed to store recording: %w", err)
+		}
+		if err := database.TxnPut(txn, *database.HTTPLogDBI, nextIDKey, next+1); err != nil {
+			return fmt.Errorf("failed to store next recording id: %w", err)
+		}
+		// ring buffer, everything at or below the cut goes, not just the one
+		// falling out, in case keep was lowered since the last append
+		if rec.ID > uint64(keep) {
+			return trim(txn, rec.ID-uint64(keep))
+		}
+		return nil
+	})
+	return rec.ID, err
+}
+
+// trim deletes the recordings with IDs up to and including last.
+func trim(txn kv.Txn, last uint64) error {
+	cursor, err := txn.Cursor(*database.HTTPLogDBI)
+	if err != nil {
+		return fmt.Errorf("failed to create cursor: %w", err)
+	}
+	defer cursor.Close()
+	cut := idKey(last)
+	k, _, err := cursor.First()
+	for ; !kv.IsNotFound(err); k, _, err = cursor.Next() {
+		if err != nil {
+			return fmt.Errorf("failed to get recording: %w", err)
+		}
+		if len(k) != 8 {
+			continue
+		}
+		if bytes.Compare(k, cut) > 0 {
+			return nil
+		}
+		if err := cursor.Delete(); err != nil {
+			return fmt.Errorf("failed to delete recording: %w", err)
+		}
+	}
+	return nil
+}
+
+// List returns all stored recordings, oldest first.
+func List(db kv.DB) ([]Recording, error) {
+	return database.ViewAll[Recording](db, *database.HTTPLogDBI, func(key, value []byte) bool {
+		return len(key) == 8
+	})
+}
+
+// Get returns a single recording. errs.Is(err, errs.NotFound) is true if it's gone / never existed.
+func Get(db kv.DB, id uint64) (*Recording, error) {
+	return database.View[Recording](db, *database.HTTPLogDBI, idKey(id))
+}
+
+// Clear deletes all recordings. IDs keep counting up.
+func Clear(db kv.DB) error {
+	return db.Update(func(txn kv.Txn) error {
+		return database.TxnForEach(txn, *database.HTTPLogDBI, func(key, value []byte) bool {
+			return len(key) == 8
+		}, func(key []byte, rec *Recording) (database.ForEachAction, error) {
+			return database.ActionDelete, nil
+		})
+	})
+}
@@ -0,0 +1,107 @@
+package httprecord
+
+import (
+	"encoding/json"
+	"net/url"
+	"slices"
+	"sprout/internal/testsupport/dbtest"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeBody(t *testing.T) {
+	body := `{"user":"bob","Password":"hunter2","nested":{"apiKey":"k","list":[{"refresh_token":"t","n":1}]}}`
+	got, truncated := SanitizeBody([]byte(body))
+	if truncated {
+		t.Errorf("SanitizeBody(small) truncated")
+	}
+	var v map[string]any
+	if err := json.Unmarshal([]byte(got), &v); err != nil {
+		t.Fatalf("SanitizeBody() = %q, not JSON: %v", got, err)
+	}
+	nested := v["nested"].(map[string]any)
+	item := nested["list"].([]any)[0].(map[string]any)
+	if v["user"] != "bob" || v["Password"] != Redacted || nested["apiKey"] != Redacted || item["refresh_token"] != Redacted || item["n"] != 1.0 {
+		t.Errorf("SanitizeBody() = %s", got)
+	}
+
+	// redacted before it's cut, the secret isn't in the kept part either
+	long := `{"pad":"` + strings.Repeat("a", MaxBodyBytes) + `","token":"hunter2"}`
+	got, truncated = SanitizeBody([]byte(long))
+	if !truncated || len(got) != MaxBodyBytes || strings.Contains(got, "hunter2") {
+		t.Errorf("SanitizeBody(long) = %d bytes, truncated %v", len(got), truncated)
+	}
+
+	for _, tc := range []struct {
+		name, body string
+		truncated  bool
+	}{
+		{"form", "user=bob&password=hunter2", false},
+		{"cut short", `{"password":"hunter2","pad":"` + strings.Repeat("a", MaxBodyBytes), true},
+	} {
+		if got, truncated := SanitizeBody([]byte(tc.body)); got != UnparsedBody || truncated != tc.truncated {
+			t.Errorf("SanitizeBody(%s) = %q, %v, want the placeholder, %v", tc.name, got, truncated, tc.truncated)
+		}
+	}
+	if got, truncated := SanitizeBody(nil); got != "" || truncated {
+		t.Errorf("SanitizeBody(nil) = %q, %v", got, truncated)
+	}
+}
+
+func TestSanitizeURI(t *testing.T) {
+	for _, tc := range []struct{ uri, want string }{
+		{"/api/login", "/api/login"},
+		{"/api/login?x=1", "/api/login?x=1"},
+		{"/hook?b=2&access_token=hunter2&a=1", "/hook?b=2&access_token=%5BREDACTED%5D&a=1"},
+		{"/x?Password=a%20b&password", "/x?Password=%5BREDACTED%5D&password=%5BREDACTED%5D"},
+		{"/x?api%5Fkey=k", "/x?api%5Fkey=%5BREDACTED%5D"},
+	} {
+		u, err := url.ParseRequestURI(tc.uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := SanitizeURI(u); got != tc.want {
+			t.Errorf("SanitizeURI(%s) = %s, want %s", tc.uri, got, tc.want)
+		}
+	}
+}
+
+func TestAppend(t *testing.T) {
+	db := dbtest.Open(t)
+	ids := func() []uint64 {
+		t.Helper()
+		recs, err := List(db)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		var out []uint64
+		for _, r := range recs {
+			out = append(out, r.ID)
+		}
+		return out
+	}
+	for range 5 {
+		if _, err := Append(db, Recording{Method: "GET", URI: "/"}, 3); err != nil {
+			t.Fatalf("Append: %v", err)
+		}
+	}
+	if got := ids(); !slices.Equal(got, []uint64{3, 4, 5}) {
+		t.Errorf("ids after 5 appends keeping 3 = %v", got)
+	}
+
+	// lowering keep drops every recording past it on the next append
+	id, err := Append(db, Recording{Method: "GET", URI: "/"}, 1)
+	if err != nil || id != 6 {
+		t.Fatalf("Append() = %d, %v", id, err)
+	}
+	if got := ids(); !slices.Equal(got, []uint64{6}) {
+		t.Errorf("ids after lowering keep to 1 = %v", got)
+	}
+
+	if err := Clear(db); err != nil {
+		t.Fatalf("Clear: %v", err)
+	}
+	if id, err := Append(db, Recording{}, 0); err != nil || id != 7 {
+		t.Errorf("Append(after Clear) = %d, %v, want 7", id, err)
+	}
+}
@@ -0,0 +1,69 @@
+// Package ids generates identifiers and random tokens.
+//
+// The App holds a [Generator] so anything that names things (transient unit
+// names, request IDs, tokens) can be made deterministic in tests by swapping
+// in [NewSeeded].
+package ids
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	mrand "math/rand/v2"
+	"sync"
+	"time"
+)
+
+type Generator interface {
+	// NewID returns a short ID unique to this process, safe for systemd unit
+	// names and URLs. Random IDs sort by creation time (to the second).
+	NewID() string
+	// Token returns n random bytes, hex encoded.
+	Token(n int) string
+}
+
+// Random is the production generator, backed by crypto/rand.
+type Random struct{}
+
+// NewID returns e.g. "20250102-150405-9f86d081", the timestamp keeps journal
+// listings readable and the random part keeps same-second IDs apart.
+func (Random) NewID() string {
+	return time.Now().Format("20060102-150405") + "-" + Random{}.Token(4)
+}
+
+func (Random) Token(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b) // never returns an error, see crypto/rand docs
+	return hex.EncodeToString(b)
+}
+
+// Seeded is a deterministic generator for tests. IDs count up ("000001",
+// "000002", ...) and tokens come from a ChaCha8 stream keyed by the seed.
+type Seeded struct {
+	mu  sync.Mutex
+	n   int
+	rng *mrand.ChaCha8
+}
+
+func NewSeeded(seed uint64) *Seeded {
+	var key [32]byte
+	for i := range 8 {
+		key[i] = byte(seed >> (8 * i))
+	}
+	return &Seeded{rng: mrand.NewChaCha8(key)}
+}
+
+func (s *Seeded) NewID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.n++
+	return fmt.Sprintf("%06d", s.n)
+}
+
+func (s *Seeded) Token(n int) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := make([]byte, n)
+	_, _ = s.rng.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,35 @@
+package ids
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSeeded(t *testing.T) {
+	a, b := NewSeeded(7), NewSeeded(7)
+	for range 3 {
+		if x, y := a.Token(16), b.Token(16); x != y {
+			t.Fatalf("same seed gave different tokens %q and %q", x, y)
+		}
+	}
+	if got := a.NewID(); got != "000001" {
+		t.Errorf("first ID = %q, want 000001", got)
+	}
+	if NewSeeded(8).Token(16) == NewSeeded(7).Token(16) {
+		t.Errorf("different seeds gave the same token")
+	}
+}
+
+func TestRandomSameSecond(t *testing.T) {
+	seen := map[string]bool{}
+	for range 100 {
+		id := Random{}.NewID()
+		if seen[id] {
+			t.Fatalf("duplicate ID %q", id)
+		}
+		if strings.ContainsAny(id, " /@") {
+			t.Fatalf("ID %q not safe for unit names", id)
+		}
+		seen[id] = true
+	}
+}
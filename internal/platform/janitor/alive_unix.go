@@ -0,0 +1,15 @@
+//go:build unix
+
+package janitor
+
+import (
+	"errors"
+
+	"golang.org/x/sys/unix"
+)
+
+// alive reports whether pid exists. EPERM means it does, just not ours.
+func alive(pid int) bool {
+	err := unix.Kill(pid, 0)
+	return err == nil || errors.Is(err, unix.EPERM)
+}
@@ -0,0 +1,23 @@
+package janitor
+
+import (
+	"errors"
+
+	"golang.org/x/sys/windows"
+)
+
+// stillActive is the exit code of a process that hasn't exited (STILL_ACTIVE).
+const stillActive = 259
+
+// alive reports whether pid is running. Access denied means it is, just not
+// ours. A process that exited can still be opened while a handle to it is
+// open elsewhere, hence the exit code check.
+func alive(pid int) bool {
+	h, err := windows.OpenProcess(windows.PROCESS_QUERY_LIMITED_INFORMATION, false, uint32(pid))
+	if err != nil {
+		return errors.Is(err, windows.ERROR_ACCESS_DENIED)
+	}
+	defer windows.CloseHandle(h)
+	var code uint32
+	return windows.GetExitCodeProcess(h, &code) == nil && code == stillActive
+}
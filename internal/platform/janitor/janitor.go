@@ -0,0 +1,226 @@
+// Package janitor cleans up files that otherwise grow without bound: rotated
+// logs, the update log, and PID files left in the instances dir by processes
+// that crashed before their cleanup ran.
+//
+// The service runs it on a schedule (see types.JanitorConfig), `janitor` runs
+// it by hand.
+package janitor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sprout/internal/types"
+	"sprout/pkg/x"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Data-Corruption/stdx/xlog"
+)
+
+// Defaults used when a limit is zero.
+const (
+	DefaultSchedule        = "@daily"
+	DefaultLogMaxAgeDays   = 30
+	DefaultLogMaxFiles     = 20
+	DefaultUpdateLogMaxKiB = 1024
+
+	activeLog = "latest.log" // written by xlog, rotated copies are <timestamp>.log
+	quietFor  = time.Hour    // update.log isn't trimmed while an update may still be appending
+)
+
+// Limits for a run. Negative disables a rule.
+type Limits struct {
+	LogMaxAge       time.Duration // rotated logs older than this are removed
+	LogMaxFiles     int           // at most this many rotated logs are kept, newest first
+	UpdateLogMaxKiB int           // update.log is cut down to its last N KiB
+}
+
+// FromConfig resolves defaults, returning "" as the schedule if the janitor is off.
+func FromConfig(c types.JanitorConfig) (string, Limits) {
+	def := func(v, d int) int { return x.Ternary(v == 0, d, v) }
+	l := Limits{
+		LogMaxAge:       time.Duration(def(c.LogMaxAgeDays, DefaultLogMaxAgeDays)) * 24 * time.Hour,
+		LogMaxFiles:     def(c.LogMaxFiles, DefaultLogMaxFiles),
+		UpdateLogMaxKiB: def(c.UpdateLogMaxKiB, DefaultUpdateLogMaxKiB),
+	}
+	switch c.Schedule {
+	case "":
+		return DefaultSchedule, l
+	case "off":
+		return "", l
+	default:
+		return c.Schedule, l
+	}
+}
+
+// Paths the janitor works on.
+type Paths struct {
+	LogDir       string // rotated logs
+	UpdateLog    string
+	InstancesDir string // one file per running process, named by PID
+}
+
+// Report lists what a run did (or would do, for a dry run).
+type Report struct {
+	RemovedLogs      []string
+	UpdateLogTrimmed int64 // bytes
+	StalePIDs        []int
+}
+
+func (r Report) Empty() bool {
+	return len(r.RemovedLogs) == 0 && r.UpdateLogTrimmed == 0 && len(r.StalePIDs) == 0
+}
+
+// Run applies every rule, continuing past failures. Each action is logged
+// unless dryRun is set, log may be nil.
+func Run(p Paths, l Limits, now time.Time, dryRun bool, log *xlog.Logger) (Report, error) {
+	var r Report
+	var errs []error
+	logf := func(format string, v ...any) {
+		if log != nil && !dryRun {
+			log.Infof("janitor: "+format, v...)
+		}
+	}
+
+	var err error
+	if r.RemovedLogs, err = pruneLogs(p.LogDir, l.LogMaxAge, l.LogMaxFiles, now, dryRun); err != nil {
+		errs = append(errs, fmt.Errorf("failed to prune logs: %w", err))
+	}
+	for _, path := range r.RemovedLogs {
+		logf("removed old log %s", filepath.Base(path))
+	}
+
+	if l.UpdateLogMaxKiB >= 0 {
+		if r.UpdateLogTrimmed, err = trimHead(p.UpdateLog, int64(l.UpdateLogMaxKiB)<<10, now, dryRun); err != nil {
+			errs = append(errs, fmt.Errorf("failed to trim update log: %w", err))
+		} else if r.UpdateLogTrimmed > 0 {
+			logf("trimmed %d bytes from %s", r.UpdateLogTrimmed, filepath.Base(p.UpdateLog))
+		}
+	}
+
+	if r.StalePIDs, err = removeStalePIDs(p.InstancesDir, dryRun); err != nil {
+		errs = append(errs, fmt.Errorf("failed to clean instances dir: %w", err))
+	}
+	for _, pid := range r.StalePIDs {
+		logf("removed PID file of exited process %d", pid)
+	}
+
+	return r, errors.Join(errs...)
+}
+
+// pruneLogs removes rotated logs past maxAge or beyond the newest maxFiles.
+// Rotated names are timestamps so name order is age order.
+func pruneLogs(dir string, maxAge time.Duration, maxFiles int, now time.Time, dryRun bool) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var rotated []os.DirEntry
+	for _, e := range entries {
+		if !e.IsDir() && e.Name() != activeLog && strings.HasSuffix(e.Name(), ".log") {
+			rotated = append(rotated, e)
+		}
+	}
+	slices.Reverse(rotated) // newest first
+
+	var removed []string
+	var errs []error
+	for i, e := range rotated {
+		info, err := e.Info()
+		if err != nil {
+			continue // gone already
+		}
+		tooMany := maxFiles >= 0 && i >= maxFiles
+		tooOld := maxAge >= 0 && now.Sub(info.ModTime()) > maxAge
+		if !tooMany && !tooOld {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		if !dryRun {
+			if err := os.Remove(path); err != nil {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		removed = append(removed, path)
+	}
+	return removed, errors.Join(errs...)
+}
+
+// trimHead cuts path down to roughly its last max bytes, starting at a line
+// boundary, returning how many bytes were dropped. Recently written files are
+// left alone, the writer would keep appending to the replaced file.
+func trimHead(path string, max int64, now time.Time, dryRun bool) (int64, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	if info.Size() <= max || now.Sub(info.ModTime()) < quietFor {
+		return 0, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(info.Size()-max, io.SeekStart); err != nil {
+		return 0, err
+	}
+	tail, err := io.ReadAll(f)
+	if err != nil {
+		return 0, err
+	}
+	if i := bytes.IndexByte(tail, '\n'); i >= 0 {
+		tail = tail[i+1:]
+	}
+	dropped := info.Size() - int64(len(tail))
+	if dryRun {
+		return dropped, nil
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, tail, info.Mode().Perm()); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	return dropped, nil
+}
+
+// removeStalePIDs removes PID files of processes that no longer exist.
+func removeStalePIDs(dir string, dryRun bool) ([]int, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var removed []int
+	var errs []error
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || pid <= 0 || alive(pid) {
+			continue
+		}
+		if !dryRun {
+			if err := os.Remove(filepath.Join(dir, e.Name())); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, err)
+				continue
+			}
+		}
+		removed = append(removed, pid)
+	}
+	return removed, errors.Join(errs...)
+}
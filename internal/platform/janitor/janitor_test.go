@@ -0,0 +1,84 @@
+package janitor
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	p := Paths{
+		LogDir:       filepath.Join(dir, "logs"),
+		UpdateLog:    filepath.Join(dir, "update.log"),
+		InstancesDir: filepath.Join(dir, "instances"),
+	}
+	for _, d := range []string{p.LogDir, p.InstancesDir} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	write := func(path, data string, age time.Duration) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// rotated logs: 1 too old, 3 recent (one over the file limit), plus the active log
+	write(filepath.Join(p.LogDir, "20250101-000000.000000.log"), "x", 60*24*time.Hour)
+	write(filepath.Join(p.LogDir, "20250201-000000.000000.log"), "x", 3*time.Hour)
+	write(filepath.Join(p.LogDir, "20250202-000000.000000.log"), "x", 2*time.Hour)
+	write(filepath.Join(p.LogDir, "20250203-000000.000000.log"), "x", time.Hour)
+	write(filepath.Join(p.LogDir, activeLog), "x", 100*24*time.Hour)
+	write(p.UpdateLog, strings.Repeat("old line\n", 300)+"last line\n", 2*quietFor)
+	write(filepath.Join(p.InstancesDir, strconv.Itoa(os.Getpid())), "", 0)
+	write(filepath.Join(p.InstancesDir, "999999999"), "", 0) // beyond pid_max
+
+	limits := Limits{LogMaxAge: 30 * 24 * time.Hour, LogMaxFiles: 2, UpdateLogMaxKiB: 1}
+
+	dry, err := Run(p, limits, now, true, nil)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(p.LogDir, "20250101-000000.000000.log")); err != nil {
+		t.Errorf("dry run removed a file: %v", err)
+	}
+
+	r, err := Run(p, limits, now, false, nil)
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if len(r.RemovedLogs) != 2 || len(dry.RemovedLogs) != 2 {
+		t.Errorf("removed logs = %v (dry run %v), want the old one and the one over the limit", r.RemovedLogs, dry.RemovedLogs)
+	}
+	if _, err := os.Stat(filepath.Join(p.LogDir, activeLog)); err != nil {
+		t.Errorf("active log removed: %v", err)
+	}
+	if len(r.StalePIDs) != 1 || r.StalePIDs[0] != 999999999 {
+		t.Errorf("stale PIDs = %v, want [999999999]", r.StalePIDs)
+	}
+
+	data, err := os.ReadFile(p.UpdateLog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) > 1024 || !strings.HasPrefix(string(data), "old line\n") || !strings.HasSuffix(string(data), "last line\n") {
+		t.Errorf("update.log not trimmed at a line boundary: %d bytes, starts %q", len(data), string(data[:min(20, len(data))]))
+	}
+	if r.UpdateLogTrimmed != dry.UpdateLogTrimmed || r.UpdateLogTrimmed == 0 {
+		t.Errorf("trimmed %d bytes, dry run said %d", r.UpdateLogTrimmed, dry.UpdateLogTrimmed)
+	}
+
+	// second run has nothing left to do
+	if r, err := Run(p, limits, now, false, nil); err != nil || !r.Empty() {
+		t.Errorf("second run = %+v, %v, want empty", r, err)
+	}
+}
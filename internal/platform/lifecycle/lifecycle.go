@@ -0,0 +1,118 @@
+// Package lifecycle tracks service starts and stops in the config, which the
+// settings page uses to tell when a requested restart / update has finished.
+//
+// Only one instance counts starts (see [Claim]). Otherwise a second
+// `service run` would bump the counter and the page would report a restart
+// that didn't happen. Every instance but the migrator records its version
+// when it closes (see [RecordStop]), so the CLI running `update` leaves the
+// version the update started from.
+package lifecycle
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sprout/internal/platform/database/config"
+	"sprout/internal/platform/database/kv"
+	"sprout/internal/types"
+	"time"
+)
+
+const LockFileName = "lifecycle.lock"
+
+// The service counts as crash looping after CrashLoopStarts starts within
+// CrashLoopWindow, see [CrashLooping].
+const (
+	CrashLoopStarts = 3
+	CrashLoopWindow = 15 * time.Minute
+)
+
+// Tracker records starts for the instance holding the lifecycle lock.
+type Tracker struct {
+	db      kv.DB
+	version string
+	lock    *os.File
+}
+
+// Claim tries to become the tracking instance by taking an exclusive lock in
+// runtimeDir. It doesn't block, ok is false when another instance holds the lock.
+func Claim(db kv.DB, runtimeDir, version string) (t *Tracker, ok bool, err error) {
+	if err := os.MkdirAll(runtimeDir, 0o755); err != nil {
+		return nil, false, err
+	}
+	f, err := os.OpenFile(filepath.Join(runtimeDir, LockFileName), os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, false, err
+	}
+	locked, err := tryLock(f)
+	if err != nil || !locked {
+		_ = f.Close()
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to lock %s: %w", LockFileName, err)
+		}
+		return nil, false, nil
+	}
+	return &Tracker{db: db, version: version, lock: f}, true, nil
+}
+
+// RecordStart increments the start counter and returns the version recorded
+// by the last stop, in one transaction. updated reports whether that differs
+// from the running version, i.e. this start is the first after an update.
+func (t *Tracker) RecordStart() (previousVersion string, updated bool, err error) {
+	err = config.Update(t.db, func(cfg *types.Configuration) error {
+		cfg.StartCounter++
+		cfg.RecentStarts = append(cfg.RecentStarts, time.Now())
+		if n := len(cfg.RecentStarts); n > CrashLoopStarts {
+			cfg.RecentStarts = cfg.RecentStarts[n-CrashLoopStarts:]
+		}
+		previousVersion = cfg.PreUpdateVersion
+		updated = WasUpdated(cfg, t.version)
+		return nil
+	})
+	return previousVersion, updated, err
+}
+
+// RecordStop stores version as the one running at the last stop, so the next
+// start can tell if it was updated.
+func RecordStop(db kv.DB, version string) error {
+	return config.Update(db, func(cfg *types.Configuration) error {
+		cfg.PreUpdateVersion = version
+		return nil
+	})
+}
+
+// Release gives up the lifecycle lock.
+func (t *Tracker) Release() error {
+	return t.lock.Close()
+}
+
+// ExpectRestart resets the start counter before a requested restart, the
+// next [Tracker.RecordStart] then makes [WasRestarted] true.
+func ExpectRestart(db kv.DB) error {
+	return config.Update(db, func(cfg *types.Configuration) error {
+		cfg.StartCounter = 0
+		return nil
+	})
+}
+
+// WasRestarted reports whether the service started since [ExpectRestart].
+func WasRestarted(cfg *types.Configuration) bool {
+	return cfg.StartCounter > 0
+}
+
+// WasUpdated reports whether the version recorded at the last stop differs from version.
+func WasUpdated(cfg *types.Configuration, version string) bool {
+	return cfg.PreUpdateVersion != "" && cfg.PreUpdateVersion != version
+}
+
+// CrashLooping reports whether the service started [CrashLoopStarts] times
+// within [CrashLoopWindow] before now, e.g. systemd restarting it after crashes.
+func CrashLooping(cfg *types.Configuration, now time.Time) bool {
+	recent := 0
+	for _, t := range cfg.RecentStarts {
+		if now.Sub(t) < CrashLoopWindow {
+			recent++
+		}
+	}
+	return recent >= CrashLoopStarts
+}
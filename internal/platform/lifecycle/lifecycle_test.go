@@ -0,0 +1,79 @@
+package lifecycle
+
+import (
+	"sprout/internal/platform/database/config"
+	"sprout/internal/testsupport/dbtest"
+	"testing"
+	"time"
+)
+
+func TestClaim(t *testing.T) {
+	db := dbtest.Open(t)
+	dir := t.TempDir()
+
+	first, ok, err := Claim(db, dir, "v1.0.0")
+	if err != nil || !ok {
+		t.Fatalf("Claim() = %v, %v, want the lock", ok, err)
+	}
+	// held, a second instance doesn't track
+	if second, ok, err := Claim(db, dir, "v1.0.0"); err != nil || ok || second != nil {
+		t.Errorf("Claim() while held = %v, %v, %v, want not ok", second, ok, err)
+	}
+	if err := first.Release(); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	next, ok, err := Claim(db, dir, "v1.1.0")
+	if err != nil || !ok {
+		t.Fatalf("Claim() after Release = %v, %v, want the lock", ok, err)
+	}
+	defer next.Release()
+}
+
+func TestRecord(t *testing.T) {
+	db := dbtest.Open(t)
+	dir := t.TempDir()
+	start := func(version string) (string, bool) {
+		t.Helper()
+		tr, ok, err := Claim(db, dir, version)
+		if err != nil || !ok {
+			t.Fatalf("Claim(%s) = %v, %v", version, ok, err)
+		}
+		defer tr.Release()
+		prev, updated, err := tr.RecordStart()
+		if err != nil {
+			t.Fatalf("RecordStart: %v", err)
+		}
+		if err := RecordStop(db, version); err != nil {
+			t.Fatalf("RecordStop: %v", err)
+		}
+		return prev, updated
+	}
+
+	if prev, updated := start("v1.0.0"); prev != "" || updated {
+		t.Errorf("first start = %q, %v, want not updated", prev, updated)
+	}
+	if err := ExpectRestart(db); err != nil {
+		t.Fatalf("ExpectRestart: %v", err)
+	}
+	if prev, updated := start("v1.1.0"); prev != "v1.0.0" || !updated {
+		t.Errorf("start after an update = %q, %v, want updated from v1.0.0", prev, updated)
+	}
+	cfg, err := config.View(db)
+	if err != nil {
+		t.Fatalf("View: %v", err)
+	}
+	if !WasRestarted(cfg) || WasUpdated(cfg, "v1.1.0") || !WasUpdated(cfg, "v1.2.0") {
+		t.Errorf("after restart: counter %d, recorded %q", cfg.StartCounter, cfg.PreUpdateVersion)
+	}
+	if len(cfg.RecentStarts) != 2 || CrashLooping(cfg, time.Now()) {
+		t.Errorf("recent starts = %v, crash looping %v", cfg.RecentStarts, CrashLooping(cfg, time.Now()))
+	}
+	start("v1.1.0")
+	start("v1.1.0")
+	if cfg, _ = config.View(db); len(cfg.RecentStarts) != CrashLoopStarts || !CrashLooping(cfg, time.Now()) {
+		t.Errorf("after %d quick starts: recent %v, want crash looping", CrashLoopStarts+1, cfg.RecentStarts)
+	}
+	if CrashLooping(cfg, time.Now().Add(CrashLoopWindow)) {
+		t.Error("crash looping once the window passed")
+	}
+}
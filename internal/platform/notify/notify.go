@@ -0,0 +1,210 @@
+// Package notify provides a pluggable notification dispatcher.
+//
+// Event producers call [Dispatcher.Dispatch] and never need to know which
+// channels exist. Channels implement [Notifier] and are registered once at
+// startup. Which notifiers receive which events is decided by routing rules
+// (see [types.NotifyRoute]), read from the config on every dispatch so changes
+// take effect without a restart.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sync"
+	"time"
+
+	"sprout/internal/types"
+	"sprout/pkg/x"
+
+	"github.com/Data-Corruption/stdx/xlog"
+)
+
+const (
+	QueueSize       = 64               // max pending deliveries before new ones are dropped
+	Workers         = 4                // concurrent deliveries, so one slow webhook doesn't hold up the rest
+	DeliveryTimeout = 15 * time.Second // per attempt
+	MaxAttempts     = 3                // per delivery
+	DrainTimeout    = 5 * time.Second  // max time Close waits for pending deliveries
+)
+
+// Lifecycle event kinds.
+const (
+	EventServiceStarted   = "service.started"
+	EventServiceStopping  = "service.stopping"
+	EventConfigChanged    = "config.changed"
+	EventMigrationApplied = "migration.applied"
+	EventUpdateAvailable  = "update.available" // the update check found a newer version, once per version
+	EventUpdateApplied    = "update.applied"
+	EventUpdateFailed     = "update.failed" // a detached update failed, see app.RetryUpdate
+	EventStorageLow       = "storage.low"   // free space below the configured threshold
+	EventBackupCompleted  = "backup.completed"
+	EventBackupFailed     = "backup.failed"
+	EventCertRenewed      = "cert.renewed" // a new ACME certificate is served, see types.TLSConfig
+	EventCertFailed       = "cert.failed"  // renewing the ACME certificate failed, it's retried daily
+)
+
+// Event is a single notification. Kind is a dotted name (e.g. "update.available")
+// that routing rules match against.
+type Event struct {
+	Kind    string            `json:"kind"`
+	Title   string            `json:"title"`
+	Message string            `json:"message"`
+	Time    time.Time         `json:"time"`
+	Fields  map[string]string `json:"fields,omitempty"`
+}
+
+// Notifier is a notification channel (log, webhook, email, etc).
+type Notifier interface {
+	// Name is the identifier used in routing rules. Must be unique per dispatcher.
+	Name() string
+	// Notify delivers the event. Returning an error triggers a retry, unless it's x.Permanent.
+	Notify(ctx context.Context, ev Event) error
+}
+
+type delivery struct {
+	notifier Notifier
+	event    Event
+}
+
+// Dispatcher routes events to registered notifiers. Deliveries are queued and
+// performed by a small worker pool with retries, so Dispatch never blocks the caller.
+// Deliveries run concurrently, receivers shouldn't rely on arrival order (use Event.Time).
+type Dispatcher struct {
+	log       *xlog.Logger
+	routes    func() []types.NotifyRoute
+	mu        sync.RWMutex
+	notifiers map[string]Notifier
+	retry     x.RetryPolicy
+	pool      *x.Pool
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// New creates a dispatcher and starts its workers. routes is called on every
+// dispatch to get the current routing rules, it may be nil (route everything everywhere).
+func New(log *xlog.Logger, routes func() []types.NotifyRoute) *Dispatcher {
+	d := &Dispatcher{
+		log:       log,
+		routes:    routes,
+		notifiers: make(map[string]Notifier),
+		retry:     x.RetryPolicy{MaxAttempts: MaxAttempts},
+		pool:      x.NewPool(Workers, QueueSize),
+		done:      make(chan struct{}),
+	}
+	return d
+}
+
+// Register adds a notifier. Registering a name twice replaces the previous notifier.
+func (d *Dispatcher) Register(n Notifier) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.notifiers[n.Name()] = n
+}
+
+// Dispatch queues the event for every notifier its kind is routed to.
+// Safe to call on a nil dispatcher (no-op), which keeps producers simple in tests.
+func (d *Dispatcher) Dispatch(ev Event) {
+	if d == nil {
+		return
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now()
+	}
+	select {
+	case <-d.done:
+		return
+	default:
+	}
+
+	for _, n := range d.targets(ev.Kind) {
+		dl := delivery{notifier: n, event: ev}
+		if !d.pool.Submit(func() { d.deliver(dl) }) {
+			d.log.Warnf("notify: queue full, dropping %q for %s", ev.Kind, n.Name())
+		}
+	}
+}
+
+// Close stops accepting events and waits up to [DrainTimeout] for pending deliveries.
+func (d *Dispatcher) Close() error {
+	d.closeOnce.Do(func() {
+		close(d.done)
+		wait := make(chan struct{})
+		go func() {
+			d.pool.Close()
+			close(wait)
+		}()
+		select {
+		case <-wait:
+		case <-time.After(DrainTimeout):
+			d.log.Warn("notify: timed out draining queue, pending notifications dropped")
+		}
+	})
+	return nil
+}
+
+// targets resolves the notifiers an event kind is routed to.
+// With no rules configured, every registered notifier gets every event.
+func (d *Dispatcher) targets(kind string) []Notifier {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	var rules []types.NotifyRoute
+	if d.routes != nil {
+		rules = d.routes()
+	}
+	if len(rules) == 0 {
+		out := make([]Notifier, 0, len(d.notifiers))
+		for _, n := range d.notifiers {
+			out = append(out, n)
+		}
+		return out
+	}
+
+	seen := make(map[string]bool)
+	var out []Notifier
+	for _, rule := range rules {
+		if ok, _ := path.Match(rule.Event, kind); !ok {
+			continue
+		}
+		for _, name := range rule.Notifiers {
+			n, ok := d.notifiers[name]
+			if !ok || seen[name] {
+				continue
+			}
+			seen[name] = true
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+func (d *Dispatcher) deliver(dl delivery) {
+	var attempts int
+	err := x.Retry(context.Background(), d.retry, func(attempt int) error {
+		attempts = attempt
+		ctx, cancel := context.WithTimeout(context.Background(), DeliveryTimeout)
+		defer cancel()
+		return dl.notifier.Notify(ctx, dl.event)
+	})
+	if err != nil {
+		d.log.Errorf("notify: %s failed to deliver %q after %d attempts: %v", dl.notifier.Name(), dl.event.Kind, attempts, err)
+	}
+}
+
+// LogNotifier writes events to the application log. Always registered, handy
+// as a catch-all route and for seeing what other notifiers would receive.
+type LogNotifier struct {
+	Log *xlog.Logger
+}
+
+func (l *LogNotifier) Name() string { return "log" }
+
+func (l *LogNotifier) Notify(ctx context.Context, ev Event) error {
+	msg := ev.Title
+	if ev.Message != "" {
+		msg = fmt.Sprintf("%s: %s", ev.Title, ev.Message)
+	}
+	l.Log.Infof("[%s] %s", ev.Kind, msg)
+	return nil
+}
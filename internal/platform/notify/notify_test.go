@@ -0,0 +1,248 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sprout/internal/types"
+	"sprout/pkg/x"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Data-Corruption/stdx/xlog"
+)
+
+// recorder is a notifier that remembers what it received.
+type recorder struct {
+	name string
+	mu   sync.Mutex
+	got  []string
+}
+
+func (r *recorder) Name() string { return r.name }
+
+func (r *recorder) Notify(ctx context.Context, ev Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.got = append(r.got, ev.Kind)
+	return nil
+}
+
+func TestDispatcherRouting(t *testing.T) {
+	logger, err := xlog.New(filepath.Join(t.TempDir(), "logs"), "none")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	routes := []types.NotifyRoute{
+		{Event: "update.*", Notifiers: []string{"a"}},
+		{Event: "*", Notifiers: []string{"b"}},
+	}
+	d := New(logger, func() []types.NotifyRoute { return routes })
+	a, b := &recorder{name: "a"}, &recorder{name: "b"}
+	d.Register(a)
+	d.Register(b)
+
+	d.Dispatch(Event{Kind: EventUpdateApplied})
+	d.Dispatch(Event{Kind: EventServiceStarted})
+	d.Close()
+
+	if len(a.got) != 1 || a.got[0] != EventUpdateApplied {
+		t.Errorf("notifier a got %v, want [%s]", a.got, EventUpdateApplied)
+	}
+	if len(b.got) != 2 {
+		t.Errorf("notifier b got %v, want 2 events", b.got)
+	}
+}
+
+// flaky fails its first fails deliveries, permanently if permanent.
+type flaky struct {
+	fails     int
+	permanent bool
+	calls     atomic.Int32
+}
+
+func (f *flaky) Name() string { return "flaky" }
+
+func (f *flaky) Notify(ctx context.Context, ev Event) error {
+	if int(f.calls.Add(1)) <= f.fails {
+		err := errors.New("unavailable")
+		return x.Ternary(f.permanent, x.Permanent(err), err)
+	}
+	return nil
+}
+
+// gate blocks deliveries until it's opened, counting them.
+type gate struct {
+	started   chan struct{}
+	open      chan struct{}
+	delivered atomic.Int32
+}
+
+func (g *gate) Name() string { return "gate" }
+
+func (g *gate) Notify(ctx context.Context, ev Event) error {
+	g.started <- struct{}{}
+	<-g.open
+	g.delivered.Add(1)
+	return nil
+}
+
+func TestDispatcherRetries(t *testing.T) {
+	logger, err := xlog.New(filepath.Join(t.TempDir(), "logs"), "none")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	for _, tc := range []struct {
+		name string
+		n    *flaky
+		want int32
+	}{
+		{"recovers", &flaky{fails: MaxAttempts - 1}, MaxAttempts},
+		{"gives up", &flaky{fails: 100}, MaxAttempts},
+		{"permanent", &flaky{fails: 100, permanent: true}, 1},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			d := New(logger, nil)
+			d.retry.Initial = time.Millisecond
+			d.Register(tc.n)
+			d.Dispatch(Event{Kind: EventServiceStarted})
+			d.Close()
+			if got := tc.n.calls.Load(); got != tc.want {
+				t.Errorf("attempts = %d, want %d", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDispatcherQueueFull(t *testing.T) {
+	logger, err := xlog.New(filepath.Join(t.TempDir(), "logs"), "none")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	d := New(logger, nil)
+	g := &gate{started: make(chan struct{}, Workers), open: make(chan struct{})}
+	d.Register(g)
+	// every worker busy, then the queue full, then some more that don't fit
+	for range Workers {
+		d.Dispatch(Event{Kind: EventServiceStarted})
+	}
+	for range Workers {
+		<-g.started
+	}
+	for range QueueSize + 5 {
+		d.Dispatch(Event{Kind: EventServiceStarted})
+	}
+	go func() {
+		for range g.started {
+		}
+	}()
+	close(g.open)
+	d.Close()
+	close(g.started)
+	if got := g.delivered.Load(); got != Workers+QueueSize {
+		t.Errorf("delivered %d, want %d (the rest dropped)", got, Workers+QueueSize)
+	}
+}
+
+func TestDispatcherCloseDrains(t *testing.T) {
+	logger, err := xlog.New(filepath.Join(t.TempDir(), "logs"), "none")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	d := New(logger, nil)
+	g := &gate{started: make(chan struct{}, QueueSize), open: make(chan struct{})}
+	d.Register(g)
+	for range 10 {
+		d.Dispatch(Event{Kind: EventServiceStopping})
+	}
+	// pending deliveries finish before Close returns
+	time.AfterFunc(50*time.Millisecond, func() { close(g.open) })
+	d.Close()
+	if got := g.delivered.Load(); got != 10 {
+		t.Errorf("delivered %d before Close returned, want 10", got)
+	}
+	// nothing is accepted after
+	d.Dispatch(Event{Kind: EventServiceStarted})
+	d.Close()
+	if got := g.delivered.Load(); got != 10 {
+		t.Errorf("delivered %d after Close, want 10", got)
+	}
+}
+
+func TestWebhookSignature(t *testing.T) {
+	const secret = "hunter2"
+	var gotSig, gotEvent string
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotSig = r.Header.Get("X-Webhook-Signature-256")
+		gotEvent = r.Header.Get("X-Webhook-Event")
+		gotBody, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	wh := &WebhookNotifier{ID: "test", URL: srv.URL, Secret: secret, Instance: Instance{Name: "sprout"}}
+	if err := wh.Notify(context.Background(), Event{Kind: EventServiceStarted, Title: "Service started"}); err != nil {
+		t.Fatalf("Notify() failed: %v", err)
+	}
+
+	if gotEvent != EventServiceStarted {
+		t.Errorf("X-Webhook-Event = %q, want %q", gotEvent, EventServiceStarted)
+	}
+	if want := "sha256=" + Sign(secret, gotBody); gotSig != want {
+		t.Errorf("signature = %q, want %q", gotSig, want)
+	}
+	var payload webhookPayload
+	if err := json.Unmarshal(gotBody, &payload); err != nil {
+		t.Fatalf("Failed to unmarshal payload: %v", err)
+	}
+	if payload.Instance.Name != "sprout" {
+		t.Errorf("payload instance name = %q, want %q", payload.Instance.Name, "sprout")
+	}
+}
+
+func TestWebhookFormats(t *testing.T) {
+	var gotHeader http.Header
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHeader = r.Header
+		gotBody, _ = io.ReadAll(r.Body)
+	}))
+	defer srv.Close()
+
+	ev := Event{Kind: EventUpdateFailed, Title: "Update failed", Message: "exit status 1"}
+	inst := Instance{Name: "sprout", Version: "v1.0.0", Hostname: "web-1"}
+
+	slack := &WebhookNotifier{ID: "slack", URL: srv.URL, Format: FormatSlack, Instance: inst}
+	if err := slack.Notify(context.Background(), ev); err != nil {
+		t.Fatalf("Notify() failed: %v", err)
+	}
+	var msg struct{ Text string }
+	if err := json.Unmarshal(gotBody, &msg); err != nil {
+		t.Fatalf("Failed to unmarshal slack body: %v", err)
+	}
+	if want := "*Update failed* (sprout v1.0.0 on web-1)\nexit status 1"; msg.Text != want {
+		t.Errorf("slack text = %q, want %q", msg.Text, want)
+	}
+
+	ntfy := &WebhookNotifier{ID: "ntfy", URL: srv.URL, Format: FormatNtfy, Instance: inst}
+	if err := ntfy.Notify(context.Background(), ev); err != nil {
+		t.Fatalf("Notify() failed: %v", err)
+	}
+	if string(gotBody) != "exit status 1" || gotHeader.Get("Title") != "Update failed (sprout v1.0.0 on web-1)" || gotHeader.Get("Priority") != "high" {
+		t.Errorf("ntfy request = %q %v, want the message with title and high priority", gotBody, gotHeader)
+	}
+}
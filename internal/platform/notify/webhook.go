@@ -0,0 +1,143 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"sprout/internal/types"
+	"sprout/pkg/x"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Instance identifies the sender of a webhook, so receivers tracking many
+// installations can tell them apart.
+type Instance struct {
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	BaseURL  string `json:"baseURL"`
+	Hostname string `json:"hostname"`
+}
+
+// Webhook body formats, see WebhookNotifier.Format.
+const (
+	FormatJSON  = ""      // the event and instance as JSON
+	FormatSlack = "slack" // {"text": ...} for Slack style incoming webhooks (Slack, Mattermost, Rocket.Chat, ...)
+	FormatNtfy  = "ntfy"  // plain text message with ntfy's Title / Tags / Priority headers
+)
+
+// Formats are the valid webhook formats.
+var Formats = []string{FormatJSON, FormatSlack, FormatNtfy}
+
+func init() {
+	types.AddSchemaHint("webhooks.format", types.SchemaHint{Enum: Formats})
+	types.AddValidator(func(c *types.Configuration) (e types.FieldErrors) {
+		for i, wh := range c.Webhooks {
+			if !slices.Contains(Formats, wh.Format) {
+				e = append(e, types.FieldError{Field: "webhooks", Message: fmt.Sprintf("webhook %d: unknown format %q, want slack, ntfy or empty", i, wh.Format)})
+			}
+		}
+		return e
+	})
+}
+
+// WebhookNotifier POSTs events as JSON to a URL. When Secret is set, the body is
+// signed with HMAC-SHA256 and the hex digest sent as "X-Webhook-Signature-256: sha256=<digest>".
+// Receivers should recompute it over the raw body and compare in constant time.
+type WebhookNotifier struct {
+	ID       string // notifier name used in routing rules
+	URL      string
+	Secret   string
+	Format   string // body format, one of Formats
+	Instance Instance
+	Client   *http.Client // shared outbound client, nil = plain client with a 10s timeout
+}
+
+type webhookPayload struct {
+	Event
+	Instance Instance `json:"instance"`
+}
+
+func (w *WebhookNotifier) Name() string { return w.ID }
+
+func (w *WebhookNotifier) Notify(ctx context.Context, ev Event) error {
+	var body []byte
+	var err error
+	contentType := "application/json"
+	switch w.Format {
+	case FormatJSON:
+		body, err = json.Marshal(webhookPayload{Event: ev, Instance: w.Instance})
+	case FormatSlack:
+		body, err = json.Marshal(map[string]string{"text": fmt.Sprintf("*%s* (%s)\n%s", ev.Title, w.sender(), ev.Message)})
+	case FormatNtfy:
+		body, contentType = []byte(x.Ternary(ev.Message != "", ev.Message, ev.Kind)), "text/plain; charset=utf-8"
+	default:
+		return x.Permanent(fmt.Errorf("unknown webhook format %q", w.Format))
+	}
+	if err != nil {
+		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	if w.Format == FormatNtfy {
+		req.Header.Set("Title", ev.Title+" ("+w.sender()+")")
+		if strings.HasSuffix(ev.Kind, ".failed") || ev.Kind == EventStorageLow {
+			req.Header.Set("Tags", "warning")
+			req.Header.Set("Priority", "high")
+		}
+	}
+	req.Header.Set("X-Webhook-Event", ev.Kind)
+	req.Header.Set("X-Webhook-Timestamp", strconv.FormatInt(ev.Time.Unix(), 10))
+	if w.Secret != "" {
+		req.Header.Set("X-Webhook-Signature-256", "sha256="+Sign(w.Secret, body))
+	}
+
+	client := w.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10)) // allow connection reuse
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err := fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		// receiver rejected it (bad URL, signature, ...), resending the same payload won't help
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return x.Permanent(err)
+		}
+		return err
+	}
+	return nil
+}
+
+// sender names the instance in chat style messages, e.g. "sprout v1.2.0 on web-1".
+func (w *WebhookNotifier) sender() string {
+	s := strings.TrimSpace(w.Instance.Name + " " + w.Instance.Version)
+	if w.Instance.Hostname != "" {
+		s += " on " + w.Instance.Hostname
+	}
+	return s
+}
+
+// Sign returns the hex encoded HMAC-SHA256 of body using secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
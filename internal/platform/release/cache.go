@@ -0,0 +1,99 @@
+package release
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sprout/pkg/x"
+	"time"
+)
+
+// maxCachedBody bounds what's kept in a Cache, bigger responses are always
+// fetched in full.
+const maxCachedBody = 64 << 10
+
+// CacheEntry is a previous response to a release lookup.
+type CacheEntry struct {
+	ETag         string
+	LastModified string
+	Body         []byte
+}
+
+// Cache keeps release lookups (the version file, manifests) between checks,
+// so they can be made as conditional requests (If-None-Match /
+// If-Modified-Since) the server answers with an empty 304 when nothing was
+// released. Put is best effort, a lost entry only costs a full response.
+type Cache interface {
+	Get(url string) (CacheEntry, bool)
+	Put(url string, e CacheEntry)
+}
+
+// fetchCached is fetch with conditional requests when cache isn't nil: with
+// a previous response for url the server may answer 304 Not Modified, and the
+// cached body is returned. Responses without a validator aren't cached.
+func fetchCached(ctx context.Context, client *http.Client, cache Cache, url, token string, limit int64) ([]byte, error) {
+	// Create request with context
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	var prev CacheEntry
+	var cached bool
+	if cache != nil {
+		if prev, cached = cache.Get(url); cached {
+			if prev.ETag != "" {
+				req.Header.Set("If-None-Match", prev.ETag)
+			}
+			if prev.LastModified != "" {
+				req.Header.Set("If-Modified-Since", prev.LastModified)
+			}
+		}
+	}
+
+	// Execute request
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", path.Base(url), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified && cached {
+		return prev.Body, nil
+	}
+
+	// Check status code, client errors (bad release URL, etc.) won't fix themselves.
+	// Neither will a rate limit before it resets, the caller decides when to come back
+	if rl, ok := rateLimited(resp, time.Now()); ok {
+		return nil, x.Permanent(rl)
+	}
+	if resp.StatusCode != http.StatusOK {
+		err := fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		if resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return nil, x.Permanent(err)
+		}
+		return nil, err
+	}
+
+	// Read response body
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if int64(len(body)) > limit {
+		return nil, x.Permanent(fmt.Errorf("response body over %d bytes", limit))
+	}
+
+	if cache != nil && len(body) <= maxCachedBody {
+		e := CacheEntry{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified"), Body: body}
+		changed := !cached || e.ETag != prev.ETag || e.LastModified != prev.LastModified || !bytes.Equal(e.Body, prev.Body)
+		if (e.ETag != "" || e.LastModified != "") && changed {
+			cache.Put(url, e)
+		}
+	}
+	return body, nil
+}
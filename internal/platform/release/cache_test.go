@@ -0,0 +1,77 @@
+package release_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sprout/internal/platform/release"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type memCache map[string]release.CacheEntry
+
+func (m memCache) Get(url string) (release.CacheEntry, bool) { e, ok := m[url]; return e, ok }
+func (m memCache) Put(url string, e release.CacheEntry)      { m[url] = e }
+
+func TestConditionalVersionLookup(t *testing.T) {
+	version := "v1.2.0"
+	var full, notModified atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := `"` + version + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full.Add(1)
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(version + "\n"))
+	}))
+	defer srv.Close()
+
+	cache := memCache{}
+	src := &release.GenericReleaseSource{Cache: cache}
+	check := func(want string) {
+		t.Helper()
+		if v, err := src.GetLatestVersion(context.Background(), srv.URL+"/release/"); err != nil || v != want {
+			t.Fatalf("GetLatestVersion = %q, %v, want %q", v, err, want)
+		}
+	}
+
+	check("v1.2.0")
+	check("v1.2.0") // answered from the cache
+	if full.Load() != 1 || notModified.Load() != 1 {
+		t.Errorf("full = %d, not modified = %d, want 1 and 1", full.Load(), notModified.Load())
+	}
+	version = "v1.3.0"
+	check("v1.3.0")
+	if e := cache[srv.URL+"/release/version"]; e.ETag != `"v1.3.0"` {
+		t.Errorf("cached ETag = %q after a new release", e.ETag)
+	}
+}
+
+func TestRateLimitedLookup(t *testing.T) {
+	reset := time.Now().Add(30 * time.Minute).Truncate(time.Second)
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer srv.Close()
+
+	src := &release.GenericReleaseSource{}
+	_, err := src.GetLatestVersion(context.Background(), srv.URL+"/release/")
+	var rl *release.RateLimitError
+	if !errors.As(err, &rl) || !rl.Until.Equal(reset) {
+		t.Fatalf("GetLatestVersion = %v, want rate limited until %v", err, reset)
+	}
+	if requests.Load() != 1 {
+		t.Errorf("requests = %d, want 1 (no retries while rate limited)", requests.Load())
+	}
+}
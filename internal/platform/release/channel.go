@@ -0,0 +1,72 @@
+package release
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"golang.org/x/mod/semver"
+)
+
+// Update channels, most stable first. Stable is published at the release
+// URL itself (the layout from before channels existed), the others in a
+// subdirectory of the same flat layout, e.g. <releaseURL>beta/version.
+const (
+	ChannelStable  = "stable"
+	ChannelBeta    = "beta"
+	ChannelNightly = "nightly"
+)
+
+var Channels = []string{ChannelStable, ChannelBeta, ChannelNightly}
+
+// ValidChannel reports whether ch is a known channel, "" counts as stable.
+func ValidChannel(ch string) bool {
+	return ch == "" || slices.Contains(Channels, ch)
+}
+
+// ChannelURL returns the base URL a channel's releases are published under.
+func ChannelURL(releaseURL, channel string) string {
+	if channel == "" || channel == ChannelStable {
+		return releaseURL
+	}
+	return assetURL(releaseURL, channel) + "/"
+}
+
+// Latest is the newest release a channel follows and where it's published.
+type Latest struct {
+	Version string
+	Channel string
+}
+
+// ResolveLatest returns the highest version published on channel or any more
+// stable one, so e.g. a beta install moves on to a stable release once it
+// passes the latest beta. Channels that can't be reached are skipped as long
+// as one answers, a channel may simply not have been published yet.
+func ResolveLatest(ctx context.Context, src ReleaseSource, releaseURL, channel string) (Latest, error) {
+	if channel == "" {
+		channel = ChannelStable
+	}
+	i := slices.Index(Channels, channel)
+	if i < 0 {
+		return Latest{}, fmt.Errorf("unknown channel %q", channel)
+	}
+
+	var best Latest
+	var errs []error
+	for _, ch := range Channels[:i+1] {
+		v, err := src.GetLatestVersion(ctx, ChannelURL(releaseURL, ch))
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", ch, err))
+			continue
+		}
+		// ties go to the more stable channel
+		if best.Version == "" || semver.Compare(v, best.Version) > 0 {
+			best = Latest{Version: v, Channel: ch}
+		}
+	}
+	if best.Version == "" {
+		return Latest{}, errors.Join(errs...)
+	}
+	return best, nil
+}
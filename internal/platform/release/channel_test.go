@@ -0,0 +1,50 @@
+package release_test
+
+import (
+	"context"
+	"sprout/internal/platform/release"
+	"sprout/internal/testsupport/releasetest"
+	"sprout/pkg/x"
+	"testing"
+)
+
+func TestResolveLatest(t *testing.T) {
+	srv := releasetest.NewServer(t,
+		releasetest.Release{Version: "v1.2.0"},
+		releasetest.Release{Version: "v1.3.0-beta.1", Prerelease: true, Channel: release.ChannelBeta},
+	)
+	src := &release.GenericReleaseSource{}
+	resolve := func(channel string) release.Latest {
+		t.Helper()
+		l, err := release.ResolveLatest(context.Background(), src, srv.ReleaseURL(), channel)
+		if err != nil {
+			t.Fatalf("ResolveLatest(%q): %v", channel, err)
+		}
+		return l
+	}
+
+	if l := resolve(""); l != (release.Latest{Version: "v1.2.0", Channel: release.ChannelStable}) {
+		t.Errorf("stable = %+v", l)
+	}
+	if l := resolve(release.ChannelBeta); l != (release.Latest{Version: "v1.3.0-beta.1", Channel: release.ChannelBeta}) {
+		t.Errorf("beta = %+v", l)
+	}
+	// nothing published on nightly yet, falls back to what beta follows
+	if l := resolve(release.ChannelNightly); l.Version != "v1.3.0-beta.1" {
+		t.Errorf("nightly = %+v", l)
+	}
+
+	// the stable release passes the beta, beta installs move on to it
+	srv.Publish(releasetest.Release{Version: "v1.3.0"})
+	if l := resolve(release.ChannelBeta); l != (release.Latest{Version: "v1.3.0", Channel: release.ChannelStable}) {
+		t.Errorf("beta after stable release = %+v", l)
+	}
+
+	if _, err := release.ResolveLatest(context.Background(), src, srv.ReleaseURL(), "canary"); err == nil {
+		t.Error("expected error for unknown channel")
+	}
+	srv.Fail(500)
+	if _, err := release.ResolveLatest(context.Background(), &release.GenericReleaseSource{Retry: x.RetryPolicy{MaxAttempts: 1}}, srv.ReleaseURL(), release.ChannelBeta); err == nil {
+		t.Error("expected error when no channel answers")
+	}
+}
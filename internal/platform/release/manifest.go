@@ -0,0 +1,119 @@
+package release
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sprout/pkg/x"
+)
+
+// ManifestAsset is the file ManifestReleaseSource reads at a release URL
+// (and at each channel / version URL below it, see ChannelURL and VersionURL).
+const ManifestAsset = "manifest.json"
+
+// maxManifestSize bounds manifest downloads.
+const maxManifestSize = 1 << 20
+
+// ErrNotInManifest means the manifest doesn't list a requested asset.
+var ErrNotInManifest = errors.New("asset not listed in release manifest")
+
+// Manifest describes a release, e.g.
+//
+//	{"latest": "v1.2.3", "assets": {"linux-amd64.gz": "https://s3.example.com/b/linux-amd64.gz", ...}}
+//
+// Assets maps names (BinaryAsset, InstallScript, their ".sha256" and
+// ".minisig", VersionsAsset) to where they're downloaded from, either absolute
+// URLs or relative to the manifest.
+type Manifest struct {
+	Latest string            `json:"latest"`
+	Assets map[string]string `json:"assets"`
+}
+
+// ManifestReleaseSource implements ReleaseSource by reading a Manifest from
+// the release URL, so releases can be hosted anywhere that serves files over
+// HTTP(S) (S3, an internal mirror, ...) without the static layout.
+type ManifestReleaseSource struct {
+	Client *http.Client  // outbound client, nil = plain client with a 30s timeout
+	Retry  x.RetryPolicy // zero = 3 attempts starting at 500ms, bounded by ctx
+	Token  string        // bearer token for the manifests and assets on the same host, "" = none
+	Cache  Cache         // previous manifests for conditional requests, nil = always fetch in full
+}
+
+var (
+	_ ReleaseSource = (*ManifestReleaseSource)(nil)
+	_ AssetLocator  = (*ManifestReleaseSource)(nil)
+)
+
+func (m *ManifestReleaseSource) GetLatestVersion(ctx context.Context, releaseURL string) (string, error) {
+	mf, _, err := m.manifest(ctx, releaseURL)
+	if err != nil {
+		return "", err
+	}
+	return mf.Latest, nil
+}
+
+func (m *ManifestReleaseSource) GetAsset(ctx context.Context, releaseURL, name string) ([]byte, error) {
+	loc, err := m.AssetLocation(ctx, releaseURL, name)
+	if err != nil {
+		return nil, err
+	}
+	// assets elsewhere (e.g. presigned S3 URLs) must not see the token
+	token := ""
+	if sameHost(loc, releaseURL) {
+		token = m.Token
+	}
+	var data []byte
+	err = x.Retry(ctx, policyOrDefault(m.Retry), func(attempt int) error {
+		var err error
+		data, err = fetch(ctx, clientOrDefault(m.Client), loc, token, maxAssetSize)
+		return err
+	})
+	return data, err
+}
+
+// AssetLocation returns the absolute URL the manifest lists for name.
+func (m *ManifestReleaseSource) AssetLocation(ctx context.Context, releaseURL, name string) (string, error) {
+	mf, base, err := m.manifest(ctx, releaseURL)
+	if err != nil {
+		return "", err
+	}
+	ref, ok := mf.Assets[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrNotInManifest, name)
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL for %s in release manifest: %w", name, err)
+	}
+	return u.String(), nil
+}
+
+// manifest fetches and parses the manifest at releaseURL, also returning its
+// URL for resolving relative asset references.
+func (m *ManifestReleaseSource) manifest(ctx context.Context, releaseURL string) (Manifest, *url.URL, error) {
+	loc := assetURL(releaseURL, ManifestAsset)
+	base, err := url.Parse(loc)
+	if err != nil {
+		return Manifest{}, nil, fmt.Errorf("invalid release URL: %w", err)
+	}
+	var body []byte
+	err = x.Retry(ctx, policyOrDefault(m.Retry), func(attempt int) error {
+		var err error
+		body, err = fetchCached(ctx, clientOrDefault(m.Client), m.Cache, loc, m.Token, maxManifestSize)
+		return err
+	})
+	if err != nil {
+		return Manifest{}, nil, err
+	}
+	var mf Manifest
+	if err := json.Unmarshal(body, &mf); err != nil {
+		return Manifest{}, nil, fmt.Errorf("failed to parse release manifest: %w", err)
+	}
+	if mf.Latest == "" {
+		return Manifest{}, nil, errors.New("release manifest has no latest version")
+	}
+	return mf, base, nil
+}
@@ -0,0 +1,91 @@
+package release_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sprout/internal/platform/release"
+	"sprout/internal/testsupport/releasetest"
+	"sprout/pkg/x"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestManifestReleaseSource(t *testing.T) {
+	bin := []byte("binary 1.2.0")
+	srv := releasetest.NewServer(t,
+		releasetest.Release{Version: "v1.1.0", Assets: map[string][]byte{releasetest.BinaryAsset: []byte("binary 1.1.0")}},
+		releasetest.Release{Version: "v1.2.0", Assets: map[string][]byte{releasetest.BinaryAsset: bin}},
+	)
+	src := &release.ManifestReleaseSource{Retry: x.RetryPolicy{MaxAttempts: 1}}
+	ctx := context.Background()
+
+	v, err := src.GetLatestVersion(ctx, srv.ReleaseURL())
+	if err != nil || v != "v1.2.0" {
+		t.Fatalf("GetLatestVersion = %q, %v", v, err)
+	}
+	data, err := src.GetAsset(ctx, srv.ReleaseURL(), releasetest.BinaryAsset)
+	if err != nil || !bytes.Equal(data, bin) {
+		t.Fatalf("GetAsset = %q, %v", data, err)
+	}
+
+	// relative references resolve against the manifest, root-relative ones against its host
+	loc, err := src.AssetLocation(ctx, srv.ReleaseURL(), releasetest.BinaryAsset+".sha256")
+	if want := srv.ReleaseURL() + releasetest.BinaryAsset + ".sha256"; err != nil || loc != want {
+		t.Errorf("AssetLocation(.sha256) = %q, %v, want %q", loc, err, want)
+	}
+	loc, err = src.AssetLocation(ctx, srv.ReleaseURL(), releasetest.BinaryAsset)
+	if want := srv.URL + "/download/v1.2.0/" + releasetest.BinaryAsset; err != nil || loc != want {
+		t.Errorf("AssetLocation(binary) = %q, %v, want %q", loc, err, want)
+	}
+
+	// versions and per-version manifests work like the static layout
+	fCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if err := release.FindVersion(fCtx, src, srv.ReleaseURL(), "v1.1.0"); err != nil {
+		t.Errorf("FindVersion: %v", err)
+	}
+	if _, sum, err := release.FetchVerified(ctx, src, release.VersionURL(srv.ReleaseURL(), "v1.1.0"), releasetest.BinaryAsset); err != nil || sum != releasetest.Checksum([]byte("binary 1.1.0")) {
+		t.Errorf("FetchVerified(v1.1.0) = %s, %v", sum, err)
+	}
+
+	if _, err := src.GetAsset(ctx, srv.ReleaseURL(), "nope"); !errors.Is(err, release.ErrNotInManifest) {
+		t.Errorf("unlisted asset = %v, want ErrNotInManifest", err)
+	}
+	if _, err := src.GetLatestVersion(ctx, srv.URL+"/nothing/"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("missing manifest = %v, want a 404", err)
+	}
+}
+
+func TestManifestTokenStaysOnReleaseHost(t *testing.T) {
+	var elsewhereAuth string
+	elsewhere := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		elsewhereAuth = r.Header.Get("Authorization")
+		w.Write([]byte("binary"))
+	}))
+	defer elsewhere.Close()
+	host := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer s3cret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, `{"latest":"v1.0.0","assets":{%q:%q}}`, releasetest.BinaryAsset, elsewhere.URL+"/bin")
+	}))
+	defer host.Close()
+
+	src := &release.ManifestReleaseSource{Token: "s3cret", Retry: x.RetryPolicy{MaxAttempts: 1}}
+	if _, err := src.GetAsset(context.Background(), host.URL+"/release/", releasetest.BinaryAsset); err != nil {
+		t.Fatalf("GetAsset: %v", err)
+	}
+	if elsewhereAuth != "" {
+		t.Errorf("token sent to another host: %q", elsewhereAuth)
+	}
+	src.Token = ""
+	if _, err := src.GetLatestVersion(context.Background(), host.URL+"/release/"); err == nil {
+		t.Error("GetLatestVersion without token succeeded")
+	}
+}
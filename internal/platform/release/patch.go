@@ -0,0 +1,21 @@
+package release
+
+import "strings"
+
+// build.sh publishes bsdiff patches (see pkg/bspatch) from a few recent
+// versions next to the binary, so the native updater can download those
+// instead of the whole binary. The patched result is checked against the
+// uncompressed binary's checksum, see RawChecksumAsset.
+
+// PatchAsset is the patch turning version from's binary into the one
+// published as binaryAsset, e.g. "linux-amd64.from-v1.2.0.bsdiff".
+func PatchAsset(binaryAsset, from string) string {
+	return strings.TrimSuffix(binaryAsset, ".gz") + ".from-" + from + ".bsdiff"
+}
+
+// RawChecksumAsset is the checksum file (sha256sum format, signed like the
+// binary's) of the uncompressed binary published as binaryAsset, e.g.
+// "linux-amd64.sha256".
+func RawChecksumAsset(binaryAsset string) string {
+	return strings.TrimSuffix(binaryAsset, ".gz") + ".sha256"
+}
@@ -0,0 +1,42 @@
+package release
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// DefaultRateLimitWait is assumed when a rate limited response doesn't say
+// when the limit resets.
+const DefaultRateLimitWait = time.Hour
+
+// RateLimitError means the release host refused a request for exceeding its
+// rate limit, e.g. GitHub's 60 unauthenticated API requests an hour, shared
+// by every machine behind a CI runner's IP.
+type RateLimitError struct {
+	Until time.Time // when the limit resets
+}
+
+func (e *RateLimitError) Error() string {
+	return "rate limited by the release host until " + e.Until.Format(time.DateTime)
+}
+
+// rateLimited reports whether resp is a rate limit rejection: a 429, or a 403
+// with X-RateLimit-Remaining: 0 (GitHub, Gitea). The reset comes from
+// X-RateLimit-Reset (unix seconds) or Retry-After (seconds), else
+// [DefaultRateLimitWait].
+func rateLimited(resp *http.Response, now time.Time) (*RateLimitError, bool) {
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+	case resp.StatusCode == http.StatusForbidden && resp.Header.Get("X-RateLimit-Remaining") == "0":
+	default:
+		return nil, false
+	}
+	until := now.Add(DefaultRateLimitWait)
+	if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil && reset > 0 {
+		until = time.Unix(reset, 0)
+	} else if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && secs >= 0 {
+		until = now.Add(time.Duration(secs) * time.Second)
+	}
+	return &RateLimitError{Until: until}, true
+}
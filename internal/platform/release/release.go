@@ -3,8 +3,9 @@ package release
 import (
 	"context"
 	"fmt"
-	"io"
 	"net/http"
+	"net/url"
+	"sprout/pkg/x"
 	"strings"
 	"time"
 )
@@ -12,46 +13,122 @@ import (
 // ReleaseSource defines the interface for checking for updates.
 type ReleaseSource interface {
 	GetLatestVersion(ctx context.Context, releaseURL string) (string, error)
+	// GetAsset downloads a file published with the latest release (e.g.
+	// BinaryAsset or its ".sha256").
+	GetAsset(ctx context.Context, releaseURL, name string) ([]byte, error)
 }
 
+// AssetLocator is implemented by sources whose assets needn't live at the
+// release URL itself. The updater hands AssetLocation to the install script,
+// which otherwise downloads from the static layout under its RELEASE_URL.
+type AssetLocator interface {
+	AssetLocation(ctx context.Context, releaseURL, name string) (string, error)
+}
+
+// Release source kinds, see build.BuildInfo.ReleaseSource.
+const (
+	SourceStatic   = "static"   // GenericReleaseSource, the layout build.sh uploads
+	SourceManifest = "manifest" // ManifestReleaseSource
+)
+
+// BinaryAsset is the gzipped linux/amd64 binary build.sh publishes, with
+// BinaryAsset + ".sha256" holding its checksum in sha256sum format.
+const BinaryAsset = "linux-amd64.gz"
+
+// BinaryAssetFor is the name of the gzipped binary for goos / goarch, in the
+// same format as BinaryAsset. build.sh only publishes linux/amd64.
+func BinaryAssetFor(goos, goarch string) string {
+	return goos + "-" + goarch + ".gz"
+}
+
+// InstallScript is the installer build.sh publishes at the release URL, with
+// InstallScript + ".sha256" holding its checksum. The updater runs it.
+const InstallScript = "install.sh"
+
+// maxAssetSize bounds downloads, far above any real binary.
+const maxAssetSize = 512 << 20
+
+// TokenEnv is the environment variable holding the release token when it
+// isn't configured (see types.Configuration.ReleaseToken).
+const TokenEnv = "RELEASE_TOKEN"
+
 // GenericReleaseSource implements the ReleaseSource interface for generic platforms.
-type GenericReleaseSource struct{}
+type GenericReleaseSource struct {
+	Client *http.Client  // outbound client, nil = plain client with a 30s timeout
+	Retry  x.RetryPolicy // zero = 3 attempts starting at 500ms, bounded by ctx
+	Token  string        // sent as a bearer token, for private release hosts. "" = none
+	Cache  Cache         // previous version lookups for conditional requests, nil = always fetch in full
+}
 
 func (g *GenericReleaseSource) GetLatestVersion(ctx context.Context, releaseURL string) (string, error) {
-	return getLatestVersion(ctx, releaseURL)
+	var version string
+	err := x.Retry(ctx, g.policy(), func(attempt int) error {
+		var err error
+		version, err = getLatestVersion(ctx, g.client(), g.Cache, releaseURL, g.Token)
+		return err
+	})
+	return version, err
 }
 
-func getLatestVersion(ctx context.Context, releaseURL string) (string, error) {
-	// Construct the version URL by appending "version" to the release URL
-	versionURL := strings.TrimSuffix(releaseURL, "/") + "/version"
+func (g *GenericReleaseSource) GetAsset(ctx context.Context, releaseURL, name string) ([]byte, error) {
+	var data []byte
+	err := x.Retry(ctx, g.policy(), func(attempt int) error {
+		var err error
+		data, err = fetch(ctx, g.client(), assetURL(releaseURL, name), g.Token, maxAssetSize)
+		return err
+	})
+	return data, err
+}
 
-	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
+func (g *GenericReleaseSource) policy() x.RetryPolicy { return policyOrDefault(g.Retry) }
 
-	// Create request with context
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, versionURL, nil)
-	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
-	}
+func (g *GenericReleaseSource) client() *http.Client { return clientOrDefault(g.Client) }
 
-	// Execute request
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("failed to fetch version: %w", err)
+func policyOrDefault(p x.RetryPolicy) x.RetryPolicy {
+	if p == (x.RetryPolicy{}) {
+		return x.RetryPolicy{Initial: 500 * time.Millisecond}
 	}
-	defer resp.Body.Close()
+	return p
+}
 
-	// Check status code
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+func clientOrDefault(c *http.Client) *http.Client {
+	if c != nil {
+		return c
 	}
+	return &http.Client{Timeout: 30 * time.Second}
+}
+
+// StaticReleaseSource reports a fixed version as the latest without touching
+// the network. Used in dev mode, where update checks should be inert.
+type StaticReleaseSource struct {
+	Version string
+}
+
+func (s *StaticReleaseSource) GetLatestVersion(ctx context.Context, releaseURL string) (string, error) {
+	return s.Version, nil
+}
 
-	// Read response body
-	body, err := io.ReadAll(resp.Body)
+// GetAsset always fails, there is nothing published for a dev build.
+func (s *StaticReleaseSource) GetAsset(ctx context.Context, releaseURL, name string) ([]byte, error) {
+	return nil, fmt.Errorf("no published assets for %s", s.Version)
+}
+
+func assetURL(releaseURL, name string) string {
+	return strings.TrimSuffix(releaseURL, "/") + "/" + name
+}
+
+// sameHost reports whether URLs a and b have the same scheme and host, i.e.
+// whether a release token meant for one may be sent to the other.
+func sameHost(a, b string) bool {
+	ua, errA := url.Parse(a)
+	ub, errB := url.Parse(b)
+	return errA == nil && errB == nil && ua.Scheme == ub.Scheme && ua.Host == ub.Host
+}
+
+func getLatestVersion(ctx context.Context, client *http.Client, cache Cache, releaseURL, token string) (string, error) {
+	body, err := fetchCached(ctx, client, cache, assetURL(releaseURL, "version"), token, 1<<10)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response body: %w", err)
+		return "", err
 	}
 
 	// Trim whitespace and return
@@ -62,3 +139,9 @@ func getLatestVersion(ctx context.Context, releaseURL string) (string, error) {
 
 	return version, nil
 }
+
+// fetch GETs url, reading at most limit bytes of the body. A token is sent
+// as "Authorization: Bearer", which http.Client drops on redirects to other hosts.
+func fetch(ctx context.Context, client *http.Client, url, token string, limit int64) ([]byte, error) {
+	return fetchCached(ctx, client, nil, url, token, limit)
+}
@@ -0,0 +1,35 @@
+package release
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sprout/pkg/minisign"
+)
+
+// SignatureSuffix is appended to an asset name for its minisign signature.
+// build.sh signs InstallScript and BinaryAsset + ".sha256" when a signing key
+// is configured, the binary is covered through its checksum.
+const SignatureSuffix = ".minisig"
+
+// ErrBadSignature means an asset's signature doesn't verify with the build's
+// public key, the asset must not be used.
+var ErrBadSignature = errors.New("release signature verification failed")
+
+// VerifySignature checks data, the contents of asset name, against its
+// published signature using publicKey (see build.BuildInfo.SigningKey).
+// A missing signature is an error too, there's no falling back to unsigned.
+func VerifySignature(ctx context.Context, src ReleaseSource, releaseURL, name string, data []byte, publicKey string) error {
+	pk, err := minisign.ParsePublicKey(publicKey)
+	if err != nil {
+		return fmt.Errorf("invalid signing key in build: %w", err)
+	}
+	sig, err := src.GetAsset(ctx, releaseURL, name+SignatureSuffix)
+	if err != nil {
+		return fmt.Errorf("failed to get %s%s: %w", name, SignatureSuffix, err)
+	}
+	if err := pk.Verify(data, sig); err != nil {
+		return fmt.Errorf("%w (%s): %w", ErrBadSignature, name, err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package release
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+var (
+	// ErrNotLatest means the running version is no longer the published one.
+	// Only the latest release's assets are published, so there is nothing to
+	// compare against.
+	ErrNotLatest = errors.New("running version is not the latest release")
+	// ErrBadAsset means a published asset doesn't match its published
+	// checksum, the release itself (or the connection to it) can't be trusted.
+	ErrBadAsset = errors.New("published asset doesn't match its published checksum")
+)
+
+// Verification is the outcome of [VerifyBinary]. The published checksum
+// covers the gzipped asset, Expected is the sha256 of the binary inside it.
+type Verification struct {
+	Version   string `json:"version"`
+	Asset     string `json:"asset"`
+	Published string `json:"publishedSha256"` // of the .gz, from <asset>.sha256
+	Expected  string `json:"expectedSha256"`  // of the binary inside it
+	Actual    string `json:"actualSha256"`    // of the file on disk
+	Path      string `json:"path"`
+}
+
+// Match reports whether the binary on disk is the published one.
+func (v *Verification) Match() bool { return v.Expected == v.Actual }
+
+// VerifyBinary compares the file at exe against the binary published for
+// version. The published asset is first checked against its own checksum, the
+// same way install.sh does, then decompressed and hashed.
+func VerifyBinary(ctx context.Context, src ReleaseSource, releaseURL, version, exe string) (*Verification, error) {
+	latest, err := src.GetLatestVersion(ctx, releaseURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get latest version: %w", err)
+	}
+	if latest != version {
+		return nil, fmt.Errorf("%w (running %s, published %s)", ErrNotLatest, version, latest)
+	}
+
+	v := &Verification{Version: version, Asset: BinaryAsset, Path: exe}
+	gz, published, err := FetchVerified(ctx, src, releaseURL, BinaryAsset)
+	if err != nil {
+		return nil, err
+	}
+	v.Published = published
+	zr, err := gzip.NewReader(bytes.NewReader(gz))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress binary: %w", err)
+	}
+	if v.Expected, err = hashReader(zr); err != nil {
+		return nil, fmt.Errorf("failed to decompress binary: %w", err)
+	}
+
+	f, err := os.Open(exe)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open executable: %w", err)
+	}
+	defer f.Close()
+	if v.Actual, err = hashReader(f); err != nil {
+		return nil, fmt.Errorf("failed to read executable: %w", err)
+	}
+	return v, nil
+}
+
+// FetchVerified downloads the asset name and checks it against name+".sha256",
+// returning it and its checksum. A mismatch is [ErrBadAsset].
+func FetchVerified(ctx context.Context, src ReleaseSource, releaseURL, name string) ([]byte, string, error) {
+	sumFile, err := src.GetAsset(ctx, releaseURL, name+".sha256")
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get %s.sha256: %w", name, err)
+	}
+	var published string
+	if fields := strings.Fields(string(sumFile)); len(fields) > 0 {
+		published = strings.ToLower(fields[0])
+	}
+	if len(published) != sha256.Size*2 {
+		return nil, "", fmt.Errorf("malformed %s.sha256", name)
+	}
+
+	data, err := src.GetAsset(ctx, releaseURL, name)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to get %s: %w", name, err)
+	}
+	if sum := sha256.Sum256(data); hex.EncodeToString(sum[:]) != published {
+		return nil, "", fmt.Errorf("%w (%s)", ErrBadAsset, name)
+	}
+	return data, published, nil
+}
+
+func hashReader(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
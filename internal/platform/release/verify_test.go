@@ -0,0 +1,86 @@
+package release_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sprout/internal/platform/release"
+	"sprout/internal/testsupport/releasetest"
+	"testing"
+)
+
+func gzipped(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(data)
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestVerifyBinary(t *testing.T) {
+	bin := []byte("\x7fELF published binary")
+	srv := releasetest.NewServer(t, releasetest.Release{
+		Version: "v1.2.0",
+		Assets:  map[string][]byte{releasetest.BinaryAsset: gzipped(t, bin)},
+	})
+	src := &release.GenericReleaseSource{}
+	ctx := context.Background()
+
+	exe := filepath.Join(t.TempDir(), "sprout")
+	if err := os.WriteFile(exe, bin, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := release.VerifyBinary(ctx, src, srv.ReleaseURL(), "v1.2.0", exe)
+	if err != nil {
+		t.Fatalf("VerifyBinary: %v", err)
+	}
+	if !v.Match() {
+		t.Errorf("expected match, expected %s actual %s", v.Expected, v.Actual)
+	}
+	if v.Published != releasetest.Checksum(gzipped(t, bin)) {
+		t.Errorf("Published = %s", v.Published)
+	}
+
+	// tampered binary
+	if err := os.WriteFile(exe, append(bin, 0), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if v, err = release.VerifyBinary(ctx, src, srv.ReleaseURL(), "v1.2.0", exe); err != nil {
+		t.Fatalf("VerifyBinary: %v", err)
+	} else if v.Match() {
+		t.Error("expected mismatch for modified binary")
+	}
+
+	// older version, nothing published to compare against
+	if _, err := release.VerifyBinary(ctx, src, srv.ReleaseURL(), "v1.1.0", exe); !errors.Is(err, release.ErrNotLatest) {
+		t.Errorf("expected ErrNotLatest, got %v", err)
+	}
+
+	// asset not matching its own checksum
+	mock := &releasetest.MockReleaseSource{
+		LatestVersion: "v1.2.0",
+		Assets:        map[string][]byte{releasetest.BinaryAsset: gzipped(t, bin)},
+	}
+	bad := &badAsset{mock}
+	if _, err := release.VerifyBinary(ctx, bad, "", "v1.2.0", exe); !errors.Is(err, release.ErrBadAsset) {
+		t.Errorf("expected ErrBadAsset, got %v", err)
+	}
+}
+
+// badAsset serves a corrupted binary next to the original checksum.
+type badAsset struct{ *releasetest.MockReleaseSource }
+
+func (b *badAsset) GetAsset(ctx context.Context, releaseURL, name string) ([]byte, error) {
+	data, err := b.MockReleaseSource.GetAsset(ctx, releaseURL, name)
+	if name == releasetest.BinaryAsset && err == nil {
+		data = append(data[:len(data):len(data)], 0)
+	}
+	return data, err
+}
@@ -0,0 +1,55 @@
+package release
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"golang.org/x/mod/semver"
+)
+
+// VersionsAsset is the index build.sh appends every published version to,
+// one per line, at the root of the release URL. Each version's assets are
+// also kept in <releaseURL><version>/ so it can be installed later.
+const VersionsAsset = "versions"
+
+// ErrUnknownVersion means a version was never published.
+var ErrUnknownVersion = errors.New("version not published")
+
+// VersionURL returns the base URL a specific version's assets are kept under.
+func VersionURL(releaseURL, version string) string {
+	return assetURL(releaseURL, version) + "/"
+}
+
+// ListVersions returns every published version, oldest first. Lines that
+// aren't valid semver are skipped.
+func ListVersions(ctx context.Context, src ReleaseSource, releaseURL string) ([]string, error) {
+	data, err := src.GetAsset(ctx, releaseURL, VersionsAsset)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get version index: %w", err)
+	}
+	var versions []string
+	for _, line := range strings.Split(string(data), "\n") {
+		v := strings.TrimSpace(line)
+		if semver.IsValid(v) && !slices.Contains(versions, v) {
+			versions = append(versions, v)
+		}
+	}
+	slices.SortFunc(versions, semver.Compare)
+	return versions, nil
+}
+
+// FindVersion checks version was published, returning [ErrUnknownVersion]
+// if it's missing from the index.
+func FindVersion(ctx context.Context, src ReleaseSource, releaseURL, version string) error {
+	versions, err := ListVersions(ctx, src, releaseURL)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(versions, version) {
+		return fmt.Errorf("%w: %s", ErrUnknownVersion, version)
+	}
+	return nil
+}
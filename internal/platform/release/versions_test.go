@@ -0,0 +1,41 @@
+package release_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sprout/internal/platform/release"
+	"sprout/internal/testsupport/releasetest"
+	"testing"
+)
+
+func TestFindVersion(t *testing.T) {
+	srv := releasetest.NewServer(t,
+		releasetest.Release{Version: "v1.10.0"},
+		releasetest.Release{Version: "v1.2.0"},
+		releasetest.Release{Version: "v1.11.0-beta.1", Prerelease: true, Channel: release.ChannelBeta},
+	)
+	src := &release.GenericReleaseSource{}
+	ctx := context.Background()
+
+	versions, err := release.ListVersions(ctx, src, srv.ReleaseURL())
+	if err != nil {
+		t.Fatalf("ListVersions: %v", err)
+	}
+	if want := []string{"v1.2.0", "v1.10.0", "v1.11.0-beta.1"}; !slices.Equal(versions, want) {
+		t.Errorf("versions = %v, want %v", versions, want)
+	}
+
+	if err := release.FindVersion(ctx, src, srv.ReleaseURL(), "v1.2.0"); err != nil {
+		t.Errorf("FindVersion(v1.2.0): %v", err)
+	}
+	if err := release.FindVersion(ctx, src, srv.ReleaseURL(), "v1.3.0"); !errors.Is(err, release.ErrUnknownVersion) {
+		t.Errorf("FindVersion(v1.3.0) = %v, want ErrUnknownVersion", err)
+	}
+
+	// older versions stay installable from their own directory
+	v, err := src.GetLatestVersion(ctx, release.VersionURL(srv.ReleaseURL(), "v1.2.0"))
+	if err != nil || v != "v1.2.0" {
+		t.Errorf("version in v1.2.0/ = %q, %v", v, err)
+	}
+}
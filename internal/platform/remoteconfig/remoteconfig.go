@@ -0,0 +1,230 @@
+// Package remoteconfig pulls a config overlay from an HTTPS URL, so a fleet
+// of instances can be re-configured centrally without logging into each one
+// (see types.RemoteConfig).
+//
+// The overlay has the keys of the config file, as YAML or JSON, and is
+// signed with minisign: <url>.minisig must verify with the configured public
+// key (or the build's release signing key), there's no falling back to
+// unsigned. It's applied like `config import --merge`, recorded in the
+// history as config.SourceRemote, so a running service picks it up live
+// where it can. Pulls are conditional requests (If-None-Match /
+// If-Modified-Since): an unchanged overlay is an empty 304 and isn't applied
+// again, so a setting changed locally sticks until the overlay changes.
+// Flags, the environment and the config file still win, see config.Layers.
+// The overlay can't set remoteConfig itself, where it's pulled from and the
+// key it's verified with only change locally.
+package remoteconfig
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sprout/internal/platform/database/config"
+	"sprout/internal/platform/database/kv"
+	"sprout/internal/types"
+	"sprout/pkg/errs"
+	"sprout/pkg/minisign"
+	"time"
+)
+
+const (
+	// DefaultSchedule is when the service pulls with an empty schedule.
+	DefaultSchedule = "*/15 * * * *"
+	// SignatureSuffix is appended to the URL for the overlay's signature.
+	SignatureSuffix = ".minisig"
+
+	maxOverlay   = 1 << 20
+	maxSignature = 4 << 10
+)
+
+// ErrBadSignature means the overlay's signature doesn't verify, it's not
+// applied.
+var ErrBadSignature = errors.New("remote config signature verification failed")
+
+func init() {
+	types.AddValidator(func(c *types.Configuration) types.FieldErrors {
+		if key := c.RemoteConfig.PublicKey; key != "" {
+			if _, err := minisign.ParsePublicKey(key); err != nil {
+				return types.FieldErrors{{Field: "remoteConfig.publicKey", Message: err.Error()}}
+			}
+		}
+		return nil
+	})
+}
+
+// Schedule returns the cron expression the service pulls rc on.
+func Schedule(rc types.RemoteConfig) string {
+	if rc.Schedule == "" {
+		return DefaultSchedule
+	}
+	return rc.Schedule
+}
+
+// Result is what a Pull did.
+type Result struct {
+	URL         string
+	NotModified bool     // the server answered 304, nothing was applied
+	Changed     []string // keys of the settings the overlay changed
+}
+
+// Pull fetches the overlay at remoteConfig.url and applies it to db's
+// settings if its signature verifies with remoteConfig.publicKey, or
+// signingKey (build.BuildInfo.SigningKey) if that's empty. The outcome is
+// recorded in remoteConfigState, see `config remote status`. Fails with
+// errs.Invalid if there's no URL or no key, or the overlay has invalid
+// settings.
+func Pull(ctx context.Context, client *http.Client, db kv.DB, signingKey string) (*Result, error) {
+	cfg, err := config.View(db)
+	if err != nil {
+		return nil, err
+	}
+	rc, state := cfg.RemoteConfig, cfg.RemoteConfigState
+	if rc.URL == "" {
+		return nil, errs.New(errs.Invalid, "no remoteConfig.url set")
+	}
+	res := &Result{URL: rc.URL}
+	keyText := rc.PublicKey
+	if keyText == "" {
+		keyText = signingKey
+	}
+	if keyText == "" {
+		return nil, errs.New(errs.Invalid, "no key to verify the remote config with, set remoteConfig.publicKey")
+	}
+	key, err := minisign.ParsePublicKey(keyText)
+	if err != nil {
+		return nil, errs.Wrap(errs.Invalid, err, "invalid remoteConfig.publicKey")
+	}
+
+	next, err := pull(ctx, client, rc, state, key)
+	if err != nil {
+		state.Checked, state.LastError = time.Now().UTC(), err.Error()
+		if rerr := record(db, state); rerr != nil {
+			return nil, errors.Join(err, rerr)
+		}
+		return nil, err
+	}
+	if next.f == nil {
+		res.NotModified = true
+		next.state.Checked = time.Now().UTC()
+		return res, record(db, next.state)
+	}
+
+	err = config.UpdateFrom(db, config.SourceRemote, func(cfg *types.Configuration) error {
+		prev := *cfg // Import replaces the lists and maps it sets, prev keeps the old ones
+		if err := config.Import(cfg, next.f, true); err != nil {
+			return err
+		}
+		for _, c := range config.Diff(&prev, cfg) {
+			res.Changed = append(res.Changed, c.Key)
+		}
+		next.state.Checked = time.Now().UTC()
+		if len(res.Changed) > 0 {
+			next.state.Applied = next.state.Checked
+		}
+		cfg.RemoteConfigState = next.state
+		return nil
+	})
+	if err != nil {
+		// not recorded as pulled, the next pull fetches it in full and tries again
+		state.Checked, state.LastError = time.Now().UTC(), err.Error()
+		if rerr := record(db, state); rerr != nil {
+			return nil, errors.Join(err, rerr)
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+type pulled struct {
+	f     *config.File // nil if not modified
+	state types.RemoteConfigState
+}
+
+// pull fetches and verifies the overlay, nil File if it didn't change since
+// state.
+func pull(ctx context.Context, client *http.Client, rc types.RemoteConfig, state types.RemoteConfigState, key minisign.PublicKey) (*pulled, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rc.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if state.URL == rc.URL {
+		if state.ETag != "" {
+			req.Header.Set("If-None-Match", state.ETag)
+		}
+		if state.LastModified != "" {
+			req.Header.Set("If-Modified-Since", state.LastModified)
+		}
+	}
+	body, resp, err := get(client, req, rc.Token, maxOverlay)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotModified && state.URL == rc.URL {
+		state.LastError = ""
+		return &pulled{state: state}, nil
+	}
+
+	sigReq, err := http.NewRequestWithContext(ctx, http.MethodGet, rc.URL+SignatureSuffix, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	sig, _, err := get(client, sigReq, rc.Token, maxSignature)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the signature: %w", err)
+	}
+	if err := key.Verify(body, sig); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBadSignature, err)
+	}
+
+	f, err := config.ParseFile(rc.URL, body)
+	if err != nil {
+		return nil, err
+	}
+	// one bad overlay mustn't re-key or redirect every pull after it
+	if f.Sets("remoteConfig") {
+		return nil, errs.New(errs.Invalid, "the remote config can't change remoteConfig settings, they're local only")
+	}
+	return &pulled{f: f, state: types.RemoteConfigState{
+		URL:          rc.URL,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Applied:      state.Applied,
+	}}, nil
+}
+
+// get does req with token, returning the body of a 200 (at most limit
+// bytes) or a 304's response.
+func get(client *http.Client, req *http.Request, token types.Secret, limit int64) ([]byte, *http.Response, error) {
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+string(token))
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch remote config: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		return nil, resp, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if int64(len(body)) > limit {
+		return nil, nil, fmt.Errorf("response body over %d bytes", limit)
+	}
+	return body, resp, nil
+}
+
+// record stores state, changing no settings.
+func record(db kv.DB, state types.RemoteConfigState) error {
+	return config.Update(db, func(cfg *types.Configuration) error {
+		cfg.RemoteConfigState = state
+		return nil
+	})
+}
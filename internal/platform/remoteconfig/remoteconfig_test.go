@@ -0,0 +1,152 @@
+package remoteconfig
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sprout/internal/platform/database/config"
+	"sprout/internal/testsupport/dbtest"
+	"sprout/internal/testsupport/releasetest"
+	"sprout/internal/types"
+	"sprout/pkg/errs"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestPull(t *testing.T) {
+	signer := releasetest.NewSigner()
+	var mu sync.Mutex
+	overlay, etag := []byte("port: 9100\nbackup:\n  schedule: \"@daily\"\n"), `"v1"`
+	sig := signer.Sign(overlay)
+	var conditional []string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer hunter2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/fleet.yaml":
+			conditional = append(conditional, r.Header.Get("If-None-Match"))
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			w.Header().Set("ETag", etag)
+			w.Write(overlay)
+		case "/fleet.yaml" + SignatureSuffix:
+			w.Write(sig)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	serve := func(body string, signed bool, tag string) {
+		mu.Lock()
+		defer mu.Unlock()
+		overlay, etag = []byte(body), tag
+		if signed {
+			sig = signer.Sign(overlay)
+		}
+	}
+
+	db := dbtest.Open(t)
+	ctx := context.Background()
+	if _, err := Pull(ctx, srv.Client(), db, ""); !errs.Is(err, errs.Invalid) {
+		t.Errorf("Pull(no url) = %v, want invalid", err)
+	}
+	if err := config.Update(db, func(cfg *types.Configuration) error {
+		cfg.RemoteConfig = types.RemoteConfig{URL: srv.URL + "/fleet.yaml", Token: "hunter2"}
+		return nil
+	}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if _, err := Pull(ctx, srv.Client(), db, ""); !errs.Is(err, errs.Invalid) {
+		t.Errorf("Pull(no key) = %v, want invalid", err)
+	}
+
+	// the build's key verifies it when there's no configured one
+	res, err := Pull(ctx, srv.Client(), db, signer.PublicKey)
+	if err != nil {
+		t.Fatalf("Pull: %v", err)
+	}
+	if res.NotModified || !slices.Equal(res.Changed, []string{"port", "backup.schedule"}) {
+		t.Errorf("Pull() = %+v, want port and backup.schedule changed", res)
+	}
+	cfg, err := config.View(db)
+	if err != nil {
+		t.Fatalf("View: %v", err)
+	}
+	if cfg.Port != 9100 || cfg.Backup.Schedule != "@daily" || cfg.RemoteConfigState.ETag != `"v1"` || cfg.RemoteConfigState.Applied.IsZero() {
+		t.Errorf("after Pull: port %d, schedule %q, state %+v", cfg.Port, cfg.Backup.Schedule, cfg.RemoteConfigState)
+	}
+	if revs, err := config.History(db, 1); err != nil || len(revs) != 1 || revs[0].Source != config.SourceRemote {
+		t.Errorf("History() = %+v, %v, want a remote revision", revs, err)
+	}
+
+	// unchanged, a local change sticks
+	if err := config.Update(db, func(cfg *types.Configuration) error {
+		cfg.Port = 9200
+		return nil
+	}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if res, err = Pull(ctx, srv.Client(), db, signer.PublicKey); err != nil || !res.NotModified {
+		t.Errorf("Pull(unchanged) = %+v, %v, want not modified", res, err)
+	}
+	if cfg, _ = config.View(db); cfg.Port != 9200 {
+		t.Errorf("port after an unchanged pull = %d, want the local 9200", cfg.Port)
+	}
+	if want := []string{"", `"v1"`}; !slices.Equal(conditional, want) {
+		t.Errorf("If-None-Match sent = %q, want %q", conditional, want)
+	}
+
+	// a tampered overlay isn't applied, the error is recorded
+	serve("port: 9300\n", false, `"v2"`)
+	if _, err := Pull(ctx, srv.Client(), db, signer.PublicKey); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Pull(tampered) = %v, want bad signature", err)
+	}
+	if cfg, _ = config.View(db); cfg.Port != 9200 || !strings.Contains(cfg.RemoteConfigState.LastError, "signature") {
+		t.Errorf("after a tampered pull: port %d, state %+v", cfg.Port, cfg.RemoteConfigState)
+	}
+	// so are invalid settings, values the app records for itself and the
+	// remote config's own settings
+	for _, body := range []string{
+		"port: 0\n",
+		"startCounter: 5\n",
+		"remoteConfig:\n  url: https://evil.example/fleet.yaml\n",
+		"port: 9300\nremoteConfig:\n  publicKey: " + releasetest.NewSigner().PublicKey + "\n",
+	} {
+		serve(body, true, `"v3"`)
+		if _, err := Pull(ctx, srv.Client(), db, signer.PublicKey); !errs.Is(err, errs.Invalid) {
+			t.Errorf("Pull(%q) = %v, want invalid", body, err)
+		}
+	}
+	if cfg, _ = config.View(db); cfg.Port != 9200 || cfg.RemoteConfigState.ETag != `"v1"` || cfg.RemoteConfig.URL != srv.URL+"/fleet.yaml" || cfg.RemoteConfig.PublicKey != "" {
+		t.Errorf("after invalid pulls: port %d, remote config %+v, state %+v", cfg.Port, cfg.RemoteConfig, cfg.RemoteConfigState)
+	}
+
+	serve("port: 9400\n", true, `"v4"`)
+	if res, err = Pull(ctx, srv.Client(), db, signer.PublicKey); err != nil || !slices.Equal(res.Changed, []string{"port"}) {
+		t.Fatalf("Pull(changed) = %+v, %v", res, err)
+	}
+	if cfg, _ = config.View(db); cfg.Port != 9400 || cfg.RemoteConfigState.LastError != "" {
+		t.Errorf("after a changed pull: port %d, state %+v", cfg.Port, cfg.RemoteConfigState)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := types.DefaultConfig()
+	cfg.RemoteConfig = types.RemoteConfig{URL: "http://example.com/fleet.yaml", Schedule: "often", PublicKey: "nope"}
+	var fields []string
+	for _, e := range cfg.Validate() {
+		fields = append(fields, e.Field)
+	}
+	if want := []string{"remoteConfig.publicKey", "remoteConfig.schedule", "remoteConfig.url"}; !slices.Equal(fields, want) {
+		t.Errorf("Validate() fields = %v, want %v", fields, want)
+	}
+}
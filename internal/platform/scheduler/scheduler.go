@@ -0,0 +1,120 @@
+// Package scheduler runs background jobs on cron schedules inside the service.
+//
+// Each job runs on its own goroutine and never overlaps with itself, a run that
+// takes longer than the interval just delays the next one.
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sprout/pkg/cron"
+	"sync"
+	"time"
+
+	"github.com/Data-Corruption/stdx/xlog"
+)
+
+type JobFunc func(ctx context.Context) error
+
+type job struct {
+	name     string
+	schedule *cron.Schedule
+	fn       JobFunc
+
+	mu   sync.Mutex
+	next time.Time
+}
+
+// Scheduler holds jobs until Start, then runs them until Stop.
+type Scheduler struct {
+	log    *xlog.Logger
+	mu     sync.Mutex
+	jobs   []*job
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func New(log *xlog.Logger) *Scheduler {
+	return &Scheduler{log: log}
+}
+
+// Add registers a job. Must be called before Start.
+func (s *Scheduler) Add(name, spec string, fn JobFunc) error {
+	sched, err := cron.Parse(spec)
+	if err != nil {
+		return fmt.Errorf("job %s: %w", name, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs = append(s.jobs, &job{name: name, schedule: sched, fn: fn})
+	return nil
+}
+
+// Next returns when the named job runs next, zero if unknown or not started.
+func (s *Scheduler) Next(name string) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, j := range s.jobs {
+		if j.name == name {
+			j.mu.Lock()
+			defer j.mu.Unlock()
+			return j.next
+		}
+	}
+	return time.Time{}
+}
+
+// Start runs every registered job on its schedule.
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ctx context.Context
+	ctx, s.cancel = context.WithCancel(context.Background())
+	for _, j := range s.jobs {
+		s.wg.Add(1)
+		go s.loop(ctx, j)
+	}
+}
+
+// Stop cancels running jobs and waits for them to return. Returns an error for
+// use as an app cleanup.
+func (s *Scheduler) Stop() error {
+	s.mu.Lock()
+	cancel := s.cancel
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	s.wg.Wait()
+	return nil
+}
+
+func (s *Scheduler) loop(ctx context.Context, j *job) {
+	defer s.wg.Done()
+	for {
+		next := j.schedule.Next(time.Now())
+		if next.IsZero() {
+			s.log.Warnf("scheduler: %s (%s) never runs", j.name, j.schedule)
+			return
+		}
+		j.mu.Lock()
+		j.next = next
+		j.mu.Unlock()
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		start := time.Now()
+		s.log.Debugf("scheduler: running %s", j.name)
+		if err := j.fn(ctx); err != nil {
+			s.log.Errorf("scheduler: %s failed after %v: %v", j.name, time.Since(start).Round(time.Millisecond), err)
+		} else {
+			s.log.Debugf("scheduler: %s done in %v", j.name, time.Since(start).Round(time.Millisecond))
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Package selftest runs quick checks before the service reports ready, so a
+// broken install fails at startup with a message pointing at the cause rather
+// than mid-request with whatever error the first handler happens to hit.
+package selftest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sprout/internal/platform/database"
+	"sprout/internal/platform/database/kv"
+	"sprout/pkg/errs"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Check is one self-test step. Hint is appended to its error, telling the
+// user what to do about it.
+type Check struct {
+	Name string
+	Run  func() error
+	Hint string
+}
+
+// Run executes every check (they're cheap, and seeing all failures at once
+// saves restarts) and returns how long it took and an [errs.Unavailable]
+// error listing each failure, nil if all passed.
+func Run(checks []Check) (time.Duration, error) {
+	start := time.Now()
+	var failed []string
+	for _, c := range checks {
+		if err := c.Run(); err != nil {
+			msg := fmt.Sprintf("  %s: %v", c.Name, err)
+			if c.Hint != "" {
+				msg += "\n    " + c.Hint
+			}
+			failed = append(failed, msg)
+		}
+	}
+	if len(failed) > 0 {
+		return time.Since(start), errs.New(errs.Unavailable, "self-test failed:\n"+strings.Join(failed, "\n"))
+	}
+	return time.Since(start), nil
+}
+
+// SentinelKey prefixes the key DB writes to the config DBI, suffixed with the
+// PID so concurrent starts don't trip over each other.
+const SentinelKey = "selftest-"
+
+// DB writes, reads back, and deletes a sentinel key.
+func DB(db kv.DB) error {
+	key := []byte(SentinelKey + strconv.Itoa(os.Getpid()))
+	val := []byte(time.Now().Format(time.RFC3339Nano))
+	if err := db.Update(func(txn kv.Txn) error {
+		return txn.Put(*database.ConfigDBI, key, val)
+	}); err != nil {
+		return fmt.Errorf("write failed: %w", err)
+	}
+	if err := db.View(func(txn kv.Txn) error {
+		got, err := txn.Get(*database.ConfigDBI, key)
+		if err != nil {
+			return err
+		}
+		if !bytes.Equal(got, val) {
+			return fmt.Errorf("read back %q, wrote %q", got, val)
+		}
+		return nil
+	}); err != nil {
+		return fmt.Errorf("read failed: %w", err)
+	}
+	if err := db.Update(func(txn kv.Txn) error {
+		return txn.Delete(*database.ConfigDBI, key)
+	}); err != nil {
+		return fmt.Errorf("delete failed: %w", err)
+	}
+	return nil
+}
+
+// Render runs fn against a buffer, e.g. executing a template.
+func Render(fn func(w io.Writer) error) error {
+	var buf bytes.Buffer
+	if err := fn(&buf); err != nil {
+		return err
+	}
+	if buf.Len() == 0 {
+		return errors.New("rendered nothing")
+	}
+	return nil
+}
+
+// Why Port can't bind a port, see errors.Is.
+var (
+	ErrPortInUse      = errors.New("already in use")
+	ErrPortPrivileged = errors.New("privileged")
+)
+
+// Port checks the port can be bound by this user by briefly listening on it.
+// Fails with ErrPortInUse or ErrPortPrivileged, the latter telling how to
+// allow it.
+func Port(port int) error {
+	ln, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		switch {
+		case errors.Is(err, syscall.EADDRINUSE):
+			return fmt.Errorf("port %d is %w", port, ErrPortInUse)
+		case errors.Is(err, syscall.EACCES):
+			exe, _ := os.Executable()
+			return fmt.Errorf("port %d is %w, ports below %d need root or CAP_NET_BIND_SERVICE (e.g. `sudo setcap cap_net_bind_service=+ep %s`)", port, ErrPortPrivileged, UnprivilegedPortStart(), exe)
+		}
+		return err
+	}
+	return ln.Close()
+}
+
+// UnprivilegedPortStart returns the lowest port users can bind without
+// privileges (net.ipv4.ip_unprivileged_port_start), 1024 if unknown.
+func UnprivilegedPortStart() int {
+	b, err := os.ReadFile("/proc/sys/net/ipv4/ip_unprivileged_port_start")
+	if err != nil {
+		return 1024
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		return 1024
+	}
+	return n
+}
+
+// Writable checks a file can be created in dir.
+func Writable(dir string) error {
+	f, err := os.CreateTemp(dir, ".selftest-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
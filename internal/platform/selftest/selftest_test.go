@@ -0,0 +1,85 @@
+package selftest
+
+import (
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"sprout/internal/platform/database"
+	"sprout/internal/platform/database/kv"
+	"sprout/internal/testsupport/dbtest"
+	"strings"
+	"testing"
+)
+
+func TestChecks(t *testing.T) {
+	dir := t.TempDir()
+	db := dbtest.Open(t)
+
+	if err := DB(db); err != nil {
+		t.Errorf("DB: %v", err)
+	}
+	// sentinel is cleaned up
+	if err := db.View(func(txn kv.Txn) error {
+		cur, err := txn.Cursor(*database.ConfigDBI)
+		if err != nil {
+			return err
+		}
+		defer cur.Close()
+		for k, _, err := cur.First(); err == nil; k, _, err = cur.Next() {
+			if strings.HasPrefix(string(k), SentinelKey) {
+				t.Errorf("sentinel %q left behind", k)
+			}
+		}
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Writable(dir); err != nil {
+		t.Errorf("Writable: %v", err)
+	}
+	if err := Writable(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected error for missing dir")
+	}
+
+	ln, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	port := ln.Addr().(*net.TCPAddr).Port
+	if err := Port(port); !errors.Is(err, ErrPortInUse) || !strings.Contains(err.Error(), "in use") {
+		t.Errorf("expected port in use, got %v", err)
+	}
+	if n := UnprivilegedPortStart(); n < 0 || n > 65536 {
+		t.Errorf("UnprivilegedPortStart() = %d", n)
+	}
+
+	if err := Render(func(w io.Writer) error { return nil }); err == nil {
+		t.Error("expected error for empty render")
+	}
+}
+
+func TestRun(t *testing.T) {
+	if _, err := Run([]Check{{Name: "ok", Run: func() error { return nil }}}); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	_, err := Run([]Check{
+		{Name: "first", Run: func() error { return errors.New("boom") }, Hint: "fix first"},
+		{Name: "second", Run: func() error { return nil }},
+		{Name: "third", Run: func() error { return errors.New("bang") }},
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	msg := err.Error()
+	for _, want := range []string{"first: boom", "fix first", "third: bang"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("error %q missing %q", msg, want)
+		}
+	}
+	if strings.Contains(msg, "second") {
+		t.Errorf("passing check reported: %q", msg)
+	}
+}
@@ -0,0 +1,176 @@
+// Package storage measures disk usage of the storage dir and warns before the
+// volume fills up. LMDB fails writes on a full disk with errors that don't
+// point at the cause, so it's better to hear about it early.
+package storage
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sprout/internal/platform/notify"
+	"sprout/pkg/humanize"
+	"sync"
+	"time"
+
+	"github.com/Data-Corruption/stdx/xlog"
+)
+
+const (
+	CheckInterval      = 5 * time.Minute
+	DefaultWarnFreeMiB = 1024 // warn below this much free space, see Configuration.DiskFreeWarnMiB
+)
+
+// Subdirectories of the storage dir that are measured separately.
+var Dirs = []string{"db", "logs", "backups"}
+
+// Usage is a point in time measurement.
+type Usage struct {
+	Dirs       map[string]int64 `json:"dirs"` // bytes per entry of Dirs, missing dirs are 0
+	Total      int64            `json:"total"`
+	Free       int64            `json:"free"`       // bytes available to us on the volume
+	VolumeSize int64            `json:"volumeSize"` // bytes
+	MeasuredAt time.Time        `json:"measuredAt"`
+}
+
+// Measure walks the storage subdirectories and stats the volume they live on.
+func Measure(storageDir string) (*Usage, error) {
+	u := &Usage{Dirs: make(map[string]int64, len(Dirs)), MeasuredAt: time.Now()}
+	for _, name := range Dirs {
+		size, err := dirSize(filepath.Join(storageDir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to measure %s: %w", name, err)
+		}
+		u.Dirs[name] = size
+		u.Total += size
+	}
+	free, size, err := volumeSpace(storageDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat volume: %w", err)
+	}
+	u.Free, u.VolumeSize = free, size
+	return u, nil
+}
+
+// String formats the usage for CLI output, one line per dir plus the volume.
+func (u *Usage) String() string {
+	var s string
+	for _, name := range Dirs {
+		s += fmt.Sprintf("%-8s %s\n", name, humanize.Bytes(u.Dirs[name]))
+	}
+	return s + fmt.Sprintf("%-8s %s free of %s\n", "volume", humanize.Bytes(u.Free), humanize.Bytes(u.VolumeSize))
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil // missing dir (e.g. no backups yet) or file removed mid walk
+			}
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// Monitor measures usage every [CheckInterval] and dispatches a storage.low
+// event when free space drops below the threshold (once, until it recovers).
+type Monitor struct {
+	dir       string
+	warnBelow int64 // bytes, 0 = disabled
+	log       *xlog.Logger
+	notify    *notify.Dispatcher
+
+	mu     sync.RWMutex
+	latest *Usage
+	low    bool
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// NewMonitor creates a monitor. warnFreeMiB < 0 disables warnings, 0 = [DefaultWarnFreeMiB].
+func NewMonitor(storageDir string, warnFreeMiB int, log *xlog.Logger, n *notify.Dispatcher) *Monitor {
+	if warnFreeMiB == 0 {
+		warnFreeMiB = DefaultWarnFreeMiB
+	}
+	return &Monitor{
+		dir:       storageDir,
+		warnBelow: int64(max(warnFreeMiB, 0)) << 20,
+		log:       log,
+		notify:    n,
+	}
+}
+
+// Start measures once right away, then every [CheckInterval] until Stop.
+func (m *Monitor) Start() {
+	m.stop, m.done = make(chan struct{}), make(chan struct{})
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(CheckInterval)
+		defer ticker.Stop()
+		for {
+			m.Check()
+			select {
+			case <-m.stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop ends the background checks. Returns an error for use as an app cleanup.
+func (m *Monitor) Stop() error {
+	if m.stop != nil {
+		close(m.stop)
+		<-m.done
+	}
+	return nil
+}
+
+// Latest returns the last measurement, nil before the first one.
+func (m *Monitor) Latest() *Usage {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.latest
+}
+
+// Check measures now and warns if free space crossed below the threshold.
+func (m *Monitor) Check() {
+	u, err := Measure(m.dir)
+	if err != nil {
+		m.log.Errorf("storage: %v", err)
+		return
+	}
+	m.mu.Lock()
+	m.latest = u
+	wasLow := m.low
+	m.low = m.warnBelow > 0 && u.Free < m.warnBelow
+	nowLow := m.low
+	m.mu.Unlock()
+
+	m.log.Debugf("storage: db %s, logs %s, backups %s, %s free",
+		humanize.Bytes(u.Dirs["db"]), humanize.Bytes(u.Dirs["logs"]), humanize.Bytes(u.Dirs["backups"]), humanize.Bytes(u.Free))
+	switch {
+	case nowLow && !wasLow:
+		msg := fmt.Sprintf("%s free on the storage volume, below %s. Database writes fail once it's full.", humanize.Bytes(u.Free), humanize.Bytes(m.warnBelow))
+		m.log.Warn("storage: " + msg)
+		m.notify.Dispatch(notify.Event{
+			Kind:    notify.EventStorageLow,
+			Title:   "Disk space low",
+			Message: msg,
+			Fields:  map[string]string{"free": fmt.Sprint(u.Free), "threshold": fmt.Sprint(m.warnBelow), "dir": m.dir},
+		})
+	case wasLow && !nowLow:
+		m.log.Infof("storage: free space recovered, %s free", humanize.Bytes(u.Free))
+	}
+}
@@ -0,0 +1,38 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMeasure(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, size int) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("db/data.mdb", 4096)
+	write("logs/a.log", 100)
+	write("logs/old/b.log", 50)
+	write("unrelated.txt", 999) // outside the measured dirs
+
+	u, err := Measure(dir)
+	if err != nil {
+		t.Fatalf("Measure: %v", err)
+	}
+	if u.Dirs["db"] != 4096 || u.Dirs["logs"] != 150 || u.Dirs["backups"] != 0 {
+		t.Errorf("dirs = %v, want db 4096, logs 150, backups 0", u.Dirs)
+	}
+	if u.Total != 4246 {
+		t.Errorf("total = %d, want 4246", u.Total)
+	}
+	if u.Free <= 0 || u.VolumeSize < u.Free {
+		t.Errorf("free %d / volume %d don't add up", u.Free, u.VolumeSize)
+	}
+}
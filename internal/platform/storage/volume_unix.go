@@ -0,0 +1,15 @@
+//go:build unix
+
+package storage
+
+import "golang.org/x/sys/unix"
+
+// volumeSpace returns the bytes available to us and the size of the volume
+// dir is on.
+func volumeSpace(dir string) (free, size int64, err error) {
+	var st unix.Statfs_t
+	if err := unix.Statfs(dir, &st); err != nil {
+		return 0, 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), int64(st.Blocks) * int64(st.Bsize), nil
+}
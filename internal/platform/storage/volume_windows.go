@@ -0,0 +1,17 @@
+package storage
+
+import "golang.org/x/sys/windows"
+
+// volumeSpace returns the bytes available to us (quotas included) and the
+// size of the volume dir is on.
+func volumeSpace(dir string) (free, size int64, err error) {
+	path, err := windows.UTF16PtrFromString(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+	var avail, total, totalFree uint64
+	if err := windows.GetDiskFreeSpaceEx(path, &avail, &total, &totalFree); err != nil {
+		return 0, 0, err
+	}
+	return int64(avail), int64(total), nil
+}
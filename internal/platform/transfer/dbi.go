@@ -0,0 +1,124 @@
+package transfer
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sprout/internal/platform/database"
+	"sprout/internal/platform/database/kv"
+	"sprout/pkg/errs"
+	"time"
+
+	"github.com/Data-Corruption/stdx/xlog"
+)
+
+// DBIHeader is the first line of a single DBI export (`db export-dbi`), for
+// running a heavy data transform out of process instead of as a migration
+// in one write transaction. The entries follow as JSON lines in the shape of
+// Version, decrypted:
+//
+//	{"format": 1, "app": "sprout", "dbi": "widgets", "version": "v2", ...}
+//	{"key": "a", "value": {...}}
+//	...
+//
+// A transform rewrites the entries to a later version's shape and sets
+// Version to it, ImportDBI then runs only the migrations after that.
+type DBIHeader struct {
+	Format    int       `json:"format"`
+	App       string    `json:"app"`
+	DBI       string    `json:"dbi"`
+	Version   string    `json:"version"` // migration the entries' shape matches, see database.TxnDBIVersion
+	CreatedAt time.Time `json:"createdAt"`
+	Entries   int       `json:"-"` // counted by ExportDBI / ImportDBI, the stream has no trailer
+}
+
+// ExportDBI writes the DBI h.DBI from a single read transaction to w. Like
+// [Export], h supplies the descriptive fields, Format / Version / Entries are
+// filled in. Values are written decrypted, unlike the other exports.
+func ExportDBI(db kv.DB, w io.Writer, h DBIHeader) (*DBIHeader, error) {
+	if h.DBI == database.ConfigDBI.Name() {
+		return nil, errs.New(errs.Invalid, "config holds the migration state, it's only exported whole (export-all)")
+	}
+	h.Format = Format
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+	err := db.View(func(txn kv.Txn) error {
+		var err error
+		if h.Version, err = database.TxnDBIVersion(txn, h.DBI); err != nil {
+			return err
+		}
+		if err := enc.Encode(h); err != nil {
+			return fmt.Errorf("failed to write header: %w", err)
+		}
+		return database.TxnRawList(txn, h.DBI, nil, 0, func(k, v []byte) error {
+			if err := enc.Encode(newEntry(k, v)); err != nil {
+				return fmt.Errorf("failed to write entry: %w", err)
+			}
+			h.Entries++
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &h, bw.Flush()
+}
+
+// ImportDBI replaces the contents of one DBI with an ExportDBI stream read
+// from r (possibly transformed since), marks them as being at the header's
+// version and migrates from there, all in one write transaction. check is
+// called with the header before anything is written, an error from it
+// aborts the import. DBIs without migrations of their own follow the core
+// schema, their export must be at the database's current version (use
+// Export / Import across schema versions).
+func ImportDBI(db kv.DB, r io.Reader, log *xlog.Logger, check func(*DBIHeader) error) (*DBIHeader, error) {
+	dec := json.NewDecoder(bufio.NewReader(r))
+	var h DBIHeader
+	if err := dec.Decode(&h); err != nil {
+		return nil, fmt.Errorf("not a DBI export: %w", err)
+	}
+	if h.Format != Format {
+		return nil, fmt.Errorf("unsupported export format %d, this build reads %d", h.Format, Format)
+	}
+	if h.DBI == database.ConfigDBI.Name() {
+		return nil, errs.New(errs.Invalid, "config holds the migration state, it's only imported whole (import-all)")
+	}
+	dbi, ok := db.DBIs()[h.DBI]
+	if !ok {
+		return nil, errs.New(errs.Invalid, fmt.Sprintf("export has unknown DBI %q, was it made by a newer version?", h.DBI))
+	}
+	if check != nil {
+		if err := check(&h); err != nil {
+			return nil, err
+		}
+	}
+
+	err := db.Update(func(txn kv.Txn) error {
+		if err := txn.Clear(dbi); err != nil {
+			return fmt.Errorf("failed to clear %s: %w", h.DBI, err)
+		}
+		for n := 2; dec.More(); n++ {
+			var e Entry
+			if err := dec.Decode(&e); err != nil {
+				return fmt.Errorf("line %d: %w", n, err)
+			}
+			if err := database.TxnRawPut(txn, h.DBI, e.key(), e.value()); err != nil {
+				return fmt.Errorf("line %d: %w", n, err)
+			}
+			h.Entries++
+		}
+
+		if err := database.TxnSetDBIVersion(txn, h.DBI, h.Version); err != nil {
+			return err
+		}
+		if _, _, err := database.MigrateTxn(txn, log); err != nil {
+			return fmt.Errorf("failed to migrate imported data: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
@@ -0,0 +1,74 @@
+package transfer
+
+import (
+	"bytes"
+	"sprout/internal/platform/database"
+	"sprout/internal/platform/database/kv"
+	"sprout/pkg/errs"
+	"strings"
+	"testing"
+	"time"
+)
+
+var gadgetsDBI = database.Register("test-gadgets",
+	database.DBIMigration{ID: "v1", Desc: "seed", Up: func(txn kv.Txn, dbi kv.DBI) error {
+		return database.TxnPut(txn, dbi, []byte("a"), 1)
+	}},
+	database.DBIMigration{ID: "v2", Desc: "mark", Up: func(txn kv.Txn, dbi kv.DBI) error {
+		return database.TxnPut(txn, dbi, []byte("v2"), true)
+	}},
+)
+
+func TestExportImportDBI(t *testing.T) {
+	src, _ := openDB(t)
+	var buf bytes.Buffer
+	h, err := ExportDBI(src, &buf, DBIHeader{App: "sprout", DBI: "test-gadgets", CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("ExportDBI: %v", err)
+	}
+	if h.Version != "v2" || h.Entries != 2 {
+		t.Errorf("header = %+v, want v2 and 2 entries", h)
+	}
+
+	// transformed out of process into v1's shape, v2 runs again on import
+	var out strings.Builder
+	for i, line := range strings.SplitAfter(buf.String(), "\n") {
+		switch {
+		case i == 0:
+			line = strings.Replace(line, `"version":"v2"`, `"version":"v1"`, 1)
+		case strings.Contains(line, `"key":"a"`):
+			line = `{"key":"a","value":10}` + "\n"
+		case strings.Contains(line, `"key":"v2"`):
+			continue
+		}
+		out.WriteString(line)
+	}
+
+	dst, log := openDB(t)
+	if _, err := ImportDBI(dst, strings.NewReader(out.String()), log, nil); err != nil {
+		t.Fatalf("ImportDBI: %v", err)
+	}
+	if a, err := database.View[int](dst, *gadgetsDBI, []byte("a")); err != nil || *a != 10 {
+		t.Errorf("a = %v, %v, want the transformed 10", a, err)
+	}
+	if _, err := database.View[bool](dst, *gadgetsDBI, []byte("v2")); err != nil {
+		t.Errorf("v2 didn't run after the import: %v", err)
+	}
+
+	// DBIs following the core schema must be at its version
+	buf.Reset()
+	if _, err := ExportDBI(src, &buf, DBIHeader{App: "sprout", DBI: "httplog"}); err != nil {
+		t.Fatalf("ExportDBI httplog: %v", err)
+	}
+	if _, err := ImportDBI(dst, bytes.NewReader(buf.Bytes()), log, nil); err != nil {
+		t.Errorf("ImportDBI httplog: %v", err)
+	}
+	older := strings.Replace(buf.String(), `"version":"v1"`, `"version":"v0"`, 1)
+	if _, err := ImportDBI(dst, strings.NewReader(older), log, nil); !errs.Is(err, errs.Invalid) {
+		t.Errorf("ImportDBI of httplog at another schema = %v, want invalid", err)
+	}
+
+	if _, err := ExportDBI(src, &buf, DBIHeader{DBI: "config"}); !errs.Is(err, errs.Invalid) {
+		t.Errorf("ExportDBI config = %v, want invalid", err)
+	}
+}
@@ -0,0 +1,92 @@
+package transfer
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"sprout/internal/platform/database"
+	"sprout/internal/platform/database/kv"
+
+	"github.com/Data-Corruption/stdx/xlog"
+)
+
+// Dump is an export as a single indented JSON document, for inspecting or
+// editing data in a text editor (`db export` / `db import`). It's held in
+// memory whole, prefer the archive for large databases.
+//
+//	{
+//	  "format": 1, "app": "sprout", ...
+//	  "dbis": {
+//	    "config": [{"key": "config", "value": {...}}, ...],
+//	    ...
+//	  }
+//	}
+type Dump struct {
+	Header
+	DBIs map[string][]Entry `json:"dbis"`
+}
+
+// ExportJSON writes every registered DBI from a single read transaction to w
+// as a [Dump]. Like [Export], h supplies the descriptive fields.
+func ExportJSON(db kv.DB, w io.Writer, h Header) (*Header, error) {
+	d := Dump{DBIs: map[string][]Entry{}}
+	for _, name := range database.DBINameList() {
+		d.DBIs[name] = []Entry{} // empty ones show as []
+	}
+	if err := readDBIs(db, &h, func(name string, e Entry) error {
+		d.DBIs[name] = append(d.DBIs[name], e)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	d.Header = h
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(d); err != nil {
+		return nil, fmt.Errorf("failed to write dump: %w", err)
+	}
+	return &h, nil
+}
+
+// ImportJSON is [Import] for a [Dump]. Values are compacted again, so
+// reindenting them while editing doesn't change what's stored.
+func ImportJSON(db kv.DB, r io.Reader, log *xlog.Logger, check func(*Header) error) (*Header, error) {
+	var d Dump
+	if err := json.NewDecoder(r).Decode(&d); err != nil {
+		return nil, fmt.Errorf("not a JSON dump: %w", err)
+	}
+	if d.Format != Format {
+		return nil, fmt.Errorf("unsupported export format %d, this build reads %d", d.Format, Format)
+	}
+	if check != nil {
+		if err := check(&d.Header); err != nil {
+			return nil, err
+		}
+	}
+
+	err := replaceDBIs(db, log, func(put func(name string, e Entry) error) error {
+		for _, name := range slices.Sorted(maps.Keys(d.DBIs)) {
+			for i, e := range d.DBIs[name] {
+				if e.Value != nil {
+					var buf bytes.Buffer
+					if err := json.Compact(&buf, e.Value); err != nil {
+						return fmt.Errorf("%s entry %d: %w", name, i, err)
+					}
+					e.Value = buf.Bytes()
+				}
+				if err := put(name, e); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &d.Header, nil
+}
@@ -0,0 +1,270 @@
+// Package transfer exports all data to a portable archive and imports it
+// again, for moving an installation to another machine or service layout.
+//
+// Unlike a backup (a raw copy of the data file, tied to the storage backend
+// and the page size of the machine that wrote it) an export holds every
+// registered DBI as JSON lines, so it survives architecture and backend
+// changes and is inspectable by hand:
+//
+//	<name>-export-20250102-030000.tar.gz
+//	├── export.json        # Header: format, app / schema version, source storage dir
+//	└── dbi/
+//	    ├── config.jsonl   # one Entry per line
+//	    └── ...
+package transfer
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"sprout/internal/platform/database"
+	"sprout/internal/platform/database/kv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Data-Corruption/stdx/xlog"
+)
+
+const (
+	Format     = 1 // bumped on incompatible layout changes
+	HeaderName = "export.json"
+	dbiDir     = "dbi/"
+)
+
+// Header describes an export.
+type Header struct {
+	Format        int            `json:"format"`
+	App           string         `json:"app"`
+	Version       string         `json:"version"`
+	SchemaVersion string         `json:"schemaVersion"`
+	StorageDir    string         `json:"storageDir"` // of the source, so paths under it can be rewritten on import
+	CreatedAt     time.Time      `json:"createdAt"`
+	Entries       map[string]int `json:"entries"` // per DBI
+}
+
+// Entry is one key/value pair. Printable keys are stored as Key, others as
+// Key64 (base64). Values that are JSON are stored as is, others as Value64.
+type Entry struct {
+	Key     string          `json:"key,omitempty"`
+	Key64   []byte          `json:"key64,omitempty"`
+	Value   json.RawMessage `json:"value,omitempty"`
+	Value64 []byte          `json:"value64,omitempty"`
+}
+
+func newEntry(k, v []byte) Entry {
+	var e Entry
+	if printable(k) {
+		e.Key = string(k)
+	} else {
+		e.Key64 = k
+	}
+	if json.Valid(v) {
+		e.Value = v
+	} else {
+		e.Value64 = v
+	}
+	return e
+}
+
+func (e Entry) key() []byte {
+	if e.Key != "" {
+		return []byte(e.Key)
+	}
+	return e.Key64
+}
+
+func (e Entry) value() []byte {
+	if e.Value != nil {
+		return e.Value
+	}
+	return e.Value64
+}
+
+func printable(b []byte) bool {
+	if len(b) == 0 || !utf8.Valid(b) {
+		return false
+	}
+	return !strings.ContainsFunc(string(b), func(r rune) bool { return !unicode.IsPrint(r) })
+}
+
+// Export writes every registered DBI from a single read transaction to w as a
+// tar.gz archive. h supplies the descriptive fields, Format / SchemaVersion /
+// Entries are filled in. Returns the final header.
+func Export(db kv.DB, w io.Writer, h Header) (*Header, error) {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	// entries are buffered per DBI since tar needs sizes up front
+	bodies := map[string][]byte{}
+	if err := readDBIs(db, &h, func(name string, e Entry) error {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s entry: %w", name, err)
+		}
+		bodies[name] = append(append(bodies[name], line...), '\n')
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	header, err := json.MarshalIndent(h, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFile(tw, HeaderName, header, h.CreatedAt); err != nil {
+		return nil, err
+	}
+	for _, name := range database.DBINameList() {
+		if err := writeFile(tw, dbiDir+name+".jsonl", bodies[name], h.CreatedAt); err != nil {
+			return nil, err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return &h, gz.Close()
+}
+
+// readDBIs calls fn with every entry of every registered DBI from a single
+// read transaction, filling in h's Format / SchemaVersion / Entries.
+func readDBIs(db kv.DB, h *Header, fn func(name string, e Entry) error) error {
+	h.Format = Format
+	h.Entries = map[string]int{}
+	dbis := db.DBIs()
+	return db.View(func(txn kv.Txn) error {
+		if err := database.TxnGetAndUnmarshal(txn, *database.ConfigDBI, []byte(database.ConfigVersionKey), &h.SchemaVersion); err != nil {
+			return fmt.Errorf("failed to get schema version: %w", err)
+		}
+		for _, name := range database.DBINameList() {
+			cur, err := txn.Cursor(dbis[name])
+			if err != nil {
+				return fmt.Errorf("failed to open cursor on %s: %w", name, err)
+			}
+			k, v, err := cur.First()
+			for ; err == nil; k, v, err = cur.Next() {
+				if fErr := fn(name, newEntry(k, v)); fErr != nil {
+					cur.Close()
+					return fErr
+				}
+				h.Entries[name]++
+			}
+			cur.Close()
+			if !kv.IsNotFound(err) {
+				return fmt.Errorf("failed to read %s: %w", name, err)
+			}
+		}
+		return nil
+	})
+}
+
+func writeFile(tw *tar.Writer, name string, data []byte, modTime time.Time) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(data)), ModTime: modTime}); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// Import replaces all data in db with the export read from r, then migrates it
+// to the current schema, all in one write transaction. Anything invalid (an
+// unknown DBI, a schema newer than this build) rolls back and leaves db as it
+// was. check is called with the header before anything is written, an error
+// from it aborts the import.
+func Import(db kv.DB, r io.Reader, log *xlog.Logger, check func(*Header) error) (*Header, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not an export archive: %w", err)
+	}
+	tr := tar.NewReader(gz)
+
+	// header comes first
+	hdr, err := tr.Next()
+	if err != nil || hdr.Name != HeaderName {
+		return nil, fmt.Errorf("not an export archive: missing %s", HeaderName)
+	}
+	var h Header
+	if err := json.NewDecoder(io.LimitReader(tr, 1<<20)).Decode(&h); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", HeaderName, err)
+	}
+	if h.Format != Format {
+		return nil, fmt.Errorf("unsupported export format %d, this build reads %d", h.Format, Format)
+	}
+	if check != nil {
+		if err := check(&h); err != nil {
+			return nil, err
+		}
+	}
+
+	err = replaceDBIs(db, log, func(put func(name string, e Entry) error) error {
+		for {
+			f, err := tr.Next()
+			if err == io.EOF {
+				return nil
+			} else if err != nil {
+				return fmt.Errorf("failed to read archive: %w", err)
+			}
+			name, ok := strings.CutSuffix(strings.TrimPrefix(f.Name, dbiDir), ".jsonl")
+			if path.Dir(f.Name)+"/" != dbiDir || !ok {
+				continue // not data, e.g. files added by a later format
+			}
+			dec := json.NewDecoder(tr)
+			for n := 1; dec.More(); n++ {
+				var e Entry
+				if err := dec.Decode(&e); err != nil {
+					return fmt.Errorf("%s line %d: %w", f.Name, n, err)
+				}
+				if err := put(name, e); err != nil {
+					return err
+				}
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &h, nil
+}
+
+// replaceDBIs clears every registered DBI, has fill put the new entries and
+// migrates the result, all in one write transaction.
+//
+// The seal record stays this database's, see database.TxnKeepSeal.
+func replaceDBIs(db kv.DB, log *xlog.Logger, fill func(put func(name string, e Entry) error) error) error {
+	dbis := db.DBIs()
+	names := database.DBINameList()
+	return db.Update(func(txn kv.Txn) error {
+		restoreSeal, err := database.TxnKeepSeal(txn)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if err := txn.Clear(dbis[name]); err != nil {
+				return fmt.Errorf("failed to clear %s: %w", name, err)
+			}
+		}
+		if err := fill(func(name string, e Entry) error {
+			if !slices.Contains(names, name) {
+				return fmt.Errorf("export has unknown DBI %q, was it made by a newer version?", name)
+			}
+			if err := txn.Put(dbis[name], e.key(), e.value()); err != nil {
+				return fmt.Errorf("failed to write %s entry: %w", name, err)
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		if err := restoreSeal(); err != nil {
+			return err
+		}
+		if _, _, err := database.MigrateTxn(txn, log); err != nil {
+			return fmt.Errorf("failed to migrate imported data: %w", err)
+		}
+		return nil
+	})
+}
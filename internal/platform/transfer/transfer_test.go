@@ -0,0 +1,125 @@
+package transfer
+
+import (
+	"bytes"
+	"sprout/internal/platform/database"
+	"sprout/internal/platform/database/config"
+	"sprout/internal/platform/database/kv"
+	"sprout/internal/testsupport/dbtest"
+	"sprout/internal/types"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Data-Corruption/stdx/xlog"
+)
+
+// openDB returns a fresh database and a logger for importing into it.
+func openDB(t *testing.T) (kv.DB, *xlog.Logger) {
+	t.Helper()
+	log, err := xlog.New(t.TempDir(), "none")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { log.Close() })
+	return dbtest.Open(t), log
+}
+
+func TestExportImport(t *testing.T) {
+	src, _ := openDB(t)
+	if err := config.Update(src, func(cfg *types.Configuration) error {
+		cfg.Port = 9123
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	binKey, binVal := []byte{0, 1, 2, 0xff}, []byte{0xde, 0xad}
+	if err := src.Update(func(txn kv.Txn) error {
+		return txn.Put(*database.HTTPLogDBI, binKey, binVal)
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	h, err := Export(src, &buf, Header{App: "sprout", Version: "v1.0.0", CreatedAt: time.Now()})
+	if err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+	// version, data, history, plus the version and history of test-gadgets (see dbi_test.go)
+	if h.Entries["config"] != 5 || h.Entries["httplog"] != 1 {
+		t.Errorf("entries = %v", h.Entries)
+	}
+
+	dst, log := openDB(t)
+	if _, err := Import(dst, bytes.NewReader(buf.Bytes()), log, nil); err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+	cfg, err := config.View(dst)
+	if err != nil || cfg.Port != 9123 {
+		t.Errorf("imported port = %v, %v, want 9123", cfg, err)
+	}
+	var got []byte
+	if err := dst.View(func(txn kv.Txn) error {
+		got, err = txn.Get(*database.HTTPLogDBI, binKey)
+		return err
+	}); err != nil || !bytes.Equal(got, binVal) {
+		t.Errorf("binary entry = %x, %v", got, err)
+	}
+}
+
+func TestExportImportJSON(t *testing.T) {
+	src, _ := openDB(t)
+	if err := config.Update(src, func(cfg *types.Configuration) error {
+		cfg.Port = 9123
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := ExportJSON(src, &buf, Header{App: "sprout", CreatedAt: time.Now()}); err != nil {
+		t.Fatalf("ExportJSON: %v", err)
+	}
+	// edited by hand
+	dump := strings.Replace(buf.String(), `"port": 9123`, `"port": 9124`, 1)
+	if dump == buf.String() {
+		t.Fatalf("port not found in dump:\n%s", dump)
+	}
+
+	dst, log := openDB(t)
+	if _, err := ImportJSON(dst, strings.NewReader(dump), log, nil); err != nil {
+		t.Fatalf("ImportJSON: %v", err)
+	}
+	cfg, err := config.View(dst)
+	if err != nil || cfg.Port != 9124 {
+		t.Errorf("imported port = %v, %v, want 9124", cfg, err)
+	}
+}
+
+func TestImportRollsBack(t *testing.T) {
+	src, _ := openDB(t)
+	// pretend the export came from a newer build
+	if err := src.Update(func(txn kv.Txn) error {
+		return database.TxnMarshalAndPut(txn, *database.ConfigDBI, []byte(database.ConfigVersionKey), "v99")
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err := Export(src, &buf, Header{App: "sprout"}); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+
+	dst, log := openDB(t)
+	if err := config.Update(dst, func(cfg *types.Configuration) error {
+		cfg.Port = 7000
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Import(dst, &buf, log, nil)
+	if err == nil || !strings.Contains(err.Error(), "migrate") {
+		t.Fatalf("Import of a newer schema: err = %v, want a migration error", err)
+	}
+	if cfg, err := config.View(dst); err != nil || cfg.Port != 7000 {
+		t.Errorf("data changed despite failed import: %v, %v", cfg, err)
+	}
+}
@@ -0,0 +1,313 @@
+// Package apptest builds a fully wired [app.App] for integration tests.
+//
+// Everything lives under t.TempDir() (storage, runtime dir, database, logs),
+// the release source is a fake, and the port is a free one picked at random, so
+// tests never touch the real installation or the network.
+//
+//	h := apptest.New(t, apptest.WithConfig(func(cfg *types.Configuration) error {
+//		cfg.UpdateNotifications = false
+//		return nil
+//	}))
+//	resp, body := h.Get("/")
+//	err := h.Run("service", "set", "--port", "9000")
+//	out, err := h.Exec("n\n", "uninstall")
+//
+// [NewBare] is the lightweight variant, an App with a throwaway database and
+// nothing initialized, for code that only needs App fields.
+package apptest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sprout/internal/app"
+	"sprout/internal/app/commands"
+	"sprout/internal/build"
+	"sprout/internal/platform/database"
+	"sprout/internal/platform/database/config"
+	"sprout/internal/platform/http/router"
+	"sprout/internal/platform/ids"
+	"sprout/internal/testsupport/releasetest"
+	"sprout/internal/types"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Data-Corruption/stdx/xlog"
+	"github.com/urfave/cli/v3"
+)
+
+// DefaultVersion is the version the harness app reports. It's a release
+// version rather than "vX.X.X" so update related code paths are reachable.
+const DefaultVersion = "v1.0.0"
+
+// Harness is an initialized App plus helpers to poke at it.
+type Harness struct {
+	App     *app.App
+	Dir     string                         // root temp dir, storage is Dir/storage, runtime is Dir/run
+	Port    int                            // port the config points at, free when the harness was created
+	Release *releasetest.MockReleaseSource // release source the app was wired with
+	t       testing.TB
+	server  *httptest.Server
+}
+
+type options struct {
+	buildInfo build.BuildInfo
+	release   *releasetest.MockReleaseSource
+	configure []func(cfg *types.Configuration) error
+	logLevel  string
+}
+
+// Option customizes the harness.
+type Option func(o *options)
+
+// WithVersion sets the version the app reports.
+func WithVersion(version string) Option {
+	return func(o *options) { o.buildInfo.Version = version }
+}
+
+// WithBuildInfo replaces the build info entirely.
+func WithBuildInfo(bi build.BuildInfo) Option {
+	return func(o *options) { o.buildInfo = bi }
+}
+
+// WithRelease sets the mock release source (e.g. to simulate an update or a network error).
+func WithRelease(r *releasetest.MockReleaseSource) Option {
+	return func(o *options) { o.release = r }
+}
+
+// WithConfig mutates the stored configuration before the app initializes,
+// so settings read during Init (log level, webhooks, etc) take effect.
+func WithConfig(fn func(cfg *types.Configuration) error) Option {
+	return func(o *options) { o.configure = append(o.configure, fn) }
+}
+
+// WithLogLevel sets the log level, default "none".
+func WithLogLevel(level string) Option {
+	return func(o *options) { o.logLevel = level }
+}
+
+// New creates and initializes an App. It's closed automatically via t.Cleanup.
+func New(t testing.TB, opts ...Option) *Harness {
+	t.Helper()
+
+	bi := build.Info()
+	bi.Name = "sprout"
+	bi.Version = DefaultVersion
+	bi.ReleaseURL = "https://release.invalid/"
+	o := &options{
+		buildInfo: bi,
+		release:   &releasetest.MockReleaseSource{LatestVersion: DefaultVersion},
+		logLevel:  "none",
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	h := &Harness{
+		Dir:     t.TempDir(),
+		Port:    freePort(t),
+		Release: o.release,
+		t:       t,
+	}
+	storageDir := filepath.Join(h.Dir, "storage")
+
+	// apply config fixtures before Init reads them, and store the port so
+	// commands that read it from the DB agree with the override
+	if err := seedConfig(storageDir, o.logLevel, append(o.configure, func(cfg *types.Configuration) error {
+		cfg.Port = h.Port
+		return nil
+	})); err != nil {
+		t.Fatalf("apptest: failed to seed config: %v", err)
+	}
+
+	h.App = app.New(o.buildInfo)
+	h.App.StorageDir = storageDir
+	h.App.RuntimeDir = filepath.Join(h.Dir, "run")
+	h.App.ReleaseSource = o.release
+	h.App.IDs = ids.NewSeeded(1) // deterministic unit names / tokens
+	t.Cleanup(h.Close)
+
+	// Init needs a parsed command for its flags
+	initCmd := &cli.Command{
+		Name: o.buildInfo.Name,
+		Flags: []cli.Flag{
+			&cli.StringFlag{Name: "log"},
+			&cli.IntFlag{Name: "port"},
+			&cli.BoolFlag{Name: "migrate"},
+		},
+		Action: func(ctx context.Context, cmd *cli.Command) error {
+			_, err := h.App.Init(ctx, cmd)
+			return err
+		},
+	}
+	if err := initCmd.Run(context.Background(), []string{o.buildInfo.Name, "--log", o.logLevel}); err != nil {
+		t.Fatalf("apptest: failed to initialize app: %v", err)
+	}
+
+	return h
+}
+
+// NewBare returns an App with just the pieces most code under test reads: a
+// fresh database, a logger (level "none"), a storage dir under t.TempDir(),
+// the test's context and seeded IDs. Unlike New nothing is initialized
+// (no Init, config fixtures or release source) and DBDir doesn't point at
+// the database.
+func NewBare(t testing.TB, bi build.BuildInfo) *app.App {
+	t.Helper()
+	dir := t.TempDir()
+	a := app.New(bi)
+	a.Context = t.Context()
+	a.StorageDir = dir
+	a.IDs = ids.NewSeeded(1)
+
+	var err error
+	if a.Log, err = xlog.New(filepath.Join(dir, "logs"), "none"); err != nil {
+		t.Fatalf("apptest: failed to create logger: %v", err)
+	}
+	t.Cleanup(func() { a.Log.Close() })
+
+	if a.DB, err = database.NewEphemeral(a.Log); err != nil {
+		t.Fatalf("apptest: failed to create database: %v", err)
+	}
+	t.Cleanup(a.DB.Close)
+	return a
+}
+
+// Close shuts down the test server (if started) and the app. Called automatically.
+func (h *Harness) Close() {
+	if h.server != nil {
+		h.server.Close()
+	}
+	if h.App != nil {
+		h.App.Close()
+	}
+}
+
+// Config returns a copy of the current configuration.
+func (h *Harness) Config() *types.Configuration {
+	h.t.Helper()
+	cfg, err := config.View(h.App.DB)
+	if err != nil {
+		h.t.Fatalf("apptest: failed to view config: %v", err)
+	}
+	return cfg
+}
+
+// Output is what a command run by [Harness.Exec] wrote.
+type Output struct {
+	Stdout string
+	Stderr string
+}
+
+// Run executes a command against the initialized app, e.g. h.Run("service", "set", "--port", "9000").
+// Output is only logged, use [Harness.Exec] to inspect it or feed the command input.
+func (h *Harness) Run(args ...string) error {
+	h.t.Helper()
+	out, err := h.Exec("", args...)
+	if out.Stdout != "" || out.Stderr != "" {
+		h.t.Logf("apptest: %v\n%s%s", args, out.Stdout, out.Stderr)
+	}
+	return err
+}
+
+// Exec executes a command in-process with stdin as its input, capturing its output.
+// The root Before hook is skipped since the app is already initialized.
+//
+//	out, err := h.Exec("y\n", "uninstall")
+func (h *Harness) Exec(stdin string, args ...string) (Output, error) {
+	h.t.Helper()
+	var stdout, stderr strings.Builder
+	root := commands.Root(h.App)
+	root.Before = nil
+	root.Reader = strings.NewReader(stdin)
+	root.Writer = &stdout
+	root.ErrWriter = &stderr
+	err := root.Run(context.Background(), append([]string{root.Name}, args...))
+	return Output{Stdout: stdout.String(), Stderr: stderr.String()}, err
+}
+
+// URL returns the address of an httptest server serving the app's router,
+// starting it on first use.
+func (h *Harness) URL() string {
+	if h.server == nil {
+		h.server = httptest.NewServer(router.New(h.App))
+	}
+	return h.server.URL
+}
+
+// Do sends req to the test server. Relative URLs are resolved against [Harness.URL].
+// The body is read and closed, so the response can be inspected freely.
+func (h *Harness) Do(req *http.Request) (*http.Response, []byte) {
+	h.t.Helper()
+	if req.URL.Host == "" {
+		full, err := http.NewRequestWithContext(req.Context(), req.Method, h.URL()+req.URL.String(), req.Body)
+		if err != nil {
+			h.t.Fatalf("apptest: failed to build request: %v", err)
+		}
+		full.Header = req.Header
+		req = full
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		h.t.Fatalf("apptest: %s %s failed: %v", req.Method, req.URL, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		h.t.Fatalf("apptest: failed to read response body: %v", err)
+	}
+	return resp, body
+}
+
+// Get is shorthand for a GET request through [Harness.Do].
+func (h *Harness) Get(path string) (*http.Response, []byte) {
+	h.t.Helper()
+	req, err := http.NewRequest(http.MethodGet, path, nil)
+	if err != nil {
+		h.t.Fatalf("apptest: failed to build request: %v", err)
+	}
+	return h.Do(req)
+}
+
+// seedConfig opens the database before the app does and applies fixtures.
+func seedConfig(storageDir, logLevel string, fns []func(cfg *types.Configuration) error) error {
+	log, err := xlog.New(filepath.Join(storageDir, "logs"), logLevel)
+	if err != nil {
+		return fmt.Errorf("failed to create logger: %w", err)
+	}
+	defer log.Close()
+
+	db, err := database.New(filepath.Join(storageDir, "db"), log)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	return config.Update(db, func(cfg *types.Configuration) error {
+		for _, fn := range fns {
+			if err := fn(cfg); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// freePort asks the kernel for an unused port. There's a small window where
+// something else could grab it, acceptable for tests.
+func freePort(t testing.TB) int {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("apptest: failed to find a free port: %v", err)
+	}
+	defer l.Close()
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return p
+}
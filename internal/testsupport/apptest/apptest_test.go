@@ -0,0 +1,24 @@
+package apptest
+
+import (
+	"net/http"
+	"sprout/internal/testsupport/releasetest"
+	"testing"
+)
+
+func TestHarness(t *testing.T) {
+	h := New(t, WithRelease(&releasetest.MockReleaseSource{LatestVersion: "v1.1.0"}))
+
+	resp, _ := h.Get("/")
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("GET / = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	available, err := h.App.CheckForUpdate()
+	if err != nil {
+		t.Fatalf("CheckForUpdate() failed: %v", err)
+	}
+	if !available || !h.Config().UpdateAvailable {
+		t.Errorf("expected update to be available via fake release source")
+	}
+}
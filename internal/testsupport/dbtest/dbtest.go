@@ -0,0 +1,25 @@
+// Package dbtest provides throwaway databases for tests, see
+// database.NewEphemeral. Everything is torn down via t.Cleanup.
+//
+//	db := dbtest.Open(t)
+//
+// It only depends on the database, so packages the app imports can use it
+// in their own tests. For an App around such a database see apptest.NewBare.
+package dbtest
+
+import (
+	"sprout/internal/platform/database"
+	"sprout/internal/platform/database/kv"
+	"testing"
+)
+
+// Open returns a fresh, migrated database, discarding its logs.
+func Open(t testing.TB) kv.DB {
+	t.Helper()
+	db, err := database.NewEphemeral(nil)
+	if err != nil {
+		t.Fatalf("dbtest: failed to create database: %v", err)
+	}
+	t.Cleanup(db.Close)
+	return db
+}
@@ -0,0 +1,114 @@
+// Package releasetest provides fakes for the update pipeline: a mock
+// [release.ReleaseSource] and an httptest server publishing releases both in
+// the static layout build.sh uploads (what install.sh and GenericReleaseSource
+// read) and through a GitHub / Gitea compatible releases API.
+//
+// It only depends on the release package, so tests inside package app can use it.
+package releasetest
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"sprout/internal/platform/release"
+	"strings"
+	"sync"
+)
+
+// MockReleaseSource is a [release.ReleaseSource] returning a fixed answer.
+type MockReleaseSource struct {
+	LatestVersion string
+	Error         error
+	Assets        map[string][]byte // served by GetAsset, missing ".sha256" files are generated
+
+	mu    sync.Mutex
+	calls []string // release URLs GetLatestVersion was called with
+}
+
+var _ release.ReleaseSource = (*MockReleaseSource)(nil)
+
+func (m *MockReleaseSource) GetLatestVersion(ctx context.Context, releaseURL string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, releaseURL)
+	return m.LatestVersion, m.Error
+}
+
+func (m *MockReleaseSource) GetAsset(ctx context.Context, releaseURL, name string) ([]byte, error) {
+	if m.Error != nil {
+		return nil, m.Error
+	}
+	if data, ok := m.Assets[name]; ok {
+		return data, nil
+	}
+	if base, ok := strings.CutSuffix(name, ".sha256"); ok {
+		if data, ok := m.Assets[base]; ok {
+			return []byte(checksumLine(base, data)), nil
+		}
+	}
+	return nil, fmt.Errorf("no asset %q", name)
+}
+
+// Calls returns the release URLs GetLatestVersion was called with, in order.
+func (m *MockReleaseSource) Calls() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.calls...)
+}
+
+// BinaryAsset is the asset name install.sh downloads (gzipped linux/amd64 binary).
+const BinaryAsset = release.BinaryAsset
+
+// Release is a published version and its assets (name -> content).
+// Checksums are generated, don't include ".sha256" files.
+type Release struct {
+	Version    string // e.g. "v1.2.0", used as the tag
+	Prerelease bool
+	Channel    string // static layout channel, "" = stable at /release/, else /release/<channel>/
+	Assets     map[string][]byte
+}
+
+// Checksum returns the hex encoded sha256 of data, as found in .sha256 files.
+func Checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// checksumLine formats a line the way sha256sum does.
+func checksumLine(name string, data []byte) string {
+	return fmt.Sprintf("%s  %s\n", Checksum(data), name)
+}
+
+// Signer produces minisign signatures (legacy, unhashed format) for release
+// assets, the way build.sh signs them with the minisign tool.
+type Signer struct {
+	PublicKey string // base64 line, what build.BuildInfo.SigningKey holds
+	key       ed25519.PrivateKey
+	id        [8]byte
+}
+
+// NewSigner generates a throwaway signing key.
+func NewSigner() *Signer {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		panic(err)
+	}
+	s := &Signer{key: priv, id: [8]byte{1, 2, 3, 4, 5, 6, 7, 8}}
+	s.PublicKey = base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), s.id[:]...), pub...))
+	return s
+}
+
+// Sign returns the .minisig file contents for data.
+func (s *Signer) Sign(data []byte) []byte {
+	sig := ed25519.Sign(s.key, data)
+	comment := "timestamp:0\tfile:test"
+	global := ed25519.Sign(s.key, append(append([]byte(nil), sig...), comment...))
+	raw := append(append([]byte("Ed"), s.id[:]...), sig...)
+	return []byte("untrusted comment: signature from releasetest\n" +
+		base64.StdEncoding.EncodeToString(raw) + "\n" +
+		"trusted comment: " + comment + "\n" +
+		base64.StdEncoding.EncodeToString(global) + "\n")
+}
@@ -0,0 +1,64 @@
+package releasetest
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sprout/internal/platform/release"
+	"strings"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	bin := []byte("fake binary")
+	s := NewServer(t,
+		Release{Version: "v1.0.0", Assets: map[string][]byte{BinaryAsset: []byte("old")}},
+		Release{Version: "v1.1.0", Assets: map[string][]byte{BinaryAsset: bin}},
+	)
+	s.Publish(Release{Version: "v1.2.0-rc.1", Prerelease: true})
+
+	src := &release.GenericReleaseSource{Client: s.Client()}
+	latest, err := src.GetLatestVersion(context.Background(), s.ReleaseURL())
+	if err != nil {
+		t.Fatalf("GetLatestVersion() failed: %v", err)
+	}
+	if latest != "v1.1.0" {
+		t.Errorf("latest = %q, want %q", latest, "v1.1.0")
+	}
+
+	sum := get(t, s, s.ReleaseURL()+BinaryAsset+".sha256")
+	if got := strings.Fields(sum)[0]; got != Checksum([]byte(get(t, s, s.ReleaseURL()+BinaryAsset))) {
+		t.Errorf("checksum %q does not match served binary", got)
+	}
+
+	var rel apiRelease
+	if err := json.Unmarshal([]byte(get(t, s, s.URL+"/repos/acme/sprout/releases/latest")), &rel); err != nil {
+		t.Fatalf("failed to decode latest release: %v", err)
+	}
+	if rel.TagName != "v1.1.0" || len(rel.Assets) != 2 {
+		t.Fatalf("latest release = %+v, want v1.1.0 with binary and checksums.txt", rel)
+	}
+	if got := get(t, s, rel.Assets[0].BrowserDownloadURL); got != string(bin) {
+		t.Errorf("download = %q, want %q", got, bin)
+	}
+
+	s.Fail(http.StatusServiceUnavailable)
+	if _, err := src.GetLatestVersion(context.Background(), s.ReleaseURL()); err == nil {
+		t.Error("expected error while server is failing")
+	}
+}
+
+func get(t *testing.T, s *Server, url string) string {
+	t.Helper()
+	resp, err := s.Client().Get(url)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s = %d", url, resp.StatusCode)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	return string(body)
+}
@@ -0,0 +1,283 @@
+package releasetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sprout/internal/platform/release"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	Owner = "acme"
+	Repo  = "sprout"
+)
+
+// Server is a fake release server. Routes:
+//
+//	GET /release/version                              latest version (static layout)
+//	GET /release/{asset}                              latest asset, "{asset}.sha256" for its checksum
+//	GET /release/{channel}/{asset}                    same for a channel's releases (see Release.Channel)
+//	GET /release/versions                             every published version, one per line
+//	GET /release/{version}/{asset}                    a specific version's assets
+//	GET /release/[{channel}|{version}/]manifest.json  release.Manifest of the same release
+//	GET /repos/{owner}/{repo}/releases[/latest]       GitHub API
+//	GET /api/v1/repos/{owner}/{repo}/releases[/latest] Gitea API
+//	GET /download/{tag}/{asset}                       browser_download_url targets
+//
+// API releases include a "checksums.txt" asset in sha256sum format.
+// Prereleases are listed by the API but never served as latest.
+type Server struct {
+	*httptest.Server
+	mu       sync.Mutex
+	releases []Release // in publish order
+	fail     int       // status code to answer everything with, 0 = serve normally
+	requests []string  // "METHOD path" of every request
+}
+
+// NewServer starts a server publishing releases (oldest first). Closed via t.Cleanup.
+func NewServer(t testing.TB, releases ...Release) *Server {
+	t.Helper()
+	s := &Server{releases: releases}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /release/{asset}", s.handleStatic)
+	mux.HandleFunc("GET /release/{channel}/{asset}", s.handleStatic)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/releases", s.handleList)
+	mux.HandleFunc("GET /repos/{owner}/{repo}/releases/latest", s.handleLatest)
+	mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/releases", s.handleList)
+	mux.HandleFunc("GET /api/v1/repos/{owner}/{repo}/releases/latest", s.handleLatest)
+	mux.HandleFunc("GET /download/{tag}/{asset}", s.handleDownload)
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+		fail := s.fail
+		s.mu.Unlock()
+		if fail != 0 {
+			http.Error(w, http.StatusText(fail), fail)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// ReleaseURL is the static layout base URL, what build.ReleaseURL points at in production.
+func (s *Server) ReleaseURL() string { return s.URL + "/release/" }
+
+// Publish adds a release, making it the latest unless it's a prerelease.
+func (s *Server) Publish(r Release) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.releases = append(s.releases, r)
+}
+
+// Fail makes every request answer with status (e.g. 503), 0 restores normal behavior.
+func (s *Server) Fail(status int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fail = status
+}
+
+// Requests returns "METHOD path" for every request received so far.
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func (s *Server) latest() (Release, bool) {
+	return s.latestIn("")
+}
+
+// latestIn returns the last release published on a static layout channel.
+// Stable skips prereleases, other channels are made of them.
+func (s *Server) latestIn(channel string) (Release, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := len(s.releases) - 1; i >= 0; i-- {
+		r := s.releases[i]
+		if r.Channel == channel && (channel != "" || !r.Prerelease) {
+			return r, true
+		}
+	}
+	return Release{}, false
+}
+
+func (s *Server) find(tag string) (Release, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.releases {
+		if r.Version == tag {
+			return r, true
+		}
+	}
+	return Release{}, false
+}
+
+func (s *Server) handleStatic(w http.ResponseWriter, r *http.Request) {
+	channel := r.PathValue("channel")
+	if channel == "" && r.PathValue("asset") == "versions" {
+		s.mu.Lock()
+		for _, rel := range s.releases {
+			fmt.Fprintln(w, rel.Version)
+		}
+		s.mu.Unlock()
+		return
+	}
+	rel, ok := s.latestIn(channel)
+	if strings.HasPrefix(channel, "v") {
+		rel, ok = s.find(channel)
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	serveAsset(w, r, rel, r.PathValue("asset"))
+}
+
+func (s *Server) handleDownload(w http.ResponseWriter, r *http.Request) {
+	rel, ok := s.find(r.PathValue("tag"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	serveAsset(w, r, rel, r.PathValue("asset"))
+}
+
+// serveAsset serves an asset, its generated .sha256, "checksums.txt",
+// "version", or "manifest.json".
+func serveAsset(w http.ResponseWriter, r *http.Request, rel Release, name string) {
+	switch {
+	case name == "version":
+		fmt.Fprintln(w, rel.Version)
+	case name == release.ManifestAsset:
+		writeJSON(w, manifest(rel))
+	case name == "checksums.txt":
+		w.Write([]byte(checksums(rel)))
+	case strings.HasSuffix(name, ".sha256"):
+		base := strings.TrimSuffix(name, ".sha256")
+		data, ok := rel.Assets[base]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(checksumLine(base, data)))
+	default:
+		data, ok := rel.Assets[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(data)
+	}
+}
+
+// manifest lists assets by their download URL (root-relative) and checksums
+// next to the manifest (relative), so both kinds of reference are exercised.
+func manifest(rel Release) release.Manifest {
+	m := release.Manifest{Latest: rel.Version, Assets: map[string]string{
+		release.VersionsAsset: "/release/" + release.VersionsAsset,
+	}}
+	for name := range rel.Assets {
+		m.Assets[name] = "/download/" + rel.Version + "/" + name
+		m.Assets[name+".sha256"] = name + ".sha256"
+	}
+	return m
+}
+
+func checksums(rel Release) string {
+	var b strings.Builder
+	for _, name := range sortedAssetNames(rel) {
+		b.WriteString(checksumLine(name, rel.Assets[name]))
+	}
+	return b.String()
+}
+
+func sortedAssetNames(rel Release) []string {
+	names := make([]string, 0, len(rel.Assets))
+	for name := range rel.Assets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// apiRelease is the subset of the GitHub / Gitea release object clients use.
+type apiRelease struct {
+	TagName    string     `json:"tag_name"`
+	Name       string     `json:"name"`
+	Prerelease bool       `json:"prerelease"`
+	Assets     []apiAsset `json:"assets"`
+}
+
+type apiAsset struct {
+	Name               string `json:"name"`
+	Size               int    `json:"size"`
+	BrowserDownloadURL string `json:"browser_download_url"`
+}
+
+func (s *Server) toAPI(rel Release) apiRelease {
+	out := apiRelease{TagName: rel.Version, Name: rel.Version, Prerelease: rel.Prerelease, Assets: []apiAsset{}}
+	for _, name := range sortedAssetNames(rel) {
+		out.Assets = append(out.Assets, apiAsset{
+			Name:               name,
+			Size:               len(rel.Assets[name]),
+			BrowserDownloadURL: fmt.Sprintf("%s/download/%s/%s", s.URL, rel.Version, name),
+		})
+	}
+	out.Assets = append(out.Assets, apiAsset{
+		Name:               "checksums.txt",
+		Size:               len(checksums(rel)),
+		BrowserDownloadURL: fmt.Sprintf("%s/download/%s/checksums.txt", s.URL, rel.Version),
+	})
+	return out
+}
+
+func (s *Server) handleList(w http.ResponseWriter, r *http.Request) {
+	if !s.repoMatches(w, r) {
+		return
+	}
+	s.mu.Lock()
+	releases := append([]Release(nil), s.releases...)
+	s.mu.Unlock()
+
+	// newest first, like the real APIs
+	out := make([]apiRelease, 0, len(releases))
+	for i := len(releases) - 1; i >= 0; i-- {
+		out = append(out, s.toAPI(releases[i]))
+	}
+	writeJSON(w, out)
+}
+
+func (s *Server) handleLatest(w http.ResponseWriter, r *http.Request) {
+	if !s.repoMatches(w, r) {
+		return
+	}
+	rel, ok := s.latest()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, s.toAPI(rel))
+}
+
+func (s *Server) repoMatches(w http.ResponseWriter, r *http.Request) bool {
+	if r.PathValue("owner") != Owner || r.PathValue("repo") != Repo {
+		http.NotFound(w, r)
+		return false
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
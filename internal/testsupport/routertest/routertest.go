@@ -0,0 +1,214 @@
+// Package routertest serves the chi router (or a subset of routes) from an
+// httptest.Server backed by a seeded, throwaway database.
+//
+// Unlike apptest, no App lifecycle runs: there's no migration guard, update
+// checker, or notifier, just the pieces handlers actually use (DB, logger, UI,
+// build info). Use it for handler tests, and apptest for anything end to end.
+//
+//	s := routertest.New(t, routertest.WithConfig(func(cfg *types.Configuration) error {
+//		cfg.Host = "example.com"
+//		return nil
+//	}))
+//	s.PostJSON("/settings", map[string]any{"port": 9000}).AssertStatus(http.StatusOK)
+package routertest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sprout/internal/app"
+	"sprout/internal/build"
+	"sprout/internal/platform/database/config"
+	"sprout/internal/platform/http/router"
+	"sprout/internal/testsupport/apptest"
+	"sprout/internal/types"
+	"sprout/internal/ui"
+	"strings"
+	"testing"
+
+	"github.com/Data-Corruption/stdx/xlog"
+	"github.com/go-chi/chi/v5"
+)
+
+// Server is a running test server and the minimal App behind it.
+type Server struct {
+	*httptest.Server
+	App *app.App
+	t   testing.TB
+}
+
+type options struct {
+	buildInfo build.BuildInfo
+	configure []func(cfg *types.Configuration) error
+	routes    func(a *app.App, r chi.Router)
+}
+
+// Option customizes the server.
+type Option func(o *options)
+
+// WithBuildInfo sets the build info handlers see, default is build.Info() named "sprout" at v1.0.0.
+func WithBuildInfo(bi build.BuildInfo) Option {
+	return func(o *options) { o.buildInfo = bi }
+}
+
+// WithConfig mutates the stored configuration before the router is built.
+func WithConfig(fn func(cfg *types.Configuration) error) Option {
+	return func(o *options) { o.configure = append(o.configure, fn) }
+}
+
+// WithRoutes serves only the given routes instead of the full router, e.g.
+// WithRoutes(settings.Register). Keeps handler tests independent of global middleware.
+func WithRoutes(fn func(a *app.App, r chi.Router)) Option {
+	return func(o *options) { o.routes = fn }
+}
+
+// New starts the server. Everything is torn down via t.Cleanup.
+func New(t testing.TB, opts ...Option) *Server {
+	t.Helper()
+
+	bi := build.Info()
+	bi.Name = "sprout"
+	bi.Version = "v1.0.0"
+	o := &options{buildInfo: bi}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	a := apptest.NewBare(t, o.buildInfo)
+
+	if len(o.configure) > 0 {
+		if err := config.Update(a.DB, func(cfg *types.Configuration) error {
+			for _, fn := range o.configure {
+				if err := fn(cfg); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			t.Fatalf("routertest: failed to seed config: %v", err)
+		}
+	}
+
+	var err error
+	if a.UI, err = ui.New(); err != nil {
+		t.Fatalf("routertest: failed to load UI: %v", err)
+	}
+	a.BaseURL = "http://localhost"
+
+	var handler http.Handler
+	if o.routes != nil {
+		r := chi.NewRouter()
+		r.Use(func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				next.ServeHTTP(w, r.WithContext(xlog.IntoContext(r.Context(), a.Log)))
+			})
+		})
+		o.routes(a, r)
+		handler = r
+	} else {
+		handler = router.New(a)
+	}
+
+	s := &Server{Server: httptest.NewServer(handler), App: a, t: t}
+	t.Cleanup(s.Close)
+	return s
+}
+
+// WithT returns a view of the server reporting to t, for use in subtests and fuzz targets
+// where the TB the server was created with must not be used.
+func (s *Server) WithT(t testing.TB) *Server {
+	return &Server{Server: s.Server, App: s.App, t: t}
+}
+
+// Config returns a copy of the current configuration.
+func (s *Server) Config() *types.Configuration {
+	s.t.Helper()
+	cfg, err := config.View(s.App.DB)
+	if err != nil {
+		s.t.Fatalf("routertest: failed to view config: %v", err)
+	}
+	return cfg
+}
+
+// Do sends a request to path on the test server.
+func (s *Server) Do(method, path string, body io.Reader, header http.Header) *Response {
+	s.t.Helper()
+	req, err := http.NewRequestWithContext(s.t.Context(), method, s.URL+path, body)
+	if err != nil {
+		s.t.Fatalf("routertest: failed to build request: %v", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	resp, err := s.Client().Do(req)
+	if err != nil {
+		s.t.Fatalf("routertest: %s %s failed: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		s.t.Fatalf("routertest: failed to read response body: %v", err)
+	}
+	return &Response{Response: resp, Body: data, t: s.t}
+}
+
+// Get sends a GET request.
+func (s *Server) Get(path string) *Response {
+	s.t.Helper()
+	return s.Do(http.MethodGet, path, nil, nil)
+}
+
+// PostJSON marshals v and POSTs it with a JSON content type.
+func (s *Server) PostJSON(path string, v any) *Response {
+	s.t.Helper()
+	data, err := json.Marshal(v)
+	if err != nil {
+		s.t.Fatalf("routertest: failed to marshal body: %v", err)
+	}
+	return s.Do(http.MethodPost, path, bytes.NewReader(data), http.Header{"Content-Type": {"application/json"}})
+}
+
+// Response is a fully read response with assertion helpers. Assertions
+// report with t.Errorf and return the response so they can be chained.
+type Response struct {
+	*http.Response
+	Body []byte
+	t    testing.TB
+}
+
+// AssertStatus checks the status code.
+func (r *Response) AssertStatus(want int) *Response {
+	r.t.Helper()
+	if r.StatusCode != want {
+		r.t.Errorf("%s %s: status = %d, want %d, body: %s", r.Request.Method, r.Request.URL.Path, r.StatusCode, want, r.Body)
+	}
+	return r
+}
+
+// AssertHeader checks a response header value.
+func (r *Response) AssertHeader(key, want string) *Response {
+	r.t.Helper()
+	if got := r.Header.Get(key); got != want {
+		r.t.Errorf("%s %s: header %s = %q, want %q", r.Request.Method, r.Request.URL.Path, key, got, want)
+	}
+	return r
+}
+
+// AssertContains checks the body contains substr.
+func (r *Response) AssertContains(substr string) *Response {
+	r.t.Helper()
+	if !strings.Contains(string(r.Body), substr) {
+		r.t.Errorf("%s %s: body does not contain %q", r.Request.Method, r.Request.URL.Path, substr)
+	}
+	return r
+}
+
+// DecodeJSON unmarshals the body into v, failing the test on error.
+func (r *Response) DecodeJSON(v any) {
+	r.t.Helper()
+	if err := json.Unmarshal(r.Body, v); err != nil {
+		r.t.Fatalf("routertest: failed to decode JSON body %q: %v", r.Body, err)
+	}
+}
@@ -0,0 +1,180 @@
+package types
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// FieldMeta is what a setting says about itself, from its struct tags (see
+// Configuration) and AddSchemaHint.
+type FieldMeta struct {
+	Key         string   // JSON key, nested ones joined by dots, e.g. "backup.schedule"
+	Label       string   // label, or from the key: "keepLast" is "Keep Last"
+	Description string   // desc
+	Group       string   // group, or the one of the setting it's nested in
+	Env         string   // env, without the app's prefix
+	Enum        []string // valid values, from AddSchemaHint
+	Minimum     *int     // validate min=N
+	Maximum     *int     // validate max=N
+	Live        bool     // live
+}
+
+// Meta returns what every setting says about itself by key, the fields of
+// list items included (e.g. "webhooks.format"). Values the app records for
+// itself have no tags and are left out. Panics on a malformed validate tag,
+// which tests catch.
+func Meta() map[string]FieldMeta {
+	return meta(reflect.TypeFor[Configuration](), schemaHints)
+}
+
+// MetaOf is Meta for another settings struct t, e.g. a config section's (see
+// config.NewSection), keyed relative to it. Schema hints are Configuration's
+// only.
+func MetaOf(t reflect.Type) map[string]FieldMeta {
+	return meta(t, nil)
+}
+
+func meta(t reflect.Type, hints map[string]SchemaHint) map[string]FieldMeta {
+	out := map[string]FieldMeta{}
+	// nested settings are labeled with their parent's unless it's their group,
+	// e.g. "janitor.schedule" is "Janitor Schedule" but "backup.schedule" is "Schedule"
+	var walk func(prefix, group, parent string, t reflect.Type)
+	walk = func(prefix, group, parent string, t reflect.Type) {
+		for i := range t.NumField() {
+			f := t.Field(i)
+			name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+			if !f.IsExported() || name == "" || name == "-" {
+				continue
+			}
+			key := prefix + name
+			m := FieldMeta{
+				Key:         key,
+				Label:       f.Tag.Get("label"),
+				Description: f.Tag.Get("desc"),
+				Group:       group,
+				Env:         f.Tag.Get("env"),
+				Live:        f.Tag.Get("live") == "true",
+			}
+			if m.Label == "" {
+				m.Label = parent + label(name)
+			}
+			if g := f.Tag.Get("group"); g != "" {
+				m.Group = g
+			}
+			if rules := f.Tag.Get("validate"); rules != "" {
+				for rule := range strings.SplitSeq(rules, ",") {
+					name, value, _ := strings.Cut(rule, "=")
+					n, err := strconv.Atoi(value)
+					if err != nil || (name != "min" && name != "max") {
+						panic(fmt.Sprintf("types: %s: invalid validate rule %q", key, rule))
+					}
+					if name == "min" {
+						m.Minimum = &n
+					} else {
+						m.Maximum = &n
+					}
+				}
+			}
+			if h, ok := hints[key]; ok {
+				m.Enum = h.Enum
+				if h.Description != "" {
+					m.Description = h.Description
+				}
+				if h.Minimum != nil {
+					m.Minimum = h.Minimum
+				}
+				if h.Maximum != nil {
+					m.Maximum = h.Maximum
+				}
+			}
+			if m.Description == "" && m.Group == "" {
+				continue // recorded by the app
+			}
+			out[key] = m
+
+			ft := f.Type
+			if ft.Kind() == reflect.Slice {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct && ft != reflect.TypeFor[time.Time]() {
+				sub := m.Label + " "
+				if name == m.Group {
+					sub = ""
+				}
+				walk(key+".", m.Group, sub, ft)
+			}
+		}
+	}
+	walk("", "", "", t)
+	return out
+}
+
+// label turns a JSON key into words: "keepLast" is "Keep Last",
+// "outboundCABundle" "Outbound CA Bundle".
+func label(name string) string {
+	r := []rune(name)
+	var b strings.Builder
+	for i, c := range r {
+		// a word starts at an upper case letter after a lower case one, or
+		// at the last one of an acronym followed by lower case
+		if i > 0 && unicode.IsUpper(c) && (unicode.IsLower(r[i-1]) || i+1 < len(r) && unicode.IsLower(r[i+1]) && unicode.IsUpper(r[i-1])) {
+			b.WriteByte(' ')
+		}
+		if i == 0 {
+			c = unicode.ToUpper(c)
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// checkBounds reports the numbers in c outside their validate bounds.
+func (c *Configuration) checkBounds() FieldErrors {
+	return checkBounds(reflect.ValueOf(c).Elem(), Meta())
+}
+
+// CheckBounds is Validate's bounds check for v, a pointer to another settings
+// struct (e.g. a config section's), fields keyed relative to it.
+func CheckBounds(v any) FieldErrors {
+	rv := reflect.ValueOf(v).Elem()
+	return checkBounds(rv, MetaOf(rv.Type()))
+}
+
+func checkBounds(root reflect.Value, meta map[string]FieldMeta) FieldErrors {
+	var e FieldErrors
+	var walk func(prefix string, v reflect.Value)
+	walk = func(prefix string, v reflect.Value) {
+		for i := range v.NumField() {
+			name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("json"), ",")
+			f, m := v.Field(i), meta[prefix+name]
+			switch {
+			case f.Kind() == reflect.Struct && f.Type() != reflect.TypeFor[time.Time]():
+				walk(prefix+name+".", f)
+			case f.CanInt() && (m.Minimum != nil || m.Maximum != nil):
+				if msg := outOfBounds(int(f.Int()), m.Minimum, m.Maximum); msg != "" {
+					e = append(e, FieldError{Field: m.Key, Message: msg})
+				}
+			}
+		}
+	}
+	walk("", root)
+	return e
+}
+
+func outOfBounds(n int, lo, hi *int) string {
+	switch {
+	case lo != nil && hi != nil && (n < *lo || n > *hi):
+		return fmt.Sprintf("must be between %d and %d", *lo, *hi)
+	case lo != nil && n < *lo && *lo == 0:
+		return "must not be negative"
+	case lo != nil && n < *lo:
+		return fmt.Sprintf("must be at least %d", *lo)
+	case hi != nil && n > *hi:
+		return fmt.Sprintf("must be at most %d", *hi)
+	}
+	return ""
+}
@@ -0,0 +1,51 @@
+package types
+
+import (
+	"slices"
+	"sprout/internal/platform/release"
+	"strings"
+)
+
+// SchemaHint is what a setting's struct tags can't say, e.g. valid values
+// another package owns, see AddSchemaHint. Keys are JSON keys, nested ones
+// joined by dots; the fields of list items are addressed through the list,
+// e.g. "webhooks.format".
+type SchemaHint struct {
+	Description string
+	Enum        []string // valid values, "" included when it means a default
+	Minimum     *int
+	Maximum     *int
+}
+
+var schemaHints = map[string]SchemaHint{
+	"logLevel": {Enum: slices.Concat(LogLevels, upper(LogLevels))},
+	"channel":  {Enum: slices.Concat([]string{""}, release.Channels)},
+}
+
+// AddSchemaHint adds to what Meta has for key, e.g. the valid values of a
+// setting owned by a package this one can't import (see AddValidator). Fields
+// left empty keep what the key already has. Call it at init.
+func AddSchemaHint(key string, h SchemaHint) {
+	cur := schemaHints[key]
+	if h.Description != "" {
+		cur.Description = h.Description
+	}
+	if h.Enum != nil {
+		cur.Enum = h.Enum
+	}
+	if h.Minimum != nil {
+		cur.Minimum = h.Minimum
+	}
+	if h.Maximum != nil {
+		cur.Maximum = h.Maximum
+	}
+	schemaHints[key] = cur
+}
+
+func upper(s []string) []string {
+	out := make([]string, len(s))
+	for i, v := range s {
+		out[i] = strings.ToUpper(v)
+	}
+	return out
+}
@@ -0,0 +1,31 @@
+package types
+
+import "fmt"
+
+// Redacted is what a set Secret prints as.
+const Redacted = "*****"
+
+// Secret is a setting that mustn't leak, e.g. tokens and signing keys. It's
+// stored as the plain string (its JSON is, so the database, `db export` and
+// the config file round-trip it), but prints as Redacted with fmt, so logs,
+// templates and `config list` don't show it. Use Reveal where the value is
+// needed.
+type Secret string
+
+// String returns Redacted, or "" if s isn't set.
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return Redacted
+}
+
+// GoString keeps %#v from showing s.
+func (s Secret) GoString() string {
+	return fmt.Sprintf("types.Secret(%q)", s.String())
+}
+
+// Reveal returns the value.
+func (s Secret) Reveal() string {
+	return string(s)
+}
@@ -5,20 +5,206 @@ import (
 	"time"
 )
 
+// Configuration is the app's settings and the values it records for itself
+// (see config.Recorded). Settings describe themselves with struct tags, read
+// by Meta for `config schema`, the environment layer and the settings page:
+//
+//	desc:"..."               what it does, for people
+//	group:"server"           section it belongs to, nested settings inherit it
+//	env:"PORT"               <APP>_PORT in the environment overrides it
+//	validate:"min=1,max=65535"  bounds of a number, checked by Validate
+//	label:"HTTP Record"      name for forms, derived from the JSON key if unset
+//	live:"true"              applied without a restart, see app.OnReload
 type Configuration struct {
-	LogLevel  string `json:"logLevel"`
-	Port      int    `json:"port"`      // port the server is listening on. 80/443 will be omitted from URLs
-	Host      string `json:"host"`      // host the server is listening on
-	ProxyPort int    `json:"proxyPort"` // port the proxy is listening on, 0 = no proxy. 80/443 will be omitted from URLs
+	LogLevel  string `json:"logLevel" group:"server" env:"LOG_LEVEL" live:"true" desc:"Log verbosity, in any case."`
+	Port      int    `json:"port" group:"server" env:"PORT" validate:"min=1,max=65535" live:"true" desc:"Port the server is listening on, it moves to a new one live. 80/443 are omitted from URLs."`
+	Host      string `json:"host" group:"server" env:"HOST" desc:"Host the server is listening on."`
+	ProxyPort int    `json:"proxyPort" group:"server" env:"PROXY_PORT" validate:"min=0,max=65535" desc:"Port the proxy is listening on, 0 = no proxy. 80/443 are omitted from URLs."`
 
-	UpdateNotifications bool      `json:"updateNotifications"`
+	UpdateNotifications bool      `json:"updateNotifications" group:"updates" desc:"Check for updates daily and send update.available."`
 	LastUpdateCheck     time.Time `json:"lastUpdateCheck"`
 	UpdateAvailable     bool      `json:"updateAvailable"`
+	Channel             string    `json:"channel" group:"updates" env:"UPDATE_CHANNEL" desc:"Update channel, \"\" = stable."` // see release.Channels
+	// the release host rate limited lookups until then, update checks before it are skipped
+	UpdateCheckNotBefore time.Time `json:"updateCheckNotBefore"`
+	// latest version the update check found, update.available is sent once per version
+	LatestVersion string `json:"latestVersion"`
+	// see app.AutoUpdateMinUptime for the safeguards
+	AutoUpdate bool `json:"autoUpdate" group:"updates" env:"AUTO_UPDATE" desc:"Apply updates found by the daily check without asking ('service run' only). Changes apply on restart."`
+	// last version an automatic update installed, not retried automatically while an older one is running (it didn't stick)
+	AutoUpdateAttempt string `json:"autoUpdateAttempt"`
+	// see app.NativeUpdate
+	UpdateMethod string `json:"updateMethod" group:"updates" desc:"How updates are installed: \"script\" (the published install.sh, default) or \"native\" (pure Go, no curl / sh)."`
+	// see app.ParseUpdateWindow
+	UpdateWindow string `json:"updateWindow" group:"updates" desc:"When 'service run' may apply updates on its own, e.g. \"03:00-05:00 Sat\", \"\" = never. Changes apply on restart."`
+	ReleaseToken Secret `json:"releaseToken" group:"updates" desc:"Bearer token sent to the release host, for private releases. \"\" = RELEASE_TOKEN env. Changes apply on restart."`
+	// last release lookups by URL, sent back as conditional requests so unchanged ones are an empty 304. See release.Cache
+	ReleaseCache map[string]CachedResponse `json:"releaseCache"`
 
-	// app version when update process was accepted. This is lazily used to determine if the update was successful after restart.
+	// last version to open the database, and the one before it (what `rollback` reinstalls). Recorded on startup.
+	InstalledVersion string `json:"installedVersion"`
+	PreviousVersion  string `json:"previousVersion"`
+
+	// post-update hooks recorded when the last update was prepared, see app.UpdateHook
+	PendingUpdateHooks PendingUpdateHooks `json:"pendingUpdateHooks"`
+	// where the last detached update writes its output, see app.FollowUpdate
+	LastUpdateRun UpdateRun `json:"lastUpdateRun"`
+	// failed updates `service run` retries, see app.RetryUpdate
+	UpdateRetry UpdateRetry `json:"updateRetry"`
+
+	// app version when update process was accepted. This is lazily used to determine if the update was successful after restart. See lifecycle.
 	PreUpdateVersion string `json:"preUpdateVersion"`
-	// incremented on each service start (usually server listen or similar), used for detecting restarts
+	// incremented on each service start (usually server listen or similar), used for detecting restarts. See lifecycle.
 	StartCounter int `json:"startCounter"`
+	// the last few service starts, for crash-loop detection. See lifecycle.CrashLooping.
+	RecentStarts []time.Time `json:"recentStarts"`
+
+	// http server tuning, timeouts in seconds. 0 = defaults (read 5, write 10, idle 120). Changes apply on restart.
+	ServerReadTimeout  int `json:"serverReadTimeout" group:"server" validate:"min=0" desc:"HTTP server read timeout in seconds, 0 = default (5). Changes apply on restart."`
+	ServerWriteTimeout int `json:"serverWriteTimeout" group:"server" validate:"min=0" desc:"HTTP server write timeout in seconds, 0 = default (10). Changes apply on restart."`
+	ServerIdleTimeout  int `json:"serverIdleTimeout" group:"server" validate:"min=0" desc:"Seconds idle keep-alive connections are kept open, 0 = default (120). Changes apply on restart."`
+	MaxConnections     int `json:"maxConnections" group:"server" env:"MAX_CONNECTIONS" validate:"min=0" live:"true" desc:"Max concurrent requests before responding 503, 0 = unlimited. Applied live."` // see app.OnReload
+
+	// HTTPS served by the app itself rather than a proxy, see internal/platform/acme. Changes apply on restart.
+	TLS TLSConfig `json:"tls" group:"tls" label:"TLS" desc:"Serve HTTPS directly, with a certificate from files or one obtained from an ACME CA (Let's Encrypt) with DNS-01 challenges. Changes apply on restart."`
+
+	// scheduled backups, see internal/platform/backup. Changes apply on restart.
+	Backup BackupConfig `json:"backup" group:"backup" desc:"Scheduled backups. Changes apply on restart."`
+
+	// periodic cleanup of old logs and stale runtime files, see internal/platform/janitor. Changes apply on restart.
+	Janitor JanitorConfig `json:"janitor" group:"maintenance" desc:"Periodic cleanup of old logs and stale runtime files. For the limits 0 = default, < 0 = no limit. Changes apply on restart."`
+
+	// logs and sends storage.low, see storage.Monitor
+	DiskFreeWarnMiB int `json:"diskFreeWarnMiB" group:"maintenance" label:"Disk Free Warning (MiB)" desc:"Warn when free space on the storage volume drops below this, 0 = default (1024), < 0 = never."`
+
+	// record sanitized requests/responses for `http list|show|replay`. Changes apply on restart.
+	HTTPRecord     bool `json:"httpRecord" group:"debug" env:"HTTP_RECORD" label:"HTTP Record" desc:"Record sanitized requests/responses for 'http list|show|replay'. Changes apply on restart."`
+	HTTPRecordKeep int  `json:"httpRecordKeep" group:"debug" validate:"min=0" label:"HTTP Recordings Kept" desc:"Recordings kept, 0 = default (200)."`
+
+	// network wait before the service starts, see `service run`
+	NetWaitSkip      bool     `json:"netWaitSkip" group:"network" env:"NET_WAIT_SKIP" desc:"Don't wait for the network before the service starts."`
+	NetWaitTimeout   int      `json:"netWaitTimeout" group:"network" validate:"min=0" desc:"Seconds to wait for the network, 0 = default (30)."`
+	NetWaitInterface string   `json:"netWaitInterface" group:"network" desc:"Require this interface to be up with an address, \"\" = any."`
+	NetWaitProbes    []string `json:"netWaitProbes" group:"network" desc:"Network checks, e.g. \"tcp:10.0.0.1:443\", \"dns:example.com\". Empty = defaults."`
+
+	// outbound http client settings, see internal/platform/httpclient. Changes apply on restart.
+	OutboundProxy    string `json:"outboundProxy" group:"outbound" desc:"Outbound proxy URL, \"\" = HTTPS_PROXY/HTTP_PROXY env. Changes apply on restart."`
+	OutboundCABundle string `json:"outboundCABundle" group:"outbound" desc:"Path to extra PEM CA certs for outbound requests, \"\" = system roots only. Changes apply on restart."`
+	OutboundTimeout  int    `json:"outboundTimeout" group:"outbound" env:"OUTBOUND_TIMEOUT" validate:"min=0" desc:"Outbound request timeout in seconds, 0 = default (30). Changes apply on restart."`
+
+	// config overlay pulled from a URL, see internal/platform/remoteconfig. Changes apply on restart.
+	RemoteConfig RemoteConfig `json:"remoteConfig" group:"remote" desc:"Settings pulled from a URL on a schedule ('service run' only), for configuring many instances centrally. Changes apply on restart."`
+	// last pull of RemoteConfig.URL, sent back as a conditional request so an unchanged overlay is an empty 304
+	RemoteConfigState RemoteConfigState `json:"remoteConfigState"`
+
+	NotifyRoutes []NotifyRoute `json:"notifyRoutes" group:"notifications" desc:"Notification routing rules, empty = every event goes to every notifier."`
+	Webhooks     []Webhook     `json:"webhooks" group:"notifications" desc:"Outbound webhooks, each registered as a notifier. Changes apply on restart."`
+}
+
+// PendingUpdateHooks are the AfterUpdate hooks From registered, run by the next other version to boot.
+type PendingUpdateHooks struct {
+	From  string        `json:"from"`
+	Hooks []PendingHook `json:"hooks"`
+}
+
+// PendingHook is a recorded update hook.
+type PendingHook struct {
+	Name    string `json:"name"`
+	Command string `json:"command,omitempty"` // "" = Go callback, looked up by Name
+}
+
+// UpdateRun locates a detached update's output.
+type UpdateRun struct {
+	Unit      string    `json:"unit,omitempty"`      // transient systemd unit, output in the user journal
+	LogOffset int64     `json:"logOffset,omitempty"` // otherwise, size of update.log when it started
+	Started   time.Time `json:"started"`
+}
+
+// UpdateRetry tracks updates that failed in a row.
+type UpdateRetry struct {
+	Failures  int       `json:"failures"` // 0 = nothing to retry
+	NextAt    time.Time `json:"nextAt"`   // when the next attempt is due
+	LastError string    `json:"lastError"`
+	Version   string    `json:"version"` // version that failed to update, another one running means an update applied since
+	Run       time.Time `json:"run"`     // Started of the last UpdateRun whose outcome was recorded
+}
+
+// CachedResponse is a previous response to a release lookup (version file or manifest).
+type CachedResponse struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"lastModified,omitempty"`
+	Body         string `json:"body"`
+}
+
+// NotifyRoute sends events whose kind matches Event (path.Match syntax, e.g. "update.*")
+// to the named notifiers. An event matching several routes is delivered once per notifier.
+type NotifyRoute struct {
+	Event     string   `json:"event" desc:"Event kinds to route, path.Match syntax, e.g. \"update.*\"."`
+	Notifiers []string `json:"notifiers" desc:"Notifier names the matching events are sent to."`
+}
+
+// Webhook is an outbound webhook target.
+type Webhook struct {
+	Name   string `json:"name" desc:"Notifier name used in routes, \"\" = \"webhook-<index>\"."`
+	URL    string `json:"url" desc:"Full http(s) URL to POST to."`
+	Secret Secret `json:"secret" desc:"HMAC-SHA256 signing key, \"\" = unsigned."`
+	Format string `json:"format" desc:"Body format: \"\" (signed JSON), \"slack\" or \"ntfy\"."` // see notify.Formats
+}
+
+// RemoteConfig is where the service pulls a config overlay from, see
+// internal/platform/remoteconfig. An empty URL disables it.
+type RemoteConfig struct {
+	URL       string `json:"url" env:"REMOTE_CONFIG_URL" label:"Remote Config URL" desc:"HTTPS URL of the overlay, the keys of the config file as YAML or JSON, signed with minisign at <url>.minisig. \"\" = off."`
+	Schedule  string `json:"schedule" env:"REMOTE_CONFIG_SCHEDULE" desc:"Cron expression for pulls, \"\" = every 15 minutes."`
+	PublicKey string `json:"publicKey" env:"REMOTE_CONFIG_PUBLIC_KEY" desc:"minisign public key the overlay must be signed with, \"\" = the build's release signing key."`
+	Token     Secret `json:"token" desc:"Bearer token sent with the pulls, \"\" = none."`
+}
+
+// RemoteConfigState is the last pull of a RemoteConfig.
+type RemoteConfigState struct {
+	URL          string    `json:"url,omitempty"` // the ETag is only sent back to the URL it came from
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	Checked      time.Time `json:"checked"`
+	Applied      time.Time `json:"applied"` // last time an overlay changed settings
+	LastError    string    `json:"lastError,omitempty"`
+}
+
+// TLSConfig has the server serve HTTPS on its port. The certificate comes
+// from CertFile / KeyFile, or with a DNSProvider set, from an ACME CA for
+// Host: DNS-01 challenges are answered with TXT records, so it works behind
+// NAT and on any port. Neither set = plain HTTP.
+type TLSConfig struct {
+	CertFile      string `json:"certFile" desc:"PEM certificate chain to serve, with keyFile. \"\" = none."`
+	KeyFile       string `json:"keyFile" desc:"PEM private key of certFile."`
+	DNSProvider   string `json:"dnsProvider" label:"DNS Provider" desc:"Gets a certificate for host from the ACME CA, setting the DNS-01 TXT records with: \"cloudflare\" or \"exec\" (dnsCommand). \"\" = no ACME."` // see acme.Providers
+	DNSToken      Secret `json:"dnsToken" label:"DNS API Token" desc:"API token of the DNS provider, for cloudflare one with Zone.DNS edit permission."`
+	DNSCommand    string `json:"dnsCommand" label:"DNS Command" desc:"For the exec provider: executable run as <command> present|cleanup <fqdn> <value> to add / remove a TXT record."`
+	ACMEEmail     string `json:"acmeEmail" label:"ACME Email" desc:"Contact address of the ACME account, for expiry notices. \"\" = none."`
+	ACMEDirectory string `json:"acmeDirectory" label:"ACME Directory" desc:"ACME directory URL, \"\" = Let's Encrypt. Test with https://acme-staging-v02.api.letsencrypt.org/directory."`
+	HTTP3         bool   `json:"http3" label:"HTTP/3" desc:"Experimental: also serve HTTP/3 (QUIC) on the port over UDP, advertised to browsers with Alt-Svc. Helps on lossy links."` // see server.withHTTP3
+}
+
+// Enabled reports whether the server serves HTTPS.
+func (t TLSConfig) Enabled() bool { return t.CertFile != "" || t.DNSProvider != "" }
+
+// BackupConfig schedules automatic backups. An empty schedule disables them.
+// With no keep rules set, every archive is kept.
+type BackupConfig struct {
+	Schedule   string `json:"schedule" env:"BACKUP_SCHEDULE" desc:"Cron expression, e.g. \"0 3 * * *\" or \"@daily\", \"\" = no scheduled backups."`
+	Dir        string `json:"dir" env:"BACKUP_DIR" label:"Directory" desc:"Archive directory, \"\" = <storage>/backups."`
+	KeepLast   int    `json:"keepLast" validate:"min=0" desc:"Keep the newest N archives. With no keep rules set, every archive is kept."`
+	KeepDaily  int    `json:"keepDaily" validate:"min=0" desc:"Keep the newest archive of each of the last N days."`
+	KeepWeekly int    `json:"keepWeekly" validate:"min=0" desc:"Keep the newest archive of each of the last N weeks."`
+	Encrypt    string `json:"encrypt" desc:"Archive encryption: \"\" (none), \"key\" (<storage>/backup.key) or \"passphrase\" (BACKUP_PASSPHRASE env)."`
+}
+
+// JanitorConfig limits what the janitor keeps. For the limits 0 = default, < 0 = no limit.
+type JanitorConfig struct {
+	Schedule        string `json:"schedule" desc:"Cron expression, \"\" = @daily, \"off\" = disabled."`
+	LogMaxAgeDays   int    `json:"logMaxAgeDays" desc:"Rotated logs older than this are removed (default 30)."`
+	LogMaxFiles     int    `json:"logMaxFiles" desc:"Rotated logs kept at most (default 20)."`
+	UpdateLogMaxKiB int    `json:"updateLogMaxKiB" label:"Update Log Max (KiB)" desc:"update.log is trimmed to its last N KiB (default 1024)."`
 }
 
 func DefaultConfig() Configuration {
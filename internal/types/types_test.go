@@ -0,0 +1,151 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// FuzzConfigurationUnmarshal feeds arbitrary stored bytes to the config decoder.
+// Whatever decodes must survive a marshal/unmarshal round trip unchanged.
+func FuzzConfigurationUnmarshal(f *testing.F) {
+	def, err := json.Marshal(DefaultConfig())
+	if err != nil {
+		f.Fatalf("failed to marshal default config: %v", err)
+	}
+	f.Add(def)
+	f.Add([]byte(`{}`))
+	f.Add([]byte(`null`))
+	f.Add([]byte(`{"port":"8080","lastUpdateCheck":"yesterday"}`))
+	f.Add([]byte(`{"notifyRoutes":[{"event":"*","notifiers":null}],"webhooks":[{}]}`))
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var cfg Configuration
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			return
+		}
+		out, err := json.Marshal(cfg)
+		if err != nil {
+			t.Fatalf("failed to marshal decoded config: %v", err)
+		}
+		var again Configuration
+		if err := json.Unmarshal(out, &again); err != nil {
+			t.Fatalf("failed to unmarshal re-encoded config: %v", err)
+		}
+		// time.Time loses its monotonic reading / location name on the way through, compare encodings instead
+		out2, _ := json.Marshal(again)
+		if !reflect.DeepEqual(out, out2) {
+			t.Fatalf("round trip changed config:\n%s\n%s", out, out2)
+		}
+	})
+}
+
+func TestValidate(t *testing.T) {
+	cfg := DefaultConfig()
+	if fe := cfg.Validate(); fe != nil {
+		t.Fatalf("default config invalid: %v", fe)
+	}
+
+	cfg.LogLevel = "loud"
+	cfg.Port = 0
+	cfg.Backup.KeepDaily = -1
+	cfg.Backup.Schedule = "every day"
+	fe := cfg.Validate()
+	var fields []string
+	for _, e := range fe {
+		fields = append(fields, e.Field)
+	}
+	if want := []string{"backup.keepDaily", "backup.schedule", "logLevel", "port"}; !reflect.DeepEqual(fields, want) {
+		t.Fatalf("invalid fields = %v, want %v", fields, want)
+	}
+
+	if got := fe.For("port"); len(got) != 1 || got[0].Field != "port" {
+		t.Errorf("For(port) = %v, want only port", got)
+	}
+	if got := fe.For("backup"); len(got) != 2 {
+		t.Errorf("For(backup) = %v, want both backup fields", got)
+	}
+	if got := fe.For("host"); got != nil {
+		t.Errorf("For(host) = %v, want nil", got)
+	}
+}
+
+func TestMeta(t *testing.T) {
+	meta := Meta()
+	port := meta["port"]
+	if port.Group != "server" || port.Env != "PORT" || port.Minimum == nil || *port.Minimum != 1 || port.Maximum == nil || *port.Maximum != 65535 {
+		t.Errorf("port = %+v", port)
+	}
+	if m := meta["backup.schedule"]; m.Group != "backup" || m.Env != "BACKUP_SCHEDULE" || m.Description == "" {
+		t.Errorf("backup.schedule = %+v, want the backup group and an env name", m)
+	}
+	if m := meta["janitor.logMaxFiles"]; m.Label != "Janitor Log Max Files" || m.Live {
+		t.Errorf("janitor.logMaxFiles = %+v, want labeled with janitor", m)
+	}
+	if m := meta["outboundCABundle"]; m.Label != "Outbound CA Bundle" {
+		t.Errorf("outboundCABundle label = %q", m.Label)
+	}
+	if !port.Live || port.Label != "Port" {
+		t.Errorf("port = %+v, want live", port)
+	}
+	if m := meta["webhooks.format"]; m.Group != "notifications" || m.Description == "" {
+		t.Errorf("webhooks.format = %+v, want the group of webhooks", m)
+	}
+	if m := meta["logLevel"]; len(m.Enum) == 0 {
+		t.Error("logLevel has no enum")
+	}
+	for _, key := range []string{"startCounter", "lastUpdateCheck"} {
+		if _, ok := meta[key]; ok {
+			t.Errorf("recorded %s has metadata", key)
+		}
+	}
+
+	cfg := DefaultConfig()
+	cfg.ProxyPort, cfg.MaxConnections = 70000, -1
+	want := map[string]string{"proxyPort": "must be between 0 and 65535", "maxConnections": "must not be negative"}
+	for _, e := range cfg.Validate() {
+		if want[e.Field] != e.Message {
+			t.Errorf("%s: %q, want %q", e.Field, e.Message, want[e.Field])
+		}
+		delete(want, e.Field)
+	}
+	if len(want) != 0 {
+		t.Errorf("not reported: %v", want)
+	}
+
+	// another settings struct, e.g. a config section's
+	type section struct {
+		Workers int `json:"workers" env:"WORKERS" validate:"min=1" desc:"Worker count."`
+	}
+	if m := MetaOf(reflect.TypeFor[section]())["workers"]; m.Env != "WORKERS" || m.Label != "Workers" || m.Minimum == nil {
+		t.Errorf("MetaOf(section)[workers] = %+v", m)
+	}
+	if fe := CheckBounds(&section{}); len(fe) != 1 || fe[0].Field != "workers" {
+		t.Errorf("CheckBounds(section) = %v, want workers", fe)
+	}
+}
+
+func TestSecret(t *testing.T) {
+	cfg := Configuration{ReleaseToken: "tok3n"}
+	if got := fmt.Sprintf("%v %s %#v", cfg.ReleaseToken, cfg.ReleaseToken, cfg.ReleaseToken); strings.Contains(got, "tok3n") {
+		t.Errorf("formatted secret = %q", got)
+	}
+	if got := fmt.Sprintf("%+v", cfg); strings.Contains(got, "tok3n") {
+		t.Errorf("formatted config shows the secret: %s", got)
+	}
+	if Secret("").String() != "" {
+		t.Errorf("empty secret = %q, want empty", Secret("").String())
+	}
+
+	// stored as is
+	b, err := json.Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var again Configuration
+	if err := json.Unmarshal(b, &again); err != nil || again.ReleaseToken.Reveal() != "tok3n" {
+		t.Errorf("round trip = %q, %v", again.ReleaseToken.Reveal(), err)
+	}
+}
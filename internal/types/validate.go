@@ -0,0 +1,101 @@
+package types
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"sprout/internal/platform/release"
+	"sprout/pkg/cron"
+	"strings"
+)
+
+// FieldError is a setting that failed validation.
+type FieldError struct {
+	Field   string `json:"field"`   // JSON key, nested ones joined by dots, e.g. "backup.schedule"
+	Message string `json:"message"` // what's wrong, without the key
+}
+
+// FieldErrors are the settings that failed validation, see Validate.
+type FieldErrors []FieldError
+
+func (e FieldErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Field + ": " + fe.Message
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// For returns the errors of the given keys, including the settings nested in
+// them and the ones they're nested in. For checking only what was changed, so
+// an invalid value stored earlier doesn't block changing something else.
+func (e FieldErrors) For(keys ...string) FieldErrors {
+	var out FieldErrors
+	for _, fe := range e {
+		if slices.ContainsFunc(keys, func(k string) bool {
+			return k == fe.Field || strings.HasPrefix(fe.Field, k+".") || strings.HasPrefix(k, fe.Field+".")
+		}) {
+			out = append(out, fe)
+		}
+	}
+	return out
+}
+
+var validators []func(c *Configuration) FieldErrors
+
+// AddValidator adds rules for settings whose valid values belong to a package
+// this one can't import (e.g. backup's encryption modes). Validate runs them
+// after its own. Call it at init.
+func AddValidator(fn func(c *Configuration) FieldErrors) {
+	validators = append(validators, fn)
+}
+
+// LogLevels are the valid LogLevel values, in any case.
+var LogLevels = []string{"debug", "info", "warn", "error", "none"}
+
+// Validate checks every setting, nil if all are valid. Values the app records
+// for itself aren't checked.
+func (c *Configuration) Validate() FieldErrors {
+	var e FieldErrors
+	check := func(ok bool, field, format string, v ...any) {
+		if !ok {
+			e = append(e, FieldError{Field: field, Message: fmt.Sprintf(format, v...)})
+		}
+	}
+	schedule := func(field, spec string, empty ...string) {
+		if spec == "" || slices.Contains(empty, spec) {
+			return
+		}
+		if _, err := cron.Parse(spec); err != nil {
+			check(false, field, "invalid cron expression: %v", err)
+		}
+	}
+
+	check(slices.Contains(LogLevels, strings.ToLower(c.LogLevel)), "logLevel", "%q isn't a log level, want one of %s", c.LogLevel, strings.Join(LogLevels, ", "))
+	check(c.Channel == "" || slices.Contains(release.Channels, c.Channel), "channel", "%q isn't a channel, want one of %s", c.Channel, strings.Join(release.Channels, ", "))
+	e = append(e, c.checkBounds()...)
+	schedule("backup.schedule", c.Backup.Schedule)
+	schedule("janitor.schedule", c.Janitor.Schedule, "off")
+	schedule("remoteConfig.schedule", c.RemoteConfig.Schedule)
+	check(c.RemoteConfig.URL == "" || strings.HasPrefix(c.RemoteConfig.URL, "https://"), "remoteConfig.url", "must be https")
+	check((c.TLS.CertFile == "") == (c.TLS.KeyFile == ""), "tls.keyFile", "set both certFile and keyFile, or neither")
+	check(c.TLS.CertFile == "" || c.TLS.DNSProvider == "", "tls.dnsProvider", "certFile is set, use either certificate files or ACME")
+	check(c.TLS.ACMEDirectory == "" || strings.HasPrefix(c.TLS.ACMEDirectory, "https://"), "tls.acmeDirectory", "must be https")
+	check(!c.TLS.HTTP3 || c.TLS.Enabled(), "tls.http3", "needs TLS, set certFile and keyFile or dnsProvider")
+
+	for i, r := range c.NotifyRoutes {
+		_, err := path.Match(r.Event, "")
+		check(r.Event != "" && err == nil, "notifyRoutes", "route %d: event must be a pattern like \"update.*\"", i)
+		check(len(r.Notifiers) > 0, "notifyRoutes", "route %d: no notifiers", i)
+	}
+	for i, wh := range c.Webhooks {
+		check(strings.HasPrefix(wh.URL, "http://") || strings.HasPrefix(wh.URL, "https://"), "webhooks", "webhook %d: url must be http(s)", i)
+	}
+
+	for _, fn := range validators {
+		e = append(e, fn(c)...)
+	}
+	// validators come in init order, keep the output stable
+	slices.SortStableFunc(e, func(a, b FieldError) int { return strings.Compare(a.Field, b.Field) })
+	return e
+}
@@ -1,6 +1,7 @@
-(()=>{var S="nord",g="forest",p="SPROUT_THEME";function k(){return localStorage.getItem(p)||(window.matchMedia?.("(prefers-color-scheme: dark)").matches?g:S)}function b(){return k()===g}function E(){let e=document.getElementById("theme-toggle");e&&(e.checked=b())}function M(e){localStorage.setItem(p,e),document.documentElement.setAttribute("data-theme",e),E()}function v(){M(b()?S:g)}function C(){let e=k();document.documentElement.setAttribute("data-theme",e),localStorage.setItem(p,e)}function I(){E()}function u(){let e=document.getElementById("click-blocker");e&&e.classList.remove("hidden")}function a(){let e=document.getElementById("click-blocker");e&&e.classList.add("hidden")}function h(e){e&&(e.className="status loading loading-spinner loading-xs",e.textContent="",e.dataset.errorMessage="",e.onclick=null)}function w(e){e&&(e.className="status status-success",e.dataset.errorMessage="",e.onclick=null,setTimeout(()=>{e.classList.contains("status-success")&&(e.className="status hidden")},2e3))}function T(e){let n=e.closest("label");if(n){let t=n.querySelector(".status");if(t)return t}let r=e.closest(".flex");if(r){let t=r.querySelector(".status");if(t)return t}let s=e.closest(".form-control");return s?s.querySelector(".status"):null}function c(e){let n=document.getElementById("error-modal"),r=document.getElementById("error-modal-message");n&&r&&(r.textContent=e,n.showModal())}function P(){u(),fetch("/settings/stop",{method:"POST"}).then(e=>{if(e.ok)document.title="Server Stopped",document.body.className="bg-base-100 min-h-screen flex items-center justify-center",document.body.innerHTML=`
+(()=>{var k="nord",y="forest",S="SPROUT_THEME";function x(){return localStorage.getItem(S)||(window.matchMedia?.("(prefers-color-scheme: dark)").matches?y:k)}function E(){return x()===y}function T(){let e=document.getElementById("theme-toggle");e&&(e.checked=E())}function A(e){localStorage.setItem(S,e),document.documentElement.setAttribute("data-theme",e),T()}function b(){A(E()?k:y)}function v(){let e=x();document.documentElement.setAttribute("data-theme",e),localStorage.setItem(S,e)}function I(){T()}function d(){let e=document.getElementById("click-blocker");e&&e.classList.remove("hidden")}function i(){let e=document.getElementById("click-blocker");e&&e.classList.add("hidden")}function f(e){e&&(e.className="status loading loading-spinner loading-xs",e.textContent="",e.title="",e.dataset.errorMessage="",e.onclick=null)}function g(e){e&&(e.className="status status-success",e.title="",e.dataset.errorMessage="",e.onclick=null,setTimeout(()=>{e.classList.contains("status-success")&&(e.className="status hidden")},2e3))}function h(e){let t=e.closest("label");if(t){let n=t.querySelector(".status");if(n)return n}let r=e.closest(".flex");if(r){let n=r.querySelector(".status");if(n)return n}let s=e.closest(".form-control");return s?s.querySelector(".status"):null}function p(e,t){if(!e){a(t);return}e.className="status status-error cursor-pointer",e.title=t,e.dataset.errorMessage=t,e.onclick=()=>a(t)}function a(e){let t=document.getElementById("error-modal"),r=document.getElementById("error-modal-message");t&&r&&(r.textContent=e,t.showModal())}function C(){d(),fetch("/settings/stop",{method:"POST"}).then(e=>{if(e.ok)document.title="Server Stopped",document.body.className="bg-base-100 min-h-screen flex items-center justify-center",document.body.innerHTML=`
                     <div class="text-center">
                         <h1 class="text-2xl font-bold mb-2">Server Stopped</h1>
                         <p class="text-base-content/70">You can close this tab.</p>
                     </div>
-                `;else throw new Error("Failed to stop server")}).catch(e=>{a(),c("Error: "+e.message)})}function N(){let e=document.getElementById("restart-update").checked;document.getElementById("restart-modal").close(),u(),fetch("/settings/restart",{method:"POST",headers:{"Content-Type":"application/json"},body:JSON.stringify({update:e})}).then(n=>{if(n.ok||n.status===202)setTimeout(()=>H(e),3e3);else throw new Error("Failed to restart server")}).catch(n=>{a(),c("Error: "+n.message)})}function H(e=!1){let n=Date.now(),r=3e3,s=3e5,t=()=>{if(Date.now()-n>s){a(),c("Restart timed out. Please check logs or try again.");return}console.log("Polling for restart...",{updateRequested:e,time:Date.now()-n}),fetch("/settings/restart-status?t="+Date.now()).then(o=>o.json()).then(o=>{console.log("Poll response:",o),o.restarted?e&&!o.updated?(console.warn("Restart detected but not updated.",o),a(),c("Restart completed, but the update did not apply. You may already be on the latest version, or the update failed.")):(console.log("Restart success (updated="+o.updated+"), reloading..."),window.location.reload()):setTimeout(t,r)}).catch(o=>{console.error("Poll network error (expected if restarting):",o),setTimeout(t,r)})};t()}async function x(e,n,r){let s=await fetch(e,{method:"POST",headers:{"Content-Type":"application/json"},body:JSON.stringify(n),signal:r});if(!s.ok){let t=await s.text();throw new Error(t||`HTTP ${s.status}`)}return s}function L(e,n,r,s){let t=typeof e=="string"?document.getElementById(e):e;if(!t)return;let o=T(t);t.addEventListener("change",async()=>{h(o);try{await x(n,{[r]:t.value}),w(o),s&&s()}catch(l){c(o,l.message)}})}function m(e,n,r,s=500,t={}){let o=typeof e=="string"?document.getElementById(e):e;if(!o)return;let l=T(o),y=null,d=null;o.addEventListener("input",()=>{clearTimeout(y),d&&d.abort(),y=setTimeout(async()=>{if(!(t.skipEmpty&&!o.value.trim())){d=new AbortController,h(l);try{let i=o.value;if(o.type==="number"&&(i=parseInt(i,10),isNaN(i)))throw new Error("Invalid number");await x(n,{[r]:i},d.signal),w(l),t.onSuccess&&t.onSuccess()}catch(i){i.name!=="AbortError"&&c(l,i.message)}}},s)})}function f(){let e=document.getElementById("restart-required-notice");e&&e.classList.remove("hidden")}function R(){L("settings-log-level","/settings","logLevel",f),m("settings-host","/settings","host",500,{onSuccess:f}),m("settings-port","/settings","port",500,{onSuccess:f}),m("settings-proxy-port","/settings","proxyPort",500,{onSuccess:f})}function B(){R()}C();window.toggleTheme=v;window.stopServer=P;window.restartServer=N;window.blockClicks=u;window.unblockClicks=a;document.addEventListener("DOMContentLoaded",()=>{I(),B()});})();
+                `;else throw new Error("Failed to stop server")}).catch(e=>{i(),a("Error: "+e.message)})}function B(){document.getElementById("reset-modal").close(),d(),fetch("/settings/reset",{method:"POST"}).then(e=>{if(!e.ok)throw new Error("Failed to reset settings");window.location.reload()}).catch(e=>{i(),a("Error: "+e.message)})}function N(){document.getElementById("rollback-modal").close(),d(),fetch("/settings/rollback",{method:"POST"}).then(e=>{if(!e.ok)throw new Error("Failed to roll back settings");window.location.reload()}).catch(e=>{i(),a("Error: "+e.message)})}function L(){let e=document.getElementById("restart-update").checked;document.getElementById("restart-modal").close(),d(),fetch("/settings/restart",{method:"POST",headers:{"Content-Type":"application/json"},body:JSON.stringify({update:e})}).then(t=>{if(t.ok||t.status===202)e&&D(),setTimeout(()=>F(e),3e3);else throw new Error("Failed to restart server")}).catch(t=>{i(),a("Error: "+t.message)})}var P=!1;function D(){let e=document.getElementById("update-modal"),t=document.getElementById("update-log"),r=document.getElementById("update-status");if(!e||!t||!window.EventSource)return;t.textContent="",e.showModal();let s=new EventSource("/settings/update-log");s.onmessage=n=>{t.textContent+=n.data+`
+`,t.scrollTop=t.scrollHeight},s.addEventListener("done",n=>{s.close();let o=JSON.parse(n.data);o.failed?(P=!0,i(),r.textContent="Update failed: "+o.detail,r.className="text-sm text-error"):r.textContent="Update finished, waiting for the server..."}),s.addEventListener("failure",()=>s.close()),s.onerror=()=>{s.readyState===EventSource.CLOSED&&e.close()}}function F(e=!1){let t=Date.now(),r=3e3,s=3e5,n=()=>{if(!P){if(Date.now()-t>s){i(),a("Restart timed out. Please check logs or try again.");return}console.log("Polling for restart...",{updateRequested:e,time:Date.now()-t}),fetch("/settings/restart-status?t="+Date.now()).then(o=>o.json()).then(o=>{console.log("Poll response:",o),o.restarted?e&&!o.updated?(console.warn("Restart detected but not updated.",o),i(),a("Restart completed, but the update did not apply. You may already be on the latest version, or the update failed.")):(console.log("Restart success (updated="+o.updated+"), reloading..."),window.location.reload()):setTimeout(n,r)}).catch(o=>{console.error("Poll network error (expected if restarting):",o),setTimeout(n,r)})}};n()}async function w(e,t,r){let s=await fetch(e,{method:"POST",headers:{"Content-Type":"application/json"},body:JSON.stringify(t),signal:r});if(!s.ok){let n=await s.text(),o=null;try{o=JSON.parse(n)}catch{}if(o&&Array.isArray(o.fields)){let c=new Error(o.fields.map(u=>u.message).join("; ")||o.error);throw c.fields=o.fields,c}throw new Error(n||`HTTP ${s.status}`)}return s}function M(e,t,r,s){let n=typeof e=="string"?document.getElementById(e):e;if(!n)return;let o=h(n);n.addEventListener("change",async()=>{f(o);try{await w(t,{[r]:n.value}),g(o),s&&s()}catch(c){p(o,c.message)}})}function H(e,t,r,s){let n=typeof e=="string"?document.getElementById(e):e;if(!n)return;let o=h(n);n.addEventListener("change",async()=>{f(o);try{await w(t,{[r]:n.checked}),g(o),s&&s()}catch(c){p(o,c.message)}})}function O(e,t,r,s=500,n={}){let o=typeof e=="string"?document.getElementById(e):e;if(!o)return;let c=h(o),u=null,m=null;o.addEventListener("input",()=>{clearTimeout(u),m&&m.abort(),u=setTimeout(async()=>{if(!(n.skipEmpty&&!o.value.trim())){m=new AbortController,f(c);try{let l=o.value;if(o.type==="number"&&(l=parseInt(l,10),isNaN(l)))throw new Error("Invalid number");await w(t,{[r]:l},m.signal),g(c),n.onSuccess&&n.onSuccess()}catch(l){l.name!=="AbortError"&&p(c,l.message)}}},s)})}function J(){let e=document.getElementById("restart-required-notice");e&&e.classList.remove("hidden")}function j(){let e=document.getElementById("settings-port"),t=document.getElementById("settings-proxy-port");if(!e||t&&parseInt(t.value,10)>0)return;let r=new URL(window.location.href);r.port=e.value,setTimeout(()=>{window.location.href=r.toString()},1500)}function q(){document.querySelectorAll("[data-setting]").forEach(e=>{let t=e.dataset.setting,r=t==="port"?j:"live"in e.dataset?void 0:J;e.tagName==="SELECT"?M(e,"/settings",t,r):e.type==="checkbox"?H(e,"/settings",t,r):O(e,"/settings",t,500,{onSuccess:r,skipEmpty:"skipEmpty"in e.dataset})})}function R(){q()}v();window.toggleTheme=b;window.stopServer=C;window.restartServer=L;window.resetSettings=B;window.rollbackSettings=N;window.blockClicks=d;window.unblockClicks=i;document.addEventListener("DOMContentLoaded",()=>{I(),R()});})();
@@ -7,7 +7,8 @@
  * @param {object} body - JSON body
  * @param {AbortSignal} [signal] - Optional abort signal
  * @returns {Promise<Response>}
- * @throws {Error} with error message from response
+ * @throws {Error} with error message from response, and the invalid fields
+ *   as `fields` ([{field, message}]) when the server rejected some values
  */
 export async function postJSON(endpoint, body, signal) {
     const res = await fetch(endpoint, {
@@ -18,6 +19,13 @@ export async function postJSON(endpoint, body, signal) {
     });
     if (!res.ok) {
         const text = await res.text();
+        let data = null;
+        try { data = JSON.parse(text); } catch { /* plain text error */ }
+        if (data && Array.isArray(data.fields)) {
+            const err = new Error(data.fields.map(f => f.message).join('; ') || data.error);
+            err.fields = data.fields;
+            throw err;
+        }
         throw new Error(text || `HTTP ${res.status}`);
     }
     return res;
@@ -1,7 +1,7 @@
 // Form Handlers
-// Generic handlers for selects and text inputs with debouncing
+// Generic handlers for selects, checkboxes and text inputs with debouncing
 
-import { findStatus, showPending, showSuccess, showError } from './ui.js';
+import { findStatus, showPending, showSuccess, showFieldError } from './ui.js';
 import { postJSON } from './api.js';
 
 /**
@@ -26,7 +26,34 @@ export function handleSelect(inputOrId, endpoint, fieldName, onSuccess) {
             showSuccess(status);
             if (onSuccess) onSuccess();
         } catch (e) {
-            showError(status, e.message);
+            showFieldError(status, e.message);
+        }
+    });
+}
+
+/**
+ * Generic handler for checkboxes (immediate POST of the checked state on change)
+ * @param {string|HTMLElement} inputOrId - Input element or ID
+ * @param {string} endpoint - POST endpoint
+ * @param {string} fieldName - JSON field name
+ * @param {Function} [onSuccess] - Optional success callback
+ */
+export function handleToggle(inputOrId, endpoint, fieldName, onSuccess) {
+    const input = typeof inputOrId === 'string'
+        ? document.getElementById(inputOrId)
+        : inputOrId;
+    if (!input) return;
+
+    const status = findStatus(input);
+
+    input.addEventListener('change', async () => {
+        showPending(status);
+        try {
+            await postJSON(endpoint, { [fieldName]: input.checked });
+            showSuccess(status);
+            if (onSuccess) onSuccess();
+        } catch (e) {
+            showFieldError(status, e.message);
         }
     });
 }
@@ -75,7 +102,7 @@ export function handleTextInput(inputOrId, endpoint, fieldName, debounceMs = 500
                 if (opts.onSuccess) opts.onSuccess();
             } catch (e) {
                 if (e.name !== 'AbortError') {
-                    showError(status, e.message);
+                    showFieldError(status, e.message);
                 }
             }
         }, debounceMs);
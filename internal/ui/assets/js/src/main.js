@@ -3,7 +3,7 @@
 
 import { initTheme, setupThemeToggle, toggleTheme } from './theme.js';
 import { blockClicks, unblockClicks } from './ui.js';
-import { stopServer, restartServer } from './server.js';
+import { stopServer, restartServer, resetSettings, rollbackSettings } from './server.js';
 import { initSettings } from './settings.js';
 
 // Initialize theme immediately (before DOM ready) to prevent flash
@@ -13,6 +13,8 @@ initTheme();
 window.toggleTheme = toggleTheme;
 window.stopServer = stopServer;
 window.restartServer = restartServer;
+window.resetSettings = resetSettings;
+window.rollbackSettings = rollbackSettings;
 window.blockClicks = blockClicks;
 window.unblockClicks = unblockClicks;
 
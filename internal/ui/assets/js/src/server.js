@@ -28,6 +28,36 @@ export function stopServer() {
         });
 }
 
+/** Reset every setting to its default, then reload the page to show them */
+export function resetSettings() {
+    document.getElementById('reset-modal').close();
+    blockClicks();
+    fetch('/settings/reset', { method: 'POST' })
+        .then(response => {
+            if (!response.ok) throw new Error('Failed to reset settings');
+            window.location.reload();
+        })
+        .catch(err => {
+            unblockClicks();
+            showError('Error: ' + err.message);
+        });
+}
+
+/** Restore the settings from before the last change, then reload the page to show them */
+export function rollbackSettings() {
+    document.getElementById('rollback-modal').close();
+    blockClicks();
+    fetch('/settings/rollback', { method: 'POST' })
+        .then(response => {
+            if (!response.ok) throw new Error('Failed to roll back settings');
+            window.location.reload();
+        })
+        .catch(err => {
+            unblockClicks();
+            showError('Error: ' + err.message);
+        });
+}
+
 /** Restart the server with options from the restart modal */
 export function restartServer() {
     const updateRequested = document.getElementById('restart-update').checked;
@@ -44,6 +74,7 @@ export function restartServer() {
         .then(response => {
             if (response.ok || response.status === 202) {
                 // Server is restarting, poll for it to come back
+                if (updateRequested) followUpdate();
                 setTimeout(() => pollForRestart(updateRequested), 3000);
             } else {
                 throw new Error('Failed to restart server');
@@ -55,6 +86,44 @@ export function restartServer() {
         });
 }
 
+// Set once the followed update failed, stops polling for the restart
+let updateFailed = false;
+
+/** Show the detached update's output live in the update modal */
+export function followUpdate() {
+    const modal = document.getElementById('update-modal');
+    const logEl = document.getElementById('update-log');
+    const statusEl = document.getElementById('update-status');
+    if (!modal || !logEl || !window.EventSource) return;
+
+    logEl.textContent = '';
+    modal.showModal();
+
+    // reconnects with Last-Event-ID on its own while the server restarts
+    const source = new EventSource('/settings/update-log');
+    source.onmessage = (e) => {
+        logEl.textContent += e.data + '\n';
+        logEl.scrollTop = logEl.scrollHeight;
+    };
+    source.addEventListener('done', (e) => {
+        source.close();
+        const result = JSON.parse(e.data);
+        if (result.failed) {
+            updateFailed = true;
+            unblockClicks();
+            statusEl.textContent = 'Update failed: ' + result.detail;
+            statusEl.className = 'text-sm text-error';
+        } else {
+            statusEl.textContent = 'Update finished, waiting for the server...';
+        }
+    });
+    // no update to follow or the server couldn't read it, polling still reports the outcome
+    source.addEventListener('failure', () => source.close());
+    source.onerror = () => {
+        if (source.readyState === EventSource.CLOSED) modal.close();
+    };
+}
+
 /** Poll for server restart completion */
 export function pollForRestart(updateRequested = false) {
     const startTime = Date.now();
@@ -62,6 +131,7 @@ export function pollForRestart(updateRequested = false) {
     const timeout = 300000; // 5 minutes
 
     const check = () => {
+        if (updateFailed) return;
         if (Date.now() - startTime > timeout) {
             unblockClicks();
             showError('Restart timed out. Please check logs or try again.');
@@ -1,7 +1,7 @@
 // Settings Wiring
 // DOMContentLoaded initialization for all settings controls
 
-import { handleSelect, handleTextInput } from './forms.js';
+import { handleSelect, handleTextInput, handleToggle } from './forms.js';
 
 /** Show restart required notice */
 function showRestartNotice() {
@@ -9,12 +9,30 @@ function showRestartNotice() {
     if (notice) notice.classList.remove('hidden');
 }
 
-/** Wire up settings */
+/** The server moves to a new port on its own (see server.Listen), follow it unless behind a proxy */
+function followPort() {
+    const port = document.getElementById('settings-port');
+    const proxy = document.getElementById('settings-proxy-port');
+    if (!port || (proxy && parseInt(proxy.value, 10) > 0)) return;
+    const url = new URL(window.location.href);
+    url.port = port.value;
+    setTimeout(() => { window.location.href = url.toString(); }, 1500);
+}
+
+/** Wire up every input the page generated for a setting (data-setting holds its key) */
 function wireSettings() {
-    handleSelect('settings-log-level', '/settings', 'logLevel', showRestartNotice);
-    handleTextInput('settings-host', '/settings', 'host', 500, { onSuccess: showRestartNotice });
-    handleTextInput('settings-port', '/settings', 'port', 500, { onSuccess: showRestartNotice });
-    handleTextInput('settings-proxy-port', '/settings', 'proxyPort', 500, { onSuccess: showRestartNotice });
+    document.querySelectorAll('[data-setting]').forEach(input => {
+        const key = input.dataset.setting;
+        // live settings apply on their own (see config.Watch), the port moves the page with it
+        const onSuccess = key === 'port' ? followPort : ('live' in input.dataset ? undefined : showRestartNotice);
+        if (input.tagName === 'SELECT') {
+            handleSelect(input, '/settings', key, onSuccess);
+        } else if (input.type === 'checkbox') {
+            handleToggle(input, '/settings', key, onSuccess);
+        } else {
+            handleTextInput(input, '/settings', key, 500, { onSuccess, skipEmpty: 'skipEmpty' in input.dataset });
+        }
+    });
 }
 
 /** Initialize all settings on DOMContentLoaded */
@@ -18,6 +18,7 @@ export function showPending(statusEl) {
     if (!statusEl) return;
     statusEl.className = 'status loading loading-spinner loading-xs';
     statusEl.textContent = '';
+    statusEl.title = '';
     statusEl.dataset.errorMessage = '';
     statusEl.onclick = null;
 }
@@ -26,6 +27,7 @@ export function showPending(statusEl) {
 export function showSuccess(statusEl) {
     if (!statusEl) return;
     statusEl.className = 'status status-success';
+    statusEl.title = '';
     statusEl.dataset.errorMessage = '';
     statusEl.onclick = null;
     setTimeout(() => {
@@ -57,6 +59,18 @@ export function findStatus(input) {
     return null;
 }
 
+/** Show a red circle on the status element, clicking it shows the message */
+export function showFieldError(statusEl, message) {
+    if (!statusEl) {
+        showError(message);
+        return;
+    }
+    statusEl.className = 'status status-error cursor-pointer';
+    statusEl.title = message;
+    statusEl.dataset.errorMessage = message;
+    statusEl.onclick = () => showError(message);
+}
+
 /** Show error modal with message */
 export function showError(message) {
     const modal = document.getElementById('error-modal');
@@ -9,7 +9,10 @@ import (
 	"io"
 	"io/fs"
 	"net/http"
+	"os"
 	"path/filepath"
+	"sort"
+	"sprout/pkg/humanize"
 	"strings"
 )
 
@@ -63,6 +66,9 @@ type UI struct {
 
 	// URL path -> Asset for routing
 	routeMap map[string]*Asset
+
+	// devDir is set in dev mode, templates and assets are then read from disk on every use
+	devDir string
 }
 
 // New parses all embedded templates and loads static assets from the manifest.
@@ -113,12 +119,9 @@ func New() (*UI, error) {
 		return "/assets/" + relPath
 	}
 
-	// Parse templates with helper functions
-	t, err := template.New("").Funcs(template.FuncMap{
-		"assetPath": assetPath,
-	}).ParseFS(templateFS, "templates/*.html")
+	t, err := parseTemplates(templateFS, assetPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to parse templates: %w", err)
+		return nil, err
 	}
 
 	return &UI{
@@ -130,15 +133,80 @@ func New() (*UI, error) {
 	}, nil
 }
 
+// NewDev loads templates and assets from dir (the internal/ui source directory)
+// instead of the embedded copies. Templates are re-parsed on every render and
+// assets read on every request, uncached and without hashes, so edits (and
+// tailwind --watch output) show up on refresh without rebuilding.
+func NewDev(dir string) (*UI, error) {
+	if _, err := os.Stat(filepath.Join(dir, "templates")); err != nil {
+		return nil, fmt.Errorf("dev ui dir %s has no templates: %w", dir, err)
+	}
+	ui := &UI{
+		Assets:   make(map[string]*Asset),
+		routeMap: make(map[string]*Asset),
+		devDir:   dir,
+		CSS:      &Asset{RelPath: "css/output.css", URLPath: "/assets/css/output.css", ContentType: detectContentType(".css")},
+		JS:       &Asset{RelPath: "js/output.js", URLPath: "/assets/js/output.js", ContentType: detectContentType(".js")},
+	}
+	// parse once up front so a broken template fails startup, not the first request
+	var err error
+	if ui.templates, err = ui.devTemplates(); err != nil {
+		return nil, err
+	}
+	return ui, nil
+}
+
+func (ui *UI) devTemplates() (*template.Template, error) {
+	return parseTemplates(os.DirFS(ui.devDir), func(relPath string) string { return "/assets/" + relPath })
+}
+
+// parseTemplates parses templates/*.html from fsys with the helper functions.
+// assetPath must be defined before parsing.
+func parseTemplates(fsys fs.FS, assetPath func(string) string) (*template.Template, error) {
+	t, err := template.New("").Funcs(template.FuncMap{
+		"assetPath": assetPath,
+		"bytes":     humanize.Bytes,
+		"duration":  humanize.Duration,
+		"ago":       humanize.Ago,
+	}).ParseFS(fsys, "templates/*.html")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse templates: %w", err)
+	}
+	return t, nil
+}
+
 // Execute renders a template by name to the writer.
 func (ui *UI) Execute(w io.Writer, name string, data any) error {
+	if ui.devDir != "" {
+		t, err := ui.devTemplates()
+		if err != nil {
+			return err
+		}
+		return t.ExecuteTemplate(w, name, data)
+	}
 	return ui.templates.ExecuteTemplate(w, name, data)
 }
 
+// TemplateNames returns the names of all parsed templates, sorted.
+func (ui *UI) TemplateNames() []string {
+	var names []string
+	for _, t := range ui.templates.Templates() {
+		if t.Name() != "" {
+			names = append(names, t.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
 // ServeAsset returns an http.HandlerFunc that routes to the correct asset
 // based on the URL path. Mount this at "/assets/*".
 func (ui *UI) ServeAsset(w http.ResponseWriter, r *http.Request) {
 	path := r.URL.Path
+	if ui.devDir != "" {
+		ui.serveDevAsset(w, r)
+		return
+	}
 	if asset, ok := ui.routeMap[path]; ok {
 		asset.Handler()(w, r)
 		return
@@ -146,6 +214,23 @@ func (ui *UI) ServeAsset(w http.ResponseWriter, r *http.Request) {
 	http.NotFound(w, r)
 }
 
+// serveDevAsset serves an unhashed asset straight from disk.
+func (ui *UI) serveDevAsset(w http.ResponseWriter, r *http.Request) {
+	relPath := strings.TrimPrefix(r.URL.Path, "/assets/")
+	if !fs.ValidPath(relPath) || isIgnored(relPath) {
+		http.NotFound(w, r)
+		return
+	}
+	data, err := os.ReadFile(filepath.Join(ui.devDir, "assets", filepath.FromSlash(relPath)))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", detectContentType(relPath))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(data)
+}
+
 // isIgnored checks if a path matches any ignore pattern.
 func isIgnored(relPath string) bool {
 	for _, pattern := range ignorePatterns {
@@ -0,0 +1,102 @@
+package ui_test
+
+import (
+	"html/template"
+	"path/filepath"
+	"sprout/internal/platform/database/config"
+	"sprout/internal/platform/http/router/settings"
+	"sprout/internal/types"
+	"sprout/internal/ui"
+	"sprout/internal/ui/uitest"
+	"testing"
+	"time"
+)
+
+// templateCases holds representative data for every embedded template.
+// Adding a template without a case here fails TestTemplatesGolden.
+var templateCases = map[string]map[string]any{
+	"settings.html": {
+		"defaults": settingsData(nil),
+		"update-available": settingsData(map[string]any{
+			"UpdateAvailable": true,
+			"LastUpdateCheck": time.Now().Add(-2*time.Hour - time.Minute),
+			"Form": settingsForm(func(cfg *types.Configuration) {
+				cfg.LogLevel, cfg.Host, cfg.ProxyPort = "ERROR", "example.com", 443
+				cfg.Backup = types.BackupConfig{Schedule: "0 3 * * *", KeepLast: 7, KeepWeekly: 4}
+				cfg.ReleaseToken, cfg.AutoUpdate = "hunter2", true
+			}),
+		}),
+		"config-file": settingsData(map[string]any{
+			"FileKeys": []string{"backup.schedule", "port"},
+			"Form":     settingsForm(nil, &config.File{Path: "/home/sprout/.sprout/config.yaml", Keys: []string{"backup.schedule", "port"}}),
+		}),
+		"env": settingsData(map[string]any{
+			"EnvKeys": []string{"logLevel"},
+			"Form":    settingsForm(nil, &config.File{Path: config.EnvPath, Keys: []string{"logLevel"}}),
+		}),
+		"history": settingsData(map[string]any{
+			"CanRollback": true,
+			"History": []config.Revision{
+				{Time: time.Now().Add(-5 * time.Minute), Source: config.SourceWeb, Fields: []config.RevisionField{{Key: "port", Old: "8080", New: "9000"}}},
+				{Time: time.Now().Add(-26 * time.Hour), Source: config.SourceCLI, Profile: "dev", Fields: []config.RevisionField{
+					{Key: "logLevel", Old: "WARN", New: "DEBUG"},
+					{Key: "releaseToken", Old: "", New: "*****"},
+				}},
+			},
+		}),
+	},
+}
+
+func settingsData(overrides map[string]any) map[string]any {
+	data := map[string]any{
+		"CSS":             "/assets/css/output.css",
+		"JS":              "/assets/js/output.js",
+		"Favicon":         template.URL("data:,"),
+		"Title":           "Settings",
+		"Version":         "v1.0.0",
+		"UpdateAvailable": false,
+		"LastUpdateCheck": time.Time{},
+		"Form":            settingsForm(nil),
+		"FileKeys":        []string(nil),
+		"FileName":        "config.yaml",
+		"History":         []config.Revision(nil),
+		"EnvKeys":         []string(nil),
+		"CanRollback":     false,
+	}
+	for k, v := range overrides {
+		data[k] = v
+	}
+	return data
+}
+
+// settingsForm returns the settings page's inputs for fixed defaults changed
+// by fn, if not nil.
+func settingsForm(fn func(cfg *types.Configuration), layers ...*config.File) []settings.FormGroup {
+	cfg := types.DefaultConfig()
+	cfg.LogLevel, cfg.Port, cfg.Host = "warn", 8080, "localhost"
+	if fn != nil {
+		fn(&cfg)
+	}
+	return settings.Form(&cfg, layers)
+}
+
+func TestTemplatesGolden(t *testing.T) {
+	u, err := ui.New()
+	if err != nil {
+		t.Fatalf("ui.New() failed: %v", err)
+	}
+
+	for _, name := range u.TemplateNames() {
+		cases, ok := templateCases[name]
+		if !ok {
+			t.Errorf("template %s has no test case, add one to templateCases", name)
+			continue
+		}
+		for caseName, data := range cases {
+			t.Run(name+"/"+caseName, func(t *testing.T) {
+				got := uitest.Render(t, u, name, data)
+				uitest.AssertGolden(t, filepath.Join("testdata", name, caseName+".golden"), got)
+			})
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// Package uitest renders embedded templates in tests and compares the output
+// against golden files, so template errors and regressions show up in
+// `go test` instead of as a 500 on the settings page.
+//
+// Regenerate golden files after an intended change with:
+//
+//	go test ./internal/ui/... -update
+package uitest
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sprout/internal/ui"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files with the current output")
+
+// assetHash matches the cache busting hash in asset URLs (e.g. "output.0123456789abcdef.css"),
+// which changes with every asset build and would otherwise make golden files flaky.
+var assetHash = regexp.MustCompile(`\.[0-9a-f]{16}\.`)
+
+// Render executes the named template with data, failing the test on error.
+// Asset hashes in the output are replaced with "HASH".
+func Render(t testing.TB, u *ui.UI, name string, data any) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := u.Execute(&buf, name, data); err != nil {
+		t.Fatalf("failed to render %s: %v", name, err)
+	}
+	return assetHash.ReplaceAll(buf.Bytes(), []byte(".HASH."))
+}
+
+// AssertGolden compares got with the golden file at path, or writes it when
+// -update is set. A missing golden file is an error, run with -update to create it.
+func AssertGolden(t testing.TB, path string, got []byte) {
+	t.Helper()
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to create golden dir: %v", err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatalf("failed to write golden file: %v", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read golden file (run with -update to create it): %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs from golden file %s (run with -update if intended):\n%s", t.Name(), path, firstDiff(want, got))
+	}
+}
+
+// firstDiff describes the first differing line, enough to find the regression without dumping whole pages.
+func firstDiff(want, got []byte) string {
+	wl, gl := bytes.Split(want, []byte("\n")), bytes.Split(got, []byte("\n"))
+	for i := 0; i < len(wl) || i < len(gl); i++ {
+		var w, g []byte
+		if i < len(wl) {
+			w = wl[i]
+		}
+		if i < len(gl) {
+			g = gl[i]
+		}
+		if !bytes.Equal(w, g) {
+			return fmt.Sprintf("line %d:\n  want: %s\n  got:  %s", i+1, w, g)
+		}
+	}
+	return "no line differs (trailing bytes?)"
+}
@@ -0,0 +1,92 @@
+// Package bspatch applies binary patches in the format of Colin Percival's
+// bsdiff 4 ("BSDIFF40"), as written by the bsdiff tool.
+//
+// A patch is a 32 byte header followed by three bzip2 compressed blocks:
+//
+//	header  "BSDIFF40", control block length, diff block length, new size
+//	control triples (x, y, z): add x diff bytes to old, copy y extra bytes, seek old by z
+//	diff    bytes added to the old file
+//	extra   bytes copied as is
+//
+// Numbers are 8 byte little endian sign-magnitude integers.
+package bspatch
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const magic = "BSDIFF40"
+
+// ErrCorrupt means the patch is malformed or doesn't fit the old file.
+var ErrCorrupt = errors.New("corrupt patch")
+
+// Apply returns old with patch applied. maxSize bounds the new file's size
+// declared in the header, 0 = no limit.
+func Apply(old, patch []byte, maxSize int64) ([]byte, error) {
+	if len(patch) < 32 || string(patch[:8]) != magic {
+		return nil, fmt.Errorf("%w: not a bsdiff 4 patch", ErrCorrupt)
+	}
+	ctrlLen, diffLen, newSize := offtin(patch[8:]), offtin(patch[16:]), offtin(patch[24:])
+	if ctrlLen < 0 || diffLen < 0 || newSize < 0 || 32+ctrlLen+diffLen > int64(len(patch)) {
+		return nil, fmt.Errorf("%w: bad header", ErrCorrupt)
+	}
+	if maxSize > 0 && newSize > maxSize {
+		return nil, fmt.Errorf("%w: new size %d exceeds %d", ErrCorrupt, newSize, maxSize)
+	}
+	body := patch[32:]
+	ctrl := bzip2.NewReader(bytes.NewReader(body[:ctrlLen]))
+	diff := bzip2.NewReader(bytes.NewReader(body[ctrlLen : ctrlLen+diffLen]))
+	extra := bzip2.NewReader(bytes.NewReader(body[ctrlLen+diffLen:]))
+
+	out := make([]byte, newSize)
+	var oldPos, newPos int64
+	var buf [24]byte
+	for newPos < newSize {
+		if _, err := io.ReadFull(ctrl, buf[:]); err != nil {
+			return nil, fmt.Errorf("%w: control block: %w", ErrCorrupt, err)
+		}
+		x, y, z := offtin(buf[0:]), offtin(buf[8:]), offtin(buf[16:])
+		if x < 0 || y < 0 || newPos+x > newSize {
+			return nil, fmt.Errorf("%w: bad control entry", ErrCorrupt)
+		}
+
+		// diff bytes, added to old where old has them
+		if _, err := io.ReadFull(diff, out[newPos:newPos+x]); err != nil {
+			return nil, fmt.Errorf("%w: diff block: %w", ErrCorrupt, err)
+		}
+		for i := int64(0); i < x; i++ {
+			if p := oldPos + i; p >= 0 && p < int64(len(old)) {
+				out[newPos+i] += old[p]
+			}
+		}
+		newPos += x
+		oldPos += x
+
+		// extra bytes
+		if newPos+y > newSize {
+			return nil, fmt.Errorf("%w: bad control entry", ErrCorrupt)
+		}
+		if _, err := io.ReadFull(extra, out[newPos:newPos+y]); err != nil {
+			return nil, fmt.Errorf("%w: extra block: %w", ErrCorrupt, err)
+		}
+		newPos += y
+		oldPos += z
+	}
+	return out, nil
+}
+
+// offtin decodes an 8 byte little endian sign-magnitude integer.
+func offtin(b []byte) int64 {
+	y := int64(b[7] & 0x7f)
+	for i := 6; i >= 0; i-- {
+		y = y<<8 | int64(b[i])
+	}
+	if b[7]&0x80 != 0 {
+		y = -y
+	}
+	return y
+}
@@ -0,0 +1,47 @@
+package bspatch
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+// built with Python's bz2: one control entry adding the diff to all but the
+// last byte of old, then the rest of new as extra bytes
+const patchHex = "42534449464634302e000000000000002b000000000000003c00000000000000425a6839314159265359965aa19f000005f00048080800002020002129a6d066817c0ae177245385090965aa19f0425a683931415926535942d2802b000000e00060040400200030cd34126836932717724538509042d2802b425a6839314159265359232bc7850000025180001040042a61cc802000229a3d2198a100000efac2622a7ca094c7c5dc914e142408caf1e140"
+
+func TestApply(t *testing.T) {
+	old := []byte("hello sprout, version 1.0.0 of the binary\n")
+	want := "hello sprout, version 1.1.0 of the binary, now with patches\n"
+	patch, _ := hex.DecodeString(patchHex)
+
+	got, err := Apply(old, patch, 0)
+	if err != nil || string(got) != want {
+		t.Fatalf("Apply() = %q, %v, want %q", got, err, want)
+	}
+
+	if _, err := Apply(old, patch, 10); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Apply() over maxSize = %v, want ErrCorrupt", err)
+	}
+	if _, err := Apply(old, patch[:60], 0); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Apply() truncated = %v, want ErrCorrupt", err)
+	}
+	if _, err := Apply(old, []byte("BSDIFF41"+string(patch[8:])), 0); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("Apply() bad magic = %v, want ErrCorrupt", err)
+	}
+}
+
+func TestOfftin(t *testing.T) {
+	for _, tt := range []struct {
+		b    [8]byte
+		want int64
+	}{
+		{[8]byte{0x2b}, 43},
+		{[8]byte{0x01, 0x01}, 257},
+		{[8]byte{0x05, 0, 0, 0, 0, 0, 0, 0x80}, -5},
+	} {
+		if got := offtin(tt.b[:]); got != tt.want {
+			t.Errorf("offtin(%x) = %d, want %d", tt.b, got, tt.want)
+		}
+	}
+}
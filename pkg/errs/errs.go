@@ -0,0 +1,168 @@
+// Package errs classifies errors by kind so the edges (HTTP handlers, the CLI)
+// can pick a status code, exit code, and user facing message without string
+// matching.
+//
+// Kinds survive wrapping, so keep adding context with fmt.Errorf("...: %w", err)
+// as usual and only classify where the kind is known:
+//
+//	if kv.IsNotFound(err) {
+//		return errs.Wrap(errs.NotFound, err, "config not found")
+//	}
+//	...
+//	xhttp.Error(ctx, w, errs.HTTP(err)) // 404 "config not found"
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/Data-Corruption/stdx/xhttp"
+)
+
+type Kind int
+
+const (
+	Internal    Kind = iota // bug or unexpected failure, the default for unclassified errors
+	NotFound                // the thing asked for doesn't exist
+	Invalid                 // bad input, retrying the same request won't help
+	Conflict                // clashes with current state (e.g. operation already running)
+	Unavailable             // not possible right now or in this build, may work later / elsewhere
+)
+
+var kinds = [...]struct {
+	name   string
+	status int
+	exit   int // sysexits.h
+	msg    string
+}{
+	Internal:    {"internal", http.StatusInternalServerError, 70, "internal error"}, // EX_SOFTWARE
+	NotFound:    {"not found", http.StatusNotFound, 66, "not found"},                // EX_NOINPUT
+	Invalid:     {"invalid", http.StatusBadRequest, 65, "invalid request"},          // EX_DATAERR
+	Conflict:    {"conflict", http.StatusConflict, 75, "conflict"},                  // EX_TEMPFAIL
+	Unavailable: {"unavailable", http.StatusServiceUnavailable, 69, "unavailable"},  // EX_UNAVAILABLE
+}
+
+func (k Kind) valid() bool { return k >= 0 && int(k) < len(kinds) }
+
+func (k Kind) String() string {
+	if !k.valid() {
+		return fmt.Sprintf("Kind(%d)", int(k))
+	}
+	return kinds[k].name
+}
+
+// HTTPStatus returns the response status for the kind.
+func (k Kind) HTTPStatus() int {
+	if !k.valid() {
+		return http.StatusInternalServerError
+	}
+	return kinds[k].status
+}
+
+// ExitCode returns the process exit code for the kind (sysexits.h values).
+func (k Kind) ExitCode() int {
+	if !k.valid() {
+		return 1
+	}
+	return kinds[k].exit
+}
+
+// Error is a classified error. Msg is shown to users (HTTP response body, CLI
+// output) so it must not leak internals, Err carries the details for logs.
+//
+// It intentionally has no ExitCode method, urfave/cli would otherwise os.Exit
+// from inside Run and skip the app's cleanup. Use [ExitCode] in main instead.
+type Error struct {
+	Kind Kind
+	Msg  string
+	Err  error
+}
+
+func (e *Error) Error() string {
+	switch {
+	case e.Err == nil:
+		return e.Msg
+	case e.Msg == "":
+		return e.Err.Error()
+	default:
+		return e.Msg + ": " + e.Err.Error()
+	}
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// New returns a classified error with no underlying cause.
+func New(kind Kind, msg string) error {
+	return &Error{Kind: kind, Msg: msg}
+}
+
+// Wrap classifies err. Returns nil if err is nil.
+func Wrap(kind Kind, err error, msg string) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Msg: msg, Err: err}
+}
+
+// KindOf returns the kind of the outermost [Error] in err's chain, [Internal] if there is none.
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return Internal
+}
+
+// Is reports whether err is classified as kind.
+func Is(err error, kind Kind) bool {
+	return err != nil && KindOf(err) == kind
+}
+
+// Message returns the user facing message for err, falling back to the
+// kind's generic message so internals are never exposed.
+func Message(err error) string {
+	var e *Error
+	if errors.As(err, &e) && e.Msg != "" {
+		return e.Msg
+	}
+	return kinds[KindOf(err)].msg
+}
+
+// HTTP converts err for [xhttp.Error]. An existing [xhttp.Err] in the chain
+// is kept as is, otherwise the status and message come from the kind.
+func HTTP(err error) error {
+	if err == nil {
+		return nil
+	}
+	var he *xhttp.Err
+	if errors.As(err, &he) {
+		return err
+	}
+	return &xhttp.Err{Code: KindOf(err).HTTPStatus(), Msg: Message(err), Err: err}
+}
+
+// Status is an exit status that isn't a failure, for commands reporting a
+// result through it (e.g. `update --check` when outdated). Main exits with it
+// without printing anything.
+type Status int
+
+func (s Status) Error() string { return fmt.Sprintf("exit status %d", int(s)) }
+
+// IsStatus reports whether err is a [Status].
+func IsStatus(err error) bool {
+	var s Status
+	return errors.As(err, &s)
+}
+
+// ExitCode returns the process exit code for err, 0 if nil.
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
+	var s Status
+	if errors.As(err, &s) {
+		return int(s)
+	}
+	return KindOf(err).ExitCode()
+}
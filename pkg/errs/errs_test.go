@@ -0,0 +1,54 @@
+package errs
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Data-Corruption/stdx/xhttp"
+)
+
+func TestClassification(t *testing.T) {
+	cause := errors.New("disk on fire")
+	cases := []struct {
+		name   string
+		err    error
+		kind   Kind
+		status int
+		msg    string
+		exit   int
+	}{
+		{"unclassified", cause, Internal, 500, "internal error", 70},
+		{"wrapped kind", fmt.Errorf("loading: %w", Wrap(NotFound, cause, "no such thing")), NotFound, 404, "no such thing", 66},
+		{"outermost wins", Wrap(Internal, Wrap(NotFound, cause, "inner"), "outer"), Internal, 500, "outer", 70},
+		{"generic message", Wrap(Conflict, cause, ""), Conflict, 409, "conflict", 75},
+		{"xhttp kept", &xhttp.Err{Code: 418, Msg: "teapot"}, Internal, 418, "teapot", 70},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := KindOf(tc.err); got != tc.kind {
+				t.Errorf("KindOf = %v, want %v", got, tc.kind)
+			}
+			if got := ExitCode(tc.err); got != tc.exit {
+				t.Errorf("ExitCode = %d, want %d", got, tc.exit)
+			}
+			var he *xhttp.Err
+			if !errors.As(HTTP(tc.err), &he) || he.Code != tc.status || he.Msg != tc.msg {
+				t.Errorf("HTTP = %+v, want %d %q", he, tc.status, tc.msg)
+			}
+			if tc.kind != Internal && !errors.Is(tc.err, cause) {
+				t.Errorf("cause lost in chain")
+			}
+		})
+	}
+	if HTTP(nil) != nil || ExitCode(nil) != 0 || Wrap(Invalid, nil, "x") != nil {
+		t.Errorf("nil errors should stay nil")
+	}
+	if got := Kind(99).HTTPStatus(); got != http.StatusInternalServerError {
+		t.Errorf("unknown kind status = %d", got)
+	}
+	if st := fmt.Errorf("checking: %w", Status(100)); ExitCode(st) != 100 || !IsStatus(st) || IsStatus(cause) {
+		t.Errorf("Status exit code = %d", ExitCode(st))
+	}
+}
@@ -0,0 +1,138 @@
+// Package humanize formats sizes, durations, and times for people, shared by
+// CLI output and the UI templates (see ui.FuncMap).
+package humanize
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+)
+
+var byteUnits = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+
+// Bytes formats n in binary units, e.g. 512 B, 1.5 KiB, 12 MiB.
+// One decimal below 10 of a unit, none above.
+func Bytes(n int64) string {
+	if n < 0 {
+		if n == math.MinInt64 {
+			n++ // -n would overflow, a byte less doesn't show in EiB
+		}
+		return "-" + Bytes(-n)
+	}
+	if n < 1024 {
+		return strconv.FormatInt(n, 10) + " B"
+	}
+	v, i := float64(n), 0
+	for v >= 1024 && i < len(byteUnits)-1 {
+		v /= 1024
+		i++
+	}
+	return trimFloat(v) + " " + byteUnits[i]
+}
+
+// Duration formats d with its two largest units, e.g. 1h 5m, 2m 30s, 1.2s, 150ms.
+func Duration(d time.Duration) string {
+	if d < 0 {
+		if d == math.MinInt64 {
+			d++ // -d would overflow, a nanosecond less doesn't show in days
+		}
+		return "-" + Duration(-d)
+	}
+	switch {
+	case d < time.Microsecond:
+		return strconv.FormatInt(int64(d), 10) + "ns"
+	case d < time.Millisecond:
+		return trimFloat(float64(d)/float64(time.Microsecond)) + "µs"
+	case d < time.Second:
+		return trimFloat(float64(d)/float64(time.Millisecond)) + "ms"
+	case d < time.Minute:
+		return trimFloat(d.Seconds()) + "s"
+	}
+
+	units := []struct {
+		size time.Duration
+		name string
+	}{{24 * time.Hour, "d"}, {time.Hour, "h"}, {time.Minute, "m"}, {time.Second, "s"}}
+	for i, u := range units[:3] {
+		if d < u.size {
+			continue
+		}
+		major := d / u.size
+		minor := (d % u.size) / units[i+1].size
+		if minor == 0 {
+			return fmt.Sprintf("%d%s", major, u.name)
+		}
+		return fmt.Sprintf("%d%s %d%s", major, u.name, minor, units[i+1].name)
+	}
+	return d.String() // unreachable, d >= 1m always matches
+}
+
+// RelTime formats t relative to now, e.g. "just now", "5 minutes ago",
+// "in 2 days". The zero time is "never".
+func RelTime(t, now time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	d := now.Sub(t)
+	future := d < 0
+	if future {
+		d = -max(d, -math.MaxInt64) // Sub saturates at the minimum, which can't be negated
+	}
+	if d < 10*time.Second {
+		return "just now"
+	}
+
+	var n int64
+	var unit string
+	switch {
+	case d < time.Minute:
+		n, unit = int64(d/time.Second), "second"
+	case d < time.Hour:
+		n, unit = int64(d/time.Minute), "minute"
+	case d < 24*time.Hour:
+		n, unit = int64(d/time.Hour), "hour"
+	case d < 30*24*time.Hour:
+		n, unit = int64(d/(24*time.Hour)), "day"
+	case d < 365*24*time.Hour:
+		n, unit = int64(d/(30*24*time.Hour)), "month"
+	default:
+		n, unit = int64(d/(365*24*time.Hour)), "year"
+	}
+	if n != 1 {
+		unit += "s"
+	}
+	if future {
+		return fmt.Sprintf("in %d %s", n, unit)
+	}
+	return fmt.Sprintf("%d %s ago", n, unit)
+}
+
+// Ago is [RelTime] relative to time.Now().
+func Ago(t time.Time) string {
+	return RelTime(t, time.Now())
+}
+
+// Rate formats count per second over d with a unit, e.g. Rate(300, time.Minute, "req") = "5 req/s".
+func Rate(count float64, d time.Duration, unit string) string {
+	if d <= 0 {
+		return "0 " + unit + "/s"
+	}
+	return trimFloat(count/d.Seconds()) + " " + unit + "/s"
+}
+
+// ByteRate formats a transfer rate, e.g. ByteRate(3<<20, 2*time.Second) = "1.5 MiB/s".
+func ByteRate(n int64, d time.Duration) string {
+	if d <= 0 {
+		return "0 B/s"
+	}
+	return Bytes(int64(float64(n)/d.Seconds())) + "/s"
+}
+
+// trimFloat prints one decimal below 10, none above, and drops a trailing ".0".
+func trimFloat(v float64) string {
+	if math.Abs(v) >= 10 {
+		return strconv.FormatFloat(math.Round(v), 'f', 0, 64)
+	}
+	return strconv.FormatFloat(math.Round(v*10)/10, 'f', -1, 64)
+}
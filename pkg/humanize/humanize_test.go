@@ -0,0 +1,41 @@
+package humanize
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestFormatting(t *testing.T) {
+	now := time.Date(2025, 6, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct{ got, want string }{
+		{Bytes(0), "0 B"},
+		{Bytes(1023), "1023 B"},
+		{Bytes(1536), "1.5 KiB"},
+		{Bytes(12 << 20), "12 MiB"},
+		{Bytes(-2048), "-2 KiB"},
+		{Bytes(math.MinInt64), "-8 EiB"},
+		{Duration(150 * time.Millisecond), "150ms"},
+		{Duration(1234 * time.Millisecond), "1.2s"},
+		{Duration(150 * time.Second), "2m 30s"},
+		{Duration(time.Hour + 5*time.Minute + 9*time.Second), "1h 5m"},
+		{Duration(49 * time.Hour), "2d 1h"},
+		{Duration(3 * time.Hour), "3h"},
+		{Duration(math.MinInt64), "-106751d 23h"},
+		{RelTime(time.Time{}, now), "never"},
+		{RelTime(now.Add(-3*time.Second), now), "just now"},
+		{RelTime(now.Add(-90*time.Second), now), "1 minute ago"},
+		{RelTime(now.Add(-5*time.Hour), now), "5 hours ago"},
+		{RelTime(now.Add(48*time.Hour), now), "in 2 days"},
+		{RelTime(now.Add(-400*24*time.Hour), now), "1 year ago"},
+		{RelTime(now.AddDate(1000, 0, 0), now), "in 292 years"},
+		{Rate(300, time.Minute, "req"), "5 req/s"},
+		{ByteRate(3<<20, 2*time.Second), "1.5 MiB/s"},
+		{ByteRate(1, 0), "0 B/s"},
+	}
+	for _, tc := range cases {
+		if tc.got != tc.want {
+			t.Errorf("got %q, want %q", tc.got, tc.want)
+		}
+	}
+}
@@ -1,76 +1,291 @@
 package migrator
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"time"
 
-	"github.com/Data-Corruption/lmdb-go/lmdb"
 	"github.com/Data-Corruption/stdx/xlog"
 )
 
-// Operation defines the actual database modification.
-type Operation func(txn *lmdb.Txn) error
+// ErrUnknownVersion is returned for a current version that isn't one of the
+// steps, e.g. a database migrated by a newer build.
+var ErrUnknownVersion = errors.New("version not found in migration history")
+
+// ErrHistoryChanged is returned by Verify when an applied step no longer
+// matches its record.
+var ErrHistoryChanged = errors.New("applied migration was changed")
+
+// Operation defines the actual database modification, on the transaction
+// type T of whatever store is being migrated.
+type Operation[T any] func(txn T) error
+
+// BatchOperation migrates a bounded part of the data, starting at cursor (nil
+// for the first batch). It returns the cursor the next batch continues from,
+// nil (or empty) once there's nothing left.
+type BatchOperation[T any] func(txn T, cursor []byte) (next []byte, err error)
 
 // Migration represents a single version step.
-type Migration struct {
-	ID   string    // e.g., "v1.0.0", "20231012_add_users"
-	Desc string    // Human readable description for logs
-	Up   Operation // The function to execute
+type Migration[T any] struct {
+	ID    string            // e.g., "v1.0.0", "20231012_add_users"
+	Desc  string            // Human readable description for logs
+	Up    Operation[T]      // The function to execute
+	Batch BatchOperation[T] // Instead of Up for steps run in batches, see AddBatched
+}
+
+// Sum returns a checksum of the step's ID and description, kept in its
+// Applied record to notice an edited step.
+func (s Migration[T]) Sum() string {
+	h := sha256.Sum256([]byte(s.ID + "\x00" + s.Desc))
+	return hex.EncodeToString(h[:])
+}
+
+// Applied records a step that was run, stored by the caller next to the
+// current version (see History and Verify).
+type Applied struct {
+	ID  string `json:"id"`
+	Sum string `json:"sum"`
+}
+
+// EventKind says what an Event reports.
+type EventKind int
+
+const (
+	StepStarted  EventKind = iota // not repeated when a batched step resumes at a cursor
+	StepBatch                     // a batch of a batched step ran
+	StepFinished                  // the step is applied
+	StepFailed                    // the step returned Err
+)
+
+// Event is passed to the OnProgress callback as steps run.
+type Event struct {
+	Kind     EventKind
+	ID       string
+	Desc     string
+	Duration time.Duration // of the step (StepFinished) or the batch (StepBatch), within this run
+	Err      error         // StepFailed
+}
+
+// StepResult is a step applied by a run.
+type StepResult struct {
+	ID       string        `json:"id"`
+	Desc     string        `json:"desc"`
+	Duration time.Duration `json:"duration"`
+	Batches  int           `json:"batches,omitempty"` // for batched steps, within this run
+}
+
+// Result describes what a run did.
+type Result struct {
+	From    string       `json:"from"`
+	To      string       `json:"to"`      // version reached, also on error
+	Applied []StepResult `json:"applied"` // finished steps, in order
+	Skipped int          `json:"skipped"` // steps already applied before From
+
+	// RunPartial only: the cursor the unfinished batched step continues from
+	// (empty once nothing is left) and what this call did of it.
+	Cursor  []byte      `json:"-"`
+	Partial *StepResult `json:"-"`
+}
+
+// Merge adds the result of the following RunPartial call to r, folding the
+// batches of a step that spans calls into one StepResult.
+func (r *Result) Merge(next *Result) {
+	if p := r.Partial; p != nil {
+		if len(next.Applied) > 0 && next.Applied[0].ID == p.ID {
+			next.Applied[0].Batches += p.Batches
+			next.Applied[0].Duration += p.Duration
+		} else if next.Partial != nil && next.Partial.ID == p.ID {
+			p.Batches += next.Partial.Batches
+			p.Duration += next.Partial.Duration
+			next.Partial = p
+		}
+	}
+	r.Partial = next.Partial
+	r.Applied = append(r.Applied, next.Applied...)
+	r.To, r.Cursor = next.To, next.Cursor
 }
 
 // Migrator manages the execution of migrations.
-type Migrator struct {
-	steps []Migration
+type Migrator[T any] struct {
+	steps    []Migration[T]
+	progress func(Event)
 }
 
 // New creates a Migrator instance with an empty migration list.
-func New() *Migrator {
-	return &Migrator{
-		steps: make([]Migration, 0),
+func New[T any]() *Migrator[T] {
+	return &Migrator[T]{
+		steps: make([]Migration[T], 0),
+	}
+}
+
+// OnProgress sets fn to be called as steps start, run batches and finish,
+// e.g. to render per-step progress. Returns m for chaining.
+func (m *Migrator[T]) OnProgress(fn func(Event)) *Migrator[T] {
+	m.progress = fn
+	return m
+}
+
+func (m *Migrator[T]) emit(ev Event) {
+	if m.progress != nil {
+		m.progress(ev)
 	}
 }
 
 // Add registers a new migration step.
 // Order matters! Call this in the exact order you want migrations to run.
-func (m *Migrator) Add(id string, desc string, op Operation) {
-	m.steps = append(m.steps, Migration{
+func (m *Migrator[T]) Add(id string, desc string, op Operation[T]) {
+	m.steps = append(m.steps, Migration[T]{
 		ID:   id,
 		Desc: desc,
 		Up:   op,
 	})
 }
 
-// Run executes all pending migrations based on the current version.
-// It returns the new version string and any error encountered.
-func (m *Migrator) Run(txn *lmdb.Txn, currentVersion string, logger *xlog.Logger) (string, error) {
-	startIndex := 0
+// Latest returns the ID of the last step, "" if there are none.
+func (m *Migrator[T]) Latest() string {
+	if len(m.steps) == 0 {
+		return ""
+	}
+	return m.steps[len(m.steps)-1].ID
+}
 
-	// 1. Determine where to start
-	if currentVersion != "" {
-		found := false
-		for i, step := range m.steps {
-			if step.ID == currentVersion {
-				startIndex = i + 1 // Start at the *next* step
-				found = true
-				break
-			}
+// History returns the records of the steps up to and including version, in
+// order. Fails like Run for an unknown version.
+func (m *Migrator[T]) History(version string) ([]Applied, error) {
+	end, err := m.pending(version)
+	if err != nil {
+		return nil, err
+	}
+	history := make([]Applied, end)
+	for i, step := range m.steps[:end] {
+		history[i] = Applied{ID: step.ID, Sum: step.Sum()}
+	}
+	return history, nil
+}
+
+// Verify checks recorded history against the steps, failing with
+// ErrHistoryChanged if an applied step was edited, removed or reordered since.
+// Records past the last step (a newer build's) aren't checked, Run rejects
+// their version.
+func (m *Migrator[T]) Verify(history []Applied) error {
+	for i, rec := range history {
+		if i == len(m.steps) {
+			break
 		}
-		if !found {
-			return currentVersion, fmt.Errorf("current version %q not found in migration history; database state is unknown", currentVersion)
+		step := m.steps[i]
+		if step.ID != rec.ID {
+			return fmt.Errorf("%w: step %d is %q, but %q was applied", ErrHistoryChanged, i+1, step.ID, rec.ID)
+		}
+		if step.Sum() != rec.Sum {
+			return fmt.Errorf("%w: %q was edited after it was applied, add a new step instead", ErrHistoryChanged, step.ID)
 		}
 	}
+	return nil
+}
+
+// AddBatched registers a step that rewrites more data than one transaction
+// should hold. Run still applies all of its batches in its one transaction,
+// callers that can commit in between use RunPartial instead.
+func (m *Migrator[T]) AddBatched(id string, desc string, op BatchOperation[T]) {
+	m.steps = append(m.steps, Migration[T]{
+		ID:    id,
+		Desc:  desc,
+		Batch: op,
+	})
+}
+
+// Plan returns the steps Run would apply from currentVersion, in order,
+// without running anything. Like Run it fails for an unknown version.
+func (m *Migrator[T]) Plan(currentVersion string) ([]Migration[T], error) {
+	start, err := m.pending(currentVersion)
+	if err != nil {
+		return nil, err
+	}
+	return m.steps[start:], nil
+}
+
+// pending returns the index of the first step after currentVersion.
+func (m *Migrator[T]) pending(currentVersion string) (int, error) {
+	if currentVersion == "" {
+		return 0, nil
+	}
+	for i, step := range m.steps {
+		if step.ID == currentVersion {
+			return i + 1, nil // Start at the *next* step
+		}
+	}
+	return 0, fmt.Errorf("current version %q: %w; database state is unknown", currentVersion, ErrUnknownVersion)
+}
+
+// Run executes all pending migrations based on the current version.
+// It returns what was applied and any error encountered, Result.To being
+// the version reached either way.
+func (m *Migrator[T]) Run(txn T, currentVersion string, logger *xlog.Logger) (*Result, error) {
+	res, err := m.RunPartial(txn, currentVersion, nil, logger)
+	for err == nil && len(res.Cursor) != 0 {
+		var next *Result
+		next, err = m.RunPartial(txn, res.To, res.Cursor, logger)
+		res.Merge(next)
+	}
+	return res, err
+}
+
+// RunPartial is Run for callers that commit between batches of batched steps.
+// It applies pending steps until a batched step has more to do, returning
+// the version reached and the cursor that step continues from (see Result).
+// Keep both with the data and call it again, in a new transaction, until the
+// cursor comes back empty. A crash in between resumes at the cursor.
+func (m *Migrator[T]) RunPartial(txn T, currentVersion string, cursor []byte, logger *xlog.Logger) (*Result, error) {
+	res := &Result{From: currentVersion, To: currentVersion, Cursor: cursor}
+
+	// 1. Determine where to start
+	startIndex, err := m.pending(currentVersion)
+	if err != nil {
+		return res, err
+	}
+	res.Skipped = startIndex
 
 	// 2. Apply pending migrations (skipped entirely if up-to-date)
-	finalVersion := currentVersion
 	for i := startIndex; i < len(m.steps); i++ {
 		step := m.steps[i]
+		sr := StepResult{ID: step.ID, Desc: step.Desc}
+		fail := func(err error) (*Result, error) {
+			m.emit(Event{Kind: StepFailed, ID: step.ID, Desc: step.Desc, Err: err})
+			return res, fmt.Errorf("failed to apply migration %q (%s): %w", step.ID, step.Desc, err)
+		}
+		if len(cursor) == 0 {
+			logger.Infof("Applying migration: %s - %s", step.ID, step.Desc)
+			m.emit(Event{Kind: StepStarted, ID: step.ID, Desc: step.Desc})
+		}
 
-		logger.Infof("Applying migration: %s - %s", step.ID, step.Desc)
-		if err := step.Up(txn); err != nil {
-			return finalVersion, fmt.Errorf("failed to apply migration %q (%s): %w", step.ID, step.Desc, err)
+		start := time.Now()
+		if step.Batch == nil {
+			if err := step.Up(txn); err != nil {
+				return fail(err)
+			}
+		} else {
+			next, err := step.Batch(txn, cursor)
+			if err != nil {
+				return fail(err)
+			}
+			sr.Batches = 1
+			m.emit(Event{Kind: StepBatch, ID: step.ID, Desc: step.Desc, Duration: time.Since(start)})
+			if len(next) != 0 {
+				sr.Duration = time.Since(start)
+				res.Cursor, res.Partial = next, &sr
+				return res, nil
+			}
 		}
+		cursor = nil // only the first pending step continues from it
+		sr.Duration = time.Since(start)
+		m.emit(Event{Kind: StepFinished, ID: step.ID, Desc: step.Desc, Duration: sr.Duration})
 
-		finalVersion = step.ID
+		res.To = step.ID
+		res.Cursor = nil
+		res.Applied = append(res.Applied, sr)
 	}
 
-	return finalVersion, nil
+	return res, nil
 }
@@ -0,0 +1,211 @@
+package migrator
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/Data-Corruption/stdx/xlog"
+)
+
+// FuzzRun checks version resolution against arbitrary stored versions: a known
+// version applies exactly the steps after it, anything else is rejected untouched.
+func FuzzRun(f *testing.F) {
+	logger, err := xlog.New(filepath.Join(f.TempDir(), "logs"), "none")
+	if err != nil {
+		f.Fatalf("Failed to create logger: %v", err)
+	}
+	f.Cleanup(func() { logger.Close() })
+
+	ids := []string{"v1", "v2", "v3"}
+	for _, seed := range []string{"", "v1", "v3", "v4", "V1", " v1", "v1\x00"} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, current string) {
+		var applied []string
+		m := New[any]()
+		for _, id := range ids {
+			m.Add(id, "step "+id, func(txn any) error {
+				applied = append(applied, id)
+				return nil
+			})
+		}
+
+		res, err := m.Run(nil, current, logger)
+		got := res.To
+
+		idx := slices.Index(ids, current)
+		switch {
+		case current == "":
+			if err != nil || got != "v3" || !slices.Equal(applied, ids) {
+				t.Fatalf("fresh db: got %q, applied %v, err %v", got, applied, err)
+			}
+		case idx >= 0:
+			if err != nil || got != "v3" || !slices.Equal(applied, ids[idx+1:]) {
+				t.Fatalf("from %q: got %q, applied %v, err %v", current, got, applied, err)
+			}
+		default:
+			if err == nil || got != current || len(applied) != 0 {
+				t.Fatalf("unknown %q: got %q, applied %v, err %v", current, got, applied, err)
+			}
+		}
+	})
+}
+
+func TestPlan(t *testing.T) {
+	m := New[any]()
+	for _, id := range []string{"v1", "v2", "v3"} {
+		m.Add(id, "step "+id, func(txn any) error {
+			t.Fatalf("Plan ran %s", id)
+			return nil
+		})
+	}
+	ids := func(steps []Migration[any]) (out []string) {
+		for _, s := range steps {
+			out = append(out, s.ID)
+		}
+		return out
+	}
+
+	if steps, err := m.Plan(""); err != nil || !slices.Equal(ids(steps), []string{"v1", "v2", "v3"}) {
+		t.Errorf("Plan(\"\") = %v, %v", ids(steps), err)
+	}
+	if steps, err := m.Plan("v2"); err != nil || !slices.Equal(ids(steps), []string{"v3"}) {
+		t.Errorf("Plan(v2) = %v, %v", ids(steps), err)
+	}
+	if steps, err := m.Plan("v3"); err != nil || len(steps) != 0 {
+		t.Errorf("Plan(v3) = %v, %v, want nothing pending", ids(steps), err)
+	}
+	if _, err := m.Plan("v9"); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("Plan(v9) = %v, want ErrUnknownVersion", err)
+	}
+	if got := m.Latest(); got != "v3" {
+		t.Errorf("Latest() = %q, want v3", got)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	build := func(descs ...string) *Migrator[any] {
+		m := New[any]()
+		for i, desc := range descs {
+			m.Add(fmt.Sprintf("v%d", i+1), desc, func(txn any) error { return nil })
+		}
+		return m
+	}
+	history, err := build("one", "two").History("v2")
+	if err != nil || len(history) != 2 {
+		t.Fatalf("History(v2) = %v, %v", history, err)
+	}
+	if _, err := build("one").History("v9"); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("History(v9) = %v, want ErrUnknownVersion", err)
+	}
+
+	for _, tt := range []struct {
+		name string
+		m    *Migrator[any]
+		ok   bool
+	}{
+		{"same", build("one", "two"), true},
+		{"new step added", build("one", "two", "three"), true},
+		{"newer database", build("one"), true},
+		{"edited", build("one", "2"), false},
+	} {
+		err := tt.m.Verify(history)
+		if tt.ok != (err == nil) || (err != nil && !errors.Is(err, ErrHistoryChanged)) {
+			t.Errorf("%s: Verify() = %v", tt.name, err)
+		}
+	}
+
+	reordered := New[any]()
+	reordered.Add("v2", "two", func(txn any) error { return nil })
+	reordered.Add("v1", "one", func(txn any) error { return nil })
+	if err := reordered.Verify(history); !errors.Is(err, ErrHistoryChanged) {
+		t.Errorf("reordered: Verify() = %v, want ErrHistoryChanged", err)
+	}
+}
+
+func TestRunPartial(t *testing.T) {
+	logger, err := xlog.New(filepath.Join(t.TempDir(), "logs"), "none")
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+	defer logger.Close()
+
+	var applied []string
+	build := func() *Migrator[any] {
+		applied = nil
+		m := New[any]()
+		m.Add("v1", "plain", func(txn any) error {
+			applied = append(applied, "v1")
+			return nil
+		})
+		// 5 items, 2 per batch
+		m.AddBatched("v2", "batched", func(txn any, cursor []byte) ([]byte, error) {
+			start := 0
+			if cursor != nil {
+				start = int(cursor[0])
+			}
+			for i := start; i < min(start+2, 5); i++ {
+				applied = append(applied, fmt.Sprintf("v2/%d", i))
+			}
+			if start+2 >= 5 {
+				return nil, nil
+			}
+			return []byte{byte(start + 2)}, nil
+		})
+		m.Add("v3", "plain", func(txn any) error {
+			applied = append(applied, "v3")
+			return nil
+		})
+		return m
+	}
+	want := []string{"v1", "v2/0", "v2/1", "v2/2", "v2/3", "v2/4", "v3"}
+
+	// one "transaction" per call, resuming from the returned version and cursor
+	m := build()
+	var events []string
+	m.OnProgress(func(ev Event) {
+		events = append(events, fmt.Sprintf("%s:%d", ev.ID, ev.Kind))
+	})
+	res, err := m.RunPartial(nil, "", nil, logger)
+	for calls := 1; ; calls++ {
+		if err != nil {
+			t.Fatalf("RunPartial: %v", err)
+		}
+		if len(res.Cursor) == 0 {
+			if res.To != "v3" || calls != 3 || !slices.Equal(applied, want) {
+				t.Errorf("RunPartial: version %q after %d calls, applied %v", res.To, calls, applied)
+			}
+			break
+		}
+		if res.To != "v1" || res.Partial == nil || res.Partial.ID != "v2" {
+			t.Errorf("mid-batch result = %+v, want v1 and v2 in progress", res)
+		}
+		var next *Result
+		next, err = m.RunPartial(nil, res.To, res.Cursor, logger)
+		res.Merge(next)
+	}
+	wantEvents := []string{"v1:0", "v1:2", "v2:0", "v2:1", "v2:1", "v2:1", "v2:2", "v3:0", "v3:2"}
+	if !slices.Equal(events, wantEvents) {
+		t.Errorf("events = %v, want %v", events, wantEvents)
+	}
+
+	// Run does every batch at once, the merged result has each step once
+	m = build()
+	if res, err = m.Run(nil, "", logger); err != nil || res.To != "v3" || !slices.Equal(applied, want) {
+		t.Errorf("Run = %+v, %v, applied %v", res, err, applied)
+	}
+	var steps []string
+	for _, s := range res.Applied {
+		steps = append(steps, fmt.Sprintf("%s/%d", s.ID, s.Batches))
+	}
+	if !slices.Equal(steps, []string{"v1/0", "v2/3", "v3/0"}) || res.From != "" || res.Skipped != 0 || res.Partial != nil {
+		t.Errorf("Run result = %+v, applied %v", res, steps)
+	}
+	if res, err = m.Run(nil, "v1", logger); err != nil || res.Skipped != 1 || len(res.Applied) != 2 {
+		t.Errorf("Run from v1 = %+v, %v, want 1 skipped, 2 applied", res, err)
+	}
+}
@@ -0,0 +1,135 @@
+// Package minisign verifies minisign signatures
+// (https://jedisct1.github.io/minisign/), both the current prehashed format
+// (`minisign -S`) and legacy ones. Signing is left to the minisign tool.
+//
+//	pk, err := minisign.ParsePublicKey("RWQ...")
+//	err = pk.Verify(file, sigFile) // sigFile is the contents of file.minisig
+package minisign
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrInvalidSignature means the signature doesn't match the data or its
+	// trusted comment was altered.
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrKeyMismatch means the data was signed with a different key.
+	ErrKeyMismatch = errors.New("signed with a different key")
+)
+
+const (
+	algLegacy    = "Ed" // signs the data
+	algPrehashed = "ED" // signs the BLAKE2b-512 digest of the data
+)
+
+// PublicKey is a minisign public key.
+type PublicKey struct {
+	ID  uint64 // key ID as minisign prints it (little-endian on the wire)
+	Key ed25519.PublicKey
+}
+
+// ParsePublicKey parses a public key, either the base64 line alone (as given
+// to `minisign -P`) or a whole .pub file with its comment line.
+func ParsePublicKey(s string) (PublicKey, error) {
+	line := lastLine(s)
+	raw, err := base64.StdEncoding.DecodeString(line)
+	if err != nil || len(raw) != 2+8+ed25519.PublicKeySize {
+		return PublicKey{}, errors.New("malformed public key")
+	}
+	if string(raw[:2]) != algLegacy {
+		return PublicKey{}, fmt.Errorf("unsupported key algorithm %q", raw[:2])
+	}
+	return PublicKey{
+		ID:  binary.LittleEndian.Uint64(raw[2:10]),
+		Key: ed25519.PublicKey(raw[10:]),
+	}, nil
+}
+
+// String returns the key ID the way minisign prints it.
+func (pk PublicKey) String() string {
+	return fmt.Sprintf("%016X", pk.ID)
+}
+
+// Signature is a parsed .minisig file.
+type Signature struct {
+	Algorithm      string
+	KeyID          uint64
+	Sig            []byte
+	TrustedComment string
+	GlobalSig      []byte // over Sig + TrustedComment
+}
+
+// ParseSignature parses the contents of a .minisig file.
+func ParseSignature(data []byte) (Signature, error) {
+	lines := strings.Split(strings.TrimRight(string(data), "\r\n"), "\n")
+	if len(lines) != 4 {
+		return Signature{}, errors.New("malformed signature: want 4 lines")
+	}
+	for i := range lines {
+		lines[i] = strings.TrimRight(lines[i], "\r")
+	}
+	if !strings.HasPrefix(lines[0], "untrusted comment:") {
+		return Signature{}, errors.New("malformed signature: missing untrusted comment")
+	}
+	raw, err := base64.StdEncoding.DecodeString(lines[1])
+	if err != nil || len(raw) != 2+8+ed25519.SignatureSize {
+		return Signature{}, errors.New("malformed signature")
+	}
+	comment, ok := strings.CutPrefix(lines[2], "trusted comment: ")
+	if !ok {
+		return Signature{}, errors.New("malformed signature: missing trusted comment")
+	}
+	global, err := base64.StdEncoding.DecodeString(lines[3])
+	if err != nil || len(global) != ed25519.SignatureSize {
+		return Signature{}, errors.New("malformed signature: bad global signature")
+	}
+	s := Signature{
+		Algorithm:      string(raw[:2]),
+		KeyID:          binary.LittleEndian.Uint64(raw[2:10]),
+		Sig:            raw[10:],
+		TrustedComment: comment,
+		GlobalSig:      global,
+	}
+	if s.Algorithm != algLegacy && s.Algorithm != algPrehashed {
+		return Signature{}, fmt.Errorf("unsupported signature algorithm %q", s.Algorithm)
+	}
+	return s, nil
+}
+
+// Verify checks sigFile (the contents of a .minisig file) is a valid
+// signature of data by pk, including its trusted comment.
+func (pk PublicKey) Verify(data, sigFile []byte) error {
+	s, err := ParseSignature(sigFile)
+	if err != nil {
+		return err
+	}
+	if s.KeyID != pk.ID {
+		return fmt.Errorf("%w (key %016X, want %s)", ErrKeyMismatch, s.KeyID, pk)
+	}
+	msg := data
+	if s.Algorithm == algPrehashed {
+		sum := blake2b512(data)
+		msg = sum[:]
+	}
+	if !ed25519.Verify(pk.Key, msg, s.Sig) {
+		return ErrInvalidSignature
+	}
+	global := append(bytes.Clone(s.Sig), s.TrustedComment...)
+	if !ed25519.Verify(pk.Key, global, s.GlobalSig) {
+		return fmt.Errorf("%w: trusted comment was modified", ErrInvalidSignature)
+	}
+	return nil
+}
+
+// lastLine returns the last non-empty line of s, trimmed.
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
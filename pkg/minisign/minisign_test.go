@@ -0,0 +1,81 @@
+package minisign
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBlake2b512(t *testing.T) {
+	// reference digests from Python's hashlib.blake2b, input byte i is i % 251
+	want := map[int]string{
+		0:    "786a02f742015903c6c6fd852552d272912f4740e15847618a86e217f71f5419d25e1031afee585313896444934eb04b903a685b1448b755d56f701afe9be2ce",
+		3:    "40a374727302d9a4769c17b5f409ff32f58aa24ff122d7603e4fda1509e919d4107a52c57570a6d94e50967aea573b11f86f473f537565c66f7039830a85d186",
+		128:  "2319e3789c47e2daa5fe807f61bec2a1a6537fa03f19ff32e87eecbfd64b7e0e8ccff439ac333b040f19b0c4ddd11a61e24ac1fe0f10a039806c5dcc0da3d115",
+		129:  "f59711d44a031d5f97a9413c065d1e614c417ede998590325f49bad2fd444d3e4418be19aec4e11449ac1a57207898bc57d76a1bcf3566292c20c683a5c4648f",
+		1000: "c11e1c0340bd7e5a1b275f1230c962fad215ecb1391486e74e31b960a2f2996381a5fad092da06841d5f26e38f6ecfeaf441acbcd1c2de61aef121e7927175f5",
+	}
+	for n, w := range want {
+		data := make([]byte, n)
+		for i := range data {
+			data[i] = byte(i % 251)
+		}
+		if got := blake2b512(data); hex.EncodeToString(got[:]) != w {
+			t.Errorf("blake2b512(%d bytes) = %x, want %s", n, got, w)
+		}
+	}
+}
+
+// prehashed signature of "hello sprout release\n", made with openssl and
+// hashlib independently of this package
+const (
+	vectorKey = "RWQBI0VniavN70Y6KEKMGIWtJvP60JlLvUNuzM3pHVNUYnn7HWQsH9h+"
+	vectorSig = "untrusted comment: signature from minisign secret key\n" +
+		"RUQBI0VniavN78b3y0K0Pj3BKhHw1TT18TvB7Dy5/L/EVg6mlATsv6UZXomqv/tMsL2K0wD0hc/zVdS8iaMlbznzCO14qqjjOA4=\n" +
+		"trusted comment: timestamp:1760000000\tfile:msg\thashed\n" +
+		"nCJh8/LAAQq0Te+UkbmjycUDimurtbONfJXb0MYIuT/ET/pHhOYgMc+nklUKO22Z140XmQeUUMtWCJ6u7scDBA==\n"
+)
+
+func TestVerify(t *testing.T) {
+	pk, err := ParsePublicKey("untrusted comment: minisign public key 0123456789ABCDEF\n" + vectorKey + "\n")
+	if err != nil {
+		t.Fatalf("ParsePublicKey: %v", err)
+	}
+	if pk.String() != "EFCDAB8967452301" {
+		t.Errorf("key ID = %s", pk)
+	}
+	msg := []byte("hello sprout release\n")
+	if err := pk.Verify(msg, []byte(vectorSig)); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+
+	if err := pk.Verify([]byte("hello sprout release!\n"), []byte(vectorSig)); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("modified data = %v, want ErrInvalidSignature", err)
+	}
+	forged := strings.Replace(vectorSig, "timestamp:1760000000", "timestamp:1860000000", 1)
+	if err := pk.Verify(msg, []byte(forged)); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("modified trusted comment = %v, want ErrInvalidSignature", err)
+	}
+
+	// legacy signature from another key
+	other, sk, _ := ed25519.GenerateKey(nil)
+	otherKey := PublicKey{ID: 42, Key: other}
+	sig := ed25519.Sign(sk, msg)
+	raw := append([]byte("Ed\x2a\x00\x00\x00\x00\x00\x00\x00"), sig...)
+	legacy := "untrusted comment: x\n" + base64.StdEncoding.EncodeToString(raw) + "\ntrusted comment: t\n" +
+		base64.StdEncoding.EncodeToString(ed25519.Sign(sk, append(bytes.Clone(sig), 't'))) + "\n"
+	if err := otherKey.Verify(msg, []byte(legacy)); err != nil {
+		t.Errorf("legacy signature: %v", err)
+	}
+	if err := pk.Verify(msg, []byte(legacy)); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("other key = %v, want ErrKeyMismatch", err)
+	}
+
+	if _, err := ParsePublicKey("not a key"); err == nil {
+		t.Error("ParsePublicKey accepted garbage")
+	}
+}
@@ -0,0 +1,167 @@
+// Package progress shows that long CLI operations are still alive: spinners,
+// byte counters / bars, and step lists ending in ✓ or ✗.
+//
+// On a terminal the running task redraws a single line. Anywhere else (pipes,
+// CI, tests) each task prints one line when it starts and one when it ends,
+// so scripted runs get clean, greppable output:
+//
+//	p := progress.New(w)
+//	s := p.Step("Verifying archive")
+//	err := verify()
+//	s.End(err) // "✓ Verifying archive (1.2s)" or "✗ Verifying archive: <err>"
+//
+// Only one task should run at a time per Printer.
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sprout/pkg/humanize"
+	"sprout/pkg/x"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	tick     = 100 * time.Millisecond
+	barWidth = 24
+)
+
+var frames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// Printer writes task progress to w.
+type Printer struct {
+	w   io.Writer
+	tty bool
+	mu  sync.Mutex
+}
+
+// New returns a Printer for w, redrawing in place only if w is a terminal.
+func New(w io.Writer) *Printer {
+	return &Printer{w: w, tty: IsTerminal(w)}
+}
+
+// IsTerminal reports whether w is a terminal that can redraw a line.
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok || os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	return isTerminal(f.Fd())
+}
+
+// Task is a running step. Report progress with Add / Write (it's an
+// io.Writer, so io.TeeReader / io.MultiWriter can count bytes for it), and
+// finish with Done, Fail, or End. Finishing more than once is a no-op.
+type Task struct {
+	p       *Printer
+	label   string
+	total   int64 // bytes, 0 = unknown
+	counted bool  // show the byte count
+	current atomic.Int64
+	start   time.Time
+	stop    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// Step starts a task with no measurable progress, a spinner on terminals.
+func (p *Printer) Step(label string) *Task {
+	return p.start(label, 0, false)
+}
+
+// Bar starts a task counting bytes towards total. With total 0 (unknown) it
+// shows the count next to a spinner instead of a bar.
+func (p *Printer) Bar(label string, total int64) *Task {
+	return p.start(label, total, true)
+}
+
+func (p *Printer) start(label string, total int64, counted bool) *Task {
+	t := &Task{p: p, label: label, total: total, counted: counted, start: time.Now()}
+	if !p.tty {
+		p.printf("%s ...\n", label)
+		return t
+	}
+	t.stop, t.stopped = make(chan struct{}), make(chan struct{})
+	go t.spin()
+	return t
+}
+
+func (t *Task) spin() {
+	defer close(t.stopped)
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+	for i := 0; ; i++ {
+		t.p.printf("\r\033[K%s %s%s", frames[i%len(frames)], t.label, t.status())
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// status is the part after the label while running.
+func (t *Task) status() string {
+	if !t.counted {
+		return ""
+	}
+	n := t.current.Load()
+	if t.total <= 0 {
+		return " " + humanize.Bytes(n)
+	}
+	frac := min(float64(n)/float64(t.total), 1)
+	filled := int(frac * barWidth)
+	return fmt.Sprintf(" [%s%s] %3.0f%% %s / %s",
+		strings.Repeat("#", filled), strings.Repeat(".", barWidth-filled),
+		frac*100, humanize.Bytes(n), humanize.Bytes(t.total))
+}
+
+// Add records n more bytes done.
+func (t *Task) Add(n int64) { t.current.Add(n) }
+
+// Write counts len(b) bytes, it never fails.
+func (t *Task) Write(b []byte) (int, error) {
+	t.Add(int64(len(b)))
+	return len(b), nil
+}
+
+// Done finishes the task successfully.
+func (t *Task) Done() { t.finish(nil) }
+
+// Fail finishes the task with err.
+func (t *Task) Fail(err error) { t.finish(err) }
+
+// End finishes the task, failed if err isn't nil, and returns err.
+func (t *Task) End(err error) error {
+	t.finish(err)
+	return err
+}
+
+func (t *Task) finish(err error) {
+	t.once.Do(func() {
+		if t.stop != nil {
+			close(t.stop)
+			<-t.stopped
+		}
+		prefix := x.Ternary(t.p.tty, "\r\033[K", "")
+		if err != nil {
+			t.p.printf("%s✗ %s: %v\n", prefix, t.label, err)
+			return
+		}
+		detail := humanize.Duration(time.Since(t.start))
+		if t.counted {
+			detail = humanize.Bytes(t.current.Load()) + ", " + detail
+		}
+		t.p.printf("%s✓ %s (%s)\n", prefix, t.label, detail)
+	})
+}
+
+func (p *Printer) printf(format string, v ...any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintf(p.w, format, v...)
+}
@@ -0,0 +1,57 @@
+package progress
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestPlain(t *testing.T) {
+	var out strings.Builder
+	p := New(&out)
+	if p.tty {
+		t.Fatal("strings.Builder detected as terminal")
+	}
+
+	s := p.Step("Checking")
+	s.Done()
+	s.Fail(errors.New("ignored")) // already finished
+
+	b := p.Bar("Copying", 10)
+	io.Copy(b, strings.NewReader("0123456789abc"))
+	b.Done()
+
+	if err := p.Step("Breaking").End(errors.New("boom")); err == nil {
+		t.Error("End should return its error")
+	}
+
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	want := []string{"Checking ...", "✓ Checking (", "Copying ...", "✓ Copying (13 B, ", "Breaking ...", "✗ Breaking: boom"}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d lines, want %d:\n%s", len(lines), len(want), out.String())
+	}
+	for i, prefix := range want {
+		if !strings.HasPrefix(lines[i], prefix) {
+			t.Errorf("line %d = %q, want prefix %q", i, lines[i], prefix)
+		}
+	}
+	if strings.Contains(out.String(), "\r") {
+		t.Error("plain output contains carriage returns")
+	}
+}
+
+func TestStatus(t *testing.T) {
+	task := &Task{total: 100, counted: true}
+	task.Add(50)
+	if got := task.status(); !strings.Contains(got, " 50%") || !strings.Contains(got, "############............") {
+		t.Errorf("status = %q", got)
+	}
+	task.Add(100) // past total clamps
+	if got := task.status(); !strings.Contains(got, "100%") {
+		t.Errorf("status = %q", got)
+	}
+	if got := (&Task{counted: true}).status(); got != " 0 B" {
+		t.Errorf("unknown total status = %q", got)
+	}
+}
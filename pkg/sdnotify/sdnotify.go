@@ -6,6 +6,7 @@ package sdnotify
 import (
 	"net"
 	"os"
+	"strconv"
 	"time"
 )
 
@@ -62,6 +63,18 @@ func Stopping(status string) error {
 	return notify(map[string]string{"STOPPING": "1", "STATUS": status})
 }
 
+// Status updates the free-form status line shown by `systemctl status`.
+// Useful for reporting progress of slow startup steps.
+func Status(status string) error {
+	return notify(map[string]string{"STATUS": status})
+}
+
+// ExtendTimeout asks systemd for d more time to start (or stop), for startup
+// steps that can take longer than the unit's TimeoutStartSec.
+func ExtendTimeout(d time.Duration) error {
+	return notify(map[string]string{"EXTEND_TIMEOUT_USEC": strconv.FormatInt(d.Microseconds(), 10)})
+}
+
 // Watchdog pokes the watchdog if WatchdogSec is configured in the unit.
 // Call periodically <= WatchdogSec/2.
 // Returns nil if NOTIFY_SOCKET unset (no-op).
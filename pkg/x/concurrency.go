@@ -0,0 +1,104 @@
+package x
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Pool runs submitted tasks on a fixed number of goroutines, with a bounded
+// queue in front of them. The zero value is not usable, see [NewPool].
+type Pool struct {
+	tasks  chan func()
+	wg     sync.WaitGroup
+	mu     sync.RWMutex // guards closed, so Submit never sends on a closed channel
+	closed bool
+}
+
+// NewPool starts workers goroutines (min 1) pulling from a queue of size queue.
+func NewPool(workers, queue int) *Pool {
+	p := &Pool{tasks: make(chan func(), max(queue, 0))}
+	for range max(workers, 1) {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+			for task := range p.tasks {
+				task()
+			}
+		}()
+	}
+	return p
+}
+
+// Submit queues fn without blocking. It returns false if the queue is full or
+// the pool is closed, leaving it to the caller to drop or handle inline.
+func (p *Pool) Submit(fn func()) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return false
+	}
+	select {
+	case p.tasks <- fn:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops accepting tasks and waits for queued / running ones to finish.
+// Safe to call more than once.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.tasks)
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+}
+
+// ParallelMap calls fn for every item, at most limit at a time (<= 0 = all at
+// once), and returns the results in input order. The first failure cancels the
+// ctx passed to the remaining calls, items not started yet are skipped. All
+// errors are joined, minus the cancellations the first one caused.
+func ParallelMap[T, R any](ctx context.Context, limit int, items []T, fn func(ctx context.Context, item T) (R, error)) ([]R, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	errFailed := errors.New("parallel map: another item failed")
+
+	results := make([]R, len(items))
+	errs := make([]error, len(items))
+	sem := make(chan struct{}, Ternary(limit > 0, limit, max(len(items), 1)))
+	var wg sync.WaitGroup
+	var skipped bool
+	for i, item := range items {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			skipped = true
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			r, err := fn(ctx, item)
+			if err != nil {
+				if errors.Is(err, context.Canceled) && context.Cause(ctx) == errFailed {
+					return // casualty of an earlier failure
+				}
+				errs[i] = err
+				cancel(errFailed)
+				return
+			}
+			results[i] = r
+		}()
+	}
+	wg.Wait()
+	if cause := context.Cause(ctx); skipped && cause != errFailed {
+		errs = append(errs, cause) // parent canceled before everything started
+	}
+	return results, errors.Join(errs...)
+}
@@ -0,0 +1,66 @@
+package x
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParallelMap(t *testing.T) {
+	var running, peak atomic.Int32
+	got, err := ParallelMap(context.Background(), 2, []int{1, 2, 3, 4, 5}, func(ctx context.Context, n int) (int, error) {
+		cur := running.Add(1)
+		defer running.Add(-1)
+		for p := peak.Load(); cur > p && !peak.CompareAndSwap(p, cur); p = peak.Load() {
+		}
+		time.Sleep(5 * time.Millisecond)
+		return n * n, nil
+	})
+	if err != nil {
+		t.Fatalf("ParallelMap: %v", err)
+	}
+	for i, want := range []int{1, 4, 9, 16, 25} {
+		if got[i] != want {
+			t.Errorf("result[%d] = %d, want %d", i, got[i], want)
+		}
+	}
+	if peak.Load() > 2 {
+		t.Errorf("peak concurrency %d, want <= 2", peak.Load())
+	}
+
+	boom := errors.New("boom")
+	var calls atomic.Int32
+	_, err = ParallelMap(context.Background(), 1, []int{1, 2, 3}, func(ctx context.Context, n int) (int, error) {
+		calls.Add(1)
+		if n == 1 {
+			return 0, boom
+		}
+		return n, ctx.Err()
+	})
+	if !errors.Is(err, boom) || errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want only boom", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("%d calls, want items after the failure skipped", calls.Load())
+	}
+}
+
+func TestPool(t *testing.T) {
+	p := NewPool(2, 4)
+	var done atomic.Int32
+	for range 4 {
+		if !p.Submit(func() { time.Sleep(time.Millisecond); done.Add(1) }) {
+			t.Fatal("Submit rejected a task with queue room")
+		}
+	}
+	p.Close()
+	if done.Load() != 4 {
+		t.Errorf("%d tasks done after Close, want 4", done.Load())
+	}
+	if p.Submit(func() {}) {
+		t.Errorf("Submit accepted a task after Close")
+	}
+	p.Close()
+}
@@ -0,0 +1,85 @@
+package x
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// RetryPolicy configures [Retry]. Zero values use the defaults noted per field.
+type RetryPolicy struct {
+	MaxAttempts int           // total attempts, 0 = 3, < 0 = unlimited (bounded by MaxElapsed / ctx)
+	MaxElapsed  time.Duration // don't start another attempt past this much time since the first, 0 = no limit
+	Initial     time.Duration // delay before the second attempt, 0 = 1s
+	Max         time.Duration // cap for a single delay, 0 = 30s
+	Multiplier  float64       // delay growth per attempt, 0 = 2
+	Jitter      float64       // randomize each delay by +/- this fraction, 0 = 0.2, < 0 = none
+}
+
+// Delay returns the wait after the given (1-based) failed attempt, jitter included.
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	initial := Ternary(p.Initial > 0, p.Initial, time.Second)
+	maxDelay := Ternary(p.Max > 0, p.Max, 30*time.Second)
+	mult := Ternary(p.Multiplier > 0, p.Multiplier, 2)
+	jitter := Ternary(p.Jitter != 0, p.Jitter, 0.2)
+
+	d := float64(initial)
+	for i := 1; i < attempt && d < float64(maxDelay); i++ {
+		d *= mult
+	}
+	d = min(d, float64(maxDelay))
+	if jitter > 0 {
+		d *= 1 - jitter + rand.Float64()*2*jitter
+	}
+	return time.Duration(d)
+}
+
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string { return e.err.Error() }
+func (e *permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as not worth retrying, [Retry] returns it (unwrapped) right away.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+// Retry calls fn until it succeeds, returns a [Permanent] error, or the policy
+// / ctx gives up, returning the last error. attempt starts at 1.
+//
+//	err := x.Retry(ctx, x.RetryPolicy{MaxAttempts: 5}, func(attempt int) error {
+//		return ping(ctx)
+//	})
+func Retry(ctx context.Context, p RetryPolicy, fn func(attempt int) error) error {
+	maxAttempts := Ternary(p.MaxAttempts != 0, p.MaxAttempts, 3)
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		err := fn(attempt)
+		if err == nil {
+			return nil
+		}
+		var perm *permanentError
+		if errors.As(err, &perm) {
+			return perm.err
+		}
+		if maxAttempts > 0 && attempt >= maxAttempts {
+			return err
+		}
+		delay := p.Delay(attempt)
+		if p.MaxElapsed > 0 && time.Since(start)+delay > p.MaxElapsed {
+			return err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w, last error: %w", ctx.Err(), err)
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package x
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetry(t *testing.T) {
+	fast := RetryPolicy{Initial: time.Millisecond, Jitter: -1}
+	boom := errors.New("boom")
+
+	calls := 0
+	err := Retry(context.Background(), fast, func(attempt int) error {
+		calls++
+		return boom
+	})
+	if !errors.Is(err, boom) || calls != 3 {
+		t.Errorf("default policy: err %v after %d calls, want boom after 3", err, calls)
+	}
+
+	calls = 0
+	err = Retry(context.Background(), fast, func(attempt int) error {
+		calls++
+		return Permanent(boom)
+	})
+	if err != boom || calls != 1 {
+		t.Errorf("permanent: err %v after %d calls, want unwrapped boom after 1", err, calls)
+	}
+
+	calls = 0
+	err = Retry(context.Background(), RetryPolicy{MaxAttempts: -1, Initial: time.Millisecond}, func(attempt int) error {
+		if calls++; attempt < 5 {
+			return boom
+		}
+		return nil
+	})
+	if err != nil || calls != 5 {
+		t.Errorf("unlimited: err %v after %d calls, want nil after 5", err, calls)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = Retry(ctx, RetryPolicy{MaxAttempts: -1}, func(attempt int) error { return boom })
+	if !errors.Is(err, context.Canceled) || !errors.Is(err, boom) {
+		t.Errorf("canceled: err %v, want both context.Canceled and boom", err)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	p := RetryPolicy{Initial: 100 * time.Millisecond, Max: time.Second, Jitter: -1}
+	want := []time.Duration{100, 200, 400, 800, 1000, 1000}
+	for i, w := range want {
+		if got := p.Delay(i + 1); got != w*time.Millisecond {
+			t.Errorf("Delay(%d) = %v, want %v", i+1, got, w*time.Millisecond)
+		}
+	}
+	p.Jitter = 0.5
+	for range 100 {
+		if d := p.Delay(1); d < 50*time.Millisecond || d > 150*time.Millisecond {
+			t.Fatalf("jittered Delay(1) = %v, want within 50ms..150ms", d)
+		}
+	}
+}
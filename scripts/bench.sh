@@ -0,0 +1,40 @@
+#!/bin/bash
+
+# Target: bash Linux x86_64/amd64
+# Requires: go, optionally benchstat (go install golang.org/x/perf/cmd/benchstat@latest)
+# Runs the benchmark suite and compares it against the cached baseline.
+# Usage:
+#   ./scripts/bench.sh          # run, compare with baseline if there is one
+#   ./scripts/bench.sh --save   # run and save the result as the new baseline
+# Run from the repo root. Save a baseline on the last release, then compare
+# before tagging the next one.
+
+set -euo pipefail
+
+BENCH_PKGS="${BENCH_PKGS:-./internal/platform/database/...}"
+BENCH_COUNT="${BENCH_COUNT:-6}" # benchstat wants >= 6 samples for confidence intervals
+CACHE_DIR=".cache/bench"
+BASELINE="$CACHE_DIR/baseline.txt"
+OUTPUT="bench_output.txt"
+
+mkdir -p "$CACHE_DIR"
+
+printf 'Running benchmarks (%s x%s) ...\n' "$BENCH_PKGS" "$BENCH_COUNT"
+go test -run='^$' -bench=. -benchmem -count="$BENCH_COUNT" $BENCH_PKGS | tee "$OUTPUT"
+
+if [[ "${1:-}" == "--save" ]]; then
+  cp "$OUTPUT" "$BASELINE"
+  printf '🟢 Saved baseline to %s\n' "$BASELINE"
+  exit 0
+fi
+
+if [[ ! -f "$BASELINE" ]]; then
+  printf 'No baseline yet, save one with: %s --save\n' "$0"
+  exit 0
+fi
+
+if command -v benchstat >/dev/null 2>&1; then
+  benchstat "$BASELINE" "$OUTPUT"
+else
+  printf 'benchstat not installed, raw results in %s, baseline in %s\n' "$OUTPUT" "$BASELINE"
+fi
@@ -1,7 +1,7 @@
 #!/bin/bash
 
 # Target: bash Linux x86_64/amd64
-# Requires: (go gcc sed awk sha256sum gzip rclone) preinstalled
+# Requires: (go gcc sed awk sha256sum gzip rclone) preinstalled, gcc only for STORAGE="lmdb"
 # Builds and tests app
 # If in CI it:
 # - uploads install script if R2 is setup
@@ -24,10 +24,30 @@ SERVICE_DESC="Sprout daemon"
 SERVICE_ARGS="service run"
 SERVICE_DEFAULT_PORT="8484"
 
+# minisign public key (the base64 line of the .pub file) baked into the binary, empty = no signing.
+# When set, CI signs releases with MINISIGN_SECRET_KEY (contents of the secret key file) and
+# MINISIGN_PASSWORD, and the updater refuses releases whose signatures don't verify.
+SIGNING_PUBLIC_KEY=""
+
+# how the app reads RELEASE_URL: "static" (version file + assets, the layout uploaded below) or
+# "manifest" (a manifest.json listing where each asset lives, also uploaded below, so releases can
+# be mirrored anywhere by copying the manifests and rewriting their URLs)
+RELEASE_SOURCE="static"
+
+# publish bsdiff patches from this many previous versions next to the binary, so the native updater
+# (updateMethod "native") downloads a patch instead of the whole binary. Needs bsdiff, 0 = none.
+PATCH_VERSIONS=3
+
+# database backend (see internal/platform/database/kv): "lmdb" (needs cgo, the CLI and service can
+# use the database at once) or "bolt" (pure Go, CGO_ENABLED=0, one process at a time)
+STORAGE="lmdb"
+
 # -----------------------------------------------------------------------------
 
 TAILWIND_VERSION="${TAILWIND_VERSION:-v4.1.18}"
 DAISYUI_VERSION="${DAISYUI_VERSION:-v5.5.14}"
+# pinned, output.js is committed (go build embeds it) and CI checks it's what this version bundles
+ESBUILD_VERSION="${ESBUILD_VERSION:-0.28.2}"
 
 BIN_DIR="bin"
 JS_DIR="./internal/ui/assets/js"
@@ -56,6 +76,59 @@ run_step() {
   fi
 }
 
+# sign_file "path"
+# Writes path.minisig with the CI signing key, no-op without a public key configured.
+sign_file() {
+  [[ -n "$SIGNING_PUBLIC_KEY" ]] || return 0
+  local key_file
+  key_file=$(mktemp)
+  printf '%s\n' "$MINISIGN_SECRET_KEY" > "$key_file"
+  run_step "Signed $(basename "$1")" "Failed to sign $1" \
+    sh -c 'printf "%s\n" "$MINISIGN_PASSWORD" | minisign -S -s "$1" -m "$2"' _ "$key_file" "$1"
+  rm -f "$key_file"
+  run_step "Verified signature of $(basename "$1")" "Signature of $1 doesn't verify with SIGNING_PUBLIC_KEY" \
+    minisign -V -P "$SIGNING_PUBLIC_KEY" -m "$1"
+}
+
+# write_manifest "output_path" "version" "asset"...
+# Writes a release manifest (see release.Manifest) listing assets next to it.
+write_manifest() {
+  local out="$1" version="$2" sep="" asset
+  shift 2
+  {
+    printf '{"latest":"%s","assets":{' "$version"
+    for asset in "$@"; do
+      printf '%s"%s":"%s"' "$sep" "$asset" "$asset"
+      sep=","
+    done
+    printf '}}\n'
+  } > "$out"
+}
+
+# make_patches
+# Writes bsdiff patches from the last PATCH_VERSIONS published versions to BUILD_OUT into BIN_DIR
+# (see release.PatchAsset), with their checksums, and prints their names. Skipped without bsdiff.
+make_patches() {
+  (( PATCH_VERSIONS > 0 )) || return 0
+  if ! command -v bsdiff >/dev/null 2>&1; then
+    printf "🟡 bsdiff not installed, not publishing patches\n" >&2
+    return 0
+  fi
+  local prev old patch
+  for prev in $(rclone cat "r2:$R2_BUCKET/release/versions" --s3-env-auth 2>/dev/null | grep -vxF "$VERSION" | tail -n "$PATCH_VERSIONS"); do
+    old="$BIN_DIR/linux-amd64.$prev"
+    if ! rclone cat "r2:$R2_BUCKET/release/$prev/linux-amd64.gz" --s3-env-auth 2>/dev/null | gzip -dc > "$old"; then
+      printf "🟡 Couldn't get the %s binary, no patch from it\n" "$prev" >&2
+      continue
+    fi
+    patch="linux-amd64.from-$prev.bsdiff"
+    bsdiff "$old" "$BUILD_OUT" "$BIN_DIR/$patch" || { printf "🟡 bsdiff from %s failed\n" "$prev" >&2; continue; }
+    (cd "$BIN_DIR" && sha256sum "$patch" > "$patch.sha256")
+    printf "🟢 Made patch from %s (%s bytes)\n" "$prev" "$(stat -c %s "$BIN_DIR/$patch")" >&2
+    printf '%s\n' "$patch"
+  done
+}
+
 # download_file "output_path" "url"
 # Downloads a file, with status output.
 download_file() {
@@ -83,7 +156,8 @@ check_var() {
 # Stages ----------------------------------------------------------------------
 
 dep_check() {
-  local required_bins=(go gcc sed awk sha256sum gzip rclone) # gcc for cgo
+  local required_bins=(go sed awk sha256sum gzip rclone)
+  [[ "$STORAGE" == "bolt" ]] || required_bins+=(gcc) # for cgo
   for bin in "${required_bins[@]}"; do
     if ! command -v "$bin" >/dev/null 2>&1; then
       printf "error: '$bin' is required but not installed or not in \$PATH\n" >&2
@@ -93,6 +167,12 @@ dep_check() {
 }
 
 setup() {
+  case "$STORAGE" in
+    lmdb) GO_TAGS="" CGO="1" ;;
+    bolt) GO_TAGS="bolt" CGO="0" ;;
+    *) printf "🔴 Unknown STORAGE %s, want lmdb or bolt\n" "$STORAGE" >&2; exit 1 ;;
+  esac
+
   rm -rf "$BIN_DIR" && mkdir -p "$BIN_DIR"
   printf '🟢 Cleaned bin directory\n'
 
@@ -103,6 +183,10 @@ setup() {
     printf "🔴 Distribution not configured\n" >&2
     exit 1
   fi
+  if $IN_CI && [[ -n "$SIGNING_PUBLIC_KEY" && ( -z "${MINISIGN_SECRET_KEY:-}" || -z "${MINISIGN_PASSWORD:-}" ) ]]; then
+    printf "🔴 Signing key configured but MINISIGN_SECRET_KEY / MINISIGN_PASSWORD missing\n" >&2
+    exit 1
+  fi
 
   VERSION="vX.X.X" # dev/test version
   DESCRIPTION="hello world"
@@ -123,8 +207,14 @@ setup() {
         -e "s|<SERVICE_ARGS>|$SERVICE_ARGS|g" \
         "./scripts/install.sh" > "$BIN_DIR/install.sh"
 
-    # Upload install.sh
+    # Upload install.sh and its checksum (the updater refuses to run a script that doesn't match)
+    (cd "$BIN_DIR" && sha256sum install.sh > install.sh.sha256)
     run_step "Uploaded install.sh" "Failed to upload install.sh" rclone copyto "$BIN_DIR/install.sh" "r2:$R2_BUCKET/release/install.sh" --header-upload "$NO_CACHE" --s3-env-auth --s3-no-check-bucket
+    run_step "Uploaded install.sh.sha256" "Failed to upload install.sh.sha256" rclone copyto "$BIN_DIR/install.sh.sha256" "r2:$R2_BUCKET/release/install.sh.sha256" --header-upload "$NO_CACHE" --s3-env-auth --s3-no-check-bucket
+    sign_file "$BIN_DIR/install.sh"
+    if [[ -n "$SIGNING_PUBLIC_KEY" ]]; then
+      run_step "Uploaded install.sh.minisig" "Failed to upload install.sh.minisig" rclone copyto "$BIN_DIR/install.sh.minisig" "r2:$R2_BUCKET/release/install.sh.minisig" --header-upload "$NO_CACHE" --s3-env-auth --s3-no-check-bucket
+    fi
 
     # Process install.ps1 template
     sed -e "s|<APP_NAME>|$APP_NAME|g" \
@@ -150,13 +240,13 @@ setup() {
   fi
 
   # Export for use in other stages
-  export IN_CI VERSION DESCRIPTION
+  export IN_CI VERSION DESCRIPTION GO_TAGS CGO
 }
 
 frontend_build() {
   # Download tools if missing (or refetch if requested in CI)
   $IN_CI && [[ "${REFETCH_TOOLS:-false}" == "true" ]] && rm -f esbuild tailwindcss "$CSS_DIR/daisyui.mjs" "$CSS_DIR/daisyui-theme.mjs"
-  [[ -f esbuild ]] || curl -fsSL https://esbuild.github.io/dl/latest | sh
+  [[ -x esbuild && "$(./esbuild --version)" == "$ESBUILD_VERSION" ]] || curl -fsSL "https://esbuild.github.io/dl/v${ESBUILD_VERSION}" | sh
   [[ -f tailwindcss ]] || download_file tailwindcss "https://github.com/tailwindlabs/tailwindcss/releases/download/${TAILWIND_VERSION}/tailwindcss-linux-x64"
   [[ -f "$CSS_DIR/daisyui.mjs" ]] || download_file "$CSS_DIR/daisyui.mjs" "https://github.com/saadeghi/daisyui/releases/download/${DAISYUI_VERSION}/daisyui.mjs"
   [[ -f "$CSS_DIR/daisyui-theme.mjs" ]] || download_file "$CSS_DIR/daisyui-theme.mjs" "https://github.com/saadeghi/daisyui/releases/download/${DAISYUI_VERSION}/daisyui-theme.mjs"
@@ -164,6 +254,11 @@ frontend_build() {
   chmod +x tailwindcss esbuild
   run_step "Tailwind CSS built" "Tailwind CSS failed" ./tailwindcss -i "$CSS_DIR/input.css" -o "$CSS_DIR/output.css" --minify
   run_step "JavaScript bundled" "JavaScript bundling failed" ./esbuild "$JS_DIR/src/main.js" --bundle --minify --outfile="$JS_DIR/output.js"
+  # a stale committed bundle means plain `go build`s ship a UI that doesn't match src
+  if $IN_CI && ! git diff --quiet -- "$JS_DIR/output.js"; then
+    printf '\n🔴 %s/output.js is out of date with src, run this script and commit it\n' "$JS_DIR" >&2
+    exit 1
+  fi
 }
 
 hash_assets() {
@@ -224,7 +319,18 @@ hash_assets() {
 }
 
 tests() {
-  run_step "Tests passed" "Tests failed" go test -race ./...
+  # -race needs cgo
+  if [[ "$CGO" == "1" ]]; then
+    run_step "Tests passed" "Tests failed" go test -race -tags "$GO_TAGS" ./...
+  else
+    run_step "Tests passed" "Tests failed" env CGO_ENABLED=0 go test -tags "$GO_TAGS" ./...
+  fi
+  # only linux is released, but the native update paths must keep compiling.
+  # lmdb needs cgo, which doesn't cross compile, so these vet the bolt build
+  local goos
+  for goos in windows darwin; do
+    run_step "Vet passed ($goos)" "Vet failed ($goos)" env GOOS="$goos" CGO_ENABLED=0 go vet -tags bolt ./...
+  done
 }
 
 go_build() {
@@ -232,15 +338,19 @@ go_build() {
   local ldflags="-X '${pkg}.name=$APP_NAME'"
   ldflags+=" -X '${pkg}.version=$VERSION'"
   ldflags+=" -X '${pkg}.releaseURL=$RELEASE_URL'"
+  ldflags+=" -X '${pkg}.releaseSource=$RELEASE_SOURCE'"
   ldflags+=" -X '${pkg}.contactURL=$CONTACT_URL'"
   ldflags+=" -X '${pkg}.defaultLogLevel=$DEFAULT_LOG_LEVEL'"
   ldflags+=" -X '${pkg}.serviceEnabled=$SERVICE'"
   ldflags+=" -X '${pkg}.serviceDesc=$SERVICE_DESC'"
   ldflags+=" -X '${pkg}.serviceArgs=$SERVICE_ARGS'"
   ldflags+=" -X '${pkg}.serviceDefaultPort=$SERVICE_DEFAULT_PORT'"
+  ldflags+=" -X '${pkg}.signingKey=$SIGNING_PUBLIC_KEY'"
   BUILD_OUT="$BIN_DIR/linux-amd64"
   
-  GOOS=linux GOARCH=amd64 CGO_ENABLED=1 go build -trimpath -buildvcs=false -ldflags="$ldflags" -o "$BUILD_OUT" "$GO_MAIN_PATH"
+  # VCS info (commit, dirty flag) is stamped by the go tool and read via debug.ReadBuildInfo,
+  # set GOFLAGS=-buildvcs=false if building outside a git checkout
+  GOOS=linux GOARCH=amd64 CGO_ENABLED="$CGO" go build -trimpath -tags "$GO_TAGS" -ldflags="$ldflags" -o "$BUILD_OUT" "$GO_MAIN_PATH"
   printf "🟢 Built $BUILD_OUT\n"
 
   # Export for use in other stages
@@ -254,12 +364,14 @@ verify_build() {
   check_var "name" "$APP_NAME"
   check_var "version" "$VERSION"
   check_var "releaseURL" "$RELEASE_URL"
+  check_var "releaseSource" "$RELEASE_SOURCE"
   check_var "contactURL" "$CONTACT_URL"
   check_var "defaultLogLevel" "$DEFAULT_LOG_LEVEL"
   check_var "serviceEnabled" "$SERVICE"
   check_var "serviceDesc" "$SERVICE_DESC"
   check_var "serviceArgs" "$SERVICE_ARGS"
   check_var "serviceDefaultPort" "$SERVICE_DEFAULT_PORT"
+  [[ -z "$SIGNING_PUBLIC_KEY" ]] || check_var "signingKey" "$SIGNING_PUBLIC_KEY"
 
   printf "🟢 Build variables verified\n"
 }
@@ -277,19 +389,85 @@ distribute() {
     sha256sum "$(basename "$gzip_out")" > "$(basename "$sha_out")"
   )
   printf "🟢 Generated checksum $sha_out\n"
+  sign_file "$sha_out"
+
+  # Checksum of the uncompressed binary, what the native updater checks patched binaries against,
+  # and the patches. Stale patches left in a channel dir just fail that check, the updater then
+  # downloads the whole binary.
+  local raw_sha_out="$BUILD_OUT.sha256"
+  (
+    cd "$(dirname "$BUILD_OUT")" || exit 1
+    sha256sum "$(basename "$BUILD_OUT")" > "$(basename "$raw_sha_out")"
+  )
+  sign_file "$raw_sha_out"
+  local patch_assets=("$(basename "$raw_sha_out")") patch
+  [[ -z "$SIGNING_PUBLIC_KEY" ]] || patch_assets+=("$(basename "$raw_sha_out").minisig")
+  for patch in $(make_patches); do
+    patch_assets+=("$patch" "$patch.sha256")
+  done
 
   # Tag and push (GIT_TERMINAL_PROMPT=0 ensures failure instead of hang if auth fails)
   run_step "Tagged $VERSION" "Failed to tag $VERSION" git tag "$VERSION"
   run_step "Pushed $VERSION" "Failed to push $VERSION" env GIT_TERMINAL_PROMPT=0 git push origin "$VERSION"
 
+  # Channel from the prerelease suffix: v1.2.0 -> stable (release/ itself),
+  # v1.2.0-nightly.20250102 -> release/nightly/, any other (v1.2.0-beta.1, -rc.1) -> release/beta/
+  local dest="release"
+  case "$VERSION" in
+    *-nightly*) dest="release/nightly" ;;
+    *-*)        dest="release/beta" ;;
+  esac
+
   # Upload to R2 (no-check-bucket needed for Object Read & Write tokens)
-  run_step "Uploaded $(basename "$gzip_out")" "Failed to upload $(basename "$gzip_out")" rclone copyto "$gzip_out" "r2:$R2_BUCKET/release/$(basename "$gzip_out")" --header-upload "$NO_CACHE" --s3-env-auth --s3-no-check-bucket
-  run_step "Uploaded $(basename "$sha_out")" "Failed to upload $(basename "$sha_out")" rclone copyto "$sha_out" "r2:$R2_BUCKET/release/$(basename "$sha_out")" --header-upload "$NO_CACHE" --s3-env-auth --s3-no-check-bucket
+  run_step "Uploaded $(basename "$gzip_out") to $dest" "Failed to upload $(basename "$gzip_out")" rclone copyto "$gzip_out" "r2:$R2_BUCKET/$dest/$(basename "$gzip_out")" --header-upload "$NO_CACHE" --s3-env-auth --s3-no-check-bucket
+  run_step "Uploaded $(basename "$sha_out") to $dest" "Failed to upload $(basename "$sha_out")" rclone copyto "$sha_out" "r2:$R2_BUCKET/$dest/$(basename "$sha_out")" --header-upload "$NO_CACHE" --s3-env-auth --s3-no-check-bucket
+  if [[ -n "$SIGNING_PUBLIC_KEY" ]]; then
+    run_step "Uploaded $(basename "$sha_out").minisig to $dest" "Failed to upload $(basename "$sha_out").minisig" rclone copyto "$sha_out.minisig" "r2:$R2_BUCKET/$dest/$(basename "$sha_out").minisig" --header-upload "$NO_CACHE" --s3-env-auth --s3-no-check-bucket
+  fi
 
   # Upload version file
   local version_file="$BIN_DIR/version"
   echo "$VERSION" > "$version_file"
-  run_step "Uploaded version" "Failed to upload version" rclone copyto "$version_file" "r2:$R2_BUCKET/release/version" --header-upload "$NO_CACHE" --s3-env-auth --s3-no-check-bucket
+  run_step "Uploaded version to $dest" "Failed to upload version" rclone copyto "$version_file" "r2:$R2_BUCKET/$dest/version" --header-upload "$NO_CACHE" --s3-env-auth --s3-no-check-bucket
+
+  # Keep a copy per version (release/<version>/) so it can be pinned later, e.g. `sprout update --to <version>`
+  local pin_dest="release/$VERSION"
+  run_step "Uploaded $(basename "$gzip_out") to $pin_dest" "Failed to upload $(basename "$gzip_out")" rclone copyto "$gzip_out" "r2:$R2_BUCKET/$pin_dest/$(basename "$gzip_out")" --s3-env-auth --s3-no-check-bucket
+  run_step "Uploaded $(basename "$sha_out") to $pin_dest" "Failed to upload $(basename "$sha_out")" rclone copyto "$sha_out" "r2:$R2_BUCKET/$pin_dest/$(basename "$sha_out")" --s3-env-auth --s3-no-check-bucket
+  if [[ -n "$SIGNING_PUBLIC_KEY" ]]; then
+    run_step "Uploaded $(basename "$sha_out").minisig to $pin_dest" "Failed to upload $(basename "$sha_out").minisig" rclone copyto "$sha_out.minisig" "r2:$R2_BUCKET/$pin_dest/$(basename "$sha_out").minisig" --s3-env-auth --s3-no-check-bucket
+  fi
+  run_step "Uploaded version to $pin_dest" "Failed to upload version" rclone copyto "$version_file" "r2:$R2_BUCKET/$pin_dest/version" --s3-env-auth --s3-no-check-bucket
+
+  # Uncompressed checksum and patches, both places
+  local asset
+  for asset in "${patch_assets[@]}"; do
+    run_step "Uploaded $asset to $dest" "Failed to upload $asset" rclone copyto "$BIN_DIR/$asset" "r2:$R2_BUCKET/$dest/$asset" --header-upload "$NO_CACHE" --s3-env-auth --s3-no-check-bucket
+    run_step "Uploaded $asset to $pin_dest" "Failed to upload $asset" rclone copyto "$BIN_DIR/$asset" "r2:$R2_BUCKET/$pin_dest/$asset" --s3-env-auth --s3-no-check-bucket
+  done
+
+  # Append to the version index (release/versions), missing on the first release
+  local versions_file="$BIN_DIR/versions"
+  rclone cat "r2:$R2_BUCKET/release/versions" --s3-env-auth > "$versions_file" 2>/dev/null || : > "$versions_file"
+  grep -qxF "$VERSION" "$versions_file" || echo "$VERSION" >> "$versions_file"
+  run_step "Uploaded versions index" "Failed to upload versions index" rclone copyto "$versions_file" "r2:$R2_BUCKET/release/versions" --header-upload "$NO_CACHE" --s3-env-auth --s3-no-check-bucket
+
+  # Manifests last, so they never list a file that isn't uploaded yet. Only stable releases
+  # rewrite the root one, which also lists the files shared by every channel.
+  if [[ "$RELEASE_SOURCE" == "manifest" ]]; then
+    local assets=("$(basename "$gzip_out")" "$(basename "$sha_out")")
+    [[ -z "$SIGNING_PUBLIC_KEY" ]] || assets+=("$(basename "$sha_out").minisig")
+    assets+=("${patch_assets[@]}")
+    local manifest_file="$BIN_DIR/manifest.json"
+    write_manifest "$manifest_file" "$VERSION" "${assets[@]}"
+    run_step "Uploaded manifest.json to $pin_dest" "Failed to upload manifest.json" rclone copyto "$manifest_file" "r2:$R2_BUCKET/$pin_dest/manifest.json" --s3-env-auth --s3-no-check-bucket
+    if [[ "$dest" == "release" ]]; then
+      assets+=(install.sh install.sh.sha256 versions)
+      [[ -z "$SIGNING_PUBLIC_KEY" ]] || assets+=(install.sh.minisig)
+      write_manifest "$manifest_file" "$VERSION" "${assets[@]}"
+    fi
+    run_step "Uploaded manifest.json to $dest" "Failed to upload manifest.json" rclone copyto "$manifest_file" "r2:$R2_BUCKET/$dest/manifest.json" --header-upload "$NO_CACHE" --s3-env-auth --s3-no-check-bucket
+  fi
 }
 
 # Main ------------------------------------------------------------------------
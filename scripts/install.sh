@@ -3,6 +3,9 @@
 # Target: ~POSIX Linux x86_64/amd64, user-level install, optional systemd --user unit
 # Requires: curl, gzip, mktemp, install, sha256sum, sed, awk, (and systemd if SERVICE=true)
 # Example: curl -fsSL https://cd.example.com/release/install.sh | sh
+# Beta / nightly: curl -fsSL https://cd.example.com/release/install.sh | CHANNEL=beta sh
+# Specific version: curl -fsSL https://cd.example.com/release/install.sh | INSTALL_VERSION=v1.2.0 sh
+# Private host: curl -fsSL -H "Authorization: Bearer $RELEASE_TOKEN" https://cd.example.com/release/install.sh | RELEASE_TOKEN="$RELEASE_TOKEN" sh
 
 # print logo, i made this with https://manytools.org/hacker-tools/ascii-banner/ <3
 cat << 'EOF'
@@ -26,9 +29,34 @@ SERVICE="<SERVICE>"
 SERVICE_DESC="<SERVICE_DESC>"
 SERVICE_ARGS="<SERVICE_ARGS>"
 
+# update channel, recorded in the app's config when given
+CHANNEL="${CHANNEL:-}"
+CHANNEL_SOURCE="${CHANNEL_SOURCE:-${CHANNEL:-stable}}"
+
+# exact version to install instead of the channel's latest, e.g. v1.2.0
+INSTALL_VERSION="${INSTALL_VERSION:-}"
+# reinstall the kept previous binary (PREV_BIN) instead of downloading, set by the app's rollback command
+INSTALL_PREV="${INSTALL_PREV:-false}"
+# checksum the downloaded one must match, set by the app's updater from the signed checksum file
+EXPECTED_SHA256="${EXPECTED_SHA256:-}"
+# where to download the binary and its checksum from instead of the release URL, set by the app's
+# updater for releases published through a manifest (release.ManifestReleaseSource)
+BINARY_URL="${BINARY_URL:-}"
+BINARY_SHA256_URL="${BINARY_SHA256_URL:-}"
+BINARY_VERSION="${BINARY_VERSION:-}"
+# bearer token for a private release host, or a curl header file holding it (set by the app's updater,
+# so the token never shows up in a command line). Only sent to the release URL's host.
+RELEASE_TOKEN="${RELEASE_TOKEN:-}"
+RELEASE_HEADER_FILE="${RELEASE_HEADER_FILE:-}"
+# the app's outbound settings, set by its updater: a curl config file with the proxy (its URL may hold
+# credentials), and a PEM bundle trusted in addition to the system roots. curl honors HTTPS_PROXY itself.
+OUTBOUND_CURL_CONFIG="${OUTBOUND_CURL_CONFIG:-}"
+OUTBOUND_CA_BUNDLE="${OUTBOUND_CA_BUNDLE:-}"
+
 APP_BIN="$HOME/.local/bin/$APP_NAME"
 APP_DATA_DIR="$HOME/.$APP_NAME"
 APP_ENV_FILE="$APP_DATA_DIR/$APP_NAME.env"
+PREV_BIN="$APP_DATA_DIR/$APP_NAME.prev" # binary replaced by the last install of a different version
 
 SERVICE_NAME="$APP_NAME.service"
 SERVICE_FILE="$HOME/.config/systemd/user/$SERVICE_NAME"
@@ -45,6 +73,7 @@ LOCK_FILE="$RUNTIME_DIR/$APP_NAME/migrate.lock"
 # Globals used by rollback/cleanup --------------------------------------------
 temp_dir=""
 old_app_bin=""
+old_version=""
 old_service_file=""
 service_exists=0
 service_was_enabled=0
@@ -182,9 +211,35 @@ fi
 mkdir -p "$(dirname "$SERVICE_FILE")" "$APP_DATA_DIR" || { rc=$?; fatalf 'failed to create install dirs (rc=%d)' "$rc"; }
 
 # Download -------------------------------------------------------------------
-ver_url="${RELEASE_URL}version"
-bin_url="${RELEASE_URL}${BIN_ASSET_NAME}"
-bin_url_sha256="${RELEASE_URL}${BIN_ASSET_NAME_SHA256}"
+
+# stable releases live at RELEASE_URL, beta / nightly in subdirectories.
+# CHANNEL_SOURCE is set by the app's updater to the channel its latest release came from.
+case "$CHANNEL_SOURCE" in
+    stable)       asset_url="$RELEASE_URL" ;;
+    beta|nightly) asset_url="${RELEASE_URL}${CHANNEL_SOURCE}/" ;;
+    *)            fatalf 'Unknown channel: %s (want stable, beta or nightly)' "$CHANNEL_SOURCE" ;;
+esac
+
+# every published version is also kept in its own directory, see RELEASE_URL/versions
+if [ -n "$INSTALL_VERSION" ]; then
+    case "$INSTALL_VERSION" in
+        v[0-9]*) : ;;
+        *) fatalf 'Invalid version: %s (want a release tag like v1.2.0)' "$INSTALL_VERSION" ;;
+    esac
+    case "$INSTALL_VERSION" in
+        *[!0-9A-Za-z.+-]*) fatalf 'Invalid version: %s (want a release tag like v1.2.0)' "$INSTALL_VERSION" ;;
+    esac
+    asset_url="${RELEASE_URL}${INSTALL_VERSION}/"
+fi
+
+ver_url="${asset_url}version"
+bin_url="${asset_url}${BIN_ASSET_NAME}"
+bin_url_sha256="${asset_url}${BIN_ASSET_NAME_SHA256}"
+if [ -n "$BINARY_URL" ]; then
+    [ -n "$BINARY_SHA256_URL" ] || fatalf 'BINARY_URL is set without BINARY_SHA256_URL'
+    bin_url="$BINARY_URL"
+    bin_url_sha256="$BINARY_SHA256_URL"
+fi
 
 # make temp dir
 temp_dir=$(mktemp -d) || { rc=$?; fatalf 'failed to create temp dir (rc=%d)' "$rc"; }
@@ -196,8 +251,55 @@ gzip_out=${dwld_out%".gz"}
 
 curl_opts="-sS --fail --location --show-error --connect-timeout 5 --retry-all-errors --retry 3 --retry-delay 1 --max-time 300"
 
+# release auth (printf is a builtin, so the token isn't visible in ps)
+if [ -z "$RELEASE_HEADER_FILE" ] && [ -n "$RELEASE_TOKEN" ]; then
+    RELEASE_HEADER_FILE="$temp_dir/auth"
+    (umask 077 && printf 'Authorization: Bearer %s\n' "$RELEASE_TOKEN" > "$RELEASE_HEADER_FILE") || fatalf 'Failed to write release auth header'
+fi
+release_origin=$(printf '%s' "$RELEASE_URL" | sed 's|^\([A-Za-z][A-Za-z0-9+.-]*://[^/]*\).*|\1|')
+
+# --cacert replaces curl's default roots, so combine them (same files Go checks) with the extra bundle
+ca_bundle=""
+if [ -n "$OUTBOUND_CA_BUNDLE" ]; then
+    [ -r "$OUTBOUND_CA_BUNDLE" ] || fatalf 'Cannot read CA bundle: %s' "$OUTBOUND_CA_BUNDLE"
+    ca_bundle="$temp_dir/ca-bundle.pem"
+    : > "$ca_bundle"
+    for roots in /etc/ssl/certs/ca-certificates.crt /etc/pki/tls/certs/ca-bundle.crt /etc/ssl/ca-bundle.pem \
+        /etc/pki/tls/cacert.pem /etc/pki/ca-trust/extracted/pem/tls-ca-bundle.pem /etc/ssl/cert.pem; do
+        if [ -r "$roots" ]; then
+            cat "$roots" > "$ca_bundle"
+            break
+        fi
+    done
+    cat "$OUTBOUND_CA_BUNDLE" >> "$ca_bundle" || fatalf 'Failed to read CA bundle: %s' "$OUTBOUND_CA_BUNDLE"
+fi
+
+# fetch "url" [curl args...]
+# curl with the outbound settings, plus the release auth header for URLs on the release host.
+fetch() {
+    fetch_url=$1; shift
+    [ -z "$OUTBOUND_CURL_CONFIG" ] || set -- -K "$OUTBOUND_CURL_CONFIG" "$@"
+    [ -z "$ca_bundle" ] || set -- --cacert "$ca_bundle" "$@"
+    case "$fetch_url" in
+        "$release_origin"/*)
+            if [ -n "$RELEASE_HEADER_FILE" ]; then
+                curl $curl_opts -H "@$RELEASE_HEADER_FILE" "$@" "$fetch_url"
+                return
+            fi
+            ;;
+    esac
+    curl $curl_opts "$@" "$fetch_url"
+}
+
 # get version
-version=$(curl $curl_opts "$ver_url") # not needed, but useful info for the user
+if [ "$INSTALL_PREV" = "true" ]; then
+    [ -f "$PREV_BIN" ] || fatalf 'No previous binary to roll back to: %s' "$PREV_BIN"
+    version="$INSTALL_VERSION"
+elif [ -n "$BINARY_VERSION" ]; then
+    version="$BINARY_VERSION"
+else
+    version=$(fetch "$ver_url") # not needed, but useful info for the user
+fi
 
 # print install header
 INSTALL_SYMBOL=''
@@ -206,23 +308,32 @@ case $(printf %s "${LC_ALL:-${LANG:-}}" | tr '[:upper:]' '[:lower:]') in
 esac
 printf '%sInstalling %s %s ...\n' "$INSTALL_SYMBOL" "$APP_NAME" "$version"
 
-# download bin and checksum
-printf 'Downloading binary ...\n'
-curl $curl_opts -o "$dwld_out" "$bin_url" || { rc=$?; fatalf 'Download of binary failed (rc=%d)' "$rc"; }
-printf 'Downloading checksum ...\n'
-curl $curl_opts -o "$hash_out" "$bin_url_sha256" || { rc=$?; fatalf 'Download of checksum failed (rc=%d)' "$rc"; }
-
-# verify checksum
-printf 'Verifying checksum ...\n'
-expected_sum=$(cut -d' ' -f1 "$hash_out" | tr -d '\r\n') # read the first field (the hash)
-[ ${#expected_sum} -eq 64 ] || fatalf 'Invalid checksum format'
-actual_sum=$(sha256sum "$dwld_out" | awk '{print $1}' | tr -d '\r\n') # same deal
-[ -n "$actual_sum" ] || fatalf 'Failed to compute hash of downloaded file'
-[ "$expected_sum" = "$actual_sum" ] || fatalf 'Checksum mismatch! Expected %s, got %s' "$expected_sum" "$actual_sum"
+if [ "$INSTALL_PREV" = "true" ]; then
+    # kept by an earlier install of this script, already verified back then
+    printf 'Using previous binary %s ...\n' "$PREV_BIN"
+    cp -f "$PREV_BIN" "$gzip_out" || { rc=$?; fatalf 'Failed to copy previous binary (rc=%d)' "$rc"; }
+else
+    # download bin and checksum
+    printf 'Downloading binary ...\n'
+    fetch "$bin_url" -o "$dwld_out" || { rc=$?; fatalf 'Download of binary failed (rc=%d)' "$rc"; }
+    printf 'Downloading checksum ...\n'
+    fetch "$bin_url_sha256" -o "$hash_out" || { rc=$?; fatalf 'Download of checksum failed (rc=%d)' "$rc"; }
+
+    # verify checksum
+    printf 'Verifying checksum ...\n'
+    expected_sum=$(cut -d' ' -f1 "$hash_out" | tr -d '\r\n') # read the first field (the hash)
+    [ ${#expected_sum} -eq 64 ] || fatalf 'Invalid checksum format'
+    if [ -n "$EXPECTED_SHA256" ] && [ "$expected_sum" != "$EXPECTED_SHA256" ]; then
+        fatalf 'Checksum file does not match the signed one! Expected %s, got %s' "$EXPECTED_SHA256" "$expected_sum"
+    fi
+    actual_sum=$(sha256sum "$dwld_out" | awk '{print $1}' | tr -d '\r\n') # same deal
+    [ -n "$actual_sum" ] || fatalf 'Failed to compute hash of downloaded file'
+    [ "$expected_sum" = "$actual_sum" ] || fatalf 'Checksum mismatch! Expected %s, got %s' "$expected_sum" "$actual_sum"
 
-# unzip
-printf 'Unzipping ...\n'
-gzip -dc "$dwld_out" > "$gzip_out" || { rc=$?; fatalf 'Failed to unzip (rc=%d)' "$rc"; }
+    # unzip
+    printf 'Unzipping ...\n'
+    gzip -dc "$dwld_out" > "$gzip_out" || { rc=$?; fatalf 'Failed to unzip (rc=%d)' "$rc"; }
+fi
 
 # Backup (for rollback) -------------------------------------------------------
 if [ -f "$APP_BIN" ] || [ "$service_exists" -eq 1 ]; then
@@ -232,6 +343,8 @@ fi
 if [ -f "$APP_BIN" ]; then
     old_app_bin="$temp_dir/$APP_NAME.old"
     cp -f "$APP_BIN" "$old_app_bin" || { rc=$?; fatalf 'Failed to backup existing binary (rc=%d)' "$rc"; }
+    # version of what's being replaced, empty if it's too broken to tell
+    old_version=$("$old_app_bin" --build-vars 2>/dev/null | sed -n 's/.*"version":"\([^"]*\)".*/\1/p') || old_version=""
 fi
 
 if [ "$SERVICE" = "true" ] && [ "$service_exists" -eq 1 ]; then
@@ -299,6 +412,11 @@ default_port=$(printf '%s' "$build_vars" | sed -n 's/.*"defaultPort":\([0-9]*\).
 # release lock
 [ -n "${lock_fd:-}" ] && eval "exec $lock_fd>&-" || :
 
+# remember the channel for future updates
+if [ -n "$CHANNEL" ]; then
+    out=$("$APP_BIN" update --channel "$CHANNEL" 2>&1) || warnf 'Failed to set update channel:\n%s' "$out"
+fi
+
 # Service ---------------------------------------------------------------------
 if [ "$SERVICE" = "true" ]; then
     [ "$service_exists" -eq 1 ] && printf 'Updating service ...\n' || printf 'Setting up service ...\n'
@@ -320,6 +438,7 @@ if [ "$SERVICE" = "true" ]; then
         printf '%s\n' "[Service]"
         printf '%s\n' "Type=notify"
         printf 'ExecStart=%s %s\n' "$APP_BIN" "$safe_args"
+        printf '%s\n' 'ExecReload=/bin/kill -HUP $MAINPID'
         printf 'WorkingDirectory=%s\n' "$APP_DATA_DIR"
         printf '%s\n' "Restart=always"
         printf '%s\n' "RestartSec=1"
@@ -401,6 +520,13 @@ add_path_block "$HOME/.zshrc"
 add_path_block "$HOME/.profile"
 add_path_block "$HOME/.bash_profile"
 
+# Keep previous binary -------------------------------------------------------
+# for the app's rollback command. Reinstalling the same version keeps the older one.
+new_version=$(printf '%s' "$build_vars" | sed -n 's/.*"version":"\([^"]*\)".*/\1/p')
+if [ -n "$old_version" ] && [ "$old_version" != "$new_version" ]; then
+    install -m755 "$old_app_bin" "$PREV_BIN" || warnf 'Failed to keep previous binary for rollback'
+fi
+
 # Success! --------------------------------------------------------------------
 successf 'Installed: %s (%s)' "$APP_NAME" "$effective_version"
 warnf    'Open a new terminal or refresh this one with: exec "$SHELL" -l || exec sh -l'